@@ -33,6 +33,7 @@ Options:
     --all           Compile all files in $MROPATH.
     --json          Output abstract syntax tree as JSON.
     --strict        Strict syntax validation
+    --strict-retain Require file outputs of stages to be retained.
     --no-check-src  Do not check that stage source paths exist.
 
     -h --help       Show this message.
@@ -62,6 +63,7 @@ Options:
 		}
 	}
 	mkjson := opts["--json"].(bool)
+	strictRetain := opts["--strict-retain"].(bool)
 
 	count := 0
 	wasErr := false
@@ -73,6 +75,18 @@ Options:
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
+		if strictRetain {
+			var errs syntax.ErrorList
+			for _, ast := range asts {
+				if err := ast.CheckRetains(); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if err := errs.If(); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
 
 		if mkjson {
 			fmt.Printf("%s", syntax.JsonDumpAsts(asts))
@@ -81,19 +95,22 @@ Options:
 		count += num
 	} else {
 		// Compile just the specified MRO files.
-		var asts []*syntax.Ast
-		for _, fname := range opts["<file.mro>"].([]string) {
+		fileNames := opts["<file.mro>"].([]string)
+		for i, fname := range fileNames {
 			if !filepath.IsAbs(fname) {
-				fname = path.Join(cwd, fname)
+				fileNames[i] = path.Join(cwd, fname)
 			}
-			_, _, ast, err := syntax.Compile(fname, mroPaths, checkSrcPath)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err.Error())
-				wasErr = true
-			} else {
-				if mkjson {
-					asts = append(asts, ast)
-				}
+		}
+		parser := syntax.Parser{StrictRetain: strictRetain}
+		compiled, err := parser.CompileAll(fileNames, mroPaths, checkSrcPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			wasErr = true
+		}
+		asts := make([]*syntax.Ast, 0, len(compiled))
+		for _, ast := range compiled {
+			if ast != nil {
+				asts = append(asts, ast)
 				count++
 			}
 		}
@@ -0,0 +1,196 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Unified diff output for mrf.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The number of lines of unchanged context to print around each change.
+const diffContext = 3
+
+type diffLine struct {
+	// One of ' ', '-', or '+'.
+	kind byte
+	text string
+}
+
+// Split a string into lines, keeping the trailing newlines.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Compute a minimal line-based edit script transforming a into b, using
+// the Myers O(ND) algorithm.
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+search:
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back through the trace to recover the edit script.
+	result := make([]diffLine, 0, maxD)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			result = append(result, diffLine{' ', a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				result = append(result, diffLine{'+', b[y]})
+			} else {
+				x--
+				result = append(result, diffLine{'-', a[x]})
+			}
+		}
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// Returns true if the line looks like the start of a declaration, in the
+// same sense as diff -p, which means it begins with a letter or underscore.
+func isSectionHeading(line string) bool {
+	if line == "" {
+		return false
+	}
+	c := line[0]
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Format a hunk range in the style of diff -u.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
+
+// Write a unified diff between the given sources to w.  Nothing is written
+// if the sources are identical.
+//
+// As with diff -p, each hunk header includes the nearest preceding line
+// which starts a declaration, to make it easier to find where in the file
+// the hunk is.
+func writeUnifiedDiff(w io.Writer, fromName, toName, from, to string) error {
+	if from == to {
+		return nil
+	}
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	// The line numbers in from and to before each line of the diff.
+	aLine := make([]int, len(lines)+1)
+	bLine := make([]int, len(lines)+1)
+	var changes []int
+	for i, line := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if line.kind != '+' {
+			aLine[i+1]++
+		}
+		if line.kind != '-' {
+			bLine[i+1]++
+		}
+		if line.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", fromName, toName); err != nil {
+		return err
+	}
+	for len(changes) > 0 {
+		start := changes[0] - diffContext
+		if start < 0 {
+			start = 0
+		}
+		last := changes[0]
+		changes = changes[1:]
+		for len(changes) > 0 && changes[0]-last <= 2*diffContext {
+			last = changes[0]
+			changes = changes[1:]
+		}
+		end := last + diffContext + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+		heading := ""
+		for i := start - 1; i >= 0; i-- {
+			if lines[i].kind != '+' && isSectionHeading(lines[i].text) {
+				heading = " " + strings.TrimRight(lines[i].text, "\n")
+				break
+			}
+		}
+		if _, err := fmt.Fprintf(w, "@@ -%s +%s @@%s\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]),
+			heading); err != nil {
+			return err
+		}
+		for _, line := range lines[start:end] {
+			text := line.text
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n\\ No newline at end of file\n"
+			}
+			if _, err := fmt.Fprintf(w, "%c%s", line.kind, text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := `stage FOO(
+  in int x,
+  out int y,
+  src py "foo",
+)
+
+# comment
+# comment
+# comment
+# comment
+# comment
+
+pipeline BAR(
+  in int x,
+)
+{
+    return ()
+}`
+	to := `stage FOO(
+    in  int x,
+    out int y,
+    src py  "foo",
+)
+
+# comment
+# comment
+# comment
+# comment
+# comment
+
+pipeline BAR(
+    in int x,
+)
+{
+    return ()
+}
+`
+	var buf strings.Builder
+	if err := writeUnifiedDiff(&buf, "foo.mro", "formatted/foo.mro",
+		from, to); err != nil {
+		t.Fatal(err)
+	}
+	expect := "--- foo.mro\n" +
+		"+++ formatted/foo.mro\n" +
+		"@@ -1,7 +1,7 @@\n" +
+		" stage FOO(\n" +
+		"-  in int x,\n" +
+		"-  out int y,\n" +
+		"-  src py \"foo\",\n" +
+		"+    in  int x,\n" +
+		"+    out int y,\n" +
+		"+    src py  \"foo\",\n" +
+		" )\n" +
+		" \n" +
+		" # comment\n" +
+		"@@ -11,8 +11,8 @@ stage FOO(\n" +
+		" # comment\n" +
+		" \n" +
+		" pipeline BAR(\n" +
+		"-  in int x,\n" +
+		"+    in int x,\n" +
+		" )\n" +
+		" {\n" +
+		"     return ()\n" +
+		"-}\n" +
+		"\\ No newline at end of file\n" +
+		"+}\n"
+	if s := buf.String(); s != expect {
+		t.Errorf("Expected\n%s\nGot\n%s", expect, s)
+	}
+
+	buf.Reset()
+	if err := writeUnifiedDiff(&buf, "foo.mro", "formatted/foo.mro",
+		to, to); err != nil {
+		t.Fatal(err)
+	} else if buf.Len() != 0 {
+		t.Errorf("Expected no diff, got\n%s", buf.String())
+	}
+}
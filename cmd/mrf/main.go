@@ -8,10 +8,43 @@
 //
 //	mrf *.mrp --rewrite
 //
+// If the file name is given as -, the source is read from standard input
+// and the formatted result is written to standard output.
+//
 // mrf is an opinionated code formatter, meaning its style output is not
 // configurable.  This is a deliberate choice.  By preventing users from
 // making different style choices, pointless whitespace-only diffs should
-// be prevented and arguments about style can be avoided.
+// be prevented and arguments about style can be avoided.  The one exception
+// is the indentation width, which may be set with --indent for projects
+// which have already standardized on something other than 4 spaces, e.g.
+//
+//	mrf --indent=2 --rewrite *.mro
+//	mrf --indent=tab --rewrite *.mro
+//
+// To enforce formatting in continuous integration, use
+//
+//	mrf --check --all
+//
+// which, like gofmt -l, lists the files which are not correctly formatted
+// without modifying them, and exits with a non-zero status if there are any.
+//
+// With --organize-includes, the @include directives at the top of each file
+// are sorted and exact duplicates are removed, keeping any comments attached
+// to them.  Unlike --includes, this does not need to search MROPATH.
+//
+// With --prune-includes, @include directives for files which declare nothing
+// used by the including file, directly or through their own includes, are
+// removed.  Unlike --includes, missing includes are not added.
+//
+// With --lint, each file is also compiled and checked for questionable
+// practices, such as stages with file outputs which do not retain any of
+// them.  Problems found are listed on stderr, and mrf exits with a non-zero
+// status if there are any.
+//
+// With --dead-code, each file is also compiled, and stages and pipelines
+// declared in it which are not reachable from the top-level call or from a
+// preflight stage are listed on stderr.  mrf exits with a non-zero status
+// if there are any.
 package main
 
 import (
@@ -20,6 +53,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/martian-lang/docopt.go"
 	"github.com/martian-lang/martian/martian/syntax"
@@ -33,13 +68,34 @@ func main() {
 	doc := `Martian Formatter.
 
 Usage:
-    mrf [--rewrite] [--includes] <file.mro>...
-    mrf --all [--includes]
+    mrf [--rewrite | --check | --diff] [--includes | --prune-includes]
+        [--organize-includes] [--indent=<n>] [--lint] [--dead-code]
+        <file.mro>...
+    mrf --all [--check | --diff] [--includes | --prune-includes]
+        [--organize-includes] [--indent=<n>] [--lint] [--dead-code]
     mrf -h | --help | --version
 
 Options:
-    --rewrite     Rewrite the specified file(s) in place.
+    --rewrite     Rewrite the specified file(s) in place.  Not allowed if
+                  the source is read from standard input.
+    --check       Do not write anything.  Instead, list files which are
+                  not correctly formatted on stderr, and exit with status 1
+                  if there are any.
+    --diff        Do not write anything.  Instead, print a unified diff
+                  of the changes which formatting would make.
     --includes    Add and remove includes as appropriate.
+    --prune-includes
+                  Remove includes which are not used, without adding
+                  any which are missing.
+    --organize-includes
+                  Sort includes and remove duplicates, without adding or
+                  removing any others.
+    --indent=<n>  Indent each level by n spaces, or by a tab if n is
+                  "tab".  [default: 4]
+    --lint        After formatting, compile each file and report any
+                  lint rule violations on stderr.
+    --dead-code   After formatting, compile each file and report any
+                  stages or pipelines which are never called on stderr.
     --all         Rewrite all files in MROPATH.
     -h --help     Show this message.
     --version     Show version.`
@@ -54,6 +110,20 @@ Options:
 	}
 
 	fixIncludes := opts["--includes"].(bool)
+	check := opts["--check"].(bool)
+	diff := opts["--diff"].(bool)
+	var options syntax.FormatOptions
+	if indent, err := parseIndent(opts["--indent"].(string)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	} else {
+		options.Indent = indent
+	}
+	options.OrganizeIncludes = opts["--organize-includes"].(bool)
+	options.PruneIncludes = opts["--prune-includes"].(bool)
+	lint := opts["--lint"].(bool)
+	deadCode := opts["--dead-code"].(bool)
+	var parser syntax.Parser
 	if opts["--all"].(bool) {
 		// Format all MRO files in MRO path.
 		fileNames := make([]string, 0, len(mroPaths)*3)
@@ -62,23 +132,193 @@ Options:
 			util.DieIf(err)
 			fileNames = append(fileNames, fnames...)
 		}
-		var parser syntax.Parser
+		badCount := 0
+		failed := false
 		for _, fname := range fileNames {
-			fsrc, err := parser.FormatFile(fname, fixIncludes, mroPaths)
+			src, fsrc, err := formatFile(&parser, fname, fixIncludes, mroPaths, &options)
 			util.DieIf(err)
-			ioutil.WriteFile(fname, []byte(fsrc), 0644)
+			if lint && !lintFile(&parser, fname, src, mroPaths) {
+				failed = true
+			}
+			if deadCode && !deadCodeFile(&parser, fname, src, mroPaths) {
+				failed = true
+			}
+			if check {
+				if !checkFormat(fname, src, fsrc) {
+					badCount++
+				}
+			} else if diff {
+				util.DieIf(printDiff(fname, src, fsrc))
+			} else {
+				ioutil.WriteFile(fname, []byte(fsrc), 0644)
+			}
+		}
+		if check {
+			if badCount > 0 {
+				fmt.Fprintf(os.Stderr,
+					"%d of %d files are not correctly formatted.\n",
+					badCount, len(fileNames))
+				os.Exit(1)
+			}
+			fmt.Printf("All %d files are correctly formatted.\n", len(fileNames))
+		} else if !diff {
+			fmt.Printf("Successfully reformatted %d files.\n", len(fileNames))
+		}
+		if failed {
+			os.Exit(1)
 		}
-		fmt.Printf("Successfully reformatted %d files.\n", len(fileNames))
 	} else {
 		// Format just the specified MRO files.
-		for _, fname := range opts["<file.mro>"].([]string) {
-			fsrc, err := syntax.FormatFile(fname, fixIncludes, mroPaths)
+		fileNames := opts["<file.mro>"].([]string)
+		if opts["--rewrite"].(bool) {
+			for _, fname := range fileNames {
+				if fname == stdinName {
+					fmt.Fprintln(os.Stderr,
+						"Cannot rewrite source read from standard input.")
+					os.Exit(1)
+				}
+			}
+		}
+		ok := true
+		for _, fname := range fileNames {
+			src, fsrc, err := formatFile(&parser, fname, fixIncludes, mroPaths, &options)
 			util.DieIf(err)
-			if opts["--rewrite"].(bool) {
+			if lint {
+				ok = lintFile(&parser, fname, src, mroPaths) && ok
+			}
+			if deadCode {
+				ok = deadCodeFile(&parser, fname, src, mroPaths) && ok
+			}
+			if check {
+				ok = checkFormat(fname, src, fsrc) && ok
+			} else if diff {
+				util.DieIf(printDiff(fname, src, fsrc))
+			} else if opts["--rewrite"].(bool) {
 				ioutil.WriteFile(fname, []byte(fsrc), 0644)
 			} else {
 				fmt.Print(fsrc)
 			}
 		}
+		if !ok {
+			os.Exit(1)
+		}
+	}
+}
+
+// The file name used to request reading source from standard input.
+const stdinName = "-"
+
+// Parse the value of the --indent option, which is either a number of
+// spaces or "tab".
+func parseIndent(opt string) (string, error) {
+	if opt == "tab" {
+		return "\t", nil
+	}
+	n, err := strconv.Atoi(opt)
+	if err != nil || n < 1 || n > 8 {
+		return "", fmt.Errorf(
+			"Invalid indent '%s': must be \"tab\" or a number of spaces from 1 to 8.",
+			opt)
+	}
+	return strings.Repeat(" ", n), nil
+}
+
+// Read and format the given file, returning both the original and the
+// formatted source.
+//
+// If the file name is "-", the source is read from standard input, and
+// includes are resolved relative to the current working directory.
+func formatFile(parser *syntax.Parser, fname string,
+	fixIncludes bool, mroPaths []string,
+	options *syntax.FormatOptions) ([]byte, string, error) {
+	var src []byte
+	var err error
+	srcPath := fname
+	if fname == stdinName {
+		src, err = ioutil.ReadAll(os.Stdin)
+		srcPath = "<stdin>"
+	} else {
+		src, err = ioutil.ReadFile(fname)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	fsrc, err := parser.FormatSrcBytesOptions(src, srcPath, fixIncludes,
+		mroPaths, options)
+	return src, fsrc, err
+}
+
+// Compile the given source and check it against the default lint rules.
+// Compilation errors and lint violations for declarations in the file
+// itself are printed to stderr.  Returns true if there were none.
+func lintFile(parser *syntax.Parser, fname string, src []byte,
+	mroPaths []string) bool {
+	srcPath := fname
+	if fname == stdinName {
+		srcPath = "<stdin>"
+	}
+	_, _, ast, _, err := parser.ParseSourceBytes(src, srcPath, mroPaths, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return false
+	}
+	absPath, _ := filepath.Abs(srcPath)
+	ok := true
+	for _, v := range syntax.Lint(ast, syntax.DefaultLintConfig()) {
+		if v.Node.Loc.File != nil && v.Node.Loc.File.FullPath == absPath {
+			fmt.Fprintln(os.Stderr, v.String())
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Compile the given source and report the stages and pipelines declared in
+// the file itself which are never called.  Returns true if there were none.
+func deadCodeFile(parser *syntax.Parser, fname string, src []byte,
+	mroPaths []string) bool {
+	srcPath := fname
+	if fname == stdinName {
+		srcPath = "<stdin>"
 	}
+	_, _, ast, _, err := parser.ParseSourceBytes(src, srcPath, mroPaths, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return false
+	}
+	absPath, _ := filepath.Abs(srcPath)
+	ok := true
+	for _, callable := range ast.UnusedCallables() {
+		var loc *syntax.SourceLoc
+		switch c := callable.(type) {
+		case *syntax.Stage:
+			loc = &c.Node.Loc
+		case *syntax.Pipeline:
+			loc = &c.Node.Loc
+		}
+		if loc == nil || loc.File == nil || loc.File.FullPath != absPath {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "MRO DEAD CODE: %s %s is never called\n    at %s\n",
+			callable.Type(), callable.GetId(), loc.String())
+		ok = false
+	}
+	return ok
+}
+
+// Returns true if the formatted source is the same as the original.
+// Otherwise, prints the file name to stderr.
+func checkFormat(fname string, src []byte, fsrc string) bool {
+	if string(src) == fsrc {
+		return true
+	}
+	fmt.Fprintln(os.Stderr, fname)
+	return false
+}
+
+// Print a unified diff of the changes formatting would make to stdout.
+// Prints nothing if the file is already correctly formatted.
+func printDiff(fname string, src []byte, fsrc string) error {
+	return writeUnifiedDiff(os.Stdout, fname,
+		path.Join("formatted", fname), string(src), fsrc)
 }
@@ -0,0 +1,28 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseIndent(t *testing.T) {
+	for opt, expect := range map[string]string{
+		"4":   "    ",
+		"2":   "  ",
+		"tab": "\t",
+	} {
+		if indent, err := parseIndent(opt); err != nil {
+			t.Errorf("Unexpected error for %q: %v", opt, err)
+		} else if indent != expect {
+			t.Errorf("Expected %q for %q, got %q", expect, opt, indent)
+		}
+	}
+	for _, opt := range []string{"", "0", "-1", "9", "tabs"} {
+		if _, err := parseIndent(opt); err == nil {
+			t.Errorf("Expected an error for %q", opt)
+		}
+	}
+}
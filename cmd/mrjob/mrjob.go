@@ -122,6 +122,10 @@ func (self *runner) writeJobinfo() {
 	self.jobInfo.Host, _ = os.Hostname()
 	self.jobInfo.Pid = os.Getpid()
 	self.jobInfo.ClusterEnv = getClusterEnv()
+	// Record the start time, so that mrp can enforce stage timeouts.
+	self.jobInfo.WallClockInfo = &core.WallClockInfo{
+		Start: self.start.Format(util.TIMEFMT),
+	}
 	if err := self.metadata.WriteAtomic(core.JobInfoFile, self.jobInfo); err != nil {
 		self.Fail(err, "Could not write updated jobInfo.")
 	}
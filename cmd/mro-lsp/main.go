@@ -0,0 +1,48 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian language server for MRO files.
+//
+// mro-lsp implements the language server protocol over standard input and
+// output, for use by editors.  It supports diagnostics, completion, hover,
+// and go to definition.  Documents are synchronized in full on each change.
+//
+// Includes are resolved relative to the including file, and then using
+// MROPATH, as for mrc.  Included files which have not changed are only
+// parsed once, even if they are included by several open documents.
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	// Standard output is reserved for the protocol.
+	util.SetPrintLogger(os.Stderr)
+	doc := `Martian Language Server.
+
+Usage:
+    mro-lsp
+    mro-lsp -h | --help | --version
+
+Options:
+    -h --help     Show this message.
+    --version     Show version.`
+	martianVersion := util.GetVersion()
+	docopt.Parse(doc, nil, true, martianVersion, false)
+
+	// Martian environment variables.
+	cwd, _ := filepath.Abs(path.Dir(os.Args[0]))
+	mroPaths := util.ParseMroPath(cwd)
+	if value := os.Getenv("MROPATH"); len(value) > 0 {
+		mroPaths = util.ParseMroPath(value)
+	}
+
+	os.Exit(newServer(os.Stdin, os.Stdout, mroPaths).run())
+}
@@ -0,0 +1,628 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// An open text document.
+type document struct {
+	uri  string
+	path string
+	text string
+
+	// The most recent AST successfully produced from the document.  This
+	// is kept while the document has errors, so that completion and
+	// navigation continue to work while it is being edited.
+	ast *syntax.Ast
+}
+
+type server struct {
+	conn     *conn
+	mroPaths []string
+
+	// The parser is shared across all documents, so that files which are
+	// included by several of them, or which have not changed between
+	// edits, are only parsed once.
+	parser syntax.Parser
+
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+func newServer(r io.Reader, w io.Writer, mroPaths []string) *server {
+	return &server{
+		conn:     newConn(r, w),
+		mroPaths: mroPaths,
+		docs:     make(map[string]*document),
+	}
+}
+
+// Serve requests until the client sends an exit notification or closes
+// the input.  Returns the process exit code.
+func (s *server) run() int {
+	for {
+		req, err := s.conn.read()
+		if err == io.EOF {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		} else if rerr, ok := err.(*responseError); ok {
+			if err := s.conn.reply(nil, nil, rerr); err != nil {
+				util.PrintError(err, "lsp", "Failed to write response.")
+				return 1
+			}
+			continue
+		} else if err != nil {
+			util.PrintError(err, "lsp", "Failed to read message.")
+			return 1
+		}
+		if req.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		result, err := s.handle(req)
+		if req.ID != nil {
+			if err := s.conn.reply(req.ID, result, err); err != nil {
+				util.PrintError(err, "lsp", "Failed to write response.")
+				return 1
+			}
+		} else if err != nil {
+			util.PrintError(err, "lsp", "Error handling %s", req.Method)
+		}
+	}
+}
+
+func (s *server) handle(req *request) (interface{}, error) {
+	if !s.initialized && req.Method != "initialize" {
+		if req.ID == nil {
+			return nil, nil
+		}
+		return nil, &responseError{
+			Code:    codeServerNotInitialized,
+			Message: "server not initialized",
+		}
+	}
+	switch req.Method {
+	case "initialize":
+		s.initialized = true
+		return &initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync: syncFull,
+				CompletionProvider: &completionOptions{
+					TriggerCharacters: []string{"."},
+				},
+				HoverProvider:      true,
+				DefinitionProvider: true,
+			},
+			ServerInfo: serverInfo{
+				Name:    "mro-lsp",
+				Version: util.GetVersion(),
+			},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenTextDocumentParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.didOpen(&params)
+	case "textDocument/didChange":
+		var params didChangeTextDocumentParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.didChange(&params)
+	case "textDocument/didClose":
+		var params didCloseTextDocumentParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.didClose(&params)
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(&params), nil
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(&params), nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(&params), nil
+	}
+	if req.ID == nil {
+		// Unknown notifications are ignored.
+		return nil, nil
+	}
+	return nil, &responseError{
+		Code:    codeMethodNotFound,
+		Message: "method not found: " + req.Method,
+	}
+}
+
+func unmarshalParams(req *request, params interface{}) error {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return &responseError{
+			Code:    codeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+//
+// Document synchronization
+//
+
+func (s *server) didOpen(params *didOpenTextDocumentParams) error {
+	doc := &document{
+		uri:  params.TextDocument.URI,
+		path: uriToPath(params.TextDocument.URI),
+		text: params.TextDocument.Text,
+	}
+	s.docs[doc.uri] = doc
+	return s.update(doc)
+}
+
+func (s *server) didChange(params *didChangeTextDocumentParams) error {
+	doc := s.docs[params.TextDocument.URI]
+	if doc == nil || len(params.ContentChanges) == 0 {
+		return nil
+	}
+	doc.text = params.ContentChanges[len(params.ContentChanges)-1].Text
+	return s.update(doc)
+}
+
+func (s *server) didClose(params *didCloseTextDocumentParams) error {
+	delete(s.docs, params.TextDocument.URI)
+	// Clear any diagnostics for the closed document.
+	return s.conn.notify("textDocument/publishDiagnostics",
+		&publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []diagnostic{},
+		})
+}
+
+// Parse and compile the document, and publish the resulting diagnostics.
+func (s *server) update(doc *document) error {
+	_, _, ast, warnings, err := s.parser.ParseSourceBytes(
+		[]byte(doc.text), doc.path, s.mroPaths, false)
+	if ast != nil {
+		doc.ast = ast
+	}
+	diags := make([]diagnostic, 0, len(warnings))
+	var errs syntax.ErrorList
+	if list, ok := err.(syntax.ErrorList); ok {
+		errs = list
+	} else if err != nil {
+		errs = syntax.ErrorList{err}
+	}
+	for _, e := range errs {
+		msg := e.Error()
+		if astErr, ok := e.(*syntax.AstError); ok {
+			msg = astErr.Msg
+		}
+		loc, _ := syntax.ErrorLoc(e)
+		diags = append(diags, diagnostic{
+			Range:    doc.lineRange(&loc),
+			Severity: severityError,
+			Source:   "mro",
+			Message:  msg,
+		})
+	}
+	for _, w := range warnings {
+		diags = append(diags, diagnostic{
+			Range:    doc.lineRange(&w.Node.Loc),
+			Severity: severityWarning,
+			Source:   "mro",
+			Message:  w.Msg,
+		})
+	}
+	return s.conn.notify("textDocument/publishDiagnostics",
+		&publishDiagnosticsParams{
+			URI:         doc.uri,
+			Diagnostics: diags,
+		})
+}
+
+// Get the range from the given location to the end of its line.  Locations
+// in other files are reported at the start of the document.
+func (doc *document) lineRange(loc *syntax.SourceLoc) textRange {
+	if loc.File == nil || loc.File.FullPath != doc.path || loc.Line < 1 {
+		return textRange{}
+	}
+	start := toPosition(doc.text, loc.Line, loc.Col)
+	line := lineText(doc.text, loc.Line-1)
+	return textRange{
+		Start: start,
+		End: position{
+			Line:      start.Line,
+			Character: utf16Len(line),
+		},
+	}
+}
+
+//
+// Navigation
+//
+
+// Resolve the identifier at the given position in the document.
+func (s *server) resolve(params *textDocumentPositionParams) (*document, syntax.AstNodable) {
+	doc := s.docs[params.TextDocument.URI]
+	if doc == nil || doc.ast == nil {
+		return doc, nil
+	}
+	line, col := fromPosition(doc.text, params.Position)
+	if dec, ok := doc.ast.ResolveAt(doc.path, line, col); ok {
+		return doc, dec
+	}
+	return doc, nil
+}
+
+func (s *server) definition(params *textDocumentPositionParams) interface{} {
+	_, dec := s.resolve(params)
+	if dec == nil {
+		return nil
+	}
+	loc := syntax.DefiningLoc(dec)
+	if loc.File == nil {
+		return nil
+	}
+	pos := toPosition(s.fileText(loc.File.FullPath), loc.Line, loc.Col)
+	return &location{
+		URI: pathToURI(loc.File.FullPath),
+		Range: textRange{
+			Start: pos,
+			End:   pos,
+		},
+	}
+}
+
+// Get the text of the given file, from the open document if there is one,
+// or otherwise from disk.
+func (s *server) fileText(path string) string {
+	for _, doc := range s.docs {
+		if doc.path == path {
+			return doc.text
+		}
+	}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		return string(b)
+	}
+	return ""
+}
+
+func (s *server) hover(params *textDocumentPositionParams) interface{} {
+	doc, dec := s.resolve(params)
+	if dec == nil {
+		return nil
+	}
+	if call, ok := dec.(*syntax.CallStm); ok {
+		if callable := doc.ast.Callables.Table[call.DecId]; callable != nil {
+			dec = callable
+		}
+	}
+	text := describe(dec)
+	if text == "" {
+		return nil
+	}
+	return &hover{
+		Contents: markupContent{
+			Kind:  "markdown",
+			Value: text,
+		},
+	}
+}
+
+func typeString(tname string, arrayDim int) string {
+	return tname + strings.Repeat("[]", arrayDim)
+}
+
+// Get a markdown description of a declaration.
+func describe(dec syntax.AstNodable) string {
+	var buf strings.Builder
+	switch dec := dec.(type) {
+	case *syntax.Stage:
+		buf.WriteString("```\nstage ")
+		describeParams(&buf, dec.Id, dec.InParams, dec.OutParams)
+		buf.WriteString("```")
+		writeDoc(&buf, dec.Doc)
+		if dec.Deprecated != "" {
+			buf.WriteString("\n\n**Deprecated:** ")
+			buf.WriteString(dec.Deprecated)
+		}
+	case *syntax.Pipeline:
+		buf.WriteString("```\npipeline ")
+		describeParams(&buf, dec.Id, dec.InParams, dec.OutParams)
+		buf.WriteString("```")
+		writeDoc(&buf, dec.Doc)
+	case *syntax.InParam:
+		buf.WriteString("```\nin ")
+		buf.WriteString(typeString(dec.Tname, int(dec.ArrayDim)))
+		buf.WriteRune(' ')
+		buf.WriteString(dec.Id)
+		buf.WriteString("\n```")
+		writeDoc(&buf, dec.Help)
+		writeDoc(&buf, dec.Doc)
+	case *syntax.OutParam:
+		buf.WriteString("```\nout ")
+		buf.WriteString(typeString(dec.Tname, int(dec.ArrayDim)))
+		buf.WriteRune(' ')
+		buf.WriteString(dec.Id)
+		buf.WriteString("\n```")
+		writeDoc(&buf, dec.Help)
+		writeDoc(&buf, dec.Doc)
+	}
+	return buf.String()
+}
+
+// Add a paragraph of documentation to a description.
+func writeDoc(buf *strings.Builder, doc string) {
+	if doc != "" {
+		buf.WriteString("\n\n")
+		buf.WriteString(doc)
+	}
+}
+
+func describeParams(buf *strings.Builder, id string,
+	ins *syntax.InParams, outs *syntax.OutParams) {
+	buf.WriteString(id)
+	buf.WriteString("(\n")
+	if ins != nil {
+		for _, param := range ins.List {
+			buf.WriteString("    in  ")
+			buf.WriteString(typeString(param.Tname, int(param.ArrayDim)))
+			buf.WriteRune(' ')
+			buf.WriteString(param.Id)
+			buf.WriteString(",\n")
+		}
+	}
+	if outs != nil {
+		for _, param := range outs.List {
+			buf.WriteString("    out ")
+			buf.WriteString(typeString(param.Tname, int(param.ArrayDim)))
+			if param.Id != "default" {
+				buf.WriteRune(' ')
+				buf.WriteString(param.Id)
+			}
+			buf.WriteString(",\n")
+		}
+	}
+	buf.WriteString(")\n")
+}
+
+//
+// Completion
+//
+
+var keywords = [...]string{
+	"as", "call", "disabled", "disk_space_gb", "enum", "env", "filetype",
+	"in", "local", "mem_gb", "out", "pipeline", "preflight", "priority",
+	"retain", "retries", "return", "self", "special", "split", "src", "stage",
+	"struct", "sweep", "threads", "timeout", "using", "volatile",
+}
+
+var builtinTypes = [...]string{
+	"bool", "file", "float", "int", "map", "path", "string",
+}
+
+var (
+	selfRefRe = regexp.MustCompile(`\bself\.\w*$`)
+	callRefRe = regexp.MustCompile(`\b(\w+)\.\w*$`)
+)
+
+func (s *server) completion(params *textDocumentPositionParams) []completionItem {
+	doc := s.docs[params.TextDocument.URI]
+	if doc == nil {
+		return nil
+	}
+	line, col := fromPosition(doc.text, params.Position)
+	prefix := lineText(doc.text, line-1)
+	if col-1 <= len(prefix) {
+		prefix = prefix[:col-1]
+	}
+	if doc.ast != nil {
+		if selfRefRe.MatchString(prefix) {
+			return selfCompletions(doc, line)
+		} else if m := callRefRe.FindStringSubmatch(prefix); m != nil {
+			return callCompletions(doc, line, m[1])
+		}
+	}
+	items := make([]completionItem, 0, len(keywords)+len(builtinTypes))
+	for _, kw := range keywords {
+		items = append(items, completionItem{
+			Label: kw,
+			Kind:  completionKeyword,
+		})
+	}
+	types := make(map[string]struct{}, len(builtinTypes))
+	for _, t := range builtinTypes {
+		types[t] = struct{}{}
+	}
+	if doc.ast != nil {
+		for t := range doc.ast.TypeTable {
+			types[t] = struct{}{}
+		}
+		for _, callable := range doc.ast.Callables.List {
+			items = append(items, completionItem{
+				Label:  callable.GetId(),
+				Kind:   completionFunction,
+				Detail: callable.Type(),
+			})
+		}
+	}
+	typeNames := make([]string, 0, len(types))
+	for t := range types {
+		typeNames = append(typeNames, t)
+	}
+	sort.Strings(typeNames)
+	for _, t := range typeNames {
+		items = append(items, completionItem{
+			Label:  t,
+			Kind:   completionClass,
+			Detail: "type",
+		})
+	}
+	return items
+}
+
+// Find the pipeline in the document enclosing the given line.
+func enclosingPipeline(doc *document, line int) *syntax.Pipeline {
+	var found *syntax.Pipeline
+	for _, pipeline := range doc.ast.Pipelines {
+		if loc := pipeline.Node.Loc; loc.File != nil &&
+			loc.File.FullPath == doc.path && loc.Line <= line &&
+			(found == nil || loc.Line > found.Node.Loc.Line) {
+			found = pipeline
+		}
+	}
+	return found
+}
+
+func selfCompletions(doc *document, line int) []completionItem {
+	pipeline := enclosingPipeline(doc, line)
+	if pipeline == nil || pipeline.InParams == nil {
+		return nil
+	}
+	items := make([]completionItem, 0, len(pipeline.InParams.List))
+	for _, param := range pipeline.InParams.List {
+		items = append(items, completionItem{
+			Label:  param.Id,
+			Kind:   completionField,
+			Detail: typeString(param.Tname, int(param.ArrayDim)),
+		})
+	}
+	return items
+}
+
+func callCompletions(doc *document, line int, callId string) []completionItem {
+	pipeline := enclosingPipeline(doc, line)
+	if pipeline == nil {
+		return nil
+	}
+	for _, call := range pipeline.Calls {
+		if call.Id != callId {
+			continue
+		}
+		callable := doc.ast.Callables.Table[call.DecId]
+		if callable == nil || callable.GetOutParams() == nil {
+			return nil
+		}
+		outs := callable.GetOutParams().List
+		items := make([]completionItem, 0, len(outs))
+		for _, param := range outs {
+			items = append(items, completionItem{
+				Label:  param.Id,
+				Kind:   completionField,
+				Detail: typeString(param.Tname, int(param.ArrayDim)),
+			})
+		}
+		return items
+	}
+	return nil
+}
+
+//
+// Position conversion
+//
+
+// Get the text of the given 0-based line.
+func lineText(text string, line int) string {
+	for i := 0; i < line; i++ {
+		nl := strings.IndexByte(text, '\n')
+		if nl < 0 {
+			return ""
+		}
+		text = text[nl+1:]
+	}
+	if nl := strings.IndexByte(text, '\n'); nl >= 0 {
+		text = text[:nl]
+	}
+	return strings.TrimSuffix(text, "\r")
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// Convert an LSP position, with a 0-based line and a character offset in
+// UTF-16 code units, into the 1-based line and byte column used by the
+// parser.
+func fromPosition(text string, pos position) (int, int) {
+	line := lineText(text, pos.Line)
+	col, units := 0, 0
+	for col < len(line) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(line[col:])
+		units += len(utf16.Encode([]rune{r}))
+		col += size
+	}
+	return pos.Line + 1, col + 1
+}
+
+// Convert a 1-based line and byte column into an LSP position.
+func toPosition(text string, line, col int) position {
+	if line < 1 {
+		return position{}
+	}
+	if col < 1 {
+		col = 1
+	}
+	lt := lineText(text, line-1)
+	if col-1 > len(lt) {
+		return position{Line: line - 1, Character: col - 1}
+	}
+	return position{
+		Line:      line - 1,
+		Character: utf16Len(lt[:col-1]),
+	}
+}
+
+func uriToPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return filepath.FromSlash(u.Path)
+	}
+	return uri
+}
+
+func pathToURI(path string) string {
+	u := url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(path),
+	}
+	return u.String()
+}
@@ -0,0 +1,246 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const stagesSrc = `# Square a number.
+stage SQUARE(
+    in  int value  "The value to square",
+    out int square,
+    src py  "stages/square",
+)
+`
+
+const pipelineSrc = `@include "stages.mro"
+
+pipeline SUM_SQUARES(
+    in  int a,
+    out int sum,
+)
+{
+    call SQUARE(
+        value = self.a,
+    )
+
+    return (
+        sum = SQUARE.square,
+    )
+}
+`
+
+type testClient struct {
+	t   *testing.T
+	in  bytes.Buffer
+	id  int
+	uri string
+}
+
+func (c *testClient) send(method string, params interface{}, isRequest bool) {
+	c.t.Helper()
+	msg := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+	if isRequest {
+		c.id++
+		msg["id"] = c.id
+	}
+	if err := newConn(nil, &c.in).write(msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) position(method string, line, char int) {
+	c.t.Helper()
+	c.send(method, map[string]interface{}{
+		"textDocument": map[string]string{"uri": c.uri},
+		"position":     map[string]int{"line": line, "character": char},
+	}, true)
+}
+
+type testMessage struct {
+	ID     *int             `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+	Result json.RawMessage  `json:"result"`
+	Error  *json.RawMessage `json:"error"`
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mro-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "stages.mro"),
+		[]byte(stagesSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainPath := filepath.Join(dir, "pipeline.mro")
+	client := testClient{t: t, uri: pathToURI(mainPath)}
+
+	client.send("initialize", map[string]interface{}{}, true)
+	client.send("initialized", map[string]interface{}{}, false)
+	client.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"uri":        client.uri,
+			"languageId": "mro",
+			"version":    1,
+			"text":       pipelineSrc,
+		},
+	}, false)
+	// Hover over the callable name in the call.
+	client.position("textDocument/hover", 7, 10)
+	// Go to the definition of the bound parameter.
+	client.position("textDocument/definition", 8, 9)
+	// Complete the outputs of SQUARE.
+	client.send("textDocument/didChange", map[string]interface{}{
+		"textDocument": map[string]string{"uri": client.uri},
+		"contentChanges": []map[string]string{{
+			"text": strings.Replace(pipelineSrc,
+				"sum = SQUARE.square", "sum = SQUARE.", 1),
+		}},
+	}, false)
+	client.position("textDocument/completion", 12, 21)
+	client.send("shutdown", nil, true)
+	client.send("exit", nil, false)
+
+	var out bytes.Buffer
+	if code := newServer(&client.in, &out, nil).run(); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	msgs := decodeAll(t, out.Bytes())
+	if len(msgs) != 7 {
+		t.Fatalf("Expected 7 messages, got %d", len(msgs))
+	}
+	if msgs[0].ID == nil || *msgs[0].ID != 1 ||
+		!bytes.Contains(msgs[0].Result, []byte(`"hoverProvider":true`)) {
+		t.Errorf("Bad initialize response %s", msgs[0].Result)
+	}
+
+	var diags publishDiagnosticsParams
+	if msgs[1].Method != "textDocument/publishDiagnostics" {
+		t.Errorf("Expected diagnostics, got %s", msgs[1].Method)
+	} else if err := json.Unmarshal(msgs[1].Params, &diags); err != nil {
+		t.Error(err)
+	} else if len(diags.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", diags.Diagnostics)
+	}
+
+	var h hover
+	if err := json.Unmarshal(msgs[2].Result, &h); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(h.Contents.Value, "stage SQUARE(") ||
+		!strings.Contains(h.Contents.Value, "in  int value,") ||
+		!strings.HasSuffix(h.Contents.Value, "```\n\nSquare a number.") {
+		t.Errorf("Bad hover text %q", h.Contents.Value)
+	}
+
+	var loc location
+	if err := json.Unmarshal(msgs[3].Result, &loc); err != nil {
+		t.Error(err)
+	} else if loc.URI != pathToURI(filepath.Join(dir, "stages.mro")) ||
+		loc.Range.Start.Line != 2 || loc.Range.Start.Character != 4 {
+		t.Errorf("Bad definition %v", loc)
+	}
+
+	// The incomplete reference is a syntax error.
+	if err := json.Unmarshal(msgs[4].Params, &diags); err != nil {
+		t.Error(err)
+	} else if len(diags.Diagnostics) != 1 {
+		t.Errorf("Expected one diagnostic, got %v", diags.Diagnostics)
+	} else if d := diags.Diagnostics[0]; d.Severity != severityError ||
+		d.Range.Start.Line != 12 {
+		t.Errorf("Bad diagnostic %v", d)
+	}
+
+	var items []completionItem
+	if err := json.Unmarshal(msgs[5].Result, &items); err != nil {
+		t.Error(err)
+	} else if len(items) != 1 || items[0].Label != "square" {
+		t.Errorf("Expected to complete square, got %v", items)
+	}
+
+	if msgs[6].ID == nil || *msgs[6].ID != 5 || msgs[6].Error != nil {
+		t.Errorf("Bad shutdown response")
+	}
+}
+
+// Decode the messages written by the server.
+func decodeAll(t *testing.T, out []byte) []testMessage {
+	t.Helper()
+	var msgs []testMessage
+	for len(out) > 0 {
+		end := bytes.Index(out, []byte("\r\n\r\n"))
+		if end < 0 {
+			t.Fatalf("Missing header in %q", out)
+		}
+		header := string(out[:end])
+		length, err := strconv.Atoi(strings.TrimPrefix(header, "Content-Length: "))
+		if err != nil {
+			t.Fatalf("Bad header %q: %v", header, err)
+		}
+		body := out[end+4 : end+4+length]
+		out = out[end+4+length:]
+		var msg testMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestNotInitialized(t *testing.T) {
+	client := testClient{t: t, uri: "file:///test.mro"}
+	client.position("textDocument/hover", 0, 0)
+	var out bytes.Buffer
+	if code := newServer(&client.in, &out, nil).run(); code != 1 {
+		t.Errorf("Expected exit code 1 without shutdown, got %d", code)
+	}
+	msgs := decodeAll(t, out.Bytes())
+	if len(msgs) != 1 || msgs[0].Error == nil {
+		t.Fatalf("Expected an error response, got %v", msgs)
+	}
+	if !bytes.Contains(*msgs[0].Error, []byte("-32002")) {
+		t.Errorf("Expected ServerNotInitialized, got %s", *msgs[0].Error)
+	}
+}
+
+func TestPositionConversion(t *testing.T) {
+	text := "abc\n  \"é😀\" x\r\nlast"
+	for _, c := range []struct {
+		pos       position
+		line, col int
+	}{
+		{position{0, 0}, 1, 1},
+		{position{0, 2}, 1, 3},
+		// é is 2 bytes and 1 UTF-16 unit; 😀 is 4 bytes and 2 units.
+		{position{1, 4}, 2, 6},
+		{position{1, 7}, 2, 11},
+		{position{2, 4}, 3, 5},
+	} {
+		if line, col := fromPosition(text, c.pos); line != c.line || col != c.col {
+			t.Errorf("Expected %v -> %d:%d, got %d:%d",
+				c.pos, c.line, c.col, line, col)
+		}
+		if pos := toPosition(text, c.line, c.col); pos != c.pos {
+			t.Errorf("Expected %d:%d -> %v, got %v",
+				c.line, c.col, c.pos, pos)
+		}
+	}
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/martian-lang/martian/martian/syntax"
 )
 
-func writeStageChunkDef(buffer *bytes.Buffer, prefix string, stage *syntax.Stage) {
+func writeStageChunkDef(buffer *bytes.Buffer, ast *syntax.Ast, prefix string, stage *syntax.Stage) {
 	if len(stage.ChunkIns.List) > 0 {
 		// chunk def
 		fmt.Fprintf(buffer, `
@@ -20,7 +20,7 @@ type %sChunkDef struct {`,
 			stage.Id, prefix)
 		buffer.WriteString("\n\t*core.JobResources `json:\",omitempty\"`\n")
 		for _, param := range stage.ChunkIns.List {
-			writeParam(buffer, param)
+			writeParam(buffer, ast, param)
 		}
 		fmt.Fprintf(buffer, `}
 
@@ -80,7 +80,7 @@ func writeKeyMarshaller(buffer *bytes.Buffer, param syntax.Param, i int) {
 	}`)
 }
 
-func writeStageChunkOuts(buffer *bytes.Buffer, prefix string, stage *syntax.Stage) {
+func writeStageChunkOuts(buffer *bytes.Buffer, ast *syntax.Ast, prefix string, stage *syntax.Stage) {
 	if len(stage.ChunkOuts.List) > 0 && len(stage.OutParams.List) > 0 {
 		fmt.Fprintf(buffer, `
 // A structure to encode outs from the chunks for %s.
@@ -89,7 +89,7 @@ type %sChunkOuts struct {
 `,
 			stage.Id, prefix, prefix)
 		for _, param := range stage.ChunkOuts.List {
-			writeParam(buffer, param)
+			writeParam(buffer, ast, param)
 		}
 		fmt.Fprintf(buffer, `}
 
@@ -119,7 +119,7 @@ type %sChunkOuts struct {
 `,
 			stage.Id, prefix)
 		for _, param := range stage.ChunkOuts.List {
-			writeParam(buffer, param)
+			writeParam(buffer, ast, param)
 		}
 		buffer.WriteString("}\n")
 	}
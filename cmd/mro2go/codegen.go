@@ -49,7 +49,7 @@ import (
 		}
 	}
 	for _, stage := range stages {
-		writeStageStructs(&buffer, stage)
+		writeStageStructs(&buffer, ast, stage)
 	}
 	return buffer.String()
 }
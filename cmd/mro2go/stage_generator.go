@@ -12,18 +12,18 @@ import (
 	"unicode"
 )
 
-func writeStageStructs(buffer *bytes.Buffer, stage *syntax.Stage) {
+func writeStageStructs(buffer *bytes.Buffer, ast *syntax.Ast, stage *syntax.Stage) {
 	prefix := GoName(stage.Id)
 
 	buffer.WriteString("//\n// ")
 	buffer.WriteString(stage.Id)
 	buffer.WriteString("\n//\n\n")
 
-	writeStageArgs(buffer, prefix, stage)
-	writeStageOuts(buffer, prefix, stage)
+	writeStageArgs(buffer, ast, prefix, stage)
+	writeStageOuts(buffer, ast, prefix, stage)
 
 	if stage.Split {
-		writeStageChunkDef(buffer, prefix, stage)
+		writeStageChunkDef(buffer, ast, prefix, stage)
 		fmt.Fprintf(buffer, `
 // A structure to decode args to the join method for %s
 type %sJoinArgs struct {
@@ -31,7 +31,7 @@ type %sJoinArgs struct {
 	%sArgs
 }
 `, stage.Id, prefix, prefix)
-		writeStageChunkOuts(buffer, prefix, stage)
+		writeStageChunkOuts(buffer, ast, prefix, stage)
 	}
 }
 
@@ -55,7 +55,7 @@ func GoName(stageName string) string {
 	return result.String()
 }
 
-func writeParam(buffer *bytes.Buffer, param syntax.Param) {
+func writeParam(buffer *bytes.Buffer, ast *syntax.Ast, param syntax.Param) {
 	var comments []string
 	switch p := param.(type) {
 	case *syntax.InParam:
@@ -129,7 +129,12 @@ func writeParam(buffer *bytes.Buffer, param syntax.Param) {
 		case "map":
 			goType = "map[string]interface{}"
 		default:
-			goType = "string"
+			if _, ok := ast.TypeTable[param.GetTname()].(*syntax.StructType); ok {
+				goType = "map[string]interface{}"
+			} else {
+				// Strings, files, and enums.
+				goType = "string"
+			}
 		}
 		fmt.Fprintf(buffer,
 			"\t%s %s%s `json:\"%s\"`\n",
@@ -140,7 +145,7 @@ func writeParam(buffer *bytes.Buffer, param syntax.Param) {
 	}
 }
 
-func writeStageArgs(buffer *bytes.Buffer, prefix string, stage *syntax.Stage) {
+func writeStageArgs(buffer *bytes.Buffer, ast *syntax.Ast, prefix string, stage *syntax.Stage) {
 	// Args
 	fmt.Fprintf(buffer,
 		"// A structure to encode and decode args to the %s stage.\n",
@@ -149,12 +154,12 @@ func writeStageArgs(buffer *bytes.Buffer, prefix string, stage *syntax.Stage) {
 		"type %sArgs struct {\n",
 		prefix)
 	for _, param := range stage.InParams.List {
-		writeParam(buffer, param)
+		writeParam(buffer, ast, param)
 	}
 	buffer.WriteString("}\n\n")
 }
 
-func writeStageOuts(buffer *bytes.Buffer, prefix string, stage *syntax.Stage) {
+func writeStageOuts(buffer *bytes.Buffer, ast *syntax.Ast, prefix string, stage *syntax.Stage) {
 	// Args
 	fmt.Fprintf(buffer,
 		"// A structure to encode and decode outs from the %s stage.\n",
@@ -163,7 +168,7 @@ func writeStageOuts(buffer *bytes.Buffer, prefix string, stage *syntax.Stage) {
 		"type %sOuts struct {\n",
 		prefix)
 	for _, param := range stage.OutParams.List {
-		writeParam(buffer, param)
+		writeParam(buffer, ast, param)
 	}
 	buffer.WriteString("}\n\n")
 }
@@ -488,23 +488,66 @@ Usage:
     mrp -h | --help | --version
 
 Options:
+    --config=PATH       Load options from a YAML or TOML file.  Options given
+                            on the command line take precedence.
     --jobmode=MODE      Job manager to use. Valid options:
-                            local (default), sge, lsf, or a .template file
+                            local (default), sge, lsf, k8s, batch, or a
+                            .template file
     --localcores=NUM    Set max cores the pipeline may request at one time.
                             Only applies to local jobs.
     --localmem=NUM      Set max GB the pipeline may request at one time.
                             Only applies to local jobs.
+    --jobtemplate=PATH  Render cluster job scripts from the Go text/template
+                            at PATH instead of the job mode's template.
+                            Only applies in cluster jobmodes.
     --mempercore=NUM    Specify min GB per core on your cluster.
                             Only applies in cluster jobmodes.
     --maxjobs=NUM       Set max jobs submitted to cluster at one time.
                             Only applies in cluster jobmodes.
+    --maxstages=NUM     Set max stages which may run at one time, regardless
+                            of the resources they use.
+    --maxrunning=NUM    Set max jobs which may run at one time, across all
+                            job managers.
+    --maxtotalmem=GB    Set max total memory which running jobs may reserve,
+                            across all job managers.
+    --maxforks=NUM      Set max forks any one stage or pipeline may have
+                            from its sweeps.  Defaults to 10000.  Use -1
+                            for no limit.
     --jobinterval=NUM   Set delay between submitting jobs to cluster, in ms.
                             Only applies in cluster jobmodes.
+    --submit-rate=NUM   Limit job submissions to NUM per second.  Jobs over
+                            the rate wait to be submitted.
+                            Only applies in cluster jobmodes.
+    --submit-burst=NUM  Allow up to NUM jobs to be submitted at once before
+                            --submit-rate applies.  Defaults to 1.
+    --submit-retries=NUM
+                        Retry job submissions which fail with transient
+                        errors up to NUM times, with exponential backoff.
+                        Only applies in cluster jobmodes.
     --limit-loadavg     Avoid scheduling jobs when the system loadavg is high.
                             Only applies to local jobs.
+    --limit-memory      Run each job in a cgroup limited to the memory it
+                            reserved.  Requires permission to create cgroups.
+                            Only applies to local jobs.
+    --memory-slack=PCT  Percentage of extra memory allowed by
+                            --limit-memory.  Defaults to 10.
+    --min-free-disk=GB  Do not start stages which declare disk_space_gb if
+                            the free space, less the space declared by
+                            running stages, would fall below GB.
+    --sample-interval=SECS
+                        Sample the memory and cpu usage of running jobs
+                        every SECS seconds, for the performance report.
+                        Only applies to local jobs.
+    --drain-timeout=SECS
+                        On SIGTERM, wait up to SECS seconds for running
+                        local jobs to finish before exiting.  Cluster jobs
+                        are left running.
 
     --vdrmode=MODE      Enables Volatile Data Removal. Valid options:
-                            post, rolling (default), or disable
+                            post, rolling (default), aggressive, or disable
+                        In aggressive mode, all stage outputs are removed
+                        once they are no longer needed, ignoring retain
+                        annotations.
 
     --nopreflight       Skips preflight stages.
     --strict=MODE       Determines how mrp reports cases where it needs to fall
@@ -519,7 +562,16 @@ Options:
                         web UI.
     --noexit            Keep UI running after pipestance completes or fails.
     --onfinish=EXEC     Run this when pipeline finishes, success or fail.
+    --state-log=PATH    Append stage state changes to PATH as
+                        newline-delimited JSON.
+    --webhook=URL       Post to URL whenever a stage completes or fails.
+    --otel-exporter=URL
+                        Export a span for each step of each stage to an
+                        OpenTelemetry collector at URL, using OTLP/HTTP.
     --zip               Zip metadata files after pipestance completes.
+    --compress-metadata
+                        Gzip the metadata files for each stage once it
+                        completes.
     --tags=TAGS         Tag pipestance with comma-separated key:value pairs.
 
     --profile=MODE      Enables stage performance profiling. Valid options:
@@ -527,12 +579,18 @@ Options:
     --stackvars         Print local variables in stage code stack trace.
     --monitor           Kill jobs that exceed requested memory resources.
     --inspect           Inspect pipestance without resetting failed stages.
+    --dry-run           Plan the jobs for each stage, without running any
+                        stage code.
     --debug             Enable debug logging for local job manager.
     --stest             Substitute real stages with stress-testing stage.
     --autoretry=NUM     Automatically retry failed runs up to NUM times.
     --retry-wait=SECS   Wait SECS seconds after a failure before attempting
                         automatic retry.  Defaults to 1 second.
     --overrides=JSON    JSON file supplying custom run conditions per stage.
+    --resource-overrides=JSON
+                        JSON file mapping stage name patterns to resources
+                        which override those requested by the stage.  The
+                        file may be edited while the pipeline is running.
     --psdir=PATH        The path to the pipestance directory.  The default is
                         to use <pipestance_name>.
     --never-local       Ignore 'local' modifiers on non-preflight stages.
@@ -566,6 +624,16 @@ Options:
 		util.LogInfo("options", "--strict=%s", level.String())
 	}
 
+	// Load options from the config file before applying the command line.
+	if value := opts["--config"]; value != nil {
+		if err := config.LoadFromFile(value.(string)); err != nil {
+			util.PrintError(err, "options",
+				"Could not load config file \"%s\"", value.(string))
+			os.Exit(1)
+		}
+		util.LogInfo("options", "--config=%s", value.(string))
+	}
+
 	// Requested cores and memory.
 	if value := opts["--localcores"]; value != nil {
 		if value, err := strconv.Atoi(value.(string)); err == nil {
@@ -635,7 +703,7 @@ Options:
 	}
 
 	// Max parallel jobs.
-	if config.JobMode != "local" {
+	if config.JobMode != "local" && config.MaxJobs == 0 {
 		config.MaxJobs = 64
 	}
 	if value := opts["--maxjobs"]; value != nil {
@@ -647,10 +715,46 @@ Options:
 		}
 	}
 	util.LogInfo("options", "--maxjobs=%d", config.MaxJobs)
+	if value := opts["--maxstages"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.MaxConcurrentStages = value
+			util.LogInfo("options", "--maxstages=%d", config.MaxConcurrentStages)
+		} else {
+			util.PrintError(err, "options", "Could not parse --maxstages value \"%s\"", opts["--maxstages"].(string))
+			os.Exit(1)
+		}
+	}
+	if value := opts["--maxrunning"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.MaxConcurrentJobs = value
+			util.LogInfo("options", "--maxrunning=%d", config.MaxConcurrentJobs)
+		} else {
+			util.PrintError(err, "options", "Could not parse --maxrunning value \"%s\"", opts["--maxrunning"].(string))
+			os.Exit(1)
+		}
+	}
+	if value := opts["--maxtotalmem"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.MaxTotalMemGB = value
+			util.LogInfo("options", "--maxtotalmem=%d", config.MaxTotalMemGB)
+		} else {
+			util.PrintError(err, "options", "Could not parse --maxtotalmem value \"%s\"", opts["--maxtotalmem"].(string))
+			os.Exit(1)
+		}
+	}
+	if value := opts["--maxforks"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.MaxForks = value
+			util.LogInfo("options", "--maxforks=%d", config.MaxForks)
+		} else {
+			util.PrintError(err, "options", "Could not parse --maxforks value \"%s\"", opts["--maxforks"].(string))
+			os.Exit(1)
+		}
+	}
 
 	// frequency (in milliseconds) that jobs will be sent to the queue
 	// (this is a minimum bound, as it may take longer to emit jobs)
-	if config.JobMode != "local" {
+	if config.JobMode != "local" && config.JobFreqMillis == 0 {
 		config.JobFreqMillis = 100
 	}
 	if value := opts["--jobinterval"]; value != nil {
@@ -663,6 +767,42 @@ Options:
 	}
 	util.LogInfo("options", "--jobinterval=%d", config.JobFreqMillis)
 
+	if value := opts["--jobtemplate"]; value != nil {
+		config.JobTemplate = value.(string)
+		util.LogInfo("options", "--jobtemplate=%s", config.JobTemplate)
+	}
+
+	if value := opts["--submit-rate"]; value != nil {
+		if value, err := strconv.ParseFloat(value.(string), 64); err == nil {
+			config.SubmitRate = value
+			util.LogInfo("options", "--submit-rate=%g", config.SubmitRate)
+		} else {
+			util.PrintError(err, "options",
+				"Could not parse --submit-rate value \"%s\"", opts["--submit-rate"].(string))
+			os.Exit(1)
+		}
+	}
+	if value := opts["--submit-burst"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.SubmitBurst = value
+			util.LogInfo("options", "--submit-burst=%d", config.SubmitBurst)
+		} else {
+			util.PrintError(err, "options",
+				"Could not parse --submit-burst value \"%s\"", opts["--submit-burst"].(string))
+			os.Exit(1)
+		}
+	}
+	if value := opts["--submit-retries"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.MaxSubmitRetries = value
+			util.LogInfo("options", "--submit-retries=%d", config.MaxSubmitRetries)
+		} else {
+			util.PrintError(err, "options",
+				"Could not parse --submit-retries value \"%s\"", opts["--submit-retries"].(string))
+			os.Exit(1)
+		}
+	}
+
 	// Compute vdrMode.
 	if value := opts["--vdrmode"]; value != nil {
 		config.VdrMode = value.(string)
@@ -673,9 +813,24 @@ Options:
 	// Compute onfinish
 	if value := opts["--onfinish"]; value != nil {
 		config.OnFinishHandler = value.(string)
+	}
+	if config.OnFinishHandler != "" {
 		core.VerifyOnFinish(config.OnFinishHandler)
 	}
 
+	if value := opts["--state-log"]; value != nil {
+		config.StateLog = value.(string)
+		util.LogInfo("options", "--state-log=%s", config.StateLog)
+	}
+	if value := opts["--webhook"]; value != nil {
+		config.StageFinishWebhook = value.(string)
+		util.LogInfo("options", "--webhook=%s", config.StageFinishWebhook)
+	}
+	if value := opts["--otel-exporter"]; value != nil {
+		config.OTELExporter = value.(string)
+		util.LogInfo("options", "--otel-exporter=%s", config.OTELExporter)
+	}
+
 	// Compute profiling mode.
 	if value := opts["--profile"]; value != nil {
 		config.ProfileMode = core.ProfileMode(value.(string))
@@ -741,20 +896,73 @@ Options:
 		}
 	}
 
+	if value := opts["--resource-overrides"]; value != nil {
+		config.ResourceOverrideFile = value.(string)
+		util.LogInfo("options", "--resource-overrides=%s",
+			config.ResourceOverrideFile)
+	}
+
 	// Compute stackVars flag.
-	config.StackVars = opts["--stackvars"].(bool)
+	config.StackVars = config.StackVars || opts["--stackvars"].(bool)
 	util.LogInfo("options", "--stackvars=%v", config.StackVars)
 
-	config.Zip = opts["--zip"].(bool)
+	config.Zip = config.Zip || opts["--zip"].(bool)
 	util.LogInfo("options", "--zip=%v", config.Zip)
 
-	config.LimitLoadavg = opts["--limit-loadavg"].(bool)
+	config.CompressMetadata = config.CompressMetadata ||
+		opts["--compress-metadata"].(bool)
+	util.LogInfo("options", "--compress-metadata=%v", config.CompressMetadata)
+
+	config.LimitLoadavg = config.LimitLoadavg || opts["--limit-loadavg"].(bool)
 	util.LogInfo("options", "--limit-loadavg=%v", config.LimitLoadavg)
 
+	config.LimitMemory = config.LimitMemory || opts["--limit-memory"].(bool)
+	util.LogInfo("options", "--limit-memory=%v", config.LimitMemory)
+	if value := opts["--memory-slack"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.MemorySlack = value
+			util.LogInfo("options", "--memory-slack=%d", config.MemorySlack)
+		} else {
+			util.PrintError(err, "options",
+				"Could not parse --memory-slack value \"%s\"", opts["--memory-slack"].(string))
+			os.Exit(1)
+		}
+	}
+	if value := opts["--min-free-disk"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.MinFreeDiskGB = value
+			util.LogInfo("options", "--min-free-disk=%d", config.MinFreeDiskGB)
+		} else {
+			util.PrintError(err, "options",
+				"Could not parse --min-free-disk value \"%s\"", opts["--min-free-disk"].(string))
+			os.Exit(1)
+		}
+	}
+	if value := opts["--sample-interval"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.SampleInterval = time.Duration(value) * time.Second
+			util.LogInfo("options", "--sample-interval=%d", value)
+		} else {
+			util.PrintError(err, "options",
+				"Could not parse --sample-interval value \"%s\"", opts["--sample-interval"].(string))
+			os.Exit(1)
+		}
+	}
+	if value := opts["--drain-timeout"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil {
+			config.DrainTimeout = time.Duration(value) * time.Second
+			util.LogInfo("options", "--drain-timeout=%d", value)
+		} else {
+			util.PrintError(err, "options",
+				"Could not parse --drain-timeout value \"%s\"", opts["--drain-timeout"].(string))
+			os.Exit(1)
+		}
+	}
+
 	noExit := opts["--noexit"].(bool)
 	util.LogInfo("options", "--noexit=%v", noExit)
 
-	config.SkipPreflight = opts["--nopreflight"].(bool)
+	config.SkipPreflight = config.SkipPreflight || opts["--nopreflight"].(bool)
 	util.LogInfo("options", "--nopreflight=%v", config.SkipPreflight)
 
 	psid := opts["<pipestance_name>"].(string)
@@ -771,10 +979,12 @@ Options:
 	}
 	stepSecs := 3
 	checkSrc := true
-	config.Monitor = opts["--monitor"].(bool)
+	config.Monitor = config.Monitor || opts["--monitor"].(bool)
 	readOnly := opts["--inspect"].(bool)
-	config.Debug = opts["--debug"].(bool)
-	config.StressTest = opts["--stest"].(bool)
+	dryRun := opts["--dry-run"].(bool)
+	util.LogInfo("options", "--dry-run=%v", dryRun)
+	config.Debug = config.Debug || opts["--debug"].(bool)
+	config.StressTest = config.StressTest || opts["--stest"].(bool)
 	envs := map[string]string{}
 	retries := core.DefaultRetries()
 	if value := opts["--autoretry"]; value != nil {
@@ -793,6 +1003,11 @@ Options:
 			"\nWARNING: ignoring autoretry when MRO_FULLSTAGERESET is set.\n")
 		util.LogInfo("options", "autoretry disabled due to MRO_FULLSTAGERESET.\n")
 	}
+	if retries > 0 && dryRun {
+		// Retrying would reattach to the pipestance and run the stages.
+		retries = 0
+		util.LogInfo("options", "autoretry disabled due to --dry-run.\n")
+	}
 	retryWait := time.Second
 	if retries > 0 {
 		if value := opts["--retry-wait"]; value != nil {
@@ -835,13 +1050,13 @@ Options:
 
 	factory := core.NewRuntimePipestanceFactory(rt,
 		invocationSrc, invocationPath, psid, mroPaths, pipestancePath, mroVersion,
-		envs, checkSrc, readOnly, tags)
+		envs, checkSrc, readOnly, tags, dryRun)
 
 	// Attempt to reattach to the pipestance.
 	reattaching := false
 	pipestance, err := factory.InvokePipeline()
 	if err != nil {
-		if _, ok := err.(*core.PipestanceExistsError); ok {
+		if _, ok := err.(*core.PipestanceExistsError); ok && !dryRun {
 			if pipestance, err = factory.ReattachToPipestance(context.Background()); err == nil {
 				config.MartianVersion, mroVersion, _ = pipestance.GetVersions()
 				reattaching = true
@@ -222,6 +222,9 @@ func (self *mrpWebServer) handleApi(sm *http.ServeMux) {
 	sm.HandleFunc(api.QueryListMetadataTop, self.listMetadataTop)
 	sm.HandleFunc(api.QueryListMetadataTop+"/", self.listMetadataTop)
 	sm.HandleFunc(api.QueryKill, self.kill)
+	sm.HandleFunc(api.QueryPause, self.pause)
+	sm.HandleFunc(api.QueryResume, self.resume)
+	sm.Handle(api.QueryMetrics, self.authorize(self.rt.Metrics))
 	sm.Handle(api.QueryExtras, self.authorize(noDot(
 		http.FileServer(http.Dir(path.Join(p, "extras"))))))
 }
@@ -416,6 +419,36 @@ func (self *mrpWebServer) restart(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Pause the pipestance.
+func (self *mrpWebServer) pause(w http.ResponseWriter, req *http.Request) {
+	if !self.verifyAuth(w, req) {
+		return
+	}
+	if self.pipestanceBox.readOnly {
+		http.Error(w, "mrp is in read-only mode.", http.StatusBadRequest)
+		return
+	}
+	util.LogInfo("webserv", "Got API pause request.")
+	if err := self.pipestanceBox.getPipestance().Pause(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Resume a paused pipestance.
+func (self *mrpWebServer) resume(w http.ResponseWriter, req *http.Request) {
+	if !self.verifyAuth(w, req) {
+		return
+	}
+	if self.pipestanceBox.readOnly {
+		http.Error(w, "mrp is in read-only mode.", http.StatusBadRequest)
+		return
+	}
+	util.LogInfo("webserv", "Got API resume request.")
+	if err := self.pipestanceBox.getPipestance().Resume(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 // Kill the pipestance.
 func (self *mrpWebServer) kill(w http.ResponseWriter, req *http.Request) {
 	if !self.verifyAuth(w, req) {
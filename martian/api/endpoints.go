@@ -27,6 +27,15 @@ const (
 	// Terminate a running pipestance.
 	QueryKill = "/api/kill"
 
+	// Stop starting new jobs for a running pipestance.
+	QueryPause = "/api/pause"
+
+	// Start new jobs again for a paused pipestance.
+	QueryResume = "/api/resume"
+
+	// Gets runtime metrics in the Prometheus text format.
+	QueryMetrics = "/metrics"
+
 	// Register an instance of mrp with an mrv host.
 	QueryRegisterMrv = "/register"
 
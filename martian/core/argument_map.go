@@ -41,8 +41,11 @@ func (self *ArgumentMap) UnmarshalJSON(b []byte) error {
 
 // Returns true if the given value has the correct mro type.
 // Non-fatal errors are written to alarms.
+//
+// isFile should be false for struct and enum types, which are the only
+// non-builtin types which are not file types.
 func checkType(val json.RawMessage, typename string, arrayDim int,
-	alarms *bytes.Buffer) (bool, string) {
+	isFile bool, alarms *bytes.Buffer) (bool, string) {
 	truncateMessage := func(val json.RawMessage, expect string) (bool, string) {
 		if len(val) > 35 {
 			tr := append(val[:15:15], "..."...)
@@ -61,7 +64,7 @@ func checkType(val json.RawMessage, typename string, arrayDim int,
 			return truncateMessage(val, "an array")
 		}
 		for i, v := range arr {
-			if ok, msg := checkType(v, typename, arrayDim-1, alarms); !ok {
+			if ok, msg := checkType(v, typename, arrayDim-1, isFile, alarms); !ok {
 				return false, fmt.Sprintf("element %d %s", i, msg)
 			}
 		}
@@ -104,6 +107,19 @@ func checkType(val json.RawMessage, typename string, arrayDim int,
 				return true, ""
 			}
 		default:
+			if !isFile {
+				// Struct or enum types.  Struct fields and enum values
+				// are checked by the compiler.
+				var v map[string]json.RawMessage
+				var s string
+				if err := json.Unmarshal(val, &v); err == nil {
+					return true, ""
+				} else if err := json.Unmarshal(val, &s); err == nil {
+					return true, ""
+				} else {
+					return truncateMessage(val, "a struct or enum value")
+				}
+			}
 			// User defined file types.  For backwards compatiblity we need
 			// to accept everything here.
 			var v string
@@ -167,6 +183,7 @@ func (self LazyArgumentMap) ValidateInputs(expected *syntax.InParams, optional .
 		} else if ok, msg := checkType(val,
 			param.GetTname(),
 			param.GetArrayDim(),
+			param.IsFile(),
 			&alarms); !ok {
 			fmt.Fprintf(&result,
 				"Expected %s input parameter '%s' %s\n",
@@ -184,6 +201,7 @@ func (self LazyArgumentMap) ValidateInputs(expected *syntax.InParams, optional .
 						if ok, msg := checkType(val,
 							param.GetTname(),
 							param.GetArrayDim(),
+							param.IsFile(),
 							&alarms); !ok {
 							fmt.Fprintf(&result,
 								"Optional %s input parameter '%s' %s\n",
@@ -240,6 +258,7 @@ func (self LazyArgumentMap) ValidateOutputs(expected *syntax.OutParams, optional
 		} else if ok, msg := checkType(val,
 			param.GetTname(),
 			param.GetArrayDim(),
+			param.IsFile(),
 			&alarms); !ok {
 			fmt.Fprintf(&result,
 				"Expected %s output value '%s' %s\n",
@@ -257,6 +276,7 @@ func (self LazyArgumentMap) ValidateOutputs(expected *syntax.OutParams, optional
 						if ok, msg := checkType(val,
 							param.GetTname(),
 							param.GetArrayDim(),
+							param.IsFile(),
 							&alarms); !ok {
 							fmt.Fprintf(&result,
 								"Optional %s output value '%s' %s\n",
@@ -104,6 +104,24 @@ func TestArgumentMapValidateInputs(t *testing.T) {
 	} else if msg != "" {
 		t.Errorf("Didn't expect a soft error message, got %s", msg)
 	}
+	delete(params.Table, missing.Id)
+	params.List = params.List[:len(params.List)-1]
+
+	// Struct types require an object, and enum types a string.
+	params.Table["baz"].Tname = "POINT"
+	params.Table["bath"].Tname = "FORMAT"
+	if err, msg := def.Args.ValidateInputs(&params); err != nil {
+		t.Errorf("Validation error: expected success, got %v", err)
+	} else if msg != "" {
+		t.Errorf("Didn't expect a soft error message, got %s", msg)
+	}
+	params.Table["foo"].Tname = "POINT"
+	if err, _ := def.Args.ValidateInputs(&params); err == nil {
+		t.Errorf("Expected error from struct, got none.")
+	} else if strings.TrimSpace(err.Error()) !=
+		"Expected POINT input parameter 'foo' with value \"12\" cannot be parsed as a struct or enum value." {
+		t.Errorf("Validation error: got \"%v\"", err)
+	}
 }
 
 func TestArgumentMapValidateOutputs(t *testing.T) {
@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Memory limits for local jobs, using cgroups.
+
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+)
+
+// Creates a cgroup for each local job, with a memory limit based on the
+// job's memory reservation, so that a job which uses too much memory is
+// killed by the kernel rather than running the whole machine out of memory.
+type memCgroups struct {
+	// The cgroup directory in which job cgroups are created.
+	parent string
+
+	// True for the unified (v2) cgroup hierarchy.
+	v2 bool
+
+	// Extra memory allowed beyond a job's reservation, as a percentage.
+	slackPercent int
+
+	// Used to give each job cgroup a unique name.
+	count uint64
+}
+
+// The cgroup for a single job.
+type memCgroup struct {
+	path string
+	v2   bool
+
+	// The memory limit for the cgroup.
+	limitBytes int64
+}
+
+// Create a cgroup for a job with the given memory reservation.
+func (self *memCgroups) create(memGB int) (*memCgroup, error) {
+	cg := &memCgroup{
+		path: path.Join(self.parent, fmt.Sprintf("martian-%d-%d",
+			os.Getpid(), atomic.AddUint64(&self.count, 1))),
+		v2:         self.v2,
+		limitBytes: int64(memGB) * 1024 * 1024 * 1024 * int64(100+self.slackPercent) / 100,
+	}
+	if err := os.Mkdir(cg.path, 0755); err != nil {
+		return nil, err
+	}
+	limitFile := "memory.limit_in_bytes"
+	if cg.v2 {
+		limitFile = "memory.max"
+	}
+	if err := cg.write(limitFile, strconv.FormatInt(cg.limitBytes, 10)); err != nil {
+		cg.remove()
+		return nil, err
+	}
+	if cg.v2 {
+		// Without this the job would be allowed to swap instead of being
+		// killed.  Not all kernels have swap accounting enabled, so
+		// errors are ignored.
+		cg.write("memory.swap.max", "0")
+	}
+	return cg, nil
+}
+
+func (self *memCgroup) write(name, value string) error {
+	return ioutil.WriteFile(path.Join(self.path, name), []byte(value), 0644)
+}
+
+// Move the process into the cgroup.  Child processes which it starts
+// afterwards will also be in the cgroup.
+func (self *memCgroup) add(pid int) error {
+	return self.write("cgroup.procs", strconv.Itoa(pid))
+}
+
+// Returns true if the kernel killed a process in the cgroup because the
+// cgroup ran out of memory.
+func (self *memCgroup) oomKilled() bool {
+	// The v1 oom_control file and v2 events file both have an oom_kill
+	// line with the number of processes killed.
+	name := "memory.oom_control"
+	if self.v2 {
+		name = "memory.events"
+	}
+	content, err := ioutil.ReadFile(path.Join(self.path, name))
+	if err != nil {
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 2 && string(fields[0]) == "oom_kill" {
+			n, _ := strconv.Atoi(string(fields[1]))
+			return n > 0
+		}
+	}
+	return false
+}
+
+// Remove the cgroup.  This fails if any processes are still in it.
+func (self *memCgroup) remove() error {
+	return os.Remove(self.path)
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// +build !linux
+
+package core
+
+import "fmt"
+
+func newMemCgroups(slackPercent int) (*memCgroups, error) {
+	return nil, fmt.Errorf("cgroup memory limits are only supported on Linux")
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+// Code to find the cgroup in which to create job cgroups.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// The standard location where cgroup hierarchies are mounted.
+const cgroupMount = "/sys/fs/cgroup"
+
+// Set up for creating job cgroups under the memory cgroup of the current
+// process.  Returns an error if the memory controller is not available or
+// the current user cannot create cgroups there.
+func newMemCgroups(slackPercent int) (*memCgroups, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := os.Stat(path.Join(cgroupMount, "cgroup.controllers")); err == nil {
+		p, err := findCgroup(f, "")
+		if err != nil {
+			return nil, err
+		}
+		parent := path.Join(cgroupMount, p)
+		if err := enableMemoryController(parent); err != nil {
+			return nil, err
+		}
+		return &memCgroups{
+			parent:       parent,
+			v2:           true,
+			slackPercent: slackPercent,
+		}, nil
+	}
+	p, err := findCgroup(f, "memory")
+	if err != nil {
+		return nil, err
+	}
+	parent := path.Join(cgroupMount, "memory", p)
+	if err := checkCgroupWritable(parent); err != nil {
+		return nil, err
+	}
+	return &memCgroups{
+		parent:       parent,
+		slackPercent: slackPercent,
+	}, nil
+}
+
+// Find the path of the cgroup for the given controller, relative to the
+// root of its hierarchy, from the content of /proc/self/cgroup.  An empty
+// controller finds the cgroup in the unified (v2) hierarchy.
+func findCgroup(r io.Reader, controller string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Each line is hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if controller == "" {
+			if fields[0] == "0" && fields[1] == "" {
+				return fields[2], nil
+			}
+			continue
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			if c == controller {
+				return fields[2], nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if controller == "" {
+		return "", fmt.Errorf("no unified cgroup found")
+	}
+	return "", fmt.Errorf("no %s cgroup found", controller)
+}
+
+func checkCgroupWritable(p string) error {
+	test := path.Join(p, fmt.Sprintf("martian-%d-test", os.Getpid()))
+	if err := os.Mkdir(test, 0755); err != nil {
+		return err
+	}
+	return os.Remove(test)
+}
+
+// In the unified hierarchy, controllers can only be enabled for the
+// children of a cgroup which has no processes of its own.  Move this
+// process into a child cgroup and enable the memory controller for the
+// children.
+//
+// This requires mrp to be the only process in its cgroup, for example by
+// running it with systemd-run --user --scope -p Delegate=yes.
+func enableMemoryController(p string) error {
+	if controllers, err := ioutil.ReadFile(path.Join(p, "cgroup.controllers")); err != nil {
+		return err
+	} else if !hasField(string(controllers), "memory") {
+		return fmt.Errorf("memory controller is not available in %s", p)
+	}
+	if procs, err := ioutil.ReadFile(path.Join(p, "cgroup.procs")); err != nil {
+		return err
+	} else if pids := strings.Fields(string(procs)); len(pids) > 1 ||
+		len(pids) == 1 && pids[0] != strconv.Itoa(os.Getpid()) {
+		return fmt.Errorf(
+			"other processes are in cgroup %s.  Run mrp in its own cgroup, "+
+				"for example with systemd-run --user --scope -p Delegate=yes",
+			p)
+	} else if len(pids) == 1 {
+		leaf := path.Join(p, "mrp")
+		if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+			return err
+		}
+		if err := ioutil.WriteFile(path.Join(leaf, "cgroup.procs"),
+			[]byte(pids[0]), 0644); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path.Join(p, "cgroup.subtree_control"),
+		[]byte("+memory"), 0644)
+}
+
+func hasField(s, field string) bool {
+	for _, f := range strings.Fields(s) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
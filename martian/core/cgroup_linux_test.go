@@ -0,0 +1,78 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFindCgroup(t *testing.T) {
+	const v1 = `12:pids:/user.slice/user-1000.slice
+11:cpu,cpuacct:/user.slice
+4:memory:/user.slice/user-1000.slice/session-2.scope
+0::/user.slice/user-1000.slice/session-2.scope
+`
+	if p, err := findCgroup(strings.NewReader(v1), "memory"); err != nil {
+		t.Error(err)
+	} else if p != "/user.slice/user-1000.slice/session-2.scope" {
+		t.Errorf("Incorrect memory cgroup %s", p)
+	}
+	if p, err := findCgroup(strings.NewReader(v1), "cpuacct"); err != nil {
+		t.Error(err)
+	} else if p != "/user.slice" {
+		t.Errorf("Incorrect cpuacct cgroup %s", p)
+	}
+	if p, err := findCgroup(strings.NewReader("0::/mrp.scope\n"), ""); err != nil {
+		t.Error(err)
+	} else if p != "/mrp.scope" {
+		t.Errorf("Incorrect unified cgroup %s", p)
+	}
+	if _, err := findCgroup(strings.NewReader("0::/mrp.scope\n"), "memory"); err == nil {
+		t.Error("Expected an error finding a missing controller.")
+	}
+}
+
+func TestMemCgroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMemCgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cgroups := &memCgroups{parent: dir, v2: true, slackPercent: 50}
+	cg, err := cgroups.create(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit, err := ioutil.ReadFile(path.Join(cg.path, "memory.max")); err != nil {
+		t.Error(err)
+	} else if string(limit) != "3221225472" {
+		t.Errorf("Expected a 3GB limit, got %s", limit)
+	}
+	if cg.oomKilled() {
+		t.Error("Expected no OOM kill without an events file.")
+	}
+	events := path.Join(cg.path, "memory.events")
+	if err := ioutil.WriteFile(events,
+		[]byte("low 0\nhigh 0\nmax 4\noom 1\noom_kill 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cg.oomKilled() {
+		t.Error("Expected no OOM kill.")
+	}
+	if err := ioutil.WriteFile(events,
+		[]byte("low 0\nhigh 0\nmax 4\noom 1\noom_kill 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !cg.oomKilled() {
+		t.Error("Expected an OOM kill.")
+	}
+	if other, err := cgroups.create(1); err != nil {
+		t.Error(err)
+	} else if other.path == cg.path {
+		t.Error("Expected a unique cgroup for each job.")
+	}
+}
@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Running docker and podman stages in containers.
+
+package core
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+// Get the command and arguments to run a job for a docker or podman stage.
+//
+// The stage code is run like an exec stage, with the first word of the
+// stage code command as the container entrypoint.  The pipestance directory
+// is mounted at the same path in the container, so that the paths to the
+// job's metadata and files are the same inside and outside of it.  The
+// job's environment variables are passed through to the container, and the
+// job's resource reservation is enforced with --cpus and --memory.
+func (self *Node) containerCommand(stagecodeParts, jobArgs []string,
+	metadata *Metadata, envs map[string]string,
+	res *JobResources) (string, []string) {
+	runtime := "docker"
+	if self.stagecodeLang == syntax.PodmanStage {
+		runtime = "podman"
+	}
+	argv := []string{
+		"run", "--rm",
+		"--user", strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+		"--workdir", metadata.curFilesPath,
+	}
+	// The journal and tmp directories are in the pipestance directory.
+	mounts := []string{path.Dir(self.journalPath)}
+	if td := envs["TMPDIR"]; td != "" &&
+		!strings.HasPrefix(td, mounts[0]+"/") {
+		mounts = append(mounts, td)
+	}
+	for _, dir := range mounts {
+		argv = append(argv, "--volume", dir+":"+dir)
+	}
+	if res != nil {
+		if res.Threads > 0 {
+			argv = append(argv, "--cpus", strconv.Itoa(res.Threads))
+		}
+		if res.MemGB > 0 {
+			argv = append(argv, "--memory", strconv.Itoa(res.MemGB)+"g")
+		}
+	}
+	envNames := make([]string, 0, len(envs))
+	for key := range envs {
+		envNames = append(envNames, key)
+	}
+	// The local job manager may set thread limits after this point.
+	jobManager, _ := self.jobManager()
+	if settings := jobManager.GetSettings(); settings != nil {
+		for _, key := range settings.ThreadEnvs {
+			if _, ok := envs[key]; !ok {
+				envNames = append(envNames, key)
+			}
+		}
+	}
+	sort.Strings(envNames)
+	for _, key := range envNames {
+		argv = append(argv, "--env", key)
+	}
+	argv = append(argv, "--entrypoint", stagecodeParts[0], self.stagecodeImage)
+	argv = append(argv, stagecodeParts[1:]...)
+	return runtime, append(argv, jobArgs...)
+}
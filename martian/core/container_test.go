@@ -0,0 +1,51 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+func TestContainerCommand(t *testing.T) {
+	node := &Node{
+		fqname:         "ID.test.PIPE.STAGE",
+		journalPath:    "/ps/journal",
+		stagecodeLang:  syntax.PodmanStage,
+		stagecodeCmd:   "/opt/stage --fast",
+		stagecodeImage: "martian/stage:1.0",
+		rt: &Runtime{
+			Config: &RuntimeOptions{JobMode: "local"},
+			JobManager: &LocalJobManager{
+				jobSettings: &JobManagerSettings{
+					ThreadEnvs: []string{"OMP_NUM_THREADS"},
+				},
+			},
+		},
+	}
+	metadata := NewMetadata("ID.test.PIPE.STAGE.fork0.chnk0",
+		"/ps/PIPE/STAGE/fork0/chnk0")
+	shellCmd, argv, envs := node.jobCommand("main", metadata.fqname, metadata,
+		&JobResources{Threads: 2, MemGB: 4})
+	if shellCmd != "podman" {
+		t.Errorf("Expected podman, got %s", shellCmd)
+	}
+	if envs["TMPDIR"] != "/ps/PIPE/STAGE/fork0/chnk0/tmp" {
+		t.Errorf("Incorrect TMPDIR %q", envs["TMPDIR"])
+	}
+	user := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	expect := "run --rm --user " + user +
+		" --workdir /ps/PIPE/STAGE/fork0/chnk0/files" +
+		" --volume /ps:/ps --cpus 2 --memory 4g" +
+		" --env OMP_NUM_THREADS --env TMPDIR" +
+		" --entrypoint /opt/stage martian/stage:1.0 --fast" +
+		" main /ps/PIPE/STAGE/fork0/chnk0 /ps/PIPE/STAGE/fork0/chnk0/files" +
+		" /ps/journal/ID.test.PIPE.STAGE.fork0.chnk0"
+	if args := strings.Join(argv, " "); args != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, args)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Reservation of the disk space declared by stages.
+
+package core
+
+import (
+	"sync"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const bytesPerGB = 1024 * 1024 * 1024
+
+// Tracks the disk space declared, with disk_space_gb, by stages which are
+// running, so that a stage is not started if the free space, less the space
+// reserved by running stages, would fall below a minimum.
+type diskReservations struct {
+	mutex sync.Mutex
+
+	// The minimum free space to leave, in bytes.
+	minFree int64
+
+	// The free space when it was last measured, in bytes, or zero if it is
+	// unknown.
+	free int64
+
+	// The space reserved by each running stage, keyed by fqname, in bytes.
+	reserved map[string]int64
+
+	// The sum of reserved.
+	total int64
+}
+
+func newDiskReservations(minFreeGB int) *diskReservations {
+	return &diskReservations{
+		minFree:  int64(minFreeGB) * bytesPerGB,
+		reserved: make(map[string]int64),
+	}
+}
+
+// Measure the free space in the filesystem containing the given path.
+func (self *diskReservations) refresh(path string) {
+	if self == nil {
+		return
+	}
+	bytes, _, _, err := GetAvailableSpace(path)
+	if err != nil {
+		util.LogError(err, "runtime", "Error measuring free disk space.")
+		bytes = 0
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.free = int64(bytes)
+}
+
+// Reserve the given space for a stage.  Returns false if the free space,
+// less the space already reserved, would fall below the minimum, unless
+// force is true.  The free space is not checked if it is unknown, or if
+// the disk space check is disabled.
+func (self *diskReservations) reserve(fqname string, gb int, force bool) bool {
+	if self == nil {
+		return true
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if _, ok := self.reserved[fqname]; ok {
+		return true
+	}
+	need := int64(gb) * bytesPerGB
+	if !force && !disableDiskSpaceCheck && self.free != 0 &&
+		self.free-self.total-need < self.minFree {
+		return false
+	}
+	self.reserved[fqname] = need
+	self.total += need
+	return true
+}
+
+// Release the space reserved for a stage, if any.
+func (self *diskReservations) release(fqname string) {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if need, ok := self.reserved[fqname]; ok {
+		delete(self.reserved, fqname)
+		self.total -= need
+	}
+}
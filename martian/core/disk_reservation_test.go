@@ -0,0 +1,82 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDiskReservations(t *testing.T) {
+	if disableDiskSpaceCheck {
+		t.Skip("disk space check disabled")
+	}
+	res := newDiskReservations(10)
+	res.free = 100 * bytesPerGB
+	if !res.reserve("ID.ps.A", 50, false) {
+		t.Error("Expected the first reservation to fit.")
+	}
+	if !res.reserve("ID.ps.A", 50, false) {
+		t.Error("Expected an existing reservation to be kept.")
+	}
+	if res.total != 50*bytesPerGB {
+		t.Errorf("Expected 50GB reserved, got %d", res.total/bytesPerGB)
+	}
+	if res.reserve("ID.ps.B", 41, false) {
+		t.Error("Expected a reservation below the minimum to be refused.")
+	}
+	if !res.reserve("ID.ps.B", 40, false) {
+		t.Error("Expected a reservation down to the minimum to fit.")
+	}
+	if !res.reserve("ID.ps.C", 40, true) {
+		t.Error("Expected a forced reservation to be kept.")
+	}
+	res.release("ID.ps.A")
+	res.release("ID.ps.C")
+	if res.total != 40*bytesPerGB {
+		t.Errorf("Expected 40GB reserved, got %d", res.total/bytesPerGB)
+	}
+
+	// Nothing is refused if the free space is unknown.
+	res.free = 0
+	if !res.reserve("ID.ps.D", 1000, false) {
+		t.Error("Expected no check of unknown free space.")
+	}
+
+	var none *diskReservations
+	if !none.reserve("ID.ps.A", 1000, false) {
+		t.Error("Expected no check without reservations.")
+	}
+}
+
+func TestReserveDisk(t *testing.T) {
+	if disableDiskSpaceCheck {
+		t.Skip("disk space check disabled")
+	}
+	dir, err := ioutil.TempDir("", "TestReserveDisk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := retryTestNode(t, dir, RetryPolicy{})
+	node.rt.diskReservations = newDiskReservations(0)
+	node.rt.diskReservations.free = 10 * bytesPerGB
+	node.resources = &JobResources{DiskGB: 20}
+	if node.reserveStart() {
+		t.Error("Expected the stage to wait for disk space.")
+	}
+	if !node.waitingForDisk {
+		t.Error("Expected the node to be waiting.")
+	}
+	node.resources.DiskGB = 5
+	if !node.reserveStart() {
+		t.Error("Expected the stage to start.")
+	}
+	if node.waitingForDisk {
+		t.Error("Expected the node to no longer be waiting.")
+	}
+	if r := node.rt.diskReservations.reserved[node.fqname]; r != 5*bytesPerGB {
+		t.Errorf("Expected 5GB reserved, got %d", r/bytesPerGB)
+	}
+}
@@ -19,6 +19,10 @@ func (self *RuntimeError) Error() string {
 	return fmt.Sprintf("RuntimeError: %s.", self.Msg)
 }
 
+// ErrReadOnly is returned by operations which would write to a pipestance
+// which is read-only, or by a read-only runtime.
+var ErrReadOnly error = &RuntimeError{"Pipestance is in read only mode."}
+
 // PipestanceInvocationError
 type PipestanceInvocationError struct {
 	Psid           string
@@ -49,6 +53,34 @@ func (self *PipestanceJobModeError) Error() string {
 	return fmt.Sprintf("RuntimeError: pipestance '%s' was originally started in job mode '%s'. Please try running again in job mode '%s'.", self.Psid, self.JobMode, self.JobMode)
 }
 
+// PipestanceVersionError
+type PipestanceVersionError struct {
+	Psid      string
+	Version   int
+	Supported int
+}
+
+func (self *PipestanceVersionError) Error() string {
+	if self.Version > self.Supported {
+		return fmt.Sprintf("RuntimeError: pipestance '%s' was created by a newer version of Martian, with metadata version %d. This version of Martian supports metadata version %d. Please run it again with the newer version.", self.Psid, self.Version, self.Supported)
+	}
+	return fmt.Sprintf("RuntimeError: pipestance '%s' has metadata version %d, which this version of Martian cannot upgrade to metadata version %d. Please run it again with the version of Martian which created it.", self.Psid, self.Version, self.Supported)
+}
+
+// PipestanceFailedError
+type PipestanceFailedError struct {
+	Psid    string
+	Fqname  string
+	Summary string
+}
+
+func (self *PipestanceFailedError) Error() string {
+	if self.Summary == "" {
+		return fmt.Sprintf("RuntimeError: pipestance '%s' failed in %s", self.Psid, self.Fqname)
+	}
+	return fmt.Sprintf("RuntimeError: pipestance '%s' failed in %s: %s", self.Psid, self.Fqname, self.Summary)
+}
+
 // PipestanceLockedError
 type PipestanceLockedError struct {
 	Psid           string
@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Notification of node state changes to subscribers in the same process.
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// A change in the state of a stage or pipeline, as sent to subscribers.
+type NodeEvent struct {
+	Fqname    string
+	OldState  MetadataState
+	NewState  MetadataState
+	Timestamp time.Time
+}
+
+// The set of channels subscribed to state changes, shared by all nodes in
+// a pipestance.
+type nodeSubscribers struct {
+	channels []chan<- NodeEvent
+	lock     sync.Mutex
+}
+
+func (self *nodeSubscribers) add(ch chan<- NodeEvent) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.channels = append(self.channels, ch)
+}
+
+// Remove the channel and close it.  Returns false if the channel was not
+// subscribed.
+func (self *nodeSubscribers) remove(ch chan<- NodeEvent) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for i, c := range self.channels {
+		if c == ch {
+			self.channels = append(self.channels[:i], self.channels[i+1:]...)
+			close(ch)
+			return true
+		}
+	}
+	return false
+}
+
+// Send the event to all subscribers.  Does nothing if there are none.
+//
+// Sends never block, so that a slow subscriber cannot hold up the
+// pipestance.  If a subscriber's channel is full, the event is dropped for
+// that subscriber.
+func (self *nodeSubscribers) publish(event NodeEvent) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, ch := range self.channels {
+		select {
+		case ch <- event:
+		default:
+			util.LogInfo("runtime",
+				"Subscriber channel full; dropped %s state change to %s.",
+				event.Fqname, event.NewState)
+		}
+	}
+}
+
+// Subscribe to changes in the state of nodes in the pipestance.  An event
+// is sent on the channel each time stepping a node changes its state.
+//
+// Events are never allowed to block the pipestance, so they are dropped if
+// the channel is full.  Subscribers should use a buffered channel and
+// receive from it promptly.
+func (self *Pipestance) Subscribe(ch chan<- NodeEvent) {
+	self.node.subscribers.add(ch)
+}
+
+// Stop sending state changes to the channel, and close it.
+func (self *Pipestance) Unsubscribe(ch chan<- NodeEvent) error {
+	if !self.node.subscribers.remove(ch) {
+		return &RuntimeError{"Channel is not subscribed to the pipestance."}
+	}
+	return nil
+}
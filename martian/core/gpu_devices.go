@@ -0,0 +1,121 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+// Tracking of the GPU devices available to the local job manager.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A pool of GPU devices.  Unlike a ResourceSemaphore, which only counts
+// the amount reserved, this hands out specific devices so that jobs can be
+// told which devices to use through CUDA_VISIBLE_DEVICES.
+type gpuDevices struct {
+	// The device ids which are not currently reserved.
+	free []string
+
+	// The total number of devices.
+	count int
+
+	mu   sync.Mutex
+	cond *sync.Cond
+}
+
+func newGpuDevices(devices []string) *gpuDevices {
+	self := &gpuDevices{
+		free:  append([]string(nil), devices...),
+		count: len(devices),
+	}
+	self.cond = sync.NewCond(&self.mu)
+	return self
+}
+
+// Find the GPU devices on the local machine.
+//
+// If CUDA_VISIBLE_DEVICES is set, for example because mrp was itself
+// started by a job manager which assigned it some devices, the devices
+// listed there are used.  Otherwise the devices are those with an nvidia
+// device file.
+func detectGpuDevices() []string {
+	if visible, ok := os.LookupEnv("CUDA_VISIBLE_DEVICES"); ok {
+		var devices []string
+		for _, dev := range strings.Split(visible, ",") {
+			dev = strings.TrimSpace(dev)
+			if dev == "" {
+				continue
+			}
+			// As with the CUDA runtime, an invalid device id hides all
+			// of the devices which follow it.
+			if i, err := strconv.Atoi(dev); err == nil && i < 0 {
+				break
+			}
+			devices = append(devices, dev)
+		}
+		return devices
+	}
+	files, _ := filepath.Glob("/dev/nvidia[0-9]*")
+	indexes := make([]int, 0, len(files))
+	for _, f := range files {
+		if i, err := strconv.Atoi(strings.TrimPrefix(f, "/dev/nvidia")); err == nil {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	devices := make([]string, len(indexes))
+	for i, index := range indexes {
+		devices[i] = strconv.Itoa(index)
+	}
+	return devices
+}
+
+// Returns the total number of devices in the pool.
+func (self *gpuDevices) Count() int {
+	return self.count
+}
+
+// Returns the number of devices which are currently reserved.
+func (self *gpuDevices) InUse() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.count - len(self.free)
+}
+
+// Reserve the given number of devices, blocking until they are available.
+// Returns the ids of the reserved devices, or an error if more devices were
+// requested than exist.
+func (self *gpuDevices) Acquire(n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	if n > self.count {
+		return nil, fmt.Errorf(
+			"tried to acquire %d GPUs, when only %d exist",
+			n, self.count)
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for len(self.free) < n {
+		self.cond.Wait()
+	}
+	devices := append([]string(nil), self.free[:n]...)
+	self.free = self.free[n:]
+	return devices, nil
+}
+
+// Return devices to the pool.
+func (self *gpuDevices) Release(devices []string) {
+	if len(devices) == 0 {
+		return
+	}
+	self.mu.Lock()
+	self.free = append(self.free, devices...)
+	self.mu.Unlock()
+	self.cond.Broadcast()
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGpuDevices(t *testing.T) {
+	gpus := newGpuDevices([]string{"0", "1"})
+	if _, err := gpus.Acquire(3); err == nil {
+		t.Error("Expected an error acquiring more GPUs than exist.")
+	}
+	if devices, err := gpus.Acquire(0); err != nil || len(devices) != 0 {
+		t.Errorf("Expected no devices, got %v", devices)
+	}
+	first, err := gpus.Acquire(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, []string{"0"}) {
+		t.Errorf("Expected device 0, got %v", first)
+	}
+	if gpus.InUse() != 1 {
+		t.Errorf("Expected 1 in use, got %d", gpus.InUse())
+	}
+	acquired := make(chan []string)
+	go func() {
+		devices, err := gpus.Acquire(2)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- devices
+	}()
+	select {
+	case devices := <-acquired:
+		t.Fatalf("Acquired %v while a device was in use.", devices)
+	case <-time.After(20 * time.Millisecond):
+	}
+	gpus.Release(first)
+	select {
+	case devices := <-acquired:
+		if len(devices) != 2 {
+			t.Errorf("Expected 2 devices, got %v", devices)
+		}
+		gpus.Release(devices)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Devices were not acquired after release.")
+	}
+	if gpus.InUse() != 0 {
+		t.Errorf("Expected nothing in use, got %d", gpus.InUse())
+	}
+}
+
+func TestDetectGpuDevices(t *testing.T) {
+	if old, ok := os.LookupEnv("CUDA_VISIBLE_DEVICES"); ok {
+		defer os.Setenv("CUDA_VISIBLE_DEVICES", old)
+	} else {
+		defer os.Unsetenv("CUDA_VISIBLE_DEVICES")
+	}
+	os.Setenv("CUDA_VISIBLE_DEVICES", "2, 3,-1,4")
+	if devices := detectGpuDevices(); !reflect.DeepEqual(devices, []string{"2", "3"}) {
+		t.Errorf("Expected [2 3], got %v", devices)
+	}
+	os.Setenv("CUDA_VISIBLE_DEVICES", "")
+	if devices := detectGpuDevices(); len(devices) != 0 {
+		t.Errorf("Expected no devices, got %v", devices)
+	}
+}
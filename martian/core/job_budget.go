@@ -0,0 +1,95 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Limits on the jobs which a pipestance runs at once.
+
+package core
+
+import (
+	"strings"
+	"sync"
+)
+
+// Limits the number of jobs, and the total memory reserved by jobs, which a
+// pipestance may have running at once across all job managers, so that one
+// pipestance cannot take over a shared cluster.
+//
+// Jobs which were already running when mrp started are not counted.
+type jobBudget struct {
+	maxJobs  int
+	maxMemGB int
+	mutex    sync.Mutex
+
+	// The memory reserved by each running job, keyed by the fqname of the
+	// job's metadata.
+	running map[string]int
+	memGB   int
+}
+
+// Returns nil, meaning no limit, if neither limit is positive.
+func newJobBudget(maxJobs, maxMemGB int) *jobBudget {
+	if maxJobs <= 0 && maxMemGB <= 0 {
+		return nil
+	}
+	return &jobBudget{
+		maxJobs:  maxJobs,
+		maxMemGB: maxMemGB,
+		running:  make(map[string]int),
+	}
+}
+
+// Reserve room for a job with the given resources.  Returns false if the
+// job would exceed either limit.  A job which exceeds the memory limit on
+// its own is still allowed to run if no other jobs are running.
+func (self *jobBudget) acquire(fqname string, res *JobResources) bool {
+	if self == nil {
+		return true
+	}
+	mem := 0
+	if res != nil && res.MemGB > 0 {
+		mem = res.MemGB
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if _, ok := self.running[fqname]; ok {
+		return true
+	}
+	if self.maxJobs > 0 && len(self.running) >= self.maxJobs {
+		return false
+	}
+	if self.maxMemGB > 0 && len(self.running) > 0 &&
+		self.memGB+mem > self.maxMemGB {
+		return false
+	}
+	self.running[fqname] = mem
+	self.memGB += mem
+	return true
+}
+
+// Release the reservation for a job, if it has one.
+func (self *jobBudget) release(fqname string) {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if mem, ok := self.running[fqname]; ok {
+		delete(self.running, fqname)
+		self.memGB -= mem
+	}
+}
+
+// Release the reservations for all of the jobs of a node.
+func (self *jobBudget) releaseNode(fqname string) {
+	if self == nil {
+		return
+	}
+	prefix := fqname + "."
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for job, mem := range self.running {
+		if strings.HasPrefix(job, prefix) {
+			delete(self.running, job)
+			self.memGB -= mem
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"testing"
+)
+
+func TestJobBudget(t *testing.T) {
+	if b := newJobBudget(0, 0); b != nil {
+		t.Error("Expected no budget without limits.")
+	}
+	var none *jobBudget
+	if !none.acquire("ID.ps.A.fork0.split", &JobResources{MemGB: 1000}) {
+		t.Error("Expected no limit without a budget.")
+	}
+	none.release("ID.ps.A.fork0.split")
+	none.releaseNode("ID.ps.A")
+
+	b := newJobBudget(3, 10)
+	if !b.acquire("ID.ps.A.fork0.split", &JobResources{MemGB: 20}) {
+		t.Error("Expected a large job to run by itself.")
+	}
+	if b.acquire("ID.ps.B.fork0.split", &JobResources{MemGB: 1}) {
+		t.Error("Expected the memory limit to be enforced.")
+	}
+	b.release("ID.ps.A.fork0.split")
+	if !b.acquire("ID.ps.A.fork0.chnk0", &JobResources{MemGB: 4}) {
+		t.Error("Expected a job within the budget to run.")
+	}
+	if !b.acquire("ID.ps.A.fork0.chnk0", &JobResources{MemGB: 4}) {
+		t.Error("Expected an existing reservation to be kept.")
+	}
+	if !b.acquire("ID.ps.A.fork0.chnk1", &JobResources{MemGB: 4}) {
+		t.Error("Expected a job within the budget to run.")
+	}
+	if !b.acquire("ID.ps.AB.fork0.chnk0", &JobResources{MemGB: 1}) {
+		t.Error("Expected a job within the budget to run.")
+	}
+	if b.acquire("ID.ps.C.fork0.split", nil) {
+		t.Error("Expected the job count limit to be enforced.")
+	}
+	b.releaseNode("ID.ps.A")
+	if len(b.running) != 1 || b.memGB != 1 {
+		t.Errorf("Expected only ID.ps.AB to be running, got %v", b.running)
+	}
+}
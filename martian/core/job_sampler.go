@@ -0,0 +1,144 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Periodic sampling of the memory and cpu usage of running local jobs.
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The number of samples kept for each job.  Older samples are discarded.
+const jobSampleCapacity = 720
+
+// A sample of the resource usage of a running job and its children.
+type JobSample struct {
+	Timestamp time.Time `json:"ts"`
+	Rss       int64     `json:"rss"`
+	Vmem      int64     `json:"vmem"`
+	Procs     int       `json:"proc_count"`
+
+	// The average number of cores used since the previous sample.
+	Cpu float64 `json:"cpu"`
+}
+
+// A fixed-size buffer of the most recent samples for a job.  The zero value
+// is an empty buffer.
+type sampleRing struct {
+	mutex   sync.Mutex
+	samples []JobSample
+	next    int
+}
+
+func (self *sampleRing) add(sample JobSample) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if len(self.samples) < jobSampleCapacity {
+		self.samples = append(self.samples, sample)
+	} else {
+		self.samples[self.next] = sample
+		self.next = (self.next + 1) % jobSampleCapacity
+	}
+}
+
+// Get a copy of the samples, oldest first.
+func (self *sampleRing) list() []JobSample {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if len(self.samples) == 0 {
+		return nil
+	}
+	result := make([]JobSample, 0, len(self.samples))
+	result = append(result, self.samples[self.next:]...)
+	return append(result, self.samples[:self.next]...)
+}
+
+type sampledJob struct {
+	metadata *Metadata
+	lastTime time.Time
+	lastCpu  time.Duration
+}
+
+// Samples the jobs which are registered with it at a fixed interval, and
+// records the samples in each job's metadata.
+type jobSampler struct {
+	interval time.Duration
+	mutex    sync.Mutex
+	jobs     map[int]*sampledJob
+}
+
+func newJobSampler(interval time.Duration) *jobSampler {
+	return &jobSampler{
+		interval: interval,
+		jobs:     make(map[int]*sampledJob),
+	}
+}
+
+// Start sampling the job with the given pid.
+func (self *jobSampler) add(pid int, metadata *Metadata) {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.jobs[pid] = &sampledJob{
+		metadata: metadata,
+		lastTime: time.Now(),
+	}
+}
+
+// Stop sampling the job with the given pid.
+func (self *jobSampler) remove(pid int) {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.jobs, pid)
+}
+
+func (self *jobSampler) run() {
+	for range time.Tick(self.interval) {
+		self.sample()
+	}
+}
+
+// Take a sample of each job.
+func (self *jobSampler) sample() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for pid, job := range self.jobs {
+		mem, err := GetProcessTreeMemory(pid, true, nil)
+		if err != nil {
+			// The job probably just finished.
+			continue
+		}
+		now := time.Now()
+		sample := JobSample{
+			Timestamp: now,
+			Rss:       mem.Rss,
+			Vmem:      mem.Vmem,
+			Procs:     mem.Procs,
+		}
+		if cpu, err := GetProcessTreeCpuTime(pid); err == nil {
+			if elapsed := now.Sub(job.lastTime); elapsed > 0 && cpu >= job.lastCpu {
+				sample.Cpu = float64(cpu-job.lastCpu) / float64(elapsed)
+			}
+			job.lastCpu = cpu
+		}
+		job.lastTime = now
+		job.metadata.samples.add(sample)
+	}
+}
+
+// Sample the memory and cpu usage of each running job at the given
+// interval.
+func (self *LocalJobManager) sampleJobs(interval time.Duration) {
+	self.sampler = newJobSampler(interval)
+	go self.sampler.run()
+	util.LogInfo("jobmngr", "Sampling job memory and cpu usage every %v.",
+		interval)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSampleRing(t *testing.T) {
+	var ring sampleRing
+	if s := ring.list(); s != nil {
+		t.Errorf("Expected no samples, got %v", s)
+	}
+	start := time.Now()
+	for i := 0; i < jobSampleCapacity+10; i++ {
+		ring.add(JobSample{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Rss:       int64(i),
+		})
+	}
+	samples := ring.list()
+	if len(samples) != jobSampleCapacity {
+		t.Fatalf("Expected %d samples, got %d", jobSampleCapacity, len(samples))
+	}
+	for i, s := range samples {
+		if s.Rss != int64(i+10) {
+			t.Fatalf("Expected sample %d to be %d, got %d", i, i+10, s.Rss)
+		}
+	}
+}
+
+func TestJobSampler(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires /proc")
+	}
+	metadata := NewMetadata("ID.test.PIPE.STAGE.fork0.chnk0", t.Name())
+	sampler := newJobSampler(time.Second)
+	pid := os.Getpid()
+	sampler.add(pid, metadata)
+	sampler.sample()
+	sampler.sample()
+	samples := metadata.samples.list()
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 samples, got %d", len(samples))
+	}
+	if samples[1].Rss <= 0 || samples[1].Procs <= 0 {
+		t.Errorf("Expected memory usage, got %+v", samples[1])
+	}
+	if samples[1].Cpu < 0 {
+		t.Errorf("Expected non-negative cpu usage, got %v", samples[1].Cpu)
+	}
+	sampler.remove(pid)
+	sampler.sample()
+	if n := len(metadata.samples.list()); n != 2 {
+		t.Errorf("Expected no samples after removal, got %d", n)
+	}
+
+	// A nil sampler does nothing.
+	var none *jobSampler
+	none.add(pid, metadata)
+	none.remove(pid)
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/martian-lang/martian/martian/syntax"
 	"github.com/martian-lang/martian/martian/util"
@@ -19,17 +20,35 @@ import (
 type JobResources struct {
 	Threads int    `json:"__threads,omitempty"`
 	MemGB   int    `json:"__mem_gb,omitempty"`
+	GPUs    int    `json:"__gpus,omitempty"`
 	Special string `json:"__special,omitempty"`
+
+	// The wall-clock time limit for each job, from the stage declaration.
+	// Stage code cannot override it.
+	Timeout time.Duration `json:"-"`
+
+	// The maximum number of automatic retries of the stage after transient
+	// failures, from the stage declaration, or -1 to use the runtime's
+	// retry policy.
+	Retries int `json:"-"`
+
+	// The disk space, in GB, which the stage may use while it runs, from
+	// the stage declaration.  It is reserved for the whole stage, not for
+	// each job.
+	DiskGB int `json:"-"`
 }
 
 func (self *JobResources) ToMap() ArgumentMap {
-	r := make(ArgumentMap, 3)
+	r := make(ArgumentMap, 4)
 	if self.Threads != 0 {
 		r["__threads"] = self.Threads
 	}
 	if self.MemGB != 0 {
 		r["__mem_gb"] = self.MemGB
 	}
+	if self.GPUs != 0 {
+		r["__gpus"] = self.GPUs
+	}
 	if self.Special != "" {
 		r["__special"] = self.Special
 	}
@@ -37,13 +56,16 @@ func (self *JobResources) ToMap() ArgumentMap {
 }
 
 func (self *JobResources) ToLazyMap() LazyArgumentMap {
-	r := make(LazyArgumentMap, 3)
+	r := make(LazyArgumentMap, 4)
 	if self.Threads != 0 {
 		r["__threads"] = json.RawMessage(strconv.Itoa(self.Threads))
 	}
 	if self.MemGB != 0 {
 		r["__mem_gb"] = json.RawMessage(strconv.Itoa(self.MemGB))
 	}
+	if self.GPUs != 0 {
+		r["__gpus"] = json.RawMessage(strconv.Itoa(self.GPUs))
+	}
 	if self.Special != "" {
 		r["__special"], _ = json.Marshal(self.Special)
 	}
@@ -92,6 +114,14 @@ func (self *JobResources) updateFromLazyArgs(args LazyArgumentMap) error {
 		}
 		delete(args, "__mem_gb")
 	}
+	if v, ok := args["__gpus"]; ok {
+		if n, err := getInt(v, "__gpus"); err != nil {
+			return err
+		} else {
+			self.GPUs = n
+		}
+		delete(args, "__gpus")
+	}
 	if v, ok := args["__special"]; ok {
 		var s string
 		if json.Unmarshal(v, &s) != nil {
@@ -161,6 +191,14 @@ func (self *JobResources) updateFromArgs(args ArgumentMap) error {
 		}
 		delete(args, "__mem_gb")
 	}
+	if v, ok := args["__gpus"]; ok {
+		if n, err := getInt(v, "__gpus"); err != nil {
+			return err
+		} else {
+			self.GPUs = n
+		}
+		delete(args, "__gpus")
+	}
 	if v, ok := args["__special"]; ok {
 		if s, ok := v.(string); !ok {
 			return fmt.Errorf("Expected string for __special, found %v instead", v)
@@ -266,7 +304,7 @@ func (self *LazyChunkDef) UnmarshalJSON(b []byte) error {
 		if err := res.updateFromLazyArgs(self.Args); err != nil {
 			return err
 		}
-		if res.Threads != 0 || res.MemGB != 0 || res.Special != "" {
+		if res.Threads != 0 || res.MemGB != 0 || res.GPUs != 0 || res.Special != "" {
 			self.Resources = &res
 		}
 	}
@@ -414,7 +452,7 @@ func (self *ChunkDef) UnmarshalJSON(b []byte) error {
 		if err := res.updateFromArgs(self.Args); err != nil {
 			return err
 		}
-		if res.Threads != 0 || res.MemGB != 0 || res.Special != "" {
+		if res.Threads != 0 || res.MemGB != 0 || res.GPUs != 0 || res.Special != "" {
 			self.Resources = &res
 		}
 	}
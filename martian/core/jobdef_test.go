@@ -13,6 +13,7 @@ func TestChunkDefMarshal(t *testing.T) {
 		Resources: &JobResources{
 			Threads: 3,
 			MemGB:   2,
+			GPUs:    1,
 		},
 		Args: ArgumentMap{
 			"foo":  12,
@@ -23,11 +24,11 @@ func TestChunkDefMarshal(t *testing.T) {
 	}); err != nil {
 		t.Errorf("Marshaling failure %v", err)
 	} else {
-		def := make(map[string]interface{}, 6)
+		def := make(map[string]interface{}, 7)
 		if err := json.Unmarshal(b, &def); err != nil {
 			t.Errorf("Unmarshaling failure %v", err)
-		} else if len(def) != 6 {
-			t.Errorf("Incorrect number of json keys: expected 6, got %d", len(def))
+		} else if len(def) != 7 {
+			t.Errorf("Incorrect number of json keys: expected 7, got %d", len(def))
 		} else {
 			if v, ok := def["__threads"].(float64); !ok || v != 3.0 {
 				t.Errorf("Incorrect threads: expected 3, got %v", def["__threads"])
@@ -35,6 +36,9 @@ func TestChunkDefMarshal(t *testing.T) {
 			if v, ok := def["__mem_gb"].(float64); !ok || v != 2.0 {
 				t.Errorf("Incorrect mem_gb: expected 2, got %v", def["__mem_gb"])
 			}
+			if v, ok := def["__gpus"].(float64); !ok || v != 1.0 {
+				t.Errorf("Incorrect gpus: expected 1, got %v", def["__gpus"])
+			}
 			if v, ok := def["foo"].(float64); !ok || v != 12.0 {
 				t.Errorf("Incorrect foo: expected 12, got %v", def["foo"])
 			}
@@ -58,6 +62,7 @@ func TestChunkDefUnmarshal(t *testing.T) {
 	if err := json.Unmarshal([]byte(`{
 		"__threads": 4,
 		"__mem_gb": 3,
+		"__gpus": 2,
 		"foo": 12,
 		"bar": 1.2,
 		"baz": { "fooz": "bars" },
@@ -74,6 +79,9 @@ func TestChunkDefUnmarshal(t *testing.T) {
 		if def.Resources.MemGB != 3 {
 			t.Errorf("Incorrect mem_gb: expected 3, got %d", def.Resources.MemGB)
 		}
+		if def.Resources.GPUs != 2 {
+			t.Errorf("Incorrect gpus: expected 2, got %d", def.Resources.GPUs)
+		}
 	}
 	if len(def.Args) != 4 {
 		t.Errorf("Incorrect number of args: expected 4, got %d", len(def.Args))
@@ -17,7 +17,9 @@ import (
 	"runtime/trace"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/cloudfoundry/gosigar"
@@ -55,9 +57,13 @@ func max(a, b int) int {
 // Job managers
 //
 type JobManager interface {
-	execJob(string, []string, map[string]string, *Metadata, int, int, string, string, string, bool)
+	execJob(string, []string, map[string]string, *Metadata, *JobResources, string, string, bool)
 	endJob(*Metadata)
 
+	// Kill a job which is still running, for example because it exceeded
+	// its timeout, and release the resources reserved for it.
+	killJob(*Metadata)
+
 	// Given a list of candidate job IDs, returns a list of jobIds which may be
 	// still queued or running, as well as the stderr output of the queue check.
 	// If this job manager doesn't know how to check the queue or the query
@@ -90,11 +96,25 @@ type LocalJobManager struct {
 	coreSem     *ResourceSemaphore
 	memMBSem    *ResourceSemaphore
 	procsSem    *ResourceSemaphore
+	gpus        *gpuDevices
+	cgroups     *memCgroups
+	sampler     *jobSampler
+	running     sync.WaitGroup
 	lastMemDiff int64
 	queue       []*exec.Cmd
 	debug       bool
 	limitLoad   bool
 	highMem     ObservedMemory
+	jobsMutex   sync.Mutex
+	jobs        map[*Metadata]*localJob
+}
+
+// A job which was started by the local job manager.
+type localJob struct {
+	proc *os.Process
+
+	// Closed once the job has exited and its resources have been released.
+	done chan struct{}
 }
 
 func NewLocalJobManager(userMaxCores int, userMaxMemGB int,
@@ -170,6 +190,11 @@ func NewLocalJobManager(userMaxCores int, userMaxMemGB int,
 
 	self.coreSem = NewResourceSemaphore(int64(self.maxCores), "threads")
 	self.memMBSem = NewResourceSemaphore(int64(self.maxMemGB)*1024, "MB of memory")
+	self.gpus = newGpuDevices(detectGpuDevices())
+	if n := self.gpus.Count(); n > 0 {
+		util.LogInfo("jobmngr", "Using %d GPU%s available on system.",
+			n, util.Pluralize(n))
+	}
 	if rlim, err := GetMaxProcs(); err != nil {
 		util.LogError(err, "jobmngr",
 			"WARNING: Could not get process rlimit.")
@@ -263,6 +288,25 @@ func (self *LocalJobManager) HandleSignal(sig os.Signal) {
 	}
 }
 
+// Wait up to the given time for running jobs to finish.  Returns false if
+// some jobs were still running after the timeout.
+//
+// Jobs are started in a critical section, so no new jobs will start while
+// this is called from a signal handler.
+func (self *LocalJobManager) drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		self.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func (self *LocalJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
 	// Sanity check and cap to self.maxCores.
 	if threads == 0 {
@@ -326,7 +370,7 @@ func (self *LocalJobManager) queueCheckGrace() time.Duration {
 
 func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	fqname string, retries int, waitTime int, localpreflight bool) {
+	gpus int, fqname string, retries int, waitTime int, localpreflight bool) {
 
 	time.Sleep(time.Second * time.Duration(waitTime))
 	go func() {
@@ -350,6 +394,7 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 		stderrPath := metadata.MetadataFilePath("stderr")
 
 		threads, memGB = self.GetSystemReqs(threads, memGB)
+		gpus = self.getGpuReqs(gpus)
 
 		// Acquire cores.
 		if self.debug {
@@ -411,6 +456,35 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 			}
 		}
 
+		// Acquire GPUs.
+		if gpus > 0 && self.debug {
+			util.LogInfo("jobmngr", "Waiting for %d GPU%s", gpus, util.Pluralize(gpus))
+		}
+		devices, err := self.gpus.Acquire(gpus)
+		if err != nil {
+			util.LogError(err, "jobmngr",
+				"%s requested %d GPUs, but only %d were found.",
+				metadata.fqname, gpus, self.gpus.Count())
+			self.coreSem.Release(int64(threads))
+			self.memMBSem.Release(int64(memGB) * 1024)
+			if self.procsSem != nil {
+				self.procsSem.Release(procEstimate)
+			}
+			metadata.WriteRaw(Errors, err.Error())
+			return
+		}
+		if len(devices) > 0 {
+			if self.debug {
+				util.LogInfo("jobmngr", "Acquired GPU%s %s (%d/%d in use)",
+					util.Pluralize(gpus), strings.Join(devices, ","),
+					self.gpus.InUse(), self.gpus.Count())
+			}
+			// Restrict the job to the devices it was given.  Later entries
+			// in the environment take precedence over earlier ones.
+			cmd.Env = append(cmd.Env,
+				"CUDA_VISIBLE_DEVICES="+strings.Join(devices, ","))
+		}
+
 		// Set up _stdout and _stderr for the job.
 		if stdoutFile, err := os.Create(stdoutPath); err == nil {
 			stdoutFile.WriteString("[stdout]\n")
@@ -429,22 +503,60 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 			defer stderrFile.Close()
 		}
 
+		// Put the job in a cgroup limited to its memory reservation.
+		var cg *memCgroup
+		if self.cgroups != nil && memGB > 0 {
+			if cg, err = self.cgroups.create(memGB); err != nil {
+				util.LogError(err, "jobmngr",
+					"Could not create a cgroup for %s.  Its memory will not be limited.",
+					metadata.fqname)
+			}
+		}
+
 		// Run the command and wait for completion.
-		err := func(metadata *Metadata, cmd *exec.Cmd) error {
+		var job *localJob
+		err = func(metadata *Metadata, cmd *exec.Cmd) error {
 			util.EnterCriticalSection()
 			defer util.ExitCriticalSection()
 			err := cmd.Start()
 			if err == nil {
 				metadata.remove("queued_locally")
+				if cg != nil {
+					if err := cg.add(cmd.Process.Pid); err != nil {
+						util.LogError(err, "jobmngr",
+							"Could not add %s to its cgroup.  Its memory will not be limited.",
+							metadata.fqname)
+					}
+				}
+				self.sampler.add(cmd.Process.Pid, metadata)
+				self.running.Add(1)
+				job = self.addJob(metadata, cmd.Process)
 			}
 			return err
 		}(metadata, cmd)
 		if err == nil {
 			err = cmd.Wait()
+			self.sampler.remove(cmd.Process.Pid)
+			self.running.Done()
 		}
 
-		// CentOS < 5.5 workaround
-		if err != nil {
+		oomKilled := false
+		if cg != nil {
+			oomKilled = cg.oomKilled()
+			if err := cg.remove(); err != nil {
+				util.LogError(err, "jobmngr", "Could not remove cgroup for %s.",
+					metadata.fqname)
+			}
+		}
+		if oomKilled {
+			// Replace whatever error the job wrote about being killed with
+			// the reason it was killed.
+			metadata.WriteRaw(Errors, fmt.Sprintf(
+				"Job exceeded memory reservation of %d GB and was killed "+
+					"(limit %.1f GB).",
+				memGB, float64(cg.limitBytes)/(1024*1024*1024)))
+		} else if err != nil {
+			// CentOS < 5.5 workaround
 			exitCodeString := fmt.Sprintf("errno %d", retryExitCode)
 			if strings.Contains(err.Error(), exitCodeString) {
 				retries += 1
@@ -465,8 +577,8 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 				}
 			} else {
 				util.LogInfo("jobmngr", "Job failed: %s. Retrying job %s in %d seconds", err.Error(), fqname, waitTime)
-				self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, fqname, retries,
-					waitTime, localpreflight)
+				self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, gpus, fqname,
+					retries, waitTime, localpreflight)
 			}
 		}
 
@@ -490,9 +602,99 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 					procEstimate, self.procsSem.InUse(), self.procsSem.CurrentSize())
 			}
 		}
+		if len(devices) > 0 {
+			// Release GPUs.
+			self.gpus.Release(devices)
+			if self.debug {
+				util.LogInfo("jobmngr", "Released GPU%s %s (%d/%d in use)",
+					util.Pluralize(gpus), strings.Join(devices, ","),
+					self.gpus.InUse(), self.gpus.Count())
+			}
+		}
+		self.removeJob(metadata, job)
 	}()
 }
 
+// Record a job which was started, so that it can be killed.
+func (self *LocalJobManager) addJob(metadata *Metadata, proc *os.Process) *localJob {
+	job := &localJob{
+		proc: proc,
+		done: make(chan struct{}),
+	}
+	self.jobsMutex.Lock()
+	defer self.jobsMutex.Unlock()
+	if self.jobs == nil {
+		self.jobs = make(map[*Metadata]*localJob)
+	}
+	self.jobs[metadata] = job
+	return job
+}
+
+// Forget about a job after its resources were released.
+func (self *LocalJobManager) removeJob(metadata *Metadata, job *localJob) {
+	if job == nil {
+		return
+	}
+	self.jobsMutex.Lock()
+	// The job may have been retried already.
+	if self.jobs[metadata] == job {
+		delete(self.jobs, metadata)
+	}
+	self.jobsMutex.Unlock()
+	close(job.done)
+}
+
+// Kill the job, and wait until its cores, memory and GPUs are released.
+func (self *LocalJobManager) killJob(metadata *Metadata) {
+	self.jobsMutex.Lock()
+	job := self.jobs[metadata]
+	self.jobsMutex.Unlock()
+	if job == nil {
+		return
+	}
+	if err := job.proc.Kill(); err != nil {
+		util.LogError(err, "jobmngr", "Could not kill %s.", metadata.fqname)
+	}
+	<-job.done
+}
+
+// Sanity check the number of GPUs requested by a job and cap it to the
+// number of devices available.
+func (self *LocalJobManager) getGpuReqs(gpus int) int {
+	if gpus <= 0 {
+		return 0
+	}
+	if n := self.gpus.Count(); n == 0 {
+		// Without any detected devices there is nothing to manage, so let
+		// the job run and find out for itself.
+		if self.debug {
+			util.LogInfo("jobmngr", "Need %d GPU%s but none were found.",
+				gpus, util.Pluralize(gpus))
+		}
+		return 0
+	} else if gpus > n {
+		if self.debug {
+			util.LogInfo("jobmngr", "Need %d GPU%s but settling for %d.",
+				gpus, util.Pluralize(gpus), n)
+		}
+		return n
+	}
+	return gpus
+}
+
+// Limit the memory of each job to its reservation, plus the given
+// percentage, by running it in a cgroup.
+func (self *LocalJobManager) limitMemory(slackPercent int) error {
+	cgroups, err := newMemCgroups(slackPercent)
+	if err != nil {
+		return err
+	}
+	self.cgroups = cgroups
+	util.LogInfo("jobmngr", "Limiting job memory with cgroups in %s.",
+		cgroups.parent)
+	return nil
+}
+
 func (self *LocalJobManager) GetMaxCores() int {
 	return self.maxCores
 }
@@ -502,9 +704,10 @@ func (self *LocalJobManager) GetMaxMemGB() int {
 }
 
 func (self *LocalJobManager) execJob(shellCmd string, argv []string,
-	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	special string, fqname string, shellName string, preflight bool) {
-	self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, fqname, 0, 0, preflight)
+	envs map[string]string, metadata *Metadata, resources *JobResources,
+	fqname string, shellName string, preflight bool) {
+	self.Enqueue(shellCmd, argv, envs, metadata, resources.Threads,
+		resources.MemGB, resources.GPUs, fqname, 0, 0, preflight)
 }
 
 func (self *LocalJobManager) endJob(*Metadata) {}
@@ -518,32 +721,54 @@ type RemoteJobManager struct {
 	jobFreqMillis        int
 	jobSem               *MaxJobsSemaphore
 	limiter              *time.Ticker
+	submitLimiter        *submitLimiter
+	submitRetry          *submitRetryPolicy
+	lastBacklog          int
 	debug                bool
-}
 
-func NewRemoteJobManager(jobMode string, memGBPerCore int, maxJobs int, jobFreqMillis int,
-	jobResources string, debug bool) *RemoteJobManager {
-	self := &RemoteJobManager{}
-	self.jobMode = jobMode
-	self.memGBPerCore = memGBPerCore
-	self.maxJobs = maxJobs
-	self.jobFreqMillis = jobFreqMillis
-	self.debug = debug
-	self.config = verifyJobManager(jobMode, memGBPerCore)
+	// Canceled on shutdown, to abandon submissions which are waiting to be
+	// retried.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
 
-	// Parse jobresources mappings
-	self.jobResourcesMappings = map[string]string{}
+// Parse the semicolon-separated special:value mappings from
+// MRO_JOBRESOURCES.  Values may contain colons, for example in AWS ARNs.
+func parseJobResourcesMappings(jobResources string) map[string]string {
+	mappings := map[string]string{}
 	for _, mapping := range strings.Split(jobResources, ";") {
 		if len(mapping) > 0 {
-			parts := strings.Split(mapping, ":")
+			parts := strings.SplitN(mapping, ":", 2)
 			if len(parts) == 2 {
-				self.jobResourcesMappings[parts[0]] = parts[1]
+				mappings[parts[0]] = parts[1]
 				util.LogInfo("jobmngr", "Mapping %s to %s", parts[0], parts[1])
 			} else {
 				util.LogInfo("jobmngr", "Could not parse mapping: %s", mapping)
 			}
 		}
 	}
+	return mappings
+}
+
+func NewRemoteJobManager(jobMode string, memGBPerCore int, maxJobs int, jobFreqMillis int,
+	jobResources string, debug bool) *RemoteJobManager {
+	return newRemoteJobManager(jobMode, memGBPerCore, maxJobs, jobFreqMillis,
+		jobResources, "", debug)
+}
+
+// Like NewRemoteJobManager, but if jobTemplate is not empty, job scripts
+// are rendered from that Go template file.
+func newRemoteJobManager(jobMode string, memGBPerCore int, maxJobs int, jobFreqMillis int,
+	jobResources string, jobTemplate string, debug bool) *RemoteJobManager {
+	self := &RemoteJobManager{}
+	self.jobMode = jobMode
+	self.memGBPerCore = memGBPerCore
+	self.maxJobs = maxJobs
+	self.jobFreqMillis = jobFreqMillis
+	self.debug = debug
+	self.config = verifyJobManagerTemplate(jobMode, memGBPerCore, jobTemplate)
+
+	self.jobResourcesMappings = parseJobResourcesMappings(jobResources)
 
 	if self.maxJobs > 0 {
 		self.jobSem = NewMaxJobsSemaphore(self.maxJobs)
@@ -554,13 +779,32 @@ func NewRemoteJobManager(jobMode string, memGBPerCore int, maxJobs int, jobFreqM
 		// dummy limiter to keep struct OK
 		self.limiter = time.NewTicker(time.Millisecond * 1)
 	}
+	self.ctx, self.cancel = context.WithCancel(context.Background())
+	util.RegisterSignalHandler(self)
 	return self
 }
 
+func (self *RemoteJobManager) HandleSignal(os.Signal) {
+	self.cancel()
+}
+
+// Limit job submissions to the given number per second, after an initial
+// burst.  Jobs over the rate wait to be submitted.
+func (self *RemoteJobManager) limitSubmitRate(rate float64, burst int) {
+	self.submitLimiter = newSubmitLimiter(rate, burst)
+	util.LogInfo("jobmngr", "Limiting job submissions to %g per second, "+
+		"with bursts of up to %d.", rate, int(self.submitLimiter.burst))
+}
+
 func (self *RemoteJobManager) refreshResources(bool) error {
 	if self.jobSem != nil {
 		self.jobSem.FindDone()
 	}
+	if backlog := self.submitLimiter.backlog(); backlog != self.lastBacklog {
+		self.lastBacklog = backlog
+		util.LogInfo("jobmngr", "%d job%s waiting to be submitted.",
+			backlog, util.Pluralize(backlog))
+	}
 	return nil
 }
 
@@ -608,32 +852,30 @@ func (self *RemoteJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
 }
 
 func (self *RemoteJobManager) execJob(shellCmd string, argv []string,
-	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	special string, fqname string, shellName string, localpreflight bool) {
-	ctx, task := trace.NewTask(context.Background(), "queueRemote")
+	envs map[string]string, metadata *Metadata, resources *JobResources,
+	fqname string, shellName string, localpreflight bool) {
+	ctx, task := trace.NewTask(self.ctx, "queueRemote")
 
-	// no limit, send the job
-	if self.maxJobs <= 0 {
-		defer task.End()
-		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname, shellName, ctx)
-		return
-	}
-
-	// grab job when ready, block until job state changes to a finalized state
+	// grab job when ready, block until job state changes to a finalized state.
+	// Even without a limit, submission may wait between retries, so it is
+	// never done on the caller's goroutine.
 	go func() {
 		defer task.End()
-		if self.debug {
-			util.LogInfo("jobmngr", "Waiting for job: %s", fqname)
-		}
-		// if we want to try to put a more precise cap on cluster execution load,
-		// might be preferable to request num threads here instead of a slot per job
-		if success := self.jobSem.Acquire(metadata); !success {
-			return
+		if self.jobSem != nil {
+			if self.debug {
+				util.LogInfo("jobmngr", "Waiting for job: %s", fqname)
+			}
+			// if we want to try to put a more precise cap on cluster execution load,
+			// might be preferable to request num threads here instead of a slot per job
+			if success := self.jobSem.Acquire(metadata); !success {
+				return
+			}
 		}
+		self.submitLimiter.wait()
 		if self.debug {
 			util.LogInfo("jobmngr", "Job sent: %s", fqname)
 		}
-		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname, shellName, ctx)
+		self.sendJob(shellCmd, argv, envs, metadata, resources, fqname, shellName, ctx)
 	}()
 }
 
@@ -643,6 +885,22 @@ func (self *RemoteJobManager) endJob(metadata *Metadata) {
 	}
 }
 
+// Cancel the job with the job mode's kill command, if it has one and the
+// job id is known, and release the job's slot.
+func (self *RemoteJobManager) killJob(metadata *Metadata) {
+	if self.config.killCmd != "" {
+		if id, err := metadata.readRawSafe(JobId); err == nil && id != "" {
+			cmd := exec.Command(self.config.killCmd, id)
+			cmd.Dir = metadata.curFilesPath
+			if output, err := cmd.CombinedOutput(); err != nil {
+				util.LogError(err, "jobmngr", "Could not kill %s (job %s): %s",
+					metadata.fqname, id, output)
+			}
+		}
+	}
+	self.endJob(metadata)
+}
+
 // Set environment variables which control thread count.  Do not override
 // envs from above.
 func threadEnvs(self JobManager, threads int, envs map[string]string) map[string]string {
@@ -657,17 +915,11 @@ func threadEnvs(self JobManager, threads int, envs map[string]string) map[string
 	return newEnvs
 }
 
-func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[string]string,
-	metadata *Metadata, threads int, memGB int, special string, fqname string, shellName string,
-	ctx context.Context) {
-
-	if self.jobFreqMillis > 0 {
-		<-(self.limiter.C)
-		if self.debug {
-			util.LogInfo("jobmngr", "Job rate-limit released: %s", fqname)
-		}
-	}
-	threads, memGB = self.GetSystemReqs(threads, memGB)
+// Get the template parameters which depend on the resources requested for
+// a job, along with the number of threads to use.
+func (self *RemoteJobManager) jobParams(resources *JobResources) (int, map[string]string) {
+	threads, memGB := self.GetSystemReqs(resources.Threads, resources.MemGB)
+	special := resources.Special
 
 	// figure out per-thread memory requirements for the template.  If
 	// mempercore is specified, use that as what we send.
@@ -695,18 +947,15 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		}
 	}
 
-	argv = append(
-		util.FormatEnv(threadEnvs(self, threads, envs)),
-		append([]string{shellCmd},
-			argv...)...,
-	)
-	params := map[string]string{
-		"JOB_NAME":          fqname + "." + shellName,
+	// Leave GPUs blank unless the stage requested them, so that lines in the
+	// template which request GPUs are removed for other jobs.
+	gpus := ""
+	if resources.GPUs > 0 {
+		gpus = strconv.Itoa(resources.GPUs)
+	}
+
+	return threads, map[string]string{
 		"THREADS":           fmt.Sprintf("%d", threads),
-		"STDOUT":            metadata.MetadataFilePath("stdout"),
-		"STDERR":            metadata.MetadataFilePath("stderr"),
-		"JOB_WORKDIR":       metadata.curFilesPath,
-		"CMD":               strings.Join(argv, " "),
 		"MEM_GB":            fmt.Sprintf("%d", memGB),
 		"MEM_MB":            fmt.Sprintf("%d", memGB*1024),
 		"MEM_KB":            fmt.Sprintf("%d", memGB*1024*1024),
@@ -717,8 +966,21 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		"MEM_B_PER_THREAD":  fmt.Sprintf("%d", memGBPerThread*1024*1024*1024),
 		"ACCOUNT":           os.Getenv("MRO_ACCOUNT"),
 		"RESOURCES":         mappedJobResourcesOpt,
+		"GPUS":              gpus,
+		"SPECIAL":           special,
+		"ARRAY":             "",
 	}
+}
 
+// Fill in the job template with the given parameters.  Lines of the
+// template which refer to parameters with empty values are removed.
+//
+// If the job manager uses a Go template, it is rendered with the
+// parameters converted to a JobTemplateData.
+func (self *RemoteJobManager) jobScript(params map[string]string) (string, error) {
+	if self.config.goTemplate != nil {
+		return renderJobTemplate(self.config.goTemplate, params)
+	}
 	// Replace template annotations with actual values
 	args := []string{}
 	template := self.config.jobTemplate
@@ -735,19 +997,80 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		}
 	}
 	r := strings.NewReplacer(args...)
-	jobscript := r.Replace(template)
+	return r.Replace(template), nil
+}
+
+func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[string]string,
+	metadata *Metadata, resources *JobResources, fqname string, shellName string,
+	ctx context.Context) {
+
+	if self.jobFreqMillis > 0 {
+		<-(self.limiter.C)
+		if self.debug {
+			util.LogInfo("jobmngr", "Job rate-limit released: %s", fqname)
+		}
+	}
+	threads, params := self.jobParams(resources)
+
+	argv = append(
+		util.FormatEnv(threadEnvs(self, threads, envs)),
+		append([]string{shellCmd},
+			argv...)...,
+	)
+	params["FQNAME"] = fqname
+	params["JOB_NAME"] = fqname + "." + shellName
+	params["STDOUT"] = metadata.MetadataFilePath("stdout")
+	params["STDERR"] = metadata.MetadataFilePath("stderr")
+	params["JOB_WORKDIR"] = metadata.curFilesPath
+	params["CMD"] = strings.Join(argv, " ")
+
+	jobscript, err := self.jobScript(params)
+	if err != nil {
+		metadata.remove(QueuedLocally)
+		metadata.WriteRaw(Errors, "Error rendering job template: "+err.Error())
+		return
+	}
 	metadata.WriteRaw("jobscript", jobscript)
 
+	for retries := 0; ; retries++ {
+		delay, retry := self.submitJob(jobscript, metadata, retries, ctx)
+		if !retry {
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			metadata.remove(QueuedLocally)
+			metadata.WriteRaw(Errors, "job submission canceled: "+ctx.Err().Error())
+			return
+		}
+	}
+}
+
+// Run the job submission command.  If it fails with a transient error
+// which should be retried, returns the time to wait before retrying, and
+// true.
+func (self *RemoteJobManager) submitJob(jobscript string, metadata *Metadata,
+	retries int, ctx context.Context) (time.Duration, bool) {
 	cmd := exec.CommandContext(ctx, self.config.jobCmd, self.config.jobCmdArgs...)
 	cmd.Dir = metadata.curFilesPath
 	cmd.Stdin = strings.NewReader(jobscript)
 
 	util.EnterCriticalSection()
 	defer util.ExitCriticalSection()
-	metadata.remove("queued_locally")
 	if output, err := cmd.CombinedOutput(); err != nil {
-		metadata.WriteRaw(Errors, "jobcmd error ("+err.Error()+"):\n"+string(output))
+		errMsg := "jobcmd error (" + err.Error() + "):\n" + string(output)
+		if delay, retry := self.submitRetry.retryDelay(errMsg, retries); retry {
+			util.LogInfo("jobmngr",
+				"Submitting %s failed (attempt %d of %d), retrying in %v: %s",
+				metadata.fqname, retries+1, self.submitRetry.maxRetries+1,
+				delay, errMsg)
+			return delay, true
+		}
+		metadata.remove("queued_locally")
+		metadata.WriteRaw(Errors, errMsg)
 	} else {
+		metadata.remove("queued_locally")
 		trimmed := bytes.TrimSpace(output)
 		// jobids should not have spaces in them.  This is the most general way to
 		// check that a string is actually a jobid.
@@ -756,6 +1079,7 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 			metadata.cache("jobid", metadata.uniquifier)
 		}
 	}
+	return 0, false
 }
 
 func (self *RemoteJobManager) checkQueue(ids []string, ctx context.Context) ([]string, string) {
@@ -765,13 +1089,23 @@ func (self *RemoteJobManager) checkQueue(ids []string, ctx context.Context) ([]s
 	jobPath := util.RelPath(path.Join("..", "jobmanagers"))
 	cmd := exec.CommandContext(ctx, path.Join(jobPath, self.config.queueQueryCmd))
 	cmd.Dir = jobPath
-	cmd.Stdin = strings.NewReader(strings.Join(ids, "\n"))
+	query := ids
+	arrays := arrayJobIds(ids)
+	if len(arrays) > 0 {
+		query = append(append(make([]string, 0, len(ids)+len(arrays)),
+			ids...), arrays...)
+	}
+	cmd.Stdin = strings.NewReader(strings.Join(query, "\n"))
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	output, err := cmd.Output()
 	if err != nil {
 		return ids, stderr.String()
 	}
+	if len(arrays) > 0 {
+		return aliveArrayTasks(ids, strings.Split(string(output), "\n")),
+			stderr.String()
+	}
 	return strings.Split(string(output), "\n"), stderr.String()
 }
 
@@ -797,6 +1131,7 @@ type JobModeJson struct {
 	Args            []string      `json:"args,omitempty"`
 	QueueQuery      string        `json:"queue_query,omitempty"`
 	QueueQueryGrace int           `json:"queue_query_grace_secs,omitempty"`
+	KillCmd         string        `json:"kill_cmd,omitempty"`
 	ResourcesOpt    string        `json:"resopt"`
 	JobEnvs         []*JobModeEnv `json:"envs"`
 }
@@ -818,12 +1153,25 @@ type jobManagerConfig struct {
 	jobCmdArgs       []string
 	queueQueryCmd    string
 	queueQueryGrace  time.Duration
+	killCmd          string
 	jobResourcesOpt  string
 	jobTemplate      string
 	threadingEnabled bool
+	jobArraysEnabled bool
+
+	// If set, this is used instead of jobTemplate.
+	goTemplate *template.Template
 }
 
 func verifyJobManager(jobMode string, memGBPerCore int) jobManagerConfig {
+	return verifyJobManagerTemplate(jobMode, memGBPerCore, "")
+}
+
+// Like verifyJobManager, but if goTemplateFile is not empty, the job script
+// is rendered from that Go template instead of the template for the job
+// mode.
+func verifyJobManagerTemplate(jobMode string, memGBPerCore int,
+	goTemplateFile string) jobManagerConfig {
 	jobPath := util.RelPath(path.Join("..", "jobmanagers"))
 
 	// Check for existence of job manager JSON file
@@ -893,23 +1241,46 @@ func verifyJobManager(jobMode string, memGBPerCore int) jobManagerConfig {
 	jobResourcesOpt := jobModeJson.ResourcesOpt
 	util.LogInfo("jobmngr", "Job submit resources option = %s", jobResourcesOpt)
 
-	// Check for existence of job manager template file
-	if _, err := os.Stat(jobTemplateFile); os.IsNotExist(err) {
-		util.PrintInfo("jobmngr", jobErrorMsg)
-		os.Exit(1)
-	}
-	util.LogInfo("jobmngr", "Job template = %s", jobTemplateFile)
-	bytes, _ = ioutil.ReadFile(jobTemplateFile)
-	jobTemplate := string(bytes)
+	var jobTemplate string
+	var goTemplate *template.Template
+	var jobThreadingEnabled, jobArraysEnabled, memEnabled bool
+	if goTemplateFile != "" {
+		util.LogInfo("jobmngr", "Job template = %s", goTemplateFile)
+		bytes, err := ioutil.ReadFile(goTemplateFile)
+		if err == nil {
+			jobTemplate = string(bytes)
+			goTemplate, err = template.New(path.Base(goTemplateFile)).Parse(jobTemplate)
+		}
+		if err != nil {
+			util.PrintError(err, "jobmngr",
+				"Could not load job template %s.", goTemplateFile)
+			os.Exit(1)
+		}
+		jobThreadingEnabled = strings.Contains(jobTemplate, ".Threads")
+		jobArraysEnabled = strings.Contains(jobTemplate, ".Array")
+		memEnabled = strings.Contains(jobTemplate, ".Mem")
+	} else {
+		// Check for existence of job manager template file
+		if _, err := os.Stat(jobTemplateFile); os.IsNotExist(err) {
+			util.PrintInfo("jobmngr", jobErrorMsg)
+			os.Exit(1)
+		}
+		util.LogInfo("jobmngr", "Job template = %s", jobTemplateFile)
+		bytes, _ = ioutil.ReadFile(jobTemplateFile)
+		jobTemplate = string(bytes)
+
+		// Check if template includes threading.
+		jobThreadingEnabled = strings.Contains(jobTemplate, "__MRO_THREADS__")
+
+		// Check if the template supports job arrays.
+		jobArraysEnabled = strings.Contains(jobTemplate, "__MRO_ARRAY__")
 
-	// Check if template includes threading.
-	jobThreadingEnabled := false
-	if strings.Contains(jobTemplate, "__MRO_THREADS__") {
-		jobThreadingEnabled = true
+		memEnabled = strings.Contains(jobTemplate, "__MRO_MEM_GB") ||
+			strings.Contains(jobTemplate, "__MRO_MEM_MB")
 	}
 
 	// Check if memory reservations or mempercore are enabled
-	if !strings.Contains(jobTemplate, "__MRO_MEM_GB") && !strings.Contains(jobTemplate, "__MRO_MEM_MB") && memGBPerCore <= 0 {
+	if !memEnabled && memGBPerCore <= 0 {
 		util.Println("\nCLUSTER MODE WARNING:\n   Memory reservations are not enabled in your job template.\n   To avoid memory over-subscription, we highly recommend that you enable\n   memory reservations on your cluster, or use the --mempercore option.\nPlease consult the documentation for details.\n")
 	}
 
@@ -943,8 +1314,11 @@ func verifyJobManager(jobMode string, memGBPerCore int) jobManagerConfig {
 		jobModeJson.Args,
 		jobModeJson.QueueQuery,
 		queueGrace,
+		jobModeJson.KillCmd,
 		jobResourcesOpt,
 		jobTemplate,
 		jobThreadingEnabled,
+		jobArraysEnabled,
+		goTemplate,
 	}
 }
@@ -0,0 +1,216 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Submission of stage chunks as cluster job arrays.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime/trace"
+	"strconv"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// A job which is run as one task of an array job.
+type arrayJob struct {
+	shellCmd string
+	argv     []string
+	envs     map[string]string
+	metadata *Metadata
+}
+
+// Implemented by job managers which can submit a set of jobs with the same
+// resource requirements as a single array job.
+type arrayJobManager interface {
+	JobManager
+
+	// Returns true if execJobArray can be used.
+	supportsArrays() bool
+
+	// Submit the jobs as an array.  The metadata is used for the
+	// submission script and the output of the array job itself, while the
+	// output of each task goes to the metadata for that job.
+	execJobArray(jobs []*arrayJob, resources *JobResources,
+		metadata *Metadata, fqname string, shellName string)
+}
+
+// The environment variables which hold the (1-based) task index of a job
+// array task in SLURM and SGE.
+const arrayTaskIdVar = "${SLURM_ARRAY_TASK_ID:-$SGE_TASK_ID}"
+
+// Job arrays are used when the job template has an __MRO_ARRAY__
+// parameter, e.g. "#SBATCH --array=__MRO_ARRAY__" for SLURM, or
+// "#$ -t __MRO_ARRAY__" for SGE.
+//
+// Arrays are not used with --maxjobs, since every task of an array counts
+// against the limit but the tasks are submitted all at once.
+func (self *RemoteJobManager) supportsArrays() bool {
+	return self.config.jobArraysEnabled && self.maxJobs <= 0
+}
+
+func (self *RemoteJobManager) execJobArray(jobs []*arrayJob, resources *JobResources,
+	metadata *Metadata, fqname string, shellName string) {
+	ctx, task := trace.NewTask(context.Background(), "queueRemoteArray")
+	if self.submitLimiter == nil {
+		defer task.End()
+		self.sendJobArray(jobs, resources, metadata, fqname, shellName, ctx)
+		return
+	}
+	// The whole array counts as a single submission.
+	go func() {
+		defer task.End()
+		self.submitLimiter.wait()
+		self.sendJobArray(jobs, resources, metadata, fqname, shellName, ctx)
+	}()
+}
+
+// Get the command for an array job, which runs the job for the current
+// task index.
+func (self *RemoteJobManager) arrayCommand(jobs []*arrayJob, threads int) string {
+	var buf strings.Builder
+	buf.WriteString("case \"" + arrayTaskIdVar + "\" in\n")
+	for i, job := range jobs {
+		argv := append(
+			util.FormatEnv(threadEnvs(self, threads, job.envs)),
+			append([]string{job.shellCmd},
+				job.argv...)...,
+		)
+		fmt.Fprintf(&buf, "%d)\n    cd %s && %s > %s 2> %s\n    ;;\n",
+			i+1, job.metadata.curFilesPath, strings.Join(argv, " "),
+			job.metadata.MetadataFilePath(StdOut),
+			job.metadata.MetadataFilePath(StdErr))
+	}
+	buf.WriteString("esac")
+	return buf.String()
+}
+
+func (self *RemoteJobManager) sendJobArray(jobs []*arrayJob, resources *JobResources,
+	metadata *Metadata, fqname string, shellName string, ctx context.Context) {
+	if self.jobFreqMillis > 0 {
+		<-(self.limiter.C)
+		if self.debug {
+			util.LogInfo("jobmngr", "Job rate-limit released: %s", fqname)
+		}
+	}
+	threads, params := self.jobParams(resources)
+	params["FQNAME"] = fqname
+	params["JOB_NAME"] = fqname + "." + shellName
+	params["STDOUT"] = metadata.MetadataFilePath(StdOut)
+	params["STDERR"] = metadata.MetadataFilePath(StdErr)
+	params["JOB_WORKDIR"] = metadata.path
+	params["CMD"] = self.arrayCommand(jobs, threads)
+	params["ARRAY"] = "1-" + strconv.Itoa(len(jobs))
+
+	jobscript, err := self.jobScript(params)
+	if err != nil {
+		for _, job := range jobs {
+			job.metadata.remove(QueuedLocally)
+			job.metadata.WriteRaw(Errors,
+				"Error rendering job template: "+err.Error())
+		}
+		return
+	}
+	metadata.WriteRaw("jobscript", jobscript)
+
+	cmd := exec.CommandContext(ctx, self.config.jobCmd, self.config.jobCmdArgs...)
+	cmd.Dir = metadata.path
+	cmd.Stdin = strings.NewReader(jobscript)
+
+	util.EnterCriticalSection()
+	defer util.ExitCriticalSection()
+	for _, job := range jobs {
+		job.metadata.remove(QueuedLocally)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		for _, job := range jobs {
+			job.metadata.WriteRaw(Errors,
+				"jobcmd error ("+err.Error()+"):\n"+string(output))
+		}
+	} else if id := arrayJobId(output); id != "" {
+		for i, job := range jobs {
+			job.metadata.WriteRaw(JobId, arrayTaskId(id, i+1))
+			job.metadata.cache(JobId, job.metadata.uniquifier)
+		}
+	}
+}
+
+// Get the job id from the output of the job submission command for an
+// array job.  SGE prints the task range after the id, e.g. 1234.1-10:1,
+// and SLURM may print the cluster name, e.g. 1234;cluster.
+func arrayJobId(output []byte) string {
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) == 0 || bytes.ContainsAny(trimmed, " \t\n\r") {
+		return ""
+	}
+	if i := bytes.IndexAny(trimmed, ".;"); i > 0 {
+		trimmed = trimmed[:i]
+	}
+	return string(trimmed)
+}
+
+// Get the job id recorded for a task of an array job.
+func arrayTaskId(jobId string, task int) string {
+	return jobId + "[" + strconv.Itoa(task) + "]"
+}
+
+// Split the id of an array task into the id of the array job and the task.
+func splitArrayTaskId(id string) (string, string, bool) {
+	if !strings.HasSuffix(id, "]") {
+		return id, "", false
+	}
+	i := strings.LastIndexByte(id, '[')
+	if i <= 0 {
+		return id, "", false
+	}
+	return id[:i], id[i+1 : len(id)-1], true
+}
+
+// Get the ids of array jobs for any array tasks in the list, which are
+// queried along with the tasks for queue query commands which only report
+// whole jobs.
+func arrayJobIds(ids []string) []string {
+	var arrays []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if base, _, ok := splitArrayTaskId(id); ok && !seen[base] {
+			seen[base] = true
+			arrays = append(arrays, base)
+		}
+	}
+	return arrays
+}
+
+// Given the ids reported by the queue query command, get which of the given
+// ids may still be queued or running.
+//
+// An array task is alive if the query command reported it.  If the command
+// reported the array job but none of its tasks, it does not know about
+// individual tasks, so every task of the array is treated as alive.
+func aliveArrayTasks(ids, reported []string) []string {
+	found := make(map[string]bool, len(reported))
+	hasTasks := make(map[string]bool)
+	for _, id := range reported {
+		id = strings.TrimSpace(id)
+		found[id] = true
+		if base, _, ok := splitArrayTaskId(id); ok {
+			hasTasks[base] = true
+		}
+	}
+	alive := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if found[id] {
+			alive = append(alive, id)
+		} else if base, _, ok := splitArrayTaskId(id); ok &&
+			found[base] && !hasTasks[base] {
+			alive = append(alive, id)
+		}
+	}
+	return alive
+}
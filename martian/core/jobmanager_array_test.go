@@ -0,0 +1,109 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestArrayJobId(t *testing.T) {
+	for output, expect := range map[string]string{
+		"1234\n":       "1234",
+		"1234.1-10:1":  "1234",
+		"1234;cluster": "1234",
+		"":             "",
+		"bad output":   "",
+	} {
+		if id := arrayJobId([]byte(output)); id != expect {
+			t.Errorf("Expected %q for %q, got %q", expect, output, id)
+		}
+	}
+	if base, task, ok := splitArrayTaskId(arrayTaskId("1234", 3)); !ok ||
+		base != "1234" || task != "3" {
+		t.Errorf("Incorrect split %s %s", base, task)
+	}
+	if _, _, ok := splitArrayTaskId("1234"); ok {
+		t.Error("Expected 1234 not to be an array task.")
+	}
+}
+
+func TestAliveArrayTasks(t *testing.T) {
+	ids := []string{"1", "2[1]", "2[2]", "3[1]", "3[2]", "4[1]"}
+	if a := arrayJobIds(ids); !reflect.DeepEqual(a, []string{"2", "3", "4"}) {
+		t.Errorf("Expected array ids [2 3 4], got %v", a)
+	}
+	// The query reports only the whole job for array 2, and individual
+	// tasks for array 3.  Array 4 is gone.
+	alive := aliveArrayTasks(ids, []string{"1", "2", "3", "3[2]", ""})
+	if expect := []string{"1", "2[1]", "2[2]", "3[2]"}; !reflect.DeepEqual(alive, expect) {
+		t.Errorf("Expected %v, got %v", expect, alive)
+	}
+}
+
+func TestSendJobArray(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSendJobArray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jm := &RemoteJobManager{
+		config: jobManagerConfig{
+			jobSettings: &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+			// Echo an SGE-style array job id.
+			jobCmd:           "echo",
+			jobCmdArgs:       []string{"1234.1-2:1"},
+			jobTemplate:      "#$ -t __MRO_ARRAY__\n#$ -l gpu=__MRO_GPUS__\n__MRO_CMD__\n",
+			threadingEnabled: true,
+			jobArraysEnabled: true,
+		},
+	}
+	if !jm.supportsArrays() {
+		t.Error("Expected job array support.")
+	}
+	fork := NewMetadata("ID.test.STAGE.fork0", dir)
+	jobs := make([]*arrayJob, 2)
+	for i := range jobs {
+		name := "chnk" + strconv.Itoa(i)
+		m := NewMetadataRunWithJournalPath("ID.test.STAGE.fork0."+name,
+			path.Join(dir, name), path.Join(dir, name, "files"), dir, "main")
+		if err := m.mkdirs(); err != nil {
+			t.Fatal(err)
+		}
+		jobs[i] = &arrayJob{
+			shellCmd: "/bin/stage",
+			argv:     []string{"main", m.path},
+			metadata: m,
+		}
+	}
+	util.SetupSignalHandlers()
+	jm.sendJobArray(jobs, &JobResources{Threads: 2, MemGB: 1}, fork,
+		"ID.test.STAGE.fork0", "main", context.Background())
+	for i, job := range jobs {
+		if job.metadata.exists(Errors) {
+			t.Errorf("Unexpected error: %s", job.metadata.readRaw(Errors))
+		}
+		if id := job.metadata.readRaw(JobId); id != arrayTaskId("1234", i+1) {
+			t.Errorf("Incorrect job id %s", id)
+		}
+	}
+	script := fork.readRaw("jobscript")
+	if !strings.HasPrefix(script, "#$ -t 1-2\n") {
+		t.Errorf("Expected the array range in the script:\n%s", script)
+	}
+	if strings.Contains(script, "gpu=") {
+		t.Errorf("Expected unused parameters to be removed:\n%s", script)
+	}
+	if !strings.Contains(script, "2)\n    cd "+jobs[1].metadata.curFilesPath+
+		" && ") {
+		t.Errorf("Expected a case for each task:\n%s", script)
+	}
+}
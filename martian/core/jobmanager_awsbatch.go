@@ -0,0 +1,649 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Job manager which runs jobs with AWS Batch.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The job mode which selects the AWS Batch job manager.
+const BatchJobMode = "batch"
+
+const (
+	// AWS Batch accepts at most this many job IDs in a DescribeJobs call.
+	batchDescribeLimit = 100
+
+	// Jobs which are not known to AWS Batch for this long are considered
+	// to have failed.
+	batchQueueCheckGrace = 5 * time.Minute
+)
+
+// Runs each job as an AWS Batch job.
+//
+// Jobs are submitted to the job queue given by the MRO_BATCH_QUEUE
+// environment variable.  The job definition for a stage is the one which
+// MRO_JOBRESOURCES maps the stage's special resource to, if any, or else
+// the one given by MRO_BATCH_JOB_DEFINITION.  If neither is set, a job
+// definition for the container image given by MRO_BATCH_IMAGE is
+// registered the first time it is needed, or reused if one was registered
+// by a previous run.  The pipestance directory must be on a shared
+// filesystem.  If MRO_BATCH_MOUNT_PATH is set, that path on the compute
+// instances is mounted at the same path in the job containers of
+// registered job definitions.
+//
+// The job ARN is recorded as the job ID.
+//
+// Credentials and the region are taken from the standard AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, and AWS_REGION environment
+// variables.
+type AWSBatchJobManager struct {
+	endpoint  string
+	region    string
+	client    *http.Client
+	queue     string
+	image     string
+	mountPath string
+
+	// Job definition ARNs, by container image.
+	jobDefinitions map[string]string
+	jobDefLock     sync.Mutex
+
+	// The job definition to use for all stages, and for stages by special
+	// resource.
+	defaultJobDef  string
+	specialJobDefs map[string]string
+
+	settings      *JobManagerSettings
+	memGBPerCore  int
+	maxJobs       int
+	jobFreqMillis int
+	jobSem        *MaxJobsSemaphore
+	limiter       *time.Ticker
+	debug         bool
+}
+
+func NewAWSBatchJobManager(memGBPerCore int, maxJobs int, jobFreqMillis int,
+	jobResources string, debug bool) (*AWSBatchJobManager, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, &RuntimeError{"AWS_REGION must be set for the batch job mode"}
+	}
+	if _, err := getAWSCredentials(); err != nil {
+		return nil, err
+	}
+	queue := os.Getenv("MRO_BATCH_QUEUE")
+	if queue == "" {
+		return nil, &RuntimeError{"MRO_BATCH_QUEUE must be set for the batch job mode"}
+	}
+	image, jobDef := os.Getenv("MRO_BATCH_IMAGE"), os.Getenv("MRO_BATCH_JOB_DEFINITION")
+	if image == "" && jobDef == "" {
+		return nil, &RuntimeError{
+			"MRO_BATCH_IMAGE or MRO_BATCH_JOB_DEFINITION must be set for the batch job mode"}
+	}
+	self := &AWSBatchJobManager{
+		endpoint:       "https://batch." + region + ".amazonaws.com",
+		region:         region,
+		client:         &http.Client{Timeout: time.Minute},
+		queue:          queue,
+		image:          image,
+		mountPath:      os.Getenv("MRO_BATCH_MOUNT_PATH"),
+		jobDefinitions: make(map[string]string),
+		defaultJobDef:  jobDef,
+		specialJobDefs: parseJobResourcesMappings(jobResources),
+		settings:       verifyJobManager("local", -1).jobSettings,
+		memGBPerCore:   memGBPerCore,
+		maxJobs:        maxJobs,
+		jobFreqMillis:  jobFreqMillis,
+		debug:          debug,
+	}
+	if jobDef != "" {
+		util.LogInfo("jobmngr", "Running jobs with job definition %s in AWS Batch queue %s.",
+			jobDef, self.queue)
+	} else {
+		util.LogInfo("jobmngr", "Running jobs with image %s in AWS Batch queue %s.",
+			self.image, self.queue)
+	}
+	if self.maxJobs > 0 {
+		self.jobSem = NewMaxJobsSemaphore(self.maxJobs)
+	}
+	if self.jobFreqMillis > 0 {
+		self.limiter = time.NewTicker(time.Millisecond * time.Duration(self.jobFreqMillis))
+	}
+	return self, nil
+}
+
+type awsCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Get AWS credentials from the environment.  They are read for every
+// request, since temporary credentials may be refreshed.
+func getAWSCredentials() (*awsCredentials, error) {
+	creds := &awsCredentials{
+		AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyId == "" || creds.SecretAccessKey == "" {
+		return nil, &RuntimeError{
+			"AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for the batch job mode"}
+	}
+	return creds, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Sign a request with AWS signature version 4.  The body must be the
+// request body, which is hashed into the signature.
+func signAWSRequest(req *http.Request, body []byte, creds *awsCredentials,
+	region, service string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for _, h := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Security-Token"} {
+		if v := req.Header.Get(h); v != "" {
+			headers[strings.ToLower(h)] = strings.TrimSpace(v)
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	payloadHash := sha256.Sum256(body)
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyId, scope, signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// Call an AWS Batch API action, such as "submitjob", decoding the response
+// into out.
+func (self *AWSBatchJobManager) request(ctx context.Context, action string,
+	in, out interface{}) error {
+	creds, err := getAWSCredentials()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	u := self.endpoint + "/v1/" + action
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	signAWSRequest(req, body, creds, self.region, "batch", time.Now())
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s\n%s", action, resp.Status, msg)
+	}
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+//
+// Subset of the AWS Batch API types used by the job manager.
+//
+
+type batchKeyValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type batchResourceRequirement struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type batchVolume struct {
+	Name string           `json:"name"`
+	Host *batchVolumeHost `json:"host,omitempty"`
+}
+
+type batchVolumeHost struct {
+	SourcePath string `json:"sourcePath"`
+}
+
+type batchMountPoint struct {
+	SourceVolume  string `json:"sourceVolume"`
+	ContainerPath string `json:"containerPath"`
+}
+
+type batchContainerProperties struct {
+	Image       string            `json:"image"`
+	Vcpus       int               `json:"vcpus"`
+	Memory      int               `json:"memory"`
+	Volumes     []batchVolume     `json:"volumes,omitempty"`
+	MountPoints []batchMountPoint `json:"mountPoints,omitempty"`
+}
+
+type batchJobDefinition struct {
+	JobDefinitionName   string                    `json:"jobDefinitionName"`
+	JobDefinitionArn    string                    `json:"jobDefinitionArn,omitempty"`
+	Revision            int                       `json:"revision,omitempty"`
+	Type                string                    `json:"type"`
+	ContainerProperties *batchContainerProperties `json:"containerProperties"`
+}
+
+type batchContainerOverrides struct {
+	Vcpus                int                        `json:"vcpus"`
+	Memory               int                        `json:"memory"`
+	Command              []string                   `json:"command"`
+	Environment          []batchKeyValue            `json:"environment,omitempty"`
+	ResourceRequirements []batchResourceRequirement `json:"resourceRequirements,omitempty"`
+}
+
+type batchSubmitJobRequest struct {
+	JobName            string                   `json:"jobName"`
+	JobQueue           string                   `json:"jobQueue"`
+	JobDefinition      string                   `json:"jobDefinition"`
+	ContainerOverrides *batchContainerOverrides `json:"containerOverrides"`
+}
+
+type batchJobDetail struct {
+	JobId  string `json:"jobId"`
+	JobArn string `json:"jobArn,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+// Get the job ID from a job ARN, which ends with job/ID.  Job IDs which are
+// not ARNs are returned unchanged.
+func batchJobIdFromArn(arn string) string {
+	if strings.HasPrefix(arn, "arn:") {
+		if i := strings.LastIndexByte(arn, '/'); i >= 0 {
+			return arn[i+1:]
+		}
+	}
+	return arn
+}
+
+// Get the name of the job definition for a container image.
+func batchJobDefinitionName(image string) string {
+	return fmt.Sprintf("martian-%x", sha1.Sum([]byte(image)))
+}
+
+// Get the ARN of the job definition for the image, reusing an active job
+// definition if one exists, or registering a new one.
+func (self *AWSBatchJobManager) jobDefinition(ctx context.Context, image string) (string, error) {
+	self.jobDefLock.Lock()
+	defer self.jobDefLock.Unlock()
+	if arn := self.jobDefinitions[image]; arn != "" {
+		return arn, nil
+	}
+	name := batchJobDefinitionName(image)
+	var existing struct {
+		JobDefinitions []*batchJobDefinition `json:"jobDefinitions"`
+	}
+	if err := self.request(ctx, "describejobdefinitions", map[string]string{
+		"jobDefinitionName": name,
+		"status":            "ACTIVE",
+	}, &existing); err != nil {
+		return "", err
+	}
+	var best *batchJobDefinition
+	for _, def := range existing.JobDefinitions {
+		if def.ContainerProperties == nil ||
+			def.ContainerProperties.Image != image ||
+			def.ContainerProperties.mountPath() != self.mountPath {
+			continue
+		}
+		if best == nil || def.Revision > best.Revision {
+			best = def
+		}
+	}
+	if best != nil {
+		self.jobDefinitions[image] = best.JobDefinitionArn
+		return best.JobDefinitionArn, nil
+	}
+	def := &batchJobDefinition{
+		JobDefinitionName: name,
+		Type:              "container",
+		ContainerProperties: &batchContainerProperties{
+			Image: image,
+			// The resources are overridden for each job.
+			Vcpus:  1,
+			Memory: 1024,
+		},
+	}
+	if self.mountPath != "" {
+		def.ContainerProperties.Volumes = []batchVolume{{
+			Name: "pipestance",
+			Host: &batchVolumeHost{SourcePath: self.mountPath},
+		}}
+		def.ContainerProperties.MountPoints = []batchMountPoint{{
+			SourceVolume:  "pipestance",
+			ContainerPath: self.mountPath,
+		}}
+	}
+	var registered batchJobDefinition
+	if err := self.request(ctx, "registerjobdefinition", def, &registered); err != nil {
+		return "", err
+	}
+	util.LogInfo("jobmngr", "Registered AWS Batch job definition %s.",
+		registered.JobDefinitionArn)
+	self.jobDefinitions[image] = registered.JobDefinitionArn
+	return registered.JobDefinitionArn, nil
+}
+
+// Get the path which is mounted by the job definition, if any.
+// Get the job definition for a stage with the given special resource.
+func (self *AWSBatchJobManager) stageJobDefinition(ctx context.Context,
+	special string) (string, error) {
+	if special != "" {
+		if jobDef := self.specialJobDefs[special]; jobDef != "" {
+			return jobDef, nil
+		}
+	}
+	if self.defaultJobDef != "" {
+		return self.defaultJobDef, nil
+	}
+	return self.jobDefinition(ctx, self.image)
+}
+
+func (self *batchContainerProperties) mountPath() string {
+	for _, m := range self.MountPoints {
+		if m.SourceVolume == "pipestance" {
+			return m.ContainerPath
+		}
+	}
+	return ""
+}
+
+func (self *AWSBatchJobManager) refreshResources(bool) error {
+	if self.jobSem != nil {
+		self.jobSem.FindDone()
+	}
+	return nil
+}
+
+func (self *AWSBatchJobManager) GetMaxCores() int {
+	return 0
+}
+
+func (self *AWSBatchJobManager) GetMaxMemGB() int {
+	return 0
+}
+
+func (self *AWSBatchJobManager) GetSettings() *JobManagerSettings {
+	return self.settings
+}
+
+func (self *AWSBatchJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
+	if threads == 0 {
+		threads = self.settings.ThreadsPerJob
+	} else if threads < 0 {
+		threads = -threads
+	}
+	if memGB < 0 {
+		memGB = -memGB
+	}
+	if memGB < 1 {
+		memGB = self.settings.MemGBPerJob
+	}
+	if self.memGBPerCore > 0 {
+		threads = max(threads, (memGB+self.memGBPerCore-1)/self.memGBPerCore)
+	}
+	return threads, memGB
+}
+
+func (self *AWSBatchJobManager) execJob(shellCmd string, argv []string,
+	envs map[string]string, metadata *Metadata, resources *JobResources,
+	fqname string, shellName string, localpreflight bool) {
+	ctx, task := trace.NewTask(context.Background(), "queueBatch")
+	if self.jobSem == nil {
+		defer task.End()
+		self.sendJob(shellCmd, argv, envs, metadata, resources, fqname, shellName, ctx)
+		return
+	}
+	go func() {
+		defer task.End()
+		if success := self.jobSem.Acquire(metadata); !success {
+			return
+		}
+		self.sendJob(shellCmd, argv, envs, metadata, resources, fqname, shellName, ctx)
+	}()
+}
+
+// Get a name for the AWS Batch job.  Names may only contain letters,
+// numbers, hyphens, and underscores, and are limited to 128 characters.
+func batchJobName(fqname, shellName string) string {
+	name := []byte(fqname + "_" + shellName)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c >= '0' && c <= '9' || c == '-' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	if len(name) > 128 {
+		// Keep the end of the name, which is the most specific part.
+		name = name[len(name)-128:]
+	}
+	return string(name)
+}
+
+// Build the request to submit a job.
+func (self *AWSBatchJobManager) submitRequest(jobDef string, shellCmd string,
+	argv []string, envs map[string]string, metadata *Metadata,
+	resources *JobResources, fqname string, shellName string) *batchSubmitJobRequest {
+	threads, memGB := self.GetSystemReqs(resources.Threads, resources.MemGB)
+	env := make([]batchKeyValue, 0, len(envs)+3)
+	for key, value := range threadEnvs(self, threads, envs) {
+		env = append(env, batchKeyValue{Name: key, Value: value})
+	}
+	env = append(env,
+		batchKeyValue{Name: "MRO_FILES", Value: metadata.curFilesPath},
+		batchKeyValue{Name: "MRO_STDOUT", Value: metadata.MetadataFilePath(StdOut)},
+		batchKeyValue{Name: "MRO_STDERR", Value: metadata.MetadataFilePath(StdErr)})
+	// Batch does not support overriding the working directory, so the
+	// wrapper changes to it, and redirects the output into the metadata
+	// directory, as the job templates for other cluster job managers do.
+	command := append([]string{
+		"/bin/sh", "-c",
+		`cd "$MRO_FILES" && exec "$@" > "$MRO_STDOUT" 2> "$MRO_STDERR"`,
+		"sh", shellCmd,
+	}, argv...)
+	overrides := &batchContainerOverrides{
+		Vcpus:       threads,
+		Memory:      memGB * 1024,
+		Command:     command,
+		Environment: env,
+	}
+	if resources.GPUs > 0 {
+		overrides.ResourceRequirements = []batchResourceRequirement{{
+			Type:  "GPU",
+			Value: strconv.Itoa(resources.GPUs),
+		}}
+	}
+	return &batchSubmitJobRequest{
+		JobName:            batchJobName(fqname, shellName),
+		JobQueue:           self.queue,
+		JobDefinition:      jobDef,
+		ContainerOverrides: overrides,
+	}
+}
+
+func (self *AWSBatchJobManager) sendJob(shellCmd string, argv []string, envs map[string]string,
+	metadata *Metadata, resources *JobResources, fqname string, shellName string,
+	ctx context.Context) {
+	if self.limiter != nil {
+		<-self.limiter.C
+	}
+	jobDef, err := self.stageJobDefinition(ctx, resources.Special)
+	if err != nil {
+		util.EnterCriticalSection()
+		defer util.ExitCriticalSection()
+		metadata.remove(QueuedLocally)
+		metadata.WriteRaw(Errors, "AWS Batch error ("+err.Error()+")")
+		return
+	}
+	req := self.submitRequest(jobDef, shellCmd, argv, envs, metadata,
+		resources, fqname, shellName)
+	if self.debug {
+		util.LogInfo("jobmngr", "Submitting AWS Batch job %s to %s",
+			req.JobName, self.queue)
+	}
+
+	util.EnterCriticalSection()
+	defer util.ExitCriticalSection()
+	metadata.remove(QueuedLocally)
+	var resp batchJobDetail
+	if err := self.request(ctx, "submitjob", req, &resp); err != nil {
+		metadata.WriteRaw(Errors, "AWS Batch error ("+err.Error()+")")
+	} else {
+		if resp.JobArn != "" {
+			metadata.WriteRaw(JobId, resp.JobArn)
+		} else {
+			metadata.WriteRaw(JobId, resp.JobId)
+		}
+		metadata.cache(JobId, metadata.uniquifier)
+	}
+}
+
+func (self *AWSBatchJobManager) endJob(metadata *Metadata) {
+	if self.jobSem != nil {
+		self.jobSem.Release(metadata)
+	}
+}
+
+// Terminate the AWS Batch job, and release its slot.
+func (self *AWSBatchJobManager) killJob(metadata *Metadata) {
+	self.endJob(metadata)
+	id, err := metadata.readRawSafe(JobId)
+	if err != nil || id == "" {
+		return
+	}
+	go func() {
+		if err := self.request(context.Background(), "terminatejob",
+			map[string]string{
+				"jobId":  batchJobIdFromArn(id),
+				"reason": "Killed by mrp.",
+			}, nil); err != nil {
+			util.LogError(err, "jobmngr", "Could not terminate AWS Batch job %s.", id)
+		}
+	}()
+}
+
+// Returns the IDs, or ARNs, of jobs which are still queued or running, or
+// have succeeded.  Jobs which failed or which AWS Batch no longer knows
+// about are omitted, so that the runtime will mark them as failed after the
+// grace period.
+func (self *AWSBatchJobManager) checkQueue(ids []string, ctx context.Context) ([]string, string) {
+	result := make([]string, 0, len(ids))
+	for start := 0; start < len(ids); start += batchDescribeLimit {
+		end := start + batchDescribeLimit
+		if end > len(ids) {
+			end = len(ids)
+		}
+		// Map the job IDs back to the values from the JobId files.
+		byId := make(map[string]string, end-start)
+		jobIds := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			jobId := batchJobIdFromArn(id)
+			byId[jobId] = id
+			jobIds = append(jobIds, jobId)
+		}
+		var resp struct {
+			Jobs []batchJobDetail `json:"jobs"`
+		}
+		if err := self.request(ctx, "describejobs", map[string][]string{
+			"jobs": jobIds,
+		}, &resp); err != nil {
+			return ids, err.Error()
+		}
+		for _, job := range resp.Jobs {
+			if job.Status != "FAILED" {
+				if id, ok := byId[job.JobId]; ok {
+					result = append(result, id)
+				} else {
+					result = append(result, job.JobId)
+				}
+			}
+		}
+	}
+	return result, ""
+}
+
+func (self *AWSBatchJobManager) hasQueueCheck() bool {
+	return true
+}
+
+func (self *AWSBatchJobManager) queueCheckGrace() time.Duration {
+	return batchQueueCheckGrace
+}
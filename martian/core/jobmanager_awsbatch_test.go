@@ -0,0 +1,316 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	// The get-vanilla case from the AWS signature version 4 test suite.
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signAWSRequest(req, nil, &awsCredentials{
+		AccessKeyId:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	const expect = "AWS4-HMAC-SHA256 " +
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if auth := req.Header.Get("Authorization"); auth != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, auth)
+	}
+}
+
+func TestBatchJobName(t *testing.T) {
+	if name := batchJobName("ID.test.PIPE.STAGE.fork0.chnk0", "main"); name !=
+		"ID_test_PIPE_STAGE_fork0_chnk0_main" {
+		t.Errorf("Incorrect job name %s", name)
+	}
+	if name := batchJobName(strings.Repeat("A.", 100), "main"); len(name) != 128 ||
+		!strings.HasSuffix(name, "_main") {
+		t.Errorf("Incorrect long job name %s", name)
+	}
+}
+
+// Serves a fake AWS Batch API, which records the submitted jobs.
+type fakeBatchServer struct {
+	t           *testing.T
+	definitions []*batchJobDefinition
+	registered  int
+	submitted   []*batchSubmitJobRequest
+	jobs        map[string]string
+}
+
+func (self *fakeBatchServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		self.t.Error("Request was not signed.")
+	}
+	enc := json.NewEncoder(w)
+	switch req.URL.Path {
+	case "/v1/describejobdefinitions":
+		enc.Encode(map[string]interface{}{"jobDefinitions": self.definitions})
+	case "/v1/registerjobdefinition":
+		var def batchJobDefinition
+		if err := json.NewDecoder(req.Body).Decode(&def); err != nil {
+			self.t.Error(err)
+		}
+		self.registered++
+		def.Revision = len(self.definitions) + 1
+		def.JobDefinitionArn = "arn:" + def.JobDefinitionName
+		self.definitions = append(self.definitions, &def)
+		enc.Encode(&def)
+	case "/v1/submitjob":
+		var sub batchSubmitJobRequest
+		if err := json.NewDecoder(req.Body).Decode(&sub); err != nil {
+			self.t.Error(err)
+		}
+		self.submitted = append(self.submitted, &sub)
+		enc.Encode(&batchJobDetail{
+			JobId:  "job" + sub.JobName,
+			JobArn: "arn:aws:batch:us-east-1:123456789012:job/job" + sub.JobName,
+		})
+	case "/v1/describejobs":
+		var ids struct {
+			Jobs []string `json:"jobs"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&ids); err != nil {
+			self.t.Error(err)
+		}
+		var resp struct {
+			Jobs []batchJobDetail `json:"jobs"`
+		}
+		for _, id := range ids.Jobs {
+			if st, ok := self.jobs[id]; ok {
+				resp.Jobs = append(resp.Jobs, batchJobDetail{JobId: id, Status: st})
+			}
+		}
+		enc.Encode(&resp)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// Set fake AWS credentials in the environment.  Returns a function which
+// restores the original environment.
+func setTestAWSCredentials() func() {
+	restore := make(map[string]*string, 2)
+	for key, value := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	} {
+		if old, ok := os.LookupEnv(key); ok {
+			restore[key] = &old
+		} else {
+			restore[key] = nil
+		}
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, old := range restore {
+			if old == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *old)
+			}
+		}
+	}
+}
+
+func testAWSBatchJobManager(srv *httptest.Server) *AWSBatchJobManager {
+	return &AWSBatchJobManager{
+		endpoint:       srv.URL,
+		region:         "us-east-1",
+		client:         srv.Client(),
+		queue:          "test-queue",
+		image:          "martian:test",
+		mountPath:      "/data",
+		jobDefinitions: make(map[string]string),
+		specialJobDefs: make(map[string]string),
+		settings:       &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+	}
+}
+
+func TestBatchJobDefinition(t *testing.T) {
+	fake := &fakeBatchServer{t: t}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	defer setTestAWSCredentials()()
+	jm := testAWSBatchJobManager(srv)
+
+	arn, err := jm.jobDefinition(context.Background(), "martian:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.registered != 1 {
+		t.Errorf("Expected a job definition to be registered.")
+	}
+	if props := fake.definitions[0].ContainerProperties; props.Image != "martian:test" ||
+		props.mountPath() != "/data" {
+		t.Errorf("Incorrect container properties %v", props)
+	}
+
+	// A new job manager reuses the job definition.
+	jm = testAWSBatchJobManager(srv)
+	if again, err := jm.jobDefinition(context.Background(), "martian:test"); err != nil {
+		t.Fatal(err)
+	} else if again != arn {
+		t.Errorf("Expected %s, got %s", arn, again)
+	}
+	if fake.registered != 1 {
+		t.Errorf("Expected the job definition to be reused.")
+	}
+}
+
+func TestBatchSubmitRequest(t *testing.T) {
+	jm := &AWSBatchJobManager{
+		queue:    "test-queue",
+		image:    "martian:test",
+		settings: &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+	}
+	metadata := NewMetadata("ID.test.PIPE.STAGE.fork0.chnk0", "/data/chnk0")
+	req := jm.submitRequest("arn:def", "/bin/stage", []string{"main", "a"},
+		nil, metadata, &JobResources{Threads: 2, MemGB: 3, GPUs: 1},
+		"ID.test.PIPE.STAGE.fork0.chnk0", "main")
+	if req.JobQueue != "test-queue" || req.JobDefinition != "arn:def" {
+		t.Errorf("Incorrect job request %v", req)
+	}
+	o := req.ContainerOverrides
+	if o.Vcpus != 2 || o.Memory != 3072 {
+		t.Errorf("Expected 2 vcpus and 3072MB, got %d and %d", o.Vcpus, o.Memory)
+	}
+	if len(o.ResourceRequirements) != 1 || o.ResourceRequirements[0].Value != "1" {
+		t.Errorf("Incorrect GPU requirements %v", o.ResourceRequirements)
+	}
+	if n := len(o.Command); n != 7 || o.Command[4] != "/bin/stage" || o.Command[6] != "a" {
+		t.Errorf("Incorrect command %v", o.Command)
+	}
+}
+
+func TestBatchSendJob(t *testing.T) {
+	fake := &fakeBatchServer{t: t}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	defer setTestAWSCredentials()()
+	jm := testAWSBatchJobManager(srv)
+
+	dir, err := ioutil.TempDir("", "TestBatchSendJob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := NewMetadata("ID.test.PIPE.STAGE", path.Join(dir, "STAGE"))
+	if err := metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	util.SetupSignalHandlers()
+	jm.sendJob("/bin/stage", nil, nil, metadata, &JobResources{},
+		"ID.test.PIPE.STAGE", "split", context.Background())
+	if len(fake.submitted) != 1 {
+		t.Fatalf("Expected 1 job to be submitted, got %d", len(fake.submitted))
+	}
+	if metadata.exists(Errors) {
+		e, _ := metadata.readRawSafe(Errors)
+		t.Fatalf("Unexpected error: %s", e)
+	}
+	if sub := fake.submitted[0]; sub.JobDefinition != fake.definitions[0].JobDefinitionArn {
+		t.Errorf("Expected job definition %s, got %s",
+			fake.definitions[0].JobDefinitionArn, sub.JobDefinition)
+	}
+	if id, err := metadata.readRawSafe(JobId); err != nil {
+		t.Error(err)
+	} else if id != "arn:aws:batch:us-east-1:123456789012:job/jobID_test_PIPE_STAGE_split" {
+		t.Errorf("Incorrect job id %s", id)
+	}
+}
+
+func TestBatchStageJobDefinition(t *testing.T) {
+	fake := &fakeBatchServer{t: t}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	defer setTestAWSCredentials()()
+	jm := testAWSBatchJobManager(srv)
+	jm.specialJobDefs = parseJobResourcesMappings(
+		"highmem:arn:aws:batch:us-east-1:123456789012:job-definition/highmem:2")
+
+	ctx := context.Background()
+	if def, err := jm.stageJobDefinition(ctx, "highmem"); err != nil {
+		t.Error(err)
+	} else if def != "arn:aws:batch:us-east-1:123456789012:job-definition/highmem:2" {
+		t.Errorf("Incorrect job definition %s for highmem", def)
+	}
+	if def, err := jm.stageJobDefinition(ctx, ""); err != nil {
+		t.Error(err)
+	} else if fake.registered != 1 || def != fake.definitions[0].JobDefinitionArn {
+		t.Errorf("Expected the registered job definition, got %s", def)
+	}
+
+	// A global job definition replaces the registered one.
+	jm.defaultJobDef = "martian:3"
+	if def, err := jm.stageJobDefinition(ctx, "other"); err != nil {
+		t.Error(err)
+	} else if def != "martian:3" {
+		t.Errorf("Expected the global job definition, got %s", def)
+	}
+	if def, err := jm.stageJobDefinition(ctx, "highmem"); err != nil {
+		t.Error(err)
+	} else if def != "arn:aws:batch:us-east-1:123456789012:job-definition/highmem:2" {
+		t.Errorf("Incorrect job definition %s for highmem", def)
+	}
+}
+
+func TestBatchCheckQueue(t *testing.T) {
+	fake := &fakeBatchServer{
+		t: t,
+		jobs: map[string]string{
+			"running":   "RUNNING",
+			"runnable":  "RUNNABLE",
+			"succeeded": "SUCCEEDED",
+			"failed":    "FAILED",
+		},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	defer setTestAWSCredentials()()
+	jm := testAWSBatchJobManager(srv)
+	if !jm.hasQueueCheck() {
+		t.Error("Expected queue checking.")
+	}
+	result, errMsg := jm.checkQueue(
+		[]string{"running", "runnable", "succeeded", "failed", "missing"},
+		context.Background())
+	if errMsg != "" {
+		t.Fatal(errMsg)
+	}
+	if len(result) != 3 || result[0] != "running" ||
+		result[1] != "runnable" || result[2] != "succeeded" {
+		t.Errorf("Expected [running runnable succeeded], got %v", result)
+	}
+
+	// Job ARNs are checked by job ID, and returned as ARNs.
+	const prefix = "arn:aws:batch:us-east-1:123456789012:job/"
+	result, errMsg = jm.checkQueue(
+		[]string{prefix + "running", prefix + "failed", "succeeded"},
+		context.Background())
+	if errMsg != "" {
+		t.Fatal(errMsg)
+	}
+	if len(result) != 2 || result[0] != prefix+"running" || result[1] != "succeeded" {
+		t.Errorf("Expected [%srunning succeeded], got %v", prefix, result)
+	}
+}
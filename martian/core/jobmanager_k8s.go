@@ -0,0 +1,473 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Job manager which runs jobs as Kubernetes Jobs.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The job mode which selects the Kubernetes job manager.
+const K8sJobMode = "k8s"
+
+const (
+	// Where the service account credentials are mounted in a pod.
+	k8sServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// The label which identifies Kubernetes Jobs created by Martian.
+	k8sManagedByLabel = "app.kubernetes.io/managed-by"
+
+	// The annotation which records the fully qualified name of the job.
+	k8sFqnameAnnotation = "martian-lang.org/fqname"
+
+	// Jobs which are not found in the Kubernetes API for this long are
+	// considered to have failed.
+	k8sQueueCheckGrace = 5 * time.Minute
+)
+
+// Runs each job as a Kubernetes Job, using the Kubernetes API.
+//
+// When mrp runs inside the cluster, it uses the credentials of its pod's
+// service account.  Otherwise it uses the current context from the
+// kubeconfig file given by KUBECONFIG, or ~/.kube/config.  The job pods run
+// in the namespace given by the MRO_K8S_NAMESPACE environment variable, or
+// else mrp's namespace or the context's namespace, using the container
+// image given by MRO_K8S_IMAGE.  The pipestance directory
+// must be on a shared filesystem.  If MRO_K8S_PVC is set, the persistent
+// volume claim it names is mounted in the job pods at MRO_K8S_MOUNT_PATH,
+// which must be where the same volume is mounted for mrp.
+type KubernetesJobManager struct {
+	server    string
+	client    *http.Client
+	token     string
+	tokenPath string
+	namespace string
+	image     string
+	pvc       string
+	mountPath string
+
+	settings      *JobManagerSettings
+	memGBPerCore  int
+	maxJobs       int
+	jobFreqMillis int
+	jobSem        *MaxJobsSemaphore
+	limiter       *time.Ticker
+	debug         bool
+}
+
+func NewKubernetesJobManager(memGBPerCore int, maxJobs int, jobFreqMillis int,
+	debug bool) (*KubernetesJobManager, error) {
+	config, err := loadK8sClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	namespace := os.Getenv("MRO_K8S_NAMESPACE")
+	if namespace == "" {
+		namespace = config.namespace
+	}
+	image := os.Getenv("MRO_K8S_IMAGE")
+	if image == "" {
+		return nil, &RuntimeError{"MRO_K8S_IMAGE must be set for the k8s job mode"}
+	}
+	pvc, mountPath := os.Getenv("MRO_K8S_PVC"), os.Getenv("MRO_K8S_MOUNT_PATH")
+	if pvc != "" && mountPath == "" {
+		return nil, &RuntimeError{"MRO_K8S_MOUNT_PATH must be set with MRO_K8S_PVC"}
+	}
+	self := &KubernetesJobManager{
+		server: config.server,
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: config.tls,
+			},
+			Timeout: time.Minute,
+		},
+		token:         config.token,
+		tokenPath:     config.tokenPath,
+		namespace:     namespace,
+		image:         image,
+		pvc:           pvc,
+		mountPath:     mountPath,
+		settings:      verifyJobManager("local", -1).jobSettings,
+		memGBPerCore:  memGBPerCore,
+		maxJobs:       maxJobs,
+		jobFreqMillis: jobFreqMillis,
+		debug:         debug,
+	}
+	util.LogInfo("jobmngr", "Running jobs with image %s in Kubernetes namespace %s.",
+		self.image, self.namespace)
+	if self.maxJobs > 0 {
+		self.jobSem = NewMaxJobsSemaphore(self.maxJobs)
+	}
+	if self.jobFreqMillis > 0 {
+		self.limiter = time.NewTicker(time.Millisecond * time.Duration(self.jobFreqMillis))
+	}
+	return self, nil
+}
+
+//
+// Subset of the Kubernetes API types used by the job manager.
+//
+
+type k8sObjectMeta struct {
+	Name        string            `json:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type k8sEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type k8sResources struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+type k8sVolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+}
+
+type k8sContainer struct {
+	Name         string           `json:"name"`
+	Image        string           `json:"image"`
+	Command      []string         `json:"command"`
+	Env          []k8sEnvVar      `json:"env,omitempty"`
+	WorkingDir   string           `json:"workingDir,omitempty"`
+	Resources    k8sResources     `json:"resources"`
+	VolumeMounts []k8sVolumeMount `json:"volumeMounts,omitempty"`
+}
+
+type k8sPVCSource struct {
+	ClaimName string `json:"claimName"`
+}
+
+type k8sVolume struct {
+	Name                  string        `json:"name"`
+	PersistentVolumeClaim *k8sPVCSource `json:"persistentVolumeClaim,omitempty"`
+}
+
+type k8sPodSpec struct {
+	RestartPolicy string         `json:"restartPolicy"`
+	Containers    []k8sContainer `json:"containers"`
+	Volumes       []k8sVolume    `json:"volumes,omitempty"`
+}
+
+type k8sPodTemplate struct {
+	Metadata k8sObjectMeta `json:"metadata"`
+	Spec     k8sPodSpec    `json:"spec"`
+}
+
+type k8sJobSpec struct {
+	BackoffLimit int            `json:"backoffLimit"`
+	Template     k8sPodTemplate `json:"template"`
+}
+
+type k8sJobStatus struct {
+	Active    int `json:"active"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+type k8sJob struct {
+	APIVersion string        `json:"apiVersion,omitempty"`
+	Kind       string        `json:"kind,omitempty"`
+	Metadata   k8sObjectMeta `json:"metadata"`
+	Spec       *k8sJobSpec   `json:"spec,omitempty"`
+	Status     *k8sJobStatus `json:"status,omitempty"`
+}
+
+type k8sJobList struct {
+	Items []k8sJob `json:"items"`
+}
+
+// Make a request to the Kubernetes API.  If out is not nil, the response
+// is decoded into it.
+func (self *KubernetesJobManager) request(ctx context.Context, method, p string,
+	query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		if b, err := json.Marshal(in); err != nil {
+			return err
+		} else {
+			body = bytes.NewReader(b)
+		}
+	}
+	u := self.server + "/apis/batch/v1/namespaces/" + self.namespace + "/jobs" + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Read the token for every request, since it may be rotated.
+	if self.tokenPath != "" {
+		if token, err := ioutil.ReadFile(self.tokenPath); err == nil {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+	} else if self.token != "" {
+		req.Header.Set("Authorization", "Bearer "+self.token)
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s\n%s", method, u, resp.Status, msg)
+	}
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (self *KubernetesJobManager) refreshResources(bool) error {
+	if self.jobSem != nil {
+		self.jobSem.FindDone()
+	}
+	return nil
+}
+
+func (self *KubernetesJobManager) GetMaxCores() int {
+	return 0
+}
+
+func (self *KubernetesJobManager) GetMaxMemGB() int {
+	return 0
+}
+
+func (self *KubernetesJobManager) GetSettings() *JobManagerSettings {
+	return self.settings
+}
+
+func (self *KubernetesJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
+	if threads == 0 {
+		threads = self.settings.ThreadsPerJob
+	} else if threads < 0 {
+		threads = -threads
+	}
+	if memGB < 0 {
+		memGB = -memGB
+	}
+	if memGB < 1 {
+		memGB = self.settings.MemGBPerJob
+	}
+	if self.memGBPerCore > 0 {
+		threads = max(threads, (memGB+self.memGBPerCore-1)/self.memGBPerCore)
+	}
+	return threads, memGB
+}
+
+func (self *KubernetesJobManager) execJob(shellCmd string, argv []string,
+	envs map[string]string, metadata *Metadata, resources *JobResources,
+	fqname string, shellName string, localpreflight bool) {
+	ctx, task := trace.NewTask(context.Background(), "queueK8s")
+	if self.jobSem == nil {
+		defer task.End()
+		self.sendJob(shellCmd, argv, envs, metadata, resources, fqname, shellName, ctx)
+		return
+	}
+	go func() {
+		defer task.End()
+		if success := self.jobSem.Acquire(metadata); !success {
+			return
+		}
+		self.sendJob(shellCmd, argv, envs, metadata, resources, fqname, shellName, ctx)
+	}()
+}
+
+// Get a name for the Kubernetes Job.  Names must be valid DNS labels, so
+// the name is derived from a hash of the fully qualified name, which is
+// recorded in an annotation instead.
+func k8sJobName(fqname, shellName string, t time.Time) string {
+	h := sha1.Sum([]byte(fqname + "." + shellName + "." +
+		strconv.FormatInt(t.UnixNano(), 10)))
+	return fmt.Sprintf("martian-%x", h[:10])
+}
+
+// Build the specification of the Kubernetes Job for a job.
+func (self *KubernetesJobManager) jobSpec(name string, shellCmd string, argv []string,
+	envs map[string]string, metadata *Metadata, resources *JobResources,
+	fqname string, shellName string) *k8sJob {
+	threads, memGB := self.GetSystemReqs(resources.Threads, resources.MemGB)
+	env := make([]k8sEnvVar, 0, len(envs)+2)
+	for key, value := range threadEnvs(self, threads, envs) {
+		env = append(env, k8sEnvVar{Name: key, Value: value})
+	}
+	env = append(env,
+		k8sEnvVar{Name: "MRO_STDOUT", Value: metadata.MetadataFilePath(StdOut)},
+		k8sEnvVar{Name: "MRO_STDERR", Value: metadata.MetadataFilePath(StdErr)})
+	// Redirect the output into the metadata directory, as the job templates
+	// for other cluster job managers do.
+	command := append([]string{
+		"/bin/sh", "-c", `exec "$@" > "$MRO_STDOUT" 2> "$MRO_STDERR"`,
+		"sh", shellCmd,
+	}, argv...)
+	res := k8sResources{
+		Requests: map[string]string{
+			"cpu":    strconv.Itoa(threads),
+			"memory": strconv.Itoa(memGB) + "Gi",
+		},
+	}
+	if resources.GPUs > 0 {
+		res.Limits = map[string]string{
+			"nvidia.com/gpu": strconv.Itoa(resources.GPUs),
+		}
+	}
+	container := k8sContainer{
+		Name:       "stage",
+		Image:      self.image,
+		Command:    command,
+		Env:        env,
+		WorkingDir: metadata.curFilesPath,
+		Resources:  res,
+	}
+	labels := map[string]string{k8sManagedByLabel: "martian"}
+	job := &k8sJob{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Metadata: k8sObjectMeta{
+			Name:        name,
+			Namespace:   self.namespace,
+			Labels:      labels,
+			Annotations: map[string]string{k8sFqnameAnnotation: fqname + "." + shellName},
+		},
+		Spec: &k8sJobSpec{
+			// Martian handles retries itself.
+			BackoffLimit: 0,
+			Template: k8sPodTemplate{
+				Metadata: k8sObjectMeta{Labels: labels},
+				Spec: k8sPodSpec{
+					RestartPolicy: "Never",
+					Containers:    []k8sContainer{container},
+				},
+			},
+		},
+	}
+	if self.pvc != "" {
+		spec := &job.Spec.Template.Spec
+		spec.Volumes = []k8sVolume{{
+			Name:                  "pipestance",
+			PersistentVolumeClaim: &k8sPVCSource{ClaimName: self.pvc},
+		}}
+		spec.Containers[0].VolumeMounts = []k8sVolumeMount{{
+			Name:      "pipestance",
+			MountPath: self.mountPath,
+		}}
+	}
+	return job
+}
+
+func (self *KubernetesJobManager) sendJob(shellCmd string, argv []string, envs map[string]string,
+	metadata *Metadata, resources *JobResources, fqname string, shellName string,
+	ctx context.Context) {
+	if self.limiter != nil {
+		<-self.limiter.C
+	}
+	name := k8sJobName(fqname, shellName, time.Now())
+	job := self.jobSpec(name, shellCmd, argv, envs, metadata, resources,
+		fqname, shellName)
+	if self.debug {
+		util.LogInfo("jobmngr", "Creating Kubernetes job %s for %s.%s",
+			name, fqname, shellName)
+	}
+
+	util.EnterCriticalSection()
+	defer util.ExitCriticalSection()
+	metadata.remove(QueuedLocally)
+	if err := self.request(ctx, http.MethodPost, "", nil, job, nil); err != nil {
+		metadata.WriteRaw(Errors, "k8s error ("+err.Error()+")")
+	} else {
+		metadata.WriteRaw(JobId, name)
+		metadata.cache(JobId, metadata.uniquifier)
+	}
+}
+
+// Delete the Kubernetes Job, and its pods, once Martian is done with it.
+func (self *KubernetesJobManager) endJob(metadata *Metadata) {
+	if self.jobSem != nil {
+		self.jobSem.Release(metadata)
+	}
+	if !metadata.exists(JobId) {
+		return
+	}
+	name, err := metadata.readRawSafe(JobId)
+	if err != nil || name == "" {
+		return
+	}
+	go func() {
+		if err := self.request(context.Background(), http.MethodDelete,
+			"/"+url.PathEscape(name),
+			url.Values{"propagationPolicy": []string{"Background"}},
+			nil, nil); err != nil {
+			util.LogError(err, "jobmngr", "Could not delete Kubernetes job %s.", name)
+		}
+	}()
+}
+
+// Deleting the Kubernetes Job also kills its pods.
+func (self *KubernetesJobManager) killJob(metadata *Metadata) {
+	self.endJob(metadata)
+}
+
+// Returns the IDs of jobs which are still active or have succeeded.  Jobs
+// which failed or which no longer exist are omitted, so that the runtime
+// will mark them as failed after the grace period.
+func (self *KubernetesJobManager) checkQueue(ids []string, ctx context.Context) ([]string, string) {
+	var jobs k8sJobList
+	if err := self.request(ctx, http.MethodGet, "",
+		url.Values{"labelSelector": []string{k8sManagedByLabel + "=martian"}},
+		nil, &jobs); err != nil {
+		return ids, err.Error()
+	}
+	alive := make(map[string]bool, len(jobs.Items))
+	for _, job := range jobs.Items {
+		if st := job.Status; st == nil || st.Active > 0 || st.Failed == 0 {
+			alive[job.Metadata.Name] = true
+		}
+	}
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if alive[id] {
+			result = append(result, id)
+		}
+	}
+	return result, ""
+}
+
+func (self *KubernetesJobManager) hasQueueCheck() bool {
+	return true
+}
+
+func (self *KubernetesJobManager) queueCheckGrace() time.Duration {
+	return k8sQueueCheckGrace
+}
@@ -0,0 +1,245 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Connection configuration for the Kubernetes job manager.
+
+package core
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// How to connect to the Kubernetes API server.
+type k8sClientConfig struct {
+	server    string
+	tls       *tls.Config
+	namespace string
+
+	// A bearer token, or a file from which to read one for each request.
+	token     string
+	tokenPath string
+}
+
+// Get the configuration for connecting to the API server.  When mrp runs
+// in a pod, the pod's service account is used.  Otherwise the current
+// context of the kubeconfig file given by KUBECONFIG, or ~/.kube/config,
+// is used.
+func loadK8sClientConfig() (*k8sClientConfig, error) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return k8sInClusterConfig()
+	}
+	return k8sKubeConfig(k8sKubeConfigPath())
+}
+
+func k8sInClusterConfig() (*k8sClientConfig, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, &RuntimeError{
+			"KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set"}
+	}
+	caCert, err := ioutil.ReadFile(k8sServiceAccountPath + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, &RuntimeError{"could not parse the Kubernetes CA certificate"}
+	}
+	ns, err := ioutil.ReadFile(k8sServiceAccountPath + "/namespace")
+	if err != nil {
+		return nil, err
+	}
+	return &k8sClientConfig{
+		server:    "https://" + net.JoinHostPort(host, port),
+		tls:       &tls.Config{RootCAs: pool},
+		namespace: strings.TrimSpace(string(ns)),
+		tokenPath: k8sServiceAccountPath + "/token",
+	}, nil
+}
+
+// Get the path to the kubeconfig file.  If KUBECONFIG lists several files,
+// only the first is used.
+func k8sKubeConfigPath() string {
+	if p := os.Getenv("KUBECONFIG"); p != "" {
+		return filepath.SplitList(p)[0]
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return path.Join(home, ".kube", "config")
+	}
+	if u, err := user.Current(); err == nil {
+		return path.Join(u.HomeDir, ".kube", "config")
+	}
+	return ""
+}
+
+// The subset of the kubeconfig file format used by the job manager.
+type k8sKubeConfigFile struct {
+	CurrentContext string `json:"current-context"`
+	Clusters       []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			Server                   string `json:"server"`
+			CertificateAuthority     string `json:"certificate-authority"`
+			CertificateAuthorityData string `json:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+	Users []struct {
+		Name string `json:"name"`
+		User struct {
+			Token                 string          `json:"token"`
+			TokenFile             string          `json:"tokenFile"`
+			ClientCertificate     string          `json:"client-certificate"`
+			ClientCertificateData string          `json:"client-certificate-data"`
+			ClientKey             string          `json:"client-key"`
+			ClientKeyData         string          `json:"client-key-data"`
+			Exec                  json.RawMessage `json:"exec"`
+			AuthProvider          json.RawMessage `json:"auth-provider"`
+		} `json:"user"`
+	} `json:"users"`
+	Contexts []struct {
+		Name    string `json:"name"`
+		Context struct {
+			Cluster   string `json:"cluster"`
+			User      string `json:"user"`
+			Namespace string `json:"namespace"`
+		} `json:"context"`
+	} `json:"contexts"`
+}
+
+// Read a kubeconfig file.  Files in JSON format are read directly.  YAML
+// files are converted to JSON with kubectl, which must be on the PATH.
+func readK8sKubeConfig(fn string) (*k8sKubeConfigFile, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) == 0 || trimmed[0] != '{' {
+		cmd := exec.Command("kubectl", "config", "view", "--raw",
+			"-o", "json", "--kubeconfig", fn)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if b, err = cmd.Output(); err != nil {
+			return nil, &RuntimeError{
+				"could not convert " + fn + " to JSON with kubectl: " +
+					err.Error() + "\n" + stderr.String()}
+		}
+	}
+	var config k8sKubeConfigFile
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Get the connection configuration for the current context of a kubeconfig
+// file.
+func k8sKubeConfig(fn string) (*k8sClientConfig, error) {
+	if fn == "" {
+		return nil, &RuntimeError{"could not find a kubeconfig file"}
+	}
+	kc, err := readK8sKubeConfig(fn)
+	if err != nil {
+		return nil, err
+	}
+	// Relative paths are relative to the kubeconfig file.
+	resolve := func(p string) string {
+		if p != "" && !filepath.IsAbs(p) {
+			return path.Join(path.Dir(fn), p)
+		}
+		return p
+	}
+	// Read inline base64 data, or else the named file.
+	readData := func(data, file string) ([]byte, error) {
+		if data != "" {
+			return base64.StdEncoding.DecodeString(data)
+		} else if file != "" {
+			return ioutil.ReadFile(resolve(file))
+		}
+		return nil, nil
+	}
+	if kc.CurrentContext == "" {
+		return nil, &RuntimeError{fn + " has no current context"}
+	}
+	config := &k8sClientConfig{
+		tls:       new(tls.Config),
+		namespace: "default",
+	}
+	var clusterName, userName string
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+			if c.Context.Namespace != "" {
+				config.namespace = c.Context.Namespace
+			}
+		}
+	}
+	if clusterName == "" {
+		return nil, &RuntimeError{
+			"context " + kc.CurrentContext + " was not found in " + fn}
+	}
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		config.server = strings.TrimSuffix(c.Cluster.Server, "/")
+		config.tls.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		if ca, err := readData(c.Cluster.CertificateAuthorityData,
+			c.Cluster.CertificateAuthority); err != nil {
+			return nil, err
+		} else if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, &RuntimeError{
+					"could not parse the certificate authority for cluster " +
+						clusterName}
+			}
+			config.tls.RootCAs = pool
+		}
+	}
+	if config.server == "" {
+		return nil, &RuntimeError{
+			"no server was found for cluster " + clusterName + " in " + fn}
+	}
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if len(u.User.Exec) > 0 || len(u.User.AuthProvider) > 0 {
+			return nil, &RuntimeError{
+				"exec and auth-provider credentials are not supported for user " +
+					userName}
+		}
+		config.token = u.User.Token
+		config.tokenPath = resolve(u.User.TokenFile)
+		cert, err := readData(u.User.ClientCertificateData, u.User.ClientCertificate)
+		if err != nil {
+			return nil, err
+		}
+		key, err := readData(u.User.ClientKeyData, u.User.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		if cert != nil || key != nil {
+			if pair, err := tls.X509KeyPair(cert, key); err != nil {
+				return nil, err
+			} else {
+				config.tls.Certificates = []tls.Certificate{pair}
+			}
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func testKubernetesJobManager(srv *httptest.Server) *KubernetesJobManager {
+	return &KubernetesJobManager{
+		server:    srv.URL,
+		client:    srv.Client(),
+		namespace: "test",
+		image:     "martian:test",
+		pvc:       "data",
+		mountPath: "/data",
+		settings:  &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+	}
+}
+
+func TestK8sJobSpec(t *testing.T) {
+	jm := &KubernetesJobManager{
+		namespace: "test",
+		image:     "martian:test",
+		pvc:       "data",
+		mountPath: "/data",
+		settings:  &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+	}
+	metadata := NewMetadata("ID.test.PIPE.STAGE.fork0.chnk0", "/data/chnk0")
+	job := jm.jobSpec("martian-abc", "/bin/stage", []string{"main", "a"},
+		nil, metadata, &JobResources{Threads: 2, MemGB: 3, GPUs: 1},
+		"ID.test.PIPE.STAGE.fork0.chnk0", "main")
+	if job.Metadata.Name != "martian-abc" || job.Metadata.Namespace != "test" {
+		t.Errorf("Incorrect job metadata %v", job.Metadata)
+	}
+	if job.Metadata.Labels[k8sManagedByLabel] != "martian" {
+		t.Errorf("Missing label on job.")
+	}
+	spec := job.Spec.Template.Spec
+	if len(spec.Containers) != 1 {
+		t.Fatalf("Expected 1 container, got %d", len(spec.Containers))
+	}
+	c := spec.Containers[0]
+	if c.Image != "martian:test" {
+		t.Errorf("Incorrect image %s", c.Image)
+	}
+	if n := len(c.Command); n != 7 ||
+		c.Command[4] != "/bin/stage" || c.Command[6] != "a" {
+		t.Errorf("Incorrect command %v", c.Command)
+	}
+	if c.Resources.Requests["cpu"] != "2" ||
+		c.Resources.Requests["memory"] != "3Gi" ||
+		c.Resources.Limits["nvidia.com/gpu"] != "1" {
+		t.Errorf("Incorrect resources %v", c.Resources)
+	}
+	if len(c.VolumeMounts) != 1 || c.VolumeMounts[0].MountPath != "/data" ||
+		len(spec.Volumes) != 1 ||
+		spec.Volumes[0].PersistentVolumeClaim.ClaimName != "data" {
+		t.Errorf("Incorrect volumes %v %v", spec.Volumes, c.VolumeMounts)
+	}
+	if spec.RestartPolicy != "Never" || job.Spec.BackoffLimit != 0 {
+		t.Errorf("Jobs should not be retried by Kubernetes.")
+	}
+}
+
+func TestK8sSendJob(t *testing.T) {
+	var lock sync.Mutex
+	var created []*k8sJob
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost ||
+			req.URL.Path != "/apis/batch/v1/namespaces/test/jobs" {
+			t.Errorf("Unexpected request %s %s", req.Method, req.URL.Path)
+		}
+		var job k8sJob
+		if err := json.NewDecoder(req.Body).Decode(&job); err != nil {
+			t.Error(err)
+		}
+		lock.Lock()
+		created = append(created, &job)
+		lock.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&job)
+	}))
+	defer srv.Close()
+	jm := testKubernetesJobManager(srv)
+
+	dir, err := ioutil.TempDir("", "TestK8sSendJob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := NewMetadata("ID.test.PIPE.STAGE", path.Join(dir, "STAGE"))
+	if err := metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	util.SetupSignalHandlers()
+	jm.sendJob("/bin/stage", nil, nil, metadata, &JobResources{},
+		"ID.test.PIPE.STAGE", "split", context.Background())
+	if len(created) != 1 {
+		t.Fatalf("Expected 1 job to be created, got %d", len(created))
+	}
+	if metadata.exists(Errors) {
+		e, _ := metadata.readRawSafe(Errors)
+		t.Fatalf("Unexpected error: %s", e)
+	}
+	if id, err := metadata.readRawSafe(JobId); err != nil {
+		t.Error(err)
+	} else if id != created[0].Metadata.Name {
+		t.Errorf("Expected job id %s, got %s", created[0].Metadata.Name, id)
+	}
+}
+
+func TestK8sCheckQueue(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if sel := req.URL.Query().Get("labelSelector"); sel != k8sManagedByLabel+"=martian" {
+			t.Errorf("Incorrect label selector %s", sel)
+		}
+		json.NewEncoder(w).Encode(&k8sJobList{
+			Items: []k8sJob{
+				{
+					Metadata: k8sObjectMeta{Name: "active"},
+					Status:   &k8sJobStatus{Active: 1},
+				},
+				{
+					Metadata: k8sObjectMeta{Name: "succeeded"},
+					Status:   &k8sJobStatus{Succeeded: 1},
+				},
+				{
+					Metadata: k8sObjectMeta{Name: "failed"},
+					Status:   &k8sJobStatus{Failed: 1},
+				},
+			},
+		})
+	}))
+	defer srv.Close()
+	jm := testKubernetesJobManager(srv)
+	if !jm.hasQueueCheck() {
+		t.Error("Expected queue checking.")
+	}
+	result, errMsg := jm.checkQueue(
+		[]string{"active", "succeeded", "failed", "missing"},
+		context.Background())
+	if errMsg != "" {
+		t.Fatal(errMsg)
+	}
+	if len(result) != 2 || result[0] != "active" || result[1] != "succeeded" {
+		t.Errorf("Expected [active succeeded], got %v", result)
+	}
+}
+
+func TestK8sKubeConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if auth := req.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Incorrect authorization %q", auth)
+		}
+		if !strings.HasPrefix(req.URL.Path, "/apis/batch/v1/namespaces/pipelines/") {
+			t.Errorf("Incorrect path %s", req.URL.Path)
+		}
+		json.NewEncoder(w).Encode(&k8sJobList{})
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "TestK8sKubeConfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, "token"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ca := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}))
+	fn := path.Join(dir, "config")
+	if err := ioutil.WriteFile(fn, []byte(`{
+	"current-context": "test",
+	"contexts": [
+		{"name": "other", "context": {"cluster": "other", "user": "other"}},
+		{"name": "test", "context": {"cluster": "test", "user": "test", "namespace": "pipelines"}}
+	],
+	"clusters": [
+		{"name": "other", "cluster": {"server": "https://other"}},
+		{"name": "test", "cluster": {"server": "`+srv.URL+`", "certificate-authority-data": "`+ca+`"}}
+	],
+	"users": [
+		{"name": "test", "user": {"tokenFile": "token"}}
+	]
+}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := k8sKubeConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.server != srv.URL || config.namespace != "pipelines" ||
+		config.tokenPath != path.Join(dir, "token") {
+		t.Errorf("Incorrect config %v", config)
+	}
+	jm := &KubernetesJobManager{
+		server: config.server,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: config.tls},
+		},
+		tokenPath: config.tokenPath,
+		namespace: config.namespace,
+	}
+	if _, errMsg := jm.checkQueue([]string{"job"}, context.Background()); errMsg != "" {
+		t.Error(errMsg)
+	}
+
+	if err := ioutil.WriteFile(fn, []byte(`{
+	"current-context": "test",
+	"contexts": [{"name": "test", "context": {"cluster": "test", "user": "test"}}],
+	"clusters": [{"name": "test", "cluster": {"server": "https://test"}}],
+	"users": [{"name": "test", "user": {"exec": {"command": "aws"}}}]
+}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k8sKubeConfig(fn); err == nil {
+		t.Error("Expected an error for exec credentials.")
+	}
+}
@@ -0,0 +1,97 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Job submission scripts from user-supplied Go templates.
+
+package core
+
+import (
+	"bytes"
+	"strconv"
+	"text/template"
+)
+
+// The data available to a job template given with --jobtemplate.
+//
+// For example, a SLURM template might contain
+//
+//	#SBATCH -J {{.JobName}}
+//	#SBATCH --cpus-per-task={{.Threads}}
+//	#SBATCH --mem={{.MemMB}}
+//	{{if .GPUs}}#SBATCH --gres=gpu:{{.GPUs}}{{end}}
+//	#SBATCH --account=my_account
+//	{{.Cmd}}
+type JobTemplateData struct {
+	// The fully qualified name of the stage, fork, or chunk.
+	Fqname string
+
+	// The name of the job, which is the fqname followed by the phase of
+	// the stage (split, main, or join).
+	JobName string
+
+	Threads        int
+	MemGB          int
+	MemMB          int
+	MemGBPerThread int
+	MemMBPerThread int
+	GPUs           int
+
+	// The special resource requested by the stage.
+	Special string
+
+	// The resource option from the job manager configuration, with the
+	// value which MRO_JOBRESOURCES maps the special resource to.
+	Resources string
+
+	// The value of the MRO_ACCOUNT environment variable.
+	Account string
+
+	// The command to run.  For an array job, this is a shell case
+	// statement which runs the command for the current task.
+	Cmd string
+
+	Stdout  string
+	Stderr  string
+	WorkDir string
+
+	// The range of task indexes for an array job, e.g. "1-10", or empty
+	// for other jobs.
+	Array string
+}
+
+// Convert the template parameters used for __MRO_*__ templates into data
+// for a Go template.
+func newJobTemplateData(params map[string]string) *JobTemplateData {
+	atoi := func(key string) int {
+		i, _ := strconv.Atoi(params[key])
+		return i
+	}
+	return &JobTemplateData{
+		Fqname:         params["FQNAME"],
+		JobName:        params["JOB_NAME"],
+		Threads:        atoi("THREADS"),
+		MemGB:          atoi("MEM_GB"),
+		MemMB:          atoi("MEM_MB"),
+		MemGBPerThread: atoi("MEM_GB_PER_THREAD"),
+		MemMBPerThread: atoi("MEM_MB_PER_THREAD"),
+		GPUs:           atoi("GPUS"),
+		Special:        params["SPECIAL"],
+		Resources:      params["RESOURCES"],
+		Account:        params["ACCOUNT"],
+		Cmd:            params["CMD"],
+		Stdout:         params["STDOUT"],
+		Stderr:         params["STDERR"],
+		WorkDir:        params["JOB_WORKDIR"],
+		Array:          params["ARRAY"],
+	}
+}
+
+// Render a Go job template with the given parameters.
+func renderJobTemplate(t *template.Template, params map[string]string) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, newJobTemplateData(params)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func testTemplateJobManager(t *testing.T, text string) *RemoteJobManager {
+	t.Helper()
+	tmpl, err := template.New("test").Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RemoteJobManager{
+		jobResourcesMappings: map[string]string{"highmem": "mem=high"},
+		config: jobManagerConfig{
+			jobSettings:      &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+			jobCmd:           "cat",
+			jobResourcesOpt:  "#SBATCH --constraint=__RESOURCES__",
+			threadingEnabled: true,
+			goTemplate:       tmpl,
+		},
+	}
+}
+
+func TestJobTemplateScript(t *testing.T) {
+	jm := testTemplateJobManager(t, `#SBATCH -J {{.JobName}}
+#SBATCH -c {{.Threads}} --mem={{.MemMB}}
+{{if .GPUs}}#SBATCH --gres=gpu:{{.GPUs}}
+{{end}}{{with .Resources}}{{.}}
+{{end}}# {{.Fqname}} {{.Special}}
+{{.Cmd}}
+`)
+	_, params := jm.jobParams(&JobResources{Threads: 2, MemGB: 3, Special: "highmem"})
+	params["FQNAME"] = "ID.test.STAGE"
+	params["JOB_NAME"] = "ID.test.STAGE.main"
+	params["CMD"] = "/bin/stage main"
+	script, err := jm.jobScript(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `#SBATCH -J ID.test.STAGE.main
+#SBATCH -c 2 --mem=3072
+#SBATCH --constraint=mem=high
+# ID.test.STAGE highmem
+/bin/stage main
+`
+	if script != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, script)
+	}
+}
+
+func TestJobTemplateError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestJobTemplateError")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jm := testTemplateJobManager(t, "{{.NoSuchField}}\n")
+	metadata := NewMetadata("ID.test.STAGE", path.Join(dir, "STAGE"))
+	if err := metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	util.SetupSignalHandlers()
+	jm.sendJob("/bin/stage", nil, nil, metadata, &JobResources{},
+		"ID.test.STAGE", "main", context.Background())
+	if e, err := metadata.readRawSafe(Errors); err != nil {
+		t.Error("Expected an error.")
+	} else if !strings.Contains(e, "NoSuchField") {
+		t.Errorf("Incorrect error %s", e)
+	}
+	if metadata.exists(JobId) {
+		t.Error("Expected the job not to be submitted.")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestLocalDrain(t *testing.T) {
+	var jm LocalJobManager
+	if !jm.drain(time.Millisecond) {
+		t.Error("Expected no jobs to wait for.")
+	}
+	jm.running.Add(1)
+	if jm.drain(time.Millisecond) {
+		t.Error("Expected the drain to time out.")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		jm.running.Done()
+	}()
+	if !jm.drain(time.Minute) {
+		t.Error("Expected the job to finish.")
+	}
+}
+
+func TestLocalKillJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLocalKillJob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := NewMetadata("ID.test.STAGE.fork0.chnk0", path.Join(dir, "chnk0"))
+	if err := metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	util.SetupSignalHandlers()
+	jm := &LocalJobManager{
+		maxCores:    1,
+		maxMemGB:    1,
+		jobSettings: &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+		coreSem:     NewResourceSemaphore(1, "threads"),
+		memMBSem:    NewResourceSemaphore(1024, "MB of memory"),
+	}
+	jm.execJob("sleep", []string{"60"}, nil, metadata,
+		&JobResources{Threads: 1, MemGB: 1}, metadata.fqname, "main", false)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		jm.jobsMutex.Lock()
+		job := jm.jobs[metadata]
+		jm.jobsMutex.Unlock()
+		if job != nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("Job was not started.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	jm.killJob(metadata)
+	if n := jm.coreSem.InUse(); n != 0 {
+		t.Errorf("Expected the job's cores to be released, got %d in use.", n)
+	}
+	if n := jm.memMBSem.InUse(); n != 0 {
+		t.Errorf("Expected the job's memory to be released, got %d MB in use.", n)
+	}
+	if len(jm.jobs) != 0 {
+		t.Error("Expected the job to be forgotten.")
+	}
+	// Killing a job which is not running does nothing.
+	jm.killJob(metadata)
+}
+
+func TestRemoteKillJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRemoteKillJob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := NewMetadata("ID.test.STAGE.fork0.chnk0", path.Join(dir, "chnk0"))
+	if err := metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	killCmd := path.Join(dir, "kill")
+	if err := ioutil.WriteFile(killCmd, []byte(`#!/bin/sh
+echo "$1" > "$0.killed"
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	jm := &RemoteJobManager{
+		config: jobManagerConfig{killCmd: killCmd},
+		jobSem: NewMaxJobsSemaphore(1),
+	}
+	if !jm.jobSem.Acquire(metadata) {
+		t.Fatal("Could not acquire a job slot.")
+	}
+	metadata.WriteRaw(JobId, "12345")
+	jm.killJob(metadata)
+	if b, err := ioutil.ReadFile(killCmd + ".killed"); err != nil {
+		t.Error(err)
+	} else if string(b) != "12345\n" {
+		t.Errorf("Expected job 12345 to be killed, got %q", b)
+	}
+	if n := jm.jobSem.Current(); n != 0 {
+		t.Errorf("Expected the job's slot to be released, got %d in use.", n)
+	}
+}
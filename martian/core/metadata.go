@@ -5,8 +5,12 @@ package core
 // Martian runtime. This is where the action happens.
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -29,6 +33,7 @@ const (
 	AlarmFile      MetadataFileName = "alarm"
 	ArgsFile       MetadataFileName = "args"
 	Assert         MetadataFileName = "assert"
+	AttemptsFile   MetadataFileName = "attempts"
 	ChunkDefsFile  MetadataFileName = "chunk_defs"
 	ChunkOutsFile  MetadataFileName = "chunk_outs"
 	CompleteFile   MetadataFileName = "complete"
@@ -42,10 +47,14 @@ const (
 	Lock           MetadataFileName = "lock"
 	LogFile        MetadataFileName = "log"
 	MetadataZip    MetadataFileName = "metadata.zip"
+	MetadataVer    MetadataFileName = "metadata_version"
 	MroSourceFile  MetadataFileName = "mrosource"
 	OutsFile       MetadataFileName = "outs"
+	PausedFile     MetadataFileName = "paused"
 	Perf           MetadataFileName = "perf"
 	PerfData       MetadataFileName = "perf.data"
+	Preempted      MetadataFileName = "preempted"
+	Preemptions    MetadataFileName = "preemptions"
 	ProfileOut     MetadataFileName = "profile.out"
 	ProgressFile   MetadataFileName = "progress"
 	QueuedLocally  MetadataFileName = "queued_locally"
@@ -65,12 +74,20 @@ const (
 
 const MetadataFilePrefix string = "_"
 
+// The suffix for metadata files which were compressed after their node
+// completed.
+const CompressedSuffix string = ".gz"
+
+// Metadata files smaller than this are not worth compressing.
+const minCompressSize = 512
+
 func (self MetadataFileName) FileName() string {
 	return MetadataFilePrefix + string(self)
 }
 
 func metadataFileNameFromPath(p string) MetadataFileName {
-	return MetadataFileName(path.Base(p)[len(MetadataFilePrefix):])
+	return MetadataFileName(strings.TrimSuffix(
+		path.Base(p)[len(MetadataFilePrefix):], CompressedSuffix))
 }
 
 type MetadataState string
@@ -84,6 +101,7 @@ const (
 	Ready         MetadataState = "ready"
 	Waiting       MetadataState = ""
 	ForkWaiting   MetadataState = "waiting"
+	Paused        MetadataState = "paused"
 )
 
 const (
@@ -150,6 +168,13 @@ type Metadata struct {
 	// the chunk will be failed out if the state seems like it's still running
 	// after the job manager's grace period has elapsed.
 	notRunningSince time.Time
+
+	// Samples of the resource usage of the job, if it was run locally and
+	// sampling is enabled.
+	samples sampleRing
+
+	// If set, metadata files which are not on disk are read from here.
+	archive *metadataArchive
 }
 
 // Basic exportable information from a metadata object.
@@ -191,7 +216,7 @@ func NewMetadataWithJournalPath(fqname string, p string, journalPath string) *Me
 
 func (self *Metadata) glob() []string {
 	paths, _ := filepath.Glob(path.Join(self.path, AnyFile.FileName()))
-	return paths
+	return append(paths, self.archive.glob(self.path, AnyFile.FileName())...)
 }
 
 // Gets the locations of the symlinks pointing to uniquified directories.
@@ -432,12 +457,17 @@ func (self *Metadata) discoverUniquify() {
 // Returns the uniquifier for this pipestance, if any, by
 // examining the symlink from finalPath.
 func (self *Metadata) discoverUniquifier() string {
-	if rel, err := os.Readlink(self.finalPath); err == nil {
-		dest := path.Join(path.Dir(self.finalPath), rel)
-		if strings.HasPrefix(dest, self.finalPath+"-u") {
-			return dest[len(self.finalPath)+2:]
+	rel, err := os.Readlink(self.finalPath)
+	if err != nil {
+		var ok bool
+		if rel, ok = self.archive.readlink(self.finalPath); !ok {
+			return ""
 		}
 	}
+	dest := path.Join(path.Dir(self.finalPath), rel)
+	if strings.HasPrefix(dest, self.finalPath+"-u") {
+		return dest[len(self.finalPath)+2:]
+	}
 	return ""
 }
 
@@ -481,8 +511,79 @@ func (self *Metadata) exists(name MetadataFileName) bool {
 	return ok
 }
 
+type gzipFileReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (self gzipFileReader) Close() error {
+	self.Reader.Close()
+	return self.f.Close()
+}
+
+// Open a metadata file for reading.  If the file does not exist but a
+// compressed version of it does, the compressed file is decompressed
+// transparently.
+//
+// Also returns the size of the file on disk.
+func openMetadataFile(p string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(p)
+	compressed := false
+	if os.IsNotExist(err) {
+		if gf, gzErr := os.Open(p + CompressedSuffix); gzErr == nil {
+			f, err = gf, nil
+			compressed = true
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if !compressed {
+		return f, info.Size(), nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return gzipFileReader{Reader: zr, f: f}, info.Size(), nil
+}
+
+// Read a metadata file, decompressing it if it was compressed.
+func ReadMetadataFile(p string) ([]byte, error) {
+	f, _, err := openMetadataFile(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// Open a metadata file for reading, as for openMetadataFile, falling back
+// to the archive if the file is not on disk.
+func (self *Metadata) openFile(p string) (io.ReadCloser, int64, error) {
+	f, size, err := openMetadataFile(p)
+	if os.IsNotExist(err) {
+		if content, ok := self.archive.readFile(p); ok {
+			return ioutil.NopCloser(bytes.NewReader(content)),
+				int64(len(content)), nil
+		}
+	}
+	return f, size, err
+}
+
 func (self *Metadata) readRawBytes(name MetadataFileName) ([]byte, error) {
-	return ioutil.ReadFile(self.MetadataFilePath(name))
+	f, _, err := self.openFile(self.MetadataFilePath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
 }
 
 func (self *Metadata) readRawSafe(name MetadataFileName) (string, error) {
@@ -514,7 +615,7 @@ func (self *Metadata) read(name MetadataFileName, limit int64) (LazyArgumentMap,
 		return v, nil
 	}
 	p := self.MetadataFilePath(name)
-	if f, err := os.Open(p); err != nil {
+	if f, size, err := self.openFile(p); err != nil {
 		if !os.IsNotExist(err) {
 			util.LogError(err, "runtime",
 				"Could not open %s",
@@ -522,17 +623,13 @@ func (self *Metadata) read(name MetadataFileName, limit int64) (LazyArgumentMap,
 		}
 		return nil, err
 	} else {
-		if err := func(p string, f *os.File, limit int64, v *LazyArgumentMap) error {
+		if err := func(p string, f io.ReadCloser, limit int64, v *LazyArgumentMap) error {
 			defer f.Close()
-			if limit > 0 {
-				if info, err := f.Stat(); err != nil {
-					return err
-				} else if info.Size() > limit {
-					return fmt.Errorf(
-						"Insufficient memory to read %s\n"+
-							"File is %d bytes, read size limited to %d bytes.",
-						p, info.Size(), limit)
-				}
+			if limit > 0 && size > limit {
+				return fmt.Errorf(
+					"Insufficient memory to read %s\n"+
+						"File is %d bytes, read size limited to %d bytes.",
+					p, size, limit)
 			}
 			dec := json.NewDecoder(f)
 			return dec.Decode(v)
@@ -669,11 +766,145 @@ func (self *Metadata) UpdateJournal(name MetadataFileName) error {
 
 func (self *Metadata) remove(name MetadataFileName) error {
 	self.uncache(name)
-	return os.Remove(self.MetadataFilePath(name))
+	return removeMetadataFile(self.MetadataFilePath(name))
 }
 func (self *Metadata) _removeNoLock(name MetadataFileName) error {
 	self._uncacheNoLock(name)
-	return os.Remove(self.MetadataFilePath(name))
+	return removeMetadataFile(self.MetadataFilePath(name))
+}
+
+// Remove a metadata file, and the compressed version of it if one exists.
+func removeMetadataFile(p string) error {
+	err := os.Remove(p)
+	if gzErr := os.Remove(p + CompressedSuffix); gzErr == nil && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Compress the metadata files, other than small ones, for a node which
+// has completed.  Readers fall back to the compressed file when the
+// uncompressed one does not exist.
+func (self *Metadata) compress() {
+	for _, p := range self.glob() {
+		if strings.HasSuffix(p, CompressedSuffix) ||
+			strings.HasSuffix(p, ".tmp") ||
+			metadataFileNameFromPath(p) == MetadataZip {
+			continue
+		}
+		if info, err := os.Lstat(p); err != nil ||
+			!info.Mode().IsRegular() || info.Size() < minCompressSize {
+			continue
+		}
+		if err := compressFile(p); err != nil {
+			util.LogError(err, "runtime", "Could not compress %s", p)
+		}
+	}
+}
+
+// Replace a file with a gzipped copy.  The compressed file is moved into
+// place before the original is removed, so that the content is always
+// available to readers.
+func compressFile(p string) error {
+	in, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := p + CompressedSuffix + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, p+CompressedSuffix)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(p)
+}
+
+// Create a zip archive of metadata files, with paths relative to the
+// directory containing the archive.
+//
+// This is like util.CreateZip, except that metadata files which were
+// compressed are decompressed into the archive under their uncompressed
+// names, so that readers of the archive do not need to know which files
+// were compressed.
+func createMetadataZip(zipPath string, filePaths []string) error {
+	f, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, filePath := range filePaths {
+		info, err := os.Lstat(filePath)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		relPath, _ := filepath.Rel(path.Dir(zipPath), filePath)
+		compressed := info.Mode().IsRegular() &&
+			strings.HasSuffix(relPath, CompressedSuffix)
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = relPath
+		if compressed {
+			header.Name = strings.TrimSuffix(relPath, CompressedSuffix)
+		}
+		out, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err := os.Readlink(filePath); err != nil {
+				return err
+			} else {
+				out.Write([]byte(link))
+			}
+		} else if err := addMetadataZipFile(filePath, compressed, out); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Copy a metadata file into a zip archive, decompressing it if needed.
+func addMetadataZipFile(filePath string, compressed bool, out io.Writer) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var src io.Reader = in
+	if compressed {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		src = zr
+	}
+	_, err = io.Copy(out, src)
+	return err
 }
 
 func (self *Metadata) clearReadCache() {
@@ -862,6 +1093,36 @@ func (self *Metadata) checkHeartbeat() {
 	}
 }
 
+// The start of the error message for a job which exceeded its timeout.
+const timeoutErrorPrefix = "Job exceeded the stage timeout"
+
+// Check whether the job has been running for longer than the timeout,
+// measured from the start time recorded in the job info.  If it has,
+// returns the error message to fail it with.
+func (self *Metadata) checkTimeout(timeout time.Duration) (string, bool) {
+	if state, _ := self.getState(); state != Running {
+		return "", false
+	}
+	var jobInfo JobInfo
+	if err := self.ReadInto(JobInfoFile, &jobInfo); err != nil ||
+		jobInfo.WallClockInfo == nil {
+		return "", false
+	}
+	start, err := time.ParseInLocation(util.TIMEFMT,
+		jobInfo.WallClockInfo.Start, time.Local)
+	if err != nil {
+		return "", false
+	}
+	if elapsed := time.Since(start); elapsed > timeout {
+		return fmt.Sprintf(
+			"%s: %s of %v.  The job started at %s and was still running "+
+				"after %v.",
+			util.Timestamp(), timeoutErrorPrefix, timeout,
+			jobInfo.WallClockInfo.Start, elapsed.Truncate(time.Second)), true
+	}
+	return "", false
+}
+
 func (self *Metadata) serializeState() *MetadataInfo {
 	self.mutex.Lock()
 	names := make([]string, 0, len(self.contents))
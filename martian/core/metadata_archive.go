@@ -0,0 +1,98 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Reading metadata out of _metadata.zip without extracting it.
+
+package core
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// The contents of a pipestance's _metadata.zip.  When a pipestance is
+// attached read-only, its metadata is read from here, since the archive
+// cannot be extracted into the pipestance directory.
+type metadataArchive struct {
+	// The content of each regular file, keyed by absolute path.
+	files map[string][]byte
+
+	// The target of each symlink, keyed by absolute path.
+	links map[string]string
+
+	// The names of the entries in each directory.
+	dirs map[string][]string
+}
+
+// Read the archive into memory.
+func readMetadataArchive(zipPath string) (*metadataArchive, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	root := path.Dir(zipPath)
+	self := &metadataArchive{
+		files: make(map[string][]byte, len(zr.File)),
+		links: make(map[string]string),
+		dirs:  make(map[string][]string),
+	}
+	for _, f := range zr.File {
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		p := path.Join(root, f.Name)
+		if f.Mode()&os.ModeSymlink != 0 {
+			self.links[p] = string(content)
+		} else {
+			self.files[p] = content
+		}
+		dir := path.Dir(p)
+		self.dirs[dir] = append(self.dirs[dir], path.Base(p))
+	}
+	return self, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	in, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return ioutil.ReadAll(in)
+}
+
+// Get the content of the file at the given path, if it is in the archive.
+func (self *metadataArchive) readFile(p string) ([]byte, bool) {
+	if self == nil {
+		return nil, false
+	}
+	content, ok := self.files[p]
+	return content, ok
+}
+
+// Get the target of the symlink at the given path, if it is in the archive.
+func (self *metadataArchive) readlink(p string) (string, bool) {
+	if self == nil {
+		return "", false
+	}
+	target, ok := self.links[p]
+	return target, ok
+}
+
+// Get the paths of the entries in the given directory whose names match
+// the pattern, as for filepath.Glob.
+func (self *metadataArchive) glob(dir, pattern string) []string {
+	if self == nil {
+		return nil
+	}
+	var paths []string
+	for _, name := range self.dirs[dir] {
+		if ok, _ := path.Match(pattern, name); ok {
+			paths = append(paths, path.Join(dir, name))
+		}
+	}
+	return paths
+}
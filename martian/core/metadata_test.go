@@ -0,0 +1,120 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestCheckTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCheckTimeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := NewMetadata("ID.test.STAGE.fork0.chnk0", dir)
+	start := time.Now().Add(-2 * time.Hour)
+	if err := m.Write(JobInfoFile, &JobInfo{
+		WallClockInfo: &WallClockInfo{
+			Start: start.Format(util.TIMEFMT),
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Jobs which are not running are not timed out.
+	if _, ok := m.checkTimeout(time.Hour); ok {
+		t.Error("Expected no timeout for a queued job.")
+	}
+	if err := m.WriteTime(LogFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.checkTimeout(3 * time.Hour); ok {
+		t.Error("Expected no timeout before the limit.")
+	}
+	if msg, ok := m.checkTimeout(time.Hour); !ok {
+		t.Error("Expected a timeout.")
+	} else if !strings.Contains(msg, timeoutErrorPrefix+" of 1h0m0s") {
+		t.Errorf("Incorrect timeout message %q", msg)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mdir := path.Join(dir, "fork0")
+	if err := os.Mkdir(mdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetadata("ID.test.STAGE.fork0", mdir)
+	outs := `{"value": "` + strings.Repeat("x", 2*minCompressSize) + `"}`
+	if err := m.WriteRaw(OutsFile, outs); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteTime(CompleteFile); err != nil {
+		t.Fatal(err)
+	}
+	m.compress()
+	if _, err := os.Stat(m.MetadataFilePath(OutsFile) + CompressedSuffix); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(m.MetadataFilePath(OutsFile)); !os.IsNotExist(err) {
+		t.Error("Expected the uncompressed outs to be removed.")
+	}
+	if _, err := os.Stat(m.MetadataFilePath(CompleteFile)); err != nil {
+		t.Error("Expected small files to be left uncompressed.")
+	}
+
+	// Compressed files are read transparently.
+	m.loadCache()
+	if !m.exists(OutsFile) {
+		t.Error("Expected compressed outs to exist.")
+	}
+	if s := m.readRaw(OutsFile); s != outs {
+		t.Errorf("Incorrect outs %q", s)
+	}
+	if v, err := m.read(OutsFile, 0); err != nil {
+		t.Error(err)
+	} else if _, ok := v["value"]; !ok {
+		t.Errorf("Incorrect outs %v", v)
+	}
+
+	// The zip contains the decompressed file.
+	zipPath := path.Join(dir, MetadataZip.FileName())
+	if err := createMetadataZip(zipPath, m.glob()); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := util.ReadZip(zipPath, "fork0/_outs"); err != nil {
+		t.Error(err)
+	} else if s != outs {
+		t.Errorf("Incorrect zipped outs %q", s)
+	}
+
+	// Other zips keep the compressed file as it is.
+	otherZip := path.Join(dir, "other.zip")
+	if err := util.CreateZip(otherZip, m.glob()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := util.ReadZip(otherZip, "fork0/_outs"); err == nil {
+		t.Error("Expected only the compressed outs in the zip.")
+	}
+	if _, err := util.ReadZip(otherZip, "fork0/_outs"+CompressedSuffix); err != nil {
+		t.Error(err)
+	}
+
+	if err := m.remove(OutsFile); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(m.MetadataFilePath(OutsFile) + CompressedSuffix); !os.IsNotExist(err) {
+		t.Error("Expected the compressed outs to be removed.")
+	}
+}
@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Versioning of the on-disk layout of pipestance metadata.
+
+package core
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The version of the layout of the metadata in a pipestance directory.
+//
+// This should be incremented whenever the layout changes in a way which
+// would prevent an older version of Martian from reattaching to a
+// pipestance, with a migration from the previous version added to
+// metadataMigrations if possible.
+//
+// Pipestances which were created before the version was recorded have
+// version 1.
+const MetadataVersion = 1
+
+// A function which upgrades the metadata in a pipestance directory by one
+// version.
+type metadataMigration func(pipestancePath string) error
+
+// Migrations, keyed by the version which they upgrade from.
+var metadataMigrations = map[int]metadataMigration{}
+
+// Check that the pipestance's metadata version is supported, and upgrade it
+// if it is older than MetadataVersion.  Pipestances are only upgraded if
+// readOnly is false.
+func (self *Pipestance) VerifyMetadataVersion(readOnly bool) error {
+	self.metadata.loadCache()
+	return verifyMetadataVersion(self.metadata, self.GetPsid(), self.GetPath(),
+		MetadataVersion, readOnly)
+}
+
+// Get the metadata version recorded in the pipestance metadata.
+func readMetadataVersion(metadata *Metadata) (int, error) {
+	if !metadata.exists(MetadataVer) {
+		return 1, nil
+	}
+	data, err := metadata.readRawSafe(MetadataVer)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(data))
+}
+
+func verifyMetadataVersion(metadata *Metadata, psid, pipestancePath string,
+	supported int, readOnly bool) error {
+	version, err := readMetadataVersion(metadata)
+	if err != nil {
+		return err
+	}
+	if version == supported {
+		return nil
+	}
+	versionErr := &PipestanceVersionError{
+		Psid:      psid,
+		Version:   version,
+		Supported: supported,
+	}
+	if version > supported || readOnly {
+		return versionErr
+	}
+	for ; version < supported; version++ {
+		migrate := metadataMigrations[version]
+		if migrate == nil {
+			versionErr.Version = version
+			return versionErr
+		}
+		util.PrintInfo("runtime",
+			"Upgrading pipestance metadata from version %d to %d.",
+			version, version+1)
+		if err := migrate(pipestancePath); err != nil {
+			return err
+		}
+		if err := metadata.WriteRaw(MetadataVer,
+			strconv.Itoa(version+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
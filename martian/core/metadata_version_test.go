@@ -0,0 +1,67 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestVerifyMetadataVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestVerifyMetadataVersion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := NewMetadata("ID.test", dir)
+
+	// Pipestances without a version have version 1.
+	if err := verifyMetadataVersion(m, "test", dir, 1, false); err != nil {
+		t.Error(err)
+	}
+	if err := m.WriteRaw(MetadataVer, strconv.Itoa(MetadataVersion)); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyMetadataVersion(m, "test", dir, MetadataVersion, false); err != nil {
+		t.Error(err)
+	}
+
+	// Newer versions can't be read.
+	if err := verifyMetadataVersion(m, "test", dir, MetadataVersion-1, false); err == nil {
+		t.Error("Expected an error for a newer version.")
+	} else if verr, ok := err.(*PipestanceVersionError); !ok {
+		t.Errorf("Expected a PipestanceVersionError, got %v", err)
+	} else if verr.Version != MetadataVersion {
+		t.Errorf("Incorrect version %d", verr.Version)
+	}
+
+	// Older versions are migrated, unless they are read only.
+	v := MetadataVersion
+	var migrated []string
+	metadataMigrations[v] = func(p string) error {
+		migrated = append(migrated, p)
+		return nil
+	}
+	defer delete(metadataMigrations, v)
+	if err := verifyMetadataVersion(m, "test", dir, v+1, true); err == nil {
+		t.Error("Expected an error for a read only pipestance.")
+	}
+	if len(migrated) != 0 {
+		t.Error("Expected no migration for a read only pipestance.")
+	}
+	if err := verifyMetadataVersion(m, "test", dir, v+2, false); err == nil {
+		t.Error("Expected an error for a missing migration.")
+	} else if verr, ok := err.(*PipestanceVersionError); !ok || verr.Version != v+1 {
+		t.Errorf("Expected an error at version %d, got %v", v+1, err)
+	}
+	if len(migrated) != 1 || migrated[0] != dir {
+		t.Errorf("Expected one migration of %s, got %v", dir, migrated)
+	}
+	if got, err := readMetadataVersion(m); err != nil {
+		t.Error(err)
+	} else if got != v+1 {
+		t.Errorf("Expected version %d after migration, got %d", v+1, got)
+	}
+}
@@ -0,0 +1,191 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Runtime metrics, in the Prometheus text exposition format.
+
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	metricNodes           = "martian_nodes"
+	metricJobsSubmitted   = "martian_jobs_submitted_total"
+	metricMemoryReserved  = "martian_local_memory_reserved_bytes"
+	metricThreadsReserved = "martian_local_threads_reserved"
+)
+
+// Labels which distinguish the values of a metric.
+type metricLabels struct {
+	Psid    string
+	JobMode string
+
+	// Only used for the node count metric.
+	State MetadataState
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func (labels *metricLabels) String() string {
+	s := fmt.Sprintf(`{jobmode="%s",psid="%s"`,
+		escapeLabel(labels.JobMode), escapeLabel(labels.Psid))
+	if labels.State != "" {
+		s += fmt.Sprintf(`,state="%s"`, escapeLabel(string(labels.State)))
+	}
+	return s + "}"
+}
+
+type metric struct {
+	help   string
+	kind   string
+	values map[string]float64
+}
+
+// MetricsRegistry collects metrics from the runtime, such as the number of
+// nodes in each state and the number of jobs submitted.  It is an
+// http.Handler which serves the metrics in the Prometheus text format.
+type MetricsRegistry struct {
+	lock    sync.Mutex
+	metrics map[string]*metric
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	newMetric := func(kind, help string) *metric {
+		return &metric{
+			help:   help,
+			kind:   kind,
+			values: make(map[string]float64),
+		}
+	}
+	return &MetricsRegistry{
+		metrics: map[string]*metric{
+			metricNodes: newMetric("gauge",
+				"Number of stages which are running, queued, or failed."),
+			metricJobsSubmitted: newMetric("counter",
+				"Number of jobs submitted."),
+			metricMemoryReserved: newMetric("gauge",
+				"Memory reserved by local jobs."),
+			metricThreadsReserved: newMetric("gauge",
+				"Threads reserved by local jobs."),
+		},
+	}
+}
+
+func (self *MetricsRegistry) set(name string, labels metricLabels, v float64) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	self.metrics[name].values[labels.String()] = v
+	self.lock.Unlock()
+}
+
+func (self *MetricsRegistry) add(name string, labels metricLabels, v float64) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	self.metrics[name].values[labels.String()] += v
+	self.lock.Unlock()
+}
+
+// Write the metrics in the Prometheus text exposition format.
+func (self *MetricsRegistry) Write(w io.Writer) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	names := make([]string, 0, len(self.metrics))
+	for name := range self.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := bufio.NewWriter(w)
+	for _, name := range names {
+		m := self.metrics[name]
+		if len(m.values) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n",
+			name, m.help, name, m.kind)
+		labels := make([]string, 0, len(m.values))
+		for l := range m.values {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			fmt.Fprintf(buf, "%s%s %s\n", name, l,
+				strconv.FormatFloat(m.values[l], 'g', -1, 64))
+		}
+	}
+	return buf.Flush()
+}
+
+func (self *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	self.Write(w)
+}
+
+// Update the node and local resource metrics for the pipestance.
+func (self *Pipestance) updateMetrics() {
+	rt := self.node.rt
+	if rt.Metrics == nil {
+		return
+	}
+	labels := metricLabels{
+		Psid:    self.GetPsid(),
+		JobMode: rt.Config.JobMode,
+	}
+	counts := map[MetadataState]int{
+		Running: 0,
+		Queued:  0,
+		Failed:  0,
+	}
+	for _, node := range self.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		switch node.state {
+		case Failed:
+			counts[Failed]++
+		case Running:
+			// A stage is running if any of its jobs are running, and
+			// otherwise is queued.
+			if node.hasRunningJob() {
+				counts[Running]++
+			} else {
+				counts[Queued]++
+			}
+		}
+	}
+	for state, count := range counts {
+		l := labels
+		l.State = state
+		rt.Metrics.set(metricNodes, l, float64(count))
+	}
+	if jm := rt.LocalJobManager; jm != nil {
+		rt.Metrics.set(metricMemoryReserved, labels,
+			float64(jm.memMBSem.Reserved())*1024*1024)
+		rt.Metrics.set(metricThreadsReserved, labels,
+			float64(jm.coreSem.Reserved()))
+	}
+}
+
+// Returns true if any of the node's jobs are running.
+func (self *Node) hasRunningJob() bool {
+	for _, m := range self.collectMetadatas() {
+		if st, _ := m.getState(); st == Running {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	m := NewMetricsRegistry()
+	labels := metricLabels{Psid: "test", JobMode: "local"}
+	m.add(metricJobsSubmitted, labels, 1)
+	m.add(metricJobsSubmitted, labels, 1)
+	labels.State = Failed
+	m.set(metricNodes, labels, 2)
+	labels.Psid = `a"b`
+	m.set(metricNodes, labels, 0)
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const expect = `# HELP martian_jobs_submitted_total Number of jobs submitted.
+# TYPE martian_jobs_submitted_total counter
+martian_jobs_submitted_total{jobmode="local",psid="test"} 2
+# HELP martian_nodes Number of stages which are running, queued, or failed.
+# TYPE martian_nodes gauge
+martian_nodes{jobmode="local",psid="a\"b",state="failed"} 0
+martian_nodes{jobmode="local",psid="test",state="failed"} 2
+`
+	if s := buf.String(); s != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, s)
+	}
+}
+
+func TestCollectNodeMetrics(t *testing.T) {
+	stage := progressTestNode("ID.test.PIPE.STAGE", "")
+	stage.metadata = NewMetadata(stage.fqname, "")
+	stage.state = Queued
+	stage.attempts = []RetryAttempt{{}}
+	fork := stage.forks[0]
+	fork.split_metadata.contents[LogFile] = true
+	fork.split_metadata.contents[CompleteFile] = true
+	fork.join_metadata.contents[LogFile] = true
+	pipeline := &Node{kind: "pipeline", fqname: "ID.test.PIPE"}
+	ps := &Pipestance{allNodesCache: []*Node{pipeline, stage}}
+	expect := []nodeMetrics{
+		{fqname: "ID.test.PIPE", state: ForkWaiting},
+		{
+			fqname:      "ID.test.PIPE.STAGE",
+			state:       Running,
+			stage:       true,
+			starts:      2,
+			completions: 1,
+			retries:     1,
+		},
+	}
+	if m := collectNodeMetrics(ps); !reflect.DeepEqual(m, expect) {
+		t.Errorf("Expected %v, got %v", expect, m)
+	}
+}
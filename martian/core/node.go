@@ -69,16 +69,25 @@ type Node struct {
 	directPrenodes     []Nodable
 	postnodes          map[string]Nodable
 	frontierNodes      *threadSafeNodeMap
+	paused             *pauseFlag
+	subscribers        *nodeSubscribers
+	attempts           []RetryAttempt
+	preemptions        int
+	retryAt            time.Time
+	waitingForDisk     bool
+	waitingForSlot     bool
 	forks              []*Fork
 	state              MetadataState
 	volatile           bool
 	strictVolatile     bool
+	priority           int
 	local              bool
 	preflight          bool
 	disabled           []*Binding
 	modBindingList     []*Binding
 	stagecodeLang      syntax.StageCodeType
 	stagecodeCmd       string
+	stagecodeImage     string
 	journalPath        string
 	tmpPath            string
 	mroPaths           []string
@@ -86,6 +95,10 @@ type Node struct {
 	envs               map[string]string
 	invocation         *InvocationData
 	blacklistedFromMRT bool // Don't used cached data when MRT'ing
+	dryRun             bool // Plan stages without running them
+
+	// Zipped metadata which is read in place, for read-only pipestances.
+	metadataArchive *metadataArchive
 }
 
 // Represents an edge in the pipeline graph.
@@ -115,6 +128,18 @@ type NodeInfo struct {
 	StagecodeLang syntax.StageCodeType `json:"stagecodeLang"`
 	StagecodeCmd  string               `json:"stagecodeCmd"`
 	Error         *NodeErrorInfo       `json:"error,omitempty"`
+	Attempt       int                  `json:"attempt"`
+	Preemptions   int                  `json:"preemptions,omitempty"`
+
+	// The tags of the pipestance, for the top-level pipeline only.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// A record of an automatic retry of a stage which failed with a transient
+// error.
+type RetryAttempt struct {
+	Time  string `json:"time"`
+	Error string `json:"error,omitempty"`
 }
 
 func (self *Node) getNode() *Node { return self }
@@ -142,6 +167,7 @@ func NewNode(parent Nodable, kind string, callStm *syntax.CallStm, callables *sy
 	self.fqname = parent.getNode().fqname + "." + self.name
 	self.path = path.Join(parent.getNode().path, self.name)
 	self.journalPath = parent.getNode().journalPath
+	self.metadataArchive = parent.getNode().metadataArchive
 	self.tmpPath = parent.getNode().tmpPath
 	self.mroPaths = parent.getNode().mroPaths
 	self.mroVersion = parent.getNode().mroVersion
@@ -164,12 +190,32 @@ func NewNode(parent Nodable, kind string, callStm *syntax.CallStm, callables *sy
 	self.directPrenodes = []Nodable{}
 	self.postnodes = map[string]Nodable{}
 	self.frontierNodes = parent.getNode().frontierNodes
+	self.paused = parent.getNode().paused
+	self.subscribers = parent.getNode().subscribers
 
 	for id, bindStm := range callStm.Bindings.Table {
 		binding := NewBinding(self, bindStm)
 		self.argbindings[id] = binding
 		self.argbindingList = append(self.argbindingList, binding)
 	}
+	if self.callable != nil && self.callable.GetInParams() != nil {
+		// Bind default values for any optional parameters which the call
+		// did not supply.  The compiler normally adds these bindings to the
+		// call, but the call statement may not have been compiled.
+		for _, param := range self.callable.GetInParams().List {
+			if _, ok := self.argbindings[param.Id]; ok || param.Default == nil {
+				continue
+			}
+			binding := NewBinding(self, &syntax.BindStm{
+				Node:  callStm.Node,
+				Id:    param.Id,
+				Exp:   param.Default,
+				Tname: param.Tname,
+			})
+			self.argbindings[param.Id] = binding
+			self.argbindingList = append(self.argbindingList, binding)
+		}
+	}
 	self.disabled = parent.getNode().disabled
 	if callStm.Modifiers.Bindings != nil {
 		if disabled := callStm.Modifiers.Bindings.Table["disabled"]; disabled != nil {
@@ -393,7 +439,7 @@ func cartesianProduct(valueSets []interface{}) []interface{} {
 	return perms
 }
 
-func (self *Node) buildForks(bindings []*Binding) {
+func (self *Node) buildForks(bindings []*Binding) error {
 	self.buildUniqueSweepBindings(append(bindings, self.modBindingList...))
 
 	// Expand out sweep values for each binding.
@@ -407,6 +453,9 @@ func (self *Node) buildForks(bindings []*Binding) {
 		v, _ := binding.resolve(nil, 0)
 		argRanges = append(argRanges, v)
 	}
+	if err := self.checkForkCount(argRanges); err != nil {
+		return err
+	}
 
 	// Build out argument permutations.
 	for i, valPermute := range cartesianProduct(argRanges) {
@@ -426,6 +475,43 @@ func (self *Node) buildForks(bindings []*Binding) {
 			}
 		}
 	}
+	return nil
+}
+
+// Check that the cross-product of the given sweep values, one for each of
+// the node's sweep bindings, would not have more forks than the limit, before
+// building it.
+func (self *Node) checkForkCount(argRanges []interface{}) error {
+	max := self.rt.Config.MaxForks
+	if max == 0 {
+		max = DefaultMaxForks
+	} else if max < 0 {
+		return nil
+	}
+	count := 1
+	for _, v := range argRanges {
+		if values, ok := v.([]interface{}); ok {
+			count *= len(values)
+		}
+		if count > max {
+			break
+		}
+	}
+	if count <= max {
+		return nil
+	}
+	sweeps := make([]string, 0, len(argRanges))
+	for i, binding := range self.sweepbindings {
+		n := 0
+		if values, ok := argRanges[i].([]interface{}); ok {
+			n = len(values)
+		}
+		sweeps = append(sweeps, fmt.Sprintf("%s.%s (%d value%s)",
+			binding.node.fqname, binding.sweepRootId, n, util.Pluralize(n)))
+	}
+	return &RuntimeError{fmt.Sprintf(
+		"%s would have more than %d forks, from the sweeps over %s",
+		self.fqname, max, strings.Join(sweeps, " x "))}
 }
 
 func (self *Node) matchFork(targetArgPermute map[string]interface{}) *Fork {
@@ -541,6 +627,13 @@ func (self *Node) collectMetadatas() []*Metadata {
 	return metadatas
 }
 
+// Compress the metadata files for the node once it is complete.
+func (self *Node) compressMetadata() {
+	for _, metadata := range self.collectMetadatas() {
+		metadata.compress()
+	}
+}
+
 func (self *Node) loadMetadata() {
 	metadatas := self.collectMetadatas()
 	for _, metadata := range metadatas {
@@ -550,6 +643,20 @@ func (self *Node) loadMetadata() {
 		// Reset metadata heartbeat timer
 		metadata.resetHeartbeat()
 	}
+	self.attempts = nil
+	if self.metadata.exists(AttemptsFile) {
+		if err := self.metadata.ReadInto(AttemptsFile, &self.attempts); err != nil {
+			util.LogError(err, "runtime",
+				"Error reading retry attempts for %s", self.fqname)
+		}
+	}
+	self.preemptions = 0
+	if self.metadata.exists(Preemptions) {
+		if err := self.metadata.ReadInto(Preemptions, &self.preemptions); err != nil {
+			util.LogError(err, "runtime",
+				"Error reading preemptions for %s", self.fqname)
+		}
+	}
 	self.state = self.getState()
 	self.addFrontierNode(self)
 }
@@ -602,37 +709,46 @@ func (self *Node) getState() MetadataState {
 
 func (self *Node) reset() error {
 	if self.rt.Config.FullStageReset {
-		util.PrintInfo("runtime", "(reset)           %s", self.fqname)
-
-		// Blow away the entire stage node.
-		if err := os.RemoveAll(self.path); err != nil {
-			util.PrintInfo("runtime", "Cannot reset the stage because its folder contents could not be deleted.\n\nPlease resolve this error in order to continue running the pipeline:")
+		return self.resetFull()
+	}
+	for _, fork := range self.forks {
+		if err := fork.resetPartial(); err != nil {
 			return err
 		}
-		// Remove all related files from journal directory.
-		if files, err := filepath.Glob(path.Join(self.journalPath, self.fqname+"*")); err == nil {
-			for _, file := range files {
-				os.Remove(file)
-			}
-		}
+	}
 
-		// Clear chunks in the forks so they can be rebuilt on split.
-		for _, fork := range self.forks {
-			fork.reset()
-		}
+	// Refresh the metadata.
+	self.loadMetadata()
+	return nil
+}
 
-		// Create stage node directories.
-		if err := self.mkdirs(); err != nil {
-			return err
-		}
-	} else {
-		for _, fork := range self.forks {
-			if err := fork.resetPartial(); err != nil {
-				return err
-			}
+// Reset the stage by removing all of its metadata, regardless of state.
+func (self *Node) resetFull() error {
+	util.PrintInfoAttrs("runtime", []interface{}{"fqname", self.fqname},
+		"(reset)           %s", self.fqname)
+
+	// Blow away the entire stage node.
+	if err := os.RemoveAll(self.path); err != nil {
+		util.PrintInfo("runtime", "Cannot reset the stage because its folder contents could not be deleted.\n\nPlease resolve this error in order to continue running the pipeline:")
+		return err
+	}
+	// Remove all related files from journal directory.
+	if files, err := filepath.Glob(path.Join(self.journalPath, self.fqname+"*")); err == nil {
+		for _, file := range files {
+			os.Remove(file)
 		}
 	}
 
+	// Clear chunks in the forks so they can be rebuilt on split.
+	for _, fork := range self.forks {
+		fork.reset()
+	}
+
+	// Create stage node directories.
+	if err := self.mkdirs(); err != nil {
+		return err
+	}
+
 	// Refresh the metadata.
 	self.loadMetadata()
 	return nil
@@ -665,11 +781,29 @@ func (self *Node) restartLocalJobs() error {
 }
 
 func (self *Node) checkHeartbeats() {
+	var timeout time.Duration
+	if self.resources != nil {
+		timeout = self.resources.Timeout
+	}
 	for _, metadata := range self.collectMetadatas() {
 		metadata.checkHeartbeat()
+		if timeout > 0 {
+			if message, ok := metadata.checkTimeout(timeout); ok {
+				self.killTimedOut(metadata, message)
+			}
+		}
 	}
 }
 
+// Kill a job which exceeded its timeout.  Its resources are released
+// before it is marked failed, so they are available if it is retried.
+func (self *Node) killTimedOut(metadata *Metadata, message string) {
+	util.PrintInfo("runtime", "(timeout)         %s", metadata.fqname)
+	self.rt.JobManager.killJob(metadata)
+	self.rt.jobBudget.release(metadata.fqname)
+	metadata.WriteRaw(Errors, message)
+}
+
 func (self *Node) kill(message string) {
 	for _, fork := range self.forks {
 		fork.kill(message)
@@ -698,6 +832,17 @@ func (self *Node) GetFQName() string {
 	return self.fqname
 }
 
+// State returns the state of the node as of the last time the pipestance
+// was stepped.
+func (self *Node) State() MetadataState {
+	return self.state
+}
+
+// Metadata returns the top-level metadata for the node.
+func (self *Node) Metadata() *Metadata {
+	return self.metadata
+}
+
 func (self *Node) getFatalError() (string, bool, string, string, MetadataFileName, []string) {
 	for _, metadata := range self.collectMetadatas() {
 		if state, _ := metadata.getState(); state != Failed {
@@ -740,13 +885,19 @@ func (self *Node) getFatalError() (string, bool, string, string, MetadataFileNam
 }
 
 // Returns true if there is no error or if the error is one we expect to not
-// recur if the pipeline is rerun.
+// recur if the pipeline is rerun.  Jobs which were preempted, as recorded
+// in the _preempted file by the adapter or the cluster integration, are
+// always transient failures.
 func (self *Node) isErrorTransient() (bool, string) {
 	passRegexp, _ := getRetryRegexps()
 	for _, metadata := range self.collectMetadatas() {
 		if state, _ := metadata.getState(); state != Failed {
 			continue
 		}
+		if metadata.exists(Preempted) {
+			errlog, _ := metadata.readRawSafe(Errors)
+			return true, errlog
+		}
 		if metadata.exists(Assert) {
 			return false, ""
 		}
@@ -765,8 +916,109 @@ func (self *Node) isErrorTransient() (bool, string) {
 	return true, ""
 }
 
+// Get the maximum number of automatic retries for the node, which is set by
+// the stage declaration if present and otherwise by the runtime's retry
+// policy.
+func (self *Node) maxAttempts() int {
+	if self.resources != nil && self.resources.Retries >= 0 {
+		return self.resources.Retries
+	}
+	return self.rt.Config.Retry.MaxAttempts
+}
+
+// Returns true if a job for the node failed because it was preempted.
+func (self *Node) wasPreempted() bool {
+	for _, metadata := range self.collectMetadatas() {
+		if state, _ := metadata.getState(); state == Failed &&
+			metadata.exists(Preempted) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the node failed with a transient error and has been
+// retried fewer times than its retry limit allows, or if it was preempted
+// and has been re-queued fewer times than the preemption limit allows.
+func (self *Node) canRetry() bool {
+	if self.state != Failed || self.kind != "stage" {
+		return false
+	}
+	if self.wasPreempted() {
+		max := self.rt.Config.Retry.maxPreemptions()
+		return max < 0 || self.preemptions < max
+	}
+	if len(self.attempts) >= self.maxAttempts() {
+		return false
+	}
+	transient, _ := self.isErrorTransient()
+	return transient
+}
+
+// Reset the node if it can be retried and the backoff since it failed has
+// elapsed.  Returns true if the node was reset.
+func (self *Node) autoRetry() (bool, error) {
+	if !self.canRetry() {
+		self.retryAt = time.Time{}
+		return false, nil
+	}
+	if self.wasPreempted() {
+		return self.requeuePreempted()
+	}
+	if self.retryAt.IsZero() {
+		self.retryAt = time.Now().Add(
+			self.rt.Config.Retry.delay(len(self.attempts)))
+	}
+	if time.Now().Before(self.retryAt) {
+		return false, nil
+	}
+	_, errlog := self.isErrorTransient()
+	attempts := append(self.attempts, RetryAttempt{
+		Time:  util.Timestamp(),
+		Error: errlog,
+	})
+	util.PrintInfoAttrs("runtime",
+		[]interface{}{"fqname", self.fqname, "attempt", len(attempts)},
+		"(retry)           %s: attempt %d of %d",
+		self.fqname, len(attempts), self.maxAttempts())
+	if err := self.reset(); err != nil {
+		return false, err
+	}
+	// Write the attempts after the reset, since a full stage reset removes
+	// the node's directory.
+	self.retryAt = time.Time{}
+	self.attempts = attempts
+	return true, self.metadata.Write(AttemptsFile, attempts)
+}
+
+// Reset a node whose job was preempted, without waiting and without
+// counting it as a retry attempt.
+func (self *Node) requeuePreempted() (bool, error) {
+	preemptions := self.preemptions + 1
+	util.PrintInfoAttrs("runtime",
+		[]interface{}{"fqname", self.fqname, "preemptions", preemptions},
+		"(preempted)       %s: re-queueing, preemption %d",
+		self.fqname, preemptions)
+	if err := self.reset(); err != nil {
+		return false, err
+	}
+	self.retryAt = time.Time{}
+	self.preemptions = preemptions
+	return true, self.metadata.Write(Preemptions, preemptions)
+}
+
 func (self *Node) step() bool {
-	if self.state == Running {
+	span := self.rt.tracer.start(self.fqname)
+	defer func() {
+		span.end(map[string]string{
+			"martian.kind":  self.kind,
+			"martian.state": string(self.state),
+		})
+	}()
+	// While the pipestance is paused, keep track of the node's state, but
+	// don't step the forks, so that no new jobs are started.  Likewise if
+	// the stage cannot be started yet.
+	if self.state == Running && !self.paused.get() && self.reserveStart() {
 		for _, fork := range self.forks {
 			if self.preflight && self.rt.Config.SkipPreflight {
 				fork.skip()
@@ -777,6 +1029,25 @@ func (self *Node) step() bool {
 	}
 	previousState := self.state
 	self.state = self.getState()
+	if self.state != Running && self.kind == "stage" {
+		self.rt.stageLimiter.release(self.fqname)
+		self.rt.jobBudget.releaseNode(self.fqname)
+		if self.resources != nil && self.resources.DiskGB > 0 {
+			self.rt.diskReservations.release(self.fqname)
+		}
+	}
+	if self.state != previousState {
+		self.rt.stateLog.log(self.fqname, previousState, self.state)
+		self.subscribers.publish(NodeEvent{
+			Fqname:    self.fqname,
+			OldState:  previousState,
+			NewState:  self.state,
+			Timestamp: time.Now(),
+		})
+		if self.state == Complete || self.state == Failed {
+			self.notifyFinish()
+		}
+	}
 	switch self.state {
 	case Failed:
 		self.addFrontierNode(self)
@@ -786,7 +1057,8 @@ func (self *Node) step() bool {
 		}
 		self.addFrontierNode(self)
 	case Complete:
-		if self.rt.Config.VdrMode == "rolling" {
+		if self.rt.Config.VdrMode == "rolling" ||
+			self.rt.Config.VdrMode == "aggressive" {
 			for _, node := range self.prenodes {
 				node.getNode().vdrKill()
 				node.getNode().cachePerf()
@@ -794,6 +1066,9 @@ func (self *Node) step() bool {
 			self.vdrKill()
 			self.cachePerf()
 		}
+		if self.rt.Config.CompressMetadata && self.state != previousState {
+			self.compressMetadata()
+		}
 		fallthrough
 	case DisabledState:
 		for _, node := range self.postnodes {
@@ -806,6 +1081,82 @@ func (self *Node) step() bool {
 	return self.state != previousState
 }
 
+// Returns true unless one of the node's forks has yet to start.
+func (self *Node) hasStarted() bool {
+	for _, fork := range self.forks {
+		if fork.getState() == Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// Reserve one of the runtime's stage slots, if they are limited, and the
+// disk space declared by the stage, before starting it.  Returns false if
+// the stage cannot be started yet.  Stages which have already started
+// always get their reservations, so that they continue to be counted after
+// mrp restarts.
+func (self *Node) reserveStart() bool {
+	if self.kind != "stage" {
+		return true
+	}
+	started := self.hasStarted()
+	if !self.rt.stageLimiter.acquire(self.fqname, started) {
+		if !self.waitingForSlot {
+			self.waitingForSlot = true
+			util.PrintInfoAttrs("runtime",
+				[]interface{}{"fqname", self.fqname},
+				"(waiting)         %s: waiting for other stages to finish",
+				self.fqname)
+		}
+		return false
+	}
+	self.waitingForSlot = false
+	if !self.reserveDisk(started) {
+		self.rt.stageLimiter.release(self.fqname)
+		return false
+	}
+	return true
+}
+
+// Reserve the disk space declared by the stage, if any.  Returns false if
+// there is not yet enough free space, unless the stage has already started.
+func (self *Node) reserveDisk(started bool) bool {
+	if self.resources == nil || self.resources.DiskGB <= 0 {
+		return true
+	}
+	if self.rt.diskReservations.reserve(self.fqname,
+		self.resources.DiskGB, started) {
+		self.waitingForDisk = false
+		return true
+	}
+	if !self.waitingForDisk {
+		self.waitingForDisk = true
+		util.PrintInfoAttrs("runtime",
+			[]interface{}{"fqname", self.fqname, "disk_gb", self.resources.DiskGB},
+			"(waiting)         %s: waiting for %dGB of free disk space",
+			self.fqname, self.resources.DiskGB)
+	}
+	return false
+}
+
+// Notify the runtime's stage finish webhook that the node completed or
+// failed.
+func (self *Node) notifyFinish() {
+	if self.rt.Config.StageFinishWebhook == "" {
+		return
+	}
+	event := &StageFinishEvent{
+		Fqname:    self.fqname,
+		State:     self.state,
+		Timestamp: util.Timestamp(),
+	}
+	if self.state == Failed {
+		_, _, event.Error, _, _, _ = self.getFatalError()
+	}
+	self.rt.notifyStageFinish(event)
+}
+
 // Regular expression to convert a fully qualified name for a chunk into the
 // component parts of the pipeline path.  The parts are:
 // 1. The fully qualified stage name.
@@ -911,6 +1262,8 @@ func (self *Node) serializeState() *NodeInfo {
 		StagecodeLang: self.stagecodeLang,
 		StagecodeCmd:  self.stagecodeCmd,
 		Error:         err,
+		Attempt:       len(self.attempts) + 1,
+		Preemptions:   self.preemptions,
 	}
 }
 
@@ -924,40 +1277,92 @@ func (self *Node) serializePerf() (*NodePerfInfo, []*VdrEvent) {
 			storageEvents = append(storageEvents, vdrKill.Events...)
 		}
 	}
+	var samples map[string][]JobSample
+	if self.kind == "stage" {
+		for _, metadata := range self.collectMetadatas() {
+			if s := metadata.samples.list(); len(s) > 0 {
+				if samples == nil {
+					samples = make(map[string][]JobSample)
+				}
+				samples[metadata.fqname] = s
+			}
+		}
+	}
 	return &NodePerfInfo{
-		Name:   self.name,
-		Fqname: self.fqname,
-		Type:   self.kind,
-		Forks:  forks,
+		Name:    self.name,
+		Fqname:  self.fqname,
+		Type:    self.kind,
+		Forks:   forks,
+		Samples: samples,
 	}, storageEvents
 }
 
+// Get the wall time from the start of the first job for this node to the
+// end of the last one, if the performance information is available.
+func (self *Node) wallTime() (time.Duration, bool) {
+	forks := make([]*ForkPerfInfo, 0, len(self.forks))
+	for _, fork := range self.forks {
+		if perf, _ := fork.serializePerf(); perf != nil {
+			forks = append(forks, perf)
+		}
+	}
+	return forksWallTime(forks)
+}
+
+// Get the time from the start of the first fork to the end of the last.
+func forksWallTime(forks []*ForkPerfInfo) (time.Duration, bool) {
+	var start, end time.Time
+	for _, perf := range forks {
+		if perf == nil || perf.ForkStats == nil ||
+			perf.ForkStats.Start.IsZero() || perf.ForkStats.End.IsZero() {
+			continue
+		}
+		if start.IsZero() || perf.ForkStats.Start.Before(start) {
+			start = perf.ForkStats.Start
+		}
+		if perf.ForkStats.End.After(end) {
+			end = perf.ForkStats.End
+		}
+	}
+	if start.IsZero() || end.Before(start) {
+		return 0, false
+	}
+	return end.Sub(start), true
+}
+
 //=============================================================================
 // Job Runners
 //=============================================================================
-func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int, string) {
-	threads := 0
-	memGB := 0
-	special := ""
 
+// Get the resources for a job of the given type.  The resources declared
+// by the stage are the defaults.  Those in jobDef, which for a chunk come
+// from the __threads, __mem_gb, __gpus and __special keys of its chunk def
+// as returned by the split, take precedence over them, so that each chunk
+// can be sized for its own input.  Overrides from the command line and the
+// resource override file take precedence over both, and the result is then
+// capped by the job manager.
+func (self *Node) getJobReqs(jobDef *JobResources, stageType string) JobResources {
+	var res JobResources
 	if self.resources != nil {
-		threads = self.resources.Threads
-		memGB = self.resources.MemGB
-		special = self.resources.Special
+		res = *self.resources
 	}
 
 	// Get values passed from the stage code
 	if jobDef != nil {
 		if jobDef.Threads != 0 {
-			threads = jobDef.Threads
+			res.Threads = jobDef.Threads
 		}
 		if jobDef.MemGB != 0 {
-			memGB = jobDef.MemGB
+			res.MemGB = jobDef.MemGB
+		}
+		if jobDef.GPUs != 0 {
+			res.GPUs = jobDef.GPUs
 		}
 		if jobDef.Special != "" {
-			special = jobDef.Special
+			res.Special = jobDef.Special
 		}
 	}
+	threads, memGB := res.Threads, res.MemGB
 
 	// Override with job manager caps specified from commandline
 	overrideThreads := self.rt.overrides.GetOverride(self,
@@ -982,69 +1387,76 @@ func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int,
 			self.fqname, stageType, overrideMem)
 	}
 
+	// Apply the resource override file, which takes precedence over
+	// everything else.
+	if override := self.rt.resOverrides.get(self.fqname); override != nil {
+		util.LogInfo("override", "At [%s:%s] replace resources with %v",
+			self.fqname, stageType, override.ToMap())
+		if override.Threads != 0 {
+			threads = override.Threads
+		}
+		if override.MemGB != 0 {
+			memGB = override.MemGB
+		}
+		if override.GPUs != 0 {
+			res.GPUs = override.GPUs
+		}
+		if override.Special != "" {
+			res.Special = override.Special
+		}
+	}
+
 	if self.local {
-		threads, memGB = self.rt.LocalJobManager.GetSystemReqs(threads, memGB)
+		res.Threads, res.MemGB = self.rt.LocalJobManager.GetSystemReqs(threads, memGB)
 	} else {
-		threads, memGB = self.rt.JobManager.GetSystemReqs(threads, memGB)
+		res.Threads, res.MemGB = self.rt.JobManager.GetSystemReqs(threads, memGB)
 	}
 
 	// Return modified values
-	return threads, memGB, special
+	return res
 }
 
-func (self *Node) setJobReqs(jobDef *JobResources, stageType string) (int, int, string) {
+func (self *Node) setJobReqs(jobDef *JobResources, stageType string) *JobResources {
 	// Get values and possibly modify them
-	threads, memGB, special := self.getJobReqs(jobDef, stageType)
+	res := self.getJobReqs(jobDef, stageType)
 
 	// Write modified values back
 	if jobDef != nil {
-		jobDef.Threads = threads
-		jobDef.MemGB = memGB
+		jobDef.Threads = res.Threads
+		jobDef.MemGB = res.MemGB
+		jobDef.GPUs = res.GPUs
 	}
 
-	return threads, memGB, special
+	return &res
 }
 
-func (self *Node) setSplitJobReqs() (int, int, string) {
+func (self *Node) setSplitJobReqs() *JobResources {
 	return self.setJobReqs(nil, STAGE_TYPE_SPLIT)
 }
 
-func (self *Node) setChunkJobReqs(jobDef *JobResources) (int, int, string) {
+func (self *Node) setChunkJobReqs(jobDef *JobResources) *JobResources {
 	return self.setJobReqs(jobDef, STAGE_TYPE_CHUNK)
 }
 
-func (self *Node) setJoinJobReqs(jobDef *JobResources) (int, int, string) {
+func (self *Node) setJoinJobReqs(jobDef *JobResources) *JobResources {
 	return self.setJobReqs(jobDef, STAGE_TYPE_JOIN)
 }
 
-func (self *Node) runSplit(fqname string, metadata *Metadata) {
-	threads, memGB, special := self.setSplitJobReqs()
-	self.runJob("split", fqname, metadata, threads, memGB, special)
+func (self *Node) runSplit(fqname string, metadata *Metadata, res *JobResources) {
+	self.runJob("split", fqname, metadata, res)
 }
 
-func (self *Node) runJoin(fqname string, metadata *Metadata, threads int, memGB int, special string) {
-	self.runJob("join", fqname, metadata, threads, memGB, special)
+func (self *Node) runJoin(fqname string, metadata *Metadata, res *JobResources) {
+	self.runJob("join", fqname, metadata, res)
 }
 
-func (self *Node) runChunk(fqname string, metadata *Metadata, threads int, memGB int, special string) {
-	self.runJob("main", fqname, metadata, threads, memGB, special)
+func (self *Node) runChunk(fqname string, metadata *Metadata, res *JobResources) {
+	self.runJob("main", fqname, metadata, res)
 }
 
-func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
-	threads int, memGB int, special string) {
-
-	// Configure local variable dumping.
-	stackVars := "disable"
-	if self.rt.Config.StackVars {
-		stackVars = "stackvars"
-	}
-
-	// Configure memory monitoring.
-	monitor := "disable"
-	if self.rt.Config.Monitor {
-		monitor = "monitor"
-	}
-
+// Get the command and environment to run a job for the node.
+func (self *Node) jobCommand(shellName string, fqname string,
+	metadata *Metadata, res *JobResources) (string, []string, map[string]string) {
 	// Construct path to the shell.
 	shellCmd := ""
 	var argv []string
@@ -1053,10 +1465,6 @@ func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
 	if metadata.uniquifier != "" {
 		runFile += ".u" + metadata.uniquifier
 	}
-	version := &VersionInfo{
-		Martian:   self.rt.Config.MartianVersion,
-		Pipelines: self.mroVersion,
-	}
 	envs := make(map[string]string, len(self.envs)+1)
 	for k, v := range self.envs {
 		envs[k] = v
@@ -1085,24 +1493,58 @@ func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
 	case syntax.ExecStage:
 		shellCmd = stagecodeParts[0]
 		argv = append(stagecodeParts[1:], shellName, metadata.path, metadata.curFilesPath, runFile)
+	case syntax.DockerStage, syntax.PodmanStage:
+		shellCmd, argv = self.containerCommand(stagecodeParts,
+			[]string{shellName, metadata.path, metadata.curFilesPath, runFile},
+			metadata, envs, res)
 	default:
 		panic(fmt.Sprintf("Unknown stage code language: %v", self.stagecodeLang))
 	}
+	return shellCmd, argv, envs
+}
 
-	// Log the job run.
-	jobMode := self.rt.Config.JobMode
-	jobManager := self.rt.JobManager
+// Get the job manager which runs jobs for the node, and its job mode.
+func (self *Node) jobManager() (JobManager, string) {
 	if self.local {
-		jobMode = "local"
-		jobManager = self.rt.LocalJobManager
+		return self.rt.LocalJobManager, "local"
+	}
+	return self.rt.JobManager, self.rt.Config.JobMode
+}
+
+// Log that a job is being run, and record its job info.
+func (self *Node) recordJob(shellName string, fqname string, metadata *Metadata,
+	res *JobResources, jobMode string) {
+	// Configure local variable dumping.
+	stackVars := "disable"
+	if self.rt.Config.StackVars {
+		stackVars = "stackvars"
+	}
+
+	// Configure memory monitoring.
+	monitor := "disable"
+	if self.rt.Config.Monitor {
+		monitor = "monitor"
 	}
+
+	version := &VersionInfo{
+		Martian:   self.rt.Config.MartianVersion,
+		Pipelines: self.mroVersion,
+	}
+
+	// Log the job run.
 	jobModeLabel := strings.Replace(jobMode, ".template", "", -1)
 	padding := strings.Repeat(" ", int(math.Max(0, float64(10-len(path.Base(jobModeLabel))))))
-	msg := fmt.Sprintf("(run:%s) %s %s.%s", path.Base(jobModeLabel), padding, fqname, shellName)
+	attrs := []interface{}{
+		"fqname", fqname,
+		"shell", shellName,
+		"jobmode", path.Base(jobModeLabel),
+	}
 	if self.preflight {
-		util.LogInfo("runtime", msg)
+		util.LogInfoAttrs("runtime", attrs, "(run:%s) %s %s.%s",
+			path.Base(jobModeLabel), padding, fqname, shellName)
 	} else {
-		util.PrintInfo("runtime", msg)
+		util.PrintInfoAttrs("runtime", attrs, "(run:%s) %s %s.%s",
+			path.Base(jobModeLabel), padding, fqname, shellName)
 	}
 
 	func() {
@@ -1112,8 +1554,9 @@ func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
 		metadata.Write(JobInfoFile, &JobInfo{
 			Name:        fqname,
 			Type:        jobMode,
-			Threads:     threads,
-			MemGB:       memGB,
+			Threads:     res.Threads,
+			MemGB:       res.MemGB,
+			GPUs:        res.GPUs,
 			ProfileMode: self.rt.Config.ProfileMode,
 			Stackvars:   stackVars,
 			Monitor:     monitor,
@@ -1121,6 +1564,36 @@ func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
 			Version:     version,
 		})
 	}()
-	jobManager.execJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname,
+	self.rt.Metrics.add(metricJobsSubmitted, metricLabels{
+		Psid:    psidFromFqname(fqname),
+		JobMode: jobMode,
+	}, 1)
+}
+
+func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
+	res *JobResources) {
+	shellCmd, argv, envs := self.jobCommand(shellName, fqname, metadata, res)
+	jobManager, jobMode := self.jobManager()
+	self.recordJob(shellName, fqname, metadata, res, jobMode)
+	jobManager.execJob(shellCmd, argv, envs, metadata, res, fqname,
 		shellName, self.preflight && self.local)
 }
+
+// Run the chunks, which must all have the given resource requirements, as
+// a single array job.  The job manager must support job arrays.
+func (self *Node) runChunkArray(fork *Fork, chunks []*Chunk, res *JobResources) {
+	jobManager, jobMode := self.jobManager()
+	jobs := make([]*arrayJob, len(chunks))
+	for i, chunk := range chunks {
+		shellCmd, argv, envs := self.jobCommand("main", chunk.fqname, chunk.metadata, res)
+		self.recordJob("main", chunk.fqname, chunk.metadata, res, jobMode)
+		jobs[i] = &arrayJob{
+			shellCmd: shellCmd,
+			argv:     argv,
+			envs:     envs,
+			metadata: chunk.metadata,
+		}
+	}
+	jobManager.(arrayJobManager).execJobArray(jobs, res, fork.metadata,
+		fork.fqname, "main")
+}
@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Per-node metrics for a pipestance, for the Prometheus collector.
+
+package core
+
+const (
+	metricNodeState        = "martian_node_state"
+	metricStageStarts      = "martian_stage_starts_total"
+	metricStageCompletions = "martian_stage_completions_total"
+	metricStageRetries     = "martian_stage_retries_total"
+)
+
+// The states reported by the node state metric.  Nodes which have not
+// started are reported as "waiting".
+var collectorStates = [...]MetadataState{Running, Complete, Failed, ForkWaiting}
+
+// Get the state reported for a node, which collapses the states a node may
+// be in to those in collectorStates.
+func collectorState(state MetadataState) MetadataState {
+	switch state {
+	case Running, Queued, Ready:
+		return Running
+	case Waiting, Paused:
+		return ForkWaiting
+	}
+	return state
+}
+
+// The metrics reported for a node.
+type nodeMetrics struct {
+	fqname string
+	state  MetadataState
+
+	// The job counts are only reported for stages.
+	stage       bool
+	starts      int
+	completions int
+	retries     int
+}
+
+// Compute the metrics for each node in the pipestance from its metadata.
+func collectNodeMetrics(ps *Pipestance) []nodeMetrics {
+	nodes := ps.allNodes()
+	result := make([]nodeMetrics, 0, len(nodes))
+	for _, node := range nodes {
+		m := nodeMetrics{
+			fqname: node.fqname,
+			state:  collectorState(node.state),
+			stage:  node.kind == "stage",
+		}
+		if m.stage {
+			for _, metadata := range node.collectMetadatas() {
+				// Jobs write a log once they start running.
+				if !metadata.exists(LogFile) {
+					continue
+				}
+				m.starts++
+				if metadata.exists(CompleteFile) {
+					m.completions++
+				}
+			}
+			m.retries = len(node.attempts)
+		}
+		result = append(result, m)
+	}
+	return result
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// Make a stage node with one fork, with metadata in the given directory.
+func retryTestNode(t *testing.T, dir string, policy RetryPolicy) *Node {
+	t.Helper()
+	node := &Node{
+		kind:          "stage",
+		fqname:        "ID.test.STAGE",
+		path:          dir,
+		journalPath:   path.Join(dir, "journal"),
+		tmpPath:       path.Join(dir, "tmp"),
+		metadata:      NewMetadata("ID.test.STAGE", dir),
+		frontierNodes: &threadSafeNodeMap{nodes: make(map[string]Nodable)},
+		rt: &Runtime{
+			Config: &RuntimeOptions{Retry: policy},
+		},
+	}
+	fork := &Fork{
+		node:           node,
+		metadata:       NewMetadata("ID.test.STAGE.fork0", path.Join(dir, "fork0")),
+		split_metadata: NewMetadata("ID.test.STAGE.fork0.split", path.Join(dir, "fork0", "split")),
+		join_metadata:  NewMetadata("ID.test.STAGE.fork0.join", path.Join(dir, "fork0", "join")),
+	}
+	node.forks = []*Fork{fork}
+	for _, m := range node.collectMetadatas() {
+		if err := m.mkdirs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	node.loadMetadata()
+	return node
+}
+
+func TestAutoRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestAutoRetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := retryTestNode(t, dir, RetryPolicy{MaxAttempts: 2})
+	fail := func(msg string) {
+		t.Helper()
+		if err := node.forks[0].join_metadata.WriteRaw(Errors, msg); err != nil {
+			t.Fatal(err)
+		}
+		node.state = node.getState()
+		if node.state != Failed {
+			t.Fatalf("Expected failed, got %v", node.state)
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		fail("signal: killed")
+		if retried, err := node.autoRetry(); err != nil {
+			t.Fatal(err)
+		} else if !retried {
+			t.Fatalf("Expected retry %d", i)
+		}
+		if node.state == Failed {
+			t.Errorf("Expected the node to be reset on retry %d", i)
+		}
+		if len(node.attempts) != i {
+			t.Errorf("Expected %d attempts, got %d", i, len(node.attempts))
+		}
+	}
+	fail("signal: killed")
+	if retried, _ := node.autoRetry(); retried {
+		t.Error("Expected no retry after the maximum attempts.")
+	}
+
+	// The attempts are persisted.
+	node = retryTestNode(t, dir, RetryPolicy{MaxAttempts: 3})
+	if len(node.attempts) != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", len(node.attempts))
+	} else if node.attempts[1].Error != "signal: killed" {
+		t.Errorf("Expected the error to be recorded, got %q",
+			node.attempts[1].Error)
+	}
+
+	// Errors which are not transient are not retried.
+	fail("Exception: bad input")
+	if retried, _ := node.autoRetry(); retried {
+		t.Error("Expected no retry of a non-transient error.")
+	}
+}
+
+func TestPreemptionRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestPreemptionRetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := retryTestNode(t, dir, RetryPolicy{MaxPreemptions: 2})
+	preempt := func() {
+		t.Helper()
+		join := node.forks[0].join_metadata
+		if err := join.WriteTime(Preempted); err != nil {
+			t.Fatal(err)
+		}
+		if err := join.WriteRaw(Errors, "signal: terminated"); err != nil {
+			t.Fatal(err)
+		}
+		node.state = node.getState()
+	}
+	for i := 1; i <= 2; i++ {
+		preempt()
+		if transient, _ := node.isErrorTransient(); !transient {
+			t.Error("Expected preemption to be transient.")
+		}
+		if retried, err := node.autoRetry(); err != nil {
+			t.Fatal(err)
+		} else if !retried {
+			t.Fatalf("Expected re-queue %d", i)
+		}
+		if node.state == Failed {
+			t.Errorf("Expected the node to be reset on re-queue %d", i)
+		}
+		if node.preemptions != i {
+			t.Errorf("Expected %d preemptions, got %d", i, node.preemptions)
+		}
+		if len(node.attempts) != 0 {
+			t.Error("Expected preemption not to count as an attempt.")
+		}
+	}
+	preempt()
+	if retried, _ := node.autoRetry(); retried {
+		t.Error("Expected no re-queue after the maximum preemptions.")
+	}
+
+	// The count is persisted.
+	node = retryTestNode(t, dir, RetryPolicy{})
+	if node.preemptions != 2 {
+		t.Errorf("Expected 2 preemptions, got %d", node.preemptions)
+	}
+
+	// By default, stages are re-queued up to defaultMaxPreemptions times.
+	for i := node.preemptions; i < defaultMaxPreemptions; i++ {
+		preempt()
+		if retried, _ := node.autoRetry(); !retried {
+			t.Fatalf("Expected re-queue %d by default", i+1)
+		}
+	}
+	preempt()
+	if retried, _ := node.autoRetry(); retried {
+		t.Error("Expected no re-queue after the default maximum preemptions.")
+	}
+
+	// A negative limit re-queues without limit.
+	node = retryTestNode(t, dir, RetryPolicy{MaxPreemptions: -1})
+	preempt()
+	if retried, _ := node.autoRetry(); !retried {
+		t.Error("Expected re-queue without a limit.")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRetryBackoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}
+	if d := policy.delay(2); d != 4*time.Hour {
+		t.Errorf("Expected 4h delay for the third attempt, got %v", d)
+	}
+	if d := (&RetryPolicy{
+		Backoff:       time.Minute,
+		BackoffFactor: 3,
+	}).delay(2); d != 9*time.Minute {
+		t.Errorf("Expected 9m delay for the third attempt, got %v", d)
+	}
+	node := retryTestNode(t, dir, policy)
+	if err := node.forks[0].join_metadata.WriteRaw(Errors, "signal: killed"); err != nil {
+		t.Fatal(err)
+	}
+	node.state = node.getState()
+	if retried, _ := node.autoRetry(); retried {
+		t.Error("Expected no retry before the backoff elapsed.")
+	}
+	node.retryAt = time.Now().Add(-time.Second)
+	if retried, err := node.autoRetry(); err != nil {
+		t.Fatal(err)
+	} else if !retried {
+		t.Error("Expected retry after the backoff elapsed.")
+	}
+}
+
+func TestStageRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStageRetries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := retryTestNode(t, dir, RetryPolicy{})
+	node.resources = &JobResources{Retries: 1}
+	if err := node.forks[0].join_metadata.WriteRaw(Errors, "signal: killed"); err != nil {
+		t.Fatal(err)
+	}
+	node.state = node.getState()
+	if retried, err := node.autoRetry(); err != nil {
+		t.Fatal(err)
+	} else if !retried {
+		t.Error("Expected the stage's retry limit to override the policy.")
+	}
+
+	// A stage can also disable retries.
+	node = retryTestNode(t, dir, RetryPolicy{MaxAttempts: 3})
+	node.resources = &JobResources{Retries: 0}
+	if err := node.forks[0].join_metadata.WriteRaw(Errors, "signal: killed"); err != nil {
+		t.Fatal(err)
+	}
+	node.state = node.getState()
+	if retried, _ := node.autoRetry(); retried {
+		t.Error("Expected no retry of a stage with retries = 0.")
+	}
+}
+
+func TestChunkJobReqs(t *testing.T) {
+	overrides, _ := ReadOverrides("")
+	node := &Node{
+		kind:      "stage",
+		fqname:    "ID.test.STAGE",
+		resources: &JobResources{Threads: 1, MemGB: 2},
+		rt: &Runtime{
+			Config:    &RuntimeOptions{},
+			overrides: overrides,
+			JobManager: &LocalJobManager{
+				maxCores:    16,
+				maxMemGB:    64,
+				jobSettings: &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+			},
+		},
+	}
+	var defs StageDefs
+	if err := json.Unmarshal([]byte(`{
+    "chunks": [
+        {"__mem_gb": 8, "__threads": 4, "input": "big"},
+        {"__mem_gb": 3, "input": "small"},
+        {"input": "default"}
+    ]
+}`), &defs); err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []JobResources{
+		{Threads: 4, MemGB: 8},
+		{Threads: 1, MemGB: 3},
+		{Threads: 1, MemGB: 2},
+	} {
+		def := defs.ChunkDefs[i]
+		if def.Resources == nil {
+			def.Resources = &JobResources{}
+		}
+		res := node.setChunkJobReqs(def.Resources)
+		if res.Threads != expect.Threads || res.MemGB != expect.MemGB {
+			t.Errorf("Expected chunk %d to get %v, got %v",
+				i, expect.ToMap(), res.ToMap())
+		}
+		if _, ok := def.Args["__mem_gb"]; ok {
+			t.Errorf("Expected chunk %d resources to be removed from its args", i)
+		}
+	}
+	// The stage defaults are unchanged.
+	if node.resources.Threads != 1 || node.resources.MemGB != 2 {
+		t.Errorf("Expected the stage resources to be unchanged, got %v",
+			node.resources.ToMap())
+	}
+}
+
+func TestBuildForksLimit(t *testing.T) {
+	sweep := func(node *Node, id string, n int) *Binding {
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i] = i
+		}
+		return &Binding{
+			node:        node,
+			id:          id,
+			sweep:       true,
+			sweepRootId: id,
+			mode:        "value",
+			value:       values,
+		}
+	}
+	newNode := func(max int) *Node {
+		return &Node{
+			kind:   "stage",
+			fqname: "ID.test.PIPE.STAGE",
+			rt: &Runtime{
+				Config: &RuntimeOptions{MaxForks: max},
+			},
+		}
+	}
+	node := newNode(10)
+	if err := node.buildForks([]*Binding{
+		sweep(node, "a", 2),
+		sweep(node, "b", 5),
+	}); err != nil {
+		t.Error(err)
+	} else if len(node.forks) != 10 {
+		t.Errorf("Expected 10 forks, got %d", len(node.forks))
+	}
+
+	node = newNode(10)
+	err := node.buildForks([]*Binding{
+		sweep(node, "a", 3),
+		sweep(node, "b", 5),
+	})
+	if err == nil {
+		t.Fatal("Expected too many forks.")
+	} else if len(node.forks) != 0 {
+		t.Errorf("Expected no forks, got %d", len(node.forks))
+	}
+	const expect = "RuntimeError: ID.test.PIPE.STAGE would have more than 10 forks, " +
+		"from the sweeps over ID.test.PIPE.STAGE.a (3 values) x " +
+		"ID.test.PIPE.STAGE.b (5 values)."
+	if err.Error() != expect {
+		t.Errorf("Expected error\n%s\ngot\n%s", expect, err.Error())
+	}
+
+	node = newNode(-1)
+	if err := node.buildForks([]*Binding{
+		sweep(node, "a", 3),
+		sweep(node, "b", 5),
+	}); err != nil {
+		t.Error(err)
+	} else if len(node.forks) != 15 {
+		t.Errorf("Expected 15 forks, got %d", len(node.forks))
+	}
+}
@@ -0,0 +1,231 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Export of node step spans to an OpenTelemetry collector, using the
+// OTLP/HTTP protocol with JSON encoding.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Spans are exported once this many are buffered, even if a flush was not
+// requested.
+const maxBufferedSpans = 2048
+
+var otelClient = http.Client{Timeout: 30 * time.Second}
+
+type otelValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otelAttribute struct {
+	Key   string    `json:"key"`
+	Value otelValue `json:"value"`
+}
+
+type otelSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otelAttribute `json:"attributes,omitempty"`
+}
+
+type otelScopeSpans struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	} `json:"scope"`
+	Spans []*otelSpan `json:"spans"`
+}
+
+type otelResourceSpans struct {
+	Resource struct {
+		Attributes []otelAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otelScopeSpans `json:"scopeSpans"`
+}
+
+type otelTraceRequest struct {
+	ResourceSpans []otelResourceSpans `json:"resourceSpans"`
+}
+
+// Collects spans and posts them to an OTLP/HTTP endpoint.
+//
+// All spans from a runtime share a trace id.
+type spanExporter struct {
+	endpoint string
+	traceId  string
+
+	lock     sync.Mutex
+	spans    []*otelSpan
+	flushing bool
+}
+
+// Create an exporter for the given collector endpoint.  If the endpoint
+// URL has no path, the standard /v1/traces path is used.
+func newSpanExporter(endpoint string) (*spanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported OTLP endpoint scheme %q", u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return &spanExporter{
+		endpoint: u.String(),
+		traceId:  randomHexId(16),
+	}, nil
+}
+
+func randomHexId(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// A span which has been started but not yet ended.
+type activeSpan struct {
+	exporter *spanExporter
+	name     string
+	start    time.Time
+}
+
+// Start a span.  Returns nil if the exporter is nil.
+func (self *spanExporter) start(name string) *activeSpan {
+	if self == nil {
+		return nil
+	}
+	return &activeSpan{
+		exporter: self,
+		name:     name,
+		start:    time.Now(),
+	}
+}
+
+// End the span and add it to the exporter's buffer.  Does nothing if the
+// span is nil.
+func (self *activeSpan) end(attributes map[string]string) {
+	if self == nil {
+		return
+	}
+	span := &otelSpan{
+		TraceId: self.exporter.traceId,
+		SpanId:  randomHexId(8),
+		Name:    self.name,
+		// SPAN_KIND_INTERNAL
+		Kind:              1,
+		StartTimeUnixNano: strconv.FormatInt(self.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+	for key, value := range attributes {
+		span.Attributes = append(span.Attributes, otelAttribute{
+			Key:   key,
+			Value: otelValue{StringValue: value},
+		})
+	}
+	self.exporter.lock.Lock()
+	self.exporter.spans = append(self.exporter.spans, span)
+	full := len(self.exporter.spans) >= maxBufferedSpans
+	self.exporter.lock.Unlock()
+	if full {
+		self.exporter.flushAsync()
+	}
+}
+
+// Take the buffered spans.
+func (self *spanExporter) take() []*otelSpan {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	spans := self.spans
+	self.spans = nil
+	return spans
+}
+
+// Export the buffered spans in the background, unless an export is already
+// in progress.
+func (self *spanExporter) flushAsync() {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.flushing || len(self.spans) == 0 {
+		return
+	}
+	self.flushing = true
+	go func() {
+		self.flush()
+		self.lock.Lock()
+		self.flushing = false
+		self.lock.Unlock()
+	}()
+}
+
+// Export the buffered spans.  Failures are logged, but are otherwise
+// ignored.
+func (self *spanExporter) flush() {
+	if self == nil {
+		return
+	}
+	spans := self.take()
+	if len(spans) == 0 {
+		return
+	}
+	if err := self.export(spans); err != nil {
+		util.LogError(err, "otel", "Could not export %d spans to %s.",
+			len(spans), self.endpoint)
+	}
+}
+
+func (self *spanExporter) export(spans []*otelSpan) error {
+	var req otelTraceRequest
+	rs := otelResourceSpans{
+		ScopeSpans: []otelScopeSpans{{Spans: spans}},
+	}
+	rs.Resource.Attributes = []otelAttribute{{
+		Key:   "service.name",
+		Value: otelValue{StringValue: "martian"},
+	}}
+	rs.ScopeSpans[0].Scope.Name = "github.com/martian-lang/martian/martian/core"
+	rs.ScopeSpans[0].Scope.Version = util.GetVersion()
+	req.ResourceSpans = []otelResourceSpans{rs}
+	body, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+	resp, err := otelClient.Post(self.endpoint, "application/json",
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
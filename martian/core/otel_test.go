@@ -0,0 +1,82 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewSpanExporter(t *testing.T) {
+	if e, err := newSpanExporter("http://localhost:4318"); err != nil {
+		t.Error(err)
+	} else if e.endpoint != "http://localhost:4318/v1/traces" {
+		t.Errorf("Incorrect endpoint %s", e.endpoint)
+	} else if len(e.traceId) != 32 {
+		t.Errorf("Incorrect trace id %s", e.traceId)
+	}
+	if e, err := newSpanExporter("https://collector/custom/traces"); err != nil {
+		t.Error(err)
+	} else if e.endpoint != "https://collector/custom/traces" {
+		t.Errorf("Incorrect endpoint %s", e.endpoint)
+	}
+	if _, err := newSpanExporter("localhost:4318"); err == nil {
+		t.Error("Expected an error for an endpoint without a scheme.")
+	}
+}
+
+func TestSpanExporter(t *testing.T) {
+	var requests []otelTraceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/traces" {
+			t.Errorf("Unexpected path %s", req.URL.Path)
+		}
+		var body otelTraceRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		requests = append(requests, body)
+	}))
+	defer srv.Close()
+	e, err := newSpanExporter(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.start("ID.test.STAGE").end(map[string]string{"martian.state": "running"})
+	e.start("ID.test.STAGE2").end(nil)
+	e.flush()
+	// Nothing is sent if there are no spans.
+	e.flush()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(requests))
+	}
+	if len(requests[0].ResourceSpans) != 1 ||
+		len(requests[0].ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("Incorrect request %v", requests[0])
+	}
+	spans := requests[0].ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "ID.test.STAGE" || span.TraceId != e.traceId ||
+		len(span.SpanId) != 16 || span.SpanId == spans[1].SpanId {
+		t.Errorf("Incorrect span %v", span)
+	}
+	if span.StartTimeUnixNano == "" || span.EndTimeUnixNano < span.StartTimeUnixNano {
+		t.Errorf("Incorrect span times %s %s",
+			span.StartTimeUnixNano, span.EndTimeUnixNano)
+	}
+	if len(span.Attributes) != 1 || span.Attributes[0].Key != "martian.state" ||
+		span.Attributes[0].Value.StringValue != "running" {
+		t.Errorf("Incorrect attributes %v", span.Attributes)
+	}
+
+	// A nil exporter does nothing.
+	var none *spanExporter
+	none.start("ID.test.STAGE").end(nil)
+	none.flush()
+	none.flushAsync()
+}
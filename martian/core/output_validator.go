@@ -0,0 +1,50 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Hooks for checking the outputs of stages before they complete.
+
+package core
+
+import (
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+// A Validator checks the outputs of a stage before the stage is marked
+// complete, for example to catch outputs which were only partially
+// written.
+type Validator interface {
+	// Validate returns an error if the outputs of the stage, given as the
+	// content of its _outs file, are not acceptable.
+	Validate(stage *syntax.Stage, outputsJSON []byte) error
+}
+
+// AddOutputValidator registers a validator to run on the outputs of each
+// fork of each stage, after the outputs are written but before the fork is
+// marked complete.  If the validator returns an error, the fork fails with
+// that error instead.
+//
+// Validators should be added before any pipestance is stepped.
+func (self *Runtime) AddOutputValidator(v Validator) {
+	self.validators = append(self.validators, v)
+}
+
+// Run the runtime's validators on the outputs of a stage fork, returning
+// the first error.
+func (self *Fork) validateOutputs() error {
+	if len(self.node.rt.validators) == 0 {
+		return nil
+	}
+	stage, ok := self.node.callable.(*syntax.Stage)
+	if !ok {
+		return nil
+	}
+	outs, err := self.metadata.readRawBytes(OutsFile)
+	if err != nil {
+		return err
+	}
+	for _, v := range self.node.rt.validators {
+		if err := v.Validate(stage, outs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+type testValidator struct {
+	stage *syntax.Stage
+	outs  string
+	err   error
+}
+
+func (self *testValidator) Validate(stage *syntax.Stage, outputsJSON []byte) error {
+	self.stage = stage
+	self.outs = string(outputsJSON)
+	return self.err
+}
+
+func TestValidateOutputs(t *testing.T) {
+	util.SetupSignalHandlers()
+	dir, err := ioutil.TempDir("", "TestValidateOutputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := retryTestNode(t, dir, RetryPolicy{})
+	stage := &syntax.Stage{Id: "STAGE"}
+	node.callable = stage
+	fork := node.forks[0]
+	if err := fork.metadata.WriteRaw(OutsFile, `{"out":1}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.validateOutputs(); err != nil {
+		t.Errorf("Expected no error without validators, got %v", err)
+	}
+
+	pass := new(testValidator)
+	fail := &testValidator{err: fmt.Errorf("bad output")}
+	node.rt.AddOutputValidator(pass)
+	node.rt.AddOutputValidator(fail)
+	if err := fork.validateOutputs(); err != fail.err {
+		t.Errorf("Expected the validator's error, got %v", err)
+	}
+	if pass.stage != stage {
+		t.Error("Expected the validator to get the stage.")
+	}
+	if pass.outs != `{"out":1}` {
+		t.Errorf("Expected the validator to get the outputs, got %q", pass.outs)
+	}
+}
@@ -196,6 +196,10 @@ type NodePerfInfo struct {
 	MaxBytes  int64            `json:"maxbytes"`
 	BytesHist []*NodeByteStamp `json:"bytehist"`
 	HighMem   *ObservedMemory  `json:"highmem,omitempty"`
+
+	// Samples of the resource usage of the node's local jobs while they
+	// ran, keyed by the fully qualified name of the job's metadata.
+	Samples map[string][]JobSample `json:"samples,omitempty"`
 }
 
 func reduceJobInfo(jobInfo *JobInfo, outputPaths []string, numThreads int) *PerfInfo {
@@ -47,6 +47,12 @@ func GetRunningMemory(pid int) (ObservedMemory, error) {
 	return ObservedMemory{}, nil
 }
 
+// Gets the total cpu time used so far by the given process and all of its
+// running children.
+func GetProcessTreeCpuTime(pid int) (time.Duration, error) {
+	return 0, nil
+}
+
 // Gets IO statistics for a running process by pid.
 func GetRunningIo(pid int) (*IoAmount, error) {
 	return nil, err
@@ -262,6 +262,56 @@ func GetRunningMemory(pid int) (ObservedMemory, error) {
 	}
 }
 
+// The units of the cpu times in /proc/[pid]/stat.  This is USER_HZ, which
+// is 100 on all common platforms.
+const clockTicksPerSecond = 100
+
+// Gets the total cpu time used so far by the given process and all of its
+// running children.  Children which have already exited, but were waited
+// for, are included in their parent's time.
+func GetProcessTreeCpuTime(pid int) (time.Duration, error) {
+	spid := strconv.Itoa(pid)
+	b, err := ioutil.ReadFile("/proc/" + spid + "/stat")
+	if err != nil {
+		return 0, err
+	}
+	// The command name may contain spaces, so skip past it.
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return 0, &unexpectedContentError{fn: "stat", content: string(b)}
+	}
+	fields := bytes.Fields(b[i+1:])
+	if len(fields) < 15 {
+		return 0, &unexpectedContentError{fn: "stat", content: string(b)}
+	}
+	// utime, stime, cutime and cstime.
+	var ticks int64
+	for _, field := range fields[11:15] {
+		if t, err := util.Atoi(field); err != nil {
+			return 0, err
+		} else {
+			ticks += t
+		}
+	}
+	total := time.Duration(ticks) * time.Second / clockTicksPerSecond
+	if tasks, err := ioutil.ReadDir("/proc/" + spid + "/task"); err == nil {
+		for _, task := range tasks {
+			children, err := ioutil.ReadFile(
+				"/proc/" + spid + "/task/" + task.Name() + "/children")
+			if err != nil {
+				continue
+			}
+			for _, child := range bytes.Fields(children) {
+				if ichild, err := util.Atoi(child); err == nil {
+					ctime, _ := GetProcessTreeCpuTime(int(ichild))
+					total += ctime
+				}
+			}
+		}
+	}
+	return total, nil
+}
+
 func getRunningMemoryAt(fd int) (ObservedMemory, error) {
 	if b, err := util.ReadFileAt(fd, "statm"); err != nil {
 		return ObservedMemory{}, err
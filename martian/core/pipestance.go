@@ -7,13 +7,18 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime/trace"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -43,12 +48,15 @@ func NewStagestance(parent Nodable, callStm *syntax.CallStm, callables *syntax.C
 
 	stagecodePaths := append(self.node.mroPaths, strings.Split(os.Getenv("PATH"), ":")...)
 	stagecodePath := stage.Src.Path
-	if fullPath, found := util.SearchPaths(stage.Src.Path, stagecodePaths); found {
+	if fullPath, found := util.SearchPaths(stage.Src.Path, stagecodePaths); found &&
+		stage.Src.Image == "" {
 		// While it should have been checked at compile time (at least for
 		// python stages), it's better to have a relative path here than
 		// an empty string if the path no longer resolves.
 		stagecodePath = fullPath
 	}
+	// The stage code for container stages is a path in the image.
+	self.node.stagecodeImage = stage.Src.Image
 	self.node.stagecodeCmd = strings.Join(append([]string{stagecodePath}, stage.Src.Args...), " ")
 	var err error
 	if self.node.stagecodeLang, err = stage.Src.Lang.Parse(); err != nil {
@@ -66,12 +74,34 @@ func NewStagestance(parent Nodable, callStm *syntax.CallStm, callables *syntax.C
 		self.node.resources = &JobResources{
 			Threads: int(stage.Resources.Threads),
 			MemGB:   int(stage.Resources.MemGB),
+			GPUs:    int(stage.Resources.GPUs),
 			Special: stage.Resources.Special,
+			Timeout: time.Duration(stage.Resources.Timeout) * time.Second,
+			Retries: -1,
+			DiskGB:  int(stage.Resources.DiskGB),
+		}
+		if stage.Resources.RetriesNode != nil {
+			self.node.resources.Retries = int(stage.Resources.Retries)
 		}
 		self.node.strictVolatile = stage.Resources.StrictVolatile
+		self.node.priority = int(stage.Resources.Priority)
+	}
+	if stage.Env != nil && len(stage.Env.Vars) > 0 {
+		// The envs map is shared with the rest of the pipestance, so copy
+		// it before adding the stage's variables, which take precedence.
+		envs := make(map[string]string, len(self.node.envs)+len(stage.Env.Vars))
+		for key, value := range self.node.envs {
+			envs[key] = value
+		}
+		for _, v := range stage.Env.Vars {
+			envs[v.Key] = v.Value
+		}
+		self.node.envs = envs
+	}
+	if err := self.node.buildForks(self.node.argbindingList); err != nil {
+		return nil, err
 	}
-	self.node.buildForks(self.node.argbindingList)
-	if stage.Retain != nil {
+	if stage.Retain != nil && self.node.rt.Config.VdrMode != "aggressive" {
 		for _, param := range stage.Retain.Params {
 			for _, fork := range self.node.forks {
 				if fork.fileArgs == nil {
@@ -135,14 +165,27 @@ type Pipestance struct {
 	uuid     string
 
 	// Cache for self.node.allNodes()
-	allNodesCache    []*Node
+	allNodesCache []*Node
+	// Index of allNodesCache by fully qualified name.
+	nodesByNameCache map[string]*Node
+
 	queueCheckLock   sync.Mutex
 	queueCheckActive bool
 	lastQueueCheck   time.Time
+
+	// Set for pipestances which were attached in read-only mode, for example
+	// to monitor a pipestance being run by another process.  Nothing is ever
+	// written to the directory of such a pipestance, even if it is locked.
+	attachedReadOnly bool
+
+	// Serializes updates to the tags file.
+	tagsLock sync.Mutex
 }
 
 /* Run a script whenever a pipestance finishes */
 func (self *Pipestance) OnFinishHook(outerCtx context.Context) {
+	// Export any remaining spans before mrp exits.
+	self.getNode().rt.tracer.flush()
 	if exec_path := self.getNode().rt.Config.OnFinishHandler; exec_path != "" {
 		ctx, task := trace.NewTask(outerCtx, "onfinish")
 		defer task.End()
@@ -270,7 +313,7 @@ func NewPipestance(parent Nodable, callStm *syntax.CallStm, callables *syntax.Ca
 		self.node.retbindingList = append(self.node.retbindingList, binding)
 	}
 	self.node.attachBindings(self.node.retbindingList)
-	if pipeline.Retain != nil {
+	if pipeline.Retain != nil && self.node.rt.Config.VdrMode != "aggressive" {
 		for _, retain := range pipeline.Retain.Refs {
 			self.retain(retain)
 		}
@@ -285,7 +328,9 @@ func NewPipestance(parent Nodable, callStm *syntax.CallStm, callables *syntax.Ca
 		}
 	}
 
-	self.node.buildForks(self.node.retbindingList)
+	if err := self.node.buildForks(self.node.retbindingList); err != nil {
+		return nil, err
+	}
 	return self, nil
 }
 
@@ -298,7 +343,9 @@ func (self *Pipestance) RefreshState(ctx context.Context) {
 	defer r.End()
 	self.node.refreshState(self.readOnly())
 }
-func (self *Pipestance) readOnly() bool { return !self.metadata.exists(Lock) }
+func (self *Pipestance) readOnly() bool {
+	return self.attachedReadOnly || !self.metadata.exists(Lock)
+}
 
 func (self *Pipestance) GetPrenodes() map[string]Nodable {
 	return self.node.GetPrenodes()
@@ -315,15 +362,40 @@ func (self *Pipestance) Callable() syntax.Callable {
 func (self *Pipestance) allNodes() []*Node {
 	if self.allNodesCache == nil {
 		self.allNodesCache = self.node.allNodes()
+		self.nodesByNameCache = nil
 	}
 	return self.allNodesCache
 }
 
+// GetNodeByFQName returns the stage or pipeline node with the given fully
+// qualified name, if there is one.
+func (self *Pipestance) GetNodeByFQName(fqname string) (*Node, bool) {
+	nodes := self.allNodes()
+	if self.nodesByNameCache == nil {
+		self.nodesByNameCache = make(map[string]*Node, len(nodes))
+		for _, node := range nodes {
+			self.nodesByNameCache[node.fqname] = node
+		}
+	}
+	node, ok := self.nodesByNameCache[fqname]
+	return node, ok
+}
+
+// Mark every node in the pipestance so that stepping it reports the jobs
+// it would run instead of running them.
+func (self *Pipestance) setDryRun() {
+	for _, node := range self.allNodes() {
+		node.dryRun = true
+	}
+}
+
 func (self *Pipestance) LoadMetadata(ctx context.Context) {
 	// We used to make this concurrent but ended up with too many
 	// goroutines (Pranav's 96-sample run).
 	r := trace.StartRegion(ctx, "LoadMetadata")
 	defer r.End()
+	self.metadata.loadCache()
+	self.node.paused.set(self.metadata.exists(PausedFile))
 	for _, node := range self.allNodes() {
 		node.loadMetadata()
 	}
@@ -340,15 +412,10 @@ func (self *Pipestance) GetState(ctx context.Context) MetadataState {
 	defer r.End()
 	nodes := self.node.getFrontierNodes()
 	for _, node := range nodes {
-		if node.state == Failed {
+		if node.state == Failed && !node.canRetry() {
 			return Failed
 		}
 	}
-	for _, node := range nodes {
-		if node.state == Running {
-			return Running
-		}
-	}
 	every := true
 	for _, node := range self.allNodes() {
 		if node.state != DisabledState {
@@ -369,9 +436,331 @@ func (self *Pipestance) GetState(ctx context.Context) MetadataState {
 	if every {
 		return Complete
 	}
+	if self.IsPaused() && !hasRunningJobs(nodes) {
+		return Paused
+	}
+	for _, node := range nodes {
+		// Failed nodes which are waiting to be retried count as running.
+		if node.state == Running || node.state == Failed {
+			return Running
+		}
+	}
 	return ForkWaiting
 }
 
+// Returns true if any of the given nodes have jobs which are queued or
+// running.
+func hasRunningJobs(nodes []*Node) bool {
+	for _, node := range nodes {
+		for _, m := range node.collectMetadatas() {
+			if st, _ := m.getState(); st == Running || st == Queued {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Pause the pipestance.  While it is paused, stepping nodes does not start
+// any new jobs, but jobs which are already queued or running are left to
+// finish.  The pause is recorded in the pipestance metadata, so it persists
+// if the pipestance is reattached.
+func (self *Pipestance) Pause() error {
+	if self.readOnly() {
+		return ErrReadOnly
+	}
+	self.node.paused.set(true)
+	return self.metadata.WriteTime(PausedFile)
+}
+
+// Resume a paused pipestance.
+func (self *Pipestance) Resume() error {
+	if self.readOnly() {
+		return ErrReadOnly
+	}
+	self.node.paused.set(false)
+	if !self.metadata.exists(PausedFile) {
+		return nil
+	}
+	return self.metadata.remove(PausedFile)
+}
+
+// Returns true if the pipestance has been paused.
+func (self *Pipestance) IsPaused() bool {
+	return self.node.paused.get()
+}
+
+// Progress returns the fraction of stages in the pipestance which have
+// completed, ignoring disabled stages.
+//
+// Each stage counts once, no matter how many times it was forked.  A stage
+// with several forks contributes the fraction of its enabled forks which
+// are complete, so that a stage forked many times does not outweigh the
+// rest of the pipeline.  If there are no enabled stages, the progress is 1.
+func (self *Pipestance) Progress(ctx context.Context) float64 {
+	r := trace.StartRegion(ctx, "pipestance.Progress")
+	defer r.End()
+	var done, total float64
+	for _, node := range self.allNodes() {
+		if node.kind == "pipeline" || node.state == DisabledState {
+			continue
+		}
+		if node.state == Complete {
+			done++
+			total++
+			continue
+		}
+		var complete, enabled int
+		for _, fork := range node.forks {
+			switch fork.getState() {
+			case Complete:
+				complete++
+				enabled++
+			case DisabledState:
+			default:
+				enabled++
+			}
+		}
+		if enabled == 0 {
+			continue
+		}
+		done += float64(complete) / float64(enabled)
+		total++
+	}
+	if total == 0 {
+		return 1
+	}
+	return done / total
+}
+
+// JobProgress reports how much of the pipestance has completed, ignoring
+// disabled stages, with finer granularity than Progress.
+//
+// The completed and total counts are of jobs: each chunk of a fork which
+// has split counts as a job, as does its join.  A fork which has not split
+// yet counts as a single job, so the total grows as stages split.
+//
+// The fraction counts each stage once, no matter how many times it was
+// forked or how many chunks it has.  A stage which is not complete
+// contributes the fraction of its jobs which are complete, so that long
+// split stages make progress smoothly, but a stage forked many times does
+// not outweigh the rest of the pipeline.  If there are no enabled stages,
+// the fraction is 1.
+func (self *Pipestance) JobProgress(ctx context.Context) (completed, total int, fraction float64) {
+	r := trace.StartRegion(ctx, "pipestance.JobProgress")
+	defer r.End()
+	var done float64
+	stages := 0
+	for _, node := range self.allNodes() {
+		if node.kind == "pipeline" || node.state == DisabledState {
+			continue
+		}
+		var complete, jobs int
+		for _, fork := range node.forks {
+			c, t := fork.progress()
+			complete += c
+			jobs += t
+		}
+		if node.state == Complete {
+			done++
+		} else if jobs > 0 {
+			done += float64(complete) / float64(jobs)
+		} else {
+			continue
+		}
+		completed += complete
+		total += jobs
+		stages++
+	}
+	if stages == 0 {
+		return completed, total, 1
+	}
+	return completed, total, done / float64(stages)
+}
+
+// EstimatedTimeRemaining estimates how much longer the pipestance will take
+// to finish, as the average wall time of the stages which have completed
+// multiplied by the number of stages which have not, ignoring disabled
+// stages.  The wall time of a stage is taken from the start of its first
+// job to the end of its last, across all of its forks, from the job
+// information used for performance reporting.
+//
+// If no completed stage has timing information, -1 is returned.
+func (self *Pipestance) EstimatedTimeRemaining(ctx context.Context) time.Duration {
+	r := trace.StartRegion(ctx, "pipestance.EstimatedTimeRemaining")
+	defer r.End()
+	var total time.Duration
+	var timed, remaining int
+	for _, node := range self.allNodes() {
+		if node.kind == "pipeline" {
+			continue
+		}
+		switch node.state {
+		case DisabledState:
+		case Complete:
+			if d, ok := node.wallTime(); ok {
+				total += d
+				timed++
+			}
+		default:
+			remaining++
+		}
+	}
+	if timed == 0 {
+		return -1
+	}
+	return total / time.Duration(timed) * time.Duration(remaining)
+}
+
+// EstimateRemaining estimates how much longer the pipestance will take to
+// finish, from the performance information of a previous run of the same
+// pipeline, such as the contents of its _perf file.
+//
+// Each stage which is neither complete nor disabled contributes the wall
+// time it took in the previous run.  Stages are matched by their fully
+// qualified names, ignoring the pipestance ID.  Stages which do not appear
+// in the history contribute the runtime's DefaultStageEstimate.
+func (self *Pipestance) EstimateRemaining(history []*NodePerfInfo) time.Duration {
+	wallTimes := make(map[string]time.Duration, len(history))
+	for _, perf := range history {
+		if perf == nil || perf.Type != "stage" {
+			continue
+		}
+		if d, ok := forksWallTime(perf.Forks); ok {
+			wallTimes[stripPsid(perf.Fqname)] = d
+		}
+	}
+	var remaining time.Duration
+	for _, node := range self.allNodes() {
+		if node.kind == "pipeline" ||
+			node.state == Complete || node.state == DisabledState {
+			continue
+		}
+		if d, ok := wallTimes[stripPsid(node.fqname)]; ok {
+			remaining += d
+		} else {
+			remaining += self.node.rt.Config.DefaultStageEstimate
+		}
+	}
+	return remaining
+}
+
+// ComputeCriticalPath returns the longest chain of dependent stages, by wall
+// time, in the order in which they run.
+//
+// Stages which have completed contribute the wall time recorded in their
+// performance information.  Other stages contribute the runtime's
+// DefaultStageEstimate.  Disabled stages and pipelines take no time of
+// their own, and are left out of the result.  Ties are broken by fully qualified name, so the result is
+// deterministic.
+func (self *Pipestance) ComputeCriticalPath(ctx context.Context) []*Node {
+	r := trace.StartRegion(ctx, "pipestance.ComputeCriticalPath")
+	defer r.End()
+	nodes := append([]*Node(nil), self.allNodes()...)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].fqname < nodes[j].fqname
+	})
+
+	// Topologically sort the nodes, considering only dependencies within
+	// this pipestance.
+	inPipestance := make(map[*Node]struct{}, len(nodes))
+	for _, node := range nodes {
+		inPipestance[node] = struct{}{}
+	}
+	prenodes := make(map[*Node][]*Node, len(nodes))
+	waiting := make(map[*Node]int, len(nodes))
+	postnodes := make(map[*Node][]*Node, len(nodes))
+	for _, node := range nodes {
+		for _, pre := range node.GetPrenodes() {
+			p := pre.getNode()
+			if _, ok := inPipestance[p]; ok && p != node {
+				prenodes[node] = append(prenodes[node], p)
+				postnodes[p] = append(postnodes[p], node)
+				waiting[node]++
+			}
+		}
+	}
+	order := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if waiting[node] == 0 {
+			order = append(order, node)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		for _, post := range postnodes[order[i]] {
+			if waiting[post]--; waiting[post] == 0 {
+				order = append(order, post)
+			}
+		}
+	}
+
+	// The finish time of each node, if it starts as soon as all of its
+	// prenodes finish, and the prenode which finishes last.
+	finish := make(map[*Node]time.Duration, len(order))
+	from := make(map[*Node]*Node, len(order))
+	var last *Node
+	for _, node := range order {
+		var start time.Duration
+		for _, pre := range prenodes[node] {
+			if f := finish[pre]; from[node] == nil || f > start ||
+				f == start && pre.fqname < from[node].fqname {
+				start = f
+				from[node] = pre
+			}
+		}
+		finish[node] = start + self.criticalPathDuration(node)
+		if last == nil || finish[node] > finish[last] ||
+			finish[node] == finish[last] && node.fqname < last.fqname {
+			last = node
+		}
+	}
+
+	var path []*Node
+	for node := last; node != nil; node = from[node] {
+		if node.kind != "pipeline" && node.state != DisabledState {
+			path = append(path, node)
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Get the wall time a node contributes to the critical path.
+func (self *Pipestance) criticalPathDuration(node *Node) time.Duration {
+	switch {
+	case node.kind == "pipeline" || node.state == DisabledState:
+		return 0
+	case node.state == Complete:
+		if d, ok := node.wallTime(); ok {
+			return d
+		}
+	}
+	return self.node.rt.Config.DefaultStageEstimate
+}
+
+// Remove the "ID.<psid>." prefix from a fully qualified name, so that nodes
+// can be matched between pipestances.
+func stripPsid(fqname string) string {
+	if strings.HasPrefix(fqname, "ID.") {
+		if i := strings.IndexByte(fqname[3:], '.'); i >= 0 {
+			return fqname[i+4:]
+		}
+	}
+	return fqname
+}
+
+// Get the pipestance ID from a fully qualified name.
+func psidFromFqname(fqname string) string {
+	if strings.HasPrefix(fqname, "ID.") {
+		if i := strings.IndexByte(fqname[3:], '.'); i >= 0 {
+			return fqname[3 : i+3]
+		}
+	}
+	return ""
+}
+
 func (self *Pipestance) Kill() {
 	self.KillWithMessage("Job was killed by Martian.")
 }
@@ -390,7 +779,7 @@ func (self *Pipestance) RestartRunningNodes(jobMode string, outerCtx context.Con
 	ctx, task := trace.NewTask(outerCtx, "restartNodes")
 	defer task.End()
 	if self.readOnly() {
-		return &RuntimeError{"Pipestance is in read only mode."}
+		return ErrReadOnly
 	}
 	self.LoadMetadata(ctx)
 	nodes := self.node.getFrontierNodes()
@@ -417,7 +806,7 @@ func (self *Pipestance) RestartRunningNodes(jobMode string, outerCtx context.Con
 // kills it and all of its child processes.
 func (self *Pipestance) RestartLocalJobs(jobMode string) error {
 	if self.readOnly() {
-		return &RuntimeError{"Pipestance is in read only mode."}
+		return ErrReadOnly
 	}
 	for _, node := range self.node.getFrontierNodes() {
 		if node.state == Running {
@@ -595,21 +984,121 @@ func (self *Pipestance) StepNodes(ctx context.Context) bool {
 				"Error refreshing cluster resources: %s", err.Error())
 		}
 	}
+	self.node.rt.resOverrides.reload()
+	self.node.rt.diskReservations.refresh(self.node.path)
 	hadProgress := false
 	for _, node := range self.node.getFrontierNodes() {
 		hadProgress = node.step() || hadProgress
 	}
+	if !self.IsPaused() {
+		for _, node := range self.node.getFrontierNodes() {
+			if node.state != Failed {
+				continue
+			}
+			if retried, err := node.autoRetry(); err != nil {
+				util.LogError(err, "runtime",
+					"Error retrying %s", node.fqname)
+			} else if retried {
+				hadProgress = true
+			}
+		}
+	}
+	self.updateMetrics()
 	for _, node := range self.allNodes() {
 		for _, m := range node.collectMetadatas() {
 			m.clearReadCache()
 		}
 	}
+	self.node.rt.tracer.flushAsync()
 	return hadProgress
 }
 
+// WaitUntilComplete waits until the pipestance completes or fails, or
+// until the context is cancelled.
+//
+// The pipestance is only observed, never stepped, so this is suitable for
+// watching a pipestance which some other process (e.g. mrp) is running.
+// The state is refreshed every PollInterval.  A pipestance which is
+// entirely disabled counts as complete.  If it fails, a
+// PipestanceFailedError describing the first failed stage is returned.
+// If the context is cancelled, its error is returned.
+func (self *Pipestance) WaitUntilComplete(ctx context.Context) error {
+	interval := self.pollInterval()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		self.RefreshState(ctx)
+		if done, err := self.checkComplete(ctx); done {
+			return err
+		}
+		timer.Reset(interval)
+	}
+}
+
+// RunUntilComplete runs the pipestance until it completes or fails, or
+// until the context is cancelled.
+//
+// The pipestance is refreshed and stepped in the same way as mrp does, so
+// the caller should not step it concurrently.  When no progress was made,
+// it waits for the runtime's PollInterval before trying again.  The return
+// value is the same as for WaitUntilComplete.  Jobs which are already
+// running are not killed when the context is cancelled.
+func (self *Pipestance) RunUntilComplete(ctx context.Context) error {
+	defer self.node.rt.tracer.flush()
+	interval := self.pollInterval()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		self.RefreshState(ctx)
+		if done, err := self.checkComplete(ctx); done {
+			return err
+		}
+		self.CheckHeartbeats(ctx)
+		if self.StepNodes(ctx) {
+			timer.Reset(0)
+		} else {
+			timer.Reset(interval)
+		}
+	}
+}
+
+func (self *Pipestance) pollInterval() time.Duration {
+	if interval := self.node.rt.Config.PollInterval; interval > 0 {
+		return interval
+	}
+	return DefaultPollInterval
+}
+
+// Returns true if the pipestance has finished, along with an error if it
+// failed.
+func (self *Pipestance) checkComplete(ctx context.Context) (bool, error) {
+	switch self.GetState(ctx) {
+	case Complete, DisabledState:
+		return true, nil
+	case Failed:
+		fqname, _, summary, _, _, _ := self.GetFatalError()
+		return true, &PipestanceFailedError{
+			Psid:    self.GetPsid(),
+			Fqname:  fqname,
+			Summary: summary,
+		}
+	}
+	return false, nil
+}
+
 func (self *Pipestance) Reset() error {
 	if self.readOnly() {
-		return &RuntimeError{"Pipestance is in read only mode."}
+		return ErrReadOnly
 	}
 	for _, node := range self.allNodes() {
 		if node.state == Failed {
@@ -621,15 +1110,157 @@ func (self *Pipestance) Reset() error {
 	return nil
 }
 
+// Reset a single stage, given its fully qualified name, so that it will run
+// again.
+//
+// Only failed or complete stages can be reset.  Complete stages are always
+// fully reset, since a partial reset only removes failed jobs.  Stages which
+// depend on the reset stage are not reset.
+func (self *Pipestance) ResetNode(fqname string) error {
+	if self.readOnly() {
+		return ErrReadOnly
+	}
+	node, ok := self.GetNodeByFQName(fqname)
+	if !ok {
+		return &RuntimeError{fmt.Sprintf("No node named %s.", fqname)}
+	}
+	if node.kind != "stage" {
+		return &RuntimeError{fmt.Sprintf(
+			"%s is a pipeline, not a stage.", fqname)}
+	}
+	switch node.state {
+	case Failed:
+		return node.reset()
+	case Complete:
+		return node.resetFull()
+	default:
+		return &RuntimeError{fmt.Sprintf(
+			"Cannot reset %s because it is not failed or complete.",
+			fqname)}
+	}
+}
+
 func (self *Pipestance) SerializeState() []*NodeInfo {
 	nodes := self.allNodes()
 	ser := make([]*NodeInfo, 0, len(nodes))
 	for _, node := range nodes {
-		ser = append(ser, node.serializeState())
+		info := node.serializeState()
+		if node == self.node {
+			if tags, err := self.GetTags(); err != nil {
+				util.LogError(err, "runtime", "Error reading pipestance tags.")
+			} else {
+				info.Tags = tags
+			}
+		}
+		ser = append(ser, info)
 	}
 	return ser
 }
 
+// SerializeStateJSON serializes the state of the pipestance in a stable
+// form which can be compared across runs with tools such as diff.
+//
+// The nodes are sorted by fully qualified name, which keeps the top-level
+// pipeline first, and the fields of every object are in alphabetical order.
+func (self *Pipestance) SerializeStateJSON(ctx context.Context) ([]byte, error) {
+	defer trace.StartRegion(ctx, "SerializeStateJSON").End()
+	ser := self.SerializeState()
+	sort.Slice(ser, func(i, j int) bool {
+		return ser[i].Fqname < ser[j].Fqname
+	})
+	b, err := json.Marshal(ser)
+	if err != nil {
+		return nil, err
+	}
+	// Round-trip through generic maps, which the encoder writes with their
+	// keys sorted.
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(generic, "", "    ")
+}
+
+// Fill colors for nodes in the DOT graph, by state.
+var dotFillColors = map[MetadataState]string{
+	Complete: "#b7e1a1",
+	Running:  "#f9e79f",
+	Queued:   "#f9e79f",
+	Failed:   "#f4a6a6",
+}
+
+// WriteDOT writes the pipestance graph in the Graphviz DOT language.  It is
+// the same as ExportDOT.
+func (self *Pipestance) WriteDOT(w io.Writer) error {
+	return self.ExportDOT(w)
+}
+
+// ExportDOT writes the pipestance graph in the Graphviz DOT language.
+//
+// Each stage or pipeline is a box labeled with its fully qualified name and
+// current state, with an edge from each node to the nodes which depend on
+// it, as given by GetPrenodes and GetPostNodes.  Complete nodes are filled
+// in green, running or queued nodes in yellow, and failed nodes in red.
+func (self *Pipestance) ExportDOT(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("digraph pipestance {\n")
+	buf.WriteString("    node [shape=box];\n")
+	nodes := self.allNodes()
+	for _, node := range nodes {
+		state := string(node.state)
+		if node.state == Waiting {
+			state = "waiting"
+		}
+		var style []string
+		if node.kind == "pipeline" {
+			style = append(style, "rounded")
+		}
+		fill := dotFillColors[node.state]
+		if fill != "" {
+			style = append(style, "filled")
+		}
+		fmt.Fprintf(&buf, "    %s [label=%s",
+			strconv.Quote(node.fqname),
+			strconv.Quote(node.fqname+"\n"+state))
+		if len(style) > 0 {
+			fmt.Fprintf(&buf, ", style=%q", strings.Join(style, ","))
+		}
+		if fill != "" {
+			fmt.Fprintf(&buf, ", fillcolor=%q", fill)
+		}
+		buf.WriteString("];\n")
+	}
+	type edge struct{ from, to string }
+	edges := make(map[edge]struct{})
+	for _, node := range nodes {
+		for _, prenode := range node.GetPrenodes() {
+			edges[edge{prenode.getNode().fqname, node.fqname}] = struct{}{}
+		}
+		for _, postnode := range node.GetPostNodes() {
+			edges[edge{node.fqname, postnode.getNode().fqname}] = struct{}{}
+		}
+	}
+	sorted := make([]edge, 0, len(edges))
+	for e := range edges {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].from != sorted[j].from {
+			return sorted[i].from < sorted[j].from
+		}
+		return sorted[i].to < sorted[j].to
+	})
+	for _, e := range sorted {
+		fmt.Fprintf(&buf, "    %s -> %s;\n",
+			strconv.Quote(e.from), strconv.Quote(e.to))
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
 func (self *Pipestance) SerializePerf() []*NodePerfInfo {
 	nodes := self.allNodes()
 	ser := make([]*NodePerfInfo, 0, len(nodes))
@@ -699,6 +1330,9 @@ func (self *Pipestance) ZipMetadata(zipPath string) error {
 	if !self.node.rt.Config.Zip {
 		return nil
 	}
+	if self.attachedReadOnly {
+		return ErrReadOnly
+	}
 
 	nodes := self.allNodes()
 	metadatas := []*Metadata{}
@@ -718,7 +1352,7 @@ func (self *Pipestance) ZipMetadata(zipPath string) error {
 	defer util.ExitCriticalSection()
 
 	// Create zip with all metadata.
-	if err := util.CreateZip(zipPath, filePaths); err != nil {
+	if err := createMetadataZip(zipPath, filePaths); err != nil {
 		util.LogError(err, "runtime", "Failed to zip metadata")
 		return err
 	}
@@ -736,6 +1370,17 @@ func (self *Pipestance) ZipMetadata(zipPath string) error {
 	return nil
 }
 
+// Read metadata which is not on disk from the given archive.
+func (self *Pipestance) useMetadataArchive(archive *metadataArchive) {
+	self.metadata.archive = archive
+	for _, node := range self.allNodes() {
+		node.metadataArchive = archive
+		for _, metadata := range node.collectMetadatas() {
+			metadata.archive = archive
+		}
+	}
+}
+
 func (self *Pipestance) GetPath() string {
 	return self.node.parent.getNode().path
 }
@@ -766,6 +1411,9 @@ func (self *Pipestance) GetVersions() (string, string, error) {
 }
 
 func (self *Pipestance) PostProcess() {
+	if self.attachedReadOnly {
+		return
+	}
 	self.node.postProcess()
 	self.metadata.WriteRaw(TimestampFile, self.metadata.readRaw(TimestampFile)+"\nend: "+util.Timestamp())
 	self.Immortalize(false)
@@ -774,17 +1422,22 @@ func (self *Pipestance) PostProcess() {
 // Generate the final state file for the pipestance and zip the content up
 // for posterity.
 //
-// Unless force is true, this is only permitted for locked pipestances.
+// Unless force is true, this is only permitted for locked pipestances.  It is
+// never permitted for pipestances attached in read-only mode.
 func (self *Pipestance) Immortalize(force bool) error {
-	if !force && self.readOnly() {
-		return &RuntimeError{"Pipestance is in read only mode."}
+	if self.attachedReadOnly || !force && self.readOnly() {
+		return ErrReadOnly
 	}
 	self.metadata.loadCache()
 	if !self.metadata.exists(Perf) {
 		self.metadata.Write(Perf, self.SerializePerf())
 	}
 	if !self.metadata.exists(FinalState) {
-		self.metadata.Write(FinalState, self.SerializeState())
+		if b, err := self.SerializeStateJSON(context.Background()); err != nil {
+			util.LogError(err, "runtime", "Failed to serialize the final state.")
+		} else {
+			self.metadata.WriteRawBytes(FinalState, b)
+		}
 	}
 	if !self.metadata.exists(MetadataZip) {
 		zipPath := self.metadata.MetadataFilePath(MetadataZip)
@@ -799,10 +1452,16 @@ func (self *Pipestance) Immortalize(force bool) error {
 }
 
 func (self *Pipestance) RecordUiPort(url string) error {
+	if self.attachedReadOnly {
+		return ErrReadOnly
+	}
 	return self.metadata.WriteRaw(UiPort, url)
 }
 
 func (self *Pipestance) ClearUiPort() error {
+	if self.attachedReadOnly {
+		return ErrReadOnly
+	}
 	return self.metadata.remove(UiPort)
 }
 
@@ -814,7 +1473,42 @@ func (self *Pipestance) GetUuid() (string, error) {
 	}
 }
 
+// Get the tags given to the pipestance when it was invoked, or added since
+// with AddTag.
+func (self *Pipestance) GetTags() ([]string, error) {
+	var tags []string
+	if err := self.metadata.ReadInto(TagsFile, &tags); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Add a tag to the pipestance, for example to record the project or sample
+// which it belongs to, if it does not already have it.
+func (self *Pipestance) AddTag(tag string) error {
+	if self.readOnly() {
+		return ErrReadOnly
+	}
+	self.tagsLock.Lock()
+	defer self.tagsLock.Unlock()
+	tags, err := self.GetTags()
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if t == tag {
+			return nil
+		}
+	}
+	return self.metadata.Write(TagsFile, append(tags, tag))
+}
+
 func (self *Pipestance) SetUuid(uuid string) error {
+	if self.attachedReadOnly {
+		return ErrReadOnly
+	}
 	if err := self.metadata.WriteRaw(UuidFile, uuid); err == nil {
 		self.uuid = uuid
 		return nil
@@ -824,6 +1518,9 @@ func (self *Pipestance) SetUuid(uuid string) error {
 }
 
 func (self *Pipestance) Lock() error {
+	if self.attachedReadOnly {
+		return ErrReadOnly
+	}
 	self.metadata.loadCache()
 	if self.metadata.exists(Lock) {
 		return &PipestanceLockedError{self.node.parent.getNode().name, self.GetPath()}
@@ -834,6 +1531,9 @@ func (self *Pipestance) Lock() error {
 }
 
 func (self *Pipestance) unlock() {
+	if self.attachedReadOnly {
+		return
+	}
 	self.metadata.remove(Lock)
 }
 
@@ -843,9 +1543,34 @@ func (self *Pipestance) Unlock() {
 }
 
 func (self *Pipestance) HandleSignal(sig os.Signal) {
+	if sig == syscall.SIGTERM {
+		self.node.rt.drainLocalJobs()
+	}
 	self.unlock()
 }
 
+// A flag shared by all nodes in a pipestance, which is set while the
+// pipestance is paused.
+type pauseFlag struct {
+	paused bool
+	lock   sync.Mutex
+}
+
+func (self *pauseFlag) set(paused bool) {
+	self.lock.Lock()
+	self.paused = paused
+	self.lock.Unlock()
+}
+
+func (self *pauseFlag) get() bool {
+	if self == nil {
+		return false
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.paused
+}
+
 // Map of nodes protected by a lock.
 type threadSafeNodeMap struct {
 	nodes map[string]Nodable
@@ -864,6 +1589,9 @@ func (self *threadSafeNodeMap) Remove(key string) {
 	delete(self.nodes, key)
 }
 
+// Get the nodes, highest priority first, and otherwise ordered by fully
+// qualified name, so that when jobs are submitted in this order, those for
+// the stages with the highest priority go first.
 func (self *threadSafeNodeMap) GetNodes() []*Node {
 	self.lock.Lock()
 	defer self.lock.Unlock()
@@ -871,6 +1599,12 @@ func (self *threadSafeNodeMap) GetNodes() []*Node {
 	for _, node := range self.nodes {
 		nodes = append(nodes, node.getNode())
 	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].priority != nodes[j].priority {
+			return nodes[i].priority > nodes[j].priority
+		}
+		return nodes[i].fqname < nodes[j].fqname
+	})
 	return nodes
 }
 
@@ -906,6 +1640,8 @@ func NewTopNode(rt *Runtime, psid string, p string, mroPaths []string, mroVersio
 	self := &TopNode{}
 	self.node = &Node{}
 	self.node.frontierNodes = &threadSafeNodeMap{nodes: make(map[string]Nodable)}
+	self.node.paused = new(pauseFlag)
+	self.node.subscribers = new(nodeSubscribers)
 	self.node.path = p
 	self.node.mroPaths = mroPaths
 	self.node.mroVersion = mroVersion
@@ -951,6 +1687,7 @@ type runtimePipeFactory struct {
 	checkSrc       bool
 	readOnly       bool
 	tags           []string
+	dryRun         bool
 }
 
 func NewRuntimePipestanceFactory(rt *Runtime,
@@ -963,10 +1700,11 @@ func NewRuntimePipestanceFactory(rt *Runtime,
 	envs map[string]string,
 	checkSrc bool,
 	readOnly bool,
-	tags []string) PipestanceFactory {
+	tags []string,
+	dryRun bool) PipestanceFactory {
 	return runtimePipeFactory{rt,
 		invocationSrc, invocationPath, psid, mroPaths, pipestancePath, mroVersion,
-		envs, checkSrc, readOnly, tags}
+		envs, checkSrc, readOnly, tags, dryRun}
 }
 
 func (self runtimePipeFactory) ReattachToPipestance(ctx context.Context) (*Pipestance, error) {
@@ -978,6 +1716,10 @@ func (self runtimePipeFactory) ReattachToPipestance(ctx context.Context) (*Pipes
 }
 
 func (self runtimePipeFactory) InvokePipeline() (*Pipestance, error) {
+	if self.dryRun {
+		return self.rt.InvokePipelineDryRun(self.invocationSrc, self.invocationPath, self.psid,
+			self.pipestancePath, self.mroPaths, self.mroVersion, self.envs, self.tags)
+	}
 	return self.rt.InvokePipeline(self.invocationSrc, self.invocationPath, self.psid,
 		self.pipestancePath, self.mroPaths, self.mroVersion, self.envs, self.tags)
 }
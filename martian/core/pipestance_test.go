@@ -0,0 +1,500 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Make a stage node with forks in the given states.
+func progressTestNode(name string, states ...MetadataFileName) *Node {
+	node := &Node{kind: "stage", fqname: name}
+	for i, state := range states {
+		fork := &Fork{
+			node:           node,
+			index:          i,
+			metadata:       NewMetadata(name, ""),
+			split_metadata: NewMetadata(name+".split", ""),
+			join_metadata:  NewMetadata(name+".join", ""),
+		}
+		if state != "" {
+			fork.metadata.contents[state] = true
+		}
+		node.forks = append(node.forks, fork)
+	}
+	node.state = node.getState()
+	return node
+}
+
+func TestProgress(t *testing.T) {
+	check := func(t *testing.T, expect float64, nodes ...*Node) {
+		t.Helper()
+		ps := &Pipestance{allNodesCache: nodes}
+		if p := ps.Progress(context.Background()); p != expect {
+			t.Errorf("Expected progress %v, got %v", expect, p)
+		}
+	}
+	t.Run("empty", func(t *testing.T) {
+		check(t, 1, []*Node{}...)
+	})
+	t.Run("forks", func(t *testing.T) {
+		// Ten complete forks of one stage and one incomplete fork of
+		// another count as one stage complete out of two.
+		check(t, 0.5,
+			progressTestNode("A",
+				CompleteFile, CompleteFile, CompleteFile, CompleteFile,
+				CompleteFile, CompleteFile, CompleteFile, CompleteFile,
+				CompleteFile, CompleteFile),
+			progressTestNode("B", ""))
+	})
+	t.Run("partial", func(t *testing.T) {
+		check(t, 0.25,
+			progressTestNode("A", CompleteFile, LogFile),
+			progressTestNode("B", LogFile))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		check(t, 0.5,
+			progressTestNode("A", CompleteFile, DisabledFile),
+			progressTestNode("B", DisabledFile),
+			progressTestNode("C", ""),
+			&Node{kind: "pipeline", state: Complete})
+		check(t, 1, progressTestNode("A", DisabledFile))
+	})
+}
+
+func TestJobProgress(t *testing.T) {
+	check := func(t *testing.T, expectDone, expectTotal int, expect float64,
+		nodes ...*Node) {
+		t.Helper()
+		ps := &Pipestance{allNodesCache: nodes}
+		done, total, p := ps.JobProgress(context.Background())
+		if p != expect {
+			t.Errorf("Expected progress %v, got %v", expect, p)
+		}
+		if done != expectDone || total != expectTotal {
+			t.Errorf("Expected %d of %d jobs complete, got %d of %d",
+				expectDone, expectTotal, done, total)
+		}
+	}
+	t.Run("empty", func(t *testing.T) {
+		check(t, 0, 0, 1, []*Node{}...)
+	})
+	t.Run("forks", func(t *testing.T) {
+		// Ten complete forks of one stage and one incomplete fork of
+		// another count as one stage complete out of two.
+		check(t, 10, 11, 0.5,
+			progressTestNode("A",
+				CompleteFile, CompleteFile, CompleteFile, CompleteFile,
+				CompleteFile, CompleteFile, CompleteFile, CompleteFile,
+				CompleteFile, CompleteFile),
+			progressTestNode("B", ""))
+	})
+	t.Run("partial", func(t *testing.T) {
+		check(t, 1, 3, 0.25,
+			progressTestNode("A", CompleteFile, LogFile),
+			progressTestNode("B", LogFile))
+	})
+	t.Run("chunks", func(t *testing.T) {
+		// Two of three chunks complete, plus the join.
+		node := progressTestNode("A", LogFile)
+		fork := node.forks[0]
+		for i, state := range []MetadataFileName{
+			CompleteFile, CompleteFile, LogFile,
+		} {
+			chunk := &Chunk{
+				fork:     fork,
+				index:    i,
+				metadata: NewMetadata("A.chnk", ""),
+			}
+			chunk.metadata.contents[state] = true
+			fork.chunks = append(fork.chunks, chunk)
+		}
+		node.state = node.getState()
+		check(t, 2, 5, 0.25, node, progressTestNode("B", LogFile))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		check(t, 1, 2, 0.5,
+			progressTestNode("A", CompleteFile, DisabledFile),
+			progressTestNode("B", DisabledFile),
+			progressTestNode("C", ""),
+			&Node{kind: "pipeline", state: Complete})
+		check(t, 0, 0, 1, progressTestNode("A", DisabledFile))
+	})
+}
+
+// Set the cached performance information for a node's forks, so that
+// its wall time runs from start to end.
+func setTestWallTime(node *Node, start time.Time, d time.Duration) *Node {
+	for _, fork := range node.forks {
+		fork.perfCache = &ForkPerfCache{
+			perfInfo: &ForkPerfInfo{
+				ForkStats: &PerfInfo{
+					Start: start,
+					End:   start.Add(d),
+				},
+			},
+		}
+	}
+	return node
+}
+
+func TestEstimatedTimeRemaining(t *testing.T) {
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	check := func(t *testing.T, expect time.Duration, nodes ...*Node) {
+		t.Helper()
+		ps := &Pipestance{allNodesCache: nodes}
+		if d := ps.EstimatedTimeRemaining(context.Background()); d != expect {
+			t.Errorf("Expected %v remaining, got %v", expect, d)
+		}
+	}
+	t.Run("no history", func(t *testing.T) {
+		check(t, -1, progressTestNode("A", ""))
+		// A stage with no job information has no wall time.
+		a := setTestWallTime(progressTestNode("A", CompleteFile), time.Time{}, 0)
+		check(t, -1, a, progressTestNode("B", ""))
+	})
+	t.Run("average", func(t *testing.T) {
+		// Forks of a stage count as one stage, from the start of the
+		// first fork to the end of the last.
+		a := progressTestNode("A", CompleteFile, CompleteFile)
+		setTestWallTime(a, start, time.Hour)
+		a.forks[1].perfCache.perfInfo.ForkStats.Start = start.Add(time.Hour)
+		a.forks[1].perfCache.perfInfo.ForkStats.End = start.Add(3 * time.Hour)
+		check(t, 4*time.Hour,
+			a,
+			setTestWallTime(progressTestNode("B", CompleteFile), start, time.Hour),
+			progressTestNode("C", ""),
+			progressTestNode("D", LogFile),
+			progressTestNode("E", DisabledFile),
+			&Node{kind: "pipeline", state: Running})
+	})
+	t.Run("done", func(t *testing.T) {
+		check(t, 0,
+			setTestWallTime(progressTestNode("A", CompleteFile), start, time.Hour))
+	})
+}
+
+func TestEstimateRemaining(t *testing.T) {
+	history := func(fqname string, d time.Duration) *NodePerfInfo {
+		start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		return &NodePerfInfo{
+			Fqname: fqname,
+			Type:   "stage",
+			Forks: []*ForkPerfInfo{{
+				ForkStats: &PerfInfo{
+					Start: start,
+					End:   start.Add(d),
+				},
+			}},
+		}
+	}
+	ps := &Pipestance{
+		node: &Node{rt: &Runtime{Config: &RuntimeOptions{
+			DefaultStageEstimate: 5 * time.Minute,
+		}}},
+		allNodesCache: []*Node{
+			progressTestNode("ID.now.PIPE.A", CompleteFile),
+			progressTestNode("ID.now.PIPE.B", LogFile),
+			progressTestNode("ID.now.PIPE.C", ""),
+			progressTestNode("ID.now.PIPE.D", DisabledFile),
+		},
+	}
+	// A is complete and D is disabled, so only B and C remain.  C is not
+	// in the history, so it gets the default.
+	if d := ps.EstimateRemaining([]*NodePerfInfo{
+		history("ID.old.PIPE.A", time.Hour),
+		history("ID.old.PIPE.B", 10*time.Minute),
+		history("ID.old.PIPE.D", time.Hour),
+	}); d != 15*time.Minute {
+		t.Errorf("Expected 15m remaining, got %v", d)
+	}
+	if d := ps.EstimateRemaining(nil); d != 10*time.Minute {
+		t.Errorf("Expected 10m remaining with no history, got %v", d)
+	}
+}
+
+func TestComputeCriticalPath(t *testing.T) {
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	node := func(name string, state MetadataFileName, pre ...*Node) *Node {
+		n := progressTestNode("ID.test.PIPE."+name, state)
+		n.prenodes = make(map[string]Nodable, len(pre))
+		for _, p := range pre {
+			n.prenodes[p.fqname] = p
+		}
+		return n
+	}
+	a := setTestWallTime(node("A", CompleteFile), start, time.Hour)
+	b := setTestWallTime(node("B", CompleteFile), start, 10*time.Minute)
+	c := node("C", "", a)
+	d := node("D", DisabledFile, b)
+	e := node("E", LogFile, c, d)
+	pipeline := &Node{
+		kind:     "pipeline",
+		fqname:   "ID.test.PIPE",
+		prenodes: map[string]Nodable{"ID.test.PIPE.E": e},
+	}
+	ps := &Pipestance{
+		node: &Node{rt: &Runtime{Config: &RuntimeOptions{
+			DefaultStageEstimate: 30 * time.Minute,
+		}}},
+		allNodesCache: []*Node{pipeline, e, d, c, b, a},
+	}
+	// A, then C and E with the default estimate, takes two hours, while
+	// B, then D and E, takes 40 minutes because D is disabled.
+	path := ps.ComputeCriticalPath(context.Background())
+	names := make([]string, len(path))
+	for i, n := range path {
+		names[i] = n.fqname
+	}
+	if s := strings.Join(names, " "); s != "ID.test.PIPE.A ID.test.PIPE.C ID.test.PIPE.E" {
+		t.Errorf("Incorrect critical path %s", s)
+	}
+
+	// If stages which have not run take no time, B outweighs A.  The
+	// disabled stage D is not on the path.
+	setTestWallTime(a, start, time.Minute)
+	ps.node.rt.Config.DefaultStageEstimate = 0
+	path = ps.ComputeCriticalPath(context.Background())
+	if len(path) != 2 || path[0] != b || path[1] != e {
+		t.Errorf("Expected B and E on the critical path, got %v", path)
+	}
+
+	ps.allNodesCache = []*Node{}
+	if path := ps.ComputeCriticalPath(context.Background()); len(path) != 0 {
+		t.Errorf("Expected no critical path, got %v", path)
+	}
+}
+
+func TestGetNodeByFQName(t *testing.T) {
+	a := &Node{kind: "stage", fqname: "ID.test.PIPE.A", state: Complete}
+	b := &Node{kind: "stage", fqname: "ID.test.PIPE.B", state: Failed}
+	ps := &Pipestance{allNodesCache: []*Node{a, b}}
+	if node, ok := ps.GetNodeByFQName("ID.test.PIPE.B"); !ok || node != b {
+		t.Errorf("Expected node B, got %v", node)
+	} else if node.State() != Failed {
+		t.Errorf("Expected failed, got %v", node.State())
+	}
+	if _, ok := ps.GetNodeByFQName("ID.test.PIPE.C"); ok {
+		t.Error("Expected no node C.")
+	}
+}
+
+func TestSerializeStateJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSerializeStateJSON")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newNode := func(name string) *Node {
+		return &Node{
+			kind:     "stage",
+			name:     name,
+			fqname:   "ID.test.PIPE." + name,
+			state:    Complete,
+			metadata: NewMetadata("ID.test.PIPE."+name, path.Join(dir, name)),
+		}
+	}
+	ps := &Pipestance{allNodesCache: []*Node{newNode("B"), newNode("A")}}
+	b, err := ps.SerializeStateJSON(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b)
+	if a, b := strings.Index(s, `"ID.test.PIPE.A"`),
+		strings.Index(s, `"ID.test.PIPE.B"`); a < 0 || b < a {
+		t.Errorf("Expected the nodes to be sorted by name:\n%s", s)
+	}
+	var prev string
+	for _, line := range strings.Split(s, "\n") {
+		if line == "    {" {
+			prev = ""
+		}
+		// Only check the keys of the node objects.
+		if !strings.HasPrefix(line, `        "`) {
+			continue
+		}
+		key := strings.SplitN(strings.TrimSpace(line), ":", 2)[0]
+		if key < prev {
+			t.Errorf("Expected %s before %s", key, prev)
+		}
+		prev = key
+	}
+	// The result is still a valid serialization of the state.
+	var nodes []*NodeInfo
+	if err := json.Unmarshal(b, &nodes); err != nil {
+		t.Error(err)
+	} else if len(nodes) != 2 || nodes[0].Name != "A" {
+		t.Errorf("Incorrect nodes %v", nodes)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	node := progressTestNode("ID.test.STAGE", CompleteFile)
+	node.state = Running
+	node.rt = &Runtime{Config: &RuntimeOptions{}}
+	node.frontierNodes = &threadSafeNodeMap{nodes: make(map[string]Nodable)}
+	// Don't step the forks.
+	node.paused = &pauseFlag{paused: true}
+	node.subscribers = new(nodeSubscribers)
+	ps := &Pipestance{node: node}
+
+	ch := make(chan NodeEvent, 1)
+	ps.Subscribe(ch)
+	if !node.step() {
+		t.Fatal("Expected the node state to change.")
+	}
+	select {
+	case event := <-ch:
+		if event.Fqname != "ID.test.STAGE" ||
+			event.OldState != Running || event.NewState != Complete {
+			t.Errorf("Incorrect event %v", event)
+		}
+		if event.Timestamp.IsZero() {
+			t.Error("Expected a timestamp.")
+		}
+	default:
+		t.Fatal("Expected an event.")
+	}
+	// No event is sent if the state did not change.
+	node.step()
+	select {
+	case event := <-ch:
+		t.Errorf("Unexpected event %v", event)
+	default:
+	}
+
+	if err := ps.Unsubscribe(ch); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("Expected the channel to be closed.")
+	}
+	if err := ps.Unsubscribe(ch); err == nil {
+		t.Error("Expected an error unsubscribing twice.")
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	pipeline := &Node{kind: "pipeline", fqname: "ID.test.PIPE", state: Running}
+	a := &Node{kind: "stage", fqname: "ID.test.PIPE.A", state: Complete}
+	b := &Node{kind: "stage", fqname: "ID.test.PIPE.B", state: Failed}
+	c := &Node{kind: "stage", fqname: "ID.test.PIPE.C", state: Waiting}
+	// Prenodes and post-nodes are usually symmetric, but edges from either
+	// are included.
+	a.postnodes = map[string]Nodable{b.fqname: b}
+	b.prenodes = map[string]Nodable{a.fqname: a}
+	b.postnodes = map[string]Nodable{c.fqname: c}
+	c.prenodes = map[string]Nodable{a.fqname: a}
+	ps := &Pipestance{allNodesCache: []*Node{pipeline, a, b, c}}
+	var buf bytes.Buffer
+	if err := ps.ExportDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const expect = `digraph pipestance {
+    node [shape=box];
+    "ID.test.PIPE" [label="ID.test.PIPE\nrunning", style="rounded,filled", fillcolor="#f9e79f"];
+    "ID.test.PIPE.A" [label="ID.test.PIPE.A\ncomplete", style="filled", fillcolor="#b7e1a1"];
+    "ID.test.PIPE.B" [label="ID.test.PIPE.B\nfailed", style="filled", fillcolor="#f4a6a6"];
+    "ID.test.PIPE.C" [label="ID.test.PIPE.C\nwaiting"];
+    "ID.test.PIPE.A" -> "ID.test.PIPE.B";
+    "ID.test.PIPE.A" -> "ID.test.PIPE.C";
+    "ID.test.PIPE.B" -> "ID.test.PIPE.C";
+}
+`
+	if s := buf.String(); s != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, s)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	a := &Node{kind: "stage", fqname: "ID.test.PIPE.A", state: Complete}
+	b := &Node{kind: "stage", fqname: "ID.test.PIPE.B", state: Running}
+	a.postnodes = map[string]Nodable{b.fqname: b}
+	b.prenodes = map[string]Nodable{a.fqname: a}
+	ps := &Pipestance{allNodesCache: []*Node{a, b}}
+	var buf bytes.Buffer
+	if err := ps.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const expect = `digraph pipestance {
+    node [shape=box];
+    "ID.test.PIPE.A" [label="ID.test.PIPE.A\ncomplete", style="filled", fillcolor="#b7e1a1"];
+    "ID.test.PIPE.B" [label="ID.test.PIPE.B\nrunning", style="filled", fillcolor="#f9e79f"];
+    "ID.test.PIPE.A" -> "ID.test.PIPE.B";
+}
+`
+	if s := buf.String(); s != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, s)
+	}
+}
+
+func TestResetNode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestResetNode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := retryTestNode(t, dir, RetryPolicy{})
+	ps := &Pipestance{
+		allNodesCache: []*Node{node},
+		metadata:      NewMetadata("ID.test", dir),
+	}
+	if err := ps.ResetNode(node.fqname); err == nil {
+		t.Error("Expected an error in read only mode.")
+	}
+	ps.metadata.contents[Lock] = true
+	if err := ps.ResetNode("ID.test.OTHER"); err == nil {
+		t.Error("Expected an error for an unknown node.")
+	}
+	if err := ps.ResetNode(node.fqname); err == nil {
+		t.Errorf("Expected an error resetting a %v node.", node.state)
+	}
+	if err := node.forks[0].metadata.WriteTime(CompleteFile); err != nil {
+		t.Fatal(err)
+	}
+	node.state = node.getState()
+	if node.state != Complete {
+		t.Fatalf("Expected complete, got %v", node.state)
+	}
+	if err := ps.ResetNode(node.fqname); err != nil {
+		t.Fatal(err)
+	}
+	if node.state == Complete || node.forks[0].metadata.exists(CompleteFile) {
+		t.Error("Expected the node to be reset.")
+	}
+}
+
+func TestFrontierNodePriority(t *testing.T) {
+	frontier := &threadSafeNodeMap{nodes: make(map[string]Nodable)}
+	for _, node := range []*Node{
+		{fqname: "ID.test.PIPE.C"},
+		{fqname: "ID.test.PIPE.A"},
+		{fqname: "ID.test.PIPE.URGENT", priority: 10},
+		{fqname: "ID.test.PIPE.LATER", priority: -1},
+		{fqname: "ID.test.PIPE.B"},
+	} {
+		frontier.Add(node.fqname, node)
+	}
+	var order []string
+	for _, node := range frontier.GetNodes() {
+		order = append(order, node.fqname)
+	}
+	expect := []string{
+		"ID.test.PIPE.URGENT",
+		"ID.test.PIPE.A",
+		"ID.test.PIPE.B",
+		"ID.test.PIPE.C",
+		"ID.test.PIPE.LATER",
+	}
+	if strings.Join(order, " ") != strings.Join(expect, " ") {
+		t.Errorf("Expected %v, got %v", expect, order)
+	}
+}
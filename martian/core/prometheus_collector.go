@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// +build prometheus
+
+// A Prometheus collector for the per-node metrics of a pipestance.
+//
+// This requires github.com/prometheus/client_golang, and is only built
+// with the prometheus build tag.
+
+package core
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type prometheusCollector struct {
+	ps          *Pipestance
+	state       *prometheus.Desc
+	starts      *prometheus.Desc
+	completions *prometheus.Desc
+	retries     *prometheus.Desc
+}
+
+// NewPrometheusCollector returns a collector which reports the state of each
+// node in a pipestance, and the number of jobs started and completed and the
+// number of retries for each stage.
+//
+// The metrics are computed from the pipestance's metadata each time they are
+// collected.
+func NewPrometheusCollector(ps *Pipestance) prometheus.Collector {
+	labels := []string{"psid", "fqname"}
+	return &prometheusCollector{
+		ps: ps,
+		state: prometheus.NewDesc(metricNodeState,
+			"Set to 1 for the state which the node is in, and 0 otherwise.",
+			[]string{"psid", "fqname", "state"}, nil),
+		starts: prometheus.NewDesc(metricStageStarts,
+			"Number of jobs started for the stage.", labels, nil),
+		completions: prometheus.NewDesc(metricStageCompletions,
+			"Number of jobs completed for the stage.", labels, nil),
+		retries: prometheus.NewDesc(metricStageRetries,
+			"Number of times the stage has been retried.", labels, nil),
+	}
+}
+
+func (self *prometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- self.state
+	ch <- self.starts
+	ch <- self.completions
+	ch <- self.retries
+}
+
+func (self *prometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	psid := self.ps.GetPsid()
+	for _, m := range collectNodeMetrics(self.ps) {
+		for _, state := range collectorStates {
+			v := 0.0
+			if state == m.state {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(self.state,
+				prometheus.GaugeValue, v, psid, m.fqname, string(state))
+		}
+		if !m.stage {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(self.starts,
+			prometheus.CounterValue, float64(m.starts), psid, m.fqname)
+		ch <- prometheus.MustNewConstMetric(self.completions,
+			prometheus.CounterValue, float64(m.completions), psid, m.fqname)
+		ch <- prometheus.MustNewConstMetric(self.retries,
+			prometheus.CounterValue, float64(m.retries), psid, m.fqname)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// +build prometheus
+
+package core
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	stage := progressTestNode("ID.test.PIPE.STAGE", "")
+	stage.metadata = NewMetadata(stage.fqname, "")
+	stage.state = Running
+	pipeline := &Node{kind: "pipeline", fqname: "ID.test.PIPE"}
+	ps := &Pipestance{
+		node: &Node{
+			parent: &TopNode{node: &Node{name: "test"}},
+		},
+		allNodesCache: []*Node{pipeline, stage},
+	}
+	collector := NewPrometheusCollector(ps)
+	descs := make(chan *prometheus.Desc, 10)
+	collector.Describe(descs)
+	close(descs)
+	if n := len(descs); n != 4 {
+		t.Errorf("Expected 4 descriptions, got %d", n)
+	}
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(collector); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int, len(families))
+	for _, family := range families {
+		counts[family.GetName()] = len(family.GetMetric())
+	}
+	// Each node is reported in each of 4 states, and the job counts are
+	// only reported for the stage.
+	for name, expect := range map[string]int{
+		metricNodeState:        8,
+		metricStageStarts:      1,
+		metricStageCompletions: 1,
+		metricStageRetries:     1,
+	} {
+		if counts[name] != expect {
+			t.Errorf("Expected %d %s metrics, got %d", expect, name, counts[name])
+		}
+	}
+}
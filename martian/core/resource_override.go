@@ -0,0 +1,143 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Resource overrides for stages, for working around stages which request
+// too few resources without editing the MRO.
+//
+// A resource override file might look like:
+//
+//	{
+//	    "ID.*.SORT_READS": {
+//	        "__mem_gb": 32
+//	    },
+//	    "ID.pipestance.PIPELINE.ALIGN": {
+//	        "__threads": 8,
+//	        "__mem_gb": 16
+//	    }
+//	}
+//
+// The keys are patterns, in the syntax used by path.Match, which are matched
+// against the fully qualified name of each stage.  If more than one pattern
+// matches a stage, the longest one is used.  Values which are present in the
+// override replace the values from the MRO or from the stage code for the
+// split, chunks, and join of the stage.
+//
+// The file is checked for changes before each step of the pipestance, so it
+// may be edited while the pipestance is running.  Jobs which were already
+// started are not affected.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+type resourceOverride struct {
+	pattern   string
+	resources JobResources
+}
+
+type resourceOverrides struct {
+	path string
+
+	lock      sync.Mutex
+	modTime   time.Time
+	overrides []resourceOverride
+}
+
+// Load the resource overrides from the given file.
+func newResourceOverrides(fn string) (*resourceOverrides, error) {
+	self := &resourceOverrides{path: fn}
+	return self, self.load()
+}
+
+// Parse the resource override file.
+func parseResourceOverrides(b []byte) ([]resourceOverride, error) {
+	var byPattern map[string]JobResources
+	if err := json.Unmarshal(b, &byPattern); err != nil {
+		return nil, err
+	}
+	overrides := make([]resourceOverride, 0, len(byPattern))
+	for pattern, res := range byPattern {
+		// Check the pattern syntax.
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, &RuntimeError{"invalid resource override pattern " + pattern}
+		}
+		overrides = append(overrides, resourceOverride{
+			pattern:   pattern,
+			resources: res,
+		})
+	}
+	// Check the most specific patterns first.
+	sort.Slice(overrides, func(i, j int) bool {
+		if len(overrides[i].pattern) != len(overrides[j].pattern) {
+			return len(overrides[i].pattern) > len(overrides[j].pattern)
+		}
+		return overrides[i].pattern < overrides[j].pattern
+	})
+	return overrides, nil
+}
+
+// Read the file, if it was modified since it was last read.
+func (self *resourceOverrides) load() error {
+	info, err := os.Stat(self.path)
+	if err != nil {
+		return err
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if info.ModTime().Equal(self.modTime) {
+		return nil
+	}
+	b, err := ioutil.ReadFile(self.path)
+	if err != nil {
+		return err
+	}
+	overrides, err := parseResourceOverrides(b)
+	if err != nil {
+		return err
+	}
+	self.modTime = info.ModTime()
+	self.overrides = overrides
+	util.LogInfo("override", "Loaded %d resource overrides from %s",
+		len(overrides), self.path)
+	return nil
+}
+
+// Re-read the file if it has changed.  If the file cannot be read, the
+// previous overrides remain in effect.
+func (self *resourceOverrides) reload() {
+	if self == nil {
+		return
+	}
+	if err := self.load(); err != nil {
+		util.LogError(err, "override",
+			"Could not reload resource overrides from %s", self.path)
+	}
+}
+
+// Get the resource override for the stage with the given fully qualified
+// name, or nil if there is none.
+func (self *resourceOverrides) get(fqname string) *JobResources {
+	if self == nil {
+		return nil
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for i := range self.overrides {
+		if ok, _ := path.Match(self.overrides[i].pattern, fqname); ok {
+			res := self.overrides[i].resources
+			return &res
+		}
+	}
+	return nil
+}
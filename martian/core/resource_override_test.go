@@ -0,0 +1,80 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestResourceOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestResourceOverrides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "resources.json")
+	if err := ioutil.WriteFile(fn, []byte(`{
+	"ID.*.SORT": {"__mem_gb": 32},
+	"ID.test.PIPE.SORT": {"__threads": 4, "__mem_gb": 16}
+}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ro, err := newResourceOverrides(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := ro.get("ID.test.PIPE.SORT"); res == nil {
+		t.Error("Expected an override.")
+	} else if res.Threads != 4 || res.MemGB != 16 {
+		t.Errorf("Expected the most specific override, got %v", res.ToMap())
+	}
+	if res := ro.get("ID.test.OTHER.SORT"); res == nil {
+		t.Error("Expected an override.")
+	} else if res.Threads != 0 || res.MemGB != 32 {
+		t.Errorf("Incorrect override %v", res.ToMap())
+	}
+	if res := ro.get("ID.test.PIPE.ALIGN"); res != nil {
+		t.Errorf("Expected no override, got %v", res.ToMap())
+	}
+
+	// Changes are picked up on reload.
+	if err := ioutil.WriteFile(fn, []byte(`{"ID.*": {"__gpus": 1}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(fn, later, later); err != nil {
+		t.Fatal(err)
+	}
+	ro.reload()
+	if res := ro.get("ID.test.PIPE.SORT"); res == nil || res.GPUs != 1 || res.MemGB != 0 {
+		t.Errorf("Expected the reloaded override, got %v", res)
+	}
+
+	// Invalid files leave the previous overrides in place.
+	if err := ioutil.WriteFile(fn, []byte(`{"ID.*": {"__gpus": "one"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(fn, later, later); err != nil {
+		t.Fatal(err)
+	}
+	ro.reload()
+	if res := ro.get("ID.test.PIPE.SORT"); res == nil || res.GPUs != 1 {
+		t.Errorf("Expected the previous override, got %v", res)
+	}
+
+	if _, err := parseResourceOverrides([]byte(`{"ID.[": {}}`)); err == nil {
+		t.Error("Expected an error for an invalid pattern.")
+	}
+
+	// A nil set of overrides has no overrides.
+	var none *resourceOverrides
+	none.reload()
+	if res := none.get("ID.test.PIPE.SORT"); res != nil {
+		t.Errorf("Expected no override, got %v", res)
+	}
+}
@@ -10,12 +10,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 	"runtime/trace"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -79,7 +81,7 @@ func ParseJobMode(data string) (string, string, string) {
 }
 
 func VerifyVDRMode(vdrMode string) {
-	validModes := []string{"rolling", "post", "disable"}
+	validModes := []string{"rolling", "post", "aggressive", "disable"}
 	for _, validMode := range validModes {
 		if validMode == vdrMode {
 			return
@@ -96,19 +98,24 @@ func VerifyOnFinish(onfinish string) {
 	}
 }
 
-// Reads config file for regexps which, when matched, indicate that
-// an error is likely transient.
-func getRetryRegexps() (retryOn []*regexp.Regexp, defaultRetries int) {
+type retryJson struct {
+	DefaultRetries int      `json:"default_retries"`
+	RetryOn        []string `json:"retry_on"`
+
+	// If true, jobs which exceed their stage timeout are retried.
+	RetryTimeouts bool `json:"retry_timeouts"`
+
+	// Patterns for cluster job submission errors which are likely
+	// transient.
+	SubmitRetryOn []string `json:"submit_retry_on"`
+}
+
+// Reads the retry config file, or returns nil if there is none.
+func readRetryConfig() *retryJson {
 	retryfile := util.RelPath(path.Join("..", "jobmanagers", "retry.json"))
 
 	if _, err := os.Stat(retryfile); os.IsNotExist(err) {
-		return []*regexp.Regexp{
-			regexp.MustCompile("^signal: "),
-		}, 0
-	}
-	type retryJson struct {
-		DefaultRetries int      `json:"default_retries"`
-		RetryOn        []string `json:"retry_on"`
+		return nil
 	}
 	bytes, err := ioutil.ReadFile(retryfile)
 	if err != nil {
@@ -120,10 +127,26 @@ func getRetryRegexps() (retryOn []*regexp.Regexp, defaultRetries int) {
 		util.PrintInfo("runtime", "Retry config file could not be parsed:\n%v\n", err)
 		os.Exit(1)
 	}
-	regexps := make([]*regexp.Regexp, len(retryInfo.RetryOn))
+	return retryInfo
+}
+
+// Reads config file for regexps which, when matched, indicate that
+// an error is likely transient.
+func getRetryRegexps() (retryOn []*regexp.Regexp, defaultRetries int) {
+	retryInfo := readRetryConfig()
+	if retryInfo == nil {
+		return []*regexp.Regexp{
+			regexp.MustCompile("^signal: "),
+		}, 0
+	}
+	regexps := make([]*regexp.Regexp, len(retryInfo.RetryOn), len(retryInfo.RetryOn)+1)
 	for i, exp := range retryInfo.RetryOn {
 		regexps[i] = regexp.MustCompile(exp)
 	}
+	if retryInfo.RetryTimeouts {
+		regexps = append(regexps,
+			regexp.MustCompile(regexp.QuoteMeta(timeoutErrorPrefix)))
+	}
 	return regexps, retryInfo.DefaultRetries
 }
 
@@ -143,7 +166,12 @@ type RuntimeOptions struct {
 	JobMode string
 
 	// The volatile disk recovery mode (required): either "post",
-	// "rolling", or "disable".
+	// "rolling", "aggressive", or "disable".
+	//
+	// In "aggressive" mode, every stage is treated as strictly volatile,
+	// ignoring retain annotations, so each output is removed as soon as the
+	// stages which consume it have completed.  The outputs of the top-level
+	// pipeline are still kept.
 	VdrMode string
 
 	// The profiling mode (required): "disable" or one of the available
@@ -167,14 +195,179 @@ type RuntimeOptions struct {
 	Overrides       *PipestanceOverrides
 	LimitLoadavg    bool
 	NeverLocal      bool
+
+	// If set, changes in the state of stages and pipelines are appended to
+	// this file as newline-delimited JSON.
+	StateLog string
+
+	// If true, InvokePipeline only checks that the pipeline could be
+	// invoked, and returns without writing any metadata.  This is a
+	// different kind of dry run from InvokePipelineDryRun, which returns an
+	// error if this is set.
+	DryRun bool
+
+	// If set, a StageFinishEvent is posted to this URL as JSON whenever a
+	// stage or pipeline completes or fails.
+	StageFinishWebhook string
+
+	// The time Pipestance.RunUntilComplete waits between steps when no
+	// progress was made, and the time Pipestance.WaitUntilComplete waits
+	// between refreshes.  If zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	// The wall time which Pipestance.EstimateRemaining and
+	// Pipestance.ComputeCriticalPath assume for stages which have no
+	// performance history.
+	DefaultStageEstimate time.Duration
+
+	// The policy for automatically retrying stages which fail with
+	// transient errors.
+	Retry RetryPolicy
+
+	// The maximum number of times to retry a cluster job submission which
+	// fails with an error matching one of the submit_retry_on patterns from
+	// retry.json.  The first retry waits SubmitRetryBackoff, or 5 seconds
+	// if that is zero, and the wait doubles for each subsequent retry.
+	MaxSubmitRetries   int
+	SubmitRetryBackoff time.Duration
+
+	// If true, each local job is run in a cgroup which limits its memory
+	// to its reservation, plus MemorySlack percent.  This requires Linux
+	// and permission to create cgroups.
+	LimitMemory bool
+	MemorySlack int
+
+	// If greater than zero, no more than this many stages are run at once,
+	// regardless of the resources they use.
+	MaxConcurrentStages int
+
+	// If greater than zero, no new jobs are started while the pipestance
+	// has this many jobs running, across all job managers.
+	MaxConcurrentJobs int
+
+	// If greater than zero, no new jobs are started if the total memory
+	// reserved by the jobs the pipestance has running would exceed this many
+	// GB, across all job managers.
+	MaxTotalMemGB int
+
+	// The maximum number of forks which a single stage or pipeline may have
+	// from the cross-product of its sweeps.  Zero means DefaultMaxForks, and
+	// a negative value means there is no limit.
+	MaxForks int
+
+	// Stages which declare disk_space_gb are not started if the free space
+	// in the pipestance directory, less the space declared by stages which
+	// are running, would fall below this many GB.
+	MinFreeDiskGB int
+
+	// If greater than zero, the memory and cpu usage of each local job is
+	// sampled at this interval while it runs, and the samples are included
+	// in the pipestance's performance information.
+	SampleInterval time.Duration
+
+	// If greater than zero, on SIGTERM the runtime waits up to this long
+	// for running local jobs to finish before unlocking the pipestance and
+	// exiting, rather than exiting immediately.  No new jobs are started
+	// while waiting.  Cluster jobs are left running either way.
+	DrainTimeout time.Duration
+
+	// If set, a span for each step of each node is exported to this
+	// OpenTelemetry collector endpoint, using OTLP over HTTP.  If the URL
+	// has no path, /v1/traces is used.
+	OTELExporter string
+
+	// If greater than zero, cluster job submissions are limited to this
+	// many per second, after an initial burst of up to SubmitBurst jobs.
+	SubmitRate  float64
+	SubmitBurst int
+
+	// If set, cluster job scripts are rendered from this Go text/template
+	// file, with a JobTemplateData, instead of the template for the job
+	// mode.  The job mode still determines the submission command.
+	JobTemplate string
+
+	// If set, this JSON file maps patterns for stage fully qualified names
+	// to resources which override those requested by the stage.  The file
+	// is re-read when it changes while the pipestance is running.
+	ResourceOverrideFile string
+
+	// If true, the metadata files for each node, other than small ones, are
+	// gzipped once the node completes.
+	CompressMetadata bool
+
+	// If set, messages logged by the runtime are sent to this logger, with
+	// attributes such as the fqname and state of the node where they are
+	// available, instead of being written to the log file.  A *slog.Logger
+	// may be used.
+	//
+	// Logging is process-wide, so this is installed with
+	// util.SetStructuredLogger when the runtime is created, and applies to
+	// every runtime in the process until it is replaced.  Creating a runtime
+	// with no logger leaves the current one in place; call
+	// util.SetStructuredLogger(nil) to restore logging to the log file.
+	Logger util.StructuredLogger
+}
+
+// Controls automatic retry of stages which failed with an error which
+// matches one of the transient error patterns from retry.json.
+type RetryPolicy struct {
+	// The maximum number of times to retry a stage.  If zero, stages are
+	// never retried automatically.
+	MaxAttempts int
+
+	// The time to wait before the first retry of a stage.
+	Backoff time.Duration
+
+	// The factor by which the wait increases for each subsequent attempt.
+	// If zero, the wait is doubled.
+	BackoffFactor float64
+
+	// The maximum number of times to re-queue a stage whose job was
+	// preempted, which is not counted against MaxAttempts.  If zero,
+	// defaultMaxPreemptions is used.  If negative, preempted stages are
+	// re-queued without limit.
+	MaxPreemptions int
 }
 
+// The number of times a preempted stage is re-queued if the policy does not
+// say otherwise.
+const defaultMaxPreemptions = 3
+
+// Get the maximum number of times to re-queue a preempted stage, or a
+// negative number if there is no limit.
+func (policy *RetryPolicy) maxPreemptions() int {
+	if policy.MaxPreemptions == 0 {
+		return defaultMaxPreemptions
+	}
+	return policy.MaxPreemptions
+}
+
+// Get the time to wait before retrying a stage which has already been
+// retried the given number of times.
+func (policy *RetryPolicy) delay(attempts int) time.Duration {
+	factor := policy.BackoffFactor
+	if factor == 0 {
+		factor = 2
+	}
+	return time.Duration(float64(policy.Backoff) *
+		math.Pow(factor, float64(attempts)))
+}
+
+// The default limit on the number of forks of a node, if
+// RuntimeOptions.MaxForks is not set.
+const DefaultMaxForks = 10000
+
+// The default time to wait between steps of a pipestance when no progress
+// was made, which is the same as mrp uses.
+const DefaultPollInterval = 3 * time.Second
+
 func DefaultRuntimeOptions() RuntimeOptions {
 	return RuntimeOptions{
 		MartianVersion: util.GetVersion(),
 		ProfileMode:    DisableProfile,
 		JobMode:        "local",
 		VdrMode:        "rolling",
+		MemorySlack:    10,
 	}
 }
 
@@ -211,12 +404,41 @@ func (config *RuntimeOptions) ToFlags() []string {
 		flags = append(flags, fmt.Sprintf("--jobinterval=%d",
 			config.JobFreqMillis))
 	}
+	if config.JobTemplate != "" {
+		if p, err := filepath.Abs(config.JobTemplate); err == nil {
+			flags = append(flags, "--jobtemplate="+p)
+		} else {
+			flags = append(flags, "--jobtemplate="+config.JobTemplate)
+		}
+	}
+	if config.SubmitRate > 0 {
+		flags = append(flags, fmt.Sprintf("--submit-rate=%g",
+			config.SubmitRate))
+		if config.SubmitBurst != 0 {
+			flags = append(flags, fmt.Sprintf("--submit-burst=%d",
+				config.SubmitBurst))
+		}
+	}
+	if config.MaxSubmitRetries > 0 {
+		flags = append(flags, fmt.Sprintf("--submit-retries=%d",
+			config.MaxSubmitRetries))
+	}
 	if config.StackVars {
 		flags = append(flags, "--stackvars")
 	}
 	if config.Zip {
 		flags = append(flags, "--zip")
 	}
+	if config.CompressMetadata {
+		flags = append(flags, "--compress-metadata")
+	}
+	if config.ResourceOverrideFile != "" {
+		if p, err := filepath.Abs(config.ResourceOverrideFile); err == nil {
+			flags = append(flags, "--resource-overrides="+p)
+		} else {
+			flags = append(flags, "--resource-overrides="+config.ResourceOverrideFile)
+		}
+	}
 	if config.SkipPreflight {
 		flags = append(flags, "--nopreflight")
 	}
@@ -248,19 +470,77 @@ func (config *RuntimeOptions) ToFlags() []string {
 	if config.NeverLocal {
 		flags = append(flags, "--never-local")
 	}
+	if config.LimitMemory {
+		flags = append(flags, "--limit-memory",
+			fmt.Sprintf("--memory-slack=%d", config.MemorySlack))
+	}
+	if config.MaxConcurrentStages > 0 {
+		flags = append(flags, fmt.Sprintf("--maxstages=%d",
+			config.MaxConcurrentStages))
+	}
+	if config.MaxConcurrentJobs > 0 {
+		flags = append(flags, fmt.Sprintf("--maxrunning=%d",
+			config.MaxConcurrentJobs))
+	}
+	if config.MaxTotalMemGB > 0 {
+		flags = append(flags, fmt.Sprintf("--maxtotalmem=%d",
+			config.MaxTotalMemGB))
+	}
+	if config.MaxForks != 0 {
+		flags = append(flags, fmt.Sprintf("--maxforks=%d",
+			config.MaxForks))
+	}
+	if config.MinFreeDiskGB > 0 {
+		flags = append(flags, fmt.Sprintf("--min-free-disk=%d",
+			config.MinFreeDiskGB))
+	}
+	if config.SampleInterval > 0 {
+		flags = append(flags, fmt.Sprintf("--sample-interval=%d",
+			int(config.SampleInterval/time.Second)))
+	}
+	if config.DrainTimeout > 0 {
+		flags = append(flags, fmt.Sprintf("--drain-timeout=%d",
+			int(config.DrainTimeout/time.Second)))
+	}
+	if config.OTELExporter != "" {
+		flags = append(flags, "--otel-exporter="+config.OTELExporter)
+	}
+	if config.StageFinishWebhook != "" {
+		flags = append(flags, "--webhook="+config.StageFinishWebhook)
+	}
+	if config.StateLog != "" {
+		if p, err := filepath.Abs(config.StateLog); err == nil {
+			flags = append(flags, "--state-log="+p)
+		} else {
+			flags = append(flags, "--state-log="+config.StateLog)
+		}
+	}
 	return flags
 }
 
 // Collects configuration and state required to initialize and run pipestances
 // and stagestances.
 type Runtime struct {
-	Config          *RuntimeOptions
-	adaptersPath    string
-	mrjob           string
-	MroCache        *MroCache
-	JobManager      JobManager
-	LocalJobManager *LocalJobManager
-	overrides       *PipestanceOverrides
+	Config           *RuntimeOptions
+	adaptersPath     string
+	mrjob            string
+	MroCache         *MroCache
+	JobManager       JobManager
+	LocalJobManager  *LocalJobManager
+	overrides        *PipestanceOverrides
+	resOverrides     *resourceOverrides
+	diskReservations *diskReservations
+	stageLimiter     *stageLimiter
+	jobBudget        *jobBudget
+	validators       []Validator
+	stateLog         *stateLog
+	tracer           *spanExporter
+
+	// If set, the runtime cannot create, run, or modify pipestances.
+	readOnly bool
+
+	// Metrics for monitoring the runtime.
+	Metrics *MetricsRegistry
 }
 
 // Deprecated: use RuntimeConfig.NewRuntime() instead
@@ -304,17 +584,58 @@ func (c *RuntimeOptions) NewRuntime() *Runtime {
 		Config:       c,
 		adaptersPath: util.RelPath(path.Join("..", "adapters")),
 		mrjob:        util.RelPath("mrjob"),
+		Metrics:      NewMetricsRegistry(),
+	}
+
+	// The logger is process-wide, so only replace it if one was given.
+	if c.Logger != nil {
+		util.SetStructuredLogger(c.Logger)
 	}
 
 	self.MroCache = NewMroCache()
+	self.diskReservations = newDiskReservations(c.MinFreeDiskGB)
+	self.stageLimiter = newStageLimiter(c.MaxConcurrentStages)
+	self.jobBudget = newJobBudget(c.MaxConcurrentJobs, c.MaxTotalMemGB)
 	self.LocalJobManager = NewLocalJobManager(c.LocalCores, c.LocalMem, c.Debug,
 		c.LimitLoadavg,
 		c.JobMode != "local")
+	if c.LimitMemory {
+		if err := self.LocalJobManager.limitMemory(c.MemorySlack); err != nil {
+			util.PrintError(err, "jobmngr",
+				"WARNING: Could not set up cgroups.  Job memory will not be limited.")
+		}
+	}
+	if c.SampleInterval > 0 {
+		self.LocalJobManager.sampleJobs(c.SampleInterval)
+	}
 	if c.JobMode == "local" {
 		self.JobManager = self.LocalJobManager
+	} else if c.JobMode == K8sJobMode {
+		if jm, err := NewKubernetesJobManager(c.MemPerCore, c.MaxJobs,
+			c.JobFreqMillis, c.Debug); err != nil {
+			util.PrintError(err, "jobmngr", "Could not start the Kubernetes job manager.")
+			os.Exit(1)
+		} else {
+			self.JobManager = jm
+		}
+	} else if c.JobMode == BatchJobMode {
+		if jm, err := NewAWSBatchJobManager(c.MemPerCore, c.MaxJobs,
+			c.JobFreqMillis, c.ResourceSpecial, c.Debug); err != nil {
+			util.PrintError(err, "jobmngr", "Could not start the AWS Batch job manager.")
+			os.Exit(1)
+		} else {
+			self.JobManager = jm
+		}
 	} else {
-		self.JobManager = NewRemoteJobManager(c.JobMode, c.MemPerCore, c.MaxJobs,
-			c.JobFreqMillis, c.ResourceSpecial, c.Debug)
+		jm := newRemoteJobManager(c.JobMode, c.MemPerCore, c.MaxJobs,
+			c.JobFreqMillis, c.ResourceSpecial, c.JobTemplate, c.Debug)
+		if c.SubmitRate > 0 {
+			jm.limitSubmitRate(c.SubmitRate, c.SubmitBurst)
+		}
+		if c.MaxSubmitRetries > 0 {
+			jm.retrySubmissions(c.MaxSubmitRetries, c.SubmitRetryBackoff)
+		}
+		self.JobManager = jm
 	}
 	VerifyVDRMode(c.VdrMode)
 	VerifyProfileMode(c.ProfileMode)
@@ -325,6 +646,53 @@ func (c *RuntimeOptions) NewRuntime() *Runtime {
 		self.overrides = c.Overrides
 	}
 
+	if c.ResourceOverrideFile != "" {
+		if ro, err := newResourceOverrides(c.ResourceOverrideFile); err != nil {
+			util.PrintError(err, "runtime",
+				"Could not load resource overrides from %s",
+				c.ResourceOverrideFile)
+			os.Exit(1)
+		} else {
+			self.resOverrides = ro
+		}
+	}
+
+	if c.StateLog != "" {
+		if log, err := openStateLog(c.StateLog); err != nil {
+			util.PrintError(err, "runtime",
+				"Could not open state log %s", c.StateLog)
+		} else {
+			self.stateLog = log
+		}
+	}
+
+	if c.OTELExporter != "" {
+		if tracer, err := newSpanExporter(c.OTELExporter); err != nil {
+			util.PrintError(err, "runtime",
+				"Could not configure OpenTelemetry exporter %s", c.OTELExporter)
+		} else {
+			self.tracer = tracer
+		}
+	}
+
+	return self
+}
+
+// Creates a runtime which can only be used to inspect existing pipestances,
+// for example for a dashboard.  Operations which would create or modify a
+// pipestance return ErrReadOnly.
+//
+// Options which would have the runtime write files, or start jobs, are
+// ignored.
+func NewReadOnlyRuntime(config RuntimeOptions) *Runtime {
+	config.JobMode = "local"
+	config.LimitMemory = false
+	config.SampleInterval = 0
+	config.StateLog = ""
+	config.OTELExporter = ""
+	config.StageFinishWebhook = ""
+	self := config.NewRuntime()
+	self.readOnly = true
 	return self
 }
 
@@ -335,14 +703,10 @@ func CompileAll(mroPaths []string, checkSrcPath bool) (int, []*syntax.Ast, error
 		fpaths, _ := filepath.Glob(mroPath + "/[^_]*.mro")
 		fileNames = append(fileNames, fpaths...)
 	}
-	asts := make([]*syntax.Ast, 0, len(fileNames))
 	var parser syntax.Parser
-	for _, fpath := range fileNames {
-		if _, _, ast, err := parser.Compile(fpath, mroPaths, checkSrcPath); err != nil {
-			return 0, nil, err
-		} else {
-			asts = append(asts, ast)
-		}
+	asts, err := parser.CompileAll(fileNames, mroPaths, checkSrcPath)
+	if err != nil {
+		return 0, nil, err
 	}
 	return len(fileNames), asts, nil
 }
@@ -356,8 +720,39 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 	ctx context.Context) (string, *syntax.Ast, *Pipestance, error) {
 	r := trace.StartRegion(ctx, "instantiatePipeline")
 	defer r.End()
+	// Instantiate the pipeline.
+	if !readOnly {
+		if err := CheckMinimalSpace(pipestancePath); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	postsrc, ast, pipestance, err := self.buildPipestance(src, srcPath, psid,
+		pipestancePath, mroPaths, mroVersion, envs, !readOnly)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	// Lock the pipestance if not in read-only mode.
+	if readOnly {
+		pipestance.attachedReadOnly = true
+		return postsrc, ast, pipestance, nil
+	}
+	if err := pipestance.Lock(); err != nil {
+		return "", nil, nil, err
+	}
+
+	pipestance.getNode().mkdirs()
+
+	return postsrc, ast, pipestance, nil
+}
+
+// Parse the invocation source and build the pipestance's node tree, without
+// writing anything to disk.
+func (self *Runtime) buildPipestance(src string, srcPath string, psid string,
+	pipestancePath string, mroPaths []string, mroVersion string,
+	envs map[string]string, checkSrc bool) (string, *syntax.Ast, *Pipestance, error) {
 	// Parse the invocation source.
-	postsrc, incpaths, ast, err := syntax.ParseSource(src, srcPath, mroPaths, !readOnly)
+	postsrc, incpaths, ast, err := syntax.ParseSource(src, srcPath, mroPaths, checkSrc)
 	if err != nil {
 		return "", nil, nil, err
 	}
@@ -373,27 +768,11 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 
 	invocationData, _ := BuildDataForAst(incpaths, ast)
 
-	// Instantiate the pipeline.
-	if !readOnly {
-		if err := CheckMinimalSpace(pipestancePath); err != nil {
-			return "", nil, nil, err
-		}
-	}
 	pipestance, err := NewPipestance(NewTopNode(self, psid, pipestancePath, mroPaths, mroVersion, envs, invocationData),
 		ast.Call, ast.Callables)
 	if err != nil {
 		return "", nil, nil, err
 	}
-
-	// Lock the pipestance if not in read-only mode.
-	if !readOnly {
-		if err := pipestance.Lock(); err != nil {
-			return "", nil, nil, err
-		}
-	}
-
-	pipestance.getNode().mkdirs()
-
 	return postsrc, ast, pipestance, nil
 }
 
@@ -401,6 +780,41 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 func (self *Runtime) InvokePipeline(src string, srcPath string, psid string,
 	pipestancePath string, mroPaths []string, mroVersion string,
 	envs map[string]string, tags []string) (*Pipestance, error) {
+	return self.invokePipeline(src, srcPath, psid, pipestancePath,
+		mroPaths, mroVersion, envs, tags, false)
+}
+
+// Invokes a new pipestance which plans the stages it would run without
+// running any stage code.
+//
+// The pipestance is created as for InvokePipeline, but as its nodes are
+// stepped each stage reports the job it would run, with the resolved
+// arguments and resources, and then completes with null outputs.  Binding
+// and resource errors are thus found without running any jobs, and the
+// resulting plan can be inspected with SerializeState.
+func (self *Runtime) InvokePipelineDryRun(src string, srcPath string, psid string,
+	pipestancePath string, mroPaths []string, mroVersion string,
+	envs map[string]string, tags []string) (*Pipestance, error) {
+	return self.invokePipeline(src, srcPath, psid, pipestancePath,
+		mroPaths, mroVersion, envs, tags, true)
+}
+
+func (self *Runtime) invokePipeline(src string, srcPath string, psid string,
+	pipestancePath string, mroPaths []string, mroVersion string,
+	envs map[string]string, tags []string, dryRun bool) (*Pipestance, error) {
+
+	if self.Config.DryRun {
+		if dryRun {
+			return nil, &RuntimeError{
+				"cannot plan a dry run when the runtime is configured " +
+					"only to validate invocations"}
+		}
+		return self.validatePipeline(src, srcPath, psid, pipestancePath,
+			mroPaths, mroVersion, envs)
+	}
+	if self.readOnly {
+		return nil, ErrReadOnly
+	}
 
 	// Error if pipestance directory is non-empty, otherwise create.
 	if err := os.MkdirAll(pipestancePath, 0777); err != nil {
@@ -432,6 +846,7 @@ func (self *Runtime) InvokePipeline(src string, srcPath string, psid string,
 		Pipelines: mroVersion,
 	})
 	pipestance.metadata.Write(TagsFile, tags)
+	pipestance.metadata.WriteRaw(MetadataVer, strconv.Itoa(MetadataVersion))
 	if uid := os.Getenv("MRO_FORCE_UUID"); uid == "" {
 		pipestance.SetUuid(uuid.NewV4().String())
 	} else {
@@ -439,10 +854,71 @@ func (self *Runtime) InvokePipeline(src string, srcPath string, psid string,
 		pipestance.SetUuid(uid)
 	}
 	pipestance.metadata.WriteRaw(TimestampFile, "start: "+util.Timestamp())
+	if dryRun {
+		pipestance.setDryRun()
+	}
 
 	return pipestance, nil
 }
 
+// Check that a pipestance could be invoked, without creating it.
+//
+// The invocation is parsed and compiled, checking that stage source paths
+// exist, and the node tree is built, which checks the bindings.  Nothing is
+// written to the pipestance directory.  The returned pipestance is not
+// locked and cannot be run.
+func (self *Runtime) validatePipeline(src string, srcPath string, psid string,
+	pipestancePath string, mroPaths []string, mroVersion string,
+	envs map[string]string) (*Pipestance, error) {
+	if fileNames, err := util.Readdirnames(pipestancePath); err == nil &&
+		len(fileNames) > 0 {
+		return nil, &PipestanceExistsError{psid}
+	}
+	_, _, pipestance, err := self.buildPipestance(os.ExpandEnv(src), srcPath,
+		psid, pipestancePath, mroPaths, mroVersion, envs, true)
+	return pipestance, err
+}
+
+// ValidateInvocation checks that the call statement in the given invocation
+// source binds every required input of the callable, with a value of the
+// right type, without creating a pipestance or checking stage source paths.
+//
+// A non-nil result is a syntax.ErrorList of all of the problems found, so
+// that a caller can report each of them.
+func (self *Runtime) ValidateInvocation(src string, mroPaths []string) error {
+	_, _, ast, err := syntax.ParseSource(os.ExpandEnv(src), "",
+		mroPaths, false)
+	if err != nil {
+		if errs, ok := err.(syntax.ErrorList); ok {
+			return errs
+		}
+		return syntax.ErrorList{err}
+	}
+	if ast.Call == nil {
+		return syntax.ErrorList{
+			&RuntimeError{"cannot start a pipeline without a call statement"},
+		}
+	}
+	return nil
+}
+
+// Wait up to the configured drain timeout for running local jobs to finish.
+// Called when the process is terminated, so that a restarted mrp does not
+// need to rerun them.
+func (self *Runtime) drainLocalJobs() {
+	if self.Config.DrainTimeout <= 0 || self.LocalJobManager == nil {
+		return
+	}
+	util.PrintInfo("runtime",
+		"Waiting up to %v for running local jobs to finish.",
+		self.Config.DrainTimeout)
+	if !self.LocalJobManager.drain(self.Config.DrainTimeout) {
+		util.PrintInfo("runtime",
+			"Some local jobs were still running after %v.",
+			self.Config.DrainTimeout)
+	}
+}
+
 func (self *Runtime) ReattachToPipestance(psid string, pipestancePath string,
 	src string, invocationPath string, mroPaths []string,
 	mroVersion string, envs map[string]string, checkSrc bool, readOnly bool,
@@ -464,11 +940,32 @@ func (self *Runtime) ReattachToPipestanceWithMroSrc(psid string, pipestancePath
 		readOnly, MroSourceFile, ctx)
 }
 
+// Attaches to an existing pipestance to inspect it, without locking it or
+// writing anything to its directory, and loads its metadata.  The
+// pipestance is built from the MRO source recorded in the pipestance, so
+// the include paths do not need to be available.
+//
+// The pipestance may be running in another process.  Call RefreshState and
+// LoadMetadata to see updates.
+func (self *Runtime) AttachReadOnly(psid, pipestancePath string) (*Pipestance, error) {
+	ctx := context.Background()
+	ps, err := self.reattachToPipestance(psid, pipestancePath,
+		"", "", nil, "", nil, false, true, MroSourceFile, ctx)
+	if err != nil {
+		return nil, err
+	}
+	ps.LoadMetadata(ctx)
+	return ps, nil
+}
+
 // Reattaches to an existing pipestance.
 func (self *Runtime) reattachToPipestance(psid string, pipestancePath string,
 	src string, invocationPath string, mroPaths []string,
 	mroVersion string, envs map[string]string, checkSrc bool, readOnly bool,
 	srcType MetadataFileName, ctx context.Context) (*Pipestance, error) {
+	if self.readOnly && !readOnly {
+		return nil, ErrReadOnly
+	}
 
 	if src == "" {
 		if invocationPath == "" {
@@ -523,8 +1020,15 @@ func (self *Runtime) reattachToPipestance(psid string, pipestancePath string,
 	}
 
 	// If _metadata exists, unzip it so the pipestance can read its metadata.
+	// In read-only mode, the metadata is read from the archive instead.
 	metadataPath := path.Join(pipestancePath, MetadataZip.FileName())
-	if _, err := os.Stat(metadataPath); err == nil {
+	if _, err := os.Stat(metadataPath); err == nil && readOnly {
+		archive, err := readMetadataArchive(metadataPath)
+		if err != nil {
+			return nil, err
+		}
+		pipestance.useMetadataArchive(archive)
+	} else if err == nil {
 		if err := util.UnzipIgnoreExisting(metadataPath); err != nil {
 			pipestance.Unlock()
 			return nil, err
@@ -532,6 +1036,15 @@ func (self *Runtime) reattachToPipestance(psid string, pipestancePath string,
 		os.Remove(metadataPath)
 	}
 
+	// Make sure this version of Martian can read the metadata, upgrading
+	// it from older versions if possible.
+	if err := pipestance.VerifyMetadataVersion(readOnly); err != nil {
+		if !readOnly {
+			pipestance.Unlock()
+		}
+		return nil, err
+	}
+
 	// If we're reattaching in local mode, restart any stages that were
 	// left in a running state from last mrp run. The actual job would
 	// have been killed by the CTRL-C or, if not, by SIGTERM when the
@@ -585,7 +1098,7 @@ func (self *Runtime) GetMetadata(pipestancePath string, metadataPath string) (st
 			}
 		}
 	}
-	data, err := ioutil.ReadFile(metadataPath)
+	data, err := ReadMetadataFile(metadataPath)
 	if err != nil {
 		return "", err
 	}
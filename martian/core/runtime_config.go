@@ -0,0 +1,276 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Loading of runtime options from YAML or TOML configuration files.
+
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type configSetter func(config *RuntimeOptions, value string) error
+
+func configString(field func(*RuntimeOptions) *string) configSetter {
+	return func(config *RuntimeOptions, value string) error {
+		*field(config) = value
+		return nil
+	}
+}
+
+func configInt(field func(*RuntimeOptions) *int) configSetter {
+	return func(config *RuntimeOptions, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = i
+		return nil
+	}
+}
+
+func configBool(field func(*RuntimeOptions) *bool) configSetter {
+	return func(config *RuntimeOptions, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = b
+		return nil
+	}
+}
+
+// The options which may be set from a configuration file, keyed by the
+// name of the corresponding mrp flag.
+var configSetters = map[string]configSetter{
+	"jobmode": configString(func(c *RuntimeOptions) *string { return &c.JobMode }),
+	"vdrmode": configString(func(c *RuntimeOptions) *string { return &c.VdrMode }),
+	"profile": func(config *RuntimeOptions, value string) error {
+		config.ProfileMode = ProfileMode(value)
+		return nil
+	},
+	"localcores":    configInt(func(c *RuntimeOptions) *int { return &c.LocalCores }),
+	"localmem":      configInt(func(c *RuntimeOptions) *int { return &c.LocalMem }),
+	"mempercore":    configInt(func(c *RuntimeOptions) *int { return &c.MemPerCore }),
+	"maxjobs":       configInt(func(c *RuntimeOptions) *int { return &c.MaxJobs }),
+	"maxstages":     configInt(func(c *RuntimeOptions) *int { return &c.MaxConcurrentStages }),
+	"maxrunning":    configInt(func(c *RuntimeOptions) *int { return &c.MaxConcurrentJobs }),
+	"maxtotalmem":   configInt(func(c *RuntimeOptions) *int { return &c.MaxTotalMemGB }),
+	"maxforks":      configInt(func(c *RuntimeOptions) *int { return &c.MaxForks }),
+	"jobinterval":   configInt(func(c *RuntimeOptions) *int { return &c.JobFreqMillis }),
+	"jobtemplate":   configString(func(c *RuntimeOptions) *string { return &c.JobTemplate }),
+	"submit-burst":  configInt(func(c *RuntimeOptions) *int { return &c.SubmitBurst }),
+	"memory-slack":  configInt(func(c *RuntimeOptions) *int { return &c.MemorySlack }),
+	"limit-loadavg": configBool(func(c *RuntimeOptions) *bool { return &c.LimitLoadavg }),
+	"limit-memory":  configBool(func(c *RuntimeOptions) *bool { return &c.LimitMemory }),
+	"never-local":   configBool(func(c *RuntimeOptions) *bool { return &c.NeverLocal }),
+	"nopreflight":   configBool(func(c *RuntimeOptions) *bool { return &c.SkipPreflight }),
+	"stackvars":     configBool(func(c *RuntimeOptions) *bool { return &c.StackVars }),
+	"zip":           configBool(func(c *RuntimeOptions) *bool { return &c.Zip }),
+	"monitor":       configBool(func(c *RuntimeOptions) *bool { return &c.Monitor }),
+	"debug":         configBool(func(c *RuntimeOptions) *bool { return &c.Debug }),
+	"stest":         configBool(func(c *RuntimeOptions) *bool { return &c.StressTest }),
+	"onfinish":      configString(func(c *RuntimeOptions) *string { return &c.OnFinishHandler }),
+	"state-log":     configString(func(c *RuntimeOptions) *string { return &c.StateLog }),
+	"webhook":       configString(func(c *RuntimeOptions) *string { return &c.StageFinishWebhook }),
+	"otel-exporter": configString(func(c *RuntimeOptions) *string { return &c.OTELExporter }),
+	"compress-metadata": configBool(func(c *RuntimeOptions) *bool {
+		return &c.CompressMetadata
+	}),
+	"resource-overrides": configString(func(c *RuntimeOptions) *string {
+		return &c.ResourceOverrideFile
+	}),
+	"submit-retries": configInt(func(c *RuntimeOptions) *int {
+		return &c.MaxSubmitRetries
+	}),
+	"min-free-disk": configInt(func(c *RuntimeOptions) *int {
+		return &c.MinFreeDiskGB
+	}),
+	"submit-rate": func(config *RuntimeOptions, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		config.SubmitRate = f
+		return nil
+	},
+	"sample-interval": func(config *RuntimeOptions, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		config.SampleInterval = time.Duration(i) * time.Second
+		return nil
+	},
+	"drain-timeout": func(config *RuntimeOptions, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		config.DrainTimeout = time.Duration(i) * time.Second
+		return nil
+	},
+	"overrides": func(config *RuntimeOptions, value string) error {
+		overrides, err := ReadOverrides(value)
+		if err != nil {
+			return err
+		}
+		config.Overrides = overrides
+		return nil
+	},
+}
+
+// Load options from a YAML or TOML file, depending on the file extension.
+//
+// Only top-level scalar values are supported.  The keys are the names of
+// the corresponding mrp flags, for example
+//
+//	jobmode: sge
+//	maxjobs: 200
+//	limit-loadavg: true
+//
+// or, in TOML,
+//
+//	jobmode = "sge"
+//	maxjobs = 200
+//	limit-loadavg = true
+//
+// Underscores may be used in place of dashes in keys.  Options which are
+// not present in the file keep their current values, so the file is
+// normally loaded into the result of DefaultRuntimeOptions.
+func (config *RuntimeOptions) LoadFromFile(path string) error {
+	var sep string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		sep = ":"
+	case ".toml":
+		sep = "="
+	default:
+		return fmt.Errorf(
+			"unrecognized config file extension for %s: expected .yaml, .yml, or .toml",
+			path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	values, err := parseConfigFile(f, sep)
+	if err != nil {
+		return fmt.Errorf("%s:%v", path, err)
+	}
+	for _, kv := range values {
+		setter := configSetters[kv.key]
+		if setter == nil {
+			return fmt.Errorf("%s:%d: unknown option %q", path, kv.line, kv.key)
+		}
+		if err := setter(config, kv.value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value for %s: %v",
+				path, kv.line, kv.key, err)
+		}
+	}
+	return nil
+}
+
+type configValue struct {
+	key, value string
+	line       int
+}
+
+// Parse a flat list of "key<sep>value" pairs.  Comments start with '#',
+// and values may be quoted.  Errors are prefixed with the line number.
+func parseConfigFile(r io.Reader, sep string) ([]configValue, error) {
+	var values []configValue
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' || trimmed == "---" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' ||
+			trimmed[0] == '[' || strings.HasPrefix(trimmed, "- ") {
+			return values, fmt.Errorf(
+				"%d: only top-level key%svalue options are supported",
+				lineNum, sep)
+		}
+		idx := strings.Index(trimmed, sep)
+		if idx <= 0 {
+			return values, fmt.Errorf("%d: expected key%svalue", lineNum, sep)
+		}
+		key := strings.TrimSpace(trimmed[:idx])
+		value, err := parseConfigValue(strings.TrimSpace(trimmed[idx+1:]))
+		if err != nil {
+			return values, fmt.Errorf("%d: %v", lineNum, err)
+		}
+		values = append(values, configValue{
+			key:   strings.Replace(unquoteConfigKey(key), "_", "-", -1),
+			value: value,
+			line:  lineNum,
+		})
+	}
+	return values, scanner.Err()
+}
+
+func unquoteConfigKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') &&
+		key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
+// Parse a scalar value, removing quotes and any trailing comment.
+func parseConfigValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch value[0] {
+	case '"':
+		// Find the closing quote, skipping escaped characters.
+		for i := 1; i < len(value); i++ {
+			if value[i] == '\\' {
+				i++
+			} else if value[i] == '"' {
+				if err := checkConfigComment(value[i+1:]); err != nil {
+					return "", err
+				}
+				return strconv.Unquote(value[:i+1])
+			}
+		}
+		return "", fmt.Errorf("unterminated string %s", value)
+	case '\'':
+		if i := strings.IndexByte(value[1:], '\''); i >= 0 {
+			if err := checkConfigComment(value[i+2:]); err != nil {
+				return "", err
+			}
+			return value[1 : i+1], nil
+		}
+		return "", fmt.Errorf("unterminated string %s", value)
+	case '[', '{', '|', '>':
+		return "", fmt.Errorf("only scalar values are supported")
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// Check that the text after a quoted value is empty or a comment.
+func checkConfigComment(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && rest[0] != '#' {
+		return fmt.Errorf("unexpected text after string: %s", rest)
+	}
+	return nil
+}
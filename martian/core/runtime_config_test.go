@@ -0,0 +1,96 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLoadFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadFromFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	check := func(t *testing.T, config *RuntimeOptions) {
+		t.Helper()
+		if config.JobMode != "sge" {
+			t.Errorf("Expected jobmode sge, got %s", config.JobMode)
+		}
+		if config.MaxJobs != 200 {
+			t.Errorf("Expected maxjobs 200, got %d", config.MaxJobs)
+		}
+		if !config.LimitLoadavg {
+			t.Error("Expected limit-loadavg to be set.")
+		}
+		if config.SubmitRate != 2.5 {
+			t.Errorf("Expected submit-rate 2.5, got %g", config.SubmitRate)
+		}
+		if config.StateLog != "/tmp/state # log.json" {
+			t.Errorf("Incorrect state-log %q", config.StateLog)
+		}
+		// Missing options keep their defaults.
+		if config.VdrMode != "rolling" || config.MemorySlack != 10 {
+			t.Errorf("Expected default vdrmode and memory-slack, got %s, %d",
+				config.VdrMode, config.MemorySlack)
+		}
+	}
+	t.Run("yaml", func(t *testing.T) {
+		fn := path.Join(dir, "martian.yaml")
+		if err := ioutil.WriteFile(fn, []byte(`---
+# Cluster settings.
+jobmode: sge
+maxjobs: 200  # per pipestance
+limit_loadavg: true
+submit-rate: 2.5
+state-log: "/tmp/state # log.json"
+`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config := DefaultRuntimeOptions()
+		if err := config.LoadFromFile(fn); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &config)
+	})
+	t.Run("toml", func(t *testing.T) {
+		fn := path.Join(dir, "martian.toml")
+		if err := ioutil.WriteFile(fn, []byte(`# Cluster settings.
+jobmode = "sge"
+maxjobs = 200
+limit-loadavg = true
+submit-rate = 2.5
+state-log = '/tmp/state # log.json' # literal string
+`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config := DefaultRuntimeOptions()
+		if err := config.LoadFromFile(fn); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &config)
+	})
+	for name, content := range map[string]string{
+		"unknown.toml": "jobmod = \"sge\"\n",
+		"type.toml":    "maxjobs = \"many\"\n",
+		"table.toml":   "[runtime]\njobmode = \"sge\"\n",
+		"nested.yaml":  "runtime:\n  jobmode: sge\n",
+		"list.yaml":    "jobmode: [sge, lsf]\n",
+		"config.json":  "{}\n",
+	} {
+		fn := path.Join(dir, name)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config := DefaultRuntimeOptions()
+		if err := config.LoadFromFile(fn); err == nil {
+			t.Errorf("Expected an error loading %s", name)
+		} else if !strings.Contains(err.Error(), fn) {
+			t.Errorf("Expected the file name in error %v", err)
+		}
+	}
+}
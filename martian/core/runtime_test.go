@@ -7,12 +7,18 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/martian-lang/martian/martian/syntax"
 	"github.com/martian-lang/martian/martian/util"
@@ -72,9 +78,7 @@ func ExampleBuildCallSource() {
 	// )
 }
 
-// Very basic invoke test.
-func TestInvoke(t *testing.T) {
-	src := `
+const invokeTestSrc = `
 stage SUM_SQUARES(
     in  float[] values,
     in  int     threads,
@@ -87,6 +91,8 @@ stage REPORT(
     in  float[] values,
     in  float   sum,
     src exec    "stages/report",
+) env (
+    OMP_NUM_THREADS = "4",
 )
 
 pipeline SUM_SQUARE_PIPELINE(
@@ -113,39 +119,59 @@ call SUM_SQUARE_PIPELINE(
     values = [1.0, 2.0, 3.0],
 )
 `
-	if d, err := ioutil.TempDir("", "pipestance"); err != nil {
-		t.Error(err)
+
+var setupSignalHandlersOnce sync.Once
+
+// Set up a runtime for invoking invokeTestSrc in a temporary directory.
+//
+// Returns the runtime, the directory, and a function which cleans up the
+// directory and anything else created for the test.
+func setupInvokeTest(t *testing.T) (*Runtime, string, func()) {
+	t.Helper()
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+	skip := func(err error) {
+		cleanup()
+		t.Skip(err)
+	}
+	d, err := ioutil.TempDir("", "pipestance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanups = append(cleanups, func() { os.RemoveAll(d) })
+	t.Log("Invoking pipestance in ", d)
+	pdir := util.RelPath("..")
+	if f, err := os.Open(pdir); err != nil {
+		skip(err)
 	} else {
-		defer os.RemoveAll(d)
-		t.Log("Invoking pipestance in ", d)
-		pdir := util.RelPath("..")
-		if d, err := os.Open(pdir); err != nil {
-			t.Skip(err)
+		// hold open the directory so it doesn't disappear on us.
+		cleanups = append(cleanups, func() { f.Close() })
+	}
+	t.Log("Runtime directory is ", pdir)
+	jobPath := path.Join(pdir, "jobmanagers")
+	if _, err := os.Stat(jobPath); os.IsNotExist(err) {
+		t.Log("Creating ", jobPath)
+		// test harness runs in temp dir.  Need to make a fake config.json.
+		if err := os.MkdirAll(jobPath, 0777); err != nil {
+			skip(err)
+		}
+		cleanups = append(cleanups, func() { os.RemoveAll(jobPath) })
+		if f, err := os.Open(jobPath); err != nil {
+			skip(err)
 		} else {
-			// hold open the directory so it doesn't disappear on us.
-			defer d.Close()
-		}
-		t.Log("Runtime directory is ", pdir)
-		jobPath := path.Join(pdir, "jobmanagers")
-		if _, err := os.Stat(jobPath); os.IsNotExist(err) {
-			t.Log("Creating ", jobPath)
-			// test harness runs in temp dir.  Need to make a fake config.json.
-			if err := os.MkdirAll(jobPath, 0777); err != nil {
-				t.Skip(err)
-			}
-			if d, err := os.Open(jobPath); err != nil {
-				t.Skip(err)
-			} else {
-				defer d.Close()
-			}
-			defer os.RemoveAll(jobPath)
-		} else if err != nil {
-			t.Skip(err)
-		}
-		cfg := path.Join(jobPath, "config.json")
-		if _, err := os.Stat(cfg); os.IsNotExist(err) {
-			t.Log("Creating ", cfg)
-			if ioutil.WriteFile(cfg, []byte(`{
+			cleanups = append(cleanups, func() { f.Close() })
+		}
+	} else if err != nil {
+		skip(err)
+	}
+	cfg := path.Join(jobPath, "config.json")
+	if _, err := os.Stat(cfg); os.IsNotExist(err) {
+		t.Log("Creating ", cfg)
+		if ioutil.WriteFile(cfg, []byte(`{
   "settings": {
     "threads_per_job": 1,
     "memGB_per_job": 1,
@@ -153,27 +179,472 @@ call SUM_SQUARE_PIPELINE(
   },
   "jobmodes": {}
 }`), 0666); err != nil {
-				t.Log(err)
-			}
-			defer os.Remove(cfg)
-		} else if err != nil {
 			t.Log(err)
 		}
-		opts := DefaultRuntimeOptions()
-		util.SetupSignalHandlers()
-		rt := opts.NewRuntime()
-		t.Log("Runtime instantiated.")
-		if ps, err := rt.InvokePipeline(src,
-			path.Join(d, "src.mro"), "test",
-			path.Join(d, "test"), nil, "1.0.0",
-			make(map[string]string), nil); err != nil {
+		cleanups = append(cleanups, func() { os.Remove(cfg) })
+	} else if err != nil {
+		t.Log(err)
+	}
+	opts := DefaultRuntimeOptions()
+	setupSignalHandlersOnce.Do(util.SetupSignalHandlers)
+	rt := opts.NewRuntime()
+	rt.Config.PollInterval = time.Millisecond
+	t.Log("Runtime instantiated.")
+	return rt, d, cleanup
+}
+
+// Invoke invokeTestSrc as a dry run in d/psid.  The caller must unlock the
+// returned pipestance.
+func invokeDryRun(t *testing.T, rt *Runtime, d, psid string) *Pipestance {
+	t.Helper()
+	ps, err := rt.InvokePipelineDryRun(invokeTestSrc,
+		path.Join(d, "src.mro"), psid,
+		path.Join(d, psid), nil, "1.0.0",
+		map[string]string{"OMP_NUM_THREADS": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.LoadMetadata(context.Background())
+	return ps
+}
+
+// Invoke invokeTestSrc as a dry run in d/psid and run it to completion.
+// The caller must unlock the returned pipestance.
+func completeDryRun(t *testing.T, rt *Runtime, d, psid string) *Pipestance {
+	t.Helper()
+	ps := invokeDryRun(t, rt, d, psid)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := ps.RunUntilComplete(ctx); err != nil {
+		ps.Unlock()
+		t.Fatal(err)
+	}
+	return ps
+}
+
+// Very basic invoke test.
+func TestInvoke(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	if ps, err := rt.InvokePipeline(invokeTestSrc,
+		path.Join(d, "src.mro"), "test",
+		path.Join(d, "test"), nil, "1.0.0",
+		make(map[string]string), nil); err != nil {
+		t.Error(err)
+	} else if ps == nil {
+		t.Errorf("nil pipestance")
+	} else if _, err := os.Stat(path.Join(d, "test")); err != nil {
+		t.Error(err)
+	} else {
+		ps.Unlock()
+	}
+}
+
+func TestInvokeDryRun(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	ps := completeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	if st := ps.GetState(context.Background()); st != Complete {
+		t.Errorf("Expected dry run to complete, got %v", st)
+	}
+	for _, node := range ps.SerializeState() {
+		if node.State != Complete {
+			t.Errorf("Expected %s to be complete, got %v",
+				node.Fqname, node.State)
+		}
+	}
+	if _, err := os.Stat(path.Join(d, "dry",
+		"SUM_SQUARE_PIPELINE", "REPORT", "fork0", "_invocation")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInvokeStageEnv(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	ps := invokeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	// Environment set by a stage only applies to that stage.
+	for stage, expect := range map[string]string{
+		"SUM_SQUARES": "1",
+		"REPORT":      "4",
+	} {
+		node, ok := ps.GetNodeByFQName("ID.dry.SUM_SQUARE_PIPELINE." + stage)
+		if !ok {
+			t.Errorf("Missing node %s", stage)
+		} else if v := node.envs["OMP_NUM_THREADS"]; v != expect {
+			t.Errorf("Expected OMP_NUM_THREADS=%s for %s, got %q",
+				expect, stage, v)
+		}
+	}
+}
+
+func TestPipestancePauseResume(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	ps := invokeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	ctx := context.Background()
+	// Nothing should be run while paused.
+	if err := ps.Pause(); err != nil {
+		t.Error(err)
+	}
+	// The pause should persist when the metadata is reloaded.
+	ps.LoadMetadata(ctx)
+	if !ps.IsPaused() {
+		t.Error("Expected pipestance to remain paused.")
+	}
+	ps.StepNodes(ctx)
+	if st := ps.GetState(ctx); st != Paused {
+		t.Errorf("Expected paused, got %v", st)
+	}
+	if _, err := os.Stat(path.Join(d, "dry",
+		"SUM_SQUARE_PIPELINE", "SUM_SQUARES", "fork0", "_invocation")); !os.IsNotExist(err) {
+		t.Errorf("Expected no invocation while paused, got %v", err)
+	}
+	if err := ps.Resume(); err != nil {
+		t.Error(err)
+	}
+	runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := ps.RunUntilComplete(runCtx); err != nil {
+		t.Error(err)
+	}
+	if st := ps.GetState(ctx); st != Complete {
+		t.Errorf("Expected pipestance to complete after resuming, got %v", st)
+	}
+}
+
+func TestPipestanceWaitUntilComplete(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	ps := invokeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	ctx := context.Background()
+	// Waiting must not step the pipestance.
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	if err := ps.WaitUntilComplete(waitCtx); err != context.DeadlineExceeded {
+		t.Errorf("Expected wait to time out, got %v", err)
+	}
+	cancel()
+	if _, err := os.Stat(path.Join(d, "dry",
+		"SUM_SQUARE_PIPELINE", "SUM_SQUARES", "fork0", "_invocation")); !os.IsNotExist(err) {
+		t.Errorf("Expected no invocation from waiting, got %v", err)
+	}
+	runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := ps.RunUntilComplete(runCtx); err != nil {
+		t.Error(err)
+	}
+	if err := ps.WaitUntilComplete(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPipestanceTags(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	ps := completeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	for _, tag := range []string{"project", "sample", "project"} {
+		if err := ps.AddTag(tag); err != nil {
 			t.Error(err)
-		} else if ps == nil {
-			t.Errorf("nil pipestance")
-		} else if _, err := os.Stat(path.Join(d, "test")); err != nil {
+		}
+	}
+	if ser := ps.SerializeState(); len(ser) == 0 ||
+		strings.Join(ser[0].Tags, ",") != "project,sample" {
+		t.Error("Expected the top-level node to have the tags.")
+	}
+}
+
+func TestPipestanceSnapshotRestore(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	ps := completeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	ctx := context.Background()
+	if data, err := ps.Snapshot(); err != nil {
+		t.Error(err)
+	} else if restored, err := rt.RestoreFromSnapshot(data,
+		path.Join(d, "restored")); err != nil {
+		t.Error(err)
+	} else {
+		restored.LoadMetadata(ctx)
+		if st := restored.GetState(ctx); st != Complete {
+			t.Errorf("Expected restored pipestance to be complete, got %v", st)
+		}
+		if _, err := os.Stat(path.Join(d, "restored",
+			"SUM_SQUARE_PIPELINE", "REPORT", "fork0", "_invocation")); err != nil {
 			t.Error(err)
-		} else {
-			ps.Unlock()
 		}
+		restored.Unlock()
+	}
+}
+
+func TestPipestanceZipMetadata(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	ps := completeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	rt.Config.Zip = true
+	if err := ps.ZipMetadata(path.Join(d, "dry",
+		MetadataZip.FileName())); err != nil {
+		t.Fatal(err)
+	}
+	rt.Config.Zip = false
+	if _, err := os.Stat(path.Join(d, "dry",
+		"SUM_SQUARE_PIPELINE", "REPORT", "_complete")); !os.IsNotExist(err) {
+		t.Errorf("Expected metadata to be removed after zipping, got %v", err)
+	}
+}
+
+func TestAttachReadOnly(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	ps := completeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	ctx := context.Background()
+	for _, tag := range []string{"project", "sample"} {
+		if err := ps.AddTag(tag); err != nil {
+			t.Error(err)
+		}
+	}
+	// Attach to zipped metadata, as for a finished pipestance.
+	rt.Config.Zip = true
+	if err := ps.ZipMetadata(path.Join(d, "dry",
+		MetadataZip.FileName())); err != nil {
+		t.Fatal(err)
+	}
+	rt.Config.Zip = false
+	t.Log("Attaching read-only while locked.")
+	chmodTree(t, path.Join(d, "dry"), 0555, 0444)
+	defer chmodTree(t, path.Join(d, "dry"), 0755, 0644)
+	// Permissions do not stop root from writing, so in that case
+	// check that nothing changed instead.
+	var before map[string]string
+	if f, err := os.Create(path.Join(d, "dry", "_probe")); err == nil {
+		f.Close()
+		os.Remove(path.Join(d, "dry", "_probe"))
+		before = listTree(t, path.Join(d, "dry"))
+	}
+	if ro, err := rt.ReattachToPipestance("dry", path.Join(d, "dry"),
+		"", "", nil, "1.0.0", make(map[string]string),
+		false, true, ctx); err != nil {
+		t.Error(err)
+	} else {
+		ro.LoadMetadata(ctx)
+		ro.RefreshState(ctx)
+		if st := ro.GetState(ctx); st != Complete {
+			t.Errorf("Expected read-only pipestance to be complete, got %v", st)
+		}
+		for _, node := range ro.SerializeState() {
+			if node.State != Complete {
+				t.Errorf("Expected %s to be complete, got %v",
+					node.Fqname, node.State)
+			}
+		}
+		ro.StepNodes(ctx)
+		ro.CheckHeartbeats(ctx)
+		if _, err := ro.SerializeStateJSON(ctx); err != nil {
+			t.Error(err)
+		}
+		if err := ro.Lock(); err == nil {
+			t.Error("Expected read-only pipestance not to lock.")
+		}
+		if err := ro.Immortalize(true); err == nil {
+			t.Error("Expected read-only pipestance not to immortalize.")
+		}
+		ro.Unlock()
+	}
+	t.Log("Attaching with a read-only runtime.")
+	roRt := NewReadOnlyRuntime(DefaultRuntimeOptions())
+	if ro, err := roRt.AttachReadOnly("dry", path.Join(d, "dry")); err != nil {
+		t.Error(err)
+	} else {
+		if st := ro.GetState(ctx); st != Complete {
+			t.Errorf("Expected read-only pipestance to be complete, got %v", st)
+		}
+		if err := ro.Pause(); err != ErrReadOnly {
+			t.Errorf("Expected ErrReadOnly, got %v", err)
+		}
+		if tags, err := ro.GetTags(); err != nil {
+			t.Error(err)
+		} else if strings.Join(tags, ",") != "project,sample" {
+			t.Errorf("Expected tags project,sample, got %v", tags)
+		}
+		if err := ro.AddTag("other"); err != ErrReadOnly {
+			t.Errorf("Expected ErrReadOnly, got %v", err)
+		}
+	}
+	if _, err := roRt.ReattachToPipestance("dry", path.Join(d, "dry"),
+		"", "", nil, "1.0.0", make(map[string]string),
+		false, false, ctx); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if _, err := roRt.InvokePipeline(invokeTestSrc,
+		path.Join(d, "src.mro"), "readonly",
+		path.Join(d, "readonly"), nil, "1.0.0",
+		make(map[string]string), nil); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if before != nil {
+		after := listTree(t, path.Join(d, "dry"))
+		for p, info := range before {
+			if a, ok := after[p]; !ok {
+				t.Errorf("Read-only attach removed %s", p)
+			} else if a != info {
+				t.Errorf("Read-only attach modified %s", p)
+			}
+		}
+		for p := range after {
+			if _, ok := before[p]; !ok {
+				t.Errorf("Read-only attach created %s", p)
+			}
+		}
+	}
+}
+
+func TestPipestanceStateLog(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	var stateLog bytes.Buffer
+	rt.stateLog = newStateLog(&stateLog)
+	ps := completeDryRun(t, rt, d, "dry")
+	defer ps.Unlock()
+	// Every node's transition to complete should be in the state log.
+	completed := make(map[string]bool)
+	dec := json.NewDecoder(&stateLog)
+	for dec.More() {
+		var change StateChange
+		if err := dec.Decode(&change); err != nil {
+			t.Fatal(err)
+		}
+		if change.NewState == Complete {
+			completed[change.Fqname] = true
+		}
+	}
+	if !completed["ID.dry.SUM_SQUARE_PIPELINE.REPORT"] {
+		t.Errorf("Expected completion of REPORT in the state log, got %v",
+			completed)
+	}
+}
+
+func TestInvokeValidateOnly(t *testing.T) {
+	rt, d, cleanup := setupInvokeTest(t)
+	defer cleanup()
+	if ps, err := rt.InvokePipeline(invokeTestSrc,
+		path.Join(d, "src.mro"), "test",
+		path.Join(d, "test"), nil, "1.0.0",
+		make(map[string]string), nil); err != nil {
+		t.Fatal(err)
+	} else {
+		ps.Unlock()
+	}
+	rt.Config.DryRun = true
+	if ps, err := rt.InvokePipeline(invokeTestSrc,
+		path.Join(d, "src.mro"), "check",
+		path.Join(d, "check"), nil, "1.0.0",
+		make(map[string]string), nil); err != nil {
+		t.Error(err)
+	} else if ps == nil {
+		t.Errorf("nil pipestance")
+	} else if _, err := os.Stat(path.Join(d, "check")); !os.IsNotExist(err) {
+		t.Errorf("Expected no pipestance directory, got %v", err)
+	}
+	if _, err := rt.InvokePipeline(strings.Replace(invokeTestSrc,
+		"sum    = SUM_SQUARES.sum,", "sum    = SUM_SQUARES.total,", 1),
+		path.Join(d, "src.mro"), "check",
+		path.Join(d, "check"), nil, "1.0.0",
+		make(map[string]string), nil); err == nil {
+		t.Error("Expected a binding error.")
+	}
+	if _, err := rt.InvokePipeline(invokeTestSrc,
+		path.Join(d, "src.mro"), "test",
+		path.Join(d, "test"), nil, "1.0.0",
+		make(map[string]string), nil); err == nil {
+		t.Error("Expected an error for an existing pipestance.")
+	}
+	if _, err := rt.InvokePipelineDryRun(invokeTestSrc,
+		path.Join(d, "src.mro"), "check",
+		path.Join(d, "check"), nil, "1.0.0",
+		make(map[string]string), nil); err == nil {
+		t.Error("Expected an error for a dry run while only validating.")
+	} else if _, err := os.Stat(path.Join(d, "check")); !os.IsNotExist(err) {
+		t.Errorf("Expected no pipestance directory, got %v", err)
+	}
+}
+
+// Set the mode of every directory and file under root.
+func chmodTree(t *testing.T, root string, dirMode, fileMode os.FileMode) {
+	t.Helper()
+	if err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.Chmod(p, dirMode)
+		} else if info.Mode().IsRegular() {
+			return os.Chmod(p, fileMode)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Get the mode, size, and modification time of every file under root, keyed
+// by path.
+func listTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	if err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		files[p] = fmt.Sprint(info.Mode(), info.Size(), info.ModTime().UnixNano())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestValidateInvocation(t *testing.T) {
+	const decs = `
+stage SUM_SQUARES(
+    in  float[] values,
+    in  int     threads,
+    in  bool    local    = false,
+    out float   sum,
+    src comp    "stages/sum_squares",
+)
+`
+	var rt Runtime
+	if err := rt.ValidateInvocation(decs+`
+call SUM_SQUARES(
+    values  = [1.0, 2.0],
+    threads = 1,
+)
+`, nil); err != nil {
+		t.Error(err)
+	}
+	err := rt.ValidateInvocation(decs+`
+call SUM_SQUARES(
+    values  = 1.0,
+)
+`, nil)
+	if errs, ok := err.(syntax.ErrorList); !ok {
+		t.Fatalf("Expected an error list, got %v", err)
+	} else if len(errs) != 2 {
+		t.Errorf("Expected 2 errors, got\n%v", err)
+	} else if msg := err.Error(); !strings.Contains(msg,
+		"no argument supplied for parameter 'threads'") {
+		t.Errorf("Expected a missing argument error, got\n%s", msg)
+	}
+	if err := rt.ValidateInvocation(decs, nil); err == nil {
+		t.Error("Expected an error for a missing call.")
+	} else if _, ok := err.(syntax.ErrorList); !ok {
+		t.Errorf("Expected an error list, got %v", err)
 	}
 }
@@ -0,0 +1,214 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Portable snapshots of pipestance state, for migrating pipestances between
+// versions of mrp.
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The version of the snapshot format written by Pipestance.Snapshot.
+const snapshotVersion = 1
+
+// Metadata files which are not included in snapshots, because they are
+// specific to a running mrp instance, or are binary.
+var snapshotSkipFiles = map[MetadataFileName]bool{
+	Lock:        true,
+	UiPort:      true,
+	MetadataZip: true,
+	PerfData:    true,
+	ProfileOut:  true,
+}
+
+// The logical state of a pipestance, in a form which does not depend on
+// how the pipestance is laid out on disk.
+type PipestanceSnapshot struct {
+	Version int    `json:"version"`
+	Psid    string `json:"psid"`
+
+	// The top-level metadata of the pipestance.
+	Metadata *MetadataSnapshot `json:"metadata"`
+
+	Nodes []*NodeSnapshot `json:"nodes"`
+}
+
+// The state of a stage or pipeline in a snapshot.
+type NodeSnapshot struct {
+	Fqname   string              `json:"fqname"`
+	State    MetadataState       `json:"state"`
+	Metadata []*MetadataSnapshot `json:"metadata"`
+}
+
+// The contents of the metadata files for a pipeline, stage, fork, split,
+// chunk, or join.
+type MetadataSnapshot struct {
+	// The metadata directory, relative to the pipestance directory.
+	Path string `json:"path"`
+
+	Files map[MetadataFileName]string `json:"files"`
+}
+
+// Snapshot serializes the state of the pipestance to a portable JSON
+// format, which can be restored with Runtime.RestoreFromSnapshot.
+//
+// The snapshot includes the contents of the metadata files for every node,
+// except for a few which are only meaningful to a running mrp or are not
+// text.  It does not include the files output by stages, so the outputs of
+// a restored pipestance still refer to the original pipestance directory.
+// Metadata updates which are still in the journal are not included, so the
+// pipestance should not be running when the snapshot is taken.
+func (self *Pipestance) Snapshot() ([]byte, error) {
+	root := self.GetPath()
+	top, err := snapshotMetadata(self.metadata, root)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := PipestanceSnapshot{
+		Version:  snapshotVersion,
+		Psid:     self.GetPsid(),
+		Metadata: top,
+	}
+	for _, node := range self.allNodes() {
+		ns := &NodeSnapshot{
+			Fqname: node.fqname,
+			State:  node.state,
+		}
+		for _, m := range node.collectMetadatas() {
+			if ms, err := snapshotMetadata(m, root); err != nil {
+				return nil, err
+			} else if len(ms.Files) > 0 {
+				ns.Metadata = append(ns.Metadata, ms)
+			}
+		}
+		snapshot.Nodes = append(snapshot.Nodes, ns)
+	}
+	return json.MarshalIndent(&snapshot, "", "    ")
+}
+
+func snapshotMetadata(m *Metadata, root string) (*MetadataSnapshot, error) {
+	rel, err := filepath.Rel(root, m.finalPath)
+	if err != nil {
+		return nil, err
+	}
+	ms := &MetadataSnapshot{
+		Path:  rel,
+		Files: make(map[MetadataFileName]string),
+	}
+	for _, p := range m.glob() {
+		name := metadataFileNameFromPath(p)
+		if snapshotSkipFiles[name] {
+			continue
+		}
+		if info, err := os.Stat(p); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			continue
+		}
+		if b, err := m.readRawBytes(name); err != nil {
+			return nil, err
+		} else {
+			ms.Files[name] = string(b)
+		}
+	}
+	return ms, nil
+}
+
+// RestoreFromSnapshot recreates a pipestance in the given directory from a
+// snapshot written by Pipestance.Snapshot, and reattaches to it.
+//
+// The directory must be empty or not exist.  The pipestance is
+// instantiated from the MRO source recorded in the snapshot, so the
+// include paths do not need to be available.  As for any reattached
+// pipestance, stages which were running when the snapshot was taken are
+// restarted in local mode.
+func (self *Runtime) RestoreFromSnapshot(data []byte, pipestancePath string) (*Pipestance, error) {
+	if self.readOnly {
+		return nil, ErrReadOnly
+	}
+	var snapshot PipestanceSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, &RuntimeError{fmt.Sprintf(
+			"unsupported snapshot version %d", snapshot.Version)}
+	}
+	if snapshot.Metadata == nil {
+		return nil, &RuntimeError{"snapshot has no pipestance metadata"}
+	}
+
+	// Error if pipestance directory is non-empty, otherwise create.
+	if err := os.MkdirAll(pipestancePath, 0777); err != nil {
+		return nil, err
+	}
+	if fileNames, err := util.Readdirnames(pipestancePath); err != nil {
+		return nil, err
+	} else if len(fileNames) > 0 {
+		return nil, &PipestanceExistsError{snapshot.Psid}
+	}
+
+	if err := restoreMetadata(snapshot.Metadata, pipestancePath); err != nil {
+		os.RemoveAll(pipestancePath)
+		return nil, err
+	}
+	for _, node := range snapshot.Nodes {
+		for _, m := range node.Metadata {
+			if err := restoreMetadata(m, pipestancePath); err != nil {
+				os.RemoveAll(pipestancePath)
+				return nil, err
+			}
+		}
+	}
+
+	var versions VersionInfo
+	if v, ok := snapshot.Metadata.Files[VersionsFile]; ok {
+		if err := json.Unmarshal([]byte(v), &versions); err != nil {
+			util.LogError(err, "runtime",
+				"Could not read the pipeline version from the snapshot.")
+		}
+	}
+	pipestance, err := self.ReattachToPipestanceWithMroSrc(snapshot.Psid,
+		pipestancePath, "", "", nil, versions.Pipelines,
+		make(map[string]string), false, false, context.Background())
+	if err != nil {
+		os.RemoveAll(pipestancePath)
+		return nil, err
+	}
+	return pipestance, nil
+}
+
+func restoreMetadata(m *MetadataSnapshot, root string) error {
+	if p := path.Clean(m.Path); path.IsAbs(p) || p == ".." ||
+		strings.HasPrefix(p, "../") {
+		return &RuntimeError{fmt.Sprintf(
+			"snapshot metadata path %s is outside of the pipestance", m.Path)}
+	}
+	dir := path.Join(root, m.Path)
+	if err := util.MkdirAll(dir); err != nil {
+		return err
+	}
+	for name, content := range m.Files {
+		if strings.ContainsRune(string(name), '/') {
+			return &RuntimeError{fmt.Sprintf(
+				"invalid metadata file name %s in snapshot", name)}
+		}
+		if err := ioutil.WriteFile(path.Join(dir, name.FileName()),
+			[]byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
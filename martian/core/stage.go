@@ -97,6 +97,10 @@ func NewChunk(fork *Fork, index int,
 			}
 		}
 	}
+	if archive := fork.node.metadataArchive; archive != nil {
+		self.metadata.archive = archive
+		self.metadata.discoverUniquify()
+	}
 	self.hasBeenRun = false
 	if !self.fork.Split() {
 		// If we're not splitting, just set the sole chunk's filesPath
@@ -194,7 +198,9 @@ func (self *Chunk) updateState(state MetadataFileName, uniquifier string) {
 	if state == ProgressFile {
 		self.fork.lastPrint = time.Now()
 		if msg, err := self.metadata.readRawSafe(state); err == nil {
-			util.PrintInfo("runtime", "(progress)        %s: %s", self.fqname, msg)
+			util.PrintInfoAttrs("runtime",
+				[]interface{}{"fqname", self.fqname, "progress", msg},
+				"(progress)        %s: %s", self.fqname, msg)
 		} else {
 			util.LogError(err, "progres", "Error reading progress file for %s", self.fqname)
 		}
@@ -202,26 +208,37 @@ func (self *Chunk) updateState(state MetadataFileName, uniquifier string) {
 	if beginState == Running || beginState == Queued {
 		if st, _ := self.metadata.getState(); st != Running && st != Queued {
 			self.fork.node.rt.JobManager.endJob(self.metadata)
+			self.fork.node.rt.jobBudget.release(self.metadata.fqname)
 		}
 	}
 }
 
 func (self *Chunk) step(bindings LazyArgumentMap) {
+	if res := self.prepare(bindings); res != nil {
+		self.fork.node.runChunk(self.fqname, self.metadata, res)
+	}
+}
+
+// Prepare to run the chunk, if it is ready to run.  Returns the resources
+// for the chunk's job, or nil if it should not be run.
+func (self *Chunk) prepare(bindings LazyArgumentMap) *JobResources {
 	if self.getState() != Ready {
-		return
+		return nil
 	}
 
 	// Belt and suspenders for not double-submitting a job.
 	if self.hasBeenRun {
-		return
-	} else {
-		self.hasBeenRun = true
+		return nil
 	}
 
 	if self.chunkDef.Resources == nil {
 		self.chunkDef.Resources = &JobResources{}
 	}
-	threads, memGB, special := self.fork.node.setChunkJobReqs(self.chunkDef.Resources)
+	res := self.fork.node.setChunkJobReqs(self.chunkDef.Resources)
+	if !self.fork.node.rt.jobBudget.acquire(self.metadata.fqname, res) {
+		return nil
+	}
+	self.hasBeenRun = true
 
 	// Resolve input argument bindings and merge in the chunk defs.
 	resolvedBindings := self.chunkDef.Merge(bindings)
@@ -237,9 +254,8 @@ func (self *Chunk) step(bindings LazyArgumentMap) {
 	}
 	self.metadata.Write(OutsFile, outs)
 
-	// Run the chunk.
 	self.fork.lastPrint = time.Now()
-	self.fork.node.runChunk(self.fqname, self.metadata, threads, memGB, special)
+	return res
 }
 
 func (self *Chunk) serializeState() *ChunkInfo {
@@ -252,8 +268,8 @@ func (self *Chunk) serializeState() *ChunkInfo {
 }
 
 func (self *Chunk) serializePerf() *ChunkPerfInfo {
-	numThreads, _, _ := self.fork.node.getJobReqs(self.chunkDef.Resources, STAGE_TYPE_CHUNK)
-	stats := self.metadata.serializePerf(numThreads)
+	res := self.fork.node.getJobReqs(self.chunkDef.Resources, STAGE_TYPE_CHUNK)
+	stats := self.metadata.serializePerf(res.Threads)
 	return &ChunkPerfInfo{
 		Index:      self.index,
 		ChunkStats: stats,
@@ -674,11 +690,31 @@ func (self *Fork) writeDisable() {
 	self.printState(DisabledState)
 }
 
+// Report the job which would be run for this fork, and mark it complete
+// without running it, so that the stages which depend on it can be planned.
+// File outputs are bound to the paths where the stage would write them, and
+// other outputs are null.
+func (self *Fork) writeDryRun() {
+	phase, stageType := "main", STAGE_TYPE_CHUNK
+	if self.Split() {
+		phase, stageType = "split", STAGE_TYPE_SPLIT
+	}
+	res := self.node.getJobReqs(nil, stageType)
+	self.lastPrint = time.Now()
+	util.PrintInfo("runtime", "(dry run)         %s: would run %s with %d threads, %d GB",
+		self.fqname, phase, res.Threads, res.MemGB)
+	self.metadata.Write(OutsFile, makeOutArgs(
+		self.OutParams(), self.metadata.curFilesPath, false))
+	self.metadata.WriteTime(CompleteFile)
+}
+
 func (self *Fork) updateState(state, uniquifier string) {
 	if state == string(ProgressFile) {
 		self.lastPrint = time.Now()
 		if msg, err := self.metadata.readRawSafe(MetadataFileName(state)); err == nil {
-			util.PrintInfo("runtime", "(progress)        %s: %s", self.fqname, msg)
+			util.PrintInfoAttrs("runtime",
+				[]interface{}{"fqname", self.fqname, "progress", msg},
+				"(progress)        %s: %s", self.fqname, msg)
 		} else {
 			util.LogError(err, "progres", "Error reading progress file for %s", self.fqname)
 		}
@@ -689,6 +725,7 @@ func (self *Fork) updateState(state, uniquifier string) {
 			uniquifier)
 		if st, _ := self.split_metadata.getState(); st != Running && st != Queued {
 			self.node.rt.JobManager.endJob(self.split_metadata)
+			self.node.rt.jobBudget.release(self.split_metadata.fqname)
 		}
 	} else if strings.HasPrefix(state, JoinPrefix) {
 		self.join_metadata.cache(
@@ -696,6 +733,7 @@ func (self *Fork) updateState(state, uniquifier string) {
 			uniquifier)
 		if st, _ := self.join_metadata.getState(); st != Running && st != Queued {
 			self.node.rt.JobManager.endJob(self.join_metadata)
+			self.node.rt.jobBudget.release(self.join_metadata.fqname)
 		}
 	} else {
 		self.metadata.cache(MetadataFileName(state), uniquifier)
@@ -734,11 +772,69 @@ func (self *Fork) printState(state MetadataState) {
 		fqname = self.fqname
 	}
 	self.lastPrint = time.Now()
-	msg := fmt.Sprintf("(%s)%s %s", state, statePad, fqname)
+	attrs := []interface{}{"fqname", fqname, "state", string(state)}
 	if self.node.preflight {
-		util.LogInfo("runtime", msg)
+		util.LogInfoAttrs("runtime", attrs, "(%s)%s %s", state, statePad, fqname)
 	} else {
-		util.PrintInfo("runtime", msg)
+		util.PrintInfoAttrs("runtime", attrs, "(%s)%s %s", state, statePad, fqname)
+	}
+}
+
+// Count the jobs of the fork which are complete, and the total number of
+// jobs, for progress reporting.  Until the fork splits, its chunks are not
+// known, so it counts as a single job.
+func (self *Fork) progress() (complete, total int) {
+	state := self.getState()
+	if state == DisabledState {
+		return 0, 0
+	}
+	if len(self.chunks) == 0 {
+		if state == Complete {
+			return 1, 1
+		}
+		return 0, 1
+	}
+	// The chunks, plus the join.
+	total = len(self.chunks) + 1
+	if state == Complete {
+		return total, total
+	}
+	for _, chunk := range self.chunks {
+		if chunk.getState() == Complete {
+			complete++
+		}
+	}
+	return complete, total
+}
+
+// Step the chunks of the fork.  If the job manager supports job arrays,
+// chunks which are ready to run and have the same resource requirements are
+// submitted together as an array job.
+func (self *Fork) stepChunks(bindings LazyArgumentMap) {
+	jm, ok := self.node.rt.JobManager.(arrayJobManager)
+	if !ok || self.node.local || !jm.supportsArrays() {
+		for _, chunk := range self.chunks {
+			chunk.step(bindings)
+		}
+		return
+	}
+	var resources []JobResources
+	groups := make(map[JobResources][]*Chunk)
+	for _, chunk := range self.chunks {
+		if res := chunk.prepare(bindings); res != nil {
+			if _, ok := groups[*res]; !ok {
+				resources = append(resources, *res)
+			}
+			groups[*res] = append(groups[*res], chunk)
+		}
+	}
+	for _, res := range resources {
+		res := res
+		if chunks := groups[res]; len(chunks) == 1 {
+			self.node.runChunk(chunks[0].fqname, chunks[0].metadata, &res)
+		} else {
+			self.node.runChunkArray(self, chunks, &res)
+		}
 	}
 }
 
@@ -772,11 +868,18 @@ func (self *Fork) step() {
 			}
 			self.writeInvocation()
 			self.split_metadata.Write(ArgsFile, getBindings())
+			if self.node.dryRun {
+				self.writeDryRun()
+				return
+			}
 			if self.Split() {
 				if !self.split_has_run {
-					self.split_has_run = true
-					self.lastPrint = time.Now()
-					self.node.runSplit(self.fqname, self.split_metadata)
+					res := self.node.setSplitJobReqs()
+					if self.node.rt.jobBudget.acquire(self.split_metadata.fqname, res) {
+						self.split_has_run = true
+						self.lastPrint = time.Now()
+						self.node.runSplit(self.fqname, self.split_metadata, res)
+					}
 				}
 			} else {
 				self.split_metadata.Write(StageDefsFile, self.stageDefs)
@@ -786,6 +889,7 @@ func (self *Fork) step() {
 		}
 		if state == Complete.Prefixed(SplitPrefix) {
 			self.node.rt.JobManager.endJob(self.split_metadata)
+			self.node.rt.jobBudget.release(self.split_metadata.fqname)
 			if self.node.volatile {
 				lockAquired := make(chan struct{}, 1)
 				go func() {
@@ -824,10 +928,7 @@ func (self *Fork) step() {
 						self.metadatasCache = nil
 					}
 					if len(self.chunks) > 0 {
-						bindings := getBindings()
-						for _, chunk := range self.chunks {
-							chunk.step(bindings)
-						}
+						self.stepChunks(getBindings())
 					}
 				}
 			} else {
@@ -854,7 +955,7 @@ func (self *Fork) step() {
 			if self.stageDefs.JoinDef == nil {
 				self.stageDefs.JoinDef = &JobResources{}
 			}
-			threads, memGB, special := self.node.setJoinJobReqs(self.stageDefs.JoinDef)
+			res := self.node.setJoinJobReqs(self.stageDefs.JoinDef)
 			resolvedBindings := ChunkDef{
 				Resources: self.stageDefs.JoinDef,
 				Args:      MakeArgumentMap(getBindings()),
@@ -881,10 +982,11 @@ func (self *Fork) step() {
 				}
 				self.join_metadata.Write(ChunkOutsFile, chunkOuts)
 				self.join_metadata.Write(OutsFile, makeOutArgs(self.OutParams(), self.join_metadata.curFilesPath, false))
-				if !self.join_has_run {
+				if !self.join_has_run &&
+					self.node.rt.jobBudget.acquire(self.join_metadata.fqname, res) {
 					self.join_has_run = true
 					self.lastPrint = time.Now()
-					self.node.runJoin(self.fqname, self.join_metadata, threads, memGB, special)
+					self.node.runJoin(self.fqname, self.join_metadata, res)
 				}
 			} else {
 				if b, err := self.chunks[0].metadata.readRawBytes(OutsFile); err == nil {
@@ -898,6 +1000,7 @@ func (self *Fork) step() {
 		}
 		if state == Complete.Prefixed(JoinPrefix) {
 			self.node.rt.JobManager.endJob(self.join_metadata)
+			self.node.rt.jobBudget.release(self.join_metadata.fqname)
 			var joinOut LazyArgumentMap
 			if len(self.OutParams().List) > 0 {
 				var err error
@@ -923,7 +1026,12 @@ func (self *Fork) step() {
 				}()
 				self.partialVdrKill()
 			}
-			if ok, msg := self.verifyOutput(joinOut); ok {
+			if ok, msg := self.verifyOutput(joinOut); !ok {
+				self.metadata.WriteRaw(Errors, msg)
+			} else if err := self.validateOutputs(); err != nil {
+				self.metadata.WriteRaw(Errors,
+					"Output validation failed: "+err.Error())
+			} else {
 				if msg != "" {
 					self.metadata.AppendAlarm(msg)
 				}
@@ -937,8 +1045,6 @@ func (self *Fork) step() {
 						util.Print("Alerts for %s:\n%s\n", self.node.fqname, alarms)
 					}
 				}
-			} else {
-				self.metadata.WriteRaw(Errors, msg)
 			}
 			self.removeEmptyFileArgs(joinOut)
 			if self.node.rt.Config.VdrMode != "post" {
@@ -1276,14 +1382,14 @@ func (self *Fork) serializePerf() (*ForkPerfInfo, *VDRKillReport) {
 		}
 	}
 
-	numThreads, _, _ := self.node.getJobReqs(nil, STAGE_TYPE_SPLIT)
-	splitStats := self.split_metadata.serializePerf(numThreads)
+	splitStats := self.split_metadata.serializePerf(
+		self.node.getJobReqs(nil, STAGE_TYPE_SPLIT).Threads)
 	if splitStats != nil {
 		stats = append(stats, splitStats)
 	}
 
-	numThreads, _, _ = self.node.getJobReqs(self.stageDefs.JoinDef, STAGE_TYPE_JOIN)
-	joinStats := self.join_metadata.serializePerf(numThreads)
+	joinStats := self.join_metadata.serializePerf(
+		self.node.getJobReqs(self.stageDefs.JoinDef, STAGE_TYPE_JOIN).Threads)
 	if joinStats != nil {
 		stats = append(stats, joinStats)
 	}
@@ -0,0 +1,57 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Limits on the number of stages which run at once.
+
+package core
+
+import (
+	"sync"
+)
+
+// Limits the number of stages which may be running at once, regardless of
+// the resources they use, for example because they use a tool with a
+// limited number of licenses.
+type stageLimiter struct {
+	max     int
+	mutex   sync.Mutex
+	running map[string]struct{}
+}
+
+// Returns nil, meaning no limit, if max is not positive.
+func newStageLimiter(max int) *stageLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &stageLimiter{
+		max:     max,
+		running: make(map[string]struct{}, max),
+	}
+}
+
+// Take a slot for the given stage.  Returns false if all of the slots are
+// in use by other stages, unless force is true.
+func (self *stageLimiter) acquire(fqname string, force bool) bool {
+	if self == nil {
+		return true
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if _, ok := self.running[fqname]; ok {
+		return true
+	}
+	if !force && len(self.running) >= self.max {
+		return false
+	}
+	self.running[fqname] = struct{}{}
+	return true
+}
+
+// Release the slot for the given stage, if it has one.
+func (self *stageLimiter) release(fqname string) {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.running, fqname)
+}
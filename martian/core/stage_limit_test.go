@@ -0,0 +1,76 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestStageLimiter(t *testing.T) {
+	if newStageLimiter(0) != nil {
+		t.Error("Expected no limiter without a limit.")
+	}
+	var none *stageLimiter
+	if !none.acquire("ID.ps.A", false) {
+		t.Error("Expected no limit without a limiter.")
+	}
+	limiter := newStageLimiter(2)
+	if !limiter.acquire("ID.ps.A", false) || !limiter.acquire("ID.ps.B", false) {
+		t.Error("Expected two stages to start.")
+	}
+	if !limiter.acquire("ID.ps.A", false) {
+		t.Error("Expected a running stage to keep its slot.")
+	}
+	if limiter.acquire("ID.ps.C", false) {
+		t.Error("Expected a third stage to wait.")
+	}
+	if !limiter.acquire("ID.ps.D", true) {
+		t.Error("Expected a started stage to be counted.")
+	}
+	limiter.release("ID.ps.A")
+	limiter.release("ID.ps.D")
+	if !limiter.acquire("ID.ps.C", false) {
+		t.Error("Expected a stage to start after others finished.")
+	}
+}
+
+func TestReserveStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReserveStart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	first := retryTestNode(t, path.Join(dir, "first"), RetryPolicy{})
+	second := retryTestNode(t, path.Join(dir, "second"), RetryPolicy{})
+	second.fqname = "ID.test.OTHER"
+	limiter := newStageLimiter(1)
+	first.rt.stageLimiter = limiter
+	second.rt.stageLimiter = limiter
+	if !first.reserveStart() {
+		t.Fatal("Expected the first stage to start.")
+	}
+	if second.reserveStart() {
+		t.Error("Expected the second stage to wait.")
+	}
+	if !second.waitingForSlot {
+		t.Error("Expected the second stage to be waiting.")
+	}
+
+	// A stage which is waiting for disk space gives up its slot.
+	if disableDiskSpaceCheck {
+		return
+	}
+	first.rt.diskReservations = newDiskReservations(0)
+	first.rt.diskReservations.free = bytesPerGB
+	first.resources = &JobResources{DiskGB: 10}
+	limiter.release(first.fqname)
+	if first.reserveStart() {
+		t.Error("Expected the first stage to wait for disk space.")
+	}
+	if !second.reserveStart() {
+		t.Error("Expected the second stage to start.")
+	}
+}
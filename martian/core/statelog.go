@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Structured log of node state changes, for external monitoring.
+
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// A change in the state of a stage or pipeline, as recorded in the state
+// log.
+type StateChange struct {
+	Timestamp string        `json:"timestamp"`
+	Fqname    string        `json:"fqname"`
+	OldState  MetadataState `json:"old_state"`
+	NewState  MetadataState `json:"new_state"`
+}
+
+// Writes state changes as newline-delimited JSON.
+type stateLog struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+func newStateLog(w io.Writer) *stateLog {
+	return &stateLog{enc: json.NewEncoder(w)}
+}
+
+// Open the state log at the given path for appending.
+func openStateLog(p string) (*stateLog, error) {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return newStateLog(f), nil
+}
+
+// Record a state change.  Does nothing if the log is nil.
+func (self *stateLog) log(fqname string, oldState, newState MetadataState) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if err := self.enc.Encode(&StateChange{
+		Timestamp: util.Timestamp(),
+		Fqname:    fqname,
+		OldState:  oldState,
+		NewState:  newState,
+	}); err != nil {
+		util.LogError(err, "runtime", "Error writing to the state log.")
+	}
+}
@@ -176,7 +176,8 @@ func (self *Fork) partialVdrKill() (*VDRKillReport, bool) {
 						}
 					}
 				}
-				if self.node.strictVolatile {
+				if self.node.strictVolatile ||
+					self.node.rt.Config.VdrMode == "aggressive" {
 					return self.vdrKillSome(partial, false)
 				}
 			}
@@ -789,7 +790,8 @@ func (self *Fork) vdrKill(partialKill *PartialVdrKillReport) *VDRKillReport {
 
 	var killPaths []string
 	// For volatile nodes, kill fork-level files.
-	if self.node.rt.overrides.GetOverride(self.node, "force_volatile", self.node.volatile).(bool) {
+	if self.node.rt.overrides.GetOverride(self.node, "force_volatile",
+		self.node.volatile || self.node.rt.Config.VdrMode == "aggressive").(bool) {
 		rep, _ := self.vdrKillSome(partialKill, true)
 		return rep
 	} else if self.Split() && self.node.rt.overrides.GetOverride(self.node, "force_volatile", true).(bool) {
@@ -975,6 +977,9 @@ func NewForkStorageEvent(timestamp time.Time, totalBytes uint64, vdrBytes uint64
 }
 
 func (self *Pipestance) VDRKill() *VDRKillReport {
+	if self.attachedReadOnly {
+		return new(VDRKillReport)
+	}
 	var killReports []*VDRKillReport
 	if nodes := self.node.allNodes(); len(nodes) > 0 {
 		killReports = make([]*VDRKillReport, 0, len(nodes))
@@ -0,0 +1,87 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Limits the rate at which jobs are submitted to a cluster.
+
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// A token bucket which paces job submissions.
+//
+// Up to burst jobs can be submitted at once, after which submissions are
+// spaced out to the configured rate.  Jobs which are over the rate wait
+// their turn, in the order in which they arrived.
+type submitLimiter struct {
+	// The time between submissions once the burst is used up.
+	interval time.Duration
+	burst    float64
+
+	lock sync.Mutex
+
+	// The number of submissions available as of last.  This goes negative
+	// when jobs are waiting.
+	tokens float64
+	last   time.Time
+
+	// The number of jobs waiting to be submitted.
+	waiting int
+}
+
+func newSubmitLimiter(rate float64, burst int) *submitLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &submitLimiter{
+		interval: time.Duration(float64(time.Second) / rate),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+	}
+}
+
+// Reserve a submission at the given time.  Returns how long to wait before
+// submitting.
+func (self *submitLimiter) reserve(now time.Time) time.Duration {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if !self.last.IsZero() && now.After(self.last) {
+		self.tokens += float64(now.Sub(self.last)) / float64(self.interval)
+		if self.tokens > self.burst {
+			self.tokens = self.burst
+		}
+	}
+	self.last = now
+	self.tokens--
+	if self.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-self.tokens * float64(self.interval))
+}
+
+// Block until the job can be submitted.
+func (self *submitLimiter) wait() {
+	if self == nil {
+		return
+	}
+	if delay := self.reserve(time.Now()); delay > 0 {
+		self.lock.Lock()
+		self.waiting++
+		self.lock.Unlock()
+		time.Sleep(delay)
+		self.lock.Lock()
+		self.waiting--
+		self.lock.Unlock()
+	}
+}
+
+// Returns the number of jobs which are waiting to be submitted.
+func (self *submitLimiter) backlog() int {
+	if self == nil {
+		return 0
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.waiting
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubmitLimiter(t *testing.T) {
+	limiter := newSubmitLimiter(2, 3)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	check := func(now time.Time, expect time.Duration) {
+		t.Helper()
+		if delay := limiter.reserve(now); delay != expect {
+			t.Errorf("Expected a delay of %v, got %v", expect, delay)
+		}
+	}
+	// The burst is submitted immediately.
+	check(start, 0)
+	check(start, 0)
+	check(start, 0)
+	// Later jobs are queued behind each other, at 2 per second.
+	check(start, 500*time.Millisecond)
+	check(start, time.Second)
+	// After a second, the two queued jobs have been submitted.
+	check(start.Add(time.Second), 500*time.Millisecond)
+	// After a long time, only the burst is available.
+	later := start.Add(time.Hour)
+	check(later, 0)
+	check(later, 0)
+	check(later, 0)
+	check(later, 500*time.Millisecond)
+}
+
+func TestSubmitLimiterWait(t *testing.T) {
+	limiter := newSubmitLimiter(100, 1)
+	limiter.wait()
+	done := make(chan struct{})
+	go func() {
+		limiter.wait()
+		close(done)
+	}()
+	<-done
+	if n := limiter.backlog(); n != 0 {
+		t.Errorf("Expected no backlog, got %d", n)
+	}
+	var none *submitLimiter
+	none.wait()
+	if n := none.backlog(); n != 0 {
+		t.Errorf("Expected no backlog, got %d", n)
+	}
+}
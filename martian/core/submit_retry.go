@@ -0,0 +1,73 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Retries cluster job submissions which fail with transient errors.
+
+package core
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const defaultSubmitRetryBackoff = 5 * time.Second
+
+// Controls retrying of job submissions which fail with an error matching
+// one of the retryOn patterns.
+type submitRetryPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+	retryOn    []*regexp.Regexp
+}
+
+// Reads the patterns for transient submission errors from retry.json.
+func getSubmitRetryRegexps() []*regexp.Regexp {
+	retryInfo := readRetryConfig()
+	if retryInfo == nil {
+		return nil
+	}
+	regexps := make([]*regexp.Regexp, len(retryInfo.SubmitRetryOn))
+	for i, exp := range retryInfo.SubmitRetryOn {
+		regexps[i] = regexp.MustCompile(exp)
+	}
+	return regexps
+}
+
+func newSubmitRetryPolicy(maxRetries int, backoff time.Duration,
+	retryOn []*regexp.Regexp) *submitRetryPolicy {
+	if backoff <= 0 {
+		backoff = defaultSubmitRetryBackoff
+	}
+	return &submitRetryPolicy{
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		retryOn:    retryOn,
+	}
+}
+
+// Returns the time to wait before retrying a submission which failed with
+// the given error, after the given number of previous retries, and whether
+// it should be retried at all.
+func (self *submitRetryPolicy) retryDelay(errMsg string, retries int) (time.Duration, bool) {
+	if self == nil || retries >= self.maxRetries {
+		return 0, false
+	}
+	for _, re := range self.retryOn {
+		if re.MatchString(errMsg) {
+			return self.backoff << uint(retries), true
+		}
+	}
+	return 0, false
+}
+
+// Retry job submissions which fail with transient errors up to the given
+// number of times, waiting the given time before the first retry and twice
+// as long before each subsequent one.
+func (self *RemoteJobManager) retrySubmissions(maxRetries int, backoff time.Duration) {
+	self.submitRetry = newSubmitRetryPolicy(maxRetries, backoff,
+		getSubmitRetryRegexps())
+	util.LogInfo("jobmngr", "Retrying job submissions which fail with "+
+		"transient errors up to %d time%s.",
+		maxRetries, util.Pluralize(maxRetries))
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestSubmitRetryDelay(t *testing.T) {
+	policy := newSubmitRetryPolicy(3, time.Second,
+		[]*regexp.Regexp{regexp.MustCompile("commlib error")})
+	const transient = "jobcmd error (exit status 1):\nerror: commlib error: got select error"
+	for retries, expect := range []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second,
+	} {
+		if delay, retry := policy.retryDelay(transient, retries); !retry {
+			t.Errorf("Expected retry %d.", retries)
+		} else if delay != expect {
+			t.Errorf("Expected retry %d after %v, got %v", retries, expect, delay)
+		}
+	}
+	if _, retry := policy.retryDelay(transient, 3); retry {
+		t.Error("Expected no more retries.")
+	}
+	if _, retry := policy.retryDelay("jobcmd error (exit status 1):\ninvalid queue", 0); retry {
+		t.Error("Expected permanent errors not to be retried.")
+	}
+	var none *submitRetryPolicy
+	if _, retry := none.retryDelay(transient, 0); retry {
+		t.Error("Expected no retries without a policy.")
+	}
+	if p := newSubmitRetryPolicy(1, 0, nil); p.backoff != defaultSubmitRetryBackoff {
+		t.Errorf("Expected the default backoff, got %v", p.backoff)
+	}
+}
+
+func TestSubmitJobRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSubmitJobRetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A submission command which fails transiently the first time.
+	jobCmd := path.Join(dir, "submit")
+	if err := ioutil.WriteFile(jobCmd, []byte(`#!/bin/sh
+cat > /dev/null
+if [ ! -e "$0.tried" ]; then
+    touch "$0.tried"
+    echo "error: commlib error: got select error" >&2
+    exit 1
+fi
+echo 12345
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	metadata := NewMetadata("ID.test.PIPE.STAGE", path.Join(dir, "STAGE"))
+	if err := metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	util.SetupSignalHandlers()
+	jm := &RemoteJobManager{
+		config: jobManagerConfig{jobCmd: jobCmd},
+		submitRetry: newSubmitRetryPolicy(1, time.Millisecond,
+			[]*regexp.Regexp{regexp.MustCompile("commlib error")}),
+	}
+	metadata.WriteTime(QueuedLocally)
+	ctx := context.Background()
+	if _, retry := jm.submitJob("", metadata, 0, ctx); !retry {
+		t.Fatal("Expected the first submission to be retried.")
+	}
+	if metadata.exists(Errors) || !metadata.exists(QueuedLocally) {
+		t.Error("Expected the job to still be queued locally.")
+	}
+	if _, retry := jm.submitJob("", metadata, 1, ctx); retry {
+		t.Fatal("Expected the second submission to succeed.")
+	}
+	if metadata.exists(Errors) {
+		e, _ := metadata.readRawSafe(Errors)
+		t.Fatalf("Unexpected error: %s", e)
+	}
+	if metadata.exists(QueuedLocally) {
+		t.Error("Expected queued_locally to be removed.")
+	}
+	if id, err := metadata.readRawSafe(JobId); err != nil {
+		t.Error(err)
+	} else if id != "12345" {
+		t.Errorf("Incorrect job id %q", id)
+	}
+}
+
+func TestSubmitJobRetryCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSubmitJobRetryCanceled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A submission command which always fails transiently.
+	jobCmd := path.Join(dir, "submit")
+	if err := ioutil.WriteFile(jobCmd, []byte(`#!/bin/sh
+cat > /dev/null
+echo "error: commlib error: got select error" >&2
+touch "$0.tried"
+exit 1
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	metadata := NewMetadata("ID.test.PIPE.STAGE", path.Join(dir, "STAGE"))
+	if err := metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	util.SetupSignalHandlers()
+	jm := &RemoteJobManager{
+		config: jobManagerConfig{
+			jobSettings: &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 1},
+			jobCmd:      jobCmd,
+		},
+		submitRetry: newSubmitRetryPolicy(3, time.Hour,
+			[]*regexp.Regexp{regexp.MustCompile("commlib error")}),
+	}
+	jm.ctx, jm.cancel = context.WithCancel(context.Background())
+	metadata.WriteTime(QueuedLocally)
+	// With no job limit, this must still return without waiting to retry.
+	jm.execJob("/bin/stage", nil, nil, metadata, &JobResources{},
+		metadata.fqname, "main", false)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(jobCmd + ".tried"); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("Job was not submitted.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	jm.HandleSignal(os.Interrupt)
+	for !metadata.exists(Errors) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the job to fail after shutdown.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if metadata.exists(QueuedLocally) {
+		t.Error("Expected queued_locally to be removed.")
+	}
+}
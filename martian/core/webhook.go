@@ -0,0 +1,65 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Notifications of stage completion to an external webhook.
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The body posted to the stage finish webhook when a stage or pipeline
+// completes or fails.
+type StageFinishEvent struct {
+	Fqname    string        `json:"fqname"`
+	State     MetadataState `json:"state"`
+	Timestamp string        `json:"timestamp"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Webhook requests which take longer than this are abandoned.
+const webhookTimeout = 10 * time.Second
+
+var webhookClient = http.Client{Timeout: webhookTimeout}
+
+// Post the event to the stage finish webhook, if one is configured.
+//
+// The request is made in the background, so this never blocks.  Failures
+// are logged, but are otherwise ignored.
+func (self *Runtime) notifyStageFinish(event *StageFinishEvent) {
+	url := self.Config.StageFinishWebhook
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		util.LogError(err, "webhook", "Could not serialize event for %s.",
+			event.Fqname)
+		return
+	}
+	go func() {
+		resp, err := webhookClient.Post(url, "application/json",
+			bytes.NewReader(body))
+		if err != nil {
+			util.LogError(err, "webhook", "Could not notify %s of %s.",
+				url, event.Fqname)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			util.LogError(fmt.Errorf("%s", resp.Status), "webhook",
+				"Could not notify %s of %s.", url, event.Fqname)
+		}
+	}()
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifyStageFinish(t *testing.T) {
+	events := make(chan *StageFinishEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var event StageFinishEvent
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		if ct := req.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected json content, got %s", ct)
+		}
+		events <- &event
+	}))
+	defer srv.Close()
+	rt := &Runtime{Config: &RuntimeOptions{StageFinishWebhook: srv.URL}}
+	rt.notifyStageFinish(&StageFinishEvent{
+		Fqname:    "ID.test.PIPE.STAGE",
+		State:     Failed,
+		Timestamp: "2018-01-01 00:00:00",
+		Error:     "oops",
+	})
+	select {
+	case event := <-events:
+		if event.Fqname != "ID.test.PIPE.STAGE" ||
+			event.State != Failed || event.Error != "oops" {
+			t.Errorf("Incorrect event %v", event)
+		}
+	case <-time.After(webhookTimeout):
+		t.Error("Timed out waiting for the webhook.")
+	}
+}
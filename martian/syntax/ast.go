@@ -24,6 +24,14 @@ type (
 	SourceLoc struct {
 		Line int
 		File *SourceFile
+
+		// The 1-based column, in bytes, of the start of the token within
+		// its line.  Zero if unknown.
+		Col int
+
+		// The byte offset of the start of the token from the beginning of
+		// the file.
+		Offset int
 	}
 
 	SourceFile struct {
@@ -64,6 +72,9 @@ type (
 	commentBlock struct {
 		Loc   SourceLoc
 		Value string
+
+		// True if the comment was preceded by a blank line in the source.
+		blankBefore bool
 	}
 
 	Ast struct {
@@ -73,6 +84,12 @@ type (
 		// All unique types found the the source.  Populated during compile.
 		UserTypeTable map[string]*UserType
 
+		// All enum types found in the source.
+		EnumTypes []*EnumType
+
+		// All struct types found in the source.
+		StructTypes []*StructType
+
 		// All valid types, both user-defined and builtin.
 		TypeTable map[string]Type
 
@@ -85,6 +102,9 @@ type (
 		Errors    []error
 		Includes  []*Include
 		comments  []*commentBlock
+
+		// Non-fatal problems found during compile.
+		warnings []Warning
 	}
 )
 
@@ -104,6 +124,10 @@ func NewAst(decs []Dec, call *CallStm, srcFile *SourceFile) *Ast {
 		switch dec := dec.(type) {
 		case *UserType:
 			self.UserTypes = append(self.UserTypes, dec)
+		case *EnumType:
+			self.EnumTypes = append(self.EnumTypes, dec)
+		case *StructType:
+			self.StructTypes = append(self.StructTypes, dec)
 		case *Stage:
 			self.Stages = append(self.Stages, dec)
 			self.Callables.List = append(self.Callables.List, dec)
@@ -124,15 +148,30 @@ func NewAstNode(loc int, file *SourceFile) AstNode {
 	}
 }
 
+// Create an AstNode at a location recorded by the lexer, including the
+// column and offset.
+func astNodeAt(loc SourceLoc) AstNode {
+	return AstNode{
+		Loc: loc,
+	}
+}
+
 // Gets the name of the file that defines the node.
 func DefiningFile(node AstNodable) string {
 	return node.getNode().Loc.File.FullPath
 }
 
+// Gets the location in the source of the node.
+func DefiningLoc(node AstNodable) SourceLoc {
+	return node.getNode().Loc
+}
+
 func (s *Ast) inheritComments() bool { return false }
 func (s *Ast) getSubnodes() []AstNodable {
 	subs := make([]AstNodable, 0,
 		1+len(s.UserTypes)+
+			len(s.EnumTypes)+
+			len(s.StructTypes)+
 			len(s.Callables.List)+
 			len(s.Includes))
 	for _, n := range s.Includes {
@@ -141,6 +180,12 @@ func (s *Ast) getSubnodes() []AstNodable {
 	for _, n := range s.UserTypes {
 		subs = append(subs, n)
 	}
+	for _, n := range s.EnumTypes {
+		subs = append(subs, n)
+	}
+	for _, n := range s.StructTypes {
+		subs = append(subs, n)
+	}
 	for _, n := range s.Callables.List {
 		subs = append(subs, n)
 	}
@@ -160,8 +205,38 @@ func (s *Include) getSubnodes() []AstNodable { return nil }
 func (s *Include) inheritComments() bool     { return false }
 func (s *Include) File() *SourceFile         { return s.Node.Loc.File }
 
+// Make a shallow copy of the ast, which can be merged with other asts
+// without modifying this one.
+func (ast *Ast) copy() *Ast {
+	files := make(map[string]*SourceFile, len(ast.Files))
+	for k, v := range ast.Files {
+		files[k] = v
+	}
+	return &Ast{
+		UserTypes:     ast.UserTypes[:len(ast.UserTypes):len(ast.UserTypes)],
+		UserTypeTable: make(map[string]*UserType, len(ast.UserTypes)),
+		EnumTypes:     ast.EnumTypes[:len(ast.EnumTypes):len(ast.EnumTypes)],
+		StructTypes:   ast.StructTypes[:len(ast.StructTypes):len(ast.StructTypes)],
+		TypeTable:     make(map[string]Type, len(ast.TypeTable)),
+		Files:         files,
+		Stages:        ast.Stages[:len(ast.Stages):len(ast.Stages)],
+		Pipelines:     ast.Pipelines[:len(ast.Pipelines):len(ast.Pipelines)],
+		Callables: &Callables{
+			List: ast.Callables.List[:len(ast.Callables.List):len(ast.Callables.List)],
+			Table: make(map[string]Callable,
+				len(ast.Callables.List)),
+		},
+		Call:     ast.Call,
+		Errors:   ast.Errors[:len(ast.Errors):len(ast.Errors)],
+		Includes: ast.Includes[:len(ast.Includes):len(ast.Includes)],
+		comments: ast.comments[:len(ast.comments):len(ast.comments)],
+	}
+}
+
 func (ast *Ast) merge(other *Ast) error {
 	ast.UserTypes = append(other.UserTypes, ast.UserTypes...)
+	ast.EnumTypes = append(other.EnumTypes, ast.EnumTypes...)
+	ast.StructTypes = append(other.StructTypes, ast.StructTypes...)
 	ast.Stages = append(other.Stages, ast.Stages...)
 	ast.Pipelines = append(other.Pipelines, ast.Pipelines...)
 	if ast.Call == nil {
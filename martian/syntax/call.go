@@ -16,11 +16,19 @@ type (
 		Id string
 
 		// The name of the callable object being called.  This will
-		// be the same as Id unless the call is aliased.
+		// be the same as Id unless the call is aliased.  For a call to
+		// a generic pipeline, this is the name of the instance, which
+		// includes the type arguments, e.g. ALIGN<fastq>.
 		DecId string
 
+		// The type arguments for a call to a generic pipeline.
+		TypeArgs []string `json:",omitempty"`
+
 		// The set of bindings for the input arguments of the callable.
 		Bindings *BindStms
+
+		// The location of the DecId in the source.
+		decLoc SourceLoc
 	}
 
 	// A binding defines the assignment of a value expression to a
@@ -64,6 +72,15 @@ type (
 		// If true, this stage's output files should be cleaned out after
 		// all dependent stages have completed.
 		Volatile bool
+
+		// The values of the above flags as set by keywords in the source,
+		// before compilation applied any bindings, so that compiling the
+		// same call again gives the same result.
+		parsed *modifierFlags
+	}
+
+	modifierFlags struct {
+		Local, Preflight, Volatile bool
 	}
 )
 
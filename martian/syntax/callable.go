@@ -48,6 +48,7 @@ type (
 		GetArrayDim() int
 		GetId() string
 		GetHelp() string
+		GetDoc() string
 		GetOutName() string
 		IsFile() bool
 		setIsFile(bool)
@@ -60,6 +61,14 @@ type (
 		Help     string
 		ArrayDim int16
 		Isfile   bool
+
+		// The value to bind if a call does not supply an argument for this
+		// parameter, or nil if the argument is required.
+		Default *ValExp `json:",omitempty"`
+
+		// Documentation from the comments immediately preceding the
+		// parameter.
+		Doc string `json:",omitempty"`
 	}
 
 	OutParam struct {
@@ -70,6 +79,10 @@ type (
 		OutName  string
 		ArrayDim int16
 		Isfile   bool
+
+		// Documentation from the comments immediately preceding the
+		// parameter.
+		Doc string `json:",omitempty"`
 	}
 
 	Stage struct {
@@ -82,7 +95,21 @@ type (
 		ChunkIns  *InParams
 		ChunkOuts *OutParams
 		Resources *Resources
+		Env       *StageEnv
 		Split     bool
+
+		// If non-empty, the stage is deprecated, and this message is
+		// included in the warning issued for each call to the stage.
+		Deprecated string `json:",omitempty"`
+
+		// Documentation from the comments immediately preceding the
+		// stage declaration.  If the stage was not parsed from source,
+		// the formatter prints this as a comment.
+		Doc string `json:",omitempty"`
+
+		// The location of the Id.  This differs from the location of
+		// the Node if the stage is annotated.
+		idLoc SourceLoc
 	}
 
 	// To simplify implementation of the parser, this stores the stage's
@@ -103,6 +130,19 @@ type (
 		Id   string
 	}
 
+	// Environment variables to set for jobs of a stage, in addition to
+	// (or overriding) the ones inherited from the pipestance.
+	StageEnv struct {
+		Node AstNode
+		Vars []*EnvVar
+	}
+
+	EnvVar struct {
+		Node  AstNode
+		Key   string
+		Value string
+	}
+
 	// The name of the stage language.  Must be one of
 	// py, exec, or comp.
 	//
@@ -114,14 +154,22 @@ type (
 	// exec stages are run directly by mrp and must take care of
 	// everything themselves.  This mode is not recommended and
 	// exists mainly for backwards compatibility.
+	//
+	// docker and podman stages are run like exec stages, but inside
+	// the given container image, e.g.
+	//
+	//     src docker "myimage:tag" "entrypoint args",
 	StageLanguage string
 
 	// Stage executable declaration.
 	SrcParam struct {
 		Node AstNode
 		Lang StageLanguage
-		Path string
-		Args []string
+
+		// The container image, for docker and podman stages.
+		Image string
+		Path  string
+		Args  []string
 	}
 
 	// Stage resouce definitions.
@@ -130,23 +178,62 @@ type (
 		ThreadNode   *AstNode
 		MemNode      *AstNode
 		SpecialNode  *AstNode
+		GPUNode      *AstNode
+		TimeoutNode  *AstNode
+		RetriesNode  *AstNode
+		DiskNode     *AstNode
+		PriorityNode *AstNode
 		VolatileNode *AstNode
 
 		Special        string
 		Threads        int16
 		MemGB          int16
+		GPUs           int16
 		StrictVolatile bool
+
+		// The wall-clock time limit for each job of the stage, in seconds.
+		Timeout int32
+
+		// The maximum number of times to automatically retry the stage
+		// after a transient failure.
+		Retries int16
+
+		// The disk space, in GB, which the stage may use while it runs.
+		DiskGB int32
+
+		// When the stage is ready to run at the same time as others, those
+		// with higher priority are started first.
+		Priority int16
 	}
 
 	Pipeline struct {
-		Node      AstNode
-		Id        string
-		InParams  *InParams
-		OutParams *OutParams
-		Calls     []*CallStm
-		Callables *Callables `json:"-"`
-		Ret       *ReturnStm
-		Retain    *PipelineRetains
+		Node       AstNode
+		Id         string
+		TypeParams []*TypeParam `json:",omitempty"`
+		InParams   *InParams
+		OutParams  *OutParams
+		Calls      []*CallStm
+		Callables  *Callables `json:"-"`
+		Ret        *ReturnStm
+		Retain     *PipelineRetains
+
+		// Documentation from the comments immediately preceding the
+		// pipeline declaration.  If the pipeline was not parsed from
+		// source, the formatter prints this as a comment.
+		Doc string `json:",omitempty"`
+
+		// For a generic pipeline, the instances created for the type
+		// arguments of its calls.  Populated during compile.
+		instances []*Pipeline
+	}
+
+	// A type parameter of a generic pipeline.  Calls to the pipeline
+	// supply a type argument to substitute for each use of the parameter
+	// as the type of an input or output, or as a type argument in a call
+	// to another generic pipeline.
+	TypeParam struct {
+		Node AstNode
+		Id   string
 	}
 
 	// Specifies the set of references which may or may not also be
@@ -196,6 +283,22 @@ func (s *RetainParam) File() *SourceFile         { return s.Node.Loc.File }
 func (s *RetainParam) getSubnodes() []AstNodable { return nil }
 func (s *RetainParam) inheritComments() bool     { return false }
 
+func (s *StageEnv) getNode() *AstNode     { return &s.Node }
+func (s *StageEnv) File() *SourceFile     { return s.Node.Loc.File }
+func (s *StageEnv) inheritComments() bool { return true }
+func (s *StageEnv) getSubnodes() []AstNodable {
+	vars := make([]AstNodable, 0, len(s.Vars))
+	for _, v := range s.Vars {
+		vars = append(vars, v)
+	}
+	return vars
+}
+
+func (s *EnvVar) getNode() *AstNode         { return &s.Node }
+func (s *EnvVar) File() *SourceFile         { return s.Node.Loc.File }
+func (s *EnvVar) getSubnodes() []AstNodable { return nil }
+func (s *EnvVar) inheritComments() bool     { return false }
+
 func (*Stage) getDec()                    {}
 func (*Pipeline) getDec()                 {}
 func (s *Stage) GetId() string            { return s.Id }
@@ -206,6 +309,7 @@ func (s *Stage) GetOutParams() *OutParams { return s.OutParams }
 func (s *Stage) Type() string             { return "stage" }
 
 func (s *Stage) inheritComments() bool { return false }
+func (s *Stage) setDoc(doc string)     { s.Doc = doc }
 func (s *Stage) getSubnodes() []AstNodable {
 	subs := make([]AstNodable, 0, 2+
 		len(s.InParams.List)+len(s.OutParams.List)+
@@ -226,6 +330,9 @@ func (s *Stage) getSubnodes() []AstNodable {
 	if s.Resources != nil {
 		subs = append(subs, s.Resources)
 	}
+	if s.Env != nil {
+		subs = append(subs, s.Env)
+	}
 	if s.Retain != nil {
 		subs = append(subs, s.Retain)
 	}
@@ -236,7 +343,7 @@ func (s *Resources) getNode() *AstNode     { return &s.Node }
 func (s *Resources) File() *SourceFile     { return s.Node.Loc.File }
 func (s *Resources) inheritComments() bool { return false }
 func (s *Resources) getSubnodes() []AstNodable {
-	subs := make([]AstNodable, 0, 3)
+	subs := make([]AstNodable, 0, 7)
 	if s.ThreadNode != nil {
 		subs = append(subs, s.ThreadNode)
 	}
@@ -246,6 +353,15 @@ func (s *Resources) getSubnodes() []AstNodable {
 	if s.SpecialNode != nil {
 		subs = append(subs, s.SpecialNode)
 	}
+	if s.GPUNode != nil {
+		subs = append(subs, s.GPUNode)
+	}
+	if s.TimeoutNode != nil {
+		subs = append(subs, s.TimeoutNode)
+	}
+	if s.RetriesNode != nil {
+		subs = append(subs, s.RetriesNode)
+	}
 	if s.VolatileNode != nil {
 		subs = append(subs, s.VolatileNode)
 	}
@@ -260,9 +376,13 @@ func (s *Pipeline) GetOutParams() *OutParams { return s.OutParams }
 func (s *Pipeline) Type() string             { return "pipeline" }
 
 func (s *Pipeline) inheritComments() bool { return false }
+func (s *Pipeline) setDoc(doc string)     { s.Doc = doc }
 func (s *Pipeline) getSubnodes() []AstNodable {
-	subs := make([]AstNodable, 0, 1+
+	subs := make([]AstNodable, 0, 1+len(s.TypeParams)+
 		len(s.InParams.List)+len(s.OutParams.List)+len(s.Calls))
+	for _, n := range s.TypeParams {
+		subs = append(subs, n)
+	}
 	for _, n := range s.InParams.List {
 		subs = append(subs, n)
 	}
@@ -279,6 +399,11 @@ func (s *Pipeline) getSubnodes() []AstNodable {
 	return subs
 }
 
+func (s *TypeParam) getNode() *AstNode         { return &s.Node }
+func (s *TypeParam) File() *SourceFile         { return s.Node.Loc.File }
+func (s *TypeParam) inheritComments() bool     { return false }
+func (s *TypeParam) getSubnodes() []AstNodable { return nil }
+
 func (s *InParam) getNode() *AstNode  { return &s.Node }
 func (s *InParam) File() *SourceFile  { return s.Node.Loc.File }
 func (s *InParam) getMode() string    { return "in" }
@@ -286,11 +411,13 @@ func (s *InParam) GetTname() string   { return s.Tname }
 func (s *InParam) GetArrayDim() int   { return int(s.ArrayDim) }
 func (s *InParam) GetId() string      { return s.Id }
 func (s *InParam) GetHelp() string    { return s.Help }
+func (s *InParam) GetDoc() string     { return s.Doc }
 func (s *InParam) GetOutName() string { return "" }
 func (s *InParam) IsFile() bool       { return s.Isfile }
 func (s *InParam) setIsFile(b bool)   { s.Isfile = b }
 
 func (s *InParam) inheritComments() bool { return false }
+func (s *InParam) setDoc(doc string)     { s.Doc = doc }
 func (s *InParam) getSubnodes() []AstNodable {
 	return nil
 }
@@ -302,11 +429,13 @@ func (s *OutParam) GetTname() string   { return s.Tname }
 func (s *OutParam) GetArrayDim() int   { return int(s.ArrayDim) }
 func (s *OutParam) GetId() string      { return s.Id }
 func (s *OutParam) GetHelp() string    { return s.Help }
+func (s *OutParam) GetDoc() string     { return s.Doc }
 func (s *OutParam) GetOutName() string { return s.OutName }
 func (s *OutParam) IsFile() bool       { return s.Isfile }
 func (s *OutParam) setIsFile(b bool)   { s.Isfile = b }
 
 func (s *OutParam) inheritComments() bool { return false }
+func (s *OutParam) setDoc(doc string)     { s.Doc = doc }
 func (s *OutParam) getSubnodes() []AstNodable {
 	return nil
 }
@@ -11,6 +11,7 @@ import (
 
 func (callables *Callables) compile(global *Ast) error {
 	var errs ErrorList
+	callables.Table = make(map[string]Callable, len(callables.List))
 	for _, callable := range callables.List {
 		// Check for duplicates
 		if existing, ok := callables.Table[callable.GetId()]; ok {
@@ -32,6 +33,9 @@ func (callables *Callables) compile(global *Ast) error {
 }
 
 // If call statement present, check the call and its bindings.
+//
+// All of the problems with the bindings and modifiers are reported, rather
+// than only the first.
 func (global *Ast) compileCall() error {
 	if global.Call != nil {
 		callable, ok := global.Callables.Table[global.Call.DecId]
@@ -40,24 +44,26 @@ func (global *Ast) compileCall() error {
 				"ScopeNameError: '%s' is not defined in this scope",
 				global.Call.DecId)
 		}
+		global.checkDeprecated(global.Call, callable)
+		var errs ErrorList
 		if err := global.Call.Bindings.compile(global,
 			nil, callable.GetInParams()); err != nil {
-			return err
+			errs = append(errs, err)
 		}
 		if err := global.Call.Modifiers.compile(global,
 			nil, global.Call); err != nil {
-			return err
-		}
-		if global.Call.Modifiers.Bindings != nil {
+			errs = append(errs, err)
+		} else if global.Call.Modifiers.Bindings != nil {
 			if _, ok := global.Call.Modifiers.Bindings.Table[disabled]; ok {
-				return global.err(global.Call,
-					"UnsupportedTagError: Top-level call cannot be disabled.")
+				errs = append(errs, global.err(global.Call,
+					"UnsupportedTagError: Top-level call cannot be disabled."))
 			}
 			if global.Call.Modifiers.Preflight {
-				return global.err(global.Call,
-					"UnsupportedTagError: Top-level call cannot be preflight.")
+				errs = append(errs, global.err(global.Call,
+					"UnsupportedTagError: Top-level call cannot be preflight."))
 			}
 		}
+		return errs.If()
 	}
 	return nil
 }
@@ -10,6 +10,7 @@ import (
 
 func (params *InParams) compile(global *Ast) error {
 	var errs ErrorList
+	params.Table = make(map[string]*InParam, len(params.List))
 	for _, param := range params.List {
 		// Check for duplicates
 		if _, ok := params.Table[param.GetId()]; ok {
@@ -30,12 +31,26 @@ func (params *InParams) compile(global *Ast) error {
 		// Cache if param is file or path.
 		t, ok := global.TypeTable[param.GetTname()]
 		param.setIsFile(ok && t.IsFile())
+
+		// Check that the default value, if any, is a literal of the
+		// correct type.  With no callable, references are rejected.
+		if param.Default != nil && ok {
+			binding := BindStm{
+				Node: param.Default.Node,
+				Id:   param.Id,
+				Exp:  param.Default,
+			}
+			if err := binding.compile(global, nil, params); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
 	return errs.If()
 }
 
 func (params *OutParams) compile(global *Ast) error {
 	var errs ErrorList
+	params.Table = make(map[string]*OutParam, len(params.List))
 	for _, param := range params.List {
 		// Check for duplicates
 		if _, ok := params.Table[param.GetId()]; ok {
@@ -79,6 +94,9 @@ func (exp *ValExp) resolveType(global *Ast, callable Callable) ([]string, int, e
 		}
 		arrayTypes := make([]string, 0, len(subexps))
 		commonArrayDim := -1
+		// Null elements, and arrays of nulls, may appear in arrays of any
+		// higher dimension.
+		nullArrayDim := 0
 		var errs ErrorList
 		for _, subexp := range subexps {
 			arrayKind, arrayDim, err := subexp.resolveType(global, callable)
@@ -87,14 +105,25 @@ func (exp *ValExp) resolveType(global *Ast, callable Callable) ([]string, int, e
 				continue
 			}
 			arrayTypes = append(arrayTypes, arrayKind...)
-			if commonArrayDim == -1 {
+			if isNullType(arrayKind) {
+				if arrayDim > nullArrayDim {
+					nullArrayDim = arrayDim
+				}
+			} else if commonArrayDim == -1 {
 				commonArrayDim = arrayDim
 			} else if commonArrayDim != arrayDim {
 				errs = append(errs, global.err(exp,
-					"Inconsistent array dimensions %d vs %d",
+					"TypeMismatchError: inconsistent array dimensions %d vs %d",
 					commonArrayDim, arrayDim))
 			}
 		}
+		if commonArrayDim == -1 {
+			commonArrayDim = nullArrayDim
+		} else if nullArrayDim > commonArrayDim {
+			errs = append(errs, global.err(exp,
+				"TypeMismatchError: inconsistent array dimensions %d vs %d",
+				commonArrayDim, nullArrayDim))
+		}
 		return arrayTypes, commonArrayDim + 1, errs.If()
 	// File: look for matching t in user/file type table
 	case KindFile:
@@ -157,12 +186,13 @@ func (exp *RefExp) resolveType(global *Ast, callable Callable) ([]string, int, e
 func (bindings *BindStms) compile(global *Ast, callable Callable, params *InParams) error {
 	// Check the bindings
 	var errs ErrorList
+	bindings.Table = make(map[string]*BindStm, len(bindings.List))
 	for _, binding := range bindings.List {
 		// Collect bindings by id so we can check that all params are bound.
-		if _, ok := bindings.Table[binding.Id]; ok {
+		if first, ok := bindings.Table[binding.Id]; ok {
 			errs = append(errs, global.err(binding,
-				"DuplicateBinding: '%s' already bound in this call",
-				binding.Id))
+				"DuplicateBinding: '%s' already bound in this call on line %d",
+				binding.Id, first.Node.Loc.Line))
 		}
 		// Building the bindings table could also happen in the grammar rules,
 		// but then we lose the ability to detect duplicate parameters as we're
@@ -175,9 +205,26 @@ func (bindings *BindStms) compile(global *Ast, callable Callable, params *InPara
 	}
 
 	if params != nil {
-		// Check that all input params of the called segment are bound.
+		// Check that all input params of the called segment are bound,
+		// binding the default value for any which are not.
 		for _, param := range params.List {
-			if _, ok := bindings.Table[param.GetId()]; !ok {
+			if _, ok := bindings.Table[param.GetId()]; ok {
+				continue
+			} else if param.Default != nil {
+				// The binding and value are located at the call, without
+				// comments, so that they format in the right place.
+				node := AstNode{Loc: bindings.Node.Loc}
+				exp := *param.Default
+				exp.Node = node
+				binding := &BindStm{
+					Node:  node,
+					Id:    param.Id,
+					Exp:   &exp,
+					Tname: param.Tname,
+				}
+				bindings.List = append(bindings.List, binding)
+				bindings.Table[binding.Id] = binding
+			} else {
 				errs = append(errs, global.err(bindings,
 					"ArgumentNotSuppliedError: no argument supplied for parameter '%s'",
 					param.GetId()))
@@ -201,40 +248,11 @@ func (binding *BindStm) compile(global *Ast, callable Callable, params *InParams
 		return err
 	}
 
-	// Check for array match
-	if binding.Sweep {
-		if arrayDim == 0 {
-			return global.err(binding,
-				"TypeMismatchError: got non-array value for sweep parameter '%s'",
-				param.GetId())
-		}
-		arrayDim -= 1
-	}
-	if param.GetArrayDim() != arrayDim {
-		if param.GetArrayDim() == 0 && arrayDim > 0 {
-			return global.err(binding,
-				"TypeMismatchError: got array value for non-array parameter '%s'",
-				param.GetId())
-		} else if param.GetArrayDim() > 0 && arrayDim == 0 {
-			// Allow an array-decorated parameter to accept null values.
-			if len(valueTypes) < 1 || valueTypes[0] != KindNull {
-				return global.err(binding,
-					"TypeMismatchError: expected array of '%s' for '%s'",
-					param.GetTname(), param.GetId())
-			}
-		} else {
-			return global.err(binding,
-				"TypeMismatchError: got %d-dimensional array value for %d-dimensional array parameter '%s'",
-				arrayDim, param.GetArrayDim(), param.GetId())
-		}
+	if err := global.checkBindingType(binding, param, valueTypes, arrayDim); err != nil {
+		return err
 	}
-
-	for _, valueType := range valueTypes {
-		if !global.checkTypeMatch(param.GetTname(), valueType) {
-			return global.err(binding,
-				"TypeMismatchError: expected type '%s' for '%s' but got '%s' instead",
-				param.GetTname(), param.GetId(), valueType)
-		}
+	if err := global.checkLiteralValue(param.GetTname(), binding.Exp, callable); err != nil {
+		return err
 	}
 	binding.Tname = param.GetTname()
 	return nil
@@ -243,12 +261,13 @@ func (binding *BindStm) compile(global *Ast, callable Callable, params *InParams
 func (bindings *BindStms) compileReturns(global *Ast, callable Callable, params *OutParams) error {
 	// Check the bindings
 	var errs ErrorList
+	bindings.Table = make(map[string]*BindStm, len(bindings.List))
 	for _, binding := range bindings.List {
 		// Collect bindings by id so we can check that all params are bound.
-		if _, ok := bindings.Table[binding.Id]; ok {
+		if first, ok := bindings.Table[binding.Id]; ok {
 			errs = append(errs, global.err(binding,
-				"DuplicateBinding: '%s' already bound in this call",
-				binding.Id))
+				"DuplicateBinding: '%s' already bound in this return statement on line %d",
+				binding.Id, first.Node.Loc.Line))
 		}
 		// Building the bindings table could also happen in the grammar rules,
 		// but then we lose the ability to detect duplicate parameters as we're
@@ -287,7 +306,20 @@ func (binding *BindStm) compileReturns(global *Ast, callable Callable, params *O
 		return err
 	}
 
-	// Check for array match
+	if err := global.checkBindingType(binding, param, valueTypes, arrayDim); err != nil {
+		return err
+	}
+	if err := global.checkLiteralValue(param.GetTname(), binding.Exp, callable); err != nil {
+		return err
+	}
+	binding.Tname = param.GetTname()
+	return nil
+}
+
+// Check that the resolved type of a binding's expression can be assigned
+// to the parameter it is bound to, including the array dimension.
+func (global *Ast) checkBindingType(binding *BindStm, param Param,
+	valueTypes []string, arrayDim int) error {
 	if binding.Sweep {
 		if arrayDim == 0 {
 			return global.err(binding,
@@ -297,35 +329,48 @@ func (binding *BindStm) compileReturns(global *Ast, callable Callable, params *O
 		arrayDim -= 1
 	}
 	if param.GetArrayDim() != arrayDim {
-		if param.GetArrayDim() == 0 && arrayDim > 0 {
-			return global.err(binding,
-				"TypeMismatchError: got array value for non-array parameter '%s'",
-				param.GetId())
-		} else if param.GetArrayDim() > 0 && arrayDim == 0 {
-			// Allow an array-decorated parameter to accept null values.
-			if len(valueTypes) < 1 || valueTypes[0] != KindNull {
-				return global.err(binding,
-					"TypeMismatchError: expected array of '%s' for '%s'",
-					param.GetTname(), param.GetId())
-			}
-		} else {
+		// Allow an array-decorated parameter to accept null values, and
+		// empty arrays of any lower dimension.
+		if !isNullType(valueTypes) || arrayDim > param.GetArrayDim() {
 			return global.err(binding,
-				"TypeMismatchError: got %d-dimensional array value for %d-dimensional array parameter '%s'",
-				arrayDim, param.GetArrayDim(), param.GetId())
+				"TypeMismatchError: expected type '%s' for '%s' but got '%s' instead",
+				paramTypeString(param), param.GetId(),
+				typeString(valueTypeName(valueTypes), arrayDim))
 		}
 	}
-
 	for _, valueType := range valueTypes {
 		if !global.checkTypeMatch(param.GetTname(), valueType) {
 			return global.err(binding,
 				"TypeMismatchError: expected type '%s' for '%s' but got '%s' instead",
-				param.GetTname(), param.GetId(), valueType)
+				paramTypeString(param), param.GetId(),
+				typeString(valueType, arrayDim))
 		}
 	}
-	binding.Tname = param.GetTname()
 	return nil
 }
 
+// Returns true if every resolved type is null, as for a null literal or an
+// array of nulls.
+func isNullType(valueTypes []string) bool {
+	for _, valueType := range valueTypes {
+		if valueType != KindNull {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the name to use for a list of resolved types in error messages,
+// which is the first non-null type, if any.
+func valueTypeName(valueTypes []string) string {
+	for _, valueType := range valueTypes {
+		if valueType != KindNull {
+			return valueType
+		}
+	}
+	return KindNull
+}
+
 func getBoundParamIds(uexp Exp) []string {
 	switch exp := uexp.(type) {
 	case *RefExp:
@@ -169,7 +169,11 @@ func (retains *PipelineRetains) compile(global *Ast, pipeline *Pipeline) error {
 					break
 				}
 			}
-			if !any {
+			if !any && param.Kind == KindSelf {
+				errs = append(errs, global.err(param,
+					"RetainParamError: input parameter %s of %s is not of file type.",
+					param.Id, pipeline.Id))
+			} else if !any {
 				errs = append(errs, global.err(param,
 					"RetainParamError: parameter %s of %s is not of file type.",
 					param.OutputId, param.Id))
@@ -192,12 +196,16 @@ func (pipeline *Pipeline) compile(global *Ast) error {
 	}
 
 	// Check calls.
+	pipeline.Callables.Table = make(map[string]Callable, len(pipeline.Calls))
+	calls := make(map[string]*CallStm, len(pipeline.Calls))
 	for _, call := range pipeline.Calls {
 		// Check for duplicate calls.
-		if _, ok := pipeline.Callables.Table[call.Id]; ok {
+		if first := calls[call.Id]; first != nil {
 			errs = append(errs, global.err(call,
-				"DuplicateCallError: '%s' was already called when encountered again",
-				call.Id))
+				"DuplicateCallError: '%s' was already called on line %d when encountered again",
+				call.Id, first.Node.Loc.Line))
+		} else {
+			calls[call.Id] = call
 		}
 		// Check we're calling something declared.
 		callable, ok := global.Callables.Table[call.DecId]
@@ -207,6 +215,7 @@ func (pipeline *Pipeline) compile(global *Ast) error {
 				call.DecId))
 			continue
 		}
+		global.checkDeprecated(call, callable)
 		// Save the valid callables for this scope.
 		pipeline.Callables.Table[call.Id] = callable
 	}
@@ -246,7 +255,7 @@ func (pipeline *Pipeline) compile(global *Ast) error {
 // Check pipeline declarations.
 func (global *Ast) compilePipelineDecs() error {
 	var errs ErrorList
-	for _, pipeline := range global.Pipelines {
+	for _, pipeline := range global.compiledPipelines() {
 		if err := pipeline.compile(global); err != nil {
 			errs = append(errs, err)
 		}
@@ -254,11 +263,40 @@ func (global *Ast) compilePipelineDecs() error {
 	return errs.If()
 }
 
+// Check for return bindings with the same id as a call in the pipeline,
+// which are easily mistaken for one another.
+func (pipeline *Pipeline) checkShadowedReturns(global *Ast) error {
+	if GetEnforcementLevel() <= EnforceDisable {
+		return nil
+	}
+	calls := make(map[string]*CallStm, len(pipeline.Calls))
+	for _, call := range pipeline.Calls {
+		calls[call.Id] = call
+	}
+	var errs ErrorList
+	for _, binding := range pipeline.Ret.Bindings.List {
+		call := calls[binding.Id]
+		if call == nil {
+			continue
+		}
+		if GetEnforcementLevel() >= EnforceError {
+			errs = append(errs, global.err(binding,
+				"ShadowedBindingError: return binding '%s' has the same name as the call on line %d",
+				binding.Id, call.Node.Loc.Line))
+		} else {
+			global.warn(binding,
+				"ShadowedBindingWarning: return binding '%s' has the same name as the call on line %d",
+				binding.Id, call.Node.Loc.Line)
+		}
+	}
+	return errs.If()
+}
+
 // Check all pipeline input params are bound in a call statement.
 func (global *Ast) compilePipelineArgs() error {
 	// Doing these in a separate loop gives the user better incremental
 	// error messages while writing a long pipeline declaration.
-	for _, pipeline := range global.Pipelines {
+	for _, pipeline := range global.compiledPipelines() {
 		boundParamIds := map[string]bool{}
 		for _, call := range pipeline.Calls {
 			for _, binding := range call.Bindings.List {
@@ -302,6 +340,10 @@ func (global *Ast) compilePipelineArgs() error {
 			return err
 		}
 
+		if err := pipeline.checkShadowedReturns(global); err != nil {
+			return err
+		}
+
 		// Check retain bindings.
 		if pipeline.Retain != nil {
 			if err := pipeline.Retain.compile(global, pipeline); err != nil {
@@ -67,6 +67,11 @@ func (stage *Stage) compile(global *Ast) error {
 			}
 		}
 	}
+	if stage.Env != nil {
+		if err := stage.Env.compile(global, stage); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if stage.Retain != nil {
 		if err := stage.Retain.compile(global, stage); err != nil {
 			errs = append(errs, err)
@@ -75,6 +80,15 @@ func (stage *Stage) compile(global *Ast) error {
 	return errs.If()
 }
 
+// Issue a warning if the given call refers to a deprecated stage.
+func (global *Ast) checkDeprecated(call *CallStm, callable Callable) {
+	if stage, ok := callable.(*Stage); ok && stage.Deprecated != "" {
+		global.warn(call,
+			"DeprecationWarning: call to deprecated stage '%s': %s",
+			stage.Id, stage.Deprecated)
+	}
+}
+
 const (
 	disabled  = "disabled"
 	local     = "local"
@@ -110,6 +124,19 @@ func (mods *Modifiers) compile(global *Ast, parent Callable, call *CallStm) erro
 			"'%s' cannot have any output parameters"
 	)
 
+	if mods.parsed == nil {
+		mods.parsed = &modifierFlags{
+			Local:     mods.Local,
+			Preflight: mods.Preflight,
+			Volatile:  mods.Volatile,
+		}
+	} else {
+		// This call was already compiled, e.g. as part of a cached include.
+		mods.Local = mods.parsed.Local
+		mods.Preflight = mods.parsed.Preflight
+		mods.Volatile = mods.parsed.Volatile
+	}
+
 	var errs ErrorList
 	if mods.Bindings != nil {
 		if err := mods.Bindings.compile(global, parent, &modParams); err != nil {
@@ -197,6 +224,20 @@ func (mods *Modifiers) compile(global *Ast, parent Callable, call *CallStm) erro
 	return errs.If()
 }
 
+func (env *StageEnv) compile(global *Ast, stage *Stage) error {
+	var errs ErrorList
+	keys := make(map[string]struct{}, len(env.Vars))
+	for _, v := range env.Vars {
+		if _, ok := keys[v.Key]; ok {
+			errs = append(errs, global.err(v,
+				"DuplicateNameError: environment variable %s is set more than once for stage %s",
+				v.Key, stage.Id))
+		}
+		keys[v.Key] = struct{}{}
+	}
+	return errs.If()
+}
+
 func (retains *RetainParams) compile(global *Ast, stage *Stage) error {
 	var errs ErrorList
 	ids := make(map[string]AstNode, len(retains.Params))
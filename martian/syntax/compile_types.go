@@ -4,6 +4,12 @@
 
 package syntax
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // Build type table, starting with builtins. Duplicates allowed.
 func (global *Ast) compileTypes() error {
 	for _, builtinType := range builtinTypes {
@@ -13,7 +19,90 @@ func (global *Ast) compileTypes() error {
 		global.TypeTable[userType.Id] = userType
 		global.UserTypeTable[userType.Id] = userType
 	}
-	return nil
+	// Enum and struct types may not be redeclared, or share a name with
+	// another type.
+	var errs ErrorList
+	for _, enumType := range global.EnumTypes {
+		if err := global.addType(enumType, enumType, "enum"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, structType := range global.StructTypes {
+		if err := global.addType(structType, structType, "struct"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, enumType := range global.EnumTypes {
+		if err := enumType.compile(global); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, structType := range global.StructTypes {
+		if err := structType.compile(global); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.If()
+}
+
+// Add an enum or struct type to the type table.
+func (global *Ast) addType(t Type, node AstNodable, kind string) error {
+	existing, ok := global.TypeTable[t.GetId()]
+	if !ok || existing == t {
+		global.TypeTable[t.GetId()] = t
+		return nil
+	}
+	if prev, ok := existing.(AstNodable); ok {
+		var msg strings.Builder
+		fmt.Fprintf(&msg,
+			"DuplicateNameError: type '%s' was already declared when %s was encountered",
+			t.GetId(), kind)
+		msg.WriteString(".\n  Previous declaration at ")
+		prev.getNode().Loc.writeTo(&msg, "      ")
+		msg.WriteRune('\n')
+		return global.err(node, "%s", msg.String())
+	}
+	return global.err(node,
+		"DuplicateNameError: %s '%s' has the same name as a builtin type",
+		kind, t.GetId())
+}
+
+func (enumType *EnumType) compile(global *Ast) error {
+	var errs ErrorList
+	seen := make(map[string]struct{}, len(enumType.Values))
+	for _, value := range enumType.Values {
+		if _, ok := seen[value]; ok {
+			errs = append(errs, global.err(enumType,
+				"DuplicateNameError: value '%s' appears more than once in enum '%s'",
+				value, enumType.Id))
+		} else {
+			seen[value] = struct{}{}
+		}
+	}
+	return errs.If()
+}
+
+func (structType *StructType) compile(global *Ast) error {
+	var errs ErrorList
+	structType.Table = make(map[string]*StructField, len(structType.Fields))
+	for _, field := range structType.Fields {
+		// Check for duplicates
+		if _, ok := structType.Table[field.Id]; ok {
+			errs = append(errs, global.err(field,
+				"DuplicateNameError: field '%s' was already declared when encountered again",
+				field.Id))
+		} else {
+			structType.Table[field.Id] = field
+		}
+
+		// Check that types exist.
+		if _, ok := global.TypeTable[field.Tname]; !ok {
+			errs = append(errs, global.err(field,
+				"TypeError: undefined type '%s'",
+				field.Tname))
+		}
+	}
+	return errs.If()
 }
 
 func (global *Ast) isUserType(t string) bool {
@@ -21,6 +110,29 @@ func (global *Ast) isUserType(t string) bool {
 	return ok
 }
 
+// Returns the struct type with the given name, or nil if the name does not
+// refer to a struct type.
+func (global *Ast) getStructType(t string) *StructType {
+	if s, ok := global.TypeTable[t].(*StructType); ok {
+		return s
+	}
+	return nil
+}
+
+// Returns the enum type with the given name, or nil if the name does not
+// refer to an enum type.
+func (global *Ast) getEnumType(t string) *EnumType {
+	if s, ok := global.TypeTable[t].(*EnumType); ok {
+		return s
+	}
+	return nil
+}
+
+// Get the name of a type with the given array dimension, e.g. "int[][]".
+func typeString(tname string, arrayDim int) string {
+	return tname + strings.Repeat("[]", arrayDim)
+}
+
 func (global *Ast) checkTypeMatch(paramType string, valueType string) bool {
 	return (valueType == KindNull ||
 		paramType == valueType ||
@@ -31,5 +143,131 @@ func (global *Ast) checkTypeMatch(paramType string, valueType string) bool {
 		(global.isUserType(paramType) &&
 			(valueType == KindString || valueType == KindFile)) ||
 		(global.isUserType(valueType) &&
-			(paramType == KindString || paramType == KindFile)))
+			(paramType == KindString || paramType == KindFile)) ||
+		// Allow implicit cast between map and struct types.  Map literals
+		// are checked against the struct fields separately.
+		(global.getStructType(paramType) != nil && valueType == KindMap) ||
+		(global.getStructType(valueType) != nil && paramType == KindMap) ||
+		// Allow implicit cast between string and enum types.  String
+		// literals are checked against the enum values separately.
+		(global.getEnumType(paramType) != nil && valueType == KindString) ||
+		(global.getEnumType(valueType) != nil && paramType == KindString))
+}
+
+// Check literal values bound to a struct or enum type, which cannot be fully
+// checked by comparing type names.
+func (global *Ast) checkLiteralValue(tname string, exp Exp,
+	callable Callable) error {
+	switch t := global.TypeTable[tname].(type) {
+	case *StructType:
+		return global.checkStructValue(t, exp, callable)
+	case *EnumType:
+		return global.checkEnumValue(t, exp)
+	}
+	return nil
+}
+
+// Check that a string literal, or array of string literals, bound to a value
+// of enum type is one of the allowed values.
+func (global *Ast) checkEnumValue(enumType *EnumType, uexp Exp) error {
+	exp, ok := uexp.(*ValExp)
+	if !ok {
+		// References are checked by type name.
+		return nil
+	}
+	switch exp.Kind {
+	case KindArray:
+		var errs ErrorList
+		for _, subexp := range exp.Value.([]Exp) {
+			if err := global.checkEnumValue(enumType, subexp); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errs.If()
+	case KindString:
+		if v, _ := exp.Value.(string); !enumType.HasValue(v) {
+			return global.err(exp,
+				"TypeMismatchError: '%s' is not a valid value for enum '%s'",
+				v, enumType.Id)
+		}
+	}
+	return nil
+}
+
+// Check that a map literal, or array of map literals, bound to a value of
+// struct type has exactly the fields declared for the struct, with values
+// of the correct types.
+func (global *Ast) checkStructValue(structType *StructType, uexp Exp,
+	callable Callable) error {
+	exp, ok := uexp.(*ValExp)
+	if !ok {
+		// References are checked by type name.
+		return nil
+	}
+	switch exp.Kind {
+	case KindArray:
+		var errs ErrorList
+		for _, subexp := range exp.Value.([]Exp) {
+			if err := global.checkStructValue(structType, subexp,
+				callable); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errs.If()
+	case KindMap:
+		values, _ := exp.Value.(map[string]Exp)
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var errs ErrorList
+		for _, key := range keys {
+			value := values[key]
+			field := structType.Table[key]
+			if field == nil {
+				errs = append(errs, global.err(exp,
+					"TypeMismatchError: struct '%s' has no field '%s'",
+					structType.Id, key))
+				continue
+			}
+			if err := global.checkFieldValue(structType, field, value,
+				callable); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, field := range structType.Fields {
+			if _, ok := values[field.Id]; !ok {
+				errs = append(errs, global.err(exp,
+					"TypeMismatchError: no value given for field '%s' of struct '%s'",
+					field.Id, structType.Id))
+			}
+		}
+		return errs.If()
+	}
+	return nil
+}
+
+func (global *Ast) checkFieldValue(structType *StructType, field *StructField,
+	value Exp, callable Callable) error {
+	valueTypes, arrayDim, err := value.resolveType(global, callable)
+	if err != nil {
+		return err
+	}
+	if arrayDim != field.GetArrayDim() &&
+		!(arrayDim == 0 && len(valueTypes) == 1 && valueTypes[0] == KindNull) &&
+		!(arrayDim == 1 && len(valueTypes) == 1 && valueTypes[0] == KindNull &&
+			field.GetArrayDim() > 0) {
+		return global.err(value,
+			"TypeMismatchError: got %d-dimensional array value for %d-dimensional array field '%s' of struct '%s'",
+			arrayDim, field.GetArrayDim(), field.Id, structType.Id)
+	}
+	for _, valueType := range valueTypes {
+		if !global.checkTypeMatch(field.Tname, valueType) {
+			return global.err(value,
+				"TypeMismatchError: expected type '%s' for field '%s' of struct '%s' but got '%s' instead",
+				field.Tname, field.Id, structType.Id, valueType)
+		}
+	}
+	return global.checkLiteralValue(field.Tname, value, callable)
 }
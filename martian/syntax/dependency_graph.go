@@ -0,0 +1,45 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Static call dependency analysis.
+
+package syntax
+
+// DependencyGraph returns the dependencies between calls in each pipeline,
+// as an adjacency list.
+//
+// Each call is identified by the Id of the enclosing pipeline and the Id of
+// the call, separated by a dot, e.g. "PIPELINE.STAGE".  For each call in
+// each pipeline, the returned map contains the list of other calls in the
+// same pipeline whose outputs are bound to the call's inputs or modifiers,
+// in the order in which they are first referenced.  Calls with no
+// dependencies map to an empty list.
+//
+// This is a purely static analysis.  Calls within sub-pipelines appear
+// under the sub-pipeline's Id, rather than being expanded for each call
+// to that pipeline as they would be in a pipestance.
+func (global *Ast) DependencyGraph() map[string][]string {
+	graph := make(map[string][]string)
+	for _, pipeline := range global.Pipelines {
+		for _, call := range pipeline.Calls {
+			graph[pipeline.Id+"."+call.Id] = callDependencies(pipeline, call)
+		}
+	}
+	return graph
+}
+
+// Get the list of calls in the pipeline referenced by the bindings of the
+// given call.
+func callDependencies(pipeline *Pipeline, call *CallStm) []string {
+	deps := make([]string, 0, 2)
+	seen := make(map[string]struct{}, 2)
+	Inspect(call, func(n AstNodable) bool {
+		if ref, ok := n.(*RefExp); ok && ref.Kind == KindCall {
+			if _, ok := seen[ref.Id]; !ok {
+				seen[ref.Id] = struct{}{}
+				deps = append(deps, pipeline.Id+"."+ref.Id)
+			}
+		}
+		return true
+	})
+	return deps
+}
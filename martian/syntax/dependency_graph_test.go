@@ -0,0 +1,103 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, `
+stage SQUARE(
+    in  int  value,
+    out int  square,
+    src py   "stages/square",
+)
+
+stage CHECK(
+    in  int  value,
+    out bool skip,
+    src py   "stages/check",
+)
+
+stage SUM(
+    in  int[] values,
+    in  bool  skip,
+    out int   sum,
+    src py    "stages/sum",
+)
+
+pipeline SUM_SQUARES(
+    in  int a,
+    in  int b,
+    out int sum,
+)
+{
+    call SQUARE as SQUARE_A(
+        value = self.a,
+    )
+
+    call SQUARE as SQUARE_B(
+        value = SQUARE_A.square,
+    )
+
+    call CHECK(
+        value = self.b,
+    )
+
+    call SUM(
+        values = [
+            SQUARE_B.square,
+            SQUARE_A.square,
+            SQUARE_B.square,
+        ],
+        skip   = false,
+    ) using (
+        disabled = CHECK.skip,
+    )
+
+    return (
+        sum = SUM.sum,
+    )
+}
+
+pipeline OUTER(
+    in  int a,
+    out int sum,
+)
+{
+    call SUM_SQUARES(
+        a = self.a,
+        b = self.a,
+    )
+
+    call SQUARE(
+        value = SUM_SQUARES.sum,
+    )
+
+    return (
+        sum = SQUARE.square,
+    )
+}
+`)
+	if ast == nil {
+		return
+	}
+	expect := map[string][]string{
+		"SUM_SQUARES.SQUARE_A": {},
+		"SUM_SQUARES.SQUARE_B": {"SUM_SQUARES.SQUARE_A"},
+		"SUM_SQUARES.CHECK":    {},
+		"SUM_SQUARES.SUM": {
+			"SUM_SQUARES.SQUARE_B",
+			"SUM_SQUARES.SQUARE_A",
+			"SUM_SQUARES.CHECK",
+		},
+		"OUTER.SUM_SQUARES": {},
+		"OUTER.SQUARE":      {"OUTER.SUM_SQUARES"},
+	}
+	if graph := ast.DependencyGraph(); !reflect.DeepEqual(graph, expect) {
+		t.Errorf("Expected\n%v\ngot\n%v", expect, graph)
+	}
+}
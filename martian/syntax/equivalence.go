@@ -337,10 +337,10 @@ func (exp *ValExp) equalVal(ov *ValExp) bool {
 		// way to compare two values without replicating a lot of
 		// code.
 		var buf1 strings.Builder
-		exp.format(&buf1, "")
+		exp.format(&buf1, "", INDENT)
 		var buf2 strings.Builder
 		buf2.Grow(buf1.Len())
-		ov.format(&buf2, "")
+		ov.format(&buf2, "", INDENT)
 		if buf1.String() != buf2.String() {
 			util.PrintInfo("compare",
 				"Values do not match:\n%s\nvs\n%s",
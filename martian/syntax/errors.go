@@ -36,6 +36,27 @@ func (self *AstError) Error() string {
 	return buff.String()
 }
 
+// A Warning describes a problem with the source which does not prevent it
+// from being compiled, for example a call to a deprecated stage.
+type Warning struct {
+	Node *AstNode
+	Msg  string
+}
+
+func (self Warning) writeTo(w stringWriter) {
+	w.WriteString("MRO WARNING ")
+	w.WriteString(self.Msg)
+	w.WriteString("\n    at ")
+	self.Node.Loc.writeTo(w, "        ")
+}
+
+func (self Warning) String() string {
+	var buff strings.Builder
+	buff.Grow(len("MRO WARNING \n    at sourcename.mro:100 included from sourcename.mro:10") + len(self.Msg))
+	self.writeTo(&buff)
+	return buff.String()
+}
+
 type FileNotFoundError struct {
 	loc  SourceLoc
 	name string
@@ -151,6 +172,33 @@ func (self *ParseError) Error() string {
 	return buff.String()
 }
 
+// ErrorLoc returns the source location associated with an error returned
+// by the parser or compiler, if it has one.  For an ErrorList, this is the
+// location of the first error in the list with a location.
+func ErrorLoc(err error) (SourceLoc, bool) {
+	switch err := err.(type) {
+	case *AstError:
+		return err.Node.Loc, true
+	case *ParseError:
+		return err.loc, true
+	case *mmLexError:
+		return err.info.Loc(), true
+	case *FileNotFoundError:
+		return err.loc, true
+	case *wrapError:
+		return err.loc, true
+	case *DuplicateCallError:
+		return err.Second.Node.Loc, true
+	case ErrorList:
+		for _, e := range err {
+			if loc, ok := ErrorLoc(e); ok {
+				return loc, true
+			}
+		}
+	}
+	return SourceLoc{}, false
+}
+
 type ErrorList []error
 
 func (self ErrorList) Error() string {
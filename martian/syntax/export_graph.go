@@ -0,0 +1,158 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Static call graph export.
+
+package syntax
+
+import (
+	"encoding/json"
+)
+
+type (
+	// A parameter of a callable in the exported graph.
+	graphParam struct {
+		Id   string `json:"id"`
+		Type string `json:"type"`
+		Help string `json:"help,omitempty"`
+	}
+
+	// A reference to a pipeline input, if Call is empty, or else to an
+	// output of a call in the same pipeline.
+	graphRef struct {
+		Call  string `json:"call,omitempty"`
+		Param string `json:"param"`
+	}
+
+	// A binding of an input, output, or modifier to the references in its
+	// expression.
+	graphBinding struct {
+		Id   string      `json:"id"`
+		Refs []*graphRef `json:"refs"`
+	}
+
+	graphCall struct {
+		Id        string          `json:"id"`
+		Callable  string          `json:"callable"`
+		Bindings  []*graphBinding `json:"bindings"`
+		Modifiers []*graphBinding `json:"modifiers,omitempty"`
+	}
+
+	graphCallable struct {
+		Id      string          `json:"id"`
+		Inputs  []*graphParam   `json:"inputs"`
+		Outputs []*graphParam   `json:"outputs"`
+		Calls   []*graphCall    `json:"calls,omitempty"`
+		Returns []*graphBinding `json:"returns,omitempty"`
+	}
+
+	graph struct {
+		Stages    []*graphCallable `json:"stages"`
+		Pipelines []*graphCallable `json:"pipelines"`
+	}
+)
+
+// ExportGraph serializes the static call graph of the ast as JSON.
+//
+// The result lists the stages and pipelines, in declaration order, with
+// their input and output parameters.  Each pipeline also lists its calls,
+// with the pipeline inputs and call outputs referenced by the bindings of
+// each call, and those referenced by the pipeline's return bindings.
+// Generic pipelines are replaced by their instances.
+//
+// Like DependencyGraph, this is a purely static view.  The ast must have
+// been compiled.
+func (global *Ast) ExportGraph() ([]byte, error) {
+	g := graph{
+		Stages:    make([]*graphCallable, 0, len(global.Stages)),
+		Pipelines: make([]*graphCallable, 0, len(global.Pipelines)),
+	}
+	for _, stage := range global.Stages {
+		g.Stages = append(g.Stages, &graphCallable{
+			Id:      stage.Id,
+			Inputs:  graphInParams(stage.InParams),
+			Outputs: graphOutParams(stage.OutParams),
+		})
+	}
+	for _, pipeline := range global.compiledPipelines() {
+		gp := &graphCallable{
+			Id:      pipeline.Id,
+			Inputs:  graphInParams(pipeline.InParams),
+			Outputs: graphOutParams(pipeline.OutParams),
+			Calls:   make([]*graphCall, 0, len(pipeline.Calls)),
+		}
+		for _, call := range pipeline.Calls {
+			gc := &graphCall{
+				Id:       call.Id,
+				Callable: call.DecId,
+				Bindings: graphBindings(call.Bindings),
+			}
+			if call.Modifiers != nil {
+				gc.Modifiers = graphBindings(call.Modifiers.Bindings)
+			}
+			gp.Calls = append(gp.Calls, gc)
+		}
+		if pipeline.Ret != nil {
+			gp.Returns = graphBindings(pipeline.Ret.Bindings)
+		}
+		g.Pipelines = append(g.Pipelines, gp)
+	}
+	return json.MarshalIndent(&g, "", "    ")
+}
+
+func graphInParams(params *InParams) []*graphParam {
+	if params == nil {
+		return []*graphParam{}
+	}
+	result := make([]*graphParam, 0, len(params.List))
+	for _, param := range params.List {
+		result = append(result, newGraphParam(param))
+	}
+	return result
+}
+
+func graphOutParams(params *OutParams) []*graphParam {
+	if params == nil {
+		return []*graphParam{}
+	}
+	result := make([]*graphParam, 0, len(params.List))
+	for _, param := range params.List {
+		result = append(result, newGraphParam(param))
+	}
+	return result
+}
+
+func newGraphParam(param Param) *graphParam {
+	return &graphParam{
+		Id:   param.GetId(),
+		Type: paramTypeString(param),
+		Help: param.GetHelp(),
+	}
+}
+
+func graphBindings(bindings *BindStms) []*graphBinding {
+	if bindings == nil {
+		return nil
+	}
+	result := make([]*graphBinding, 0, len(bindings.List))
+	for _, binding := range bindings.List {
+		gb := &graphBinding{
+			Id:   binding.Id,
+			Refs: make([]*graphRef, 0, 1),
+		}
+		Inspect(binding, func(n AstNodable) bool {
+			if ref, ok := n.(*RefExp); ok {
+				if ref.Kind == KindCall {
+					gb.Refs = append(gb.Refs, &graphRef{
+						Call:  ref.Id,
+						Param: ref.OutputId,
+					})
+				} else {
+					gb.Refs = append(gb.Refs, &graphRef{Param: ref.Id})
+				}
+			}
+			return true
+		})
+		result = append(result, gb)
+	}
+	return result
+}
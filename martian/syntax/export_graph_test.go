@@ -0,0 +1,121 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExportGraph(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, `
+stage SQUARE(
+    in  int   value  "the value to square",
+    out int   square,
+    src py    "stages/square",
+)
+
+stage SUM(
+    in  int[] values,
+    in  bool  skip,
+    out int   sum,
+    src py    "stages/sum",
+)
+
+pipeline SUM_SQUARES(
+    in  int  a,
+    in  int  b,
+    in  bool skip,
+    out int  sum,
+)
+{
+    call SQUARE as SQUARE_A(
+        value = self.a,
+    )
+
+    call SQUARE as SQUARE_B(
+        value = self.b,
+    )
+
+    call SUM(
+        values = [
+            SQUARE_A.square,
+            SQUARE_B.square,
+        ],
+        skip   = false,
+    ) using (
+        disabled = self.skip,
+    )
+
+    return (
+        sum = SUM.sum,
+    )
+}
+`)
+	if ast == nil {
+		return
+	}
+	b, err := ast.ExportGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g graph
+	if err := json.Unmarshal(b, &g); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Stages) != 2 || g.Stages[0].Id != "SQUARE" || g.Stages[1].Id != "SUM" {
+		t.Fatalf("Incorrect stages in\n%s", b)
+	}
+	if in := g.Stages[0].Inputs; len(in) != 1 || *in[0] != (graphParam{
+		Id:   "value",
+		Type: "int",
+		Help: "the value to square",
+	}) {
+		t.Errorf("Incorrect inputs in\n%s", b)
+	}
+	if out := g.Stages[1].Outputs; len(out) != 1 || out[0].Type != "int" {
+		t.Errorf("Incorrect outputs in\n%s", b)
+	}
+	if len(g.Pipelines) != 1 || len(g.Pipelines[0].Calls) != 3 {
+		t.Fatalf("Incorrect pipelines in\n%s", b)
+	}
+	p := g.Pipelines[0]
+	if call := p.Calls[1]; call.Id != "SQUARE_B" || call.Callable != "SQUARE" {
+		t.Errorf("Incorrect call %v", call)
+	}
+	refs := func(bindings []*graphBinding, id string) []*graphRef {
+		for _, binding := range bindings {
+			if binding.Id == id {
+				return binding.Refs
+			}
+		}
+		t.Errorf("Missing binding %s in\n%s", id, b)
+		return nil
+	}
+	if r := refs(p.Calls[2].Bindings, "values"); !reflect.DeepEqual(r, []*graphRef{
+		{Call: "SQUARE_A", Param: "square"},
+		{Call: "SQUARE_B", Param: "square"},
+	}) {
+		t.Errorf("Incorrect values references in\n%s", b)
+	}
+	if r := refs(p.Calls[2].Bindings, "skip"); len(r) != 0 {
+		t.Errorf("Expected no references for a literal in\n%s", b)
+	}
+	if r := refs(p.Calls[2].Modifiers, "disabled"); !reflect.DeepEqual(r,
+		[]*graphRef{{Param: "skip"}}) {
+		t.Errorf("Incorrect disabled references in\n%s", b)
+	}
+	if r := refs(p.Returns, "sum"); !reflect.DeepEqual(r,
+		[]*graphRef{{Call: "SUM", Param: "sum"}}) {
+		t.Errorf("Incorrect return references in\n%s", b)
+	}
+
+	// The output is stable.
+	if again, err := ast.ExportGraph(); err != nil {
+		t.Error(err)
+	} else if string(again) != string(b) {
+		t.Error("Expected identical output.")
+	}
+}
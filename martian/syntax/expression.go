@@ -45,7 +45,7 @@ type (
 		AstNodable
 		getKind() ExpKind
 		resolveType(*Ast, Callable) ([]string, int, error)
-		format(w stringWriter, prefix string)
+		format(w stringWriter, prefix, indent string)
 		equal(other Exp) bool
 
 		// Returns a representation of the concrete value of the
@@ -81,21 +81,11 @@ func (s *ValExp) File() *SourceFile { return s.Node.Loc.File }
 func (s *ValExp) getKind() ExpKind  { return s.Kind }
 
 func (s *ValExp) inheritComments() bool { return false }
-func (s *ValExp) getSubnodes() []AstNodable {
-	if s.Kind == KindArray {
-		if arr, ok := s.Value.([]Exp); !ok {
-			return nil
-		} else {
-			subs := make([]AstNodable, 0, len(arr))
-			for _, n := range arr {
-				subs = append(subs, n)
-			}
-			return subs
-		}
-	} else {
-		return nil
-	}
-}
+
+// The formatter does not print comments for elements of array or map
+// values, so comments inside of a value are left for the next node
+// following the value rather than being attached to the elements.
+func (s *ValExp) getSubnodes() []AstNodable { return nil }
 
 func (*ValExp) getExp() {}
 
@@ -16,10 +16,10 @@ import (
 )
 
 func FixIncludes(source *Ast, mropath []string) error {
-	return fixIncludesTop(source, mropath, makeStringIntern())
+	return fixIncludesTop(source, mropath, new(Parser))
 }
 
-func fixIncludesTop(source *Ast, mropath []string, intern *stringIntern) error {
+func fixIncludesTop(source *Ast, mropath []string, parser *Parser) error {
 	seen := make(map[string]*SourceFile, len(source.Files)+len(source.Includes))
 	incPaths := make([]string, 0, len(mropath)+1)
 	seenPaths := make(map[string]struct{}, len(mropath))
@@ -37,15 +37,15 @@ func fixIncludesTop(source *Ast, mropath []string, intern *stringIntern) error {
 			incPaths = append(incPaths, p)
 		}
 	}
-	if closure, err := getIncludes(srcFile, source.Includes,
-		incPaths, seen, intern); err != nil {
+	if closure, err := parser.getIncludes(srcFile, source.Includes,
+		incPaths, seen); err != nil {
 		return err
 	} else {
 		uncheckedMakeTables(source, closure)
 		needed, missingTypes, missingCalls := getRequiredIncludes(source)
 		extraIncs, extraTypes, err := findMissingIncludes(seen,
 			missingTypes, missingCalls,
-			incPaths, intern)
+			incPaths, parser.getIntern())
 		for _, file := range extraIncs {
 			if _, ok := needed[file.FileName]; !ok {
 				needed[file.FileName] = file
@@ -88,6 +88,20 @@ func uncheckedMakeTables(top *Ast, included *Ast) {
 				top.UserTypeTable[userType.Id] = userType
 			}
 		}
+		if top.TypeTable == nil {
+			top.TypeTable = make(map[string]Type,
+				len(included.EnumTypes)+len(included.StructTypes))
+		}
+		for _, enumType := range included.EnumTypes {
+			if _, ok := top.TypeTable[enumType.Id]; !ok {
+				top.TypeTable[enumType.Id] = enumType
+			}
+		}
+		for _, structType := range included.StructTypes {
+			if _, ok := top.TypeTable[structType.Id]; !ok {
+				top.TypeTable[structType.Id] = structType
+			}
+		}
 	}
 }
 
@@ -117,6 +131,26 @@ func getRequiredIncludes(source *Ast) (map[string]*SourceFile,
 			}
 		}
 	}
+	checkType := func(tName string) {
+		if t := source.UserTypeTable[tName]; t != nil {
+			if _, ok := required[t.getNode().Loc.File.FileName]; !ok {
+				unknownTypes[tName] = t
+			}
+		} else if t, ok := source.TypeTable[tName]; !ok {
+			unknownTypes[tName] = &UserType{
+				Id: tName,
+			}
+		} else {
+			// Unlike file types, struct and enum types can't just be
+			// redeclared.
+			switch t := t.(type) {
+			case *StructType:
+				required[t.Node.Loc.File.FileName] = t.Node.Loc.File
+			case *EnumType:
+				required[t.Node.Loc.File.FileName] = t.Node.Loc.File
+			}
+		}
+	}
 	// Check that the input and output types for all stages are declared.
 	// For pipelines, we can assume that their input/output types match
 	// those of the stages, meaning we don't need to worry about them.
@@ -126,16 +160,7 @@ func getRequiredIncludes(source *Ast) (map[string]*SourceFile,
 			stage.ChunkIns,
 		} {
 			for _, param := range params.List {
-				tName := param.GetTname()
-				if t := source.UserTypeTable[tName]; t != nil {
-					if _, ok := required[t.getNode().Loc.File.FileName]; !ok {
-						unknownTypes[tName] = t
-					}
-				} else if _, ok := source.TypeTable[tName]; !ok {
-					unknownTypes[tName] = &UserType{
-						Id: tName,
-					}
-				}
+				checkType(param.GetTname())
 			}
 		}
 		for _, params := range []*OutParams{
@@ -143,19 +168,15 @@ func getRequiredIncludes(source *Ast) (map[string]*SourceFile,
 			stage.ChunkOuts,
 		} {
 			for _, param := range params.List {
-				tName := param.GetTname()
-				if t := source.UserTypeTable[tName]; t != nil {
-					if _, ok := required[t.getNode().Loc.File.FileName]; !ok {
-						unknownTypes[tName] = t
-					}
-				} else if _, ok := source.TypeTable[tName]; !ok {
-					unknownTypes[tName] = &UserType{
-						Id: tName,
-					}
-				}
+				checkType(param.GetTname())
 			}
 		}
 	}
+	for _, structType := range source.StructTypes {
+		for _, field := range structType.Fields {
+			checkType(field.Tname)
+		}
+	}
 	return required, unknownTypes, unknownCallables
 }
 
@@ -237,6 +258,65 @@ func findMissingIncludes(seenFiles map[string]*SourceFile,
 	return neededFiles, types, errs.If()
 }
 
+// Sort includes by name, except that "private" files, with names beginning
+// with an underscore, and files named after the including file, come last.
+func sortIncludes(includes []*Include, file *SourceFile) {
+	var selfName string
+	if file != nil {
+		selfName = strings.Trim(strings.TrimSuffix(filepath.Base(file.FileName), ".mro"), "_")
+	}
+	sort.Slice(includes, func(i, j int) bool {
+		// Sort underscore-prefixed files after others.
+		// By convention these are "private".
+		p1 := strings.HasPrefix(includes[i].Value, "_")
+		p2 := strings.HasPrefix(includes[j].Value, "_")
+		if p1 != p2 {
+			return p2
+		}
+		// Sort files which contain this file's name last, e.g.
+		//   _my_pipeline_stages.mro
+		// in
+		//   my_pipeline.mro
+		if selfName != "" {
+			p1 = strings.Contains(includes[i].Value, selfName)
+			p2 = strings.Contains(includes[j].Value, selfName)
+			if p1 != p2 {
+				return p2
+			}
+		}
+		return includes[i].Value < includes[j].Value
+	})
+}
+
+// Sort the includes in the same order as FixIncludes would, and remove exact
+// duplicates, without adding or removing any other includes.  Comments
+// attached to a removed duplicate are moved to the include which is kept.
+func (source *Ast) organizeIncludes() {
+	if len(source.Includes) == 0 {
+		return
+	}
+	// Grab the scope comments off the first node, so that we can reattach them post-sort.
+	scopeComments := source.Includes[0].Node.scopeComments
+	source.Includes[0].Node.scopeComments = nil
+	kept := make(map[string]*Include, len(source.Includes))
+	newIncludes := make([]*Include, 0, len(source.Includes))
+	for _, inc := range source.Includes {
+		if prev := kept[inc.Value]; prev != nil {
+			prev.Node.scopeComments = append(prev.Node.scopeComments,
+				inc.Node.scopeComments...)
+			prev.Node.Comments = append(prev.Node.Comments,
+				inc.Node.Comments...)
+		} else {
+			kept[inc.Value] = inc
+			newIncludes = append(newIncludes, inc)
+		}
+	}
+	sortIncludes(newIncludes, source.Includes[0].Node.Loc.File)
+	newIncludes[0].Node.scopeComments = append(scopeComments,
+		newIncludes[0].Node.scopeComments...)
+	source.Includes = newIncludes
+}
+
 // Add required includes, remove unnecessary ones, and sort them.
 func fixIncludes(source *Ast, needed map[string]*SourceFile, extraTypes []*UserType) {
 	// Grab the scope comments off the first node, so that we can reattach them post-sort.
@@ -260,10 +340,6 @@ func fixIncludes(source *Ast, needed map[string]*SourceFile, extraTypes []*UserT
 			break
 		}
 	}
-	var selfName string
-	if loc.File != nil {
-		selfName = strings.Trim(strings.TrimSuffix(filepath.Base(loc.File.FileName), ".mro"), "_")
-	}
 	for f := range needed {
 		newIncludes = append(newIncludes, &Include{
 			Node: AstNode{
@@ -272,27 +348,7 @@ func fixIncludes(source *Ast, needed map[string]*SourceFile, extraTypes []*UserT
 			Value: f,
 		})
 	}
-	sort.Slice(newIncludes, func(i, j int) bool {
-		// Sort underscore-prefixed files after others.
-		// By convention these are "private".
-		p1 := strings.HasPrefix(newIncludes[i].Value, "_")
-		p2 := strings.HasPrefix(newIncludes[j].Value, "_")
-		if p1 != p2 {
-			return p2
-		}
-		// Sort files which contain this file's name last, e.g.
-		//   _my_pipeline_stages.mro
-		// in
-		//   my_pipeline.mro
-		if selfName != "" {
-			p1 = strings.Contains(newIncludes[i].Value, selfName)
-			p2 = strings.Contains(newIncludes[j].Value, selfName)
-			if p1 != p2 {
-				return p2
-			}
-		}
-		return newIncludes[i].Value < newIncludes[j].Value
-	})
+	sortIncludes(newIncludes, loc.File)
 	if len(newIncludes) > 0 {
 		newIncludes[0].Node.scopeComments = append(scopeComments,
 			newIncludes[0].Node.scopeComments...)
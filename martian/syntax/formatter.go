@@ -40,6 +40,9 @@ type printer struct {
 	buf         strings.Builder
 	comments    map[string][]*commentBlock
 	lastComment SourceLoc
+
+	// The string used for each level of indentation.
+	indent string
 }
 
 func (self *printer) printComments(node *AstNode, prefix string) {
@@ -55,7 +58,7 @@ func (self *printer) printComments(node *AstNode, prefix string) {
 		self.buf.WriteString("\"\n#\n\n")
 	}
 	for _, c := range node.scopeComments {
-		if self.lastComment.Line != 0 && self.lastComment.Line == c.Loc.Line-2 {
+		if c.blankBefore && self.needsBlankLine() {
 			self.buf.WriteString(NEWLINE)
 		}
 
@@ -75,6 +78,44 @@ func (self *printer) printComments(node *AstNode, prefix string) {
 	self.lastComment = node.Loc
 }
 
+// Print the comments for a node which has documentation.  If the node has
+// no comments, for example because it was constructed rather than parsed,
+// the documentation is printed as a comment instead.
+func (self *printer) printDocComments(node *AstNode, doc, prefix string) {
+	self.printComments(node, prefix)
+	if len(node.Comments) > 0 || doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		self.buf.WriteString(prefix)
+		if line == "" {
+			self.buf.WriteString("#")
+		} else {
+			self.buf.WriteString("# ")
+			self.buf.WriteString(line)
+		}
+		self.buf.WriteString(NEWLINE)
+	}
+}
+
+// Returns false if a blank line at the current position would be redundant,
+// because the output is at the start of the file or of a block, or already
+// ends in a blank line.
+//
+// Blank lines from the source are only preserved where this returns true, so
+// that formatting the output again does not add more of them.
+func (self *printer) needsBlankLine() bool {
+	s := self.buf.String()
+	if len(s) < 2 || strings.HasSuffix(s, "\n\n") {
+		return false
+	}
+	switch s[len(s)-2] {
+	case '(', '{', '[':
+		return false
+	}
+	return true
+}
+
 func (self *printer) WriteString(s string) (int, error) {
 	return self.buf.WriteString(s)
 }
@@ -112,7 +153,7 @@ func (self *printer) String() string {
 //
 // Expression
 //
-func (self *ValExp) format(w stringWriter, prefix string) {
+func (self *ValExp) format(w stringWriter, prefix, indent string) {
 	if self.Value == nil {
 		w.WriteString("null")
 	} else if self.Kind == KindInt {
@@ -122,42 +163,42 @@ func (self *ValExp) format(w stringWriter, prefix string) {
 	} else if self.Kind == KindString {
 		fmt.Fprintf(w, "\"%s\"", self.Value)
 	} else if self.Kind == KindMap {
-		self.formatMap(w, prefix)
+		self.formatMap(w, prefix, indent)
 	} else if self.Kind == KindArray {
-		self.formatArray(w, prefix)
+		self.formatArray(w, prefix, indent)
 	} else {
 		fmt.Fprint(w, self.Value)
 	}
 }
 
-func (self *ValExp) formatSweep(w stringWriter, prefix string) {
+func (self *ValExp) formatSweep(w stringWriter, prefix, indent string) {
 	values := self.Value.([]Exp)
 	w.WriteString("sweep(\n")
-	vindent := prefix + INDENT
+	vindent := prefix + indent
 	for _, val := range values {
 		w.WriteString(vindent)
-		val.format(w, vindent)
+		val.format(w, vindent, indent)
 		w.WriteString(",\n")
 	}
 	w.WriteString(prefix)
 	w.WriteRune(')')
 }
 
-func (self *ValExp) formatArray(w stringWriter, prefix string) {
+func (self *ValExp) formatArray(w stringWriter, prefix, indent string) {
 	values := self.Value.([]Exp)
 	if len(values) == 0 {
 		w.WriteString("[]")
 	} else if len(values) == 1 {
 		// Place single-element arrays on a single line.
 		w.WriteRune('[')
-		values[0].format(w, prefix)
+		values[0].format(w, prefix, indent)
 		w.WriteRune(']')
 	} else {
 		w.WriteString("[\n")
-		vindent := prefix + INDENT
+		vindent := prefix + indent
 		for _, val := range values {
 			w.WriteString(vindent)
-			val.format(w, vindent)
+			val.format(w, vindent, indent)
 			w.WriteString(",\n")
 		}
 		w.WriteString(prefix)
@@ -165,10 +206,10 @@ func (self *ValExp) formatArray(w stringWriter, prefix string) {
 	}
 }
 
-func (self *ValExp) formatMap(w stringWriter, prefix string) {
+func (self *ValExp) formatMap(w stringWriter, prefix, indent string) {
 	if valExpMap, ok := self.Value.(map[string]Exp); ok && len(valExpMap) > 0 {
 		w.WriteString("{\n")
-		vindent := prefix + INDENT
+		vindent := prefix + indent
 		keys := make([]string, 0, len(valExpMap))
 		for key := range valExpMap {
 			keys = append(keys, key)
@@ -179,7 +220,7 @@ func (self *ValExp) formatMap(w stringWriter, prefix string) {
 			w.WriteRune('"')
 			w.WriteString(key)
 			w.WriteString(`": `)
-			valExpMap[key].format(w, vindent)
+			valExpMap[key].format(w, vindent, indent)
 			w.WriteString(",\n")
 		}
 		w.WriteString(prefix)
@@ -189,7 +230,7 @@ func (self *ValExp) formatMap(w stringWriter, prefix string) {
 	}
 }
 
-func (self *RefExp) format(w stringWriter, prefix string) {
+func (self *RefExp) format(w stringWriter, prefix, indent string) {
 	if self.Kind == KindCall {
 		w.WriteString(self.Id)
 		if self.OutputId != "default" {
@@ -206,23 +247,23 @@ func (self *RefExp) format(w stringWriter, prefix string) {
 // Binding
 //
 func (self *BindStm) format(printer *printer, prefix string, idWidth int) {
-	printer.printComments(self.getNode(), prefix+INDENT)
-	printer.printComments(self.Exp.getNode(), prefix+INDENT)
+	printer.printComments(self.getNode(), prefix+printer.indent)
+	printer.printComments(self.Exp.getNode(), prefix+printer.indent)
 	idPad := ""
 	if len(self.Id) < idWidth {
 		idPad = strings.Repeat(" ", idWidth-len(self.Id))
 	}
-	printer.Printf("%s%s%s%s = ", prefix, INDENT,
+	printer.Printf("%s%s%s%s = ", prefix, printer.indent,
 		self.Id, idPad)
 	if ve, ok := self.Exp.(*ValExp); ok {
 		if arr, ok := ve.Value.([]Exp); ok && self.Sweep && len(arr) > 1 {
-			ve.formatSweep(printer, prefix+INDENT)
+			ve.formatSweep(printer, prefix+printer.indent, printer.indent)
 			printer.WriteRune(',')
 			printer.WriteString(NEWLINE)
 			return
 		}
 	}
-	self.Exp.format(printer, prefix+INDENT)
+	self.Exp.format(printer, prefix+printer.indent, printer.indent)
 	printer.WriteRune(',')
 	printer.WriteString(NEWLINE)
 }
@@ -244,17 +285,19 @@ func (self *BindStms) format(printer *printer, prefix string) {
 // Parameter
 //
 func paramFormat(printer *printer, param Param, modeWidth int, typeWidth int, idWidth int, helpWidth int) {
-	printer.printComments(param.getNode(), INDENT)
+	printer.printDocComments(param.getNode(), param.GetDoc(), printer.indent)
 	id := param.GetId()
 	if id == "default" {
 		id = ""
+	} else if inParam, ok := param.(*InParam); ok {
+		id = inParam.idColumn(printer.indent)
 	}
 
 	// Generate column alignment paddings.
 	modePad := strings.Repeat(" ", modeWidth-len(param.getMode()))
 	typePad := strings.Repeat(" ", typeWidth-len(param.GetTname())-2*param.GetArrayDim())
 	idPad := ""
-	if idWidth > len(id) {
+	if idWidth > len(id) && !strings.ContainsRune(id, '\n') {
 		idPad = strings.Repeat(" ", idWidth-len(id))
 	}
 	helpPad := ""
@@ -263,7 +306,7 @@ func paramFormat(printer *printer, param Param, modeWidth int, typeWidth int, id
 	}
 
 	// Common columns up to type name.
-	printer.Printf("%s%s%s %s", INDENT,
+	printer.Printf("%s%s%s %s", printer.indent,
 		param.getMode(), modePad, param.GetTname())
 
 	// If type is annotated as array, add brackets and shrink padding.
@@ -294,6 +337,19 @@ func paramFormat(printer *printer, param Param, modeWidth int, typeWidth int, id
 	printer.WriteString(",\n")
 }
 
+// Returns the id of the parameter, followed by its default value if it has
+// one, as it is written in the id column.
+func (param *InParam) idColumn(indent string) string {
+	if param.Default == nil {
+		return param.Id
+	}
+	var buf strings.Builder
+	buf.WriteString(param.Id)
+	buf.WriteString(" = ")
+	param.Default.format(&buf, indent, indent)
+	return buf.String()
+}
+
 type Params interface {
 	getWidths() (int, int, int, int)
 }
@@ -306,8 +362,9 @@ func (self *InParams) getWidths() (int, int, int, int) {
 	for _, param := range self.List {
 		modeWidth = max(modeWidth, len(param.getMode()))
 		typeWidth = max(typeWidth, len(param.GetTname())+2*param.GetArrayDim())
-		if len(param.GetId()) < 35 {
-			idWidth = max(idWidth, len(param.GetId()))
+		id := param.idColumn(INDENT)
+		if len(id) < 35 && !strings.ContainsRune(id, '\n') {
+			idWidth = max(idWidth, len(id))
 		}
 		if len(param.GetHelp()) < 25 {
 			helpWidth = max(helpWidth, len(param.GetHelp()))
@@ -365,20 +422,32 @@ func (self *OutParams) format(printer *printer, modeWidth int, typeWidth int, id
 // Pipeline, Call, Return
 //
 func (self *Pipeline) format(printer *printer) {
-	printer.printComments(&self.Node, "")
+	printer.printDocComments(&self.Node, self.Doc, "")
 
 	modeWidth, typeWidth, idWidth, helpWidth := measureParamsWidths(
 		self.InParams, self.OutParams,
 	)
 
-	printer.Printf("pipeline %s(\n", self.Id)
+	printer.WriteString("pipeline ")
+	printer.WriteString(self.Id)
+	if len(self.TypeParams) > 0 {
+		printer.WriteRune('<')
+		for i, param := range self.TypeParams {
+			if i > 0 {
+				printer.WriteString(", ")
+			}
+			printer.WriteString(param.Id)
+		}
+		printer.WriteRune('>')
+	}
+	printer.WriteString("(\n")
 	self.InParams.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
 	self.OutParams.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
 	printer.WriteString(")\n{")
 	self.topoSort()
 	for _, callstm := range self.Calls {
 		printer.WriteString(NEWLINE)
-		callstm.format(printer, INDENT)
+		callstm.format(printer, printer.indent)
 	}
 	printer.WriteString(NEWLINE)
 	self.Ret.format(printer)
@@ -393,8 +462,14 @@ func (self *CallStm) format(printer *printer, prefix string) {
 	printer.printComments(&self.Node, prefix)
 	printer.WriteString(prefix)
 	printer.WriteString("call ")
-	printer.WriteString(self.DecId)
-	if self.Id != self.DecId {
+	decId := self.genericId()
+	printer.WriteString(decId)
+	if len(self.TypeArgs) > 0 {
+		printer.WriteRune('<')
+		printer.WriteString(strings.Join(self.TypeArgs, ", "))
+		printer.WriteRune('>')
+	}
+	if self.Id != decId {
 		printer.WriteString(" as ")
 		printer.WriteString(self.Id)
 	}
@@ -458,25 +533,26 @@ func (self *CallStm) format(printer *printer, prefix string) {
 }
 
 func (self *ReturnStm) format(printer *printer) {
-	printer.printComments(&self.Node, INDENT)
-	printer.WriteString(INDENT)
+	printer.printComments(&self.Node, printer.indent)
+	printer.WriteString(printer.indent)
 	printer.WriteString("return (\n")
-	self.Bindings.format(printer, INDENT)
-	printer.WriteString(INDENT)
+	self.Bindings.format(printer, printer.indent)
+	printer.WriteString(printer.indent)
 	printer.WriteString(")\n")
 }
 
 func (self *PipelineRetains) format(printer *printer) {
-	printer.printComments(&self.Node, INDENT)
-	printer.WriteString(INDENT)
+	printer.printComments(&self.Node, printer.indent)
+	printer.WriteString(printer.indent)
 	printer.WriteString("retain (\n")
 	for _, ref := range self.Refs {
-		printer.WriteString(INDENT)
-		printer.WriteString(INDENT)
-		ref.format(printer, INDENT+INDENT)
+		printer.printComments(&ref.Node, printer.indent+printer.indent)
+		printer.WriteString(printer.indent)
+		printer.WriteString(printer.indent)
+		ref.format(printer, printer.indent+printer.indent, printer.indent)
 		printer.WriteString(",\n")
 	}
-	printer.WriteString(INDENT)
+	printer.WriteString(printer.indent)
 	printer.WriteString(")\n")
 }
 
@@ -484,13 +560,16 @@ func (self *PipelineRetains) format(printer *printer) {
 // Stage
 //
 func (self *Stage) format(printer *printer) {
-	printer.printComments(&self.Node, "")
+	printer.printDocComments(&self.Node, self.Doc, "")
 
 	modeWidth, typeWidth, idWidth, helpWidth := measureParamsWidths(
 		self.InParams, self.OutParams, self.ChunkIns, self.ChunkOuts,
 	)
 	modeWidth = max(modeWidth, len("src"))
 
+	if self.Deprecated != "" {
+		printer.Printf("@deprecated(\"%s\")\n", self.Deprecated)
+	}
 	printer.Printf("stage %s(\n", self.Id)
 	self.InParams.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
 	self.OutParams.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
@@ -507,6 +586,9 @@ func (self *Stage) format(printer *printer) {
 	if self.Resources != nil {
 		self.Resources.format(printer)
 	}
+	if self.Env != nil {
+		self.Env.format(printer)
+	}
 	if self.Retain != nil {
 		self.Retain.format(printer)
 	}
@@ -514,59 +596,117 @@ func (self *Stage) format(printer *printer) {
 }
 
 func (self *Resources) format(printer *printer) {
-	printer.printComments(&self.Node, INDENT)
+	printer.printComments(&self.Node, printer.indent)
 	printer.WriteString(") using (\n")
 	// Pad depending on which arguments are present.
-	// mem_gb   = x,
-	// special  = y
-	// threads  = y,
-	// volatile = z,
-	var memPad, threadPad string
-	if self.VolatileNode != nil {
+	// disk_space_gb = v,
+	// gpus          = w,
+	// mem_gb        = x,
+	// priority      = y,
+	// retries       = y,
+	// special       = y
+	// threads       = y,
+	// timeout       = y,
+	// volatile      = z,
+	var gpuPad, memPad, threadPad, volatilePad string
+	if self.DiskNode != nil {
+		gpuPad = "         "
+		memPad = "       "
+		threadPad = "      "
+		volatilePad = "     "
+	} else if self.VolatileNode != nil || self.PriorityNode != nil {
+		gpuPad = "    "
 		memPad = "  "
 		threadPad = " "
-	} else if self.SpecialNode != nil || self.ThreadNode != nil {
+	} else if self.SpecialNode != nil || self.ThreadNode != nil ||
+		self.TimeoutNode != nil || self.RetriesNode != nil {
+		gpuPad = "   "
 		memPad = " "
+	} else if self.MemNode != nil {
+		gpuPad = "  "
+	}
+	if self.DiskNode != nil {
+		printer.printComments(self.DiskNode, printer.indent)
+		printer.WriteString(printer.indent)
+		printer.Printf("disk_space_gb = %d,\n", self.DiskGB)
+	}
+	if self.GPUNode != nil {
+		printer.printComments(self.GPUNode, printer.indent)
+		printer.WriteString(printer.indent)
+		printer.Printf("gpus%s = %d,\n", gpuPad, self.GPUs)
 	}
 	if self.MemNode != nil {
-		printer.printComments(self.MemNode, INDENT)
-		printer.WriteString(INDENT)
+		printer.printComments(self.MemNode, printer.indent)
+		printer.WriteString(printer.indent)
 		printer.Printf("mem_gb%s = %d,\n", memPad, self.MemGB)
 	}
+	if self.PriorityNode != nil {
+		printer.printComments(self.PriorityNode, printer.indent)
+		printer.WriteString(printer.indent)
+		printer.Printf("priority%s = %d,\n", volatilePad, self.Priority)
+	}
+	if self.RetriesNode != nil {
+		printer.printComments(self.RetriesNode, printer.indent)
+		printer.WriteString(printer.indent)
+		printer.Printf("retries%s = %d,\n", threadPad, self.Retries)
+	}
 	if self.SpecialNode != nil {
-		printer.printComments(self.SpecialNode, INDENT)
-		printer.WriteString(INDENT)
+		printer.printComments(self.SpecialNode, printer.indent)
+		printer.WriteString(printer.indent)
 		printer.Printf("special%s = \"%s\",\n", threadPad, self.Special)
 	}
 	if self.ThreadNode != nil {
-		printer.printComments(self.ThreadNode, INDENT)
-		printer.WriteString(INDENT)
+		printer.printComments(self.ThreadNode, printer.indent)
+		printer.WriteString(printer.indent)
 		printer.Printf("threads%s = %d,\n", threadPad, self.Threads)
 	}
+	if self.TimeoutNode != nil {
+		printer.printComments(self.TimeoutNode, printer.indent)
+		printer.WriteString(printer.indent)
+		printer.Printf("timeout%s = %d,\n", threadPad, self.Timeout)
+	}
 	if self.VolatileNode != nil {
-		printer.printComments(self.VolatileNode, INDENT)
-		printer.WriteString(INDENT)
-		printer.WriteString("volatile = strict,\n")
+		printer.printComments(self.VolatileNode, printer.indent)
+		printer.WriteString(printer.indent)
+		printer.Printf("volatile%s = strict,\n", volatilePad)
+	}
+}
+
+func (self *StageEnv) format(printer *printer) {
+	printer.printComments(&self.Node, printer.indent)
+	printer.WriteString(") env (\n")
+	keyWidth := 0
+	for _, v := range self.Vars {
+		keyWidth = max(keyWidth, len(v.Key))
+	}
+	for _, v := range self.Vars {
+		printer.printComments(&v.Node, printer.indent)
+		printer.Printf("%s%s%s = \"%s\",\n", printer.indent,
+			v.Key, strings.Repeat(" ", keyWidth-len(v.Key)), v.Value)
 	}
 }
 
 func (self *RetainParams) format(printer *printer) {
-	printer.printComments(&self.Node, INDENT)
+	printer.printComments(&self.Node, printer.indent)
 	printer.WriteString(") retain (\n")
 	for _, param := range self.Params {
-		printer.printComments(&param.Node, INDENT)
-		printer.WriteString(INDENT)
+		printer.printComments(&param.Node, printer.indent)
+		printer.WriteString(printer.indent)
 		printer.WriteString(param.Id)
 		printer.WriteString(",\n")
 	}
 }
 
 func (self *SrcParam) format(printer *printer, modeWidth int, typeWidth int, idWidth int) {
-	printer.printComments(&self.Node, INDENT)
-	langPad := strings.Repeat(" ", typeWidth-len(string(self.Lang)))
+	printer.printComments(&self.Node, printer.indent)
+	langPad := strings.Repeat(" ", max(0, typeWidth-len(string(self.Lang))))
 	modePad := strings.Repeat(" ", modeWidth-len("src"))
-	printer.Printf("%ssrc%s %v%s \"%s\",\n", INDENT,
-		modePad, self.Lang, langPad,
+	image := ""
+	if self.Image != "" {
+		image = "\"" + self.Image + "\" "
+	}
+	printer.Printf("%ssrc%s %v%s %s\"%s\",\n", printer.indent,
+		modePad, self.Lang, langPad, image,
 		strings.Join(append([]string{self.Path}, self.Args...), " "))
 }
 
@@ -590,13 +730,64 @@ func (self *UserType) format(printer *printer) {
 	printer.Printf("filetype %s;\n", self.Id)
 }
 
+//
+// Enum
+//
+func (self *EnumType) format(printer *printer) {
+	printer.printComments(&self.Node, "")
+	values := append(make([]string, 0, len(self.Values)), self.Values...)
+	sort.Strings(values)
+	printer.Printf("enum %s(\n", self.Id)
+	for _, value := range values {
+		printer.Printf("%s\"%s\",\n", printer.indent, value)
+	}
+	printer.WriteString(")\n")
+}
+
+//
+// Struct
+//
+func (self *StructType) format(printer *printer) {
+	printer.printComments(&self.Node, "")
+	typeWidth := 0
+	idWidth := 0
+	for _, field := range self.Fields {
+		typeWidth = max(typeWidth, len(field.Tname)+2*field.GetArrayDim())
+		if len(field.Id) < 35 {
+			idWidth = max(idWidth, len(field.Id))
+		}
+	}
+	printer.Printf("struct %s(\n", self.Id)
+	for _, field := range self.Fields {
+		printer.printComments(&field.Node, printer.indent)
+		printer.WriteString(printer.indent)
+		printer.WriteString(field.Tname)
+		for i := 0; i < field.GetArrayDim(); i++ {
+			printer.WriteString("[]")
+		}
+		printer.WriteString(strings.Repeat(" ",
+			typeWidth-len(field.Tname)-2*field.GetArrayDim()+1))
+		printer.WriteString(field.Id)
+		if len(field.Help) > 0 {
+			idPad := ""
+			if idWidth > len(field.Id) {
+				idPad = strings.Repeat(" ", idWidth-len(field.Id))
+			}
+			printer.Printf("%s  \"%s\"", idPad, field.Help)
+		}
+		printer.WriteString(",\n")
+	}
+	printer.WriteString(")\n")
+}
+
 //
 // AST
 //
-func (self *Ast) format(writeIncludes bool) string {
+func (self *Ast) format(writeIncludes bool, indent string) string {
 	needSpacer := false
 	printer := printer{
 		comments: make(map[string][]*commentBlock, len(self.Files)),
+		indent:   indent,
 	}
 	if len(self.Files) > 0 {
 		// Set the printer's last comment location to the top of the
@@ -641,6 +832,24 @@ func (self *Ast) format(writeIncludes bool) string {
 		needSpacer = true
 	}
 
+	// enum declarations.
+	for _, enumType := range self.EnumTypes {
+		if needSpacer {
+			printer.WriteString(NEWLINE)
+		}
+		enumType.format(&printer)
+		needSpacer = true
+	}
+
+	// struct declarations.
+	for _, structType := range self.StructTypes {
+		if needSpacer {
+			printer.WriteString(NEWLINE)
+		}
+		structType.format(&printer)
+		needSpacer = true
+	}
+
 	// callables.
 	if needSpacer && len(self.Callables.List) > 0 {
 		printer.WriteString(NEWLINE)
@@ -675,19 +884,77 @@ func (parser *Parser) FormatFile(filename string, fixIncludes bool, mropath []st
 	if err != nil {
 		return "", err
 	}
-	return FormatSrcBytes(data, filename, fixIncludes, mropath)
+	return parser.FormatSrcBytes(data, filename, fixIncludes, mropath)
 }
 
 func Format(src string, filename string, fixIncludes bool, mropath []string) (string, error) {
 	return FormatSrcBytes([]byte(src), filename, fixIncludes, mropath)
 }
 
+// FormatBytes formats the given MRO source, without reading the source
+// from disk.
+//
+// srcPath is the path to the source file, used for error messages and for
+// resolving includes.
+//
+// If mroPaths is not nil, includes are added or removed as required by
+// the source, searching the directory containing srcPath and then mroPaths
+// for files which declare missing types or callables.
+func FormatBytes(src []byte, srcPath string, mroPaths []string) (string, error) {
+	return FormatSrcBytes(src, srcPath, mroPaths != nil, mroPaths)
+}
+
+// FormatString formats the given MRO source in the same way as FormatBytes.
+func FormatString(src string, srcPath string, mroPaths []string) (string, error) {
+	return FormatBytes([]byte(src), srcPath, mroPaths)
+}
+
 func FormatSrcBytes(src []byte, filename string, fixIncludes bool, mropath []string) (string, error) {
 	var parser Parser
 	return parser.FormatSrcBytes(src, filename, fixIncludes, mropath)
 }
 
 func (parser *Parser) FormatSrcBytes(src []byte, filename string, fixIncludes bool, mropath []string) (string, error) {
+	return parser.FormatSrcBytesOptions(src, filename, fixIncludes, mropath, nil)
+}
+
+// FormatOptions control optional formatting behavior.  A nil *FormatOptions
+// is equivalent to the zero value.
+type FormatOptions struct {
+	// The string used for each level of indentation, for example "  " or
+	// "\t".  If empty, INDENT is used.
+	Indent string
+
+	// If true, sort include directives and remove exact duplicates, which
+	// would otherwise be an error.
+	OrganizeIncludes bool
+
+	// If true, remove include directives for files which declare nothing
+	// used by the source, without adding any missing includes.  This has
+	// no effect if fixIncludes is true, since that removes them as well.
+	PruneIncludes bool
+}
+
+// FormatSrcBytesOptions formats the given source in the same way as
+// FormatSrcBytes, with the given options.
+func FormatSrcBytesOptions(src []byte, filename string, fixIncludes bool,
+	mropath []string, options *FormatOptions) (string, error) {
+	var parser Parser
+	return parser.FormatSrcBytesOptions(src, filename, fixIncludes, mropath, options)
+}
+
+func (parser *Parser) FormatSrcBytesOptions(src []byte, filename string,
+	fixIncludes bool, mropath []string, options *FormatOptions) (string, error) {
+	indent := INDENT
+	organizeIncludes := false
+	pruneIncludes := false
+	if options != nil {
+		if options.Indent != "" {
+			indent = options.Indent
+		}
+		organizeIncludes = options.OrganizeIncludes
+		pruneIncludes = options.PruneIncludes
+	}
 	absPath, _ := filepath.Abs(filename)
 	// Parse and generate the AST.
 	srcFile := SourceFile{
@@ -698,32 +965,47 @@ func (parser *Parser) FormatSrcBytes(src []byte, filename string, fixIncludes bo
 	if mmli != nil { // mmli is an mmLexInfo struct
 		return "", mmli
 	}
+	if organizeIncludes {
+		global.organizeIncludes()
+	}
 	var err error
 	if fixIncludes {
-		err = fixIncludesTop(global, mropath, parser.getIntern())
+		err = fixIncludesTop(global, mropath, parser)
+	} else if pruneIncludes {
+		err = pruneIncludesTop(global, mropath, parser)
 	}
 
 	// Format the source.
-	return global.format(true), err
+	return global.format(true, indent), err
 }
 
 func JsonDumpAsts(asts []*Ast) string {
 	type JsonDump struct {
-		UserTypes map[string]*UserType
-		Stages    map[string]*Stage
-		Pipelines map[string]*Pipeline
+		UserTypes   map[string]*UserType
+		EnumTypes   map[string]*EnumType
+		StructTypes map[string]*StructType
+		Stages      map[string]*Stage
+		Pipelines   map[string]*Pipeline
 	}
 
 	jd := JsonDump{
-		UserTypes: map[string]*UserType{},
-		Stages:    map[string]*Stage{},
-		Pipelines: map[string]*Pipeline{},
+		UserTypes:   map[string]*UserType{},
+		EnumTypes:   map[string]*EnumType{},
+		StructTypes: map[string]*StructType{},
+		Stages:      map[string]*Stage{},
+		Pipelines:   map[string]*Pipeline{},
 	}
 
 	for _, ast := range asts {
 		for _, t := range ast.UserTypes {
 			jd.UserTypes[t.Id] = t
 		}
+		for _, t := range ast.EnumTypes {
+			jd.EnumTypes[t.Id] = t
+		}
+		for _, t := range ast.StructTypes {
+			jd.StructTypes[t.Id] = t
+		}
 		for _, stage := range ast.Stages {
 			jd.Stages[stage.Id] = stage
 		}
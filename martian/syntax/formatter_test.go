@@ -7,6 +7,8 @@
 package syntax
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -21,7 +23,7 @@ func Equal(t *testing.T, value, expected, message string) {
 
 func TestFormatValueExpression(t *testing.T) {
 	ve := ValExp{
-		Node:  AstNode{SourceLoc{0, new(SourceFile)}, nil, nil},
+		Node:  AstNode{SourceLoc{Line: 0, File: new(SourceFile)}, nil, nil},
 		Kind:  "float",
 		Value: 0,
 	}
@@ -33,32 +35,32 @@ func TestFormatValueExpression(t *testing.T) {
 	ve.Kind = "float"
 
 	ve.Value = 10.0
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "10", "Preserve single zero after decimal.")
 	buff.Reset()
 
 	ve.Value = 10.05
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "10.05", "Do not strip numbers ending in non-zero digit.")
 	buff.Reset()
 
 	ve.Value = 10.050
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "10.05", "Strip single trailing zero.")
 	buff.Reset()
 
 	ve.Value = 10.050000000
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "10.05", "Strip multiple trailing zeroes.")
 	buff.Reset()
 
 	ve.Value = 0.0000000005
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "5e-10", "Handle exponential notation.")
 	buff.Reset()
 
 	ve.Value = 0.0005
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "0.0005", "Handle low decimal floats.")
 	buff.Reset()
 
@@ -68,17 +70,17 @@ func TestFormatValueExpression(t *testing.T) {
 	ve.Kind = "int"
 
 	ve.Value = 0
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "0", "Format zero integer.")
 	buff.Reset()
 
 	ve.Value = 10
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "10", "Format non-zero integer.")
 	buff.Reset()
 
 	ve.Value = 1000000
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "1000000", "Preserve integer trailing zeroes.")
 	buff.Reset()
 
@@ -88,12 +90,12 @@ func TestFormatValueExpression(t *testing.T) {
 	ve.Kind = "string"
 
 	ve.Value = "blah"
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "\"blah\"", "Double quote a string.")
 	buff.Reset()
 
 	ve.Value = "\"blah\""
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "\"\"blah\"\"", "Double quote a double-quoted string.")
 	buff.Reset()
 
@@ -101,7 +103,7 @@ func TestFormatValueExpression(t *testing.T) {
 	// Format nil ValExps.
 	//
 	ve.Value = nil
-	ve.format(&buff, "")
+	ve.format(&buff, "", INDENT)
 	Equal(t, buff.String(), "null", "Nil value is 'null'.")
 }
 
@@ -199,8 +201,11 @@ stage MAP_EXAMPLE(
     src py  "stages/merge_json",
 ) using (
     mem_gb   = 2,
+    retries  = 2,
     # This stage always uses 4 threads!
     threads  = 4,
+    # Give up if it hangs for more than an hour.
+    timeout  = 3600,
     volatile = strict,
 )
 
@@ -346,7 +351,7 @@ func BenchmarkFormat(b *testing.B) {
 	} else {
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
-			ast.format(false)
+			ast.format(false, INDENT)
 		}
 	}
 }
@@ -427,6 +432,490 @@ func TestFormatTopoSort(t *testing.T) {
 	}
 }
 
+func TestFormatStruct(t *testing.T) {
+	const src = `filetype txt;
+struct SHAPE(
+  string name,
+  # The corners.
+  POINT[]  vertices "The corners",
+  txt description,
+)
+struct POINT(float x, float y,)
+stage DRAW(
+    in  SHAPE shape,
+    src py    "stages/draw",
+)
+`
+	const expected = `filetype txt;
+
+struct SHAPE(
+    string  name,
+    # The corners.
+    POINT[] vertices     "The corners",
+    txt     description,
+)
+
+struct POINT(
+    float x,
+    float y,
+)
+
+stage DRAW(
+    in  SHAPE shape,
+    src py    "stages/draw",
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	if formatted, err := Format(expected, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+}
+
+func TestFormatEnum(t *testing.T) {
+	const src = `# Sequence formats.
+enum FORMAT("fastq", "bam",
+    "cram")
+struct READS(FORMAT format, file[] files,)
+`
+	const expected = `# Sequence formats.
+enum FORMAT(
+    "bam",
+    "cram",
+    "fastq",
+)
+
+struct READS(
+    FORMAT format,
+    file[] files,
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+}
+
+func TestFormatIndent(t *testing.T) {
+	const src = `stage FOO(
+    in  map x,
+    out int y,
+    src py  "stages/foo",
+) using (
+    mem_gb = 2,
+)
+
+pipeline BAR(
+    in  map x,
+    out int y,
+)
+{
+    call FOO(
+        x = {
+            "a": [
+                1,
+                2,
+            ],
+        },
+    )
+
+    return (
+        y = FOO.y,
+    )
+
+    retain (
+        FOO.y,
+    )
+}
+`
+	for _, indent := range []string{"  ", "\t"} {
+		expected := strings.Replace(src, INDENT, indent, -1)
+		options := FormatOptions{Indent: indent}
+		if formatted, err := FormatSrcBytesOptions([]byte(src), "test",
+			false, nil, &options); err != nil {
+			t.Errorf("Format error: %v", err)
+		} else if formatted != expected {
+			diffLines(expected, formatted, t)
+		}
+		if formatted, err := FormatSrcBytesOptions([]byte(expected), "test",
+			false, nil, &options); err != nil {
+			t.Errorf("Format error: %v", err)
+		} else if formatted != expected {
+			diffLines(expected, formatted, t)
+		}
+	}
+}
+
+func TestFormatDefaultParams(t *testing.T) {
+	const src = `stage SUM(
+    in int[] values "The values",
+    in int offset = 0 "Added to the sum",
+    in map opts = {"scale": 1.5, "round": true},
+    in string[] names = ["a"],
+    out int sum,
+    src py "stages/sum",
+)
+`
+	const expected = `stage SUM(
+    in  int[]    values         "The values",
+    in  int      offset = 0     "Added to the sum",
+    in  map      opts = {
+        "round": true,
+        "scale": 1.5,
+    },
+    in  string[] names = ["a"],
+    out int      sum,
+    src py       "stages/sum",
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	checkFormatIdempotent(t, src, "default params")
+}
+
+func TestFormatGPUResources(t *testing.T) {
+	const src = `stage SUM(
+    in int[] values,
+    out int sum,
+    src py "stages/sum",
+) using (
+    threads = 2,
+    gpus = 1,
+    mem_gb = 4,
+)
+`
+	const expected = `stage SUM(
+    in  int[] values,
+    out int   sum,
+    src py    "stages/sum",
+) using (
+    gpus    = 1,
+    mem_gb  = 4,
+    threads = 2,
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	checkFormatIdempotent(t, src, "gpu resources")
+}
+
+func TestFormatContainerSrc(t *testing.T) {
+	const src = `stage SUM(
+    in int[] values,
+    out int sum,
+    src docker "martian/sum:1.0"   "/usr/bin/sum --fast",
+)
+`
+	const expected = `stage SUM(
+    in  int[] values,
+    out int   sum,
+    src docker "martian/sum:1.0" "/usr/bin/sum --fast",
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	checkFormatIdempotent(t, src, "container src")
+}
+
+func TestFormatDiskSpace(t *testing.T) {
+	const src = `stage SUM(
+    in int[] values,
+    out int sum,
+    src py "stages/sum",
+) using (
+    volatile = strict,
+    mem_gb = 2,
+    disk_space_gb = 100,
+    priority = 10,
+    threads = 4,
+)
+`
+	const expected = `stage SUM(
+    in  int[] values,
+    out int   sum,
+    src py    "stages/sum",
+) using (
+    disk_space_gb = 100,
+    mem_gb        = 2,
+    priority      = 10,
+    threads       = 4,
+    volatile      = strict,
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	checkFormatIdempotent(t, src, "disk space")
+}
+
+func TestFormatPriority(t *testing.T) {
+	const src = `stage SUM(
+    in int[] values,
+    out int sum,
+    src py "stages/sum",
+) using (
+    threads = 4,
+    priority = -1,
+    gpus = 1,
+)
+`
+	const expected = `stage SUM(
+    in  int[] values,
+    out int   sum,
+    src py    "stages/sum",
+) using (
+    gpus     = 1,
+    priority = -1,
+    threads  = 4,
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	checkFormatIdempotent(t, src, "priority")
+}
+
+func TestFormatEnv(t *testing.T) {
+	const src = `stage SUM(
+    in int[] values,
+    out file sum,
+    src py "stages/sum",
+) using (
+    threads = 4,
+) env (
+    OMP_NUM_THREADS = "4",
+    # Force a stable collation.
+    LC_ALL = "C",
+) retain (
+    sum,
+)
+`
+	const expected = `stage SUM(
+    in  int[] values,
+    out file  sum,
+    src py    "stages/sum",
+) using (
+    threads = 4,
+) env (
+    OMP_NUM_THREADS = "4",
+    # Force a stable collation.
+    LC_ALL          = "C",
+) retain (
+    sum,
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	checkFormatIdempotent(t, src, "env")
+}
+
+func TestFormatDeprecated(t *testing.T) {
+	const src = `# Old stage.
+@deprecated( "use SUM instead" )
+stage SUM_SQUARES(
+    in float[] values,
+    out float sum,
+    src py "stages/sum_squares",
+)
+`
+	const expected = `# Old stage.
+@deprecated("use SUM instead")
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+)
+`
+	if formatted, err := Format(src, "test", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	checkFormatIdempotent(t, src, "deprecated")
+}
+
+func TestFormatDoc(t *testing.T) {
+	const src = `# Copyright header.
+
+# Sum the squares.
+#
+# Values may be negative.
+stage SUM_SQUARES(
+    # The values to square.
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+)
+`
+	ast := testGood(t, src)
+	if ast == nil {
+		return
+	}
+	stage := ast.Stages[0]
+	Equal(t, stage.Doc, "Sum the squares.\n\nValues may be negative.",
+		"Stage doc.")
+	Equal(t, stage.InParams.List[0].Doc, "The values to square.",
+		"Input doc.")
+	Equal(t, stage.OutParams.List[0].Doc, "", "Output doc.")
+	Equal(t, ast.format(false, INDENT), src, "Format with comments.")
+
+	// Documentation set without comments is printed as a comment.
+	stage.Node.Comments = nil
+	stage.OutParams.List[0].Doc = "The sum."
+	const expected = `# Copyright header.
+
+# Sum the squares.
+#
+# Values may be negative.
+stage SUM_SQUARES(
+    # The values to square.
+    in  float[] values,
+    # The sum.
+    out float   sum,
+    src py      "stages/sum_squares",
+)
+`
+	if formatted := ast.format(false, INDENT); formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+}
+
+func TestFormatOrganizeIncludes(t *testing.T) {
+	const src = `# Copyright header.
+
+@include "stages.mro"
+# Needed for BAR.
+@include "bar.mro"
+@include "_private.mro"
+# Also needed for BAR.
+@include "bar.mro"
+@include "alpha.mro"
+
+stage FOO(
+    in  int x,
+    src py  "stages/foo",
+)
+`
+	const expected = `# Copyright header.
+
+@include "alpha.mro"
+# Needed for BAR.
+# Also needed for BAR.
+@include "bar.mro"
+@include "stages.mro"
+@include "_private.mro"
+
+stage FOO(
+    in  int x,
+    src py  "stages/foo",
+)
+`
+	options := FormatOptions{OrganizeIncludes: true}
+	if formatted, err := FormatSrcBytesOptions([]byte(src), "test.mro",
+		false, nil, &options); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expected {
+		diffLines(expected, formatted, t)
+	}
+	// Without the option, includes are left alone.
+	if formatted, err := Format(src, "test.mro", false, nil); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+// Check that formatting already-formatted source does not change it.
+func checkFormatIdempotent(t *testing.T, src, filename string) {
+	t.Helper()
+	once, err := Format(src, filename, false, nil)
+	if err != nil {
+		t.Errorf("Format error: %v", err)
+		return
+	}
+	twice, err := Format(once, filename, false, nil)
+	if err != nil {
+		t.Errorf("Error formatting formatted source: %v", err)
+		return
+	}
+	if once == twice {
+		return
+	}
+	onceLines := strings.Split(once, "\n")
+	twiceLines := strings.Split(twice, "\n")
+	for i, line := range onceLines {
+		if i >= len(twiceLines) {
+			t.Errorf("%s: formatting is not idempotent.  "+
+				"Second pass output ends before line %d:\n"+
+				"first:  %q",
+				filename, i+1, line)
+			return
+		} else if line != twiceLines[i] {
+			t.Errorf("%s: formatting is not idempotent.  "+
+				"First difference at line %d:\n"+
+				"first:  %q\n"+
+				"second: %q",
+				filename, i+1, line, twiceLines[i])
+			return
+		}
+	}
+	t.Errorf("%s: formatting is not idempotent.  "+
+		"Second pass output has extra lines starting at line %d:\n"+
+		"second: %q",
+		filename, len(onceLines)+1, twiceLines[len(onceLines)])
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	checkFormatIdempotent(t, fmtTestSrc, "fmtTestSrc")
+	var files []string
+	for _, pattern := range []string{
+		"testdata/*.mro",
+		"testdata/format/*.mro",
+	} {
+		if matches, err := filepath.Glob(pattern); err != nil {
+			t.Fatal(err)
+		} else {
+			files = append(files, matches...)
+		}
+	}
+	if len(files) == 0 {
+		t.Fatal("No test files found.")
+	}
+	for _, fn := range files {
+		if src, err := ioutil.ReadFile(fn); err != nil {
+			t.Error(err)
+		} else if _, err := yaccParse(src, new(SourceFile),
+			makeStringIntern()); err != nil {
+			// Some test files are intentionally invalid.
+			t.Logf("Skipping %s: %v", fn, err)
+		} else {
+			checkFormatIdempotent(t, string(src), fn)
+		}
+	}
+}
+
 // Produce a relatively debuggable side-by-side diff.
 func diffLines(src, formatted string, t *testing.T) {
 	src_lines := strings.Split(src, "\n")
@@ -0,0 +1,217 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Instantiation of generic pipelines.
+
+package syntax
+
+import (
+	"strings"
+)
+
+// Get the name of the instance of a generic callable for the given type
+// arguments.  With no type arguments, this is just the id.
+func genericInstanceId(id string, typeArgs []string) string {
+	if len(typeArgs) == 0 {
+		return id
+	}
+	return id + "<" + strings.Join(typeArgs, ",") + ">"
+}
+
+// Get the name of the declaration being called, without type arguments.
+func (s *CallStm) genericId() string {
+	if i := strings.IndexByte(s.DecId, '<'); i >= 0 {
+		return s.DecId[:i]
+	}
+	return s.DecId
+}
+
+// Returns true if the pipeline has type parameters.
+func (s *Pipeline) IsGeneric() bool {
+	return len(s.TypeParams) > 0
+}
+
+// Get the pipelines to compile, in declaration order, with the instances
+// of each generic pipeline in place of its declaration.
+func (global *Ast) compiledPipelines() []*Pipeline {
+	pipelines := make([]*Pipeline, 0, len(global.Pipelines))
+	for _, pipeline := range global.Pipelines {
+		if pipeline.IsGeneric() {
+			pipelines = append(pipelines, pipeline.instances...)
+		} else {
+			pipelines = append(pipelines, pipeline)
+		}
+	}
+	return pipelines
+}
+
+// Create the instances of generic pipelines needed for the calls in the
+// ast, and add them to the callable table.
+//
+// Generic pipelines are not compiled themselves.  Instead, each instance
+// is compiled as an ordinary pipeline, with the type arguments substituted
+// for the type parameters.
+func (global *Ast) instantiateGenerics() error {
+	var errs ErrorList
+	for _, pipeline := range global.Pipelines {
+		pipeline.instances = nil
+		seen := make(map[string]struct{}, len(pipeline.TypeParams))
+		for _, param := range pipeline.TypeParams {
+			if _, ok := seen[param.Id]; ok {
+				errs = append(errs, global.err(param,
+					"DuplicateNameError: type parameter '%s' was already declared when encountered again",
+					param.Id))
+			}
+			seen[param.Id] = struct{}{}
+		}
+	}
+	if err := errs.If(); err != nil {
+		return err
+	}
+	for _, pipeline := range global.Pipelines {
+		if !pipeline.IsGeneric() {
+			for _, call := range pipeline.Calls {
+				if err := global.instantiate(call); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	if global.Call != nil {
+		if err := global.instantiate(global.Call); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.If()
+}
+
+// Check the type arguments of a call, and create the instance of the
+// generic pipeline it calls, if it does not exist yet.
+func (global *Ast) instantiate(call *CallStm) error {
+	id := call.genericId()
+	callable := global.Callables.Table[id]
+	generic, _ := callable.(*Pipeline)
+	if len(call.TypeArgs) == 0 {
+		if generic != nil && generic.IsGeneric() {
+			return global.err(call,
+				"GenericTypeError: pipeline '%s' requires %d type arguments",
+				id, len(generic.TypeParams))
+		}
+		return nil
+	}
+	if callable == nil {
+		return global.err(call,
+			"ScopeNameError: '%s' is not defined in this scope",
+			id)
+	} else if generic == nil || !generic.IsGeneric() {
+		return global.err(call,
+			"GenericTypeError: %s '%s' does not take type arguments",
+			callable.Type(), id)
+	} else if len(call.TypeArgs) != len(generic.TypeParams) {
+		return global.err(call,
+			"GenericTypeError: pipeline '%s' takes %d type arguments, but %d were given",
+			id, len(generic.TypeParams), len(call.TypeArgs))
+	}
+	for _, arg := range call.TypeArgs {
+		if _, ok := global.TypeTable[arg]; !ok {
+			return global.err(call,
+				"TypeError: undefined type '%s'",
+				arg)
+		}
+	}
+	if _, ok := global.Callables.Table[call.DecId]; ok {
+		return nil
+	}
+	instance := generic.instantiate(call.DecId, call.TypeArgs)
+	global.Callables.Table[instance.Id] = instance
+	generic.instances = append(generic.instances, instance)
+	// Generic pipelines may call other generic pipelines.
+	var errs ErrorList
+	for _, c := range instance.Calls {
+		if err := global.instantiate(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.If()
+}
+
+// Make a copy of a generic pipeline, substituting the type arguments for
+// its type parameters.
+//
+// Everything which is modified during compilation is copied, so that
+// each instance can be compiled independently.
+func (pipeline *Pipeline) instantiate(id string, typeArgs []string) *Pipeline {
+	types := make(map[string]string, len(typeArgs))
+	for i, param := range pipeline.TypeParams {
+		types[param.Id] = typeArgs[i]
+	}
+	substitute := func(tname string) string {
+		if t, ok := types[tname]; ok {
+			return t
+		}
+		return tname
+	}
+	instance := &Pipeline{
+		Node: pipeline.Node,
+		Id:   id,
+		InParams: &InParams{
+			List:  make([]*InParam, 0, len(pipeline.InParams.List)),
+			Table: make(map[string]*InParam, len(pipeline.InParams.List)),
+		},
+		OutParams: &OutParams{
+			List:  make([]*OutParam, 0, len(pipeline.OutParams.List)),
+			Table: make(map[string]*OutParam, len(pipeline.OutParams.List)),
+		},
+		Calls:     make([]*CallStm, 0, len(pipeline.Calls)),
+		Callables: &Callables{Table: make(map[string]Callable, len(pipeline.Calls))},
+		Ret: &ReturnStm{
+			Node:     pipeline.Ret.Node,
+			Bindings: pipeline.Ret.Bindings.copy(),
+		},
+		Retain: pipeline.Retain,
+		Doc:    pipeline.Doc,
+	}
+	for _, param := range pipeline.InParams.List {
+		p := *param
+		p.Tname = substitute(p.Tname)
+		instance.InParams.List = append(instance.InParams.List, &p)
+	}
+	for _, param := range pipeline.OutParams.List {
+		p := *param
+		p.Tname = substitute(p.Tname)
+		instance.OutParams.List = append(instance.OutParams.List, &p)
+	}
+	for _, call := range pipeline.Calls {
+		c := *call
+		c.Bindings = call.Bindings.copy()
+		if call.Modifiers != nil {
+			mods := *call.Modifiers
+			if mods.Bindings != nil {
+				mods.Bindings = mods.Bindings.copy()
+			}
+			c.Modifiers = &mods
+		}
+		if len(call.TypeArgs) > 0 {
+			c.TypeArgs = make([]string, len(call.TypeArgs))
+			for i, arg := range call.TypeArgs {
+				c.TypeArgs[i] = substitute(arg)
+			}
+			c.DecId = genericInstanceId(call.genericId(), c.TypeArgs)
+		}
+		instance.Calls = append(instance.Calls, &c)
+	}
+	return instance
+}
+
+// Copy the list of bindings.  The expressions are not copied.
+func (bindings *BindStms) copy() *BindStms {
+	c := &BindStms{
+		Node:  bindings.Node,
+		List:  make([]*BindStm, 0, len(bindings.List)),
+		Table: make(map[string]*BindStm, len(bindings.List)),
+	}
+	for _, binding := range bindings.List {
+		b := *binding
+		c.List = append(c.List, &b)
+	}
+	return c
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"strings"
+	"testing"
+)
+
+const genericSrc = `filetype bam;
+filetype fastq;
+
+stage ALIGN_READS(
+    in  file[] reads,
+    out bam    aligned,
+    src py     "stages/align",
+)
+
+pipeline ALIGN<READS>(
+    in  READS[] reads,
+    out bam     aligned,
+)
+{
+    call ALIGN_READS(
+        reads = self.reads,
+    )
+
+    return (
+        aligned = ALIGN_READS.aligned,
+    )
+}
+
+pipeline PROCESS<T>(
+    in  T[] reads,
+    out bam aligned,
+)
+{
+    call ALIGN<T>(
+        reads = self.reads,
+    )
+
+    return (
+        aligned = ALIGN.aligned,
+    )
+}
+
+pipeline MAIN(
+    in  fastq[] fq_reads,
+    in  bam[]   bam_reads,
+    out bam     fq_aligned,
+    out bam     bam_aligned,
+)
+{
+    call PROCESS<fastq> as FQ(
+        reads = self.fq_reads,
+    )
+
+    call ALIGN<bam> as BAM(
+        reads = self.bam_reads,
+    )
+
+    return (
+        fq_aligned  = FQ.aligned,
+        bam_aligned = BAM.aligned,
+    )
+}
+`
+
+func TestGenericPipeline(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, genericSrc)
+	if ast == nil {
+		return
+	}
+	if formatted := ast.format(false, INDENT); formatted != genericSrc {
+		diffLines(genericSrc, formatted, t)
+	}
+	for id, tname := range map[string]string{
+		"ALIGN<fastq>":   "fastq",
+		"ALIGN<bam>":     "bam",
+		"PROCESS<fastq>": "fastq",
+	} {
+		if instance, ok := ast.Callables.Table[id].(*Pipeline); !ok {
+			t.Errorf("Expected an instance %s", id)
+		} else if param := instance.InParams.Table["reads"]; param == nil {
+			t.Errorf("Expected %s to be compiled", id)
+		} else if param.Tname != tname {
+			t.Errorf("Expected %s.reads to be %s, got %s", id, tname, param.Tname)
+		}
+	}
+	if _, ok := ast.Callables.Table["PROCESS<bam>"]; ok {
+		t.Error("Unexpected instance PROCESS<bam>")
+	}
+	if p := ast.Callables.Table["PROCESS"].(*Pipeline); !p.IsGeneric() ||
+		p.InParams.List[0].Tname != "T" {
+		t.Error("Generic pipeline was modified.")
+	}
+	if call := ast.Callables.Table["PROCESS<fastq>"].(*Pipeline).Calls[0]; call.DecId != "ALIGN<fastq>" {
+		t.Errorf("Incorrect nested instance %s", call.DecId)
+	}
+	if calls := ast.ReferencesTo("ALIGN"); len(calls) != 2 ||
+		calls[0].Id != "ALIGN" || calls[1].Id != "BAM" {
+		t.Errorf("Expected 2 references to ALIGN, got %v", calls)
+	}
+}
+
+func TestGenericPipelineErrors(t *testing.T) {
+	t.Parallel()
+	check := func(old, new, expect string) {
+		t.Helper()
+		if !strings.Contains(genericSrc, old) {
+			t.Fatalf("Source does not contain %q", old)
+		}
+		msg := testBadCompile(t, strings.Replace(genericSrc, old, new, 1))
+		if !strings.Contains(msg, expect) {
+			t.Errorf("Expected %q, got %s", expect, msg)
+		}
+	}
+	check("call ALIGN<bam> as BAM(", "call ALIGN as BAM(",
+		"GenericTypeError: pipeline 'ALIGN' requires 1 type arguments")
+	check("call ALIGN<bam> as BAM(", "call ALIGN<bam, fastq> as BAM(",
+		"GenericTypeError: pipeline 'ALIGN' takes 1 type arguments, but 2 were given")
+	check("call ALIGN<bam> as BAM(", "call ALIGN<sam> as BAM(",
+		"TypeError: undefined type 'sam'")
+	check("call ALIGN_READS(", "call ALIGN_READS<bam>(",
+		"GenericTypeError: stage 'ALIGN_READS' does not take type arguments")
+	check("pipeline PROCESS<T>(", "pipeline PROCESS<T, T>(",
+		"DuplicateNameError: type parameter 'T'")
+	check("reads = self.bam_reads,", "reads = self.fq_reads,",
+		"TypeMismatchError: expected type 'bam[]' for 'reads' but got 'fastq[]' instead")
+}
@@ -23,15 +23,21 @@ type mmSymType struct {
 	global    *Ast
 	srcfile   *SourceFile
 	arr       int16
-	loc       int
+	loc       SourceLoc
 	val       []byte
 	modifiers *Modifiers
 	dec       Dec
 	decs      []Dec
 	inparam   *InParam
 	outparam  *OutParam
+	sfield    *StructField
+	sfields   []*StructField
+	strs      []string
+	tparams   []*TypeParam
 	retains   []*RetainParam
 	stretains *RetainParams
+	envvars   []*EnvVar
+	stenv     *StageEnv
 	i_params  *InParams
 	o_params  *OutParams
 	res       *Resources
@@ -66,47 +72,60 @@ const LPAREN = 57355
 const RPAREN = 57356
 const LBRACE = 57357
 const RBRACE = 57358
-const SWEEP = 57359
-const RETURN = 57360
-const SELF = 57361
-const FILETYPE = 57362
-const STAGE = 57363
-const PIPELINE = 57364
-const CALL = 57365
-const SPLIT = 57366
-const USING = 57367
-const RETAIN = 57368
-const LOCAL = 57369
-const PREFLIGHT = 57370
-const VOLATILE = 57371
-const DISABLED = 57372
-const STRICT = 57373
-const IN = 57374
-const OUT = 57375
-const SRC = 57376
-const AS = 57377
-const THREADS = 57378
-const MEM_GB = 57379
-const SPECIAL = 57380
-const ID = 57381
-const LITSTRING = 57382
-const NUM_FLOAT = 57383
-const NUM_INT = 57384
-const DOT = 57385
-const PY = 57386
-const EXEC = 57387
-const COMPILED = 57388
-const MAP = 57389
-const INT = 57390
-const STRING = 57391
-const FLOAT = 57392
-const PATH = 57393
-const BOOL = 57394
-const TRUE = 57395
-const FALSE = 57396
-const NULL = 57397
-const DEFAULT = 57398
-const INCLUDE_DIRECTIVE = 57399
+const LANGLE = 57359
+const RANGLE = 57360
+const SWEEP = 57361
+const RETURN = 57362
+const SELF = 57363
+const FILETYPE = 57364
+const ENUM = 57365
+const STRUCT = 57366
+const STAGE = 57367
+const PIPELINE = 57368
+const CALL = 57369
+const SPLIT = 57370
+const USING = 57371
+const RETAIN = 57372
+const ENV = 57373
+const LOCAL = 57374
+const PREFLIGHT = 57375
+const VOLATILE = 57376
+const DISABLED = 57377
+const STRICT = 57378
+const IN = 57379
+const OUT = 57380
+const SRC = 57381
+const AS = 57382
+const THREADS = 57383
+const MEM_GB = 57384
+const SPECIAL = 57385
+const GPUS = 57386
+const TIMEOUT = 57387
+const RETRIES = 57388
+const DISK_SPACE_GB = 57389
+const PRIORITY = 57390
+const ID = 57391
+const LITSTRING = 57392
+const NUM_FLOAT = 57393
+const NUM_INT = 57394
+const DOT = 57395
+const PY = 57396
+const EXEC = 57397
+const COMPILED = 57398
+const DOCKER = 57399
+const PODMAN = 57400
+const MAP = 57401
+const INT = 57402
+const STRING = 57403
+const FLOAT = 57404
+const PATH = 57405
+const BOOL = 57406
+const TRUE = 57407
+const FALSE = 57408
+const NULL = 57409
+const DEFAULT = 57410
+const INCLUDE_DIRECTIVE = 57411
+const DEPRECATED = 57412
 
 var mmToknames = [...]string{
 	"$end",
@@ -125,16 +144,21 @@ var mmToknames = [...]string{
 	"RPAREN",
 	"LBRACE",
 	"RBRACE",
+	"LANGLE",
+	"RANGLE",
 	"SWEEP",
 	"RETURN",
 	"SELF",
 	"FILETYPE",
+	"ENUM",
+	"STRUCT",
 	"STAGE",
 	"PIPELINE",
 	"CALL",
 	"SPLIT",
 	"USING",
 	"RETAIN",
+	"ENV",
 	"LOCAL",
 	"PREFLIGHT",
 	"VOLATILE",
@@ -147,6 +171,11 @@ var mmToknames = [...]string{
 	"THREADS",
 	"MEM_GB",
 	"SPECIAL",
+	"GPUS",
+	"TIMEOUT",
+	"RETRIES",
+	"DISK_SPACE_GB",
+	"PRIORITY",
 	"ID",
 	"LITSTRING",
 	"NUM_FLOAT",
@@ -155,6 +184,8 @@ var mmToknames = [...]string{
 	"PY",
 	"EXEC",
 	"COMPILED",
+	"DOCKER",
+	"PODMAN",
 	"MAP",
 	"INT",
 	"STRING",
@@ -166,6 +197,7 @@ var mmToknames = [...]string{
 	"NULL",
 	"DEFAULT",
 	"INCLUDE_DIRECTIVE",
+	"DEPRECATED",
 }
 var mmStatenames = [...]string{}
 
@@ -173,214 +205,298 @@ const mmEofCode = 1
 const mmErrCode = 2
 const mmInitialStackSize = 16
 
-//line grammar.y:725
+//line grammar.y:956
 
 //line yacctab:1
 var mmExca = [...]int{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 44,
-	13, 111,
-	35, 111,
-	-2, 70,
-	-1, 45,
-	13, 113,
-	35, 113,
-	-2, 71,
-	-1, 46,
-	13, 120,
-	35, 120,
-	-2, 72,
+	-1, 3,
+	1, 4,
+	-2, 0,
+	-1, 17,
+	1, 1,
+	-2, 0,
+	-1, 62,
+	13, 150,
+	17, 150,
+	40, 150,
+	-2, 104,
+	-1, 63,
+	13, 153,
+	17, 153,
+	40, 153,
+	-2, 105,
+	-1, 64,
+	13, 164,
+	17, 164,
+	40, 164,
+	-2, 106,
 }
 
 const mmPrivate = 57344
 
-const mmLast = 607
+const mmLast = 992
 
 var mmAct = [...]int{
 
-	96, 117, 140, 65, 171, 63, 55, 150, 138, 22,
-	106, 4, 38, 39, 14, 16, 81, 123, 91, 92,
-	212, 43, 102, 103, 104, 40, 27, 47, 113, 112,
-	33, 36, 31, 28, 30, 37, 25, 34, 8, 11,
-	12, 7, 35, 29, 32, 23, 48, 223, 184, 54,
-	222, 26, 24, 224, 64, 200, 141, 56, 18, 191,
-	68, 173, 170, 48, 75, 155, 128, 41, 22, 19,
-	204, 67, 183, 52, 95, 15, 225, 201, 202, 203,
-	143, 22, 99, 8, 11, 12, 7, 90, 93, 94,
-	172, 218, 152, 172, 177, 53, 152, 105, 80, 79,
-	75, 114, 166, 147, 145, 127, 149, 131, 130, 7,
-	80, 162, 206, 134, 135, 146, 129, 27, 163, 133,
-	5, 33, 36, 31, 28, 30, 37, 25, 34, 89,
-	151, 80, 193, 35, 29, 32, 23, 152, 107, 154,
-	158, 100, 26, 24, 157, 7, 159, 194, 80, 8,
-	11, 12, 7, 179, 169, 57, 186, 153, 180, 174,
-	6, 178, 168, 181, 17, 167, 137, 185, 59, 60,
-	61, 62, 76, 189, 17, 188, 50, 160, 49, 192,
-	161, 217, 181, 42, 195, 216, 215, 214, 98, 72,
-	71, 70, 205, 69, 230, 229, 75, 1, 228, 118,
-	213, 211, 196, 119, 227, 226, 221, 97, 27, 210,
-	220, 207, 33, 36, 31, 28, 30, 37, 25, 34,
-	197, 190, 175, 148, 35, 29, 32, 23, 122, 120,
-	121, 118, 182, 26, 24, 119, 136, 111, 110, 97,
-	27, 91, 92, 124, 33, 36, 31, 28, 30, 37,
-	25, 34, 109, 108, 198, 164, 35, 29, 32, 23,
-	122, 120, 121, 118, 139, 26, 24, 119, 187, 144,
-	156, 97, 27, 91, 92, 124, 33, 36, 31, 28,
-	30, 37, 25, 34, 51, 58, 74, 88, 35, 29,
-	32, 23, 122, 120, 121, 118, 21, 26, 24, 119,
-	132, 115, 142, 97, 27, 91, 92, 124, 33, 36,
-	31, 28, 30, 37, 25, 34, 3, 116, 77, 13,
-	35, 29, 32, 23, 122, 120, 121, 118, 126, 26,
-	24, 119, 176, 208, 165, 97, 27, 91, 92, 124,
-	33, 36, 31, 28, 30, 37, 25, 34, 199, 78,
-	66, 10, 35, 29, 32, 23, 122, 120, 121, 9,
-	20, 26, 24, 101, 2, 0, 0, 0, 27, 91,
-	92, 124, 33, 36, 31, 28, 30, 37, 25, 34,
-	0, 0, 0, 0, 35, 29, 32, 23, 0, 0,
-	0, 0, 0, 26, 24, 87, 82, 83, 85, 84,
-	86, 219, 0, 0, 0, 0, 97, 27, 0, 0,
-	0, 33, 36, 31, 28, 30, 37, 25, 34, 0,
-	0, 0, 0, 35, 29, 32, 23, 0, 209, 0,
-	0, 0, 26, 24, 27, 0, 0, 0, 33, 36,
-	31, 28, 30, 37, 25, 34, 0, 0, 130, 0,
-	35, 29, 32, 23, 0, 0, 0, 27, 0, 26,
-	24, 33, 36, 31, 28, 30, 37, 25, 34, 0,
-	0, 0, 0, 35, 29, 32, 23, 0, 125, 0,
-	0, 0, 26, 24, 27, 0, 0, 0, 33, 36,
-	31, 28, 30, 37, 25, 34, 0, 0, 0, 0,
-	35, 29, 32, 23, 0, 0, 97, 27, 0, 26,
-	24, 33, 36, 31, 28, 30, 37, 25, 34, 0,
-	0, 0, 0, 35, 29, 32, 23, 0, 73, 0,
-	0, 0, 26, 24, 27, 0, 0, 0, 33, 36,
-	31, 28, 30, 37, 25, 34, 0, 0, 0, 0,
-	35, 29, 32, 23, 0, 0, 0, 27, 0, 26,
-	24, 33, 36, 31, 28, 30, 37, 25, 34, 0,
-	0, 0, 0, 35, 29, 32, 23, 0, 0, 0,
-	27, 0, 26, 24, 33, 36, 31, 44, 45, 46,
-	25, 34, 0, 0, 0, 0, 35, 29, 32, 23,
-	0, 0, 0, 0, 0, 26, 24,
+	138, 118, 182, 210, 108, 166, 221, 81, 208, 181,
+	27, 53, 54, 124, 12, 4, 56, 57, 18, 20,
+	94, 188, 198, 163, 146, 162, 61, 133, 134, 65,
+	66, 305, 304, 58, 303, 36, 33, 48, 302, 301,
+	300, 46, 51, 43, 34, 38, 41, 52, 30, 47,
+	299, 202, 203, 246, 49, 39, 45, 37, 50, 44,
+	31, 42, 28, 168, 22, 255, 122, 76, 35, 29,
+	32, 40, 243, 84, 223, 66, 27, 220, 311, 306,
+	27, 197, 167, 7, 9, 10, 11, 15, 16, 8,
+	111, 173, 168, 119, 168, 107, 211, 172, 78, 254,
+	106, 69, 123, 9, 10, 11, 15, 16, 8, 59,
+	24, 27, 91, 222, 131, 168, 130, 291, 222, 142,
+	137, 110, 27, 168, 270, 145, 128, 127, 157, 27,
+	213, 129, 13, 307, 23, 215, 132, 135, 136, 92,
+	195, 128, 144, 156, 193, 165, 171, 248, 128, 155,
+	19, 13, 128, 237, 183, 8, 194, 175, 184, 15,
+	229, 75, 7, 177, 178, 72, 142, 8, 179, 174,
+	150, 151, 152, 153, 154, 200, 147, 273, 85, 121,
+	199, 201, 9, 10, 11, 15, 16, 8, 120, 176,
+	80, 113, 205, 187, 185, 186, 87, 88, 89, 90,
+	112, 6, 250, 218, 233, 21, 224, 251, 133, 134,
+	189, 234, 103, 226, 274, 257, 230, 102, 249, 21,
+	228, 238, 217, 241, 231, 240, 216, 232, 169, 5,
+	13, 244, 245, 259, 207, 252, 143, 82, 70, 256,
+	68, 67, 60, 55, 298, 269, 290, 289, 288, 287,
+	286, 275, 285, 268, 252, 284, 283, 282, 164, 281,
+	260, 261, 267, 262, 263, 264, 265, 266, 117, 116,
+	115, 114, 322, 101, 321, 320, 142, 319, 318, 278,
+	297, 183, 295, 26, 276, 184, 317, 316, 315, 314,
+	313, 139, 36, 33, 48, 309, 312, 310, 46, 51,
+	43, 34, 38, 41, 52, 30, 47, 294, 277, 272,
+	271, 49, 39, 45, 37, 50, 44, 31, 42, 28,
+	187, 185, 186, 242, 225, 35, 29, 32, 40, 183,
+	253, 219, 206, 184, 196, 133, 134, 189, 191, 139,
+	36, 33, 48, 161, 160, 159, 46, 51, 43, 34,
+	38, 41, 52, 30, 47, 158, 235, 1, 239, 49,
+	39, 45, 37, 50, 44, 31, 42, 28, 187, 185,
+	186, 192, 227, 35, 29, 32, 40, 183, 209, 3,
+	73, 184, 17, 133, 134, 189, 86, 139, 36, 33,
+	48, 141, 204, 212, 46, 51, 43, 34, 38, 41,
+	52, 30, 47, 125, 170, 247, 292, 49, 39, 45,
+	37, 50, 44, 31, 42, 28, 187, 185, 186, 214,
+	258, 35, 29, 32, 40, 236, 183, 279, 83, 71,
+	184, 133, 134, 189, 180, 93, 139, 36, 33, 48,
+	74, 77, 79, 46, 51, 43, 34, 38, 41, 52,
+	30, 47, 105, 126, 109, 14, 49, 39, 45, 37,
+	50, 44, 31, 42, 28, 187, 185, 186, 25, 149,
+	35, 29, 32, 40, 183, 148, 2, 0, 184, 0,
+	133, 134, 189, 0, 139, 36, 33, 48, 0, 0,
+	0, 46, 51, 43, 34, 38, 41, 52, 30, 47,
+	0, 0, 0, 0, 49, 39, 45, 37, 50, 44,
+	31, 42, 28, 187, 185, 186, 0, 104, 35, 29,
+	32, 40, 0, 0, 0, 36, 33, 48, 133, 134,
+	189, 46, 51, 43, 34, 38, 41, 52, 30, 47,
+	0, 0, 0, 0, 49, 39, 45, 37, 50, 44,
+	31, 42, 28, 0, 0, 0, 0, 0, 35, 29,
+	32, 40, 100, 95, 96, 98, 97, 99, 36, 33,
+	48, 0, 0, 0, 46, 51, 43, 34, 38, 41,
+	52, 30, 47, 0, 0, 0, 0, 49, 39, 45,
+	37, 50, 44, 31, 42, 28, 0, 0, 0, 0,
+	0, 35, 29, 32, 40, 100, 95, 96, 98, 97,
+	99, 308, 0, 0, 0, 0, 0, 0, 139, 36,
+	33, 48, 0, 0, 0, 46, 51, 43, 34, 38,
+	41, 52, 30, 47, 0, 0, 0, 0, 49, 39,
+	45, 37, 50, 44, 31, 42, 28, 0, 296, 0,
+	0, 0, 35, 29, 32, 40, 36, 33, 48, 0,
+	0, 0, 46, 51, 43, 34, 38, 41, 52, 30,
+	47, 0, 0, 0, 0, 49, 39, 45, 37, 50,
+	44, 31, 42, 28, 0, 293, 0, 0, 0, 35,
+	29, 32, 40, 36, 33, 48, 0, 0, 0, 46,
+	51, 43, 34, 38, 41, 52, 30, 47, 0, 0,
+	0, 0, 49, 39, 45, 37, 50, 44, 31, 42,
+	28, 0, 280, 0, 0, 0, 35, 29, 32, 40,
+	36, 33, 48, 0, 0, 0, 46, 51, 43, 34,
+	38, 41, 52, 30, 47, 0, 0, 0, 0, 49,
+	39, 45, 37, 50, 44, 31, 42, 28, 0, 190,
+	0, 0, 0, 35, 29, 32, 40, 36, 33, 48,
+	0, 0, 0, 46, 51, 43, 34, 38, 41, 52,
+	30, 47, 0, 0, 0, 0, 49, 39, 45, 37,
+	50, 44, 31, 42, 28, 146, 0, 0, 0, 0,
+	35, 29, 32, 40, 0, 0, 36, 33, 48, 0,
+	0, 0, 46, 51, 43, 34, 38, 41, 52, 30,
+	47, 0, 0, 0, 0, 49, 39, 45, 37, 50,
+	44, 31, 42, 28, 0, 140, 0, 0, 0, 35,
+	29, 32, 40, 36, 33, 48, 0, 0, 0, 46,
+	51, 43, 34, 38, 41, 52, 30, 47, 0, 0,
+	0, 0, 49, 39, 45, 37, 50, 44, 31, 42,
+	28, 0, 0, 0, 0, 0, 35, 29, 32, 40,
+	139, 36, 33, 48, 0, 0, 0, 46, 51, 43,
+	34, 38, 41, 52, 30, 47, 0, 0, 0, 0,
+	49, 39, 45, 37, 50, 44, 31, 42, 28, 0,
+	0, 0, 0, 0, 35, 29, 32, 40, 36, 33,
+	48, 0, 0, 0, 46, 51, 43, 34, 38, 41,
+	52, 30, 47, 0, 0, 0, 0, 49, 39, 45,
+	37, 50, 44, 31, 42, 28, 0, 0, 0, 0,
+	0, 35, 29, 32, 40, 36, 33, 48, 0, 0,
+	0, 46, 51, 43, 34, 62, 63, 64, 30, 47,
+	0, 0, 0, 0, 49, 39, 45, 37, 50, 44,
+	31, 42, 28, 0, 0, 0, 0, 0, 35, 29,
+	32, 40,
 }
 var mmPact = [...]int{
 
-	63, -1000, 18, 129, 33, 29, -1000, -1000, 537, -1000,
-	-1000, 537, 537, 129, 33, 27, 33, -1000, 170, -1000,
-	560, 20, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, 165, 163,
-	33, -1000, -1000, 60, -1000, -1000, -1000, -1000, 537, -1000,
-	-1000, 141, -1000, 537, -1000, 39, 39, -1000, -1000, 183,
-	181, 180, 179, 514, 159, 65, -1000, 348, 115, -35,
-	-35, -35, 487, -1000, -1000, 178, -1000, 127, -1000, -22,
-	348, -1000, -1000, -1000, -1000, -1000, -1000, -1000, 3, 123,
-	244, -1000, -1000, 243, 229, 228, -14, -15, 284, 464,
-	81, 26, -1000, -1000, -1000, -1000, 437, 86, -1000, -1000,
-	-1000, -1000, 537, 537, 227, 153, -1000, -1000, 252, 40,
-	-1000, -1000, -1000, -1000, -1000, -1000, 79, 90, 214, 97,
-	145, 56, 122, 33, -1000, -1000, -1000, 316, 168, -1000,
-	-1000, -1000, 102, 247, 76, 152, 149, -1000, -1000, -1000,
-	53, 52, -1000, -1000, 213, -1000, 68, 33, 148, 144,
-	220, -1000, 32, -1000, 316, -1000, 143, -1000, -1000, 39,
-	-1000, 212, -1000, -1000, 50, -1000, 116, 134, -1000, 188,
-	211, -1000, -1000, 246, -1000, -1000, -1000, 41, 39, 98,
-	-1000, -1000, 202, -1000, -1000, 414, 200, -1000, 316, 6,
-	-1000, 177, 176, 175, 171, 77, -1000, -1000, 387, -1000,
-	-1000, -1000, -1000, 197, 8, 5, 13, 45, -1000, -1000,
-	196, -1000, 195, 189, 186, 185, -1000, -1000, -1000, -1000,
-	-1000,
+	160, -1000, 81, 62, 105, 60, -1000, -1000, -1000, 896,
+	896, 896, -1000, 230, -1000, 896, 896, 62, 105, 59,
+	105, -1000, -1000, 229, -1000, 933, 22, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, 228, 227, 51, 225, 148, 105, -1000,
+	-1000, 144, -1000, -1000, -1000, -1000, 896, 48, -1000, 176,
+	-1000, 224, 896, 164, 99, 546, -1000, 203, -1000, 503,
+	134, 84, -1000, 182, -1000, -1000, -1000, 261, 260, 259,
+	258, -1000, 896, 170, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -23, -1000, 52, -1000, -1000, -1000, -1000, 88, -1000,
+	546, 84, -1000, 896, -38, -38, -38, 859, 821, 223,
+	-1000, 546, -1000, -1000, 784, 162, -1000, 116, 546, -1000,
+	114, -1000, 346, -1000, -1000, 336, 335, 334, -28, -30,
+	-1000, -1000, 248, -1000, -1000, 73, 216, 118, 47, 41,
+	-1000, -1000, -1000, -1000, -1000, -1000, 784, 174, -1000, -1000,
+	-1000, -1000, 896, 896, 415, 745, 329, -1000, -1000, -1000,
+	115, 127, 325, 31, 13, 42, 128, -1000, -1000, 323,
+	221, -1000, -1000, 366, 80, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, 104, 213, 209, -1000, -1000, 322, -1000, 68,
+	65, 315, -1000, 143, 140, 105, -1000, 463, 215, -1000,
+	-1000, -1000, 195, 348, 123, 208, -1000, -1000, 84, -1000,
+	-1000, 314, -1000, -1000, 63, -1000, 44, 117, 105, 205,
+	193, 318, -1000, 49, -1000, 463, -1000, 202, -1000, 219,
+	84, 110, -1000, -1000, 301, 300, -1000, 161, 201, -1000,
+	270, 299, -1000, -1000, 271, -1000, -1000, -1000, 708, -1000,
+	247, 246, 245, 242, 240, 239, 238, 237, 236, 103,
+	-1000, -1000, -1000, -1000, -1000, 671, 298, -1000, 463, 634,
+	-1000, 234, -2, -12, -13, -14, -18, -20, -21, 29,
+	97, -1000, 597, -1000, -1000, -1000, -1000, 288, 28, 287,
+	281, 280, 279, 278, 277, 269, 268, 266, -1000, 265,
+	-1000, 263, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000,
 }
 var mmPgo = [...]int{
 
-	0, 364, 0, 287, 16, 7, 363, 4, 360, 10,
-	160, 359, 351, 316, 350, 349, 348, 334, 333, 332,
-	6, 3, 328, 318, 2, 1, 317, 17, 8, 302,
-	11, 300, 286, 285, 5, 284, 270, 269, 268, 197,
+	0, 476, 0, 273, 20, 5, 475, 469, 6, 468,
+	13, 201, 14, 455, 379, 454, 453, 452, 442, 441,
+	440, 435, 429, 428, 427, 425, 420, 419, 406, 405,
+	7, 4, 404, 403, 3, 2, 9, 21, 8, 393,
+	15, 392, 391, 386, 1, 380, 372, 371, 358, 357,
 }
 var mmR1 = [...]int{
 
-	0, 39, 39, 39, 39, 39, 39, 1, 1, 13,
-	13, 10, 10, 10, 12, 11, 37, 37, 38, 38,
-	38, 38, 38, 17, 17, 16, 16, 3, 3, 9,
-	9, 20, 20, 14, 14, 21, 21, 15, 15, 15,
-	15, 15, 15, 23, 5, 7, 4, 4, 4, 4,
-	4, 4, 4, 6, 6, 6, 22, 22, 22, 36,
-	19, 19, 18, 18, 31, 31, 30, 30, 30, 8,
-	8, 8, 8, 35, 35, 33, 33, 33, 33, 34,
-	34, 32, 32, 32, 28, 28, 29, 29, 24, 24,
-	26, 26, 26, 26, 26, 26, 26, 26, 26, 26,
-	26, 27, 27, 25, 25, 25, 2, 2, 2, 2,
+	0, 49, 49, 49, 49, 49, 49, 1, 1, 14,
+	14, 14, 14, 11, 11, 11, 11, 11, 11, 11,
+	19, 19, 18, 18, 17, 17, 13, 22, 22, 23,
+	23, 12, 47, 47, 48, 48, 48, 48, 48, 48,
+	48, 48, 48, 48, 27, 27, 26, 26, 25, 25,
+	24, 24, 3, 3, 10, 10, 30, 30, 15, 15,
+	15, 15, 31, 31, 16, 16, 16, 16, 16, 16,
+	33, 33, 5, 8, 4, 4, 4, 4, 4, 4,
+	4, 6, 6, 6, 7, 7, 32, 32, 32, 46,
+	29, 29, 28, 28, 41, 41, 40, 40, 40, 20,
+	20, 21, 21, 9, 9, 9, 9, 45, 45, 43,
+	43, 43, 43, 44, 44, 42, 42, 42, 38, 38,
+	39, 39, 34, 34, 36, 36, 36, 36, 36, 36,
+	36, 36, 36, 36, 36, 37, 37, 35, 35, 35,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
-	2,
+	2, 2, 2, 2, 2,
 }
 var mmR2 = [...]int{
 
 	0, 2, 3, 2, 1, 2, 1, 3, 2, 2,
-	1, 3, 1, 1, 11, 10, 0, 4, 0, 5,
-	5, 5, 5, 0, 4, 0, 3, 3, 1, 0,
-	3, 0, 2, 6, 5, 0, 2, 4, 5, 6,
-	5, 6, 7, 4, 1, 1, 1, 1, 1, 1,
+	1, 2, 1, 3, 5, 6, 5, 1, 5, 1,
+	3, 1, 0, 2, 5, 4, 12, 0, 3, 1,
+	3, 11, 0, 4, 0, 5, 5, 5, 5, 5,
+	5, 5, 5, 5, 0, 4, 0, 5, 0, 4,
+	0, 3, 3, 1, 0, 3, 0, 2, 6, 5,
+	8, 7, 0, 2, 4, 5, 6, 5, 6, 7,
+	4, 5, 1, 1, 1, 1, 1, 1, 1, 1,
 	1, 1, 1, 1, 1, 1, 0, 6, 5, 4,
-	0, 4, 0, 3, 2, 1, 6, 8, 5, 0,
-	2, 2, 2, 0, 2, 4, 4, 4, 4, 0,
-	2, 4, 8, 7, 3, 1, 5, 3, 1, 1,
-	3, 4, 2, 2, 3, 4, 1, 1, 1, 1,
-	1, 1, 1, 3, 1, 3, 1, 1, 1, 1,
+	0, 4, 0, 3, 2, 1, 7, 9, 5, 0,
+	3, 1, 3, 0, 2, 2, 2, 0, 2, 4,
+	4, 4, 4, 0, 2, 4, 8, 7, 3, 1,
+	5, 3, 1, 1, 3, 4, 2, 2, 3, 4,
+	1, 1, 1, 1, 1, 1, 1, 3, 1, 3,
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
-	1,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	1, 1, 1, 1, 1,
 }
 var mmChk = [...]int{
 
-	-1000, -39, -1, -13, -30, 57, -10, 23, 20, -11,
-	-12, 21, 22, -13, -30, 57, -30, -10, 25, 40,
-	-8, -3, -2, 39, 46, 30, 45, 20, 27, 37,
-	28, 26, 38, 24, 31, 36, 25, 29, -2, -2,
-	-30, 40, 13, -2, 27, 28, 29, 7, 43, 13,
-	13, -35, 13, 35, -2, -20, -20, 14, -33, 27,
-	28, 29, 30, -34, -2, -21, -14, 32, -21, 10,
-	10, 10, 10, 14, -32, -2, 13, -23, -15, 34,
-	33, -4, 48, 49, 51, 50, 52, 47, -3, 14,
-	-27, 53, 54, -27, -27, -25, -2, 19, 10, -34,
-	14, -6, 44, 45, 46, -4, -9, 15, 9, 9,
-	9, 9, 43, 43, -24, 17, -26, -25, 11, 15,
-	41, 42, 40, -27, 55, 14, -22, 24, 40, -9,
-	11, -2, -31, -30, -2, -2, 9, 13, -28, 12,
-	-24, 16, -29, 40, -37, 25, 25, 13, 9, 9,
-	-5, -2, 40, 12, -5, 9, -36, -30, 18, -28,
-	9, 12, 9, 16, 8, -17, 26, 13, 13, -20,
-	9, -7, 40, 9, -5, 9, -19, 26, 13, 9,
-	14, -24, 12, 40, 16, -24, 13, -38, -20, -21,
-	9, 9, -7, 16, 13, -34, 14, 9, 8, -16,
-	14, 36, 37, 38, 29, -21, 14, 9, -18, 14,
-	9, -24, 14, -2, 10, 10, 10, 10, 14, 14,
-	-25, 9, 42, 42, 40, 31, 9, 9, 9, 9,
-	9,
+	-1000, -49, -1, -14, -40, 69, -11, 2, 27, 22,
+	23, 24, -12, 70, -13, 25, 26, -14, -40, 69,
+	-40, -11, 2, 29, 50, -9, -3, -2, 49, 56,
+	35, 47, 57, 23, 31, 55, 22, 44, 32, 42,
+	58, 33, 48, 30, 46, 43, 28, 36, 24, 41,
+	45, 29, 34, -2, -2, 13, -2, -2, -40, 50,
+	13, -2, 32, 33, 34, 7, 53, 13, 13, 50,
+	13, -22, 17, -45, -20, 17, -2, -19, 50, -18,
+	14, -30, 13, -23, -2, 14, -43, 32, 33, 34,
+	35, 13, 40, -21, -4, 60, 61, 63, 62, 64,
+	59, -3, 14, 9, 14, -17, -4, -12, -31, -15,
+	37, -30, 18, 9, 10, 10, 10, 10, -44, -2,
+	18, 9, 14, 50, -10, -33, -16, 39, 38, -4,
+	-31, -2, -37, 65, 66, -37, -37, -35, -2, 21,
+	14, -42, -2, 13, -4, -2, 11, 14, -6, -7,
+	54, 55, 56, 57, 58, -4, -10, 14, 9, 9,
+	9, 9, 53, 53, 10, -44, -5, 9, 50, 12,
+	-32, 28, 50, 50, -10, -2, 15, -2, -2, -34,
+	19, -36, -35, 11, 15, 51, 52, 50, -37, 67,
+	14, 9, -47, 29, 29, 13, 9, 50, 9, -5,
+	-2, -5, 9, 10, -41, -40, 9, 13, -38, 12,
+	-34, 16, -39, 50, -27, 31, 13, 13, -30, 9,
+	9, -8, 50, 9, -5, 9, -36, -46, -40, 20,
+	-38, 9, 12, 9, 16, 8, -25, 30, 13, -48,
+	-30, -31, 9, 9, -8, -5, 9, -29, 30, 13,
+	9, 14, -34, 12, 50, 16, -34, 13, -26, 14,
+	41, 42, 44, 45, 46, 47, 48, 43, 34, -31,
+	14, 9, 9, 16, 13, -44, 14, 9, 8, -24,
+	14, -2, 10, 10, 10, 10, 10, 10, 10, 10,
+	10, 14, -28, 14, 9, -34, 14, -2, 10, 52,
+	52, 52, 52, 52, 52, 52, 50, 36, 14, -35,
+	9, 50, 9, 9, 9, 9, 9, 9, 9, 9,
+	9, 9, 9,
 }
 var mmDef = [...]int{
 
-	0, -2, 0, 4, 6, 0, 10, 69, 0, 12,
-	13, 0, 0, 1, 3, 0, 5, 9, 0, 8,
-	0, 0, 28, 106, 107, 108, 109, 110, 111, 112,
-	113, 114, 115, 116, 117, 118, 119, 120, 0, 0,
-	2, 7, 73, 0, -2, -2, -2, 11, 0, 31,
-	31, 0, 79, 0, 27, 35, 35, 68, 74, 0,
-	0, 0, 0, 0, 0, 0, 32, 0, 0, 0,
-	0, 0, 0, 66, 80, 0, 79, 0, 36, 0,
-	0, 29, 46, 47, 48, 49, 50, 51, 52, 0,
-	0, 101, 102, 0, 0, 0, 104, 0, 0, 0,
-	56, 0, 53, 54, 55, 29, 0, 0, 75, 76,
-	77, 78, 0, 0, 0, 0, 88, 89, 0, 0,
-	96, 97, 98, 99, 100, 67, 16, 0, 0, 0,
-	0, 0, 0, 65, 103, 105, 81, 0, 0, 92,
-	85, 93, 0, 0, 23, 0, 0, 31, 43, 37,
-	0, 0, 44, 30, 0, 34, 60, 64, 0, 0,
-	0, 90, 0, 94, 0, 15, 0, 18, 31, 35,
-	38, 0, 45, 40, 0, 33, 0, 0, 79, 0,
-	0, 84, 91, 0, 95, 87, 25, 0, 35, 0,
-	39, 41, 0, 14, 62, 0, 0, 83, 0, 0,
-	17, 0, 0, 0, 0, 0, 58, 42, 0, 59,
-	82, 86, 24, 0, 0, 0, 0, 0, 57, 61,
-	0, 26, 0, 0, 0, 0, 63, 19, 20, 21,
-	22,
+	0, -2, 0, -2, 6, 0, 10, 12, 103, 0,
+	0, 0, 17, 0, 19, 0, 0, -2, 3, 0,
+	5, 9, 11, 0, 8, 0, 0, 53, 140, 141,
+	142, 143, 144, 145, 146, 147, 148, 149, 150, 151,
+	152, 153, 154, 155, 156, 157, 158, 159, 160, 161,
+	162, 163, 164, 0, 0, 0, 0, 27, 2, 7,
+	107, 99, -2, -2, -2, 13, 0, 0, 22, 0,
+	56, 0, 0, 0, 0, 0, 52, 0, 21, 0,
+	0, 62, 56, 0, 29, 98, 108, 0, 0, 0,
+	0, 113, 0, 0, 101, 74, 75, 76, 77, 78,
+	79, 80, 14, 0, 16, 23, 54, 18, 0, 57,
+	0, 62, 28, 0, 0, 0, 0, 0, 0, 0,
+	100, 0, 15, 20, 0, 0, 63, 0, 0, 54,
+	0, 30, 0, 135, 136, 0, 0, 0, 138, 0,
+	96, 114, 0, 113, 102, 0, 0, 86, 0, 0,
+	81, 82, 83, 84, 85, 54, 0, 0, 109, 110,
+	111, 112, 0, 0, 0, 0, 0, 25, 72, 55,
+	32, 0, 0, 0, 0, 0, 0, 137, 139, 0,
+	0, 122, 123, 0, 0, 130, 131, 132, 133, 134,
+	97, 24, 44, 0, 0, 56, 70, 0, 64, 0,
+	0, 0, 59, 0, 0, 95, 115, 0, 0, 126,
+	119, 127, 0, 0, 48, 0, 34, 56, 62, 71,
+	65, 0, 73, 67, 0, 58, 0, 90, 94, 0,
+	0, 0, 124, 0, 128, 0, 31, 0, 46, 0,
+	62, 0, 66, 68, 0, 0, 61, 0, 0, 113,
+	0, 0, 118, 125, 0, 129, 121, 50, 0, 33,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	88, 69, 60, 26, 92, 0, 0, 117, 0, 0,
+	45, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 87, 0, 89, 116, 120, 49, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 91, 0,
+	51, 0, 35, 36, 37, 38, 39, 40, 41, 42,
+	43, 93, 47,
 }
 var mmTok1 = [...]int{
 
@@ -393,7 +509,8 @@ var mmTok2 = [...]int{
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
 	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
 	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
-	52, 53, 54, 55, 56, 57,
+	52, 53, 54, 55, 56, 57, 58, 59, 60, 61,
+	62, 63, 64, 65, 66, 67, 68, 69, 70,
 }
 var mmTok3 = [...]int{
 	0,
@@ -738,7 +855,7 @@ mmdefault:
 
 	case 1:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:94
+		//line grammar.y:106
 		{
 			{
 				global := NewAst(mmDollar[2].decs, nil, mmDollar[2].srcfile)
@@ -748,7 +865,7 @@ mmdefault:
 		}
 	case 2:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:100
+		//line grammar.y:112
 		{
 			{
 				global := NewAst(mmDollar[2].decs, mmDollar[3].call, mmDollar[2].srcfile)
@@ -758,7 +875,7 @@ mmdefault:
 		}
 	case 3:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:106
+		//line grammar.y:118
 		{
 			{
 				global := NewAst(nil, mmDollar[2].call, mmDollar[2].srcfile)
@@ -768,7 +885,7 @@ mmdefault:
 		}
 	case 4:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:112
+		//line grammar.y:124
 		{
 			{
 				global := NewAst(mmDollar[1].decs, nil, mmDollar[1].srcfile)
@@ -777,7 +894,7 @@ mmdefault:
 		}
 	case 5:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:117
+		//line grammar.y:129
 		{
 			{
 				global := NewAst(mmDollar[1].decs, mmDollar[2].call, mmDollar[1].srcfile)
@@ -786,7 +903,7 @@ mmdefault:
 		}
 	case 6:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:122
+		//line grammar.y:134
 		{
 			{
 				global := NewAst(nil, mmDollar[1].call, mmDollar[1].srcfile)
@@ -795,23 +912,23 @@ mmdefault:
 		}
 	case 7:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:130
+		//line grammar.y:142
 		{
 			{
 				mmVAL.includes = append(mmDollar[1].includes, &Include{
-					Node:  NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile),
+					Node:  astNodeAt(mmDollar[2].loc),
 					Value: mmDollar[3].intern.unquote(mmDollar[3].val),
 				})
 			}
 		}
 	case 8:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:136
+		//line grammar.y:148
 		{
 			{
 				mmVAL.includes = []*Include{
 					{
-						Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+						Node:  astNodeAt(mmDollar[1].loc),
 						Value: mmDollar[2].intern.unquote(mmDollar[2].val),
 					},
 				}
@@ -819,7 +936,7 @@ mmdefault:
 		}
 	case 9:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:146
+		//line grammar.y:158
 		{
 			{
 				mmVAL.decs = append(mmDollar[1].decs, mmDollar[2].dec)
@@ -827,47 +944,213 @@ mmdefault:
 		}
 	case 10:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:148
+		//line grammar.y:160
 		{
 			{
 				mmVAL.decs = []Dec{mmDollar[1].dec}
 			}
 		}
 	case 11:
+		mmDollar = mmS[mmpt-2 : mmpt+1]
+		//line grammar.y:162
+		{
+			{
+				mmVAL.srcfile = mmlex.(*mmLexInfo).srcfile
+				mmVAL.decs = mmDollar[1].decs
+			}
+		}
+	case 12:
+		mmDollar = mmS[mmpt-1 : mmpt+1]
+		//line grammar.y:167
+		{
+			{
+				mmVAL.srcfile = mmlex.(*mmLexInfo).srcfile
+				mmVAL.decs = nil
+			}
+		}
+	case 13:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:153
+		//line grammar.y:175
 		{
 			{
 				mmVAL.dec = &UserType{
-					Node: NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile),
+					Node: astNodeAt(mmDollar[2].loc),
 					Id:   mmDollar[2].intern.Get(mmDollar[2].val),
 				}
 			}
 		}
 	case 14:
-		mmDollar = mmS[mmpt-11 : mmpt+1]
-		//line grammar.y:163
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:180
 		{
 			{
-				mmVAL.dec = &Pipeline{
-					Node:      NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile),
-					Id:        mmDollar[2].intern.Get(mmDollar[2].val),
-					InParams:  mmDollar[4].i_params,
-					OutParams: mmDollar[5].o_params,
-					Calls:     mmDollar[8].calls,
-					Callables: &Callables{Table: make(map[string]Callable)},
-					Ret:       mmDollar[9].retstm,
-					Retain:    mmDollar[10].plretains,
+				mmVAL.dec = &EnumType{
+					Node:   astNodeAt(mmDollar[2].loc),
+					Id:     mmDollar[2].intern.Get(mmDollar[2].val),
+					Values: mmDollar[4].strs,
 				}
 			}
 		}
 	case 15:
-		mmDollar = mmS[mmpt-10 : mmpt+1]
-		//line grammar.y:177
+		mmDollar = mmS[mmpt-6 : mmpt+1]
+		//line grammar.y:186
+		{
+			{
+				mmVAL.dec = &EnumType{
+					Node:   astNodeAt(mmDollar[2].loc),
+					Id:     mmDollar[2].intern.Get(mmDollar[2].val),
+					Values: mmDollar[4].strs,
+				}
+			}
+		}
+	case 16:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:192
+		{
+			{
+				mmVAL.dec = &StructType{
+					Node:   astNodeAt(mmDollar[2].loc),
+					Id:     mmDollar[2].intern.Get(mmDollar[2].val),
+					Fields: mmDollar[4].sfields,
+				}
+			}
+		}
+	case 18:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:199
+		{
+			{
+				stage := mmDollar[5].dec.(*Stage)
+				// Comments preceding the annotation belong to the stage.
+				stage.Node = astNodeAt(mmDollar[1].loc)
+				stage.Deprecated = mmDollar[3].intern.unquote(mmDollar[3].val)
+				mmVAL.dec = stage
+			}
+		}
+	case 20:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+		//line grammar.y:211
+		{
+			{
+				mmVAL.strs = append(mmDollar[1].strs, mmDollar[3].intern.unquote(mmDollar[3].val))
+			}
+		}
+	case 21:
+		mmDollar = mmS[mmpt-1 : mmpt+1]
+		//line grammar.y:213
+		{
+			{
+				mmVAL.strs = []string{mmDollar[1].intern.unquote(mmDollar[1].val)}
+			}
+		}
+	case 22:
+		mmDollar = mmS[mmpt-0 : mmpt+1]
+		//line grammar.y:218
+		{
+			{
+				mmVAL.sfields = nil
+			}
+		}
+	case 23:
+		mmDollar = mmS[mmpt-2 : mmpt+1]
+		//line grammar.y:220
+		{
+			{
+				mmVAL.sfields = append(mmDollar[1].sfields, mmDollar[2].sfield)
+			}
+		}
+	case 24:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:225
+		{
+			{
+				mmVAL.sfield = &StructField{
+					Node:     astNodeAt(mmDollar[1].loc),
+					Tname:    mmDollar[1].intern.Get(mmDollar[1].val),
+					ArrayDim: mmDollar[2].arr,
+					Id:       mmDollar[3].intern.Get(mmDollar[3].val),
+					Help:     unquote(mmDollar[4].val),
+				}
+			}
+		}
+	case 25:
+		mmDollar = mmS[mmpt-4 : mmpt+1]
+		//line grammar.y:233
+		{
+			{
+				mmVAL.sfield = &StructField{
+					Node:     astNodeAt(mmDollar[1].loc),
+					Tname:    mmDollar[1].intern.Get(mmDollar[1].val),
+					ArrayDim: mmDollar[2].arr,
+					Id:       mmDollar[3].intern.Get(mmDollar[3].val),
+				}
+			}
+		}
+	case 26:
+		mmDollar = mmS[mmpt-12 : mmpt+1]
+		//line grammar.y:243
+		{
+			{
+				mmVAL.dec = &Pipeline{
+					Node:       astNodeAt(mmDollar[2].loc),
+					Id:         mmDollar[2].intern.Get(mmDollar[2].val),
+					TypeParams: mmDollar[3].tparams,
+					InParams:   mmDollar[5].i_params,
+					OutParams:  mmDollar[6].o_params,
+					Calls:      mmDollar[9].calls,
+					Callables:  &Callables{Table: make(map[string]Callable)},
+					Ret:        mmDollar[10].retstm,
+					Retain:     mmDollar[11].plretains,
+				}
+			}
+		}
+	case 27:
+		mmDollar = mmS[mmpt-0 : mmpt+1]
+		//line grammar.y:258
+		{
+			{
+				mmVAL.tparams = nil
+			}
+		}
+	case 28:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+		//line grammar.y:260
+		{
+			{
+				mmVAL.tparams = mmDollar[2].tparams
+			}
+		}
+	case 29:
+		mmDollar = mmS[mmpt-1 : mmpt+1]
+		//line grammar.y:265
+		{
+			{
+				mmVAL.tparams = []*TypeParam{
+					{
+						Node: astNodeAt(mmDollar[1].loc),
+						Id:   mmDollar[1].intern.Get(mmDollar[1].val),
+					},
+				}
+			}
+		}
+	case 30:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+		//line grammar.y:273
+		{
+			{
+				mmVAL.tparams = append(mmDollar[1].tparams, &TypeParam{
+					Node: astNodeAt(mmDollar[3].loc),
+					Id:   mmDollar[3].intern.Get(mmDollar[3].val),
+				})
+			}
+		}
+	case 31:
+		mmDollar = mmS[mmpt-11 : mmpt+1]
+		//line grammar.y:282
 		{
 			{
 				mmVAL.dec = &Stage{
-					Node:      NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile),
+					Node:      astNodeAt(mmDollar[2].loc),
 					Id:        mmDollar[2].intern.Get(mmDollar[2].val),
 					InParams:  mmDollar[4].i_params,
 					OutParams: mmDollar[5].o_params,
@@ -876,131 +1159,232 @@ mmdefault:
 					ChunkOuts: mmDollar[8].par_tuple.Outs,
 					Split:     mmDollar[8].par_tuple.Present,
 					Resources: mmDollar[9].res,
-					Retain:    mmDollar[10].stretains,
+					Env:       mmDollar[10].stenv,
+					Retain:    mmDollar[11].stretains,
+					idLoc:     mmDollar[2].loc,
 				}
 			}
 		}
-	case 16:
+	case 32:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:194
+		//line grammar.y:301
 		{
 			{
 				mmVAL.res = nil
 			}
 		}
-	case 17:
+	case 33:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:196
+		//line grammar.y:303
 		{
 			{
-				mmDollar[3].res.Node = NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile)
+				mmDollar[3].res.Node = astNodeAt(mmDollar[1].loc)
 				mmVAL.res = mmDollar[3].res
 			}
 		}
-	case 18:
+	case 34:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:204
+		//line grammar.y:311
 		{
 			{
 				mmVAL.res = new(Resources)
 			}
 		}
-	case 19:
+	case 35:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:206
+		//line grammar.y:313
 		{
 			{
-				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
+				n := astNodeAt(mmDollar[2].loc)
 				mmDollar[1].res.ThreadNode = &n
 				i := parseInt(mmDollar[4].val)
 				mmDollar[1].res.Threads = int16(i)
 				mmVAL.res = mmDollar[1].res
 			}
 		}
-	case 20:
+	case 36:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:214
+		//line grammar.y:321
 		{
 			{
-				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
+				n := astNodeAt(mmDollar[2].loc)
 				mmDollar[1].res.MemNode = &n
 				i := parseInt(mmDollar[4].val)
 				mmDollar[1].res.MemGB = int16(i)
 				mmVAL.res = mmDollar[1].res
 			}
 		}
-	case 21:
+	case 37:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:329
+		{
+			{
+				n := astNodeAt(mmDollar[2].loc)
+				mmDollar[1].res.GPUNode = &n
+				i := parseInt(mmDollar[4].val)
+				mmDollar[1].res.GPUs = int16(i)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 38:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:337
+		{
+			{
+				n := astNodeAt(mmDollar[2].loc)
+				mmDollar[1].res.TimeoutNode = &n
+				i := parseInt(mmDollar[4].val)
+				mmDollar[1].res.Timeout = int32(i)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 39:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:345
+		{
+			{
+				n := astNodeAt(mmDollar[2].loc)
+				mmDollar[1].res.RetriesNode = &n
+				i := parseInt(mmDollar[4].val)
+				mmDollar[1].res.Retries = int16(i)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 40:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:353
+		{
+			{
+				n := astNodeAt(mmDollar[2].loc)
+				mmDollar[1].res.DiskNode = &n
+				i := parseInt(mmDollar[4].val)
+				mmDollar[1].res.DiskGB = int32(i)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 41:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:222
+		//line grammar.y:361
 		{
 			{
-				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
+				n := astNodeAt(mmDollar[2].loc)
+				mmDollar[1].res.PriorityNode = &n
+				i := parseInt(mmDollar[4].val)
+				mmDollar[1].res.Priority = int16(i)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 42:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:369
+		{
+			{
+				n := astNodeAt(mmDollar[2].loc)
 				mmDollar[1].res.SpecialNode = &n
 				mmDollar[1].res.Special = mmDollar[4].intern.unquote(mmDollar[4].val)
 				mmVAL.res = mmDollar[1].res
 			}
 		}
-	case 22:
+	case 43:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:229
+		//line grammar.y:376
 		{
 			{
-				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
+				n := astNodeAt(mmDollar[2].loc)
 				mmDollar[1].res.VolatileNode = &n
 				mmDollar[1].res.StrictVolatile = true
 				mmVAL.res = mmDollar[1].res
 			}
 		}
-	case 23:
+	case 44:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:239
+		//line grammar.y:386
+		{
+			{
+				mmVAL.stenv = nil
+			}
+		}
+	case 45:
+		mmDollar = mmS[mmpt-4 : mmpt+1]
+		//line grammar.y:388
+		{
+			{
+				mmVAL.stenv = &StageEnv{
+					Node: astNodeAt(mmDollar[1].loc),
+					Vars: mmDollar[3].envvars,
+				}
+			}
+		}
+	case 46:
+		mmDollar = mmS[mmpt-0 : mmpt+1]
+		//line grammar.y:398
+		{
+			{
+				mmVAL.envvars = nil
+			}
+		}
+	case 47:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:400
+		{
+			{
+				mmVAL.envvars = append(mmDollar[1].envvars, &EnvVar{
+					Node:  astNodeAt(mmDollar[2].loc),
+					Key:   mmDollar[2].intern.Get(mmDollar[2].val),
+					Value: mmDollar[4].intern.unquote(mmDollar[4].val),
+				})
+			}
+		}
+	case 48:
+		mmDollar = mmS[mmpt-0 : mmpt+1]
+		//line grammar.y:411
 		{
 			{
 				mmVAL.stretains = nil
 			}
 		}
-	case 24:
+	case 49:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:241
+		//line grammar.y:413
 		{
 			{
 				mmVAL.stretains = &RetainParams{
-					Node:   NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:   astNodeAt(mmDollar[1].loc),
 					Params: mmDollar[3].retains,
 				}
 			}
 		}
-	case 25:
+	case 50:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:251
+		//line grammar.y:423
 		{
 			{
 				mmVAL.retains = nil
 			}
 		}
-	case 26:
+	case 51:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:253
+		//line grammar.y:425
 		{
 			{
 				mmVAL.retains = append(mmDollar[1].retains, &RetainParam{
-					Node: NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile),
+					Node: astNodeAt(mmDollar[2].loc),
 					Id:   mmDollar[2].intern.Get(mmDollar[2].val),
 				})
 			}
 		}
-	case 27:
+	case 52:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:264
+		//line grammar.y:436
 		{
 			{
 				idd := append(mmDollar[1].val, '.')
 				mmVAL.val = append(idd, mmDollar[3].val...)
 			}
 		}
-	case 28:
+	case 53:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:269
+		//line grammar.y:441
 		{
 			{
 				// set capacity == length so append doesn't overwrite
@@ -1008,46 +1392,46 @@ mmdefault:
 				mmVAL.val = mmDollar[1].val[:len(mmDollar[1].val):len(mmDollar[1].val)]
 			}
 		}
-	case 29:
+	case 54:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:278
+		//line grammar.y:450
 		{
 			{
 				mmVAL.arr = 0
 			}
 		}
-	case 30:
+	case 55:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:280
+		//line grammar.y:452
 		{
 			{
 				mmVAL.arr++
 			}
 		}
-	case 31:
+	case 56:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:285
+		//line grammar.y:457
 		{
 			{
 				mmVAL.i_params = &InParams{Table: make(map[string]*InParam)}
 			}
 		}
-	case 32:
+	case 57:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:287
+		//line grammar.y:459
 		{
 			{
 				mmDollar[1].i_params.List = append(mmDollar[1].i_params.List, mmDollar[2].inparam)
 				mmVAL.i_params = mmDollar[1].i_params
 			}
 		}
-	case 33:
+	case 58:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:295
+		//line grammar.y:467
 		{
 			{
 				mmVAL.inparam = &InParam{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
 					ArrayDim: mmDollar[3].arr,
 					Id:       mmDollar[4].intern.Get(mmDollar[4].val),
@@ -1055,56 +1439,85 @@ mmdefault:
 				}
 			}
 		}
-	case 34:
+	case 59:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:303
+		//line grammar.y:475
 		{
 			{
 				mmVAL.inparam = &InParam{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
 					ArrayDim: mmDollar[3].arr,
 					Id:       mmDollar[4].intern.Get(mmDollar[4].val),
 				}
 			}
 		}
-	case 35:
+	case 60:
+		mmDollar = mmS[mmpt-8 : mmpt+1]
+		//line grammar.y:482
+		{
+			{
+				mmVAL.inparam = &InParam{
+					Node:     astNodeAt(mmDollar[1].loc),
+					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
+					ArrayDim: mmDollar[3].arr,
+					Id:       mmDollar[4].intern.Get(mmDollar[4].val),
+					Default:  mmDollar[6].vexp,
+					Help:     unquote(mmDollar[7].val),
+				}
+			}
+		}
+	case 61:
+		mmDollar = mmS[mmpt-7 : mmpt+1]
+		//line grammar.y:491
+		{
+			{
+				mmVAL.inparam = &InParam{
+					Node:     astNodeAt(mmDollar[1].loc),
+					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
+					ArrayDim: mmDollar[3].arr,
+					Id:       mmDollar[4].intern.Get(mmDollar[4].val),
+					Default:  mmDollar[6].vexp,
+				}
+			}
+		}
+	case 62:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:313
+		//line grammar.y:502
 		{
 			{
 				mmVAL.o_params = &OutParams{Table: make(map[string]*OutParam)}
 			}
 		}
-	case 36:
+	case 63:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:315
+		//line grammar.y:504
 		{
 			{
 				mmDollar[1].o_params.List = append(mmDollar[1].o_params.List, mmDollar[2].outparam)
 				mmVAL.o_params = mmDollar[1].o_params
 			}
 		}
-	case 37:
+	case 64:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:323
+		//line grammar.y:512
 		{
 			{
 				mmVAL.outparam = &OutParam{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
 					ArrayDim: mmDollar[3].arr,
 					Id:       default_out_name,
 				}
 			}
 		}
-	case 38:
+	case 65:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:330
+		//line grammar.y:519
 		{
 			{
 				mmVAL.outparam = &OutParam{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
 					ArrayDim: mmDollar[3].arr,
 					Id:       default_out_name,
@@ -1112,13 +1525,13 @@ mmdefault:
 				}
 			}
 		}
-	case 39:
+	case 66:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:338
+		//line grammar.y:527
 		{
 			{
 				mmVAL.outparam = &OutParam{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
 					ArrayDim: mmDollar[3].arr,
 					Id:       default_out_name,
@@ -1127,26 +1540,26 @@ mmdefault:
 				}
 			}
 		}
-	case 40:
+	case 67:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:347
+		//line grammar.y:536
 		{
 			{
 				mmVAL.outparam = &OutParam{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
 					ArrayDim: mmDollar[3].arr,
 					Id:       mmDollar[4].intern.Get(mmDollar[4].val),
 				}
 			}
 		}
-	case 41:
+	case 68:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:354
+		//line grammar.y:543
 		{
 			{
 				mmVAL.outparam = &OutParam{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
 					ArrayDim: mmDollar[3].arr,
 					Id:       mmDollar[4].intern.Get(mmDollar[4].val),
@@ -1154,13 +1567,13 @@ mmdefault:
 				}
 			}
 		}
-	case 42:
+	case 69:
 		mmDollar = mmS[mmpt-7 : mmpt+1]
-		//line grammar.y:362
+		//line grammar.y:551
 		{
 			{
 				mmVAL.outparam = &OutParam{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Tname:    mmDollar[2].intern.Get(mmDollar[2].val),
 					ArrayDim: mmDollar[3].arr,
 					Id:       mmDollar[4].intern.Get(mmDollar[4].val),
@@ -1169,23 +1582,38 @@ mmdefault:
 				}
 			}
 		}
-	case 43:
+	case 70:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:374
+		//line grammar.y:563
 		{
 			{
 				stagecodeParts := strings.Split(mmDollar[3].intern.unquote(mmDollar[3].val), " ")
 				mmVAL.src = &SrcParam{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Lang: StageLanguage(mmDollar[2].intern.Get(mmDollar[2].val)),
 					Path: stagecodeParts[0],
 					Args: stagecodeParts[1:],
 				}
 			}
 		}
-	case 56:
+	case 71:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:571
+		{
+			{
+				stagecodeParts := strings.Split(mmDollar[4].intern.unquote(mmDollar[4].val), " ")
+				mmVAL.src = &SrcParam{
+					Node:  astNodeAt(mmDollar[1].loc),
+					Lang:  StageLanguage(mmDollar[2].intern.Get(mmDollar[2].val)),
+					Image: mmDollar[3].intern.unquote(mmDollar[3].val),
+					Path:  stagecodeParts[0],
+					Args:  stagecodeParts[1:],
+				}
+			}
+		}
+	case 86:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:409
+		//line grammar.y:612
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{
@@ -1195,9 +1623,9 @@ mmdefault:
 				}
 			}
 		}
-	case 57:
+	case 87:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:417
+		//line grammar.y:620
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{
@@ -1207,9 +1635,9 @@ mmdefault:
 				}
 			}
 		}
-	case 58:
+	case 88:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:423
+		//line grammar.y:626
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{
@@ -1219,248 +1647,284 @@ mmdefault:
 				}
 			}
 		}
-	case 59:
+	case 89:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:432
+		//line grammar.y:635
 		{
 			{
 				mmVAL.retstm = &ReturnStm{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Bindings: mmDollar[3].bindings,
 				}
 			}
 		}
-	case 60:
+	case 90:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:440
+		//line grammar.y:643
 		{
 			{
 				mmVAL.plretains = nil
 			}
 		}
-	case 61:
+	case 91:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:442
+		//line grammar.y:645
 		{
 			{
 				mmVAL.plretains = &PipelineRetains{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Refs: mmDollar[3].reflist,
 				}
 			}
 		}
-	case 62:
+	case 92:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:449
+		//line grammar.y:652
 		{
 			{
 				mmVAL.reflist = nil
 			}
 		}
-	case 63:
+	case 93:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:451
+		//line grammar.y:654
 		{
 			{
 				mmVAL.reflist = append(mmDollar[1].reflist, mmDollar[2].rexp)
 			}
 		}
-	case 64:
+	case 94:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:455
+		//line grammar.y:658
 		{
 			{
 				mmVAL.calls = append(mmDollar[1].calls, mmDollar[2].call)
 			}
 		}
-	case 65:
+	case 95:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:457
+		//line grammar.y:660
 		{
 			{
 				mmVAL.calls = []*CallStm{mmDollar[1].call}
 			}
 		}
-	case 66:
-		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:462
+	case 96:
+		mmDollar = mmS[mmpt-7 : mmpt+1]
+		//line grammar.y:665
 		{
 			{
 				id := mmDollar[3].intern.Get(mmDollar[3].val)
 				mmVAL.call = &CallStm{
-					Node:      NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:      astNodeAt(mmDollar[1].loc),
 					Modifiers: mmDollar[2].modifiers,
 					Id:        id,
-					DecId:     id,
-					Bindings:  mmDollar[5].bindings,
+					DecId:     genericInstanceId(id, mmDollar[4].strs),
+					TypeArgs:  mmDollar[4].strs,
+					Bindings:  mmDollar[6].bindings,
+					decLoc:    mmDollar[3].loc,
 				}
 			}
 		}
-	case 67:
-		mmDollar = mmS[mmpt-8 : mmpt+1]
-		//line grammar.y:471
+	case 97:
+		mmDollar = mmS[mmpt-9 : mmpt+1]
+		//line grammar.y:676
 		{
 			{
 				mmVAL.call = &CallStm{
-					Node:      NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:      astNodeAt(mmDollar[1].loc),
 					Modifiers: mmDollar[2].modifiers,
-					Id:        mmDollar[5].intern.Get(mmDollar[5].val),
-					DecId:     mmDollar[3].intern.Get(mmDollar[3].val),
-					Bindings:  mmDollar[7].bindings,
+					Id:        mmDollar[6].intern.Get(mmDollar[6].val),
+					DecId:     genericInstanceId(mmDollar[3].intern.Get(mmDollar[3].val), mmDollar[4].strs),
+					TypeArgs:  mmDollar[4].strs,
+					Bindings:  mmDollar[8].bindings,
+					decLoc:    mmDollar[3].loc,
 				}
 			}
 		}
-	case 68:
+	case 98:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:479
+		//line grammar.y:686
 		{
 			{
 				mmDollar[1].call.Modifiers.Bindings = mmDollar[4].bindings
 				mmVAL.call = mmDollar[1].call
 			}
 		}
-	case 69:
+	case 99:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:487
+		//line grammar.y:694
+		{
+			{
+				mmVAL.strs = nil
+			}
+		}
+	case 100:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+		//line grammar.y:696
+		{
+			{
+				mmVAL.strs = mmDollar[2].strs
+			}
+		}
+	case 101:
+		mmDollar = mmS[mmpt-1 : mmpt+1]
+		//line grammar.y:701
+		{
+			{
+				mmVAL.strs = []string{mmDollar[1].intern.Get(mmDollar[1].val)}
+			}
+		}
+	case 102:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+		//line grammar.y:703
+		{
+			{
+				mmVAL.strs = append(mmDollar[1].strs, mmDollar[3].intern.Get(mmDollar[3].val))
+			}
+		}
+	case 103:
+		mmDollar = mmS[mmpt-0 : mmpt+1]
+		//line grammar.y:708
 		{
 			{
 				mmVAL.modifiers = new(Modifiers)
 			}
 		}
-	case 70:
+	case 104:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:489
+		//line grammar.y:710
 		{
 			{
 				mmVAL.modifiers.Local = true
 			}
 		}
-	case 71:
+	case 105:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:491
+		//line grammar.y:712
 		{
 			{
 				mmVAL.modifiers.Preflight = true
 			}
 		}
-	case 72:
+	case 106:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:493
+		//line grammar.y:714
 		{
 			{
 				mmVAL.modifiers.Volatile = true
 			}
 		}
-	case 73:
+	case 107:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:498
+		//line grammar.y:719
 		{
 			{
 				mmVAL.bindings = &BindStms{
-					Node:  NewAstNode(mmDollar[0].loc, mmDollar[0].srcfile),
+					Node:  astNodeAt(mmDollar[0].loc),
 					Table: make(map[string]*BindStm),
 				}
 			}
 		}
-	case 74:
+	case 108:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:503
+		//line grammar.y:724
 		{
 			{
 				mmDollar[1].bindings.List = append(mmDollar[1].bindings.List, mmDollar[2].binding)
 				mmVAL.bindings = mmDollar[1].bindings
 			}
 		}
-	case 75:
+	case 109:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:511
+		//line grammar.y:732
 		{
 			{
 				mmVAL.binding = &BindStm{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Id:   local,
 					Exp:  mmDollar[3].vexp,
 				}
 			}
 		}
-	case 76:
+	case 110:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:517
+		//line grammar.y:738
 		{
 			{
 				mmVAL.binding = &BindStm{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Id:   preflight,
 					Exp:  mmDollar[3].vexp,
 				}
 			}
 		}
-	case 77:
+	case 111:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:523
+		//line grammar.y:744
 		{
 			{
 				mmVAL.binding = &BindStm{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Id:   volatile,
 					Exp:  mmDollar[3].vexp,
 				}
 			}
 		}
-	case 78:
+	case 112:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:529
+		//line grammar.y:750
 		{
 			{
 				mmVAL.binding = &BindStm{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Id:   disabled,
 					Exp:  mmDollar[3].rexp,
 				}
 			}
 		}
-	case 79:
+	case 113:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:537
+		//line grammar.y:758
 		{
 			{
 				mmVAL.bindings = &BindStms{
-					Node:  NewAstNode(mmDollar[0].loc, mmDollar[0].srcfile),
+					Node:  astNodeAt(mmDollar[0].loc),
 					Table: make(map[string]*BindStm),
 				}
 			}
 		}
-	case 80:
+	case 114:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:542
+		//line grammar.y:763
 		{
 			{
 				mmDollar[1].bindings.List = append(mmDollar[1].bindings.List, mmDollar[2].binding)
 				mmVAL.bindings = mmDollar[1].bindings
 			}
 		}
-	case 81:
+	case 115:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:550
+		//line grammar.y:771
 		{
 			{
 				mmVAL.binding = &BindStm{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Id:   mmDollar[1].intern.Get(mmDollar[1].val),
 					Exp:  mmDollar[3].exp,
 				}
 			}
 		}
-	case 82:
+	case 116:
 		mmDollar = mmS[mmpt-8 : mmpt+1]
-		//line grammar.y:556
+		//line grammar.y:777
 		{
 			{
 				mmVAL.binding = &BindStm{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Id:   mmDollar[1].intern.Get(mmDollar[1].val),
 					Exp: &ValExp{
-						Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+						Node:  astNodeAt(mmDollar[1].loc),
 						Kind:  KindArray,
 						Value: mmDollar[5].exps,
 					},
@@ -1468,16 +1932,16 @@ mmdefault:
 				}
 			}
 		}
-	case 83:
+	case 117:
 		mmDollar = mmS[mmpt-7 : mmpt+1]
-		//line grammar.y:567
+		//line grammar.y:788
 		{
 			{
 				mmVAL.binding = &BindStm{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Id:   mmDollar[1].intern.Get(mmDollar[1].val),
 					Exp: &ValExp{
-						Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+						Node:  astNodeAt(mmDollar[1].loc),
 						Kind:  KindArray,
 						Value: mmDollar[5].exps,
 					},
@@ -1485,233 +1949,233 @@ mmdefault:
 				}
 			}
 		}
-	case 84:
+	case 118:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:581
+		//line grammar.y:802
 		{
 			{
 				mmVAL.exps = append(mmDollar[1].exps, mmDollar[3].exp)
 			}
 		}
-	case 85:
+	case 119:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:583
+		//line grammar.y:804
 		{
 			{
 				mmVAL.exps = []Exp{mmDollar[1].exp}
 			}
 		}
-	case 86:
+	case 120:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:588
+		//line grammar.y:809
 		{
 			{
 				mmDollar[1].kvpairs[unquote(mmDollar[3].val)] = mmDollar[5].exp
 				mmVAL.kvpairs = mmDollar[1].kvpairs
 			}
 		}
-	case 87:
+	case 121:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:593
+		//line grammar.y:814
 		{
 			{
 				mmVAL.kvpairs = map[string]Exp{unquote(mmDollar[1].val): mmDollar[3].exp}
 			}
 		}
-	case 88:
+	case 122:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:598
+		//line grammar.y:819
 		{
 			{
 				mmVAL.exp = mmDollar[1].vexp
 			}
 		}
-	case 89:
+	case 123:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:600
+		//line grammar.y:821
 		{
 			{
 				mmVAL.exp = mmDollar[1].rexp
 			}
 		}
-	case 90:
+	case 124:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:604
+		//line grammar.y:825
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindArray,
 					Value: mmDollar[2].exps,
 				}
 			}
 		}
-	case 91:
+	case 125:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:610
+		//line grammar.y:831
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindArray,
 					Value: mmDollar[2].exps,
 				}
 			}
 		}
-	case 92:
+	case 126:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:616
+		//line grammar.y:837
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindArray,
 					Value: make([]Exp, 0),
 				}
 			}
 		}
-	case 93:
+	case 127:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:622
+		//line grammar.y:843
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindMap,
 					Value: make(map[string]interface{}, 0),
 				}
 			}
 		}
-	case 94:
+	case 128:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:628
+		//line grammar.y:849
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindMap,
 					Value: mmDollar[2].kvpairs,
 				}
 			}
 		}
-	case 95:
+	case 129:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:634
+		//line grammar.y:855
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindMap,
 					Value: mmDollar[2].kvpairs,
 				}
 			}
 		}
-	case 96:
+	case 130:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:640
+		//line grammar.y:861
 		{
 			{ // Lexer guarantees parseable float strings.
 				f := parseFloat(mmDollar[1].val)
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindFloat,
 					Value: f,
 				}
 			}
 		}
-	case 97:
+	case 131:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:649
+		//line grammar.y:870
 		{
 			{ // Lexer guarantees parseable int strings.
 				i := parseInt(mmDollar[1].val)
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindInt,
 					Value: i,
 				}
 			}
 		}
-	case 98:
+	case 132:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:658
+		//line grammar.y:879
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindString,
 					Value: unquote(mmDollar[1].val),
 				}
 			}
 		}
-	case 100:
+	case 134:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:665
+		//line grammar.y:886
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Kind: KindNull,
 				}
 			}
 		}
-	case 101:
+	case 135:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:673
+		//line grammar.y:894
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindBool,
 					Value: true,
 				}
 			}
 		}
-	case 102:
+	case 136:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:679
+		//line grammar.y:900
 		{
 			{
 				mmVAL.vexp = &ValExp{
-					Node:  NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:  astNodeAt(mmDollar[1].loc),
 					Kind:  KindBool,
 					Value: false,
 				}
 			}
 		}
-	case 103:
+	case 137:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:687
+		//line grammar.y:908
 		{
 			{
 				mmVAL.rexp = &RefExp{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Kind:     KindCall,
 					Id:       mmDollar[1].intern.Get(mmDollar[1].val),
 					OutputId: mmDollar[3].intern.Get(mmDollar[3].val),
 				}
 			}
 		}
-	case 104:
+	case 138:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:694
+		//line grammar.y:915
 		{
 			{
 				mmVAL.rexp = &RefExp{
-					Node:     NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node:     astNodeAt(mmDollar[1].loc),
 					Kind:     KindCall,
 					Id:       mmDollar[1].intern.Get(mmDollar[1].val),
 					OutputId: default_out_name,
 				}
 			}
 		}
-	case 105:
+	case 139:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:701
+		//line grammar.y:922
 		{
 			{
 				mmVAL.rexp = &RefExp{
-					Node: NewAstNode(mmDollar[1].loc, mmDollar[1].srcfile),
+					Node: astNodeAt(mmDollar[1].loc),
 					Kind: KindSelf,
 					Id:   mmDollar[3].intern.Get(mmDollar[3].val),
 				}
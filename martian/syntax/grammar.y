@@ -17,15 +17,21 @@ import (
     global    *Ast
     srcfile   *SourceFile
     arr       int16
-    loc       int
+    loc       SourceLoc
     val       []byte
     modifiers *Modifiers
     dec       Dec
     decs      []Dec
     inparam   *InParam
     outparam  *OutParam
+    sfield    *StructField
+    sfields   []*StructField
+    strs      []string
+    tparams   []*TypeParam
     retains   []*RetainParam
     stretains *RetainParams
+    envvars   []*EnvVar
+    stenv     *StageEnv
     i_params  *InParams
     o_params  *OutParams
     res       *Resources
@@ -48,15 +54,21 @@ import (
 }
 
 %type <includes>  includes
-%type <val>       id id_list type help type src_lang type outname
+%type <val>       id id_list type help type src_lang container_lang type outname
 %type <modifiers> modifiers
 %type <arr>       arr_list
 %type <dec>       dec stage pipeline
 %type <decs>      dec_list
 %type <inparam>   in_param
 %type <outparam>  out_param
+%type <sfield>    struct_field
+%type <sfields>   struct_field_list
+%type <strs>      enum_value_list type_args type_arg_list
+%type <tparams>   type_params type_param_list
 %type <retains>   stage_retain_list
 %type <stretains> stage_retain
+%type <envvars>   stage_env_list
+%type <stenv>     stage_env
 %type <reflist>   pipeline_retain_list
 %type <plretains> pipeline_retain
 %type <i_params>  in_param_list
@@ -77,16 +89,16 @@ import (
 
 %token SKIP COMMENT INVALID
 %token SEMICOLON COLON COMMA EQUALS
-%token LBRACKET RBRACKET LPAREN RPAREN LBRACE RBRACE
+%token LBRACKET RBRACKET LPAREN RPAREN LBRACE RBRACE LANGLE RANGLE
 %token SWEEP RETURN SELF
-%token <val> FILETYPE STAGE PIPELINE CALL SPLIT USING RETAIN
+%token <val> FILETYPE ENUM STRUCT STAGE PIPELINE CALL SPLIT USING RETAIN ENV
 %token <val> LOCAL PREFLIGHT VOLATILE DISABLED STRICT
 %token IN OUT SRC AS
-%token <val> THREADS MEM_GB SPECIAL
+%token <val> THREADS MEM_GB SPECIAL GPUS TIMEOUT RETRIES DISK_SPACE_GB PRIORITY
 %token <val> ID LITSTRING NUM_FLOAT NUM_INT DOT
-%token <val> PY EXEC COMPILED
+%token <val> PY EXEC COMPILED DOCKER PODMAN
 %token <val> MAP INT STRING FLOAT PATH BOOL TRUE FALSE NULL DEFAULT
-%token INCLUDE_DIRECTIVE
+%token INCLUDE_DIRECTIVE DEPRECATED
 
 %%
 file
@@ -128,14 +140,14 @@ file
 includes
     : includes INCLUDE_DIRECTIVE LITSTRING
         {{ $$ = append($1, &Include{
-            Node: NewAstNode($<loc>2, $<srcfile>2),
+            Node: astNodeAt($<loc>2),
             Value: $<intern>3.unquote($3),
            })
         }}
     | INCLUDE_DIRECTIVE LITSTRING
         {{ $$ = []*Include{
               &Include{
-                  Node: NewAstNode($<loc>1, $<srcfile>1),
+                  Node: astNodeAt($<loc>1),
                   Value: $<intern>2.unquote($2),
               },
            }
@@ -146,36 +158,129 @@ dec_list
         {{ $$ = append($1, $2) }}
     | dec
         {{ $$ = []Dec{$1} }}
+    | dec_list error
+        {{
+            $<srcfile>$ = mmlex.(*mmLexInfo).srcfile
+            $$ = $1
+        }}
+    | error
+        {{
+            $<srcfile>$ = mmlex.(*mmLexInfo).srcfile
+            $$ = nil
+        }}
     ;
 
 dec
     : FILETYPE id_list SEMICOLON
         {{ $$ = &UserType{
-            Node: NewAstNode($<loc>2, $<srcfile>2),
+            Node: astNodeAt($<loc>2),
+            Id: $<intern>2.Get($2),
+        } }}
+    | ENUM id LPAREN enum_value_list RPAREN
+        {{ $$ = &EnumType{
+            Node: astNodeAt($<loc>2),
             Id: $<intern>2.Get($2),
+            Values: $4,
+        } }}
+    | ENUM id LPAREN enum_value_list COMMA RPAREN
+        {{ $$ = &EnumType{
+            Node: astNodeAt($<loc>2),
+            Id: $<intern>2.Get($2),
+            Values: $4,
+        } }}
+    | STRUCT id LPAREN struct_field_list RPAREN
+        {{ $$ = &StructType{
+            Node: astNodeAt($<loc>2),
+            Id: $<intern>2.Get($2),
+            Fields: $4,
         } }}
     | stage
+    | DEPRECATED LPAREN LITSTRING RPAREN stage
+        {{
+            stage := $5.(*Stage)
+            // Comments preceding the annotation belong to the stage.
+            stage.Node = astNodeAt($<loc>1)
+            stage.Deprecated = $<intern>3.unquote($3)
+            $$ = stage
+        }}
     | pipeline
     ;
 
+enum_value_list
+    : enum_value_list COMMA LITSTRING
+        {{ $$ = append($1, $<intern>3.unquote($3)) }}
+    | LITSTRING
+        {{ $$ = []string{$<intern>1.unquote($1)} }}
+    ;
+
+struct_field_list
+    :
+        {{ $$ = nil }}
+    | struct_field_list struct_field
+        {{ $$ = append($1, $2) }}
+    ;
+
+struct_field
+    : type arr_list id help COMMA
+        {{ $$ = &StructField{
+            Node: astNodeAt($<loc>1),
+            Tname: $<intern>1.Get($1),
+            ArrayDim: $2,
+            Id: $<intern>3.Get($3),
+            Help: unquote($4),
+        } }}
+    | type arr_list id COMMA
+        {{ $$ = &StructField{
+            Node: astNodeAt($<loc>1),
+            Tname: $<intern>1.Get($1),
+            ArrayDim: $2,
+            Id: $<intern>3.Get($3),
+        } }}
+    ;
+
 pipeline
-    : PIPELINE id LPAREN in_param_list out_param_list RPAREN LBRACE call_stm_list return_stm pipeline_retain RBRACE
+    : PIPELINE id type_params LPAREN in_param_list out_param_list RPAREN LBRACE call_stm_list return_stm pipeline_retain RBRACE
         {{ $$ = &Pipeline{
-            Node: NewAstNode($<loc>2, $<srcfile>2),
+            Node: astNodeAt($<loc>2),
             Id: $<intern>2.Get($2),
-            InParams: $4,
-            OutParams: $5,
-            Calls: $8,
+            TypeParams: $3,
+            InParams: $5,
+            OutParams: $6,
+            Calls: $9,
             Callables: &Callables{Table: make(map[string]Callable)},
-            Ret: $9,
-            Retain: $10,
+            Ret: $10,
+            Retain: $11,
         } }}
     ;
 
+type_params
+    :
+        {{ $$ = nil }}
+    | LANGLE type_param_list RANGLE
+        {{ $$ = $2 }}
+    ;
+
+type_param_list
+    : id
+        {{ $$ = []*TypeParam{
+              &TypeParam{
+                  Node: astNodeAt($<loc>1),
+                  Id: $<intern>1.Get($1),
+              },
+           }
+        }}
+    | type_param_list COMMA id
+        {{ $$ = append($1, &TypeParam{
+            Node: astNodeAt($<loc>3),
+            Id: $<intern>3.Get($3),
+           })
+        }}
+    ;
+
 stage
-    : STAGE id LPAREN in_param_list out_param_list src_stm RPAREN split_param_list resources stage_retain
+    : STAGE id LPAREN in_param_list out_param_list src_stm RPAREN split_param_list resources stage_env stage_retain
         {{ $$ = &Stage{
-                Node: NewAstNode($<loc>2, $<srcfile>2),
+                Node: astNodeAt($<loc>2),
                 Id: $<intern>2.Get($2),
                 InParams: $4,
                 OutParams: $5,
@@ -184,7 +289,9 @@ stage
                 ChunkOuts: $8.Outs,
                 Split: $8.Present,
                 Resources: $9,
-                Retain: $10,
+                Env: $10,
+                Retain: $11,
+                idLoc: $<loc>2,
            }
         }}
    ;
@@ -194,7 +301,7 @@ resources
         {{ $$ = nil }}
     | USING LPAREN resource_list RPAREN
         {{
-             $3.Node = NewAstNode($<loc>1, $<srcfile>1)
+             $3.Node = astNodeAt($<loc>1)
              $$ = $3
          }}
     ;
@@ -204,7 +311,7 @@ resource_list
         {{ $$ = new(Resources) }}
     | resource_list THREADS EQUALS NUM_INT COMMA
         {{
-            n := NewAstNode($<loc>2, $<srcfile>2)
+            n := astNodeAt($<loc>2)
             $1.ThreadNode = &n
             i := parseInt($4)
             $1.Threads = int16(i)
@@ -212,35 +319,100 @@ resource_list
         }}
     | resource_list MEM_GB EQUALS NUM_INT COMMA
         {{
-            n := NewAstNode($<loc>2, $<srcfile>2)
+            n := astNodeAt($<loc>2)
             $1.MemNode = &n
             i := parseInt($4)
             $1.MemGB = int16(i)
             $$ = $1
         }}
+    | resource_list GPUS EQUALS NUM_INT COMMA
+        {{
+            n := astNodeAt($<loc>2)
+            $1.GPUNode = &n
+            i := parseInt($4)
+            $1.GPUs = int16(i)
+            $$ = $1
+        }}
+    | resource_list TIMEOUT EQUALS NUM_INT COMMA
+        {{
+            n := astNodeAt($<loc>2)
+            $1.TimeoutNode = &n
+            i := parseInt($4)
+            $1.Timeout = int32(i)
+            $$ = $1
+        }}
+    | resource_list RETRIES EQUALS NUM_INT COMMA
+        {{
+            n := astNodeAt($<loc>2)
+            $1.RetriesNode = &n
+            i := parseInt($4)
+            $1.Retries = int16(i)
+            $$ = $1
+        }}
+    | resource_list DISK_SPACE_GB EQUALS NUM_INT COMMA
+        {{
+            n := astNodeAt($<loc>2)
+            $1.DiskNode = &n
+            i := parseInt($4)
+            $1.DiskGB = int32(i)
+            $$ = $1
+        }}
+    | resource_list PRIORITY EQUALS NUM_INT COMMA
+        {{
+            n := astNodeAt($<loc>2)
+            $1.PriorityNode = &n
+            i := parseInt($4)
+            $1.Priority = int16(i)
+            $$ = $1
+        }}
     | resource_list SPECIAL EQUALS LITSTRING COMMA
         {{
-            n := NewAstNode($<loc>2, $<srcfile>2)
+            n := astNodeAt($<loc>2)
             $1.SpecialNode = &n
             $1.Special = $<intern>4.unquote($4)
             $$ = $1
         }}
     | resource_list VOLATILE EQUALS STRICT COMMA
         {{
-            n := NewAstNode($<loc>2, $<srcfile>2)
+            n := astNodeAt($<loc>2)
             $1.VolatileNode = &n
             $1.StrictVolatile = true
             $$ = $1
         }}
     ;
 
+stage_env
+    :
+        {{ $$ = nil }}
+    | ENV LPAREN stage_env_list RPAREN
+        {{
+             $$ = &StageEnv{
+                Node: astNodeAt($<loc>1),
+                Vars: $3,
+             }
+         }}
+    ;
+
+stage_env_list
+    :
+        {{ $$ = nil }}
+    | stage_env_list id EQUALS LITSTRING COMMA
+        {{
+            $$ = append($1, &EnvVar{
+                Node: astNodeAt($<loc>2),
+                Key: $<intern>2.Get($2),
+                Value: $<intern>4.unquote($4),
+            })
+        }}
+    ;
+
 stage_retain
     :
         {{ $$ = nil }}
     | RETAIN LPAREN stage_retain_list RPAREN
         {{
              $$ = &RetainParams{
-                Node: NewAstNode($<loc>1, $<srcfile>1),
+                Node: astNodeAt($<loc>1),
                 Params: $3,
              }
          }}
@@ -252,7 +424,7 @@ stage_retain_list
     | stage_retain_list id COMMA
         {{
             $$ = append($1, &RetainParam{
-                Node: NewAstNode($<loc>2, $<srcfile>2),
+                Node: astNodeAt($<loc>2),
                 Id: $<intern>2.Get($2),
             })
         }}
@@ -293,7 +465,7 @@ in_param_list
 in_param
     : IN type arr_list id help COMMA
         {{ $$ = &InParam{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Tname: $<intern>2.Get($2),
             ArrayDim: $3,
             Id: $<intern>4.Get($4),
@@ -301,10 +473,27 @@ in_param
         } }}
     | IN type arr_list id COMMA
         {{ $$ = &InParam{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
+            Tname: $<intern>2.Get($2),
+            ArrayDim: $3,
+            Id: $<intern>4.Get($4),
+        } }}
+    | IN type arr_list id EQUALS val_exp help COMMA
+        {{ $$ = &InParam{
+            Node: astNodeAt($<loc>1),
             Tname: $<intern>2.Get($2),
             ArrayDim: $3,
             Id: $<intern>4.Get($4),
+            Default: $6,
+            Help: unquote($7),
+        } }}
+    | IN type arr_list id EQUALS val_exp COMMA
+        {{ $$ = &InParam{
+            Node: astNodeAt($<loc>1),
+            Tname: $<intern>2.Get($2),
+            ArrayDim: $3,
+            Id: $<intern>4.Get($4),
+            Default: $6,
         } }}
     ;
 
@@ -321,14 +510,14 @@ out_param_list
 out_param
     : OUT type arr_list COMMA
         {{ $$ = &OutParam{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Tname: $<intern>2.Get($2),
             ArrayDim: $3,
             Id: default_out_name,
         } }}
     | OUT type arr_list help COMMA
         {{ $$ = &OutParam{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Tname: $<intern>2.Get($2),
             ArrayDim: $3,
             Id: default_out_name,
@@ -336,7 +525,7 @@ out_param
         } }}
     | OUT type arr_list help outname COMMA
         {{ $$ = &OutParam{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Tname: $<intern>2.Get($2),
             ArrayDim: $3,
             Id: default_out_name,
@@ -345,14 +534,14 @@ out_param
         } }}
     | OUT type arr_list id COMMA
         {{ $$ = &OutParam{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Tname: $<intern>2.Get($2),
             ArrayDim: $3,
             Id: $<intern>4.Get($4),
         } }}
     | OUT type arr_list id help COMMA
         {{ $$ = &OutParam{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Tname: $<intern>2.Get($2),
             ArrayDim: $3,
             Id: $<intern>4.Get($4),
@@ -360,7 +549,7 @@ out_param
         } }}
     | OUT type arr_list id help outname COMMA
         {{ $$ = &OutParam{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Tname: $<intern>2.Get($2),
             ArrayDim: $3,
             Id: $<intern>4.Get($4),
@@ -373,8 +562,17 @@ src_stm
     : SRC src_lang LITSTRING COMMA
         {{ stagecodeParts := strings.Split($<intern>3.unquote($3), " ")
            $$ = &SrcParam{
-               Node: NewAstNode($<loc>1, $<srcfile>1),
+               Node: astNodeAt($<loc>1),
+               Lang: StageLanguage($<intern>2.Get($2)),
+               Path: stagecodeParts[0],
+               Args: stagecodeParts[1:],
+           } }}
+    | SRC container_lang LITSTRING LITSTRING COMMA
+        {{ stagecodeParts := strings.Split($<intern>4.unquote($4), " ")
+           $$ = &SrcParam{
+               Node: astNodeAt($<loc>1),
                Lang: StageLanguage($<intern>2.Get($2)),
+               Image: $<intern>3.unquote($3),
                Path: stagecodeParts[0],
                Args: stagecodeParts[1:],
            } }}
@@ -404,6 +602,11 @@ src_lang
     | COMPILED
     ;
 
+container_lang
+    : DOCKER
+    | PODMAN
+    ;
+
 split_param_list
     :
         {{
@@ -430,7 +633,7 @@ split_param_list
 return_stm
     : RETURN LPAREN bind_stm_list RPAREN
         {{ $$ = &ReturnStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Bindings: $3,
         } }}
     ;
@@ -440,7 +643,7 @@ pipeline_retain
         {{ $$ = nil }}
     | RETAIN LPAREN pipeline_retain_list RPAREN
         {{ $$ = &PipelineRetains{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Refs: $3,
         } }}
 
@@ -458,22 +661,26 @@ call_stm_list
     ;
 
 call_stm
-    : CALL modifiers id LPAREN bind_stm_list RPAREN
+    : CALL modifiers id type_args LPAREN bind_stm_list RPAREN
         {{  id := $<intern>3.Get($3)
             $$ = &CallStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Modifiers: $2,
             Id: id,
-            DecId: id,
-            Bindings: $5,
+            DecId: genericInstanceId(id, $4),
+            TypeArgs: $4,
+            Bindings: $6,
+            decLoc: $<loc>3,
         } }}
-    | CALL modifiers id AS id LPAREN bind_stm_list RPAREN
+    | CALL modifiers id type_args AS id LPAREN bind_stm_list RPAREN
         {{ $$ = &CallStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Modifiers: $2,
-            Id: $<intern>5.Get($5),
-            DecId: $<intern>3.Get($3),
-            Bindings: $7,
+            Id: $<intern>6.Get($6),
+            DecId: genericInstanceId($<intern>3.Get($3), $4),
+            TypeArgs: $4,
+            Bindings: $8,
+            decLoc: $<loc>3,
         } }}
     | call_stm USING LPAREN modifier_stm_list RPAREN
         {{
@@ -482,6 +689,20 @@ call_stm
         }}
     ;
 
+type_args
+    :
+        {{ $$ = nil }}
+    | LANGLE type_arg_list RANGLE
+        {{ $$ = $2 }}
+    ;
+
+type_arg_list
+    : type
+        {{ $$ = []string{$<intern>1.Get($1)} }}
+    | type_arg_list COMMA type
+        {{ $$ = append($1, $<intern>3.Get($3)) }}
+    ;
+
 modifiers
     :
       {{ $$ = new(Modifiers) }}
@@ -496,7 +717,7 @@ modifiers
 modifier_stm_list
     :
         {{ $$ = &BindStms{
-            Node: NewAstNode($<loc>0, $<srcfile>0),
+            Node: astNodeAt($<loc>0),
             Table: make(map[string]*BindStm),
         } }}
     | modifier_stm_list modifier_stm
@@ -509,25 +730,25 @@ modifier_stm_list
 modifier_stm
     : LOCAL EQUALS bool_exp COMMA
         {{ $$ = &BindStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Id: local,
             Exp: $3,
         } }}
     | PREFLIGHT EQUALS bool_exp COMMA
         {{ $$ = &BindStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Id: preflight,
             Exp: $3,
         } }}
     | VOLATILE EQUALS bool_exp COMMA
         {{ $$ = &BindStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Id: volatile,
             Exp: $3,
         } }}
     | DISABLED EQUALS ref_exp COMMA
         {{ $$ = &BindStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Id: disabled,
             Exp: $3,
         } }}
@@ -535,7 +756,7 @@ modifier_stm
 bind_stm_list
     :
         {{ $$ = &BindStms{
-            Node: NewAstNode($<loc>0, $<srcfile>0),
+            Node: astNodeAt($<loc>0),
             Table: make(map[string]*BindStm),
         } }}
     | bind_stm_list bind_stm
@@ -548,16 +769,16 @@ bind_stm_list
 bind_stm
     : id EQUALS exp COMMA
         {{ $$ = &BindStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Id: $<intern>1.Get($1),
             Exp: $3,
         } }}
     | id EQUALS SWEEP LPAREN exp_list COMMA RPAREN COMMA
         {{ $$ = &BindStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Id: $<intern>1.Get($1),
             Exp: &ValExp{
-                Node: NewAstNode($<loc>1, $<srcfile>1),
+                Node: astNodeAt($<loc>1),
                 Kind: KindArray,
                 Value: $5,
             },
@@ -565,10 +786,10 @@ bind_stm
         } }}
     | id EQUALS SWEEP LPAREN exp_list RPAREN COMMA
         {{ $$ = &BindStm{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Id: $<intern>1.Get($1),
             Exp: &ValExp{
-                Node: NewAstNode($<loc>1, $<srcfile>1),
+                Node: astNodeAt($<loc>1),
                 Kind: KindArray,
                 Value: $5,
             },
@@ -602,37 +823,37 @@ exp
 val_exp
     : LBRACKET exp_list RBRACKET
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindArray,
             Value: $2,
         } }}
     | LBRACKET exp_list COMMA RBRACKET
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindArray,
             Value: $2,
         } }}
     | LBRACKET RBRACKET
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindArray,
             Value: make([]Exp, 0),
         } }}
     | LBRACE RBRACE
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindMap,
             Value: make(map[string]interface{}, 0),
         } }}
     | LBRACE kvpair_list RBRACE
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindMap,
             Value: $2,
         } }}
     | LBRACE kvpair_list COMMA RBRACE
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindMap,
             Value: $2,
         } }}
@@ -640,7 +861,7 @@ val_exp
         {{  // Lexer guarantees parseable float strings.
             f := parseFloat($1)
             $$ = &ValExp{
-                Node: NewAstNode($<loc>1, $<srcfile>1),
+                Node: astNodeAt($<loc>1),
                 Kind: KindFloat,
                 Value: f,
             }
@@ -649,21 +870,21 @@ val_exp
         {{  // Lexer guarantees parseable int strings.
             i := parseInt($1)
             $$ = &ValExp{
-                Node: NewAstNode($<loc>1, $<srcfile>1),
+                Node: astNodeAt($<loc>1),
                 Kind: KindInt,
                 Value: i,
             }
         }}
     | LITSTRING
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindString,
             Value: unquote($1),
         } }}
     | bool_exp
     | NULL
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindNull,
         } }}
     ;
@@ -671,13 +892,13 @@ val_exp
 bool_exp
     : TRUE
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindBool,
             Value: true,
         } }}
     | FALSE
         {{ $$ = &ValExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindBool,
             Value: false,
         } }}
@@ -685,21 +906,21 @@ bool_exp
 ref_exp
     : id DOT id
         {{ $$ = &RefExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindCall,
             Id: $<intern>1.Get($1),
             OutputId: $<intern>3.Get($3),
         } }}
     | id
         {{ $$ = &RefExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindCall,
             Id: $<intern>1.Get($1),
             OutputId: default_out_name,
         } }}
     | SELF DOT id
         {{ $$ = &RefExp{
-            Node: NewAstNode($<loc>1, $<srcfile>1),
+            Node: astNodeAt($<loc>1),
             Kind: KindSelf,
             Id: $<intern>3.Get($3),
         } }}
@@ -709,16 +930,26 @@ id
     : ID
     | COMPILED
     | DISABLED
+    | DISK_SPACE_GB
+    | DOCKER
+    | ENUM
+    | ENV
     | EXEC
     | FILETYPE
+    | GPUS
     | LOCAL
     | MEM_GB
+    | PODMAN
     | PREFLIGHT
+    | PRIORITY
     | RETAIN
+    | RETRIES
     | SPECIAL
     | SPLIT
     | STRICT
+    | STRUCT
     | THREADS
+    | TIMEOUT
     | USING
     | VOLATILE
     ;
@@ -2,6 +2,7 @@ package syntax
 
 import (
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -170,3 +171,183 @@ call MY_PIPELINE(
 		}
 	}
 }
+
+// Tests that included files are parsed only once when a Parser is reused, and
+// that compiling again with the cached includes gives the same result.
+func TestIncludeCache(t *testing.T) {
+	t.Parallel()
+	var parser Parser
+	fname := path.Join("testdata", "call.mro")
+	src1, ifnames1, _, err := parser.Compile(fname, []string{"testdata"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parser.includedASTs) != 2 {
+		t.Errorf("Expected 2 cached includes, found %d", len(parser.includedASTs))
+	}
+	cached := make(map[string]*Ast, len(parser.includedASTs))
+	for k, v := range parser.includedASTs {
+		cached[k] = v.ast
+	}
+	src2, ifnames2, _, err := parser.Compile(fname, []string{"testdata"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range parser.includedASTs {
+		if cached[k] != v.ast {
+			t.Errorf("Expected %s to be reused from the cache.", k)
+		}
+	}
+	if src1 != src2 {
+		t.Errorf("Combined source changed on recompile.  Got \n%s", src2)
+	}
+	if len(ifnames1) != len(ifnames2) {
+		t.Errorf("Expected %d included files, found %d",
+			len(ifnames1), len(ifnames2))
+	}
+	// pipeline.mro was previously included, so make sure it can be
+	// compiled at top level, and that the included file names are
+	// still correct afterwards.
+	if _, ifnames, _, err := parser.Compile(path.Join("testdata", "pipeline.mro"),
+		[]string{"testdata"}, false); err != nil {
+		t.Error(err)
+	} else if len(ifnames) != 1 || ifnames[0] != "stages.mro" {
+		t.Errorf("Expected stages.mro to be included, got %v", ifnames)
+	}
+}
+
+// Tests that FormatBytes fixes includes when given an MRO path.
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+	src := []byte(`# This file contains the top-level call.
+
+@include "stages.mro"
+
+call MY_PIPELINE(
+    info = 2,
+)
+`)
+	if fsrc, err := FormatBytes(src, path.Join("testdata", "call.mro"),
+		[]string{"testdata"}); err != nil {
+		t.Error(err)
+	} else if fsrc != `# This file contains the top-level call.
+
+@include "pipeline.mro"
+
+call MY_PIPELINE(
+    info = 2,
+)
+` {
+		t.Errorf("Incorrect formatted source.  Got \n%s", fsrc)
+	}
+	if fsrc, err := FormatBytes(src, path.Join("testdata", "call.mro"),
+		nil); err != nil {
+		t.Error(err)
+	} else if fsrc != string(src) {
+		t.Errorf("Expected includes to be unchanged.  Got \n%s", fsrc)
+	}
+}
+
+// Tests that wildcard includes are expanded in alphabetical order, without
+// duplicating files which are also included explicitly.
+func TestWildcardInclude(t *testing.T) {
+	t.Parallel()
+	if _, ifnames, ast, err := Compile(path.Join("testdata", "wildcard.mro"),
+		[]string{"testdata"}, false); err != nil {
+		t.Error(err)
+	} else {
+		if len(ifnames) != 2 {
+			t.Errorf("Expected 2 includes, found %d\n%v", len(ifnames), ifnames)
+		}
+		if len(ast.Stages) != 2 {
+			t.Fatalf("Expected 2 stages, found %d", len(ast.Stages))
+		}
+		if ast.Stages[0].Id != "STAGE_A" || ast.Stages[1].Id != "STAGE_B" {
+			t.Errorf("Expected STAGE_A then STAGE_B, got %s then %s",
+				ast.Stages[0].Id, ast.Stages[1].Id)
+		}
+		if f := ast.Stages[0].Node.Loc.File.FileName; f != "wildcard/stage_a.mro" {
+			t.Errorf("Incorrect include file name %s", f)
+		}
+	}
+	if _, _, _, err := ParseSource(`@include "nothing/*.mro"
+
+stage NOTHING(
+    in  int value,
+    src py  "nothing.py",
+)
+`, "nothing.mro", []string{"testdata"}, false); err == nil {
+		t.Error("Expected an error for a wildcard with no matches.")
+	} else if _, ok := err.(*FileNotFoundError); !ok {
+		t.Errorf("Expected file not found error, got %v", err)
+	}
+}
+
+// Tests that includes which declare nothing used by the including file
+// are detected, and that includes used only transitively are not.
+func TestUnusedInclude(t *testing.T) {
+	t.Parallel()
+	fname := path.Join("testdata", "unused_include.mro")
+	// Tests run with strict enforcement, so unused includes are an error.
+	if _, _, _, err := Compile(fname, []string{"testdata"}, false); err == nil {
+		t.Error("Expected an error for the unused include.")
+	} else if msg := err.Error(); !strings.Contains(msg,
+		"UnusedIncludeError: nothing declared in 'wildcard/stage_a.mro' is used") {
+		t.Errorf("Incorrect error %s", msg)
+	} else if strings.Contains(msg, "pipeline.mro") {
+		t.Errorf("pipeline.mro should be used: %s", msg)
+	}
+	if src, err := FormatSrcBytesOptions([]byte(`# Header comment.
+
+@include "wildcard/stage_a.mro"
+@include "pipeline.mro"
+
+call MY_PIPELINE(
+    info = 1,
+)
+`), fname, false, []string{"testdata"},
+		&FormatOptions{PruneIncludes: true}); err != nil {
+		t.Error(err)
+	} else if src != `# Header comment.
+
+@include "pipeline.mro"
+
+call MY_PIPELINE(
+    info = 1,
+)
+` {
+		t.Errorf("Incorrect pruned source.  Got \n%s", src)
+	}
+}
+
+// Tests that compiling several files with one parser parses shared
+// includes once, and reports errors for all files.
+func TestCompileAll(t *testing.T) {
+	t.Parallel()
+	var parser Parser
+	asts, err := parser.CompileAll([]string{
+		path.Join("testdata", "include_diamond_2.mro"),
+		path.Join("testdata", "self_include.mro"),
+		path.Join("testdata", "include_diamond_3.mro"),
+	}, []string{"testdata"}, false)
+	if err == nil {
+		t.Error("Expected an error for self_include.mro.")
+	} else if !strings.Contains(err.Error(), "self_include.mro") {
+		t.Errorf("Expected the error to mention self_include.mro, got %v", err)
+	}
+	if len(asts) != 3 {
+		t.Fatalf("Expected 3 asts, got %d", len(asts))
+	}
+	if asts[0] == nil || asts[2] == nil {
+		t.Fatal("Expected the diamond includes to compile.")
+	}
+	if asts[1] != nil {
+		t.Error("Expected no ast for self_include.mro.")
+	}
+	// Both files include include_diamond_4.mro, so they should share the
+	// stage parsed from it.
+	if s1, s2 := asts[0].Callables.Table["STAGE"],
+		asts[2].Callables.Table["STAGE"]; s1 == nil || s1 != s2 {
+		t.Error("Expected the shared include to be parsed only once.")
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Conversion between top-level call statements and JSON arguments, for
+// launching pipelines programmatically.
+
+package syntax
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The structured form of a top-level call statement.
+type Invocation struct {
+	Call      string                 `json:"call"`
+	Args      map[string]interface{} `json:"args"`
+	SweepArgs []string               `json:"sweepargs,omitempty"`
+}
+
+// InvocationFromJSON returns the source for a top-level call to the given
+// callable, with the given arguments, for example as decoded from JSON.
+//
+// Each argument is converted to the declared type of the corresponding
+// input parameter.  Numbers and booleans may also be given as strings, as
+// they would be from a web form.  Input parameters which are missing from
+// args are bound to null, unless they have a default value.  It is an error
+// for args to contain a value which is not an input to the callable, or
+// which cannot be converted to the parameter's type, or a string containing
+// a double quote, which mro string literals cannot represent.
+//
+// The source includes the file which declares the callable.  The ast must
+// have been compiled.
+func (global *Ast) InvocationFromJSON(callable string,
+	args map[string]interface{}) (string, error) {
+	c := global.Callables.Table[callable]
+	if c == nil {
+		return "", fmt.Errorf(
+			"ScopeNameError: '%s' is not a declared pipeline or stage",
+			callable)
+	}
+	params := c.GetInParams()
+	for id := range args {
+		if _, ok := params.Table[id]; !ok {
+			return "", fmt.Errorf(
+				"ArgumentError: '%s' has no input parameter '%s'",
+				callable, id)
+		}
+	}
+	var buf bytes.Buffer
+	if f := c.File(); f != nil && f.FileName != "" {
+		fmt.Fprintf(&buf, "@include \"%s\"\n\n", f.FileName)
+	}
+	fmt.Fprintf(&buf, "call %s(\n", callable)
+	for _, param := range params.List {
+		val, ok := args[param.Id]
+		if !ok && param.Default != nil {
+			continue
+		}
+		val, err := global.coerceArg(param.Tname, param.GetArrayDim(), val)
+		if err == nil {
+			err = checkStringLiterals(val)
+		}
+		if err != nil {
+			return "", fmt.Errorf("ArgumentError: %s: %v", param.Id, err)
+		}
+		fmt.Fprintf(&buf, "    %s = ", param.Id)
+		if err := writeInvocationValue(&buf, val); err != nil {
+			return "", fmt.Errorf("ArgumentError: %s: %v", param.Id, err)
+		}
+		buf.WriteString(",\n")
+	}
+	buf.WriteString(")\n")
+	return buf.String(), nil
+}
+
+// Write a value as JSON, which is also valid mro, indented to match the
+// bindings of the call.
+func writeInvocationValue(buf *bytes.Buffer, val interface{}) error {
+	var raw bytes.Buffer
+	enc := json.NewEncoder(&raw)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(val); err != nil {
+		return err
+	}
+	return json.Indent(buf, bytes.TrimSpace(raw.Bytes()), "    ", "    ")
+}
+
+// Check that the strings in a value, including map keys, can be written as
+// mro string literals.
+func checkStringLiterals(val interface{}) error {
+	switch v := val.(type) {
+	case string:
+		if strings.ContainsRune(v, '"') {
+			return fmt.Errorf("string %s contains a double quote", v)
+		}
+	case []interface{}:
+		for _, e := range v {
+			if err := checkStringLiterals(e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			if err := checkStringLiterals(k); err != nil {
+				return err
+			}
+			if err := checkStringLiterals(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Convert a value to the given type.
+func (global *Ast) coerceArg(tname string, arrayDim int,
+	val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if arrayDim > 0 {
+		arr, ok := val.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array of %s, got %v",
+				typeString(tname, arrayDim-1), val)
+		}
+		result := make([]interface{}, len(arr))
+		for i, v := range arr {
+			if c, err := global.coerceArg(tname, arrayDim-1, v); err != nil {
+				return nil, err
+			} else {
+				result[i] = c
+			}
+		}
+		return result, nil
+	}
+	switch t := global.TypeTable[tname].(type) {
+	case *StructType:
+		return global.coerceStruct(t, val)
+	case *EnumType:
+		if s, ok := val.(string); !ok || !t.HasValue(s) {
+			return nil, fmt.Errorf("'%v' is not a valid value for enum '%s'",
+				val, t.Id)
+		}
+		return val, nil
+	case *UserType:
+		tname = KindFile
+	}
+	switch tname {
+	case KindInt:
+		return coerceInt(val)
+	case KindFloat:
+		return coerceFloat(val)
+	case KindBool:
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	case KindString, KindPath, KindFile:
+		if s, ok := val.(string); ok {
+			return s, nil
+		}
+	case KindMap:
+		if m, ok := val.(map[string]interface{}); ok {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %s, got %v", tname, val)
+}
+
+func coerceInt(val interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v), nil
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("expected int, got %v", val)
+}
+
+func coerceFloat(val interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f, nil
+		}
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("expected float, got %v", val)
+}
+
+// Convert the fields of a map to the field types of the struct.
+func (global *Ast) coerceStruct(t *StructType,
+	val interface{}) (interface{}, error) {
+	m, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected struct %s, got %v", t.Id, val)
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if t.Table[key] == nil {
+			return nil, fmt.Errorf("struct '%s' has no field '%s'", t.Id, key)
+		}
+	}
+	result := make(map[string]interface{}, len(t.Fields))
+	for _, field := range t.Fields {
+		v, ok := m[field.Id]
+		if !ok {
+			return nil, fmt.Errorf("no value given for field '%s' of struct '%s'",
+				field.Id, t.Id)
+		}
+		c, err := global.coerceArg(field.Tname, field.GetArrayDim(), v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", field.Id, err)
+		}
+		result[field.Id] = c
+	}
+	return result, nil
+}
+
+// InvocationToJSON parses the top-level call statement in the given mro
+// source, and returns the JSON serialization of its Invocation.
+//
+// The source is parsed but not compiled, so included files are not read,
+// and the values of the arguments have the types given in the source.  The
+// call's bindings must all be literal values.
+func InvocationToJSON(src string) ([]byte, error) {
+	ast, err := yaccParse([]byte(src), new(SourceFile), makeStringIntern())
+	if err != nil {
+		return nil, err
+	}
+	if ast.Call == nil {
+		return nil, fmt.Errorf("ParseError: no call statement found")
+	}
+	inv := Invocation{
+		Call: ast.Call.DecId,
+		Args: make(map[string]interface{}, len(ast.Call.Bindings.List)),
+	}
+	for _, binding := range ast.Call.Bindings.List {
+		if _, ok := binding.Exp.(*ValExp); !ok {
+			return nil, fmt.Errorf(
+				"ArgumentError: %s: the top-level call may only bind literal values",
+				binding.Id)
+		}
+		inv.Args[binding.Id] = invocationValue(binding.Exp.ToInterface())
+		if binding.Sweep {
+			inv.SweepArgs = append(inv.SweepArgs, binding.Id)
+		}
+	}
+	return json.MarshalIndent(&inv, "", "    ")
+}
+
+// String literals are stored with their escape sequences, which are the
+// same as those in JSON.  Decode them.
+func invocationValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case string:
+		var s string
+		if err := json.Unmarshal([]byte(`"`+v+`"`), &s); err == nil {
+			return s
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = invocationValue(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = invocationValue(e)
+		}
+	}
+	return val
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const invocationTestSrc = `
+struct POINT(
+    float x,
+    float y,
+)
+
+enum SHAPE(
+    "circle",
+    "square",
+)
+
+stage PLOT(
+    in  int      count,
+    in  float    scale,
+    in  bool     fill,
+    in  string   title,
+    in  SHAPE    shape,
+    in  POINT[]  points,
+    in  map      extra,
+    in  int      width   = 10,
+    out path     plot,
+    src py       "stages/plot",
+)
+`
+
+func TestInvocationFromJSON(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, invocationTestSrc)
+	if ast == nil {
+		return
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+    "count": 3,
+    "scale": "1.5",
+    "fill": "true",
+    "title": "a <b>\ttitle",
+    "shape": "circle",
+    "points": [{"x": 1, "y": 2.5}]
+}`), &args); err != nil {
+		t.Fatal(err)
+	}
+	src, err := ast.InvocationFromJSON("PLOT", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `call PLOT(
+    count = 3,
+    scale = 1.5,
+    fill = true,
+    title = "a <b>\ttitle",
+    shape = "circle",
+    points = [
+        {
+            "x": 1,
+            "y": 2.5
+        }
+    ],
+    extra = null,
+)
+`
+	if src != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, src)
+	}
+	// The source compiles with the stage declaration.
+	if testGood(t, invocationTestSrc+src) == nil {
+		return
+	}
+
+	// And converts back to the same arguments.
+	b, err := InvocationToJSON(invocationTestSrc + src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inv Invocation
+	if err := json.Unmarshal(b, &inv); err != nil {
+		t.Fatal(err)
+	}
+	if inv.Call != "PLOT" {
+		t.Errorf("Expected call PLOT, got %s", inv.Call)
+	}
+	args["scale"] = 1.5
+	args["fill"] = true
+	args["extra"] = nil
+	if !reflect.DeepEqual(inv.Args, args) {
+		t.Errorf("Expected\n%v\ngot\n%v", args, inv.Args)
+	}
+
+	for _, bad := range []map[string]interface{}{
+		{"count": 1.5},
+		{"fill": "maybe"},
+		{"title": 1},
+		{"title": "a \"quoted\" title"},
+		{"extra": map[string]interface{}{"\"": 1}},
+		{"shape": "triangle"},
+		{"points": []interface{}{map[string]interface{}{"x": 1}}},
+		{"points": map[string]interface{}{"x": 1, "y": 2}},
+		{"height": 1},
+	} {
+		if _, err := ast.InvocationFromJSON("PLOT", bad); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+	if _, err := ast.InvocationFromJSON("PLOT_ALL", nil); err == nil {
+		t.Error("Expected an error for an unknown callable.")
+	}
+}
+
+func TestInvocationToJSON(t *testing.T) {
+	t.Parallel()
+	b, err := InvocationToJSON(`@include "plot.mro"
+
+call PLOT(
+    count = sweep(
+        1,
+        2,
+    ),
+    title = "line\nbreak",
+)
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inv Invocation
+	if err := json.Unmarshal(b, &inv); err != nil {
+		t.Fatal(err)
+	}
+	if inv.Args["title"] != "line\nbreak" {
+		t.Errorf("Incorrect title %q", inv.Args["title"])
+	}
+	if !reflect.DeepEqual(inv.SweepArgs, []string{"count"}) {
+		t.Errorf("Expected count to be swept, got %v", inv.SweepArgs)
+	}
+	if _, err := InvocationToJSON(invocationTestSrc); err == nil ||
+		!strings.Contains(err.Error(), "no call") {
+		t.Errorf("Expected an error for missing call, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// JSON schema generation for struct types.
+
+package syntax
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const jsonSchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+type schemaBuilder struct {
+	global *Ast
+
+	// Schemas for struct types referenced from the top-level struct.
+	definitions map[string]interface{}
+}
+
+// Get a JSON schema describing values of the given struct type.
+//
+// The schema for any other struct types referenced by the fields of the
+// struct are included in the "definitions" section of the schema.  Because
+// any mro value may be null, the schema permits null for every field.
+//
+// The ast must have been compiled.
+func (global *Ast) JsonSchema(structId string) (map[string]interface{}, error) {
+	structType := global.getStructType(structId)
+	if structType == nil {
+		return nil, fmt.Errorf("TypeError: '%s' is not a struct type", structId)
+	}
+	builder := schemaBuilder{
+		global:      global,
+		definitions: make(map[string]interface{}),
+	}
+	schema := builder.structSchema(structType)
+	schema["$schema"] = jsonSchemaVersion
+	schema["title"] = structType.Id
+	if len(builder.definitions) > 0 {
+		schema["definitions"] = builder.definitions
+	}
+	return schema, nil
+}
+
+// Get a JSON schema document describing the inputs to the given pipeline,
+// which can be used to validate invocation arguments before submitting them.
+//
+// Every input parameter is required, except for those with default values.
+// As for JsonSchema, any struct types used by the parameters are included
+// in the "definitions" section, and the ast must have been compiled.
+func (global *Ast) PipelineJsonSchema(pipelineId string) ([]byte, error) {
+	pipeline, ok := global.Callables.Table[pipelineId].(*Pipeline)
+	if !ok {
+		return nil, fmt.Errorf("ScopeNameError: '%s' is not a pipeline", pipelineId)
+	}
+	builder := schemaBuilder{
+		global:      global,
+		definitions: make(map[string]interface{}),
+	}
+	properties := make(map[string]interface{}, len(pipeline.InParams.List))
+	required := make([]string, 0, len(pipeline.InParams.List))
+	for _, param := range pipeline.InParams.List {
+		schema := builder.typeSchema(param.Tname, param.GetArrayDim())
+		if desc := paramDescription(param); desc != "" {
+			schema["description"] = desc
+		}
+		if param.Default != nil {
+			schema["default"] = param.Default.ToInterface()
+		} else {
+			required = append(required, param.Id)
+		}
+		properties[param.Id] = schema
+	}
+	schema := map[string]interface{}{
+		"$schema":              jsonSchemaVersion,
+		"title":                pipeline.Id,
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	if pipeline.Doc != "" {
+		schema["description"] = pipeline.Doc
+	}
+	if len(builder.definitions) > 0 {
+		schema["definitions"] = builder.definitions
+	}
+	return json.MarshalIndent(schema, "", "    ")
+}
+
+// Get the description of a parameter, combining its help text with any
+// documentation comments.
+func paramDescription(param Param) string {
+	help, doc := param.GetHelp(), param.GetDoc()
+	if help == "" {
+		return doc
+	} else if doc == "" {
+		return help
+	}
+	return help + "\n\n" + doc
+}
+
+func (builder *schemaBuilder) structSchema(structType *StructType) map[string]interface{} {
+	properties := make(map[string]interface{}, len(structType.Fields))
+	required := make([]string, 0, len(structType.Fields))
+	for _, field := range structType.Fields {
+		schema := builder.typeSchema(field.Tname, field.GetArrayDim())
+		if field.Help != "" {
+			schema["description"] = field.Help
+		}
+		properties[field.Id] = schema
+		required = append(required, field.Id)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func (builder *schemaBuilder) typeSchema(tname string, arrayDim int) map[string]interface{} {
+	if arrayDim > 0 {
+		return map[string]interface{}{
+			"type":  []string{"array", "null"},
+			"items": builder.typeSchema(tname, arrayDim-1),
+		}
+	}
+	switch tname {
+	case KindInt:
+		return map[string]interface{}{"type": []string{"integer", "null"}}
+	case KindFloat:
+		return map[string]interface{}{"type": []string{"number", "null"}}
+	case KindBool:
+		return map[string]interface{}{"type": []string{"boolean", "null"}}
+	case KindMap:
+		return map[string]interface{}{"type": []string{"object", "null"}}
+	}
+	if enumType := builder.global.getEnumType(tname); enumType != nil {
+		values := make([]interface{}, 0, len(enumType.Values)+1)
+		for _, v := range enumType.Values {
+			values = append(values, v)
+		}
+		return map[string]interface{}{
+			"enum": append(values, nil),
+		}
+	}
+	if structType := builder.global.getStructType(tname); structType != nil {
+		if _, ok := builder.definitions[tname]; !ok {
+			// Reserve the name first, in case the struct refers to itself.
+			builder.definitions[tname] = nil
+			builder.definitions[tname] = builder.structSchema(structType)
+		}
+		return map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]string{"$ref": "#/definitions/" + tname},
+				map[string]string{"type": "null"},
+			},
+		}
+	}
+	// Strings, paths, and file types.
+	return map[string]interface{}{"type": []string{"string", "null"}}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStructJsonSchema(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, structTestSrc)
+	if ast == nil {
+		return
+	}
+	if _, err := ast.JsonSchema("DRAW"); err == nil {
+		t.Error("Expected an error for a non-struct type.")
+	}
+	schema, err := ast.JsonSchema("SHAPE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.MarshalIndent(schema, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `{
+    "$schema": "http://json-schema.org/draft-07/schema#",
+    "additionalProperties": false,
+    "definitions": {
+        "POINT": {
+            "additionalProperties": false,
+            "properties": {
+                "x": {
+                    "type": [
+                        "number",
+                        "null"
+                    ]
+                },
+                "y": {
+                    "type": [
+                        "number",
+                        "null"
+                    ]
+                }
+            },
+            "required": [
+                "x",
+                "y"
+            ],
+            "type": "object"
+        }
+    },
+    "properties": {
+        "description": {
+            "description": "A text file",
+            "type": [
+                "string",
+                "null"
+            ]
+        },
+        "name": {
+            "type": [
+                "string",
+                "null"
+            ]
+        },
+        "vertices": {
+            "items": {
+                "anyOf": [
+                    {
+                        "$ref": "#/definitions/POINT"
+                    },
+                    {
+                        "type": "null"
+                    }
+                ]
+            },
+            "type": [
+                "array",
+                "null"
+            ]
+        }
+    },
+    "required": [
+        "name",
+        "vertices",
+        "description"
+    ],
+    "title": "SHAPE",
+    "type": "object"
+}`
+	if s := string(b); s != expect {
+		t.Errorf("Expected\n%s\nGot\n%s", expect, s)
+	}
+}
+
+func TestEnumJsonSchema(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, `
+enum FORMAT(
+    "bam",
+    "cram",
+)
+
+struct READS(
+    FORMAT format,
+)
+`)
+	if ast == nil {
+		return
+	}
+	schema, err := ast.JsonSchema("READS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(schema["properties"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `{"format":{"enum":["bam","cram",null]}}`
+	if s := string(b); s != expect {
+		t.Errorf("Expected %s, got %s", expect, s)
+	}
+}
+
+func TestPipelineJsonSchema(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, `
+filetype txt;
+
+enum Mode(
+    "fast",
+    "slow",
+)
+
+struct Range(
+    int start,
+    int end,
+)
+
+stage COUNT(
+    in  txt     input,
+    in  path    dir,
+    in  map     options,
+    in  Mode    mode,
+    in  Range[] ranges,
+    out int     count,
+    src py      "stages/count",
+)
+
+# Count everything.
+pipeline COUNT_ALL(
+    in  txt     input   "The input file",
+    # The output directory.
+    in  path    dir,
+    in  map     options = {"verbose": true},
+    in  Mode    mode    = "fast",
+    in  Range[] ranges,
+    out int     count,
+)
+{
+    call COUNT(
+        input   = self.input,
+        dir     = self.dir,
+        options = self.options,
+        mode    = self.mode,
+        ranges  = self.ranges,
+    )
+
+    return (
+        count = COUNT.count,
+    )
+}
+`)
+	if ast == nil {
+		return
+	}
+	if _, err := ast.PipelineJsonSchema("COUNT"); err == nil {
+		t.Error("Expected an error for a stage.")
+	}
+	b, err := ast.PipelineJsonSchema("COUNT_ALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if title := schema["title"]; title != "COUNT_ALL" {
+		t.Errorf("Incorrect title %v", title)
+	}
+	if desc := schema["description"]; desc != "Count everything." {
+		t.Errorf("Incorrect description %v", desc)
+	}
+	if req, _ := json.Marshal(schema["required"]); string(req) != `["input","dir","ranges"]` {
+		t.Errorf("Incorrect required list %s", req)
+	}
+	props, _ := schema["properties"].(map[string]interface{})
+	if len(props) != 5 {
+		t.Fatalf("Expected 5 properties, got %v", props)
+	}
+	for name, expect := range map[string]string{
+		"input":   `{"description":"The input file","type":["string","null"]}`,
+		"dir":     `{"description":"The output directory.","type":["string","null"]}`,
+		"mode":    `{"default":"fast","enum":["fast","slow",null]}`,
+		"options": `{"default":{"verbose":true},"type":["object","null"]}`,
+		"ranges": `{"items":{"anyOf":[{"$ref":"#/definitions/Range"},{"type":"null"}]},` +
+			`"type":["array","null"]}`,
+	} {
+		if p, _ := json.Marshal(props[name]); string(p) != expect {
+			t.Errorf("Expected %s to be\n%s\ngot\n%s", name, expect, p)
+		}
+	}
+	if defs, _ := schema["definitions"].(map[string]interface{}); defs["Range"] == nil {
+		t.Errorf("Expected a definition for Range, got %v", defs)
+	}
+}
@@ -18,6 +18,8 @@ type mmLexInfo struct {
 	src      []byte // All the data we're scanning
 	pos      int    // Position of the scan head
 	loc      int    // Keep track of the line number
+	linePos  int    // The offset of the start of the current line
+	lastLine int    // The line of the last token or comment
 	previous []byte //
 	token    []byte // Cache the last token for error messaging
 	global   *Ast
@@ -28,14 +30,25 @@ type mmLexInfo struct {
 	// appear at least 3 times: when it's declared, when it's called, and
 	// when its output is referenced.  So we coalesce those allocations.
 	intern *stringIntern
+
+	// Errors encountered so far during the parse.
+	errors ErrorList
 }
 
 var newlineBytes = []byte("\n")
 
+// Get the location of the most recent token.
 func (self *mmLexInfo) Loc() SourceLoc {
+	return self.locAt(self.pos - len(self.token))
+}
+
+// Get the location of the given offset, which must be on the current line.
+func (self *mmLexInfo) locAt(offset int) SourceLoc {
 	return SourceLoc{
-		Line: self.loc,
-		File: self.srcfile,
+		Line:   self.loc,
+		File:   self.srcfile,
+		Col:    offset - self.linePos + 1,
+		Offset: offset,
 	}
 }
 
@@ -51,27 +64,35 @@ func (self *mmLexInfo) Lex(lval *mmSymType) int {
 
 		// Iterate through the regexps until one matches the head.
 		tokid, val := nextToken(head)
+		start := self.pos
 		// Advance the cursor pos.
 		self.pos += len(val)
 
 		// If whitespace or comment, advance line count by counting newlines.
 		if tokid == SKIP {
-			self.loc += bytes.Count(val, newlineBytes)
+			if n := bytes.Count(val, newlineBytes); n > 0 {
+				self.loc += n
+				self.linePos = start + bytes.LastIndexByte(val, '\n') + 1
+			}
 			continue
 		} else if tokid == COMMENT {
 			self.comments = append(self.comments, &commentBlock{
-				self.Loc(),
-				string(bytes.TrimSpace(val)),
+				Loc:         self.locAt(start),
+				Value:       string(bytes.TrimSpace(val)),
+				blankBefore: self.loc > self.lastLine+1,
 			})
+			self.lastLine = self.loc
 			self.loc++
+			self.linePos = self.pos
 			continue
 		}
+		self.lastLine = self.loc
 
 		// If got parseable token, pass it and line number to parser.
 		self.previous = self.token
 		self.token = val
 		lval.val = self.token
-		lval.loc = self.loc // give grammar rules access to loc
+		lval.loc = self.locAt(start) // give grammar rules access to loc
 
 		// give NewAstNode access to file to generate file-local locations
 		lval.srcfile = self.srcfile
@@ -133,25 +154,100 @@ func (self *mmLexError) Error() string {
 	return buff.String()
 }
 
-func (self *mmLexInfo) Error(string) {}
+func (self *mmLexInfo) Error(string) {
+	// Save a copy of the lexer state to provide loc and token info.
+	err := &mmLexError{info: *self}
+	err.info.errors = nil
+	self.errors = append(self.errors, err)
+	self.skipToNextDec()
+}
+
+// The keywords which may begin a top-level declaration.
+var decKeywords = [...][]byte{
+	[]byte("filetype"),
+	[]byte("enum"),
+	[]byte("struct"),
+	[]byte("stage"),
+	[]byte("pipeline"),
+	[]byte("call"),
+}
+
+// Returns true if the given source begins with a keyword which may start a
+// top-level declaration.
+func startsDec(src []byte) bool {
+	for _, kw := range decKeywords {
+		if bytes.HasPrefix(src, kw) {
+			if len(src) == len(kw) {
+				return true
+			}
+			switch c := src[len(kw)]; {
+			case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			default:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Advance the scan head to the start of the next line which begins with a
+// top-level declaration keyword, so that the parser can resume from there.
+//
+// Calls inside of a pipeline are indented, so restricting this to keywords at
+// the start of a line prevents resuming in the middle of a pipeline.
+func (self *mmLexInfo) skipToNextDec() {
+	if start := self.pos - len(self.token); start >= 0 &&
+		(start == 0 || self.src[start-1] == '\n') &&
+		startsDec(self.token) {
+		// The offending token already starts a new declaration.
+		return
+	}
+	for self.pos < len(self.src) {
+		i := bytes.IndexByte(self.src[self.pos:], '\n')
+		if i < 0 {
+			self.pos = len(self.src)
+			return
+		}
+		self.pos += i + 1
+		self.loc++
+		self.linePos = self.pos
+		if startsDec(self.src[self.pos:]) {
+			return
+		}
+	}
+}
 
 func yaccParse(src []byte, file *SourceFile, intern *stringIntern) (*Ast, error) {
-	lexinfo := mmLexError{
-		info: mmLexInfo{
-			src:     src,
-			pos:     0,
-			loc:     1,
-			srcfile: file,
-			intern:  intern,
-		},
+	ast, errs := yaccParseAll(src, file, intern)
+	if len(errs) > 0 {
+		return nil, errs.If()
+	}
+	return ast, nil
+}
+
+// Parse the source, returning the list of all syntax errors encountered.
+//
+// After each error, the parser will attempt to resume at the next top-level
+// declaration.  If any errors were encountered, the returned ast will be
+// incomplete.
+func yaccParseAll(src []byte, file *SourceFile, intern *stringIntern) (*Ast, ErrorList) {
+	lexinfo := mmLexInfo{
+		src:     src,
+		pos:     0,
+		loc:     1,
+		srcfile: file,
+		intern:  intern,
+	}
+	if mmParse(&lexinfo) != 0 && len(lexinfo.errors) == 0 {
+		lexinfo.errors = ErrorList{&mmLexError{info: lexinfo}}
 	}
-	if mmParse(&lexinfo.info) != 0 {
-		return nil, &lexinfo // return lex on error to provide loc and token info
+	if len(lexinfo.errors) > 0 {
+		return lexinfo.global, lexinfo.errors
 	}
-	lexinfo.info.global.comments = lexinfo.info.comments
-	lexinfo.info.global.comments = compileComments(
-		lexinfo.info.global.comments, lexinfo.info.global)
-	return lexinfo.info.global, nil // success
+	lexinfo.global.comments = lexinfo.comments
+	lexinfo.global.comments = compileComments(
+		lexinfo.global.comments, lexinfo.global)
+	return lexinfo.global, nil // success
 }
 
 func attachComments(comments []*commentBlock, node *AstNode) []*commentBlock {
@@ -190,15 +286,42 @@ func compileComments(comments []*commentBlock, node nodeContainer) []*commentBlo
 	nodes := node.getSubnodes()
 	for _, n := range nodes {
 		comments = attachComments(comments, n.getNode())
+		if d, ok := n.(documented); ok {
+			d.setDoc(docString(n.getNode().Comments))
+		}
 		comments = compileComments(comments, n)
 	}
 	if len(nodes) > 0 && node.inheritComments() {
+		// Move, rather than copy, the comments, so that they are only
+		// printed once.
+		parent := node.(AstNodable).getNode()
 		nodes[0].getNode().scopeComments = append(
-			node.(AstNodable).getNode().scopeComments,
+			parent.scopeComments,
 			nodes[0].getNode().scopeComments...)
 		nodes[0].getNode().Comments = append(
-			node.(AstNodable).getNode().Comments,
+			parent.Comments,
 			nodes[0].getNode().Comments...)
+		parent.scopeComments = nil
+		parent.Comments = nil
 	}
 	return comments
 }
+
+// A node which has documentation taken from its comments.
+type documented interface {
+	setDoc(string)
+}
+
+// Get the documentation text from a block of comments, with the leading
+// '#' and the following space removed from each line.
+func docString(comments []string) string {
+	if len(comments) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(comments))
+	for _, c := range comments {
+		c = strings.TrimPrefix(c, "#")
+		lines = append(lines, strings.TrimPrefix(c, " "))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
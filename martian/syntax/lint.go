@@ -0,0 +1,127 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Optional checks for stylistic problems and questionable practices.
+
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintConfig selects which lint rules are checked.
+type LintConfig struct {
+	// Report stages which have file outputs, but no retain annotation.
+	// Without one, all of their outputs may be deleted by VDR.
+	StageRetain bool
+
+	// Report pipelines in which no calls can be disabled.
+	PipelineDisabled bool
+
+	// Report stage outputs which are declared with the generic "file"
+	// type, rather than a specific user-defined file type.
+	GenericFileOutput bool
+}
+
+// Names of the lint rules, as reported in LintViolation.Rule.
+const (
+	LintStageRetain       = "stage-retain"
+	LintPipelineDisabled  = "pipeline-disabled"
+	LintGenericFileOutput = "generic-file-output"
+)
+
+// DefaultLintConfig returns a configuration with all rules enabled.
+func DefaultLintConfig() LintConfig {
+	return LintConfig{
+		StageRetain:       true,
+		PipelineDisabled:  true,
+		GenericFileOutput: true,
+	}
+}
+
+// A LintViolation describes a place where the source fails a lint rule.
+type LintViolation struct {
+	Rule string
+	Node *AstNode
+	Msg  string
+}
+
+func (self LintViolation) writeTo(w stringWriter) {
+	w.WriteString("MRO LINT ")
+	w.WriteString(self.Rule)
+	w.WriteString(": ")
+	w.WriteString(self.Msg)
+	w.WriteString("\n    at ")
+	self.Node.Loc.writeTo(w, "        ")
+}
+
+func (self LintViolation) String() string {
+	var buff strings.Builder
+	buff.Grow(len("MRO LINT : \n    at sourcename.mro:100 included from sourcename.mro:10") +
+		len(self.Rule) + len(self.Msg))
+	self.writeTo(&buff)
+	return buff.String()
+}
+
+// Lint checks the compiled AST against the rules enabled in the
+// configuration.  Unlike compilation errors and warnings, these are matters
+// of style or best practice, and are only checked on request.
+func Lint(ast *Ast, config LintConfig) []LintViolation {
+	var violations []LintViolation
+	report := func(rule string, node AstNodable, msg string, v ...interface{}) {
+		violations = append(violations, LintViolation{
+			Rule: rule,
+			Node: node.getNode(),
+			Msg:  fmt.Sprintf(msg, v...),
+		})
+	}
+	for _, stage := range ast.Stages {
+		if config.StageRetain && stage.Retain == nil &&
+			hasFileOutput(stage.OutParams) {
+			report(LintStageRetain, stage,
+				"stage %s has file outputs but does not retain any of them",
+				stage.Id)
+		}
+		if config.GenericFileOutput && stage.OutParams != nil {
+			for _, param := range stage.OutParams.List {
+				if param.Tname == KindFile {
+					report(LintGenericFileOutput, param,
+						"output %s of stage %s should use a more specific file type",
+						param.Id, stage.Id)
+				}
+			}
+		}
+	}
+	if config.PipelineDisabled {
+		for _, pipeline := range ast.Pipelines {
+			if !hasDisabledCall(pipeline) {
+				report(LintPipelineDisabled, pipeline,
+					"no calls in pipeline %s can be disabled",
+					pipeline.Id)
+			}
+		}
+	}
+	return violations
+}
+
+func hasFileOutput(params *OutParams) bool {
+	if params == nil {
+		return false
+	}
+	for _, param := range params.List {
+		if param.IsFile() {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDisabledCall(pipeline *Pipeline) bool {
+	for _, call := range pipeline.Calls {
+		if call.Modifiers != nil && call.Modifiers.Bindings != nil &&
+			call.Modifiers.Bindings.Table[disabled] != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"testing"
+)
+
+const lintTestSrc = `
+filetype txt;
+
+stage MAKE_REPORT(
+    in  int  value,
+    out txt  report,
+    out file log,
+    src py   "stages/make_report",
+)
+
+stage CHECK(
+    in  int  value,
+    out bool skip,
+    out txt  summary,
+    src py   "stages/check",
+) retain (
+    summary,
+)
+
+pipeline REPORT(
+    in  int value,
+    out txt report,
+)
+{
+    call MAKE_REPORT(
+        value = self.value,
+    )
+
+    return (
+        report = MAKE_REPORT.report,
+    )
+}
+
+pipeline CHECKED_REPORT(
+    in  int value,
+    out txt report,
+)
+{
+    call CHECK(
+        value = self.value,
+    )
+
+    call REPORT(
+        value = self.value,
+    ) using (
+        disabled = CHECK.skip,
+    )
+
+    return (
+        report = REPORT.report,
+    )
+}
+`
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, lintTestSrc)
+	if ast == nil {
+		return
+	}
+	violations := Lint(ast, DefaultLintConfig())
+	expect := []struct {
+		rule string
+		line int
+	}{
+		{LintStageRetain, 4},
+		{LintGenericFileOutput, 7},
+		{LintPipelineDisabled, 20},
+	}
+	if len(violations) != len(expect) {
+		t.Errorf("Expected %d violations, got %d", len(expect), len(violations))
+	}
+	for i, v := range violations {
+		if i >= len(expect) {
+			t.Errorf("Unexpected violation %s", v.String())
+		} else if v.Rule != expect[i].rule || v.Node.Loc.Line != expect[i].line {
+			t.Errorf("Expected %s at line %d, got %s",
+				expect[i].rule, expect[i].line, v.String())
+		}
+	}
+	if violations := Lint(ast, LintConfig{}); len(violations) != 0 {
+		t.Errorf("Expected no violations with all rules disabled, got %v",
+			violations)
+	}
+	violations = Lint(ast, LintConfig{GenericFileOutput: true})
+	if len(violations) != 1 || violations[0].Rule != LintGenericFileOutput {
+		t.Errorf("Expected only the generic file output rule, got %v",
+			violations)
+	}
+}
@@ -8,10 +8,13 @@ package syntax
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/martian-lang/martian/martian/util"
 )
@@ -23,6 +26,14 @@ func (global *Ast) err(nodable AstNodable, msg string, v ...interface{}) error {
 	return &AstError{global, nodable.getNode(), fmt.Sprintf(msg, v...)}
 }
 
+// Record a non-fatal problem with the source.
+func (global *Ast) warn(nodable AstNodable, msg string, v ...interface{}) {
+	global.warnings = append(global.warnings, Warning{
+		Node: nodable.getNode(),
+		Msg:  fmt.Sprintf(msg, v...),
+	})
+}
+
 func (global *Ast) compile() error {
 	if err := global.compileTypes(); err != nil {
 		return err
@@ -33,6 +44,10 @@ func (global *Ast) compile() error {
 		return err
 	}
 
+	if err := global.instantiateGenerics(); err != nil {
+		return err
+	}
+
 	if err := global.compileStages(); err != nil {
 		return err
 	}
@@ -49,14 +64,19 @@ func (global *Ast) compile() error {
 		return err
 	}
 
+	if err := global.checkUnusedIncludes(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (global *Ast) checkSrcPaths(stagecodePaths []string) error {
 	var errs ErrorList
 	for _, stage := range global.Stages {
-		// Exempt exec stages
-		if stage.Src.Lang != "exec" && stage.Src.Lang != "comp" {
+		// Exempt exec stages, and stages whose code is in a container image.
+		if stage.Src.Lang != "exec" && stage.Src.Lang != "comp" &&
+			stage.Src.Image == "" {
 			if _, found := util.SearchPaths(stage.Src.Path, stagecodePaths); !found {
 				stagecodePathsList := strings.Join(stagecodePaths, ", ")
 				errs = append(errs, global.err(stage,
@@ -88,9 +108,31 @@ func (src *SourceFile) checkIncludes(fullPath string, inc *SourceLoc) error {
 // A Parser object allows the ParseSourceBytes and Compile methods
 // to cache state if repeatedly invoked.
 //
+// In particular, files which are included by more than one top-level source
+// file are only parsed once, so long as their modification time does not
+// change.
+//
 // The Parser object is NOT thread safe.
 type Parser struct {
 	intern *stringIntern
+
+	// Parsed (but not merged or compiled) ASTs for included files,
+	// keyed by absolute path.
+	includedASTs map[string]*cachedInclude
+
+	// The AST most recently produced by ParseSourceBytes or Compile,
+	// for use by NodeAt and Declaration.
+	ast *Ast
+
+	// If true, stage outputs of file or path type which are never
+	// retained are compile errors.  See Ast.CheckRetains.
+	StrictRetain bool
+}
+
+type cachedInclude struct {
+	modTime time.Time
+	size    int64
+	ast     *Ast
 }
 
 // ParseSource parses a souce string into an ast.
@@ -105,9 +147,12 @@ type Parser struct {
 //
 // if checksrc is true, then the parser will verify that stage src values
 // refer to code that actually exists.
+//
+// Any warnings generated during compilation are logged.
 func ParseSource(src string, srcPath string,
 	incPaths []string, checkSrc bool) (string, []string, *Ast, error) {
-	return ParseSourceBytes([]byte(src), srcPath, incPaths, checkSrc)
+	var parser Parser
+	return parser.parseSourceLogWarnings([]byte(src), srcPath, incPaths, checkSrc)
 }
 
 // ParseSourceBytes parses a source byte array into an ast.
@@ -122,12 +167,25 @@ func ParseSource(src string, srcPath string,
 //
 // if checksrc is true, then the parser will verify that stage src values
 // refer to code that actually exists.
+//
+// Returns the combined source, the includes, the compiled ast, any
+// non-fatal warnings, and an error if compilation failed.
 func ParseSourceBytes(src []byte, srcPath string,
-	incPaths []string, checkSrc bool) (string, []string, *Ast, error) {
+	incPaths []string, checkSrc bool) (string, []string, *Ast, []Warning, error) {
 	var parser Parser
 	return parser.ParseSourceBytes(src, srcPath, incPaths, checkSrc)
 }
 
+// ParseSourceReader parses mro source read from r into an ast.
+//
+// The entire content of the reader is buffered before parsing.  Otherwise
+// the arguments and return values are the same as for ParseSource.
+func ParseSourceReader(r io.Reader, srcPath string,
+	incPaths []string, checkSrc bool) (string, []string, *Ast, error) {
+	var parser Parser
+	return parser.ParseSourceReader(r, srcPath, incPaths, checkSrc)
+}
+
 func (parser *Parser) getIntern() *stringIntern {
 	if parser == nil {
 		return makeStringIntern()
@@ -149,20 +207,62 @@ func (parser *Parser) getIntern() *stringIntern {
 //
 // if checksrc is true, then the parser will verify that stage src values
 // refer to code that actually exists.
+//
+// After encountering a syntax error, the parser attempts to recover and
+// continue parsing at the next top-level declaration.  This way all syntax
+// errors in the source file and its includes are reported at once, as an
+// ErrorList, rather than just the first.
+//
+// Returns the combined source, the includes, the compiled ast, any
+// non-fatal warnings, and an error if compilation failed.
 func (parser *Parser) ParseSourceBytes(src []byte, srcPath string,
+	incPaths []string, checkSrc bool) (string, []string, *Ast, []Warning, error) {
+	return parser.parseSourceBytes(src, srcPath, incPaths, checkSrc)
+}
+
+// Parse the source, logging any warnings rather than returning them.
+func (parser *Parser) parseSourceLogWarnings(src []byte, srcPath string,
 	incPaths []string, checkSrc bool) (string, []string, *Ast, error) {
+	postsrc, ifnames, ast, warnings, err := parser.ParseSourceBytes(
+		src, srcPath, incPaths, checkSrc)
+	for _, w := range warnings {
+		util.PrintInfo("compile", "%s", w.String())
+	}
+	return postsrc, ifnames, ast, err
+}
+
+// ParseSourceReader parses mro source read from r into an ast.
+//
+// The entire content of the reader is buffered before parsing.  Otherwise
+// the arguments and return values are the same as for ParseSource.
+func (parser *Parser) ParseSourceReader(r io.Reader, srcPath string,
+	incPaths []string, checkSrc bool) (string, []string, *Ast, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return parser.parseSourceLogWarnings(src, srcPath, incPaths, checkSrc)
+}
+
+func (parser *Parser) parseSourceBytes(src []byte, srcPath string,
+	incPaths []string, checkSrc bool) (string, []string, *Ast, []Warning, error) {
 	fname := filepath.Base(srcPath)
 	absPath, _ := filepath.Abs(srcPath)
 	srcFile := SourceFile{
 		FileName: fname,
 		FullPath: absPath,
 	}
-	if ast, err := parseSource(src, &srcFile, incPaths,
-		map[string]*SourceFile{absPath: &srcFile},
-		parser.getIntern()); err != nil {
-		return "", nil, ast, err
+	if ast, err := parser.parseSource(src, &srcFile, incPaths,
+		map[string]*SourceFile{absPath: &srcFile}); err != nil {
+		return "", nil, ast, nil, err
 	} else {
 		err := ast.compile()
+		if parser != nil {
+			parser.ast = ast
+			if parser.StrictRetain && err == nil {
+				err = ast.CheckRetains()
+			}
+		}
 		ifnames := make([]string, len(ast.Includes))
 		for i, inc := range ast.Includes {
 			ifnames[i] = inc.Value
@@ -181,32 +281,142 @@ func (parser *Parser) ParseSourceBytes(src []byte, srcPath string,
 				err = ErrorList{err, srcerr}.If()
 			}
 		}
-		return ast.format(false), ifnames, ast, err
+		return ast.format(false, INDENT), ifnames, ast, ast.warnings, err
 	}
 }
 
-func parseSource(src []byte, srcFile *SourceFile, incPaths []string,
-	processedIncludes map[string]*SourceFile, intern *stringIntern) (*Ast, error) {
+func (parser *Parser) parseSource(src []byte, srcFile *SourceFile, incPaths []string,
+	processedIncludes map[string]*SourceFile) (*Ast, error) {
 	// Add the source file's own folder to the include path for
 	// resolving both @includes and stage src paths.
 	incPaths = append([]string{filepath.Dir(srcFile.FullPath)}, incPaths...)
 
-	// Parse the source into an AST and attach the comments.
-	ast, err := yaccParse(src, srcFile, intern)
+	ast, err := parser.parseSyntax(src, srcFile, incPaths,
+		processedIncludes)
 	if err != nil {
 		return nil, err
 	}
+	return parser.mergeIncludes(ast, srcFile, incPaths,
+		processedIncludes)
+}
+
+// Parse the source into an AST and attach the comments, without processing
+// includes.
+//
+// If there were syntax errors, the includes are still parsed in order to
+// report any syntax errors they might have.
+func (parser *Parser) parseSyntax(src []byte, srcFile *SourceFile, incPaths []string,
+	processedIncludes map[string]*SourceFile) (*Ast, error) {
+	ast, errs := yaccParseAll(src, srcFile, parser.getIntern())
+	if len(errs) == 0 {
+		return ast, nil
+	} else if ast != nil {
+		_, err := parser.getIncludes(srcFile, ast.Includes, incPaths,
+			processedIncludes)
+		return nil, append(errs, err).If()
+	} else {
+		return nil, errs.If()
+	}
+}
 
-	iasts, err := getIncludes(srcFile, ast.Includes, incPaths, processedIncludes, intern)
+// Parse the includes for the given ast and merge them into it.
+func (parser *Parser) mergeIncludes(ast *Ast, srcFile *SourceFile, incPaths []string,
+	processedIncludes map[string]*SourceFile) (*Ast, error) {
+	iasts, err := parser.getIncludes(srcFile, ast.Includes, incPaths,
+		processedIncludes)
 	if iasts != nil {
 		ast.merge(iasts)
 	}
 	return ast, err
 }
 
-func getIncludes(srcFile *SourceFile, includes []*Include, incPaths []string,
-	processedIncludes map[string]*SourceFile, intern *stringIntern) (*Ast, error) {
+// Returns true if the include path contains glob wildcard characters.
+func isWildcardInclude(value string) bool {
+	return strings.ContainsAny(value, "*?[")
+}
+
+// Expand any wildcard includes into includes for each matching file, in
+// alphabetical order.
+//
+// As with other includes, the pattern is matched against each of the
+// search paths in turn, and the first search path with any matches is
+// used.  Files matched by a wildcard which are also included explicitly,
+// or matched by an earlier wildcard, or are the including file itself,
+// are skipped.
+func expandIncludes(srcFile *SourceFile, includes []*Include,
+	incPaths []string) ([]*Include, error) {
+	hasWildcard := false
+	for _, inc := range includes {
+		if isWildcardInclude(inc.Value) {
+			hasWildcard = true
+			break
+		}
+	}
+	if !hasWildcard {
+		return includes, nil
+	}
+	seen := map[string]struct{}{srcFile.FullPath: {}}
+	for _, inc := range includes {
+		if !isWildcardInclude(inc.Value) {
+			if ifpath, found := util.SearchPaths(inc.Value, incPaths); found {
+				absPath, _ := filepath.Abs(ifpath)
+				seen[absPath] = struct{}{}
+			}
+		}
+	}
 	var errs ErrorList
+	result := make([]*Include, 0, len(includes))
+	for _, inc := range includes {
+		if !isWildcardInclude(inc.Value) {
+			result = append(result, inc)
+			continue
+		}
+		var matches []string
+		var searchPath string
+		for _, searchPath = range incPaths {
+			m, err := filepath.Glob(filepath.Join(searchPath, inc.Value))
+			if err != nil {
+				errs = append(errs, &wrapError{
+					innerError: err,
+					loc:        inc.Node.Loc,
+				})
+				break
+			} else if len(m) > 0 {
+				matches = m
+				break
+			}
+		}
+		if len(matches) == 0 {
+			errs = append(errs, &FileNotFoundError{
+				name: inc.Value,
+				loc:  inc.Node.Loc,
+			})
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			absPath, _ := filepath.Abs(match)
+			if _, ok := seen[absPath]; ok {
+				continue
+			}
+			seen[absPath] = struct{}{}
+			rel, err := filepath.Rel(searchPath, match)
+			if err != nil {
+				rel = match
+			}
+			result = append(result, &Include{
+				Node:  inc.Node,
+				Value: filepath.ToSlash(rel),
+			})
+		}
+	}
+	return result, errs.If()
+}
+
+func (parser *Parser) getIncludes(srcFile *SourceFile, includes []*Include, incPaths []string,
+	processedIncludes map[string]*SourceFile) (*Ast, error) {
+	includes, err := expandIncludes(srcFile, includes, incPaths)
+	errs := ErrorList{err}
 	var iasts *Ast
 	seen := make(map[string]struct{}, len(includes))
 	for _, inc := range includes {
@@ -237,29 +447,16 @@ func getIncludes(srcFile *SourceFile, includes []*Include, incPaths []string,
 					errs = append(errs, err)
 				}
 			} else {
-				iSrcFile = &SourceFile{
-					FileName:     inc.Value,
-					FullPath:     absPath,
-					IncludedFrom: []*SourceLoc{&inc.Node.Loc},
-				}
-				processedIncludes[absPath] = iSrcFile
-				if b, err := ioutil.ReadFile(iSrcFile.FullPath); err != nil {
-					errs = append(errs, &wrapError{
-						innerError: err,
-						loc:        inc.Node.Loc,
-					})
-				} else {
-					iast, err := parseSource(b, iSrcFile,
-						incPaths[1:], processedIncludes, intern)
-					errs = append(errs, err)
-					if iast != nil {
-						if iasts == nil {
-							iasts = iast
-						} else {
-							// x.merge(y) puts y's stuff before x's.
-							iast.merge(iasts)
-							iasts = iast
-						}
+				iast, err := parser.parseInclude(inc, absPath,
+					incPaths[1:], processedIncludes)
+				errs = append(errs, err)
+				if iast != nil {
+					if iasts == nil {
+						iasts = iast
+					} else {
+						// x.merge(y) puts y's stuff before x's.
+						iast.merge(iasts)
+						iasts = iast
 					}
 				}
 			}
@@ -268,6 +465,64 @@ func getIncludes(srcFile *SourceFile, includes []*Include, incPaths []string,
 	return iasts, errs.If()
 }
 
+// Parse an included file, reusing the cached AST if the file has not
+// changed since it was last parsed.
+func (parser *Parser) parseInclude(inc *Include, absPath string, incPaths []string,
+	processedIncludes map[string]*SourceFile) (*Ast, error) {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, &wrapError{
+			innerError: err,
+			loc:        inc.Node.Loc,
+		}
+	}
+	incPaths = append([]string{filepath.Dir(absPath)}, incPaths...)
+	if parser != nil {
+		if cached := parser.includedASTs[absPath]; cached != nil &&
+			cached.modTime.Equal(info.ModTime()) &&
+			cached.size == info.Size() {
+			// The nodes in the cached AST refer to the original
+			// SourceFile object, so reuse it.
+			iSrcFile := cached.ast.Files[absPath]
+			iSrcFile.FileName = inc.Value
+			iSrcFile.IncludedFrom = []*SourceLoc{&inc.Node.Loc}
+			processedIncludes[absPath] = iSrcFile
+			return parser.mergeIncludes(cached.ast.copy(), iSrcFile,
+				incPaths, processedIncludes)
+		}
+	}
+	iSrcFile := &SourceFile{
+		FileName:     inc.Value,
+		FullPath:     absPath,
+		IncludedFrom: []*SourceLoc{&inc.Node.Loc},
+	}
+	processedIncludes[absPath] = iSrcFile
+	b, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return nil, &wrapError{
+			innerError: err,
+			loc:        inc.Node.Loc,
+		}
+	}
+	ast, err := parser.parseSyntax(b, iSrcFile, incPaths,
+		processedIncludes)
+	if err != nil {
+		return nil, err
+	}
+	if parser != nil {
+		if parser.includedASTs == nil {
+			parser.includedASTs = make(map[string]*cachedInclude)
+		}
+		parser.includedASTs[absPath] = &cachedInclude{
+			modTime: info.ModTime(),
+			size:    info.Size(),
+			ast:     ast,
+		}
+	}
+	return parser.mergeIncludes(ast.copy(), iSrcFile,
+		incPaths, processedIncludes)
+}
+
 // Compile an MRO file in cwd or mroPaths.
 //
 // fpath is the path (absolute or relative to the current working directory) of
@@ -281,6 +536,7 @@ func getIncludes(srcFile *SourceFile, includes []*Include, incPaths []string,
 //
 // Returns the combined source (after processing all includes), the transitive
 // closure of all includes, the compiled AST, or an error if applicable.
+// Any warnings generated during compilation are logged.
 func Compile(fpath string,
 	mroPaths []string, checkSrcPath bool) (string, []string, *Ast, error) {
 	var parser Parser
@@ -300,12 +556,38 @@ func Compile(fpath string,
 //
 // Returns the combined source (after processing all includes), the transitive
 // closure of all includes, the compiled AST, or an error if applicable.
+// Any warnings generated during compilation are logged.
 func (parser *Parser) Compile(fpath string,
 	mroPaths []string, checkSrcPath bool) (string, []string, *Ast, error) {
 
 	if data, err := ioutil.ReadFile(fpath); err != nil {
 		return "", nil, nil, err
 	} else {
-		return parser.ParseSourceBytes(data, fpath, mroPaths, checkSrcPath)
+		return parser.parseSourceLogWarnings(data, fpath, mroPaths, checkSrcPath)
+	}
+}
+
+// CompileAll compiles each of the given MRO files.
+//
+// All of the files are compiled with this parser, so strings are interned
+// in a single table, and files included by more than one of them are only
+// parsed once.  Each file is still merged with its includes separately, so
+// that include cycles and missing includes are detected per file.
+//
+// Returns one AST for each path, in the same order.  The entry is nil if
+// the file could not be compiled.  The errors for all files are combined
+// into a single ErrorList.  Any warnings generated during compilation are
+// logged.
+func (parser *Parser) CompileAll(paths []string,
+	mroPaths []string, checkSrc bool) ([]*Ast, error) {
+	asts := make([]*Ast, len(paths))
+	var errs ErrorList
+	for i, fpath := range paths {
+		if _, _, ast, err := parser.Compile(fpath, mroPaths, checkSrc); err != nil {
+			errs = append(errs, err)
+		} else {
+			asts[i] = ast
+		}
 	}
+	return asts, errs.If()
 }
@@ -8,6 +8,7 @@ package syntax
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -319,6 +320,73 @@ call SUM_SQUARE_PIPELINE(
 `)
 }
 
+// Tests that the parser can report multiple syntax errors at once.
+func TestBadSyntaxAll(t *testing.T) {
+	t.Parallel()
+	var parser Parser
+	_, _, _, _, err := parser.ParseSourceBytes([]byte(`
+stage SUM_SQUARES(
+    in  float[] values,
+    osut float   sum,
+    src py      "stages/sum_squares",
+)
+
+stage SQUARE(
+    in  int   value,
+    out int   square,
+    src py    "stages/square",
+)
+
+pipeline SUM_SQUARE_PIPELINE(
+    in  float[] values,
+    out float   sum,
+)
+{
+    call SUM_SQUARES(
+        values = self.values
+    )
+    return (
+        sum = SUM_SQUARES.sum,
+    )
+}
+
+call SUM_SQUARE_PIPELINE(
+    values = [1.0, 2.0],
+    values = ,
+)
+`), "bad_syntax.mro", nil, false)
+	if err == nil {
+		t.Fatal("Expected failure to parse, but got success.")
+	}
+	if errs, ok := err.(ErrorList); !ok {
+		t.Errorf("Expected a list of errors, got %v", err)
+	} else if len(errs) != 3 {
+		t.Errorf("Expected 3 errors, got %d:\n%v", len(errs), err)
+	} else {
+		for i, line := range []string{"4", "21", "29"} {
+			if s := errs[i].Error(); !strings.HasSuffix(s, "bad_syntax.mro:"+line) {
+				t.Errorf("Expected error %d on line %s, got\n%s", i, line, s)
+			}
+		}
+	}
+	// The low-level parser should also report all errors.
+	if _, err := yaccParse([]byte(`
+stage SUM_SQUARES(
+    osut float   sum,
+)
+
+stage SQUARE(
+    out int   square
+)
+`), new(SourceFile), makeStringIntern()); err == nil {
+		t.Error("Expected failure to parse, but got success.")
+	} else if errs, ok := err.(ErrorList); !ok {
+		t.Errorf("Expected a list of errors, got %v", err)
+	} else if len(errs) != 2 {
+		t.Errorf("Expected 2 errors, got %d:\n%v", len(errs), err)
+	}
+}
+
 func TestUnusedParam(t *testing.T) {
 	t.Parallel()
 	testBadCompile(t, `
@@ -780,6 +848,48 @@ stage SUM_SQUARES(
 	}
 }
 
+func TestResourcesGPUs(t *testing.T) {
+	t.Parallel()
+	if ast := testGood(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    gpus = 2,
+    mem_gb = 3,
+)
+`); ast != nil {
+		if len(ast.Stages) != 1 {
+			t.Fatalf("Incorrect stage count %d", len(ast.Stages))
+		} else if res := ast.Stages[0].Resources; res == nil {
+			t.Fatal("No resources.")
+		} else {
+			if res.GPUs != 2 {
+				t.Errorf("Expected 2 gpus, saw %d",
+					res.GPUs)
+			}
+			if res.MemGB != 3 {
+				t.Errorf("Expected 3gb, saw %d",
+					res.MemGB)
+			}
+		}
+	}
+}
+
+func TestBadGPUs(t *testing.T) {
+	t.Parallel()
+	testBadGrammar(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    gpus = 0.5,
+)
+`)
+}
+
 func TestStrictVolatile(t *testing.T) {
 	t.Parallel()
 	if ast := testGood(t, `
@@ -851,6 +961,114 @@ stage SUM_SQUARES(
 `)
 }
 
+func TestStageEnv(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    threads = 2,
+) env (
+    OMP_NUM_THREADS = "2",
+    env             = "test",
+)
+`)
+	if ast == nil {
+		return
+	}
+	stage := ast.Callables.Table["SUM_SQUARES"].(*Stage)
+	if stage.Env == nil || len(stage.Env.Vars) != 2 {
+		t.Fatalf("Expected 2 environment variables, got %v", stage.Env)
+	}
+	if v := stage.Env.Vars[0]; v.Key != "OMP_NUM_THREADS" || v.Value != "2" {
+		t.Errorf("Expected OMP_NUM_THREADS=2, got %s=%s", v.Key, v.Value)
+	}
+	msg := testBadCompile(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) env (
+    OMP_NUM_THREADS = "2",
+    OMP_NUM_THREADS = "4",
+)
+`)
+	if !strings.Contains(msg,
+		"DuplicateNameError: environment variable OMP_NUM_THREADS is set more than once for stage SUM_SQUARES") {
+		t.Error("Expected duplicate environment variable error, got " + msg)
+	}
+}
+
+func TestRetainMissing(t *testing.T) {
+	t.Parallel()
+	msg := testBadCompile(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    out file    report,
+    src py      "stages/sum_squares",
+) retain (
+    reprot,
+)
+`)
+	if !strings.Contains(msg,
+		"RetainParamError: stage SUM_SQUARES does not have an out parameter named reprot to retain.") {
+		t.Errorf("Incorrect error %s", msg)
+	}
+}
+
+func TestPipelineRetainMissing(t *testing.T) {
+	t.Parallel()
+	const src = `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    out file    report,
+    src py      "stages/sum_squares",
+)
+
+pipeline SUM(
+    in  float[] values,
+    out float   sum,
+)
+{
+    call SUM_SQUARES(
+        values = self.values,
+    )
+
+    return (
+        sum = SUM_SQUARES.sum,
+    )
+
+    retain (
+        SUM_SQUARES.report,
+    )
+}
+`
+	testGood(t, src)
+	for _, c := range []struct {
+		ref, expect string
+	}{
+		{"SUM_SQUARES.reprot",
+			"NoSuchOutputError: 'reprot' is not an output parameter of 'SUM_SQUARES'"},
+		{"SUM_SQUARE.report",
+			"ScopeNameError: 'SUM_SQUARE' is not called in pipeline 'SUM'"},
+		{"self.value",
+			"ScopeNameError: 'value' is not an input parameter of pipeline 'SUM'"},
+		{"SUM_SQUARES.sum",
+			"RetainParamError: parameter sum of SUM_SQUARES is not of file type."},
+		{"self.values",
+			"RetainParamError: input parameter values of SUM is not of file type."},
+	} {
+		bad := strings.Replace(src, "SUM_SQUARES.report,", c.ref+",", 1)
+		if msg := testBadCompile(t, bad); !strings.Contains(msg, c.expect) {
+			t.Errorf("Expected %q, got %s", c.expect, msg)
+		}
+	}
+}
+
 func TestSplit(t *testing.T) {
 	t.Parallel()
 	testGood(t, `
@@ -1118,6 +1336,75 @@ pipeline QUARTIC(
 `)
 }
 
+func TestBindingTypeMismatch(t *testing.T) {
+	t.Parallel()
+	const src = `
+stage SQUARES(
+    in  int[][] values,
+    in  file    input,
+    in  int[]   extra,
+    out float   square,
+    src py      "stages/square",
+)
+
+pipeline QUARTIC(
+    in  int[] ints,
+    in  file  input,
+    out float quart,
+)
+{
+    call SQUARES(
+        values = [[1], [2, 3]],
+        input  = self.input,
+        extra  = self.ints,
+    )
+    return (
+        quart = SQUARES.square,
+    )
+}
+`
+	testGood(t, src)
+	for _, c := range []struct {
+		old, new, expect string
+	}{
+		{
+			"input  = self.input,", "input  = 1,",
+			"expected type 'file' for 'input' but got 'int' instead",
+		},
+		{
+			"input  = self.input,", "input  = self.ints,",
+			"expected type 'file' for 'input' but got 'int[]' instead",
+		},
+		{
+			"values = [[1], [2, 3]],", "values = self.ints,",
+			"expected type 'int[][]' for 'values' but got 'int[]' instead",
+		},
+		{
+			"values = [[1], [2, 3]],", "values = [[[1]]],",
+			"expected type 'int[][]' for 'values' but got 'int[][][]' instead",
+		},
+		{
+			"values = [[1], [2, 3]],", "values = [[1], [2.5]],",
+			"expected type 'int[][]' for 'values' but got 'float[][]' instead",
+		},
+		{
+			"quart = SQUARES.square,", "quart = [SQUARES.square],",
+			"expected type 'float' for 'quart' but got 'float[]' instead",
+		},
+		{
+			"values = [[1], [2, 3]],", "values = [[1], [[2]]],",
+			"TypeMismatchError: inconsistent array dimensions 1 vs 2",
+		},
+	} {
+		if msg := testBadCompile(t, strings.Replace(src, c.old, c.new, 1)); !strings.Contains(msg, c.expect) {
+			t.Errorf("Expected %q, got %s", c.expect, msg)
+		}
+	}
+	// Nulls and empty arrays can be bound to arrays of any dimension.
+	testGood(t, strings.Replace(src, "values = [[1], [2, 3]],", "values = [],", 1))
+	testGood(t, strings.Replace(src, "values = [[1], [2, 3]],", "values = [[], null, [1]],", 1))
+}
+
 func TestDuplicateInParam(t *testing.T) {
 	t.Parallel()
 	testBadCompile(t, `
@@ -1205,6 +1492,101 @@ pipeline SUM_SQUARES(
 `)
 }
 
+func TestDuplicateCall(t *testing.T) {
+	t.Parallel()
+	msg := testBadCompile(t, `
+stage SQUARE(
+    in  int value,
+    out int square,
+    src py  "stages/square",
+)
+
+pipeline SQUARES(
+    in  int a,
+    out int square,
+)
+{
+    call SQUARE(
+        value = self.a,
+    )
+
+    call SQUARE(
+        value = self.a,
+    )
+
+    return (
+        square = SQUARE.square,
+    )
+}
+`)
+	if !strings.Contains(msg,
+		"DuplicateCallError: 'SQUARE' was already called on line 13") ||
+		!strings.Contains(msg, "at line 17") {
+		t.Errorf("Incorrect error %s", msg)
+	}
+}
+
+func TestDuplicateReturn(t *testing.T) {
+	t.Parallel()
+	msg := testBadCompile(t, `
+stage SQUARE(
+    in  int value,
+    out int square,
+    src py  "stages/square",
+)
+
+pipeline SQUARES(
+    in  int a,
+    out int square,
+)
+{
+    call SQUARE(
+        value = self.a,
+    )
+
+    return (
+        square = SQUARE.square,
+        square = SQUARE.square,
+    )
+}
+`)
+	if !strings.Contains(msg,
+		"DuplicateBinding: 'square' already bound in this return statement on line 18") ||
+		!strings.Contains(msg, "at line 19") {
+		t.Errorf("Incorrect error %s", msg)
+	}
+}
+
+func TestShadowedReturn(t *testing.T) {
+	t.Parallel()
+	msg := testBadCompile(t, `
+stage SQUARE(
+    in  int value,
+    out int square,
+    src py  "stages/square",
+)
+
+pipeline SQUARES(
+    in  int a,
+    out int square,
+)
+{
+    call SQUARE as square(
+        value = self.a,
+    )
+
+    return (
+        square = square.square,
+    )
+}
+`)
+	if !strings.Contains(msg,
+		"ShadowedBindingError: return binding 'square' has the same name as the call on line 13") ||
+		!strings.Contains(msg, "at line 18") {
+		t.Errorf("Incorrect error %s", msg)
+	}
+}
+
 func TestMissingCallable(t *testing.T) {
 	t.Parallel()
 	testBadCompile(t, `
@@ -1503,6 +1885,17 @@ func TestCompileBig(t *testing.T) {
 	testGood(t, fmtTestSrc)
 }
 
+// Tests that compiling an already-compiled AST gives the same result, as
+// happens when a Parser reuses a cached include.
+func TestRecompile(t *testing.T) {
+	t.Parallel()
+	if ast := testGood(t, fmtTestSrc); ast != nil {
+		if err := ast.compile(); err != nil {
+			t.Errorf("Failed to recompile src: %v", err)
+		}
+	}
+}
+
 func TestCheckSrcBad(t *testing.T) {
 	t.Parallel()
 	if ast := testGood(t, `
@@ -1559,3 +1952,466 @@ func BenchmarkParseAndCompile(b *testing.B) {
 		}
 	}
 }
+
+const structTestSrc = `
+filetype txt;
+
+struct POINT(
+    float x,
+    float y,
+)
+
+struct SHAPE(
+    string  name,
+    POINT[] vertices,
+    txt     description  "A text file",
+)
+
+stage DRAW(
+    in  SHAPE   shape,
+    in  SHAPE[] others,
+    out map     info,
+    out POINT   center,
+    src py      "stages/draw",
+)
+
+pipeline DRAW_ALL(
+    in  SHAPE shape,
+    out map   info,
+)
+{
+    call DRAW(
+        shape  = self.shape,
+        others = [
+            {
+                "description": "square.txt",
+                "name": "square",
+                "vertices": [
+                    {
+                        "x": 0,
+                        "y": 0,
+                    },
+                    {
+                        "x": 1,
+                        "y": 1.5,
+                    },
+                ],
+            },
+            null,
+        ],
+    )
+
+    return (
+        info = DRAW.center,
+    )
+}
+`
+
+func TestStructTypes(t *testing.T) {
+	t.Parallel()
+	if ast := testGood(t, structTestSrc); ast != nil {
+		if len(ast.StructTypes) != 2 {
+			t.Errorf("Expected 2 struct types, got %d", len(ast.StructTypes))
+		} else if shape := ast.getStructType("SHAPE"); shape == nil {
+			t.Error("Expected SHAPE to be a struct type.")
+		} else if f := shape.Table["vertices"]; f == nil {
+			t.Error("Expected a vertices field.")
+		} else if f.Tname != "POINT" || f.ArrayDim != 1 {
+			t.Errorf("Expected POINT[], got %s with dim %d",
+				f.Tname, f.ArrayDim)
+		}
+		if param := ast.Stages[0].InParams.Table["shape"]; param.IsFile() {
+			t.Error("Struct-typed parameters are not files.")
+		}
+	}
+}
+
+func TestStructBadField(t *testing.T) {
+	t.Parallel()
+	testBadCompile(t, `
+struct POINT(
+    float x,
+    float x,
+)
+`)
+	testBadCompile(t, `
+struct POINT(
+    float x,
+    vec   y,
+)
+`)
+	testBadCompile(t, `
+struct POINT(
+    float x,
+)
+
+struct POINT(
+    float y,
+)
+`)
+	testBadCompile(t, `
+filetype POINT;
+
+struct POINT(
+    float x,
+)
+`)
+}
+
+func TestStructBadLiteral(t *testing.T) {
+	t.Parallel()
+	const prefix = `
+struct POINT(
+    float x,
+    float y,
+)
+
+stage PLOT(
+    in  POINT point,
+    src py    "stages/plot",
+)
+
+call PLOT(
+    point = `
+	if msg := testBadCompile(t, prefix+`{
+        "x": 1,
+    },
+)
+`); !strings.Contains(msg, "no value given for field 'y'") {
+		t.Errorf("Expected missing field error, got %s", msg)
+	}
+	if msg := testBadCompile(t, prefix+`{
+        "x": 1,
+        "y": 2,
+        "z": 3,
+    },
+)
+`); !strings.Contains(msg, "has no field 'z'") {
+		t.Errorf("Expected extra field error, got %s", msg)
+	}
+	if msg := testBadCompile(t, prefix+`{
+        "x": 1,
+        "y": "2",
+    },
+)
+`); !strings.Contains(msg, "expected type 'float' for field 'y'") {
+		t.Errorf("Expected field type error, got %s", msg)
+	}
+	if msg := testBadCompile(t, prefix+`1,
+)
+`); !strings.Contains(msg, "TypeMismatchError") {
+		t.Errorf("Expected type mismatch error, got %s", msg)
+	}
+}
+
+func TestEnumTypes(t *testing.T) {
+	t.Parallel()
+	const prefix = `
+enum FORMAT(
+    "fastq",
+    "bam",
+    "cram",
+)
+
+stage ALIGN(
+    in  FORMAT   format,
+    in  FORMAT[] others,
+    in  string   name,
+    out FORMAT   out_format,
+    src py       "stages/align",
+)
+
+pipeline ALIGN_ALL(
+    in  FORMAT format,
+    out string out_format,
+)
+{
+    call ALIGN(
+        format = self.format,
+        others = `
+	const suffix = `,
+        name   = ALIGN_PRE.out_format,
+    )
+
+    call ALIGN as ALIGN_PRE(
+        format = "bam",
+        others = [],
+        name   = "pre",
+    )
+
+    return (
+        out_format = ALIGN.out_format,
+    )
+}
+`
+	if ast := testGood(t, prefix+`[
+            "bam",
+            "cram",
+        ]`+suffix); ast != nil {
+		if len(ast.EnumTypes) != 1 {
+			t.Errorf("Expected 1 enum type, got %d", len(ast.EnumTypes))
+		} else if e := ast.EnumTypes[0]; !e.HasValue("cram") || e.HasValue("sam") {
+			t.Error("Incorrect enum values.")
+		}
+	}
+	if msg := testBadCompile(t, prefix+`[
+            "bam",
+            "sam",
+        ]`+suffix); !strings.Contains(msg,
+		"'sam' is not a valid value for enum 'FORMAT'") {
+		t.Errorf("Expected invalid enum value error, got %s", msg)
+	}
+	if msg := testBadCompile(t, prefix+`[1]`+suffix); !strings.Contains(msg,
+		"TypeMismatchError") {
+		t.Errorf("Expected type mismatch error, got %s", msg)
+	}
+	testBadCompile(t, `
+enum FORMAT(
+    "bam",
+    "bam",
+)
+`)
+	testBadCompile(t, `
+enum FORMAT(
+    "bam",
+)
+
+struct FORMAT(
+    int x,
+)
+`)
+	testBadGrammar(t, `
+enum FORMAT()
+`)
+}
+
+func TestDefaultParams(t *testing.T) {
+	t.Parallel()
+	const src = `
+stage SUM(
+    in  int[] values,
+    in  int   offset = 0,
+    in  map   opts   = {"scale": 1.5},
+    out int   sum,
+    src py    "stages/sum",
+)
+
+pipeline SUM_ALL(
+    in  int[] values,
+    in  int   offset = 2,
+    out int   sum,
+)
+{
+    call SUM(
+        values = self.values,
+    )
+
+    call SUM as SUM_OFFSET(
+        values = self.values,
+        offset = self.offset,
+    )
+
+    return (
+        sum = SUM.sum,
+    )
+}
+`
+	if ast := testGood(t, src); ast != nil {
+		call := ast.Pipelines[0].Calls[0]
+		if b := call.Bindings.Table["offset"]; b == nil {
+			t.Error("Expected a binding for the default offset.")
+		} else if v, ok := b.Exp.(*ValExp); !ok || v.Value.(int64) != 0 {
+			t.Errorf("Incorrect default binding %v", b.Exp)
+		} else if b.Tname != KindInt {
+			t.Errorf("Incorrect default binding type %s", b.Tname)
+		}
+		if b := call.Bindings.Table["opts"]; b == nil {
+			t.Error("Expected a binding for the default opts.")
+		}
+		if b := ast.Pipelines[0].Calls[1].Bindings.Table["offset"]; b == nil {
+			t.Error("Expected a binding for the explicit offset.")
+		} else if _, ok := b.Exp.(*RefExp); !ok {
+			t.Error("Explicit binding should not be replaced by the default.")
+		}
+	}
+	if msg := testBadCompile(t, strings.Replace(src,
+		"int   offset = 0,", `int   offset = "zero",`, 1)); !strings.Contains(msg,
+		"TypeMismatchError") {
+		t.Errorf("Expected type mismatch error, got %s", msg)
+	}
+	if msg := testBadCompile(t, strings.Replace(src,
+		"int   offset = 0,", "int   offset = [0],", 1)); !strings.Contains(msg,
+		"TypeMismatchError") {
+		t.Errorf("Expected type mismatch error, got %s", msg)
+	}
+	if msg := testBadCompile(t, strings.Replace(src,
+		"int[] values,\n    in  int   offset = 0,",
+		"int[] values,\n    in  int[] offset = [self.values],", 1)); !strings.Contains(msg,
+		"ReferenceError") {
+		t.Errorf("Expected reference error, got %s", msg)
+	}
+	if msg := testBadCompile(t, strings.Replace(src,
+		"        values = self.values,\n    )\n\n    call SUM as",
+		"    )\n\n    call SUM as", 1)); !strings.Contains(msg,
+		"ArgumentNotSuppliedError: no argument supplied for parameter 'values'") {
+		t.Errorf("Expected missing argument error, got %s", msg)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, os.ErrClosed
+}
+
+func TestParseSourceReader(t *testing.T) {
+	t.Parallel()
+	const src = `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+)
+`
+	expect, _, _, err := ParseSource(src, "test.mro", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted, incs, ast, err := ParseSourceReader(strings.NewReader(src),
+		"test.mro", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted != expect {
+		t.Errorf("Expected\n%s\nGot\n%s", expect, formatted)
+	}
+	if len(incs) != 0 {
+		t.Errorf("Expected no includes, got %v", incs)
+	}
+	if ast == nil || len(ast.Stages) != 1 {
+		t.Error("Expected one stage.")
+	}
+	if _, _, _, err := ParseSourceReader(errReader{},
+		"test.mro", nil, false); err != os.ErrClosed {
+		t.Errorf("Expected read error, got %v", err)
+	}
+}
+
+func TestDeprecatedStage(t *testing.T) {
+	t.Parallel()
+	const src = `
+@deprecated("use SUM instead")
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+)
+
+stage SUM(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum",
+)
+
+pipeline SUM_ALL(
+    in  float[] values,
+    out float   sum,
+)
+{
+    call SUM_SQUARES(
+        values = self.values,
+    )
+
+    call SUM(
+        values = self.values,
+    )
+
+    return (
+        sum = SUM.sum,
+    )
+}
+
+call SUM_SQUARES(
+    values = [1],
+)
+`
+	if ast := testGood(t, src); ast != nil {
+		if d := ast.Stages[0].Deprecated; d != "use SUM instead" {
+			t.Errorf("Expected deprecation message, got %q", d)
+		}
+		if d := ast.Stages[1].Deprecated; d != "" {
+			t.Errorf("Expected no deprecation message, got %q", d)
+		}
+	}
+	var parser Parser
+	_, _, _, warnings, err := parser.ParseSourceBytes([]byte(src),
+		"test.mro", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %d", len(warnings))
+	}
+	for _, w := range warnings {
+		if msg := w.String(); !strings.Contains(msg,
+			"DeprecationWarning: call to deprecated stage 'SUM_SQUARES': use SUM instead") {
+			t.Errorf("Incorrect warning %s", msg)
+		}
+	}
+	if warnings[0].Node.Loc.Line != 20 {
+		t.Errorf("Expected warning on line 20, got %d",
+			warnings[0].Node.Loc.Line)
+	}
+	testBadGrammar(t, `
+@deprecated("use SUM instead")
+pipeline SUM_ALL(
+    in  float[] values,
+    out float   sum,
+)
+{
+    return (
+        sum = null,
+    )
+}
+`)
+}
+
+func TestSourceLocColumns(t *testing.T) {
+	t.Parallel()
+	const src = `# comment
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+)
+`
+	check := func(src, what string, loc SourceLoc, line, col int, token string) {
+		t.Helper()
+		if loc.Line != line {
+			t.Errorf("Expected %s on line %d, got %d", what, line, loc.Line)
+		}
+		if loc.Col != col {
+			t.Errorf("Expected %s at column %d, got %d", what, col, loc.Col)
+		}
+		if loc.Offset > len(src) || !strings.HasPrefix(src[loc.Offset:], token) {
+			t.Errorf("Expected %s at offset %d to start with %q",
+				what, loc.Offset, token)
+		}
+	}
+	if ast := testGood(t, src); ast != nil {
+		stage := ast.Stages[0]
+		check(src, "stage", stage.Node.Loc, 2, 7, "SUM_SQUARES")
+		check(src, "in param", stage.InParams.List[0].Node.Loc, 3, 5, "in ")
+		check(src, "out param", stage.OutParams.List[0].Node.Loc, 4, 5, "out ")
+		check(src, "src", stage.Src.Node.Loc, 5, 5, "src ")
+	}
+	bad := strings.Replace(src, "float   sum", "float   sum sum", 1)
+	if _, err := yaccParse([]byte(bad),
+		new(SourceFile), makeStringIntern()); err == nil {
+		t.Error("Expected a parse error.")
+	} else if lexErr, ok := err.(*mmLexError); !ok {
+		t.Errorf("Expected a parse error, got %v", err)
+	} else {
+		check(bad, "error", lexErr.info.Loc(), 4, 21, "sum,")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Computing source edits for renaming a stage or pipeline.
+
+package syntax
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A FileEdit is a replacement of a range of bytes in a source file.
+type FileEdit struct {
+	// The full path to the file.
+	File string
+
+	// The byte offsets of the start and end (exclusive) of the range to
+	// replace.
+	Start, End int
+
+	// The text with which to replace the range.
+	NewText string
+}
+
+// Rename computes the edits needed to rename the stage or pipeline oldId to
+// newId, in every file which contributed to this AST.  This includes the
+// declaration, every call to it, and, for calls which are not aliased,
+// every reference to the outputs of those calls.
+//
+// The edits are sorted by file and then by offset, and do not overlap.
+// They are not applied; that is left to the caller.
+//
+// The AST must have been compiled.  Returns an error if oldId is not
+// declared, if newId is not a valid identifier, or if newId would collide
+// with an existing stage or pipeline, or with another call in a pipeline
+// which calls oldId without an alias.
+func (global *Ast) Rename(oldId, newId string) ([]FileEdit, error) {
+	callable := global.Callables.Table[oldId]
+	if callable == nil {
+		return nil, fmt.Errorf(
+			"RenameError: '%s' is not a declared stage or pipeline", oldId)
+	}
+	if tok, val := nextToken([]byte(newId)); tok != ID || len(val) != len(newId) {
+		return nil, fmt.Errorf(
+			"RenameError: '%s' is not a valid identifier", newId)
+	}
+	if other := global.Callables.Table[newId]; other != nil {
+		return nil, global.err(other,
+			"RenameError: %s '%s' is already declared",
+			other.Type(), newId)
+	}
+
+	var errs ErrorList
+	edits := make(map[FileEdit]struct{})
+	addEdit := func(node AstNodable, loc *SourceLoc, id string) {
+		if loc.File == nil || loc.Col == 0 {
+			errs = append(errs, global.err(node,
+				"RenameError: location of '%s' is unknown", id))
+			return
+		}
+		edits[FileEdit{
+			File:    loc.File.FullPath,
+			Start:   loc.Offset,
+			End:     loc.Offset + len(id),
+			NewText: newId,
+		}] = struct{}{}
+	}
+
+	switch c := callable.(type) {
+	case *Stage:
+		addEdit(c, &c.idLoc, oldId)
+	case *Pipeline:
+		addEdit(c, &c.Node.Loc, oldId)
+	}
+	for _, pipeline := range global.Pipelines {
+		for _, call := range pipeline.Calls {
+			if call.genericId() != oldId {
+				continue
+			}
+			addEdit(call, &call.decLoc, oldId)
+			if call.Id != oldId {
+				// Aliased, so references are unaffected.
+				continue
+			}
+			if other := findCall(pipeline, newId); other != nil {
+				errs = append(errs, global.err(other,
+					"RenameError: pipeline %s already has a call named '%s'",
+					pipeline.Id, newId))
+				continue
+			}
+			Inspect(pipeline, func(n AstNodable) bool {
+				if ref, ok := n.(*RefExp); ok &&
+					ref.Kind == KindCall && ref.Id == oldId &&
+					ref.File() == pipeline.File() {
+					addEdit(ref, &ref.Node.Loc, oldId)
+				}
+				return true
+			})
+		}
+	}
+	if global.Call != nil && global.Call.genericId() == oldId {
+		addEdit(global.Call, &global.Call.decLoc, oldId)
+	}
+	if err := errs.If(); err != nil {
+		return nil, err
+	}
+
+	result := make([]FileEdit, 0, len(edits))
+	for edit := range edits {
+		result = append(result, edit)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].File != result[j].File {
+			return result[i].File < result[j].File
+		}
+		return result[i].Start < result[j].Start
+	})
+	return result, nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"strings"
+	"testing"
+)
+
+const renameTestSrc = `
+filetype txt;
+
+@deprecated("use something else")
+stage SQUARE(
+    in  int  value,
+    out int  square,
+    out bool skip,
+    out txt  report,
+    src py   "stages/square",
+)
+
+pipeline SUM_SQUARES(
+    in  int a,
+    out int sum,
+    out int square,
+)
+{
+    call SQUARE(
+        value = self.a,
+    )
+
+    call SQUARE as SQUARE_B(
+        value = SQUARE.square,
+    ) using (
+        disabled = SQUARE.skip,
+    )
+
+    return (
+        sum    = SQUARE_B.square,
+        square = SQUARE.square,
+    )
+
+    retain (
+        SQUARE.report,
+    )
+}
+
+call SQUARE(
+    value = 1,
+)
+`
+
+func parseRenameTest(t *testing.T, src string) *Ast {
+	t.Helper()
+	ast, err := yaccParse([]byte(src), &SourceFile{
+		FileName: "rename.mro",
+		FullPath: "/path/to/rename.mro",
+	}, makeStringIntern())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ast.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return ast
+}
+
+func TestRename(t *testing.T) {
+	t.Parallel()
+	ast := parseRenameTest(t, renameTestSrc)
+	edits, err := ast.Rename("SQUARE", "SQUARE_A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Declaration, 3 calls, and 4 references.
+	if len(edits) != 8 {
+		t.Errorf("Expected 8 edits, got %d", len(edits))
+	}
+	src := renameTestSrc
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		if edit.File != "/path/to/rename.mro" {
+			t.Errorf("Incorrect file %s", edit.File)
+		}
+		if old := src[edit.Start:edit.End]; old != "SQUARE" {
+			t.Errorf("Expected to replace SQUARE, found %q", old)
+		}
+		src = src[:edit.Start] + edit.NewText + src[edit.End:]
+	}
+	expect := strings.Replace(renameTestSrc, "SQUARE.", "SQUARE_A.", -1)
+	expect = strings.Replace(expect, "stage SQUARE(", "stage SQUARE_A(", 1)
+	expect = strings.Replace(expect, "call SQUARE", "call SQUARE_A", -1)
+	if src != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, src)
+	}
+	renamed := parseRenameTest(t, src)
+	if renamed.Callables.Table["SQUARE_A"] == nil {
+		t.Error("Expected SQUARE_A to be declared.")
+	}
+}
+
+func TestRenameErrors(t *testing.T) {
+	t.Parallel()
+	ast := parseRenameTest(t, renameTestSrc)
+	if _, err := ast.Rename("MISSING", "OTHER"); err == nil {
+		t.Error("Expected an error renaming an undeclared stage.")
+	}
+	if _, err := ast.Rename("SQUARE", "SUM_SQUARES"); err == nil {
+		t.Error("Expected an error renaming to an existing pipeline.")
+	}
+	if _, err := ast.Rename("SQUARE", "SQUARE_B"); err == nil {
+		t.Error("Expected an error renaming to an existing call.")
+	}
+	for _, bad := range []string{"call", "9LIVES", "A.B", ""} {
+		if _, err := ast.Rename("SQUARE", bad); err == nil {
+			t.Errorf("Expected an error renaming to %q.", bad)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Resolution of identifiers in the source to their declarations.
+
+package syntax
+
+// ResolveAt returns the declaration of the identifier at the given position
+// in the given file, which may be either the full path or the name of the
+// file as it was included.  The line and column are both 1-based, and the
+// column is measured in bytes.
+//
+// The following identifiers can be resolved:
+//
+// The callable name in a call statement resolves to the Stage or Pipeline.
+//
+// The parameter name in a call binding resolves to the InParam of the called
+// stage or pipeline, and in a return binding to the pipeline's OutParam.
+//
+// In a reference to a call output, the call name resolves to the CallStm in
+// the pipeline, and the output name to the OutParam of the called stage or
+// pipeline.  In a reference to a pipeline input, the input name resolves to
+// the pipeline's InParam.
+//
+// The AST must have been compiled.  Returns false if there is no resolvable
+// identifier at the given position.
+func (global *Ast) ResolveAt(file string, line, col int) (AstNodable, bool) {
+	pos := sourcePos{file: file, line: line, col: col}
+	for _, pipeline := range global.Pipelines {
+		if !pos.inFile(pipeline.File()) {
+			continue
+		}
+		for _, call := range pipeline.Calls {
+			if dec, ok := global.resolveInCall(pos, pipeline, call); ok {
+				return dec, true
+			}
+		}
+		if pipeline.Ret != nil && pipeline.Ret.Bindings != nil {
+			for _, binding := range pipeline.Ret.Bindings.List {
+				if pos.at(&binding.Node.Loc, binding.Id) {
+					return paramDec(pipeline.OutParams.Table[binding.Id])
+				}
+				if dec, ok := global.resolveInExp(pos, pipeline,
+					binding.Exp); ok {
+					return dec, true
+				}
+			}
+		}
+		if pipeline.Retain != nil {
+			for _, ref := range pipeline.Retain.Refs {
+				if dec, ok := global.resolveInExp(pos, pipeline, ref); ok {
+					return dec, true
+				}
+			}
+		}
+	}
+	if global.Call != nil && pos.inFile(global.Call.File()) {
+		return global.resolveInCall(pos, nil, global.Call)
+	}
+	return nil, false
+}
+
+// A position in a source file.
+type sourcePos struct {
+	file      string
+	line, col int
+}
+
+func (pos *sourcePos) inFile(f *SourceFile) bool {
+	return f != nil && (f.FullPath == pos.file || f.FileName == pos.file)
+}
+
+// Returns true if the position falls within the given identifier, which
+// begins at the given location.
+func (pos *sourcePos) at(loc *SourceLoc, id string) bool {
+	return pos.atOffset(loc, 0, id)
+}
+
+// Returns true if the position falls within the given identifier, which
+// begins the given number of bytes after the given location.
+func (pos *sourcePos) atOffset(loc *SourceLoc, offset int, id string) bool {
+	if loc.Line != pos.line || loc.Col == 0 || !pos.inFile(loc.File) {
+		return false
+	}
+	start := loc.Col + offset
+	return pos.col >= start && pos.col < start+len(id)
+}
+
+// Converts a possibly-nil parameter into a declaration result.
+func paramDec(param Param) (AstNodable, bool) {
+	switch p := param.(type) {
+	case *InParam:
+		if p != nil {
+			return p, true
+		}
+	case *OutParam:
+		if p != nil {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Resolve identifiers in a call statement.  The pipeline is nil for the
+// top-level call.
+func (global *Ast) resolveInCall(pos sourcePos,
+	pipeline *Pipeline, call *CallStm) (AstNodable, bool) {
+	callable := global.Callables.Table[call.DecId]
+	if id := call.genericId(); pos.at(&call.decLoc, id) {
+		// For generic pipelines, this is the generic declaration rather
+		// than the instance.
+		if dec := global.Callables.Table[id]; dec != nil {
+			return dec, true
+		}
+		return nil, false
+	}
+	if call.Bindings != nil {
+		for _, binding := range call.Bindings.List {
+			if pos.at(&binding.Node.Loc, binding.Id) {
+				if callable == nil {
+					return nil, false
+				}
+				return paramDec(callable.GetInParams().Table[binding.Id])
+			}
+			if dec, ok := global.resolveInExp(pos, pipeline,
+				binding.Exp); ok {
+				return dec, true
+			}
+		}
+	}
+	if call.Modifiers != nil && call.Modifiers.Bindings != nil {
+		for _, binding := range call.Modifiers.Bindings.List {
+			if dec, ok := global.resolveInExp(pos, pipeline,
+				binding.Exp); ok {
+				return dec, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Resolve references within an expression in the given pipeline.
+func (global *Ast) resolveInExp(pos sourcePos,
+	pipeline *Pipeline, exp Exp) (AstNodable, bool) {
+	if pipeline == nil {
+		return nil, false
+	}
+	switch exp := exp.(type) {
+	case *RefExp:
+		return global.resolveRef(pos, pipeline, exp)
+	case *ValExp:
+		switch exp.Kind {
+		case KindArray:
+			if arr, ok := exp.Value.([]Exp); ok {
+				for _, e := range arr {
+					if dec, ok := global.resolveInExp(pos, pipeline, e); ok {
+						return dec, true
+					}
+				}
+			}
+		case KindMap:
+			if m, ok := exp.Value.(map[string]Exp); ok {
+				for _, e := range m {
+					if dec, ok := global.resolveInExp(pos, pipeline, e); ok {
+						return dec, true
+					}
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+func (global *Ast) resolveRef(pos sourcePos,
+	pipeline *Pipeline, ref *RefExp) (AstNodable, bool) {
+	if ref.Kind == KindSelf {
+		if pos.atOffset(&ref.Node.Loc, len("self."), ref.Id) {
+			return paramDec(pipeline.InParams.Table[ref.Id])
+		}
+		return nil, false
+	}
+	call := findCall(pipeline, ref.Id)
+	if call == nil {
+		return nil, false
+	}
+	if pos.at(&ref.Node.Loc, ref.Id) {
+		return call, true
+	}
+	if ref.OutputId != default_out_name &&
+		pos.atOffset(&ref.Node.Loc, len(ref.Id)+1, ref.OutputId) {
+		return global.outputDec(call, ref.OutputId)
+	}
+	return nil, false
+}
+
+func findCall(pipeline *Pipeline, id string) *CallStm {
+	for _, call := range pipeline.Calls {
+		if call.Id == id {
+			return call
+		}
+	}
+	return nil
+}
+
+// Get the declaration of the given output of the callable for a call.
+func (global *Ast) outputDec(call *CallStm, id string) (AstNodable, bool) {
+	if callable := global.Callables.Table[call.DecId]; callable != nil {
+		return paramDec(callable.GetOutParams().Table[id])
+	}
+	return nil, false
+}
+
+// NodeAt returns the node at the given position in the given file, which
+// may be either the full path or the name of the file as it was included.
+// The line and column are both 1-based, and the column is measured in
+// bytes.
+//
+// Only the starting position of each node is known, so this is the node
+// which starts closest to the position without being after it.  If several
+// nodes start at the same position, the outermost is returned.  Returns nil
+// if no node in the file starts at or before the position.
+func (global *Ast) NodeAt(file string, line, col int) AstNodable {
+	pos := sourcePos{file: file, line: line, col: col}
+	var best AstNodable
+	var bestLoc *SourceLoc
+	InspectAst(global, func(n AstNodable) bool {
+		if n == nil {
+			return false
+		}
+		loc := &n.getNode().Loc
+		if !pos.inFile(loc.File) {
+			// Values bound from default parameters in another file
+			// may appear in a call.  Their nodes are not part of the
+			// call's source.
+			return false
+		}
+		if loc.Line > line || loc.Line == line && loc.Col > col {
+			return false
+		}
+		if bestLoc == nil || loc.Line > bestLoc.Line ||
+			loc.Line == bestLoc.Line && loc.Col > bestLoc.Col {
+			best, bestLoc = n, loc
+		}
+		return true
+	})
+	return best
+}
+
+// Declaration returns the declaration referred to by a reference within
+// one of the pipelines in the AST.  For a reference to a pipeline input,
+// this is the pipeline's InParam.  For a reference to a call output, this
+// is the OutParam of the called stage or pipeline.
+//
+// The AST must have been compiled.  Returns nil if the reference is not
+// part of this AST or its declaration cannot be found.
+func (global *Ast) Declaration(ref *RefExp) AstNodable {
+	for _, pipeline := range global.Pipelines {
+		found := false
+		Inspect(pipeline, func(n AstNodable) bool {
+			if r, ok := n.(*RefExp); ok && r == ref {
+				found = true
+			}
+			return !found
+		})
+		if !found {
+			continue
+		}
+		var dec AstNodable
+		if ref.Kind == KindSelf {
+			dec, _ = paramDec(pipeline.InParams.Table[ref.Id])
+		} else if call := findCall(pipeline, ref.Id); call != nil {
+			dec, _ = global.outputDec(call, ref.OutputId)
+		}
+		return dec
+	}
+	return nil
+}
+
+// NodeAt returns the node at the given position in the AST most recently
+// parsed by this parser.  See Ast.NodeAt.
+func (parser *Parser) NodeAt(file string, line, col int) AstNodable {
+	if parser == nil || parser.ast == nil {
+		return nil
+	}
+	return parser.ast.NodeAt(file, line, col)
+}
+
+// Declaration returns the declaration referred to by a reference in the AST
+// most recently parsed by this parser.  See Ast.Declaration.
+func (parser *Parser) Declaration(ref *RefExp) AstNodable {
+	if parser == nil || parser.ast == nil {
+		return nil
+	}
+	return parser.ast.Declaration(ref)
+}
+
+// ReferencesTo returns every call to the stage or pipeline with the given
+// Id, including aliased calls, preflight calls, and the top-level call, in
+// declaration order.  The location of each call site is available through
+// its Node.
+//
+// Bindings elsewhere in a pipeline refer to a call by the call's own Id,
+// so the returned calls also identify the targets of any references in
+// bindings, return statements, and retains.
+func (global *Ast) ReferencesTo(decId string) []*CallStm {
+	var calls []*CallStm
+	for _, pipeline := range global.Pipelines {
+		for _, call := range pipeline.Calls {
+			if call.genericId() == decId {
+				calls = append(calls, call)
+			}
+		}
+	}
+	if global.Call != nil && global.Call.genericId() == decId {
+		calls = append(calls, global.Call)
+	}
+	return calls
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const resolveTestSrc = `
+stage SQUARE(
+    in  int value,
+    out int square,
+    src py  "stages/square",
+)
+
+pipeline SUM_SQUARES(
+    in  int a,
+    out int sum,
+)
+{
+    call local SQUARE as SQ(
+        value = self.a,
+    )
+
+    return (
+        sum = SQ.square,
+    )
+}
+
+call SUM_SQUARES(
+    a = 1,
+)
+`
+
+// Find the line and column of the given offset within the nth occurrence of
+// the given substring in the source.
+func findPos(t *testing.T, src, substr string, n, offset int) (int, int) {
+	t.Helper()
+	idx := -1
+	for i := 0; i <= n; i++ {
+		next := strings.Index(src[idx+1:], substr)
+		if next < 0 {
+			t.Fatalf("%q occurrence %d not found", substr, n)
+		}
+		idx += next + 1
+	}
+	idx += offset
+	line := 1 + strings.Count(src[:idx], "\n")
+	col := idx - strings.LastIndex(src[:idx], "\n")
+	return line, col
+}
+
+func TestResolveAt(t *testing.T) {
+	t.Parallel()
+	file := &SourceFile{
+		FileName: "test.mro",
+		FullPath: "/path/to/test.mro",
+	}
+	ast, err := yaccParse([]byte(resolveTestSrc), file, makeStringIntern())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ast.compile(); err != nil {
+		t.Fatal(err)
+	}
+	check := func(substr string, n, offset int, expect AstNodable) {
+		t.Helper()
+		line, col := findPos(t, resolveTestSrc, substr, n, offset)
+		dec, ok := ast.ResolveAt("test.mro", line, col)
+		if expect == nil {
+			if ok {
+				t.Errorf("Expected nothing at %q, got %T", substr, dec)
+			}
+		} else if !ok {
+			t.Errorf("Expected %T at %q, found nothing", expect, substr)
+		} else if dec != expect {
+			t.Errorf("Expected %T at %q, got %T", expect, substr, dec)
+		}
+	}
+	stage := ast.Stages[0]
+	pipeline := ast.Pipelines[0]
+	call := pipeline.Calls[0]
+	check("SQUARE as", 0, 0, stage)
+	check("SQUARE as", 0, 5, stage)
+	check("SQUARE as", 0, 6, nil)
+	check("SQ(", 0, 0, nil)
+	check("value =", 0, 2, stage.InParams.Table["value"])
+	check("self.a", 0, 5, pipeline.InParams.Table["a"])
+	check("self.a", 0, 0, nil)
+	check("sum =", 0, 0, pipeline.OutParams.Table["sum"])
+	check("SQ.square", 0, 1, call)
+	check("SQ.square", 0, 2, nil)
+	check("SQ.square", 0, 8, stage.OutParams.Table["square"])
+	check("SUM_SQUARES(", 1, 3, pipeline)
+	check("a = 1", 0, 0, pipeline.InParams.Table["a"])
+	check("a = 1", 0, 4, nil)
+
+	line, col := findPos(t, resolveTestSrc, "SQUARE as", 0, 0)
+	if _, ok := ast.ResolveAt("/path/to/test.mro", line, col); !ok {
+		t.Error("Expected to resolve using the full path.")
+	}
+	if _, ok := ast.ResolveAt("other.mro", line, col); ok {
+		t.Error("Expected nothing in a different file.")
+	}
+}
+
+func TestReferencesTo(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, `
+stage SQUARE(
+    in  int value,
+    out int square,
+    src py  "stages/square",
+)
+
+stage CHECK(
+    in  int value,
+    src py  "stages/check",
+)
+
+pipeline SUM_SQUARES(
+    in  int a,
+    in  int b,
+    out int sum,
+)
+{
+    call CHECK(
+        value = self.a,
+    ) using (
+        preflight = true,
+    )
+
+    call SQUARE as SQUARE_A(
+        value = self.a,
+    )
+
+    call SQUARE as SQUARE_B(
+        value = self.b,
+    )
+
+    return (
+        sum = SQUARE_B.square,
+    )
+}
+
+pipeline SQUARE_TWICE(
+    in  int a,
+    out int sum,
+)
+{
+    call SQUARE(
+        value = self.a,
+    )
+
+    call SUM_SQUARES(
+        a = SQUARE.square,
+        b = self.a,
+    )
+
+    return (
+        sum = SUM_SQUARES.sum,
+    )
+}
+
+call SQUARE_TWICE(
+    a = 1,
+)
+`)
+	if ast == nil {
+		return
+	}
+	check := func(decId string, expect ...string) {
+		t.Helper()
+		calls := ast.ReferencesTo(decId)
+		ids := make([]string, len(calls))
+		for i, call := range calls {
+			ids[i] = call.Id
+		}
+		if len(ids) != len(expect) {
+			t.Errorf("Expected calls %v to %s, got %v", expect, decId, ids)
+			return
+		}
+		for i, id := range ids {
+			if id != expect[i] {
+				t.Errorf("Expected calls %v to %s, got %v", expect, decId, ids)
+				return
+			}
+		}
+	}
+	check("SQUARE", "SQUARE_A", "SQUARE_B", "SQUARE")
+	check("CHECK", "CHECK")
+	check("SUM_SQUARES", "SUM_SQUARES")
+	check("SQUARE_TWICE", "SQUARE_TWICE")
+	check("MISSING")
+	if calls := ast.ReferencesTo("SQUARE"); calls[0].Node.Loc.Line != 25 {
+		t.Errorf("Expected the first call on line 25, found %d",
+			calls[0].Node.Loc.Line)
+	}
+}
+
+func TestParserNodeAt(t *testing.T) {
+	var parser Parser
+	if parser.NodeAt("wildcard.mro", 16, 20) != nil {
+		t.Error("Expected no node before parsing.")
+	}
+	if _, _, _, err := parser.Compile("testdata/wildcard.mro", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	node := parser.NodeAt("wildcard.mro", 16, 20)
+	ref, ok := node.(*RefExp)
+	if !ok {
+		t.Fatalf("Expected a reference, got %T", node)
+	}
+	if ref.Id != "STAGE_A" || ref.OutputId != "result" {
+		t.Errorf("Incorrect reference %s.%s", ref.Id, ref.OutputId)
+	}
+	dec := parser.Declaration(ref)
+	if param, ok := dec.(*OutParam); !ok {
+		t.Errorf("Expected an output parameter, got %T", dec)
+	} else if param.Id != "result" {
+		t.Errorf("Incorrect parameter %s", param.Id)
+	} else if name := filepath.Base(param.File().FullPath); name != "stage_a.mro" {
+		t.Errorf("Expected declaration in stage_a.mro, found %s", name)
+	}
+
+	// The start of the line precedes any node on it, so the result is the
+	// last node on the previous line.
+	if n, ok := parser.NodeAt("wildcard.mro", 16, 1).(*BindStms); !ok {
+		t.Errorf("Expected call bindings, got %T", n)
+	}
+	if n, ok := parser.NodeAt("wildcard.mro", 15, 10).(*CallStm); !ok {
+		t.Errorf("Expected a call, got %T", n)
+	} else if n.Id != "STAGE_B" {
+		t.Errorf("Expected STAGE_B, got %s", n.Id)
+	}
+	if n := parser.NodeAt("wildcard.mro", 1, 1); n != nil {
+		t.Errorf("Expected nothing in the leading comment, got %T", n)
+	}
+	if d := parser.Declaration(&RefExp{Kind: KindSelf, Id: "value"}); d != nil {
+		t.Errorf("Expected no declaration for a foreign reference, got %T", d)
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Structured comparison of compiled ASTs.
+
+package syntax
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The kind of difference described by a SemanticChange.
+type ChangeKind string
+
+const (
+	// A stage or pipeline was declared in the new AST but not the old one.
+	ChangeCallableAdded ChangeKind = "callable added"
+	// A stage or pipeline was declared in the old AST but not the new one.
+	ChangeCallableRemoved = "callable removed"
+	// A stage changed whether it splits.
+	ChangeSplit = "split changed"
+	// A stage's source code location or language changed.
+	ChangeSrc = "src changed"
+	// A stage's resource requirements changed.
+	ChangeResources = "resources changed"
+	// An environment variable set by a stage was added, removed, or changed.
+	ChangeEnv = "env changed"
+	// A parameter was added to a stage or pipeline.
+	ChangeParamAdded = "param added"
+	// A parameter was removed from a stage or pipeline.
+	ChangeParamRemoved = "param removed"
+	// A parameter's type changed.
+	ChangeParamType = "param type changed"
+	// An input parameter's default value changed.
+	ChangeParamDefault = "param default changed"
+	// An output parameter's output file name changed.
+	ChangeParamOutName = "param out name changed"
+	// A call was added to a pipeline.
+	ChangeCallAdded = "call added"
+	// A call was removed from a pipeline.
+	ChangeCallRemoved = "call removed"
+	// A call (possibly aliased) now refers to a different callable.
+	ChangeCallTarget = "call target changed"
+	// A call modifier, e.g. local or disabled, changed.
+	ChangeModifier = "modifier changed"
+	// A call or return binding was added.
+	ChangeBindingAdded = "binding added"
+	// A call or return binding was removed.
+	ChangeBindingRemoved = "binding removed"
+	// The value bound to a call or return binding changed.
+	ChangeBinding = "binding changed"
+)
+
+// A SemanticChange describes one logical difference between two compiled
+// ASTs.
+type SemanticChange struct {
+	Kind ChangeKind
+
+	// The location of the change, as a dot-separated path starting with
+	// the Id of the stage or pipeline, e.g. "PIPELINE.CALL.param".
+	// Modifiers and resources are under "using", and return bindings
+	// under "return".  Changes to the top-level call start with
+	// "call".
+	Path string
+
+	// A representation of the old and new values, if applicable.
+	Old string `json:",omitempty"`
+	New string `json:",omitempty"`
+
+	// True if the change would cause an existing pipestance to be
+	// incompatible with the new AST.
+	Breaking bool
+}
+
+func (change *SemanticChange) String() string {
+	var buf strings.Builder
+	if change.Breaking {
+		buf.WriteString("BREAKING: ")
+	}
+	buf.WriteString(change.Path)
+	buf.WriteString(": ")
+	buf.WriteString(string(change.Kind))
+	if change.Old != "" || change.New != "" {
+		fmt.Fprintf(&buf, " (%s -> %s)", change.Old, change.New)
+	}
+	return buf.String()
+}
+
+// Diff returns the list of semantic changes between this AST and another.
+// Both ASTs must have been compiled.
+//
+// Changes which only affect formatting, comments, or the files in which
+// things are declared are not reported.  Changes to file type names are
+// reported, but are not breaking.  Changes to resources, stage source,
+// deprecation messages, and volatility are likewise not breaking.
+//
+// Unlike EquivalentCall, all declared stages and pipelines are compared,
+// not just those reachable from the top-level call.
+func (ast *Ast) Diff(other *Ast) []SemanticChange {
+	var d differ
+	for _, callable := range ast.Callables.List {
+		if oc := other.Callables.Table[callable.GetId()]; oc == nil {
+			d.add(ChangeCallableRemoved, callable.GetId(), "", "", true)
+		} else {
+			d.diffCallable(callable, oc)
+		}
+	}
+	for _, callable := range other.Callables.List {
+		if ast.Callables.Table[callable.GetId()] == nil {
+			d.add(ChangeCallableAdded, callable.GetId(), "", "", false)
+		}
+	}
+	if ast.Call != nil || other.Call != nil {
+		d.diffCallLists("call", []*CallStm{ast.Call}, []*CallStm{other.Call})
+	}
+	return d.changes
+}
+
+type differ struct {
+	changes []SemanticChange
+}
+
+func (d *differ) add(kind ChangeKind, path, old, new string, breaking bool) {
+	d.changes = append(d.changes, SemanticChange{
+		Kind:     kind,
+		Path:     path,
+		Old:      old,
+		New:      new,
+		Breaking: breaking,
+	})
+}
+
+func (d *differ) diffCallable(callable, other Callable) {
+	id := callable.GetId()
+	if callable.Type() != other.Type() {
+		d.add(ChangeCallableRemoved, id, callable.Type(), "", true)
+		d.add(ChangeCallableAdded, id, "", other.Type(), false)
+		return
+	}
+	d.diffInParams(id, callable.GetInParams(), other.GetInParams())
+	switch c := callable.(type) {
+	case *Stage:
+		d.diffOutParams(id, c.OutParams, other.GetOutParams(), false)
+		d.diffStage(c, other.(*Stage))
+	case *Pipeline:
+		d.diffOutParams(id, c.OutParams, other.GetOutParams(), true)
+		d.diffPipeline(c, other.(*Pipeline))
+	}
+}
+
+func (d *differ) diffStage(stage, other *Stage) {
+	if stage.Split != other.Split {
+		d.add(ChangeSplit, stage.Id,
+			fmt.Sprint(stage.Split), fmt.Sprint(other.Split), true)
+	}
+	if src, osrc := srcString(stage.Src), srcString(other.Src); src != osrc {
+		d.add(ChangeSrc, stage.Id, src, osrc, false)
+	}
+	var res, ores Resources
+	if stage.Resources != nil {
+		res = *stage.Resources
+	}
+	if other.Resources != nil {
+		ores = *other.Resources
+	}
+	path := stage.Id + ".using."
+	if res.Threads != ores.Threads {
+		d.add(ChangeResources, path+"threads",
+			fmt.Sprint(res.Threads), fmt.Sprint(ores.Threads), false)
+	}
+	if res.MemGB != ores.MemGB {
+		d.add(ChangeResources, path+"mem_gb",
+			fmt.Sprint(res.MemGB), fmt.Sprint(ores.MemGB), false)
+	}
+	if res.GPUs != ores.GPUs {
+		d.add(ChangeResources, path+"gpus",
+			fmt.Sprint(res.GPUs), fmt.Sprint(ores.GPUs), false)
+	}
+	if res.Timeout != ores.Timeout {
+		d.add(ChangeResources, path+"timeout",
+			fmt.Sprint(res.Timeout), fmt.Sprint(ores.Timeout), false)
+	}
+	if res.Retries != ores.Retries {
+		d.add(ChangeResources, path+"retries",
+			fmt.Sprint(res.Retries), fmt.Sprint(ores.Retries), false)
+	}
+	if res.DiskGB != ores.DiskGB {
+		d.add(ChangeResources, path+"disk_space_gb",
+			fmt.Sprint(res.DiskGB), fmt.Sprint(ores.DiskGB), false)
+	}
+	if res.Priority != ores.Priority {
+		d.add(ChangeResources, path+"priority",
+			fmt.Sprint(res.Priority), fmt.Sprint(ores.Priority), false)
+	}
+	if res.Special != ores.Special {
+		d.add(ChangeResources, path+"special",
+			res.Special, ores.Special, false)
+	}
+	if res.StrictVolatile != ores.StrictVolatile {
+		d.add(ChangeResources, path+"volatile",
+			fmt.Sprint(res.StrictVolatile), fmt.Sprint(ores.StrictVolatile),
+			false)
+	}
+	d.diffEnv(stage.Id+".env.", stage.Env, other.Env)
+}
+
+func (d *differ) diffEnv(path string, env, other *StageEnv) {
+	vars, ovars := envMap(env), envMap(other)
+	keys := make([]string, 0, len(vars)+len(ovars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	for key := range ovars {
+		if _, ok := vars[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v, ok := vars[key]
+		ov, ook := ovars[key]
+		if v != ov || ok != ook {
+			d.add(ChangeEnv, path+key, v, ov, false)
+		}
+	}
+}
+
+func envMap(env *StageEnv) map[string]string {
+	if env == nil {
+		return nil
+	}
+	vars := make(map[string]string, len(env.Vars))
+	for _, v := range env.Vars {
+		vars[v.Key] = v.Value
+	}
+	return vars
+}
+
+func srcString(src *SrcParam) string {
+	if src == nil {
+		return ""
+	}
+	parts := []string{string(src.Lang)}
+	if src.Image != "" {
+		parts = append(parts, src.Image)
+	}
+	return strings.Join(append(append(parts, src.Path),
+		src.Args...), " ")
+}
+
+func (d *differ) diffPipeline(pipeline, other *Pipeline) {
+	d.diffCallLists(pipeline.Id, pipeline.Calls, other.Calls)
+	var ret, oret *BindStms
+	if pipeline.Ret != nil {
+		ret = pipeline.Ret.Bindings
+	}
+	if other.Ret != nil {
+		oret = other.Ret.Bindings
+	}
+	d.diffBindings(pipeline.Id+".return", ret, oret)
+}
+
+func (d *differ) diffCallLists(prefix string, calls, other []*CallStm) {
+	otherCalls := make(map[string]*CallStm, len(other))
+	for _, call := range other {
+		if call != nil {
+			otherCalls[call.Id] = call
+		}
+	}
+	myCalls := make(map[string]struct{}, len(calls))
+	for _, call := range calls {
+		if call == nil {
+			continue
+		}
+		myCalls[call.Id] = struct{}{}
+		if oc := otherCalls[call.Id]; oc == nil {
+			d.add(ChangeCallRemoved, prefix+"."+call.Id, "", "", true)
+		} else {
+			d.diffCall(prefix+"."+call.Id, call, oc)
+		}
+	}
+	for _, call := range other {
+		if call == nil {
+			continue
+		}
+		if _, ok := myCalls[call.Id]; !ok {
+			d.add(ChangeCallAdded, prefix+"."+call.Id, "", "", true)
+		}
+	}
+}
+
+func (d *differ) diffCall(path string, call, other *CallStm) {
+	if call.DecId != other.DecId {
+		d.add(ChangeCallTarget, path, call.DecId, other.DecId, true)
+	}
+	d.diffBindings(path, call.Bindings, other.Bindings)
+	var mods, omods Modifiers
+	if call.Modifiers != nil {
+		mods = *call.Modifiers
+	}
+	if other.Modifiers != nil {
+		omods = *other.Modifiers
+	}
+	if mods.Local != omods.Local {
+		d.add(ChangeModifier, path+".using.local",
+			fmt.Sprint(mods.Local), fmt.Sprint(omods.Local), true)
+	}
+	if mods.Preflight != omods.Preflight {
+		d.add(ChangeModifier, path+".using.preflight",
+			fmt.Sprint(mods.Preflight), fmt.Sprint(omods.Preflight), true)
+	}
+	if mods.Volatile != omods.Volatile {
+		d.add(ChangeModifier, path+".using.volatile",
+			fmt.Sprint(mods.Volatile), fmt.Sprint(omods.Volatile), false)
+	}
+	var dis, odis *BindStm
+	if mods.Bindings != nil && mods.Bindings.Table != nil {
+		dis = mods.Bindings.Table[disabled]
+	}
+	if omods.Bindings != nil && omods.Bindings.Table != nil {
+		odis = omods.Bindings.Table[disabled]
+	}
+	if v, ov := bindingString(dis), bindingString(odis); v != ov {
+		d.add(ChangeModifier, path+".using."+disabled, v, ov, true)
+	}
+}
+
+func (d *differ) diffBindings(path string, bindings, other *BindStms) {
+	var list, olist []*BindStm
+	if bindings != nil {
+		list = bindings.List
+	}
+	if other != nil {
+		olist = other.List
+	}
+	otherBindings := make(map[string]*BindStm, len(olist))
+	for _, b := range olist {
+		otherBindings[b.Id] = b
+	}
+	myBindings := make(map[string]struct{}, len(list))
+	for _, b := range list {
+		myBindings[b.Id] = struct{}{}
+		if ob := otherBindings[b.Id]; ob == nil {
+			d.add(ChangeBindingRemoved, path+"."+b.Id,
+				bindingString(b), "", true)
+		} else if v, ov := bindingString(b), bindingString(ob); v != ov {
+			d.add(ChangeBinding, path+"."+b.Id, v, ov, true)
+		}
+	}
+	for _, b := range olist {
+		if _, ok := myBindings[b.Id]; !ok {
+			d.add(ChangeBindingAdded, path+"."+b.Id,
+				"", bindingString(b), true)
+		}
+	}
+}
+
+// Get a single-line representation of the bound value.
+func bindingString(binding *BindStm) string {
+	if binding == nil || binding.Exp == nil {
+		return ""
+	}
+	var buf strings.Builder
+	if exp, ok := binding.Exp.(*ValExp); ok && binding.Sweep {
+		exp.formatSweep(&buf, "", "")
+	} else {
+		binding.Exp.format(&buf, "", "")
+	}
+	return strings.Replace(buf.String(), "\n", " ", -1)
+}
+
+func paramTypeString(param Param) string {
+	return typeString(param.GetTname(), param.GetArrayDim())
+}
+
+// Compare the types of two parameters.  Changes to file type names are not
+// breaking.
+func (d *differ) diffParamType(path string, param, other Param) {
+	if t, ot := paramTypeString(param), paramTypeString(other); t != ot {
+		d.add(ChangeParamType, path, t, ot,
+			param.IsFile() != other.IsFile() ||
+				param.GetArrayDim() != other.GetArrayDim() ||
+				!param.IsFile())
+	}
+}
+
+func (d *differ) diffInParams(id string, params, other *InParams) {
+	var list, olist []*InParam
+	if params != nil {
+		list = params.List
+	}
+	if other != nil {
+		olist = other.List
+	}
+	otherParams := make(map[string]*InParam, len(olist))
+	for _, p := range olist {
+		otherParams[p.Id] = p
+	}
+	myParams := make(map[string]struct{}, len(list))
+	for _, p := range list {
+		myParams[p.Id] = struct{}{}
+		path := id + "." + p.Id
+		if op := otherParams[p.Id]; op == nil {
+			d.add(ChangeParamRemoved, path, paramTypeString(p), "", true)
+		} else {
+			d.diffParamType(path, p, op)
+			if v, ov := defaultString(p.Default), defaultString(op.Default); v != ov {
+				d.add(ChangeParamDefault, path, v, ov, true)
+			}
+		}
+	}
+	for _, p := range olist {
+		if _, ok := myParams[p.Id]; !ok {
+			d.add(ChangeParamAdded, id+"."+p.Id,
+				"", paramTypeString(p), true)
+		}
+	}
+}
+
+func defaultString(exp *ValExp) string {
+	if exp == nil {
+		return ""
+	}
+	return bindingString(&BindStm{Exp: exp})
+}
+
+func (d *differ) diffOutParams(id string, params, other *OutParams,
+	checkOutNames bool) {
+	var list, olist []*OutParam
+	if params != nil {
+		list = params.List
+	}
+	if other != nil {
+		olist = other.List
+	}
+	otherParams := make(map[string]*OutParam, len(olist))
+	for _, p := range olist {
+		otherParams[p.Id] = p
+	}
+	myParams := make(map[string]struct{}, len(list))
+	for _, p := range list {
+		myParams[p.Id] = struct{}{}
+		path := id + "." + p.Id
+		if op := otherParams[p.Id]; op == nil {
+			d.add(ChangeParamRemoved, path, paramTypeString(p), "", true)
+		} else {
+			d.diffParamType(path, p, op)
+			if p.OutName != op.OutName {
+				d.add(ChangeParamOutName, path, p.OutName, op.OutName,
+					checkOutNames)
+			}
+		}
+	}
+	for _, p := range olist {
+		if _, ok := myParams[p.Id]; !ok {
+			d.add(ChangeParamAdded, id+"."+p.Id,
+				"", paramTypeString(p), true)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"testing"
+)
+
+func TestDiffIdentical(t *testing.T) {
+	t.Parallel()
+	if ast1, ast2 := testGood(t, fmtTestSrc), testGood(t, fmtTestSrc); ast1 != nil && ast2 != nil {
+		if changes := ast1.Diff(ast2); len(changes) != 0 {
+			t.Errorf("Expected no changes for identical source, got %v",
+				changes)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	ast1 := testGood(t, `
+filetype txt;
+filetype csv;
+
+stage SQUARE(
+    in  int value,
+    in  int offset,
+    out txt report,
+    out int square,
+    src py  "stages/square",
+) using (
+    mem_gb = 2,
+) env (
+    OMP_NUM_THREADS = "2",
+    LANG            = "C",
+)
+
+stage UNUSED(
+    src py "stages/unused",
+)
+
+pipeline SUM_SQUARES(
+    in  int a,
+    in  int b = 1,
+    out int sum,
+)
+{
+    call SQUARE(
+        value  = self.a,
+        offset = self.b,
+    )
+
+    return (
+        sum = SQUARE.square,
+    )
+}
+`)
+	ast2 := testGood(t, `
+filetype txt;
+filetype csv;
+
+stage SQUARE(
+    in  int   value,
+    in  int   offset,
+    out csv   report,
+    out float square,
+    src py    "stages/square",
+) using (
+    mem_gb = 4,
+) env (
+    OMP_NUM_THREADS = "4",
+)
+
+stage ADDED(
+    src py "stages/added",
+)
+
+pipeline SUM_SQUARES(
+    in  int   a,
+    in  int   b   = 2,
+    out float sum,
+)
+{
+    call SQUARE(
+        value  = self.b,
+        offset = self.a,
+    ) using (
+        local = true,
+    )
+
+    return (
+        sum = SQUARE.square,
+    )
+}
+`)
+	if ast1 == nil || ast2 == nil {
+		return
+	}
+	expect := []SemanticChange{
+		{
+			Kind: ChangeParamType,
+			Path: "SQUARE.report",
+			Old:  "txt",
+			New:  "csv",
+		},
+		{
+			Kind:     ChangeParamType,
+			Path:     "SQUARE.square",
+			Old:      "int",
+			New:      "float",
+			Breaking: true,
+		},
+		{
+			Kind: ChangeResources,
+			Path: "SQUARE.using.mem_gb",
+			Old:  "2",
+			New:  "4",
+		},
+		{
+			Kind: ChangeEnv,
+			Path: "SQUARE.env.LANG",
+			Old:  "C",
+		},
+		{
+			Kind: ChangeEnv,
+			Path: "SQUARE.env.OMP_NUM_THREADS",
+			Old:  "2",
+			New:  "4",
+		},
+		{
+			Kind:     ChangeCallableRemoved,
+			Path:     "UNUSED",
+			Breaking: true,
+		},
+		{
+			Kind:     ChangeParamDefault,
+			Path:     "SUM_SQUARES.b",
+			Old:      "1",
+			New:      "2",
+			Breaking: true,
+		},
+		{
+			Kind:     ChangeParamType,
+			Path:     "SUM_SQUARES.sum",
+			Old:      "int",
+			New:      "float",
+			Breaking: true,
+		},
+		{
+			Kind:     ChangeBinding,
+			Path:     "SUM_SQUARES.SQUARE.value",
+			Old:      "self.a",
+			New:      "self.b",
+			Breaking: true,
+		},
+		{
+			Kind:     ChangeBinding,
+			Path:     "SUM_SQUARES.SQUARE.offset",
+			Old:      "self.b",
+			New:      "self.a",
+			Breaking: true,
+		},
+		{
+			Kind:     ChangeModifier,
+			Path:     "SUM_SQUARES.SQUARE.using.local",
+			Old:      "false",
+			New:      "true",
+			Breaking: true,
+		},
+		{
+			Kind: ChangeCallableAdded,
+			Path: "ADDED",
+		},
+	}
+	changes := ast1.Diff(ast2)
+	if len(changes) != len(expect) {
+		t.Errorf("Expected %d changes, got %d", len(expect), len(changes))
+	}
+	for i, change := range changes {
+		if i >= len(expect) {
+			t.Errorf("Unexpected change %s", change.String())
+		} else if change != expect[i] {
+			t.Errorf("Expected %s, got %s",
+				expect[i].String(), change.String())
+		}
+	}
+}
@@ -18,6 +18,8 @@ const (
 	PythonStage
 	ExecStage
 	CompiledStage
+	DockerStage
+	PodmanStage
 )
 
 func (self StageCodeType) String() string {
@@ -28,15 +30,26 @@ func (self StageCodeType) String() string {
 		return "Executable"
 	case CompiledStage:
 		return "Compiled"
+	case DockerStage:
+		return "Docker"
+	case PodmanStage:
+		return "Podman"
 	default:
 		return ""
 	}
 }
 
+// IsContainer returns true for stages which run in a container image.
+func (self StageCodeType) IsContainer() bool {
+	return self == DockerStage || self == PodmanStage
+}
+
 const (
 	abr_python   = "py"
 	abr_exec     = "exec"
 	abr_compiled = "comp"
+	abr_docker   = "docker"
+	abr_podman   = "podman"
 )
 
 func (lang StageLanguage) Parse() (StageCodeType, error) {
@@ -47,6 +60,10 @@ func (lang StageLanguage) Parse() (StageCodeType, error) {
 		return ExecStage, nil
 	case abr_compiled:
 		return CompiledStage, nil
+	case abr_docker:
+		return DockerStage, nil
+	case abr_podman:
+		return PodmanStage, nil
 	default:
 		return UnknownStageLang, fmt.Errorf("Unknown language %v", lang)
 	}
@@ -68,6 +85,10 @@ func (self *StageCodeType) UnmarshalJSON(b []byte) error {
 		*self = ExecStage
 	case "Compiled":
 		*self = CompiledStage
+	case "Docker":
+		*self = DockerStage
+	case "Podman":
+		*self = PodmanStage
 	default:
 		*self = UnknownStageLang
 	}
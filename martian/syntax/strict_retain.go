@@ -0,0 +1,127 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Checks that file outputs are protected from VDR by a retain.
+
+package syntax
+
+// An output parameter of a stage or pipeline, or with a nil callable, an
+// input parameter of a pipeline.
+type retainKey struct {
+	callable Callable
+	id       string
+}
+
+type retainFinder struct {
+	global *Ast
+
+	// The outputs which are retained.
+	retained map[retainKey]struct{}
+
+	// The pipeline inputs referred to by retains.
+	inputs map[retainKey]struct{}
+}
+
+// CheckRetains reports an error for each stage output of file or path type
+// which is never retained.
+//
+// An output is retained if it is listed in the retain block of the stage,
+// or is referred to by the retain block of a pipeline, either directly or
+// through the outputs of sub-pipelines or the inputs of the pipeline.
+// Outputs which are not retained may be deleted by VDR as soon as the
+// stages which consume them have completed.
+//
+// Only retains in pipelines in this ast are considered, so an output which
+// is only retained by a pipeline declared in a file which is not included
+// is reported.  The ast must have been compiled.
+func (global *Ast) CheckRetains() error {
+	finder := retainFinder{
+		global:   global,
+		retained: make(map[retainKey]struct{}),
+		inputs:   make(map[retainKey]struct{}),
+	}
+	for _, stage := range global.Stages {
+		if stage.Retain != nil {
+			for _, param := range stage.Retain.Params {
+				finder.retained[retainKey{stage, param.Id}] = struct{}{}
+			}
+		}
+	}
+	for _, pipeline := range global.compiledPipelines() {
+		if pipeline.Retain != nil {
+			for _, ref := range pipeline.Retain.Refs {
+				finder.retainRef(pipeline, ref)
+			}
+		}
+	}
+	var errs ErrorList
+	for _, stage := range global.Stages {
+		for _, param := range stage.OutParams.List {
+			if !param.IsFile() {
+				continue
+			}
+			if _, ok := finder.retained[retainKey{stage, param.Id}]; !ok {
+				errs = append(errs, global.err(param,
+					"RetainError: output %s of stage %s is of file type, but is never retained",
+					param.Id, stage.Id))
+			}
+		}
+	}
+	return errs.If()
+}
+
+func (finder *retainFinder) retainRef(pipeline *Pipeline, ref *RefExp) {
+	switch ref.Kind {
+	case KindCall:
+		if callable := pipeline.Callables.Table[ref.Id]; callable != nil {
+			finder.retainOutput(callable, ref.OutputId)
+		}
+	case KindSelf:
+		key := retainKey{pipeline, ref.Id}
+		if _, ok := finder.inputs[key]; ok {
+			return
+		}
+		finder.inputs[key] = struct{}{}
+		// Retain whatever each caller binds to the input.
+		for _, caller := range finder.global.compiledPipelines() {
+			for _, call := range caller.Calls {
+				if call.DecId != pipeline.Id {
+					continue
+				}
+				if binding := call.Bindings.Table[ref.Id]; binding != nil {
+					finder.retainExp(caller, binding.Exp)
+				}
+			}
+		}
+	}
+}
+
+func (finder *retainFinder) retainOutput(callable Callable, id string) {
+	key := retainKey{callable, id}
+	if _, ok := finder.retained[key]; ok {
+		return
+	}
+	finder.retained[key] = struct{}{}
+	if pipeline, ok := callable.(*Pipeline); ok {
+		if binding := pipeline.Ret.Bindings.Table[id]; binding != nil {
+			finder.retainExp(pipeline, binding.Exp)
+		}
+	}
+}
+
+func (finder *retainFinder) retainExp(pipeline *Pipeline, exp Exp) {
+	switch exp := exp.(type) {
+	case *RefExp:
+		finder.retainRef(pipeline, exp)
+	case *ValExp:
+		switch v := exp.Value.(type) {
+		case []Exp:
+			for _, e := range v {
+				finder.retainExp(pipeline, e)
+			}
+		case map[string]Exp:
+			for _, e := range v {
+				finder.retainExp(pipeline, e)
+			}
+		}
+	}
+}
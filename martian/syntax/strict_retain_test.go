@@ -0,0 +1,179 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRetains(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, `
+filetype txt;
+
+stage MAKE(
+    in  int  count,
+    out txt  kept,
+    out txt  returned,
+    out path scratch,
+    out txt  unused,
+    out int  total,
+    src py   "stages/make",
+) retain (
+    kept,
+)
+
+stage COMBINE(
+    in  path[] inputs,
+    out txt    combined,
+    src py     "stages/combine",
+)
+
+pipeline INNER(
+    in  int  count,
+    out txt  returned,
+    out path scratch,
+)
+{
+    call MAKE(
+        count = self.count,
+    )
+
+    return (
+        returned = MAKE.returned,
+        scratch  = MAKE.scratch,
+    )
+}
+
+pipeline MERGE(
+    in  path[] inputs,
+    out txt    combined,
+)
+{
+    call COMBINE(
+        inputs = self.inputs,
+    )
+
+    return (
+        combined = COMBINE.combined,
+    )
+}
+
+pipeline OUTER(
+    in  int count,
+    out txt combined,
+)
+{
+    call INNER(
+        count = self.count,
+    )
+
+    call MERGE(
+        inputs = [INNER.scratch],
+    )
+
+    return (
+        combined = MERGE.combined,
+    )
+
+    retain (
+        INNER.returned,
+    )
+}
+`)
+	if ast == nil {
+		return
+	}
+	err := ast.CheckRetains()
+	if err == nil {
+		t.Fatal("Expected unretained outputs to be reported.")
+	}
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", err)
+	}
+	for i, id := range []string{"scratch", "unused", "combined"} {
+		if msg := errs[i].Error(); !strings.Contains(msg, "output "+id+" of") {
+			t.Errorf("Expected error %d to be for %s, got %s", i, id, msg)
+		}
+	}
+
+}
+
+func TestCheckRetainsInput(t *testing.T) {
+	t.Parallel()
+	// Retaining the input of a pipeline retains whatever the callers
+	// bind to it.
+	ast := testGood(t, `
+stage MAKE(
+    out file output,
+    src py   "stages/make",
+)
+
+stage CHECK(
+    in  file[] inputs,
+    out int    count,
+    src py     "stages/check",
+)
+
+pipeline VALIDATE(
+    in  file[] inputs,
+    out int    count,
+)
+{
+    call CHECK(
+        inputs = self.inputs,
+    )
+
+    return (
+        count = CHECK.count,
+    )
+
+    retain (
+        self.inputs,
+    )
+}
+
+pipeline OUTER(
+    out int count,
+)
+{
+    call MAKE()
+
+    call VALIDATE(
+        inputs = [MAKE.output],
+    )
+
+    return (
+        count = VALIDATE.count,
+    )
+}
+`)
+	if ast == nil {
+		return
+	}
+	if err := ast.CheckRetains(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParserStrictRetain(t *testing.T) {
+	t.Parallel()
+	src := []byte(`
+stage MAKE(
+    out file output,
+    src py   "stages/make",
+)
+`)
+	var parser Parser
+	if _, _, _, _, err := parser.ParseSourceBytes(src, "make.mro", nil, false); err != nil {
+		t.Error(err)
+	}
+	parser.StrictRetain = true
+	if _, _, _, _, err := parser.ParseSourceBytes(src, "make.mro", nil, false); err == nil {
+		t.Error("Expected an error in strict mode.")
+	} else if !strings.Contains(err.Error(), "RetainError") {
+		t.Errorf("Incorrect error %v", err)
+	}
+}
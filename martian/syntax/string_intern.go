@@ -27,6 +27,8 @@ func makeStringIntern() (v *stringIntern) {
 	v.internSet[abr_python] = abr_python
 	v.internSet[abr_exec] = abr_exec
 	v.internSet[abr_compiled] = abr_compiled
+	v.internSet[abr_docker] = abr_docker
+	v.internSet[abr_podman] = abr_podman
 	v.internSet[string(KindMap)] = string(KindMap)
 	v.internSet[string(KindFloat)] = string(KindFloat)
 	v.internSet[string(KindInt)] = string(KindInt)
@@ -21,6 +21,7 @@ var rules = [...]rule{
 	{regexp.MustCompile(`^\s+`), SKIP},      // whitespace
 	{regexp.MustCompile(`^#.*\n`), COMMENT}, // Python-style comments
 	{regexp.MustCompile(`^@include`), INCLUDE_DIRECTIVE},
+	{regexp.MustCompile(`^@deprecated\b`), DEPRECATED},
 	{regexp.MustCompile(`^=`), EQUALS},
 	{regexp.MustCompile(`^\(`), LPAREN},
 	{regexp.MustCompile(`^\)`), RPAREN},
@@ -32,8 +33,12 @@ var rules = [...]rule{
 	{regexp.MustCompile(`^;`), SEMICOLON},
 	{regexp.MustCompile(`^,`), COMMA},
 	{regexp.MustCompile(`^\.`), DOT},
+	{regexp.MustCompile(`^<`), LANGLE},
+	{regexp.MustCompile(`^>`), RANGLE},
 	{regexp.MustCompile(`^"[^\"]*"`), LITSTRING}, // double-quoted strings. escapes not supported
 	{regexp.MustCompile(`^filetype\b`), FILETYPE},
+	{regexp.MustCompile(`^enum\b`), ENUM},
+	{regexp.MustCompile(`^struct\b`), STRUCT},
 	{regexp.MustCompile(`^stage\b`), STAGE},
 	{regexp.MustCompile(`^pipeline\b`), PIPELINE},
 	{regexp.MustCompile(`^call\b`), CALL},
@@ -45,7 +50,13 @@ var rules = [...]rule{
 	{regexp.MustCompile(`^threads\b`), THREADS},
 	{regexp.MustCompile(`^mem_?gb\b`), MEM_GB},
 	{regexp.MustCompile(`^special\b`), SPECIAL},
+	{regexp.MustCompile(`^gpus\b`), GPUS},
+	{regexp.MustCompile(`^timeout\b`), TIMEOUT},
+	{regexp.MustCompile(`^retries\b`), RETRIES},
+	{regexp.MustCompile(`^disk_space_gb\b`), DISK_SPACE_GB},
+	{regexp.MustCompile(`^priority\b`), PRIORITY},
 	{regexp.MustCompile(`^retain\b`), RETAIN},
+	{regexp.MustCompile(`^env\b`), ENV},
 	{regexp.MustCompile(`^sweep\b`), SWEEP},
 	{regexp.MustCompile(`^split\b`), SPLIT},
 	{regexp.MustCompile(`^using\b`), USING},
@@ -58,6 +69,8 @@ var rules = [...]rule{
 	{regexp.MustCompile(`^` + abr_python + `\b`), PY},
 	{regexp.MustCompile(`^` + abr_exec + `\b`), EXEC},
 	{regexp.MustCompile(`^` + abr_compiled + `\b`), COMPILED},
+	{regexp.MustCompile(`^` + abr_docker + `\b`), DOCKER},
+	{regexp.MustCompile(`^` + abr_podman + `\b`), PODMAN},
 	{regexp.MustCompile(`^map\b`), MAP},
 	{regexp.MustCompile(`^int\b`), INT},
 	{regexp.MustCompile(`^string\b`), STRING},
@@ -20,6 +20,7 @@ func TestNextToken(t *testing.T) {
 	check("# this is a comment\n", COMMENT)
 	check(`"this/is/a/string"`, LITSTRING)
 	check(`@include`, INCLUDE_DIRECTIVE)
+	check(`@deprecated`, DEPRECATED)
 	check(`_INTERNAL_PIPELINE`, ID)
 	check(`_type_name`, ID)
 	check(`__type_name`, INVALID)
@@ -20,6 +20,35 @@ type (
 		Node AstNode
 		Id   string
 	}
+
+	// A user-defined record type, with a set of named, typed fields.
+	//
+	// Values of struct type are represented as JSON objects.
+	StructType struct {
+		Node   AstNode
+		Id     string
+		Fields []*StructField
+
+		// Lookup table of fields by Id.  Populated during compile.
+		Table map[string]*StructField `json:"-"`
+	}
+
+	// A user-defined type which may take one of a fixed set of string
+	// values.
+	EnumType struct {
+		Node   AstNode
+		Id     string
+		Values []string
+	}
+
+	// A field in a struct type.
+	StructField struct {
+		Node     AstNode
+		Tname    string
+		Id       string
+		Help     string
+		ArrayDim int16
+	}
 )
 
 var builtinTypes = [...]*BuiltinType{
@@ -32,7 +61,9 @@ var builtinTypes = [...]*BuiltinType{
 	{KindMap},
 }
 
-func (*UserType) getDec() {}
+func (*UserType) getDec()   {}
+func (*StructType) getDec() {}
+func (*EnumType) getDec()   {}
 
 func (s *BuiltinType) GetId() string { return s.Id }
 func (s *BuiltinType) IsFile() bool {
@@ -51,3 +82,43 @@ func (s *UserType) File() *SourceFile { return s.Node.Loc.File }
 
 func (s *UserType) inheritComments() bool     { return false }
 func (s *UserType) getSubnodes() []AstNodable { return nil }
+
+func (s *StructType) GetId() string     { return s.Id }
+func (s *StructType) IsFile() bool      { return false }
+func (s *StructType) getNode() *AstNode { return &s.Node }
+func (s *StructType) File() *SourceFile { return s.Node.Loc.File }
+
+func (s *StructType) inheritComments() bool { return false }
+func (s *StructType) getSubnodes() []AstNodable {
+	subs := make([]AstNodable, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		subs = append(subs, f)
+	}
+	return subs
+}
+
+func (s *EnumType) GetId() string             { return s.Id }
+func (s *EnumType) IsFile() bool              { return false }
+func (s *EnumType) getNode() *AstNode         { return &s.Node }
+func (s *EnumType) File() *SourceFile         { return s.Node.Loc.File }
+func (s *EnumType) inheritComments() bool     { return false }
+func (s *EnumType) getSubnodes() []AstNodable { return nil }
+
+// Returns true if the given value is one of the allowed values for the enum.
+func (s *EnumType) HasValue(value string) bool {
+	for _, v := range s.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *StructField) GetTname() string          { return s.Tname }
+func (s *StructField) GetArrayDim() int          { return int(s.ArrayDim) }
+func (s *StructField) GetId() string             { return s.Id }
+func (s *StructField) GetHelp() string           { return s.Help }
+func (s *StructField) getNode() *AstNode         { return &s.Node }
+func (s *StructField) File() *SourceFile         { return s.Node.Loc.File }
+func (s *StructField) inheritComments() bool     { return false }
+func (s *StructField) getSubnodes() []AstNodable { return nil }
@@ -0,0 +1,57 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Detection of stages and pipelines which are never called.
+
+package syntax
+
+// UnusedCallables returns the stages and pipelines, in declaration order,
+// which cannot be reached by following calls from a root.
+//
+// The roots are the top-level call, if there is one, and every callable
+// which is called as a preflight stage, since preflight checks are usually
+// kept around even when the pipelines which call them are not.  A generic
+// pipeline is used if any instance of it is used.
+//
+// The callable table must have been populated, which is the case for any
+// compiled AST.
+func (global *Ast) UnusedCallables() []Callable {
+	used := make(map[string]struct{}, len(global.Callables.Table))
+	var queue []Callable
+	visit := func(call *CallStm) {
+		for _, id := range [...]string{call.DecId, call.genericId()} {
+			if _, ok := used[id]; ok {
+				continue
+			}
+			used[id] = struct{}{}
+			if callable := global.Callables.Table[id]; callable != nil {
+				queue = append(queue, callable)
+			}
+		}
+	}
+	if global.Call != nil {
+		visit(global.Call)
+	}
+	for _, pipeline := range global.Pipelines {
+		for _, call := range pipeline.Calls {
+			if call.Modifiers != nil && call.Modifiers.Preflight {
+				visit(call)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		callable := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if pipeline, ok := callable.(*Pipeline); ok {
+			for _, call := range pipeline.Calls {
+				visit(call)
+			}
+		}
+	}
+	var unused []Callable
+	for _, callable := range global.Callables.List {
+		if _, ok := used[callable.GetId()]; !ok {
+			unused = append(unused, callable)
+		}
+	}
+	return unused
+}
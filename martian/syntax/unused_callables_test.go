@@ -0,0 +1,120 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"testing"
+)
+
+func checkUnusedCallables(t *testing.T, ast *Ast, expect ...string) {
+	t.Helper()
+	unused := ast.UnusedCallables()
+	if len(unused) != len(expect) {
+		t.Errorf("Expected %d unused callables, got %d", len(expect), len(unused))
+	}
+	for i, callable := range unused {
+		if i >= len(expect) {
+			t.Errorf("Unexpected unused callable %s", callable.GetId())
+		} else if callable.GetId() != expect[i] {
+			t.Errorf("Expected %s to be unused, got %s",
+				expect[i], callable.GetId())
+		}
+	}
+}
+
+func TestUnusedCallables(t *testing.T) {
+	t.Parallel()
+	const src = `
+stage CHECK(
+    in  int value,
+    src py  "stages/check",
+)
+
+stage SQUARE(
+    in  int value,
+    out int square,
+    src py  "stages/square",
+)
+
+stage ORPHAN(
+    src py "stages/orphan",
+)
+
+pipeline INNER(
+    in  int value,
+    out int square,
+)
+{
+    call SQUARE(
+        value = self.value,
+    )
+
+    return (
+        square = SQUARE.square,
+    )
+}
+
+pipeline OUTER(
+    in  int value,
+    out int square,
+)
+{
+    call INNER(
+        value = self.value,
+    )
+
+    return (
+        square = INNER.square,
+    )
+}
+
+pipeline OLD(
+    in  int value,
+    out int square,
+)
+{
+    call CHECK(
+        value = self.value,
+    ) using (
+        preflight = true,
+    )
+
+    call SQUARE(
+        value = self.value,
+    )
+
+    return (
+        square = SQUARE.square,
+    )
+}
+`
+	// Without a top-level call, only preflight stages are roots.
+	if ast := testGood(t, src); ast != nil {
+		checkUnusedCallables(t, ast,
+			"SQUARE", "ORPHAN", "INNER", "OUTER", "OLD")
+	}
+	// Calls are followed through nested pipelines.
+	if ast := testGood(t, src+`
+call OUTER(
+    value = 2,
+)
+`); ast != nil {
+		checkUnusedCallables(t, ast, "ORPHAN", "OLD")
+	}
+}
+
+func TestUnusedGenericCallables(t *testing.T) {
+	t.Parallel()
+	if ast := testGood(t, genericSrc); ast != nil {
+		checkUnusedCallables(t, ast, "ALIGN_READS", "ALIGN", "PROCESS", "MAIN")
+	}
+	// A generic pipeline is used if any instance of it is.
+	if ast := testGood(t, genericSrc+`
+call MAIN(
+    fq_reads  = [],
+    bam_reads = [],
+)
+`); ast != nil {
+		checkUnusedCallables(t, ast)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Detection of include directives which are not needed.
+
+package syntax
+
+import (
+	"path/filepath"
+)
+
+// Check for include directives which are not used by the file containing
+// them.  Under strict enforcement these are an error.  Otherwise, a warning
+// is issued.
+func (global *Ast) checkUnusedIncludes() error {
+	if GetEnforcementLevel() <= EnforceDisable {
+		return nil
+	}
+	var errs ErrorList
+	for _, inc := range global.unusedIncludes() {
+		if GetEnforcementLevel() >= EnforceError {
+			errs = append(errs, global.err(inc,
+				"UnusedIncludeError: nothing declared in '%s' is used",
+				inc.Value))
+		} else {
+			global.warn(inc,
+				"UnusedIncludeWarning: nothing declared in '%s' is used",
+				inc.Value)
+		}
+	}
+	return errs.If()
+}
+
+// Find include directives which are not used by the file containing them.
+//
+// An include is used if the including file refers to a type or callable
+// declared in the included file, or in any file transitively included by
+// it.  Wildcard includes are never reported as unused.
+//
+// The type and callable tables must have been populated.
+func (global *Ast) unusedIncludes() []*Include {
+	// The file included by each include directive, and the files directly
+	// included by each file.  These are taken from the IncludedFrom
+	// locations, rather than the include directives, so that files
+	// included through wildcards are accounted for.
+	targets := make(map[*SourceLoc]*SourceFile, len(global.Includes))
+	included := make(map[*SourceFile][]*SourceFile, len(global.Files))
+	for _, f := range global.Files {
+		for _, loc := range f.IncludedFrom {
+			targets[loc] = f
+			included[loc.File] = append(included[loc.File], f)
+		}
+	}
+	uses := global.fileReferences()
+	var unused []*Include
+	for _, inc := range global.Includes {
+		if isWildcardInclude(inc.Value) {
+			continue
+		}
+		target := targets[&inc.Node.Loc]
+		if target == nil {
+			continue
+		}
+		if !reachesAny(target, uses[inc.Node.Loc.File], included) {
+			unused = append(unused, inc)
+		}
+	}
+	return unused
+}
+
+// Returns true if any of the files in the given set are reachable from
+// the start file through the included map.
+func reachesAny(start *SourceFile, want map[*SourceFile]struct{},
+	included map[*SourceFile][]*SourceFile) bool {
+	if len(want) == 0 {
+		return false
+	}
+	seen := map[*SourceFile]struct{}{start: {}}
+	queue := []*SourceFile{start}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		if _, ok := want[f]; ok {
+			return true
+		}
+		for _, next := range included[f] {
+			if _, ok := seen[next]; !ok {
+				seen[next] = struct{}{}
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
+
+// For each source file, get the set of other files containing declarations
+// of types or callables which are referenced by declarations in that file.
+func (global *Ast) fileReferences() map[*SourceFile]map[*SourceFile]struct{} {
+	uses := make(map[*SourceFile]map[*SourceFile]struct{}, len(global.Files))
+	use := func(from *SourceFile, to *SourceFile) {
+		if from == nil || to == nil || from == to {
+			return
+		}
+		if m := uses[from]; m == nil {
+			uses[from] = map[*SourceFile]struct{}{to: {}}
+		} else {
+			m[to] = struct{}{}
+		}
+	}
+	// File types may be declared in more than one file.  A file which
+	// declares a file type itself does not need any other declaration of
+	// it.  Otherwise, any of the declarations will do.
+	userTypeFiles := make(map[string][]*SourceFile, len(global.UserTypes))
+	for _, t := range global.UserTypes {
+		userTypeFiles[t.Id] = append(userTypeFiles[t.Id], t.File())
+	}
+	useType := func(from *SourceFile, tname string) {
+		if files := userTypeFiles[tname]; len(files) > 0 {
+			for _, f := range files {
+				if f == from {
+					return
+				}
+			}
+			for _, f := range files {
+				use(from, f)
+			}
+		} else if t, ok := global.TypeTable[tname].(AstNodable); ok {
+			use(from, t.File())
+		}
+	}
+	useCallable := func(from *SourceFile, call *CallStm) {
+		if callable := global.Callables.Table[call.DecId]; callable != nil {
+			use(from, callable.File())
+		}
+	}
+	for _, structType := range global.StructTypes {
+		for _, field := range structType.Fields {
+			useType(structType.File(), field.Tname)
+		}
+	}
+	for _, callable := range global.Callables.List {
+		f := callable.File()
+		for _, param := range callable.GetInParams().List {
+			useType(f, param.Tname)
+		}
+		for _, param := range callable.GetOutParams().List {
+			useType(f, param.Tname)
+		}
+		switch c := callable.(type) {
+		case *Stage:
+			if c.ChunkIns != nil {
+				for _, param := range c.ChunkIns.List {
+					useType(f, param.Tname)
+				}
+			}
+			if c.ChunkOuts != nil {
+				for _, param := range c.ChunkOuts.List {
+					useType(f, param.Tname)
+				}
+			}
+		case *Pipeline:
+			for _, call := range c.Calls {
+				useCallable(f, call)
+			}
+		}
+	}
+	if global.Call != nil {
+		useCallable(global.Call.File(), global.Call)
+	}
+	return uses
+}
+
+// Remove includes from the top-level source which are not needed, without
+// adding any.
+func pruneIncludesTop(source *Ast, mropath []string, parser *Parser) error {
+	var srcFile *SourceFile
+	for _, f := range source.Files {
+		srcFile = f
+	}
+	incPaths := append([]string{filepath.Dir(srcFile.FullPath)}, mropath...)
+	seen := map[string]*SourceFile{srcFile.FullPath: srcFile}
+	closure, err := parser.getIncludes(srcFile, source.Includes,
+		incPaths, seen)
+	if err != nil {
+		return err
+	}
+	merged := source.copy()
+	if closure != nil {
+		merged.merge(closure)
+	}
+	uncheckedMakeTables(merged, nil)
+	unused := make(map[*Include]struct{})
+	for _, inc := range merged.unusedIncludes() {
+		if inc.Node.Loc.File == srcFile {
+			unused[inc] = struct{}{}
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+	// Grab the scope comments off the first node, so that we can reattach
+	// them after pruning.
+	scopeComments := source.Includes[0].Node.scopeComments
+	source.Includes[0].Node.scopeComments = nil
+	kept := make([]*Include, 0, len(source.Includes)-len(unused))
+	for _, inc := range source.Includes {
+		if _, ok := unused[inc]; !ok {
+			kept = append(kept, inc)
+		}
+	}
+	if len(kept) > 0 {
+		kept[0].Node.scopeComments = append(scopeComments,
+			kept[0].Node.scopeComments...)
+	}
+	source.Includes = kept
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Generic traversal of the AST.
+
+package syntax
+
+import (
+	"sort"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node AstNodable) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, in the style of go/ast.
+//
+// It starts by calling v.Visit(node); node must not be nil.  If the visitor
+// w returned by v.Visit(node) is not nil, Walk is invoked recursively with
+// visitor w for each of the non-nil children of node, followed by a call of
+// w.Visit(nil).
+//
+// Unlike the traversal used for attaching comments, this visits every
+// element of array and map values, and the default values of parameters.
+// Elements of map values are visited in order of their keys.
+func Walk(node AstNodable, v Visitor) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *StructType:
+		for _, f := range n.Fields {
+			Walk(f, v)
+		}
+
+	case *Stage:
+		walkInParams(n.InParams, v)
+		walkOutParams(n.OutParams, v)
+		if n.Src != nil {
+			Walk(n.Src, v)
+		}
+		walkInParams(n.ChunkIns, v)
+		walkOutParams(n.ChunkOuts, v)
+		if n.Resources != nil {
+			Walk(n.Resources, v)
+		}
+		if n.Env != nil {
+			Walk(n.Env, v)
+		}
+		if n.Retain != nil {
+			Walk(n.Retain, v)
+		}
+
+	case *Resources:
+		for _, sub := range n.getSubnodes() {
+			Walk(sub, v)
+		}
+
+	case *RetainParams:
+		for _, p := range n.Params {
+			Walk(p, v)
+		}
+
+	case *StageEnv:
+		for _, e := range n.Vars {
+			Walk(e, v)
+		}
+
+	case *Pipeline:
+		walkInParams(n.InParams, v)
+		walkOutParams(n.OutParams, v)
+		for _, call := range n.Calls {
+			Walk(call, v)
+		}
+		if n.Ret != nil {
+			Walk(n.Ret, v)
+		}
+		if n.Retain != nil {
+			Walk(n.Retain, v)
+		}
+
+	case *PipelineRetains:
+		for _, ref := range n.Refs {
+			Walk(ref, v)
+		}
+
+	case *InParam:
+		if n.Default != nil {
+			Walk(n.Default, v)
+		}
+
+	case *CallStm:
+		if n.Bindings != nil {
+			Walk(n.Bindings, v)
+		}
+		if n.Modifiers != nil && n.Modifiers.Bindings != nil {
+			Walk(n.Modifiers.Bindings, v)
+		}
+
+	case *ReturnStm:
+		if n.Bindings != nil {
+			Walk(n.Bindings, v)
+		}
+
+	case *BindStms:
+		for _, binding := range n.List {
+			Walk(binding, v)
+		}
+
+	case *BindStm:
+		if n.Exp != nil {
+			Walk(n.Exp, v)
+		}
+
+	case *ValExp:
+		switch val := n.Value.(type) {
+		case []Exp:
+			for _, exp := range val {
+				Walk(exp, v)
+			}
+		case map[string]Exp:
+			keys := make([]string, 0, len(val))
+			for key := range val {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				Walk(val[key], v)
+			}
+		}
+	}
+
+	v.Visit(nil)
+}
+
+func walkInParams(params *InParams, v Visitor) {
+	if params != nil {
+		for _, p := range params.List {
+			Walk(p, v)
+		}
+	}
+}
+
+func walkOutParams(params *OutParams, v Visitor) {
+	if params != nil {
+		for _, p := range params.List {
+			Walk(p, v)
+		}
+	}
+}
+
+// WalkAst calls Walk for each top-level node in the ast: includes, then
+// types, then callables, then the top-level call, if any.
+func WalkAst(global *Ast, v Visitor) {
+	for _, n := range global.getSubnodes() {
+		Walk(n, v)
+	}
+}
+
+type inspector func(AstNodable) bool
+
+func (f inspector) Visit(node AstNodable) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, in the style of go/ast.
+//
+// It starts by calling f(node); node must not be nil.  If f returns true,
+// Inspect invokes f recursively for each of the non-nil children of node,
+// followed by a call of f(nil).  Returning false prunes the subtree.  This
+// makes it easy to, for example, find every RefExp in a pipeline.
+func Inspect(node AstNodable, f func(AstNodable) bool) {
+	Walk(node, inspector(f))
+}
+
+// InspectAst calls Inspect for each top-level node in the ast, in the same
+// order as WalkAst.
+func InspectAst(global *Ast, f func(AstNodable) bool) {
+	WalkAst(global, inspector(f))
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"fmt"
+	"testing"
+)
+
+const walkTestSrc = `
+filetype txt;
+
+enum Color(
+    "red",
+    "blue",
+)
+
+struct Point(
+    int x,
+    int y,
+)
+
+stage SPLIT_STAGE(
+    in  txt[] inputs,
+    in  Color color   = "red",
+    in  map   options = {"a": [1, 2]},
+    out Point point,
+    out txt   report,
+    src py    "stages/split",
+) split (
+    in  txt   chunk_input,
+    out int   chunk_output,
+) using (
+    mem_gb  = 2,
+    threads = 1,
+) retain (
+    report,
+)
+
+pipeline PIPE(
+    in  txt[] inputs,
+    out Point point,
+)
+{
+    call SPLIT_STAGE(
+        inputs = self.inputs,
+    ) using (
+        volatile = true,
+    )
+
+    return (
+        point = SPLIT_STAGE.point,
+    )
+
+    retain (
+        SPLIT_STAGE.report,
+    )
+}
+
+call PIPE(
+    inputs = ["a.txt"],
+)
+`
+
+type recordingVisitor struct {
+	seen  map[string]int
+	depth int
+	max   int
+	prune string
+}
+
+func (v *recordingVisitor) Visit(node AstNodable) Visitor {
+	if node == nil {
+		v.depth--
+		return nil
+	}
+	name := fmt.Sprintf("%T", node)
+	v.seen[name]++
+	if name == v.prune {
+		return nil
+	}
+	v.depth++
+	if v.depth > v.max {
+		v.max = v.depth
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, walkTestSrc)
+	if ast == nil {
+		return
+	}
+	v := recordingVisitor{seen: make(map[string]int)}
+	WalkAst(ast, &v)
+	if v.depth != 0 {
+		t.Errorf("Unbalanced visit: depth %d after walk.", v.depth)
+	}
+	for name, count := range map[string]int{
+		"*syntax.UserType":        1,
+		"*syntax.EnumType":        1,
+		"*syntax.StructType":      1,
+		"*syntax.StructField":     2,
+		"*syntax.Stage":           1,
+		"*syntax.InParam":         5,
+		"*syntax.OutParam":        4,
+		"*syntax.SrcParam":        1,
+		"*syntax.Resources":       1,
+		"*syntax.AstNode":         2,
+		"*syntax.RetainParams":    1,
+		"*syntax.RetainParam":     1,
+		"*syntax.Pipeline":        1,
+		"*syntax.CallStm":         2,
+		"*syntax.BindStms":        4,
+		"*syntax.BindStm":         6,
+		"*syntax.ReturnStm":       1,
+		"*syntax.PipelineRetains": 1,
+		// The two defaults, including the array and its elements within
+		// the map (5), the volatile modifier (1), the top-level call
+		// array and element (2), and the defaults bound in the call (5).
+		"*syntax.ValExp": 13,
+		"*syntax.RefExp": 3,
+	} {
+		if c := v.seen[name]; c != count {
+			t.Errorf("Expected to visit %d %s, saw %d", count, name, c)
+		}
+	}
+
+	v = recordingVisitor{seen: make(map[string]int), prune: "*syntax.Pipeline"}
+	WalkAst(ast, &v)
+	if v.depth != 0 {
+		t.Errorf("Unbalanced visit: depth %d after walk.", v.depth)
+	}
+	if c := v.seen["*syntax.RefExp"]; c != 0 {
+		t.Errorf("Expected pruned pipeline contents to be skipped, saw %d refs", c)
+	}
+	if c := v.seen["*syntax.CallStm"]; c != 1 {
+		t.Errorf("Expected only the top-level call to be visited, saw %d", c)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, walkTestSrc)
+	if ast == nil {
+		return
+	}
+	var refs []string
+	InspectAst(ast, func(n AstNodable) bool {
+		if ref, ok := n.(*RefExp); ok {
+			refs = append(refs, ref.Id+"."+ref.OutputId)
+		}
+		return true
+	})
+	if len(refs) != 3 {
+		t.Errorf("Expected 3 references, found %v", refs)
+	} else if refs[0] != "inputs." || refs[1] != "SPLIT_STAGE.point" ||
+		refs[2] != "SPLIT_STAGE.report" {
+		t.Errorf("Incorrect references %v", refs)
+	}
+
+	// Prune everything but the stage.
+	var params int
+	InspectAst(ast, func(n AstNodable) bool {
+		switch n.(type) {
+		case *Stage:
+			return true
+		case *InParam, *OutParam:
+			params++
+		}
+		return false
+	})
+	if params != 7 {
+		t.Errorf("Expected 7 stage params, found %d", params)
+	}
+}
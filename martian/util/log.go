@@ -12,6 +12,7 @@ import (
 	"io"
 	golog "log"
 	"os"
+	"sync/atomic"
 )
 
 // StringWriter is the interface for writers which can write
@@ -163,6 +164,57 @@ func LogTeeWriter(writer StringWriter) {
 	}
 }
 
+// StructuredLogger is the interface for loggers which take a message
+// followed by alternating keys and values.  *slog.Logger implements it.
+type StructuredLogger interface {
+	Info(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Holds the structured logger, since an atomic.Value must always hold the
+// same concrete type.
+type structuredLoggerBox struct {
+	logger StructuredLogger
+}
+
+var structuredLogger atomic.Value
+
+// Send the output of the LogInfo, LogError, PrintInfo, and PrintError
+// methods, and their Attrs variants, to the given structured logger
+// instead of the log file.  The Print methods still print the formatted
+// message to standard output.  Passing nil restores the default behavior.
+func SetStructuredLogger(logger StructuredLogger) {
+	structuredLogger.Store(structuredLoggerBox{logger})
+}
+
+func getStructuredLogger() StructuredLogger {
+	if box, ok := structuredLogger.Load().(structuredLoggerBox); ok {
+		return box.logger
+	}
+	return nil
+}
+
+func logStructuredInfo(logger StructuredLogger, attrs []interface{},
+	component string, format string, v ...interface{}) {
+	logger.Info(fmt.Sprintf(format, v...),
+		append([]interface{}{"component", component}, attrs...)...)
+}
+
+func logStructuredError(logger StructuredLogger, err error,
+	component string, format string, v ...interface{}) {
+	args := append(append(make([]interface{}, 0, len(v)+1), v...), err.Error())
+	logger.Error(fmt.Sprintf(format+": %s", args...),
+		"component", component, "error", err.Error())
+}
+
+// Print a message to standard output only, for the Print methods when a
+// structured logger is in use.
+func printStdout(format func(io.Writer)) {
+	if logInit() {
+		format(LOGGER.stdoutWriter)
+	}
+}
+
 func formatInfo(w io.Writer, component string, format string, v ...interface{}) {
 	fmt.Fprintf(w, "%s [%s] %s\n", Timestamp(), component, fmt.Sprintf(format, v...))
 }
@@ -187,6 +239,17 @@ func Log(format string, v ...interface{}) {
 // is intended to indicate the source of the message and should be a consistent
 // length.  By convention, this length is 7 characters.
 func LogInfo(component string, format string, v ...interface{}) {
+	LogInfoAttrs(component, nil, format, v...)
+}
+
+// Like LogInfo, but with alternating keys and values describing the
+// message, which are used if a structured logger has been set with
+// SetStructuredLogger and otherwise ignored.
+func LogInfoAttrs(component string, attrs []interface{}, format string, v ...interface{}) {
+	if logger := getStructuredLogger(); logger != nil {
+		logStructuredInfo(logger, attrs, component, format, v...)
+		return
+	}
 	formatInfo(logWriter, component, format, v...)
 }
 
@@ -195,6 +258,10 @@ func LogInfo(component string, format string, v ...interface{}) {
 // the message and should be a consistent length.  By convention, this length
 // is 7 characters.
 func LogError(err error, component string, format string, v ...interface{}) {
+	if logger := getStructuredLogger(); logger != nil {
+		logStructuredError(logger, err, component, format, v...)
+		return
+	}
 	formatError(logWriter, err, component, format, v...)
 }
 
@@ -209,11 +276,26 @@ func Println(format string, v ...interface{}) {
 
 // Like LogInfo but also prints to standard output.
 func PrintInfo(component string, format string, v ...interface{}) {
+	PrintInfoAttrs(component, nil, format, v...)
+}
+
+// Like LogInfoAttrs but also prints to standard output.
+func PrintInfoAttrs(component string, attrs []interface{}, format string, v ...interface{}) {
+	if logger := getStructuredLogger(); logger != nil {
+		printStdout(func(w io.Writer) { formatInfo(w, component, format, v...) })
+		logStructuredInfo(logger, attrs, component, format, v...)
+		return
+	}
 	formatInfo(printWriter, component, format, v...)
 }
 
 // Like LogError but also prints to standard output.
 func PrintError(err error, component string, format string, v ...interface{}) {
+	if logger := getStructuredLogger(); logger != nil {
+		printStdout(func(w io.Writer) { formatError(w, err, component, format, v...) })
+		logStructuredError(logger, err, component, format, v...)
+		return
+	}
 	formatError(printWriter, err, component, format, v...)
 }
 
@@ -0,0 +1,64 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testStructuredLogger struct {
+	messages []string
+	args     [][]interface{}
+}
+
+func (self *testStructuredLogger) Info(msg string, args ...interface{}) {
+	self.messages = append(self.messages, "INFO "+msg)
+	self.args = append(self.args, args)
+}
+
+func (self *testStructuredLogger) Error(msg string, args ...interface{}) {
+	self.messages = append(self.messages, "ERROR "+msg)
+	self.args = append(self.args, args)
+}
+
+func TestStructuredLogger(t *testing.T) {
+	logger := new(testStructuredLogger)
+	var stdout bytes.Buffer
+	oldLogger := LOGGER
+	LOGGER = &Logger{stdoutWriter: &stdout}
+	defer func() { LOGGER = oldLogger }()
+	SetStructuredLogger(logger)
+	defer SetStructuredLogger(nil)
+
+	LogInfo("runtime", "a %d", 1)
+	PrintInfoAttrs("runtime", []interface{}{"fqname", "ID.test"},
+		"b %s", "ID.test")
+	LogError(fmt.Errorf("oops"), "jobmngr", "c %d", 2)
+	if expect := []string{
+		"INFO a 1",
+		"INFO b ID.test",
+		"ERROR c 2: oops",
+	}; !reflect.DeepEqual(logger.messages, expect) {
+		t.Errorf("Expected %v, got %v", expect, logger.messages)
+	}
+	if expect := [][]interface{}{
+		{"component", "runtime"},
+		{"component", "runtime", "fqname", "ID.test"},
+		{"component", "jobmngr", "error", "oops"},
+	}; !reflect.DeepEqual(logger.args, expect) {
+		t.Errorf("Expected %v, got %v", expect, logger.args)
+	}
+	// Print messages still go to standard output, but nothing goes to the
+	// log file.
+	if s := stdout.String(); !strings.HasSuffix(s, " [runtime] b ID.test\n") ||
+		strings.Count(s, "\n") != 1 {
+		t.Errorf("Incorrect output %q", s)
+	}
+	if LOGGER.cache.Len() != 0 {
+		t.Errorf("Unexpected log output %q", LOGGER.cache.String())
+	}
+}
@@ -11,7 +11,7 @@ syn keyword filetype  filetype nextgroup=parType skipwhite
 syn keyword parameter in out  nextgroup=parType skipwhite contained
 syn keyword src       src nextgroup=srctype skipwhite contained
 syn keyword srctype   py comp exe nextgroup=mroString contained skipwhite
-syn keyword restype   mem_gb threads special volatile nextgroup=assign contained skipwhite
+syn keyword restype   mem_gb threads special retries timeout disk_space_gb priority volatile nextgroup=assign contained skipwhite
 syn keyword modifier  local preflight volatile nextgroup=modifier,callTarg skipwhite contained
 syn keyword boundMod  local preflight volatile disabled nextgroup=assign contained skipwhite
 syn keyword sweep     sweep nextgroup=sweepArray contained
@@ -26,6 +26,7 @@ syn keyword mroBool  true false contained
 syn keyword split      split  nextgroup=splitUsing,paramBlock skipwhite contained
 syn keyword splitUsing using  nextgroup=paramBlock skipwhite contained
 syn keyword using      using  nextgroup=resParams  skipwhite contained
+syn keyword env        env    nextgroup=envParams  skipwhite contained
 syn keyword retain     retain nextgroup=idList     skipwhite contained
 syn keyword callUsing  using  nextgroup=modBlock   skipwhite contained
 syn keyword as         as     nextgroup=callTarg   skipwhite contained
@@ -47,9 +48,10 @@ syn match commentLine '#.*$'
 syn match mroNumber '\v<\d+>' contained skipwhite nextgroup=mapSep
 syn match mroNumber '\v<\d+\.\d+>' contained skipwhite nextgroup=mapSep
 
-syn region paramBlock start="(" end=")" fold transparent nextgroup=split,using,retain,callBlock skipwhite skipnl contained contains=parameter,src
+syn region paramBlock start="(" end=")" fold transparent nextgroup=split,using,env,retain,callBlock skipwhite skipnl contained contains=parameter,src
 syn region callParams start="(" end=")" fold transparent nextgroup=callUsing,retain skipwhite contained contains=assignment
-syn region resParams  start="(" end=")" fold transparent nextgroup=retain contained skipwhite skipnl contains=restype
+syn region resParams  start="(" end=")" fold transparent nextgroup=env,retain contained skipwhite skipnl contains=restype
+syn region envParams  start="(" end=")" fold transparent nextgroup=retain contained skipwhite skipnl contains=assignment
 syn region idList     start="(" end=")" fold transparent contained contains=parName
 syn region modBlock   start="(" end=")" fold transparent contained contains=boundMod
 syn region callBlock  start="{" end="}" fold transparent contains=call,return contained skipwhite
@@ -80,6 +82,7 @@ hi def link boundMod      Keyword
 hi def link self          Keyword
 hi def link sweep         Keyword
 hi def link using         Statement
+hi def link env           Statement
 hi def link retain        Statement
 
 hi def link parType       Type